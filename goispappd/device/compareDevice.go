@@ -35,20 +35,12 @@ func (d *Device) Compare(other *Device) *soap.SetParameterValues {
 
 	// Build SetParameterValues response
 	result := &soap.SetParameterValues{
-		ParameterList: struct {
-			Params []struct {
-				Name  string `xml:"cwmp:Name"`
-				Value string `xml:"cwmp:Value"`
-			} `xml:"cwmp:ParameterValueStruct"`
-		}{},
-		ParameterKey: fmt.Sprintf("Compare_%d_changes", len(differences)),
+		ParameterList: soap.SetParameterList{},
+		ParameterKey:  fmt.Sprintf("Compare_%d_changes", len(differences)),
 	}
 
 	// Convert our internal format to SOAP format
-	result.ParameterList.Params = make([]struct {
-		Name  string `xml:"cwmp:Name"`
-		Value string `xml:"cwmp:Value"`
-	}, len(differences))
+	result.ParameterList.Params = make([]soap.SetParameterValueStruct, len(differences))
 
 	for i, diff := range differences {
 		result.ParameterList.Params[i].Name = diff.Name
@@ -112,10 +104,14 @@ func buildFieldPath(pathPrefix, fieldName string, fieldType reflect.Type) string
 			fieldName = "AssociatedDevices"
 		case "IPv4Address":
 			fieldName = "IPv4Addresses"
+		case "IPv6Address":
+			fieldName = "IPv6Addresses"
 		case "Router":
 			fieldName = "Routers"
 		case "IPv4Forwarding":
 			fieldName = "IPv4Forwardings"
+		case "IPv6Forwarding":
+			fieldName = "IPv6Forwardings"
 			// Add more mappings as needed based on the Device struct
 		}
 	}
@@ -55,20 +55,12 @@ func (dev *Device) CompareEnvelope(_envelope *soap.GetParameterValuesResponse) (
 
 	// Build SetParameterValues response
 	result := &soap.SetParameterValues{
-		ParameterList: struct {
-			Params []struct {
-				Name  string `xml:"cwmp:Name"`
-				Value string `xml:"cwmp:Value"`
-			} `xml:"cwmp:ParameterValueStruct"`
-		}{},
-		ParameterKey: "EnvelopeCompare_" + strconv.Itoa(len(differences)) + "_changes",
+		ParameterList: soap.SetParameterList{},
+		ParameterKey:  "EnvelopeCompare_" + strconv.Itoa(len(differences)) + "_changes",
 	}
 
 	// Convert our internal format to SOAP format
-	result.ParameterList.Params = make([]struct {
-		Name  string `xml:"cwmp:Name"`
-		Value string `xml:"cwmp:Value"`
-	}, len(differences))
+	result.ParameterList.Params = make([]soap.SetParameterValueStruct, len(differences))
 
 	for i, diff := range differences {
 		result.ParameterList.Params[i].Name = diff.Name
@@ -233,10 +225,14 @@ func replacePluralWithSingular(pathPrefix string) string {
 		singularName = "AssociatedDevice"
 	case "IPv4Addresses":
 		singularName = "IPv4Address"
+	case "IPv6Addresses":
+		singularName = "IPv6Address"
 	case "Routers":
 		singularName = "Router"
 	case "IPv4Forwardings":
 		singularName = "IPv4Forwarding"
+	case "IPv6Forwardings":
+		singularName = "IPv6Forwarding"
 	default:
 		// Default: remove 's' if it ends with 's'
 		if strings.HasSuffix(lastPart, "s") && len(lastPart) > 1 {
@@ -22,6 +22,7 @@ type Device struct {
 	DNS                           DNSDevice                // DNS client configuration.
 	DHCPv4                        DHCPv4Device             // DHCPv4 client and server configuration.
 	Firewall                      FirewallDevice           // Firewall configuration (standard and Mikrotik extensions).
+	SoftwareModules               SoftwareModulesDevice    // Installed packages and services managed via ChangeDUState.
 	WAN                           WANDevice                // WAN device configuration and status.
 	X_ISPAPP_Interface            XMikrotikInterfaceDevice // Mikrotik generic interfaces.
 	X_ISPAPP_Monitor              XMikrotikMonitorDevice   // Mikrotik traffic monitoring.
@@ -240,8 +241,9 @@ type CarrierInfo5G struct {
 
 // SIMCard holds information about the Universal Subscriber Identity Module (USIM).
 type SIMCard struct {
-	IMSI  string // International Mobile Subscriber Identity.
-	ICCID string // Integrated Circuit Card Identifier.
+	Status string // Card status (None, Available, Valid, Blocked, Error).
+	IMSI   string // International Mobile Subscriber Identity.
+	ICCID  string // Integrated Circuit Card Identifier.
 }
 
 // CellularAccessPoint defines the configuration for a cellular Access Point Name (APN).
@@ -262,11 +264,13 @@ type EthernetDevice struct {
 
 // EthernetLink represents a layer 2 Ethernet link/connection
 type EthernetLink struct {
-	Index       int    // TR-069 index for this link
-	Enable      bool   // Administrative status.
-	Status      string // Operational status (Up, Down, etc.).
-	LowerLayers string // Reference to underlying physical interface.
-	// MACAddress not in the reference, but likely needed
+	Index       int            // TR-069 index for this link
+	Enable      bool           // Administrative status.
+	Status      string         // Operational status (Up, Down, etc.).
+	Name        string         // Linux device of the link, e.g. br-lan.
+	LowerLayers string         // Reference to underlying physical interface.
+	MACAddress  string         // MAC address of the link.
+	Stats       InterfaceStats // Link statistics.
 }
 
 // EthernetInterface represents a physical Ethernet port and its status.
@@ -274,10 +278,13 @@ type EthernetInterface struct {
 	Index              int            // TR-069 index for this interface
 	Enable             bool           // Administrative status.
 	Status             string         // Operational status (Up, Down, etc.).
+	Name               string         // Linux device of the port, e.g. lan1.
 	LowerLayers        string         // Reference to lower layers (usually empty for physical Ethernet).
 	MACAddress         string         // Burned-in MAC address of the interface.
+	MaxBitRate         int            // Highest supported speed in Mbps, -1 when unknown.
 	CurrentBitRate     int            // Current negotiated speed in Mbps.
-	X_ISPAPP_LinkDowns int            // Number of link down events since boot.
+	DuplexMode         string         // Negotiated duplex mode (Half, Full, Auto).
+	X_ISPAPP_LinkDowns int            // Number of link down events since the daemon started.
 	X_ISPAPP_Name      string         // Interface name in RouterOS.
 	X_ISPAPP_Comment   string         // User comment for the interface.
 	Stats              InterfaceStats // Interface statistics.
@@ -452,8 +459,11 @@ type PPPInterface struct {
 	Index              int            // TR-069 index for this interface
 	Enable             bool           // Administrative status.
 	Status             string         // Operational status (Up, Down, etc.).
+	Name               string         // Name of the PPP device, e.g. pppoe-wan.
 	LowerLayers        string         // Reference to the lower layer interface (e.g., Ethernet Link, Cellular).
 	ConnectionStatus   string         // PPP connection state (Connecting, Connected, Disconnected, etc.).
+	LCPEcho            int            // Seconds between LCP echo requests (0=disabled).
+	LCPEchoRetry       int            // Unanswered LCP echo requests before the link is considered down.
 	AutoDisconnectTime int            // Time in seconds after connection before auto-disconnect (0=disabled).
 	IdleDisconnectTime int            // Time in seconds of inactivity before auto-disconnect (0=disabled).
 	Username           string         // Username for PPP authentication.
@@ -490,10 +500,14 @@ type IPInterface struct {
 	Index                      int                // TR-069 index for this interface
 	Enable                     bool               // Administrative status.
 	Status                     string             // Operational status (Up, Down, etc.).
+	Name                       string             // Name of the netifd interface, e.g. lan.
 	LowerLayers                string             // Reference to the lower layer interface (e.g., Ethernet Link, PPP).
 	Type                       string             // Type of IP interface (Normal, Loopback, Tunnel, Tunneled).
+	X_ISPAPP_Device            string             // Linux device carrying the interface, e.g. br-lan.
 	IPv4AddressNumberOfEntries int                // Number of entries in IPv4Address table
 	IPv4Addresses              []IPv4AddressEntry // List of configured IPv4 addresses.
+	IPv6AddressNumberOfEntries int                // Number of entries in IPv6Address table
+	IPv6Addresses              []IPv6AddressEntry // List of configured IPv6 addresses.
 }
 
 // IPv4AddressEntry represents a single IPv4 address configuration on an IP interface.
@@ -503,15 +517,30 @@ type IPv4AddressEntry struct {
 	Status         string // Operational status (Enabled, Disabled, Error).
 	IPAddress      string // The IPv4 address.
 	SubnetMask     string // The subnet mask.
-	AddressingType string // How the address was assigned (Static, DHCP, IPCP, X_ISPAPP_Dynamic).
+	AddressingType string // How the address was assigned (Static, DHCP, IPCP, AutoIP, X_ISPAPP_Dynamic).
+}
+
+// IPv6AddressEntry represents a single IPv6 address configuration on an IP interface.
+type IPv6AddressEntry struct {
+	Index             int    // TR-069 index for this address entry
+	Enable            bool   // Administrative status.
+	Status            string // Operational status (Enabled, Disabled, Error).
+	IPAddressStatus   string // Address state (Preferred, Deprecated, Invalid, Unknown).
+	IPAddress         string // The IPv6 address.
+	Origin            string // How the address was assigned (AutoConfigured, DHCPv6, Static).
+	PreferredLifetime string // When the address stops being preferred (dateTime).
+	ValidLifetime     string // When the address stops being valid (dateTime).
 }
 
 // IPDiagnostics contains parameters for running IP layer diagnostic tests.
 type IPDiagnostics struct {
-	IPPing              IPPingDiagnostics     // IP Ping test parameters and results.
-	TraceRoute          TraceRouteDiagnostics // Trace Route test parameters and results.
-	DownloadDiagnostics DownloadDiagnostics   // Download test parameters and results.
-	UploadDiagnostics   UploadDiagnostics     // Upload test parameters and results.
+	IPPing                     IPPingDiagnostics          // IP Ping test parameters and results.
+	TraceRoute                 TraceRouteDiagnostics      // Trace Route test parameters and results.
+	DownloadDiagnostics        DownloadDiagnostics        // Download test parameters and results.
+	UploadDiagnostics          UploadDiagnostics          // Upload test parameters and results.
+	UDPEchoConfig              UDPEchoConfig              // UDP echo responder configuration and statistics.
+	UDPEchoDiagnostics         UDPEchoDiagnostics         // UDP echo test parameters and results.
+	ServerSelectionDiagnostics ServerSelectionDiagnostics // Server selection test parameters and results.
 }
 
 // IPPingDiagnostics holds configuration and results for an IP Ping test.
@@ -627,6 +656,74 @@ type PerConnectionUploadResult struct {
 	TCPOpenResponseTime string // TCP connection response time (UTC).
 }
 
+// UDPEchoConfig configures the UDP echo responder of the CPE, the target of TR-143 UDP echo tests.
+type UDPEchoConfig struct {
+	Enable                  bool   // Enables the responder.
+	Interface               string // Interface to listen on (empty for all).
+	SourceIPAddress         string // Only packets from this address are answered (empty for any).
+	UDPPort                 int    // UDP port to listen on.
+	EchoPlusEnabled         bool   // Fills in the UDPEchoPlus fields of the answers.
+	EchoPlusSupported       bool   // UDPEchoPlus is supported.
+	PacketsReceived         int    // Packets received since the responder was enabled.
+	PacketsResponded        int    // Packets answered since the responder was enabled.
+	BytesReceived           int    // UDP payload bytes received.
+	BytesResponded          int    // UDP payload bytes answered.
+	TimeFirstPacketReceived string // Time the first packet was received (UTC).
+	TimeLastPacketReceived  string // Time the last packet was received (UTC).
+}
+
+// UDPEchoDiagnostics holds configuration and results for a UDP echo test.
+type UDPEchoDiagnostics struct {
+	DiagnosticsState                      string                    // State of the diagnostic.
+	Interface                             string                    // Interface to perform the test over.
+	Host                                  string                    // Target host name or IP address.
+	Port                                  int                       // Target UDP port.
+	NumberOfRepetitions                   int                       // Number of packets to send.
+	Timeout                               int                       // Timeout in milliseconds per packet.
+	DataBlockSize                         int                       // Size of the UDP payload in bytes.
+	DSCP                                  int                       // DSCP value for test packets.
+	InterTransmissionTime                 int                       // Time between packets in milliseconds.
+	ProtocolVersion                       string                    // Any, IPv4 or IPv6.
+	IPAddressUsed                         string                    // Address the test was run against.
+	SuccessCount                          int                       // Number of answered packets.
+	FailureCount                          int                       // Number of lost packets.
+	AverageResponseTime                   int                       // Average RTT in milliseconds.
+	MinimumResponseTime                   int                       // Minimum RTT in milliseconds.
+	MaximumResponseTime                   int                       // Maximum RTT in milliseconds.
+	EnableIndividualPacketResults         bool                      // Flag to enable per-packet results.
+	IndividualPacketResultNumberOfEntries int                       // Number of entries in IndividualPacketResult table
+	IndividualPacketResult                []UDPEchoIndividualResult // Results per packet.
+}
+
+// UDPEchoIndividualResult holds the result of a single UDP echo packet.
+type UDPEchoIndividualResult struct {
+	PacketSuccess             bool   // The packet was answered.
+	PacketSendTime            string // Send time (UTC).
+	PacketReceiveTime         string // Receive time of the answer (UTC).
+	TestGenSN                 int    // Sequence number set by the CPE.
+	TestRespSN                int    // Sequence number set by the responder.
+	TestRespRcvTimeStamp      int    // Receive timestamp of the responder in microseconds.
+	TestRespReplyTimeStamp    int    // Reply timestamp of the responder in microseconds.
+	TestRespReplyFailureCount int    // Failed replies counted by the responder.
+}
+
+// ServerSelectionDiagnostics holds configuration and results for a server selection test.
+type ServerSelectionDiagnostics struct {
+	DiagnosticsState    string // State of the diagnostic.
+	Interface           string // Interface to perform the test over.
+	ProtocolVersion     string // Any, IPv4 or IPv6.
+	Protocol            string // ICMP or UDP Echo.
+	HostList            string // Comma-separated candidate hosts.
+	Port                int    // Target UDP port for UDP Echo.
+	NumberOfRepetitions int    // Number of probes per host.
+	Timeout             int    // Timeout in milliseconds per probe.
+	FastestHost         string // Host with the lowest average response time.
+	MinimumResponseTime int    // Minimum RTT of FastestHost in microseconds.
+	AverageResponseTime int    // Average RTT of FastestHost in microseconds.
+	MaximumResponseTime int    // Maximum RTT of FastestHost in microseconds.
+	IPAddressUsed       string // Address of FastestHost the test was run against.
+}
+
 // RoutingDevice aggregates routing configurations.
 type RoutingDevice struct {
 	RouterNumberOfEntries int      // Number of entries in Router table
@@ -640,6 +737,8 @@ type Router struct {
 	Status                        string                // Operational status (Enabled, Disabled, Error).
 	IPv4ForwardingNumberOfEntries int                   // Number of entries in IPv4Forwarding table
 	IPv4Forwarding                []IPv4ForwardingEntry // IPv4 routing table entries.
+	IPv6ForwardingNumberOfEntries int                   // Number of entries in IPv6Forwarding table
+	IPv6Forwarding                []IPv6ForwardingEntry // IPv6 routing table entries.
 }
 
 // IPv4ForwardingEntry represents a single entry in the IPv4 routing table.
@@ -650,9 +749,25 @@ type IPv4ForwardingEntry struct {
 	StaticRoute      bool   // Indicates if this is a static route.
 	DestIPAddress    string // Destination IP address.
 	DestSubnetMask   string // Destination subnet mask.
+	ForwardingPolicy int    // Routing table of the entry, -1 for the main table.
 	GatewayIPAddress string // Next hop gateway IP address.
 	Interface        string // Egress interface path name.
 	Origin           string // How the route was learned (Static, DHCP, RIP, OSPF, X_ISPAPP_*).
+	ForwardingMetric int    // Route metric, -1 when unset.
+}
+
+// IPv6ForwardingEntry represents a single entry in the IPv6 routing table.
+type IPv6ForwardingEntry struct {
+	Index            int    // TR-069 index for this forwarding entry
+	Enable           bool   // Administrative status.
+	Status           string // Operational status (Enabled, Disabled, Error_Misconfigured).
+	DestIPPrefix     string // Destination prefix, empty for the default route.
+	ForwardingPolicy int    // Routing table of the entry, -1 for the main table.
+	NextHop          string // Next hop address.
+	Interface        string // Egress interface path name.
+	Origin           string // How the route was learned (DHCPv6, OSPF, RA, RIPng, Static).
+	ForwardingMetric int    // Route metric, -1 when unset.
+	ExpirationTime   string // When a learned route expires (dateTime).
 }
 
 // HostsDevice provides information about hosts detected by the CPE.
@@ -663,19 +778,50 @@ type HostsDevice struct {
 
 // HostEntry represents a single host detected on the network.
 type HostEntry struct {
-	Index            int    // TR-069 index for this host
-	PhysAddress      string // Physical address (e.g., MAC address).
-	IPAddress        string // Primary IP address (IPv4 or IPv6).
-	DHCPClient       string // Reference to DHCP client entry (if applicable).
-	AssociatedDevice string // Reference to the WiFi AssociatedDevice entry (if applicable).
-	Layer1Interface  string // Reference to the Layer 1 interface the host is connected to.
-	Layer3Interface  string // Reference to the Layer 3 interface the host is connected to.
-	HostName         string // Host name (if known).
+	Index              int    // TR-069 index for this host
+	PhysAddress        string // Physical address (e.g., MAC address).
+	IPAddress          string // Primary IP address (IPv4 or IPv6).
+	DHCPClient         string // Reference to DHCP client entry (if applicable).
+	AssociatedDevice   string // Reference to the WiFi AssociatedDevice entry (if applicable).
+	Layer1Interface    string // Reference to the Layer 1 interface the host is connected to.
+	Layer3Interface    string // Reference to the Layer 3 interface the host is connected to.
+	HostName           string // Host name (if known).
+	Active             bool   // Whether the host is currently present on the LAN.
+	LeaseTimeRemaining int32  // Seconds left on the DHCP lease, -1 for an infinite lease.
 }
 
 // DNSDevice aggregates DNS client configuration.
 type DNSDevice struct {
-	Client DNSClient // DNS client settings.
+	Client      DNSClient      // DNS client settings.
+	Diagnostics DNSDiagnostics // DNS diagnostic tests.
+}
+
+// DNSDiagnostics contains parameters for running DNS diagnostic tests.
+type DNSDiagnostics struct {
+	NSLookupDiagnostics NSLookupDiagnostics // NS lookup test parameters and results.
+}
+
+// NSLookupDiagnostics holds configuration and results for an NS lookup test.
+type NSLookupDiagnostics struct {
+	DiagnosticsState      string           // State of the diagnostic.
+	Interface             string           // Interface to perform the test over.
+	HostName              string           // Host name to look up.
+	DNSServer             string           // DNS server to query (empty for the default server).
+	Timeout               int              // Timeout in milliseconds per query.
+	NumberOfRepetitions   int              // Number of lookups to perform.
+	SuccessCount          int              // Number of successful lookups.
+	ResultNumberOfEntries int              // Number of entries in Result table
+	Result                []NSLookupResult // Results per lookup.
+}
+
+// NSLookupResult holds the result of a single lookup.
+type NSLookupResult struct {
+	Status           string // Success or Error_* status of the lookup.
+	AnswerType       string // None, Authoritative or NonAuthoritative.
+	HostNameReturned string // Fully qualified name returned by the server.
+	IPAddresses      string // Comma-separated addresses returned by the server.
+	DNSServerIP      string // Address of the server that answered.
+	ResponseTime     int    // Response time in milliseconds.
 }
 
 // DNSClient contains settings for the CPE's internal DNS resolver.
@@ -766,6 +912,7 @@ type DHCPv4ClientIPv4Address struct {
 // XMikrotikConnTrack holds connection tracking information.
 type XMikrotikConnTrack struct {
 	TotalEntries int // Current number of tracked connections.
+	MaxEntries   int // Maximum number of tracked connections.
 }
 
 // XMikrotikFilter aggregates firewall filter chains and rules.
@@ -782,6 +929,7 @@ type XMikrotikNAT struct {
 
 // XMikrotikFirewallChain represents a firewall chain (filter or NAT).
 type XMikrotikFirewallChain struct {
+	Index               int                     // TR-069 index for this chain
 	Enable              bool                    // Administrative status.
 	Name                string                  // Name of the chain (e.g., "input", "forward", "srcnat").
 	RuleNumberOfEntries int                     // Number of entries in Rule table
@@ -791,6 +939,7 @@ type XMikrotikFirewallChain struct {
 // XMikrotikFirewallRule represents a single firewall rule (filter or NAT).
 // Combines parameters from both filter and NAT contexts where applicable.
 type XMikrotikFirewallRule struct {
+	Index                  int      // TR-069 index for this rule
 	Enable                 bool     // Administrative status.
 	Order                  int      // Rule order within the chain.
 	Description            string   // User comment for the rule.
@@ -892,7 +1041,81 @@ type WANIPConnection struct {
 
 // FirewallDevice aggregates firewall configurations. Includes Mikrotik extensions.
 type FirewallDevice struct {
-	X_ISPAPP_ConnTrack XMikrotikConnTrack // Mikrotik connection tracking info.
-	X_ISPAPP_Filter    XMikrotikFilter    // Mikrotik filter rules.
-	X_ISPAPP_NAT       XMikrotikNAT       // Mikrotik NAT rules.
+	Enable               bool               // Whether the firewall is enabled.
+	Config               string             // Firewall configuration (High, Low, Advanced, Policy).
+	ChainNumberOfEntries int                // Number of entries in Chain table
+	Chains               []FirewallChain    // Firewall chains holding the filter rules.
+	X_ISPAPP_ConnTrack   XMikrotikConnTrack // Mikrotik connection tracking info.
+	X_ISPAPP_Filter      XMikrotikFilter    // Mikrotik filter rules.
+	X_ISPAPP_NAT         XMikrotikNAT       // Mikrotik NAT rules.
+}
+
+// FirewallChain represents an ordered set of firewall rules.
+type FirewallChain struct {
+	Index               int            // TR-069 index for this chain
+	Enable              bool           // Administrative status.
+	Name                string         // Name of the chain.
+	Creator             string         // Who created the chain (Defaults, ACS, UserInterface, ...).
+	RuleNumberOfEntries int            // Number of entries in Rule table
+	Rules               []FirewallRule // Rules of the chain.
+}
+
+// FirewallRule represents a single filter rule of a chain.
+type FirewallRule struct {
+	Index               int    // TR-069 index for this rule
+	Enable              bool   // Administrative status.
+	Status              string // Operational status (Disabled, Enabled, Error_Misconfigured).
+	Order               int    // Position of the rule within the chain, starting at 1.
+	Description         string // Human-readable description of the rule.
+	Target              string // Action on a match (Drop, Accept, Reject, Return, TargetChain, X_ISPAPP_*).
+	Log                 bool   // Whether matching packets are logged.
+	SourceInterface     string // Ingress interface path name, empty for any.
+	SourceAllInterfaces bool   // Whether the rule matches all ingress interfaces.
+	DestInterface       string // Egress interface path name, empty for any.
+	DestAllInterfaces   bool   // Whether the rule matches all egress interfaces.
+	IPVersion           int    // IP version matched, -1 for any.
+	DestIP              string // Destination IP address, empty for any.
+	DestMask            string // Destination IP mask, empty for a host address.
+	DestIPExclude       bool   // Negate the destination IP match.
+	SourceIP            string // Source IP address, empty for any.
+	SourceMask          string // Source IP mask, empty for a host address.
+	SourceIPExclude     bool   // Negate the source IP match.
+	Protocol            int    // Protocol number, -1 for any.
+	ProtocolExclude     bool   // Negate the protocol match.
+	DestPort            int    // Destination port, -1 for any.
+	DestPortRangeMax    int    // Last destination port of a range, -1 for a single port.
+	DestPortExclude     bool   // Negate the destination port match.
+	SourcePort          int    // Source port, -1 for any.
+	SourcePortRangeMax  int    // Last source port of a range, -1 for a single port.
+	SourcePortExclude   bool   // Negate the source port match.
+}
+
+// SoftwareModulesDevice aggregates deployment units (opkg packages) and execution units (procd services).
+type SoftwareModulesDevice struct {
+	DeploymentUnitNumberOfEntries int              // Number of entries in DeploymentUnit table
+	ExecutionUnitNumberOfEntries  int              // Number of entries in ExecutionUnit table
+	DeploymentUnit                []DeploymentUnit // Installed deployment units.
+	ExecutionUnit                 []ExecutionUnit  // Execution units provided by deployment units.
+}
+
+// DeploymentUnit represents an installed package.
+type DeploymentUnit struct {
+	Index             int    // TR-069 index for this deployment unit
+	UUID              string // Unique identifier derived from the package name.
+	DUID              string // Deployment unit identifier assigned by the CPE.
+	Name              string // Package name.
+	Status            string // Installing, Installed, Updating, Uninstalling, Uninstalled.
+	Resolved          bool   // Whether all dependencies are satisfied.
+	Version           string // Installed package version.
+	ExecutionUnitList string // Comma-separated references to ExecutionUnit entries.
+	ExecutionEnvRef   string // Reference to the execution environment.
+}
+
+// ExecutionUnit represents a service shipped by a deployment unit.
+type ExecutionUnit struct {
+	Index           int    // TR-069 index for this execution unit
+	EUID            string // Execution unit identifier.
+	Name            string // Service name.
+	Status          string // Idle, Starting, Active, Stopping.
+	ExecutionEnvRef string // Reference to the execution environment.
 }
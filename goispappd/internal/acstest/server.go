@@ -0,0 +1,320 @@
+// Package acstest provides an in-process ACS for session level tests of the
+// CWMP client. It accepts Informs, answers with a scripted sequence of RPCs,
+// records every exchanged envelope and can require Basic or Digest auth and
+// a session cookie, so no test needs a real ACS or router.
+package acstest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// SessionCookie is the name of the cookie identifying a CWMP session
+const SessionCookie = "acstest_session"
+
+// AuthMode selects the HTTP authentication the server requires
+type AuthMode int
+
+const (
+	AuthNone AuthMode = iota
+	AuthBasic
+	AuthDigest
+)
+
+// Exchange is one HTTP round trip between the CPE and the ACS
+type Exchange struct {
+	Method   string // Local name of the first Body element sent by the CPE, empty for an empty POST
+	Request  []byte // Raw body sent by the CPE
+	Response []byte // Raw body returned by the ACS
+	Status   int    // HTTP status returned by the ACS
+}
+
+// Server is a scriptable ACS listening on a local httptest server
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	script        []string
+	exchanges     []Exchange
+	auth          AuthMode
+	username      string
+	password      string
+	realm         string
+	nonce         string
+	requireCookie bool
+	session       string
+	sessions      int
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithBasicAuth requires HTTP Basic authentication
+func WithBasicAuth(username, password string) Option {
+	return func(s *Server) {
+		s.auth, s.username, s.password = AuthBasic, username, password
+	}
+}
+
+// WithDigestAuth requires HTTP Digest authentication (MD5, qop=auth)
+func WithDigestAuth(username, password string) Option {
+	return func(s *Server) {
+		s.auth, s.username, s.password = AuthDigest, username, password
+	}
+}
+
+// WithSessionCookie rejects requests after the Inform that do not carry the session cookie
+func WithSessionCookie() Option {
+	return func(s *Server) {
+		s.requireCookie = true
+	}
+}
+
+// NewServer starts a mock ACS, callers must Close it
+func NewServer(opts ...Option) *Server {
+	s := &Server{realm: "acstest", nonce: randomHex(16)}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Script queues RPCs sent to the CPE after the InformResponse, one per CPE
+// message. Each RPC is the inner XML of the Body, e.g. `<cwmp:GetRPCMethods/>`.
+func (s *Server) Script(rpcs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = append(s.script, rpcs...)
+}
+
+// Exchanges returns a copy of every recorded round trip
+func (s *Server) Exchanges() []Exchange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Exchange(nil), s.exchanges...)
+}
+
+// Methods returns the method of every recorded round trip, "" for empty POSTs
+func (s *Server) Methods() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	methods := make([]string, 0, len(s.exchanges))
+	for _, exchange := range s.exchanges {
+		methods = append(methods, exchange.Method)
+	}
+	return methods
+}
+
+// Received returns the raw body of the first message of the given method sent by the CPE
+func (s *Server) Received(method string) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, exchange := range s.exchanges {
+		if exchange.Method == method {
+			return exchange.Request
+		}
+	}
+	return nil
+}
+
+// Sessions returns the number of sessions opened with an Inform
+func (s *Server) Sessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	method, id := parseEnvelope(body)
+	exchange := Exchange{Method: method, Request: body}
+	defer func() { s.exchanges = append(s.exchanges, exchange) }()
+
+	if !s.authorized(r) {
+		s.challenge(w)
+		exchange.Status = http.StatusUnauthorized
+		return
+	}
+
+	if method == "Inform" {
+		s.sessions++
+		s.session = randomHex(8)
+		http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: s.session, Path: "/"})
+		exchange.Status, exchange.Response = s.write(w, id, `<cwmp:InformResponse><MaxEnvelopes>1</MaxEnvelopes></cwmp:InformResponse>`)
+		return
+	}
+
+	if s.requireCookie {
+		if cookie, err := r.Cookie(SessionCookie); err != nil || cookie.Value != s.session {
+			http.Error(w, "unknown session", http.StatusForbidden)
+			exchange.Status = http.StatusForbidden
+			return
+		}
+	}
+
+	switch {
+	case method == "" || method == "Fault" || strings.HasSuffix(method, "Response"):
+		// The CPE is idle or answered the previous RPC, send the next one or close
+		if len(s.script) == 0 {
+			s.session = ""
+			w.WriteHeader(http.StatusNoContent)
+			exchange.Status = http.StatusNoContent
+			return
+		}
+		rpc := s.script[0]
+		s.script = s.script[1:]
+		exchange.Status, exchange.Response = s.write(w, id, rpc)
+	default:
+		// CPE initiated request such as TransferComplete or DUStateChangeComplete
+		exchange.Status, exchange.Response = s.write(w, id, fmt.Sprintf("<cwmp:%sResponse/>", method))
+	}
+}
+
+func (s *Server) write(w http.ResponseWriter, id, rpc string) (int, []byte) {
+	if id == "" {
+		id = "1"
+	}
+	body := []byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+		`<soap-env:Envelope xmlns:soap-env="http://schemas.xmlsoap.org/soap/envelope/" xmlns:soap-enc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:cwmp="urn:dslforum-org:cwmp-1-2">` +
+		`<soap-env:Header><cwmp:ID soap-env:mustUnderstand="1">` + id + `</cwmp:ID></soap-env:Header>` +
+		`<soap-env:Body>` + rpc + `</soap-env:Body></soap-env:Envelope>`)
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+	return http.StatusOK, body
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	switch s.auth {
+	case AuthBasic:
+		username, password, ok := r.BasicAuth()
+		return ok && username == s.username && password == s.password
+	case AuthDigest:
+		return s.validDigest(r)
+	}
+	return true
+}
+
+func (s *Server) challenge(w http.ResponseWriter) {
+	switch s.auth {
+	case AuthBasic:
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, s.realm))
+	case AuthDigest:
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", nonce="%s", qop="auth", algorithm=MD5`, s.realm, s.nonce))
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (s *Server) validDigest(r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+	params := ParseAuthParams(strings.TrimPrefix(header, "Digest "))
+	if params["username"] != s.username || params["realm"] != s.realm || params["nonce"] != s.nonce {
+		return false
+	}
+	ha1 := md5Hex(s.username + ":" + s.realm + ":" + s.password)
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	expected := md5Hex(strings.Join([]string{ha1, s.nonce, params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+	return params["response"] == expected
+}
+
+// ParseAuthParams parses the comma separated key=value pairs of an auth header
+func ParseAuthParams(header string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range splitAuthParams(header) {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		params[strings.ToLower(key)] = strings.Trim(value, `"`)
+	}
+	return params
+}
+
+// splitAuthParams splits on commas outside of quoted values
+func splitAuthParams(header string) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i, r := range header {
+		switch r {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, header[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, header[start:])
+}
+
+// parseEnvelope returns the local name of the first Body element and the cwmp:ID header
+func parseEnvelope(body []byte) (method, id string) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return "", ""
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	inHeader, inBody, inID := false, false, false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return method, id
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case inBody:
+				return t.Name.Local, id
+			case t.Name.Local == "Header":
+				inHeader = true
+			case t.Name.Local == "Body":
+				inBody = true
+			case inHeader && t.Name.Local == "ID":
+				inID = true
+			}
+		case xml.CharData:
+			if inID {
+				id = strings.TrimSpace(string(t))
+			}
+		case xml.EndElement:
+			if t.Name.Local == "ID" {
+				inID = false
+			}
+			if t.Name.Local == "Header" {
+				inHeader = false
+			}
+		}
+	}
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,148 @@
+package cellular
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// applyTimeout bounds the uci calls and the network reload of one request
+const applyTimeout = 30 * time.Second
+
+// cellularParams are the parameters of Device.Cellular.
+var cellularParams = func() map[string]params.Param {
+	p := map[string]params.Param{
+		"InterfaceNumberOfEntries":                              {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+		"AccessPointNumberOfEntries":                            {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+		"Interface.{i}.X_ISPAPP_CarrierInfo.{i}.Band":           {Type: soap.TR069TypeUnsignedInt},
+		"Interface.{i}.X_ISPAPP_CarrierInfo.{i}.Fcn":            {Type: soap.TR069TypeUnsignedInt},
+		"Interface.{i}.X_ISPAPP_CarrierInfo.{i}.Bandwidth":      {Type: soap.TR069TypeUnsignedInt},
+		"Interface.{i}.X_ISPAPP_CarrierInfo.{i}.PhysicalCellId": {Type: soap.TR069TypeUnsignedInt},
+		"Interface.{i}.X_ISPAPP_CarrierInfo.{i}.RSSI":           {Type: soap.TR069TypeInt},
+		"Interface.{i}.X_ISPAPP_CarrierInfo.{i}.SINR":           {Type: soap.TR069TypeInt},
+		"Interface.{i}.X_ISPAPP_CarrierInfo.{i}.RSRP":           {Type: soap.TR069TypeInt},
+		"Interface.{i}.X_ISPAPP_CarrierInfo.{i}.RSRQ":           {Type: soap.TR069TypeInt},
+		"AccessPoint.{i}.APN":                                   {Type: soap.TR069TypeString, Writable: true, Check: checkLength(64)},
+		"AccessPoint.{i}.Username":                              {Type: soap.TR069TypeString, Writable: true, Check: checkLength(256)},
+		"AccessPoint.{i}.Password":                              {Type: soap.TR069TypeString, Writable: true, Check: checkLength(256)},
+	}
+	for _, field := range interfaceFields {
+		p["Interface.{i}."+field.name] = params.Param{Type: field.kind}
+	}
+	return p
+}()
+
+// accessPointOptions are the uci options of the writable AccessPoint
+// parameters
+var accessPointOptions = map[string]string{
+	"APN":      "apn",
+	"Username": "username",
+	"Password": "password",
+}
+
+func checkLength(limit int) func(string) error {
+	return func(value string) error {
+		if len(value) > limit {
+			return fmt.Errorf("value is longer than %d characters", limit)
+		}
+		return nil
+	}
+}
+
+// Register adds Device.Cellular. to registry
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{
+		Prefix: Prefix,
+		Params: cellularParams,
+		Apply:  m.apply,
+		Commit: m.save,
+		Revert: m.revert,
+	})
+}
+
+// commit saves the network config, reloads netifd so the changed interfaces
+// reconnect and refreshes the store
+func (m *Manager) commit(ctx context.Context) error {
+	if err := m.uci.Commit(ctx); err != nil {
+		return err
+	}
+	if _, err := ucicfg.Command(ctx, m.runner, "/etc/init.d/network", "reload"); err != nil {
+		return err
+	}
+	return m.collect(ctx)
+}
+
+// path splits a name below Device.Cellular.AccessPoint. into the instance and
+// the parameter
+func path(name string) (int, string, error) {
+	instance, param, ok := strings.Cut(strings.TrimPrefix(name, accessPointPrefix), ".")
+	index, err := strconv.Atoi(instance)
+	if !strings.HasPrefix(name, accessPointPrefix) || !ok || err != nil {
+		return 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	return index, param, nil
+}
+
+// save commits the values staged by apply
+func (m *Manager) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	return m.commit(ctx)
+}
+
+// revert discards the values staged by apply
+func (m *Manager) revert() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	m.uci.Restore(ctx)
+}
+
+// apply stages the values of one SetParameterValues request, the registry
+// commits or reverts them with the other objects of the request
+func (m *Manager) apply(values map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+
+	points, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := m.applyValue(ctx, points, name, values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyValue writes one AccessPoint parameter
+func (m *Manager) applyValue(ctx context.Context, points []*accessPoint, name, value string) error {
+	index, param, err := path(name)
+	if err != nil {
+		return err
+	}
+	p := find(points, index)
+	option, ok := accessPointOptions[param]
+	if p == nil || !ok {
+		return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	return m.uci.Set(ctx, p.sec.Name, option, value)
+}
@@ -0,0 +1,280 @@
+package cellular
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/uci"
+)
+
+// atTimeout bounds the answer to one AT command
+const atTimeout = 5 * time.Second
+
+// atProtocols are the netifd protocols whose device option is an AT port
+var atProtocols = map[string]bool{"3g": true, "ncm": true}
+
+// copsTechnologies maps the <AcT> of AT+COPS to the TR-181 AccessTechnologies
+var copsTechnologies = map[string]string{
+	"0": "GPRS", "1": "GPRS", "3": "EDGE", "2": "UMTS",
+	"4": "UMTSHSPA", "5": "UMTSHSPA", "6": "UMTSHSPA",
+	"7": "LTE", "9": "LTE", "10": "LTE",
+	"11": "NR", "12": "NR", "13": "NR",
+}
+
+// lteBandwidths are the MHz of the bandwidth codes of AT+QENG
+var lteBandwidths = map[string]int{"0": 1, "1": 3, "2": 5, "3": 10, "4": 15, "5": 20}
+
+// AT reads a modem with the 3GPP TS 27.007 commands on its AT port, and with
+// the Quectel AT+QENG for the serving cell
+type AT struct {
+	Port string                                        // AT port, the device option of the 3g and ncm interfaces when empty
+	Open func(name string) (io.ReadWriteCloser, error) // Opens the port raw, openSerial when nil
+}
+
+// atSession is an open AT port
+type atSession struct {
+	port   io.ReadWriteCloser
+	reader *bufio.Reader
+}
+
+// command sends an AT command and returns the lines of its answer before OK
+func (s *atSession) command(ctx context.Context, command string) ([]string, error) {
+	deadline := time.Now().Add(atTimeout)
+	if at, ok := ctx.Deadline(); ok && at.Before(deadline) {
+		deadline = at
+	}
+	if port, ok := s.port.(interface{ SetReadDeadline(time.Time) error }); ok {
+		port.SetReadDeadline(deadline)
+	}
+	if _, err := io.WriteString(s.port, command+"\r"); err != nil {
+		return nil, fmt.Errorf("%s: %w", command, err)
+	}
+	var lines []string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", command, err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line == command:
+			// Blank separator or the echo of the command
+		case line == "OK":
+			return lines, nil
+		case line == "ERROR" || strings.HasPrefix(line, "+CME ERROR") || strings.HasPrefix(line, "+CMS ERROR"):
+			return nil, fmt.Errorf("%s: %s", command, line)
+		default:
+			lines = append(lines, line)
+		}
+	}
+}
+
+// value sends an AT command and returns the first line of its answer without
+// the +NAME: prefix and quotes, empty when the modem refuses the command
+func (s *atSession) value(ctx context.Context, command string) string {
+	lines, err := s.command(ctx, command)
+	if err != nil || len(lines) == 0 {
+		return ""
+	}
+	line := lines[0]
+	if strings.HasPrefix(line, "+") {
+		if _, rest, ok := strings.Cut(line, ":"); ok {
+			line = rest
+		}
+	}
+	return strings.Trim(strings.TrimSpace(line), `"`)
+}
+
+// fields splits the parameters of an answer line, dropping the +NAME: prefix
+// and the quotes of strings
+func fields(line string) []string {
+	if _, rest, ok := strings.Cut(line, ":"); ok && strings.HasPrefix(line, "+") {
+		line = rest
+	}
+	parts := strings.Split(line, ",")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"`)
+	}
+	return parts
+}
+
+// open opens the AT port of the modem with echo off
+func (b AT) open(ctx context.Context, network []*uci.Section) (*atSession, error) {
+	port := b.Port
+	for _, sec := range network {
+		if port == "" && atProtocols[sec.Options["proto"]] {
+			port = sec.Options["device"]
+		}
+	}
+	if port == "" {
+		return nil, ErrNoModem
+	}
+	open := b.Open
+	if open == nil {
+		open = openSerial
+	}
+	rw, err := open(port)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoModem, err)
+	}
+	s := &atSession{port: rw, reader: bufio.NewReader(rw)}
+	// Echo off keeps the answers apart from the commands
+	if _, err := s.command(ctx, "ATE0"); err != nil {
+		rw.Close()
+		return nil, fmt.Errorf("%s: %w", port, err)
+	}
+	return s, nil
+}
+
+// fieldNumber returns the i-th of the fields of an answer as a number, 0 when
+// missing or not a number
+func fieldNumber(values []string, i int) int {
+	if i >= len(values) {
+		return 0
+	}
+	n, _ := strconv.Atoi(values[i])
+	return n
+}
+
+// Interfaces implements Backend
+func (b AT) Interfaces(ctx context.Context, network []*uci.Section) ([]device.CellularInterface, error) {
+	s, err := b.open(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	defer s.port.Close()
+
+	iface := device.CellularInterface{
+		Enable:            s.value(ctx, "AT+CFUN?") != "0",
+		IMEI:              s.value(ctx, "AT+CGSN"),
+		X_ISPAPP_Model:    s.value(ctx, "AT+CGMM"),
+		X_ISPAPP_Revision: s.value(ctx, "AT+CGMR"),
+	}
+	b.sim(ctx, s, &iface)
+	b.registration(ctx, s, &iface)
+	if lines, err := s.command(ctx, `AT+QENG="servingcell"`); err == nil {
+		servingCell(lines, &iface)
+	}
+	return []device.CellularInterface{iface}, nil
+}
+
+// sim reads the state and identity of the SIM card
+func (b AT) sim(ctx context.Context, s *atSession, iface *device.CellularInterface) {
+	switch pin := s.value(ctx, "AT+CPIN?"); {
+	case pin == "":
+		// The modem answers +CME ERROR: 10 without SIM
+		iface.USIM.Status = "None"
+		return
+	case pin != "READY":
+		iface.USIM.Status = "Blocked"
+		return
+	}
+	iface.USIM.IMSI = s.value(ctx, "AT+CIMI")
+	for _, command := range []string{"AT+CCID", "AT+QCCID", "AT+ICCID"} {
+		if iface.USIM.ICCID = s.value(ctx, command); iface.USIM.ICCID != "" {
+			break
+		}
+	}
+	iface.USIM.Status = simStatus(iface.USIM)
+}
+
+// registration reads the signal, the registration and the access technology
+func (b AT) registration(ctx context.Context, s *atSession, iface *device.CellularInterface) {
+	// +CSQ: <rssi>,<ber> counts 2 dB steps from -113 dBm, 99 is unknown
+	if csq := fields(s.value(ctx, "AT+CSQ")); len(csq) > 0 {
+		if n, err := strconv.Atoi(csq[0]); err == nil && n <= 31 {
+			iface.RSSI = -113 + 2*n
+		}
+	}
+	if cops := fields(s.value(ctx, "AT+COPS?")); len(cops) >= 4 {
+		iface.X_ISPAPP_CurrentAccessTechnology = copsTechnologies[cops[3]]
+	}
+
+	registered := false
+	for _, command := range []string{"AT+CEREG?", "AT+CREG?"} {
+		if reg := fields(s.value(ctx, command)); len(reg) >= 2 {
+			registered = registered || reg[1] == "1" || reg[1] == "5"
+		}
+	}
+	active := false
+	if lines, err := s.command(ctx, "AT+CGACT?"); err == nil {
+		for _, line := range lines {
+			if pdp := fields(line); len(pdp) >= 2 && pdp[1] == "1" {
+				active = true
+			}
+		}
+	}
+	switch {
+	case !iface.Enable:
+		iface.Status = "Down"
+	case active:
+		iface.Status = "Up"
+	case registered:
+		iface.Status = "Dormant"
+	default:
+		iface.Status = "Down"
+	}
+}
+
+// servingCell maps the answer of AT+QENG="servingcell", one line for LTE or
+// 5G standalone and one line per radio under EN-DC
+func servingCell(lines []string, iface *device.CellularInterface) {
+	number := fieldNumber
+	for _, line := range lines {
+		values := fields(line)
+		if len(values) > 2 && values[0] == "servingcell" {
+			values = values[2:]
+		}
+		if len(values) == 0 {
+			continue
+		}
+		switch values[0] {
+		case "LTE":
+			// LTE,<is_tdd>,<MCC>,<MNC>,<cellID>,<PCID>,<earfcn>,<band>,<UL_bw>,<DL_bw>,<TAC>,<RSRP>,<RSRQ>,<RSSI>,<SINR>,<CQI>
+			if len(values) < 15 {
+				continue
+			}
+			cellID, _ := strconv.ParseInt(values[4], 16, 64)
+			iface.X_ISPAPP_CellId = int(cellID)
+			iface.X_ISPAPP_RSRP = number(values, 11)
+			iface.X_ISPAPP_RSRQ = number(values, 12)
+			iface.X_ISPAPP_SINR = number(values, 14)
+			iface.X_ISPAPP_CQI = number(values, 15)
+			iface.X_ISPAPP_BandInfo = "B" + values[7]
+			iface.X_ISPAPP_CarrierInfo = []device.CarrierInfo{{
+				Index:          1,
+				Band:           number(values, 7),
+				Fcn:            number(values, 6),
+				Bandwidth:      lteBandwidths[values[9]],
+				PhysicalCellId: number(values, 5),
+				RSSI:           number(values, 13),
+				SINR:           number(values, 14),
+				RSRP:           number(values, 11),
+				RSRQ:           number(values, 12),
+			}}
+		case "NR5G-NSA":
+			// NR5G-NSA,<MCC>,<MNC>,<PCID>,<RSRP>,<SINR>,<RSRQ>,<ARFCN>,<band>
+			iface.X_ISPAPP_5G_PhysicalCellId = number(values, 3)
+			iface.X_ISPAPP_5G_RSRP = number(values, 4)
+			iface.X_ISPAPP_5G_SINR = number(values, 5)
+			iface.X_ISPAPP_5G_RSRQ = number(values, 6)
+			iface.X_ISPAPP_5G_Band = number(values, 8)
+		case "NR5G-SA":
+			// NR5G-SA,<duplex>,<MCC>,<MNC>,<cellID>,<PCID>,<TAC>,<ARFCN>,<band>,<NR_DL_bw>,<RSRP>,<RSRQ>,<SINR>
+			cellID, _ := strconv.ParseInt(values[min(4, len(values)-1)], 16, 64)
+			iface.X_ISPAPP_CellId = int(cellID)
+			iface.X_ISPAPP_5G_PhysicalCellId = number(values, 5)
+			iface.X_ISPAPP_5G_Band = number(values, 8)
+			iface.X_ISPAPP_5G_RSRP = number(values, 10)
+			iface.X_ISPAPP_5G_RSRQ = number(values, 11)
+			iface.X_ISPAPP_5G_SINR = number(values, 12)
+			iface.X_ISPAPP_BandInfo = fmt.Sprintf("n%d", iface.X_ISPAPP_5G_Band)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+// Package cellular maps TR-181 Device.Cellular to the modems of the device.
+// The radio state is read by a Backend, ModemManager, uqmi or AT commands on
+// a serial port, and an AccessPoint is a network interface section of a
+// cellular protocol holding the APN.
+package cellular
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// Prefix is the object mapped by the package
+const Prefix = "Device.Cellular."
+
+// Tables below Prefix
+const (
+	interfacePrefix   = Prefix + "Interface."
+	accessPointPrefix = Prefix + "AccessPoint."
+)
+
+// accessPointInstance is the UCI option numbering the access points
+const accessPointInstance = "cellular_ap_instance"
+
+// protocols are the netifd protocols of a cellular interface
+var protocols = map[string]bool{
+	"modemmanager": true,
+	"qmi":          true,
+	"mbim":         true,
+	"ncm":          true,
+	"3g":           true,
+	"wwan":         true,
+}
+
+// ErrNoModem is returned by a Backend that finds no modem, e.g. because its
+// tool is not installed
+var ErrNoModem = errors.New("no cellular modem")
+
+// Backend reads the modems. network holds the sections of the cellular
+// interfaces, which name the control device of some protocols
+type Backend interface {
+	Interfaces(ctx context.Context, network []*uci.Section) ([]device.CellularInterface, error)
+}
+
+// Manager reads the modems through its backends and writes the access points
+// with uci
+type Manager struct {
+	runner   exec.Runner
+	uci      *ucicfg.Config
+	numbers  *ucicfg.Config // Instance numbers, committed apart from the requests
+	backends []Backend
+	mu       sync.Mutex
+}
+
+// NewManager creates a Manager running uci and netifd through runner. The
+// modems are read by the first of backends finding one
+func NewManager(runner exec.Runner, backends ...Backend) *Manager {
+	c := ucicfg.New(runner, "network", "cellular")
+	return &Manager{runner: runner, uci: c, numbers: c.Numbers(), backends: backends}
+}
+
+// accessPoint is a cellular interface section
+type accessPoint struct {
+	device.CellularAccessPoint
+	sec *uci.Section
+}
+
+// load reads the cellular interfaces of the network config, numbering the
+// sections that have no instance yet
+func (m *Manager) load(ctx context.Context) ([]*accessPoint, error) {
+	shown, err := m.uci.Show(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var sections []*uci.Section
+	highest := 0
+	for _, sec := range shown {
+		if sec.SectionType == "interface" && protocols[sec.Options["proto"]] {
+			sections = append(sections, sec)
+			if index, err := strconv.Atoi(sec.Options[accessPointInstance]); err == nil {
+				highest = max(highest, index)
+			}
+		}
+	}
+
+	numbered := false
+	points := make([]*accessPoint, 0, len(sections))
+	for _, sec := range sections {
+		index, err := strconv.Atoi(sec.Options[accessPointInstance])
+		if err != nil {
+			highest++
+			index = highest
+			if err := m.numbers.Set(ctx, sec.Name, accessPointInstance, strconv.Itoa(index)); err != nil {
+				return nil, err
+			}
+			numbered = true
+		}
+		points = append(points, &accessPoint{
+			CellularAccessPoint: device.CellularAccessPoint{
+				Index:    index,
+				APN:      sec.Options["apn"],
+				Username: sec.Options["username"],
+				Password: sec.Options["password"],
+			},
+			sec: sec,
+		})
+	}
+	if numbered {
+		if err := m.numbers.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Index < points[j].Index })
+	return points, nil
+}
+
+// find returns the access point with instance number index
+func find(points []*accessPoint, index int) *accessPoint {
+	for _, p := range points {
+		if p.Index == index {
+			return p
+		}
+	}
+	return nil
+}
+
+// Cellular returns the modems and the access points
+func (m *Manager) Cellular(ctx context.Context) (*device.CellularDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cellular(ctx)
+}
+
+func (m *Manager) cellular(ctx context.Context) (*device.CellularDevice, error) {
+	points, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	network := make([]*uci.Section, len(points))
+	for i, p := range points {
+		network[i] = p.sec
+	}
+	interfaces, err := m.interfaces(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+
+	cellular := &device.CellularDevice{Interfaces: interfaces}
+	for i := range cellular.Interfaces {
+		iface := &cellular.Interfaces[i]
+		iface.Index = i + 1
+		iface.X_ISPAPP_CarrierInfoNumberOfEntries = len(iface.X_ISPAPP_CarrierInfo)
+		iface.X_ISPAPP_CarrierInfo5GNumberOfEntries = len(iface.X_ISPAPP_CarrierInfo5G)
+	}
+	for _, p := range points {
+		cellular.AccessPoints = append(cellular.AccessPoints, p.CellularAccessPoint)
+	}
+	cellular.InterfaceNumberOfEntries = len(cellular.Interfaces)
+	cellular.AccessPointNumberOfEntries = len(cellular.AccessPoints)
+	return cellular, nil
+}
+
+// interfaces returns the modems of the first backend finding one, a device
+// without modem has no interfaces
+func (m *Manager) interfaces(ctx context.Context, network []*uci.Section) ([]device.CellularInterface, error) {
+	var failed error
+	for _, backend := range m.backends {
+		interfaces, err := backend.Interfaces(ctx, network)
+		switch {
+		case err == nil && len(interfaces) > 0:
+			return interfaces, nil
+		case err != nil && !errors.Is(err, ErrNoModem) && failed == nil:
+			failed = err
+		}
+	}
+	return nil, failed
+}
+
+// Collect stores the modems and access points in the tr069 store
+func (m *Manager) Collect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.collect(ctx)
+}
+
+func (m *Manager) collect(ctx context.Context) error {
+	cellular, err := m.cellular(ctx)
+	if err != nil {
+		return err
+	}
+	return store.Replace([]string{interfacePrefix, accessPointPrefix}, Values(cellular))
+}
+
+// Values flattens the modems and access points into parameters keyed by full
+// name. Passwords are not stored, they read as empty like any hidden value
+func Values(cellular *device.CellularDevice) map[string]string {
+	values := map[string]string{
+		Prefix + "InterfaceNumberOfEntries":   strconv.Itoa(cellular.InterfaceNumberOfEntries),
+		Prefix + "AccessPointNumberOfEntries": strconv.Itoa(cellular.AccessPointNumberOfEntries),
+	}
+	for _, iface := range cellular.Interfaces {
+		name := fmt.Sprintf("%s%d.", interfacePrefix, iface.Index)
+		for _, field := range interfaceFields {
+			values[name+field.name] = field.value(&iface)
+		}
+		for _, carrier := range iface.X_ISPAPP_CarrierInfo {
+			entry := fmt.Sprintf("%sX_ISPAPP_CarrierInfo.%d.", name, carrier.Index)
+			values[entry+"Band"] = strconv.Itoa(carrier.Band)
+			values[entry+"Fcn"] = strconv.Itoa(carrier.Fcn)
+			values[entry+"Bandwidth"] = strconv.Itoa(carrier.Bandwidth)
+			values[entry+"PhysicalCellId"] = strconv.Itoa(carrier.PhysicalCellId)
+			values[entry+"RSSI"] = strconv.Itoa(carrier.RSSI)
+			values[entry+"SINR"] = strconv.Itoa(carrier.SINR)
+			values[entry+"RSRP"] = strconv.Itoa(carrier.RSRP)
+			values[entry+"RSRQ"] = strconv.Itoa(carrier.RSRQ)
+		}
+	}
+	for _, p := range cellular.AccessPoints {
+		name := fmt.Sprintf("%s%d.", accessPointPrefix, p.Index)
+		values[name+"APN"] = p.APN
+		values[name+"Username"] = p.Username
+		values[name+"Password"] = ""
+	}
+	return values
+}
+
+// field is a parameter of the Interface table
+type field struct {
+	name  string
+	kind  string // soap.TR069Type of the parameter
+	value func(*device.CellularInterface) string
+}
+
+func intField(name string, get func(*device.CellularInterface) int) field {
+	return field{name, soap.TR069TypeInt, func(i *device.CellularInterface) string { return strconv.Itoa(get(i)) }}
+}
+
+func uintField(name string, get func(*device.CellularInterface) int) field {
+	return field{name, soap.TR069TypeUnsignedInt, func(i *device.CellularInterface) string { return strconv.Itoa(get(i)) }}
+}
+
+func stringField(name string, get func(*device.CellularInterface) string) field {
+	return field{name, soap.TR069TypeString, func(i *device.CellularInterface) string { return get(i) }}
+}
+
+func listField(name string, get func(*device.CellularInterface) []string) field {
+	return field{name, soap.TR069TypeString, func(i *device.CellularInterface) string { return strings.Join(get(i), ",") }}
+}
+
+// interfaceFields are the parameters of an Interface the backends read
+var interfaceFields = []field{
+	{"Enable", soap.TR069TypeBoolean, func(i *device.CellularInterface) string { return strconv.FormatBool(i.Enable) }},
+	stringField("Status", func(i *device.CellularInterface) string { return i.Status }),
+	stringField("IMEI", func(i *device.CellularInterface) string { return i.IMEI }),
+	intField("RSSI", func(i *device.CellularInterface) int { return i.RSSI }),
+	stringField("USIM.Status", func(i *device.CellularInterface) string { return i.USIM.Status }),
+	stringField("USIM.IMSI", func(i *device.CellularInterface) string { return i.USIM.IMSI }),
+	stringField("USIM.ICCID", func(i *device.CellularInterface) string { return i.USIM.ICCID }),
+	stringField("X_ISPAPP_Model", func(i *device.CellularInterface) string { return i.X_ISPAPP_Model }),
+	stringField("X_ISPAPP_Revision", func(i *device.CellularInterface) string { return i.X_ISPAPP_Revision }),
+	listField("X_ISPAPP_SupportedAccessTechnologies", func(i *device.CellularInterface) []string { return i.X_ISPAPP_SupportedAccessTechnologies }),
+	listField("X_ISPAPP_AccessTechnologies", func(i *device.CellularInterface) []string { return i.X_ISPAPP_AccessTechnologies }),
+	stringField("X_ISPAPP_CurrentAccessTechnology", func(i *device.CellularInterface) string { return i.X_ISPAPP_CurrentAccessTechnology }),
+	listField("X_ISPAPP_SupportedLteBands", func(i *device.CellularInterface) []string { return i.X_ISPAPP_SupportedLteBands }),
+	listField("X_ISPAPP_LteBands", func(i *device.CellularInterface) []string { return i.X_ISPAPP_LteBands }),
+	listField("X_ISPAPP_Supported5GBands", func(i *device.CellularInterface) []string { return i.X_ISPAPP_Supported5GBands }),
+	listField("X_ISPAPP_5GBands", func(i *device.CellularInterface) []string { return i.X_ISPAPP_5GBands }),
+	intField("X_ISPAPP_RSCP", func(i *device.CellularInterface) int { return i.X_ISPAPP_RSCP }),
+	intField("X_ISPAPP_ECNO", func(i *device.CellularInterface) int { return i.X_ISPAPP_ECNO }),
+	intField("X_ISPAPP_SINR", func(i *device.CellularInterface) int { return i.X_ISPAPP_SINR }),
+	intField("X_ISPAPP_RSRP", func(i *device.CellularInterface) int { return i.X_ISPAPP_RSRP }),
+	intField("X_ISPAPP_RSRQ", func(i *device.CellularInterface) int { return i.X_ISPAPP_RSRQ }),
+	uintField("X_ISPAPP_CQI", func(i *device.CellularInterface) int { return i.X_ISPAPP_CQI }),
+	uintField("X_ISPAPP_5G_Band", func(i *device.CellularInterface) int { return i.X_ISPAPP_5G_Band }),
+	uintField("X_ISPAPP_5G_PhysicalCellId", func(i *device.CellularInterface) int { return i.X_ISPAPP_5G_PhysicalCellId }),
+	intField("X_ISPAPP_5G_SINR", func(i *device.CellularInterface) int { return i.X_ISPAPP_5G_SINR }),
+	intField("X_ISPAPP_5G_RSRP", func(i *device.CellularInterface) int { return i.X_ISPAPP_5G_RSRP }),
+	intField("X_ISPAPP_5G_RSRQ", func(i *device.CellularInterface) int { return i.X_ISPAPP_5G_RSRQ }),
+	uintField("X_ISPAPP_CellId", func(i *device.CellularInterface) int { return i.X_ISPAPP_CellId }),
+	stringField("X_ISPAPP_BandInfo", func(i *device.CellularInterface) string { return i.X_ISPAPP_BandInfo }),
+	uintField("X_ISPAPP_CarrierInfoNumberOfEntries", func(i *device.CellularInterface) int { return i.X_ISPAPP_CarrierInfoNumberOfEntries }),
+}
+
+// accessTechnologies maps the technology names of the backends to the
+// TR-181 AccessTechnologies
+var accessTechnologies = map[string]string{
+	"gsm":       "GPRS",
+	"gprs":      "GPRS",
+	"edge":      "EDGE",
+	"umts":      "UMTS",
+	"wcdma":     "UMTS",
+	"hsdpa":     "UMTSHSPA",
+	"hsupa":     "UMTSHSPA",
+	"hspa":      "UMTSHSPA",
+	"hspa-plus": "UMTSHSPA",
+	"lte":       "LTE",
+	"5gnr":      "NR",
+	"nr5g":      "NR",
+}
+
+// modeTechnologies are the TR-181 AccessTechnologies of a network generation
+var modeTechnologies = map[string][]string{
+	"2g": {"GPRS", "EDGE"},
+	"3g": {"UMTS", "UMTSHSPA"},
+	"4g": {"LTE"},
+	"5g": {"NR"},
+}
+
+// simStatus derives the USIM status of a card that is not blocked
+func simStatus(sim device.SIMCard) string {
+	switch {
+	case sim.IMSI != "":
+		return "Valid"
+	case sim.ICCID != "":
+		return "Available"
+	}
+	return "None"
+}
+
+// appendUnique appends the values missing from list
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, item := range list {
+			found = found || item == value
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
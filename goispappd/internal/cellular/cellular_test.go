@@ -0,0 +1,254 @@
+package cellular_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/cellular"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// Outputs recorded from ModemManager 1.22 with a Quectel EM12 on OpenWrt
+const (
+	mmList  = `{"modem-list":["/org/freedesktop/ModemManager1/Modem/0"]}`
+	mmModem = `{"modem":{"3gpp":{"enabled-locks":["fixed-dialing"],"imei":"867962040000001","operator-code":"26201","operator-name":"Telekom.de","registration-state":"home"},
+"dbus-path":"/org/freedesktop/ModemManager1/Modem/0",
+"generic":{"access-technologies":["lte"],"current-bands":["utran-1","eutran-1","eutran-3","eutran-20"],"current-capabilities":["gsm-umts, lte"],
+"current-modes":"allowed: 3g, 4g; preferred: 4g","equipment-identifier":"867962040000001","manufacturer":"Quectel","model":"EM12",
+"power-state":"on","primary-port":"cdc-wdm0","revision":"EM12GPAR01A21M4G","signal-quality":{"recent":"yes","value":"67"},
+"sim":"/org/freedesktop/ModemManager1/SIM/0","state":"connected","state-failed-reason":"--",
+"supported-bands":["utran-1","utran-8","eutran-1","eutran-3","eutran-7","eutran-20","eutran-28"],
+"supported-capabilities":["gsm-umts, lte"],"unlock-required":"--"}}}`
+	mmSignal = `{"modem":{"signal":{"5g":{"error-rate":"--","rsrp":"--","rsrq":"--","snr":"--"},"gsm":{"error-rate":"--","rssi":"--"},
+"lte":{"error-rate":"--","rsrp":"-98.00","rsrq":"-9.00","rssi":"-65.00","snr":"12.40"},"refresh":{"rate":"0"},
+"umts":{"ecio":"--","error-rate":"--","rscp":"--","rssi":"--"}}}}`
+	mmSIM = `{"sim":{"dbus-path":"/org/freedesktop/ModemManager1/SIM/0","properties":{"active":"yes","iccid":"89490200001234567890","imsi":"262011234567890","operator-name":"Telekom.de"}}}`
+)
+
+// newUCI emulates a network config with a ModemManager and a qmi interface
+func newUCI() *ucitest.UCI {
+	return ucitest.New().
+		Section("network", "lan", "interface", "proto", "static").
+		Section("network", "wwan", "interface", "proto", "modemmanager", "device", "/sys/devices/platform/1e1c0000.xhci/usb2/2-1", "apn", "internet.telekom", "cellular_ap_instance", "1").
+		Section("network", "backup", "interface", "proto", "qmi", "device", "/dev/cdc-wdm0", "apn", "web.vodafone.de", "username", "vodafone", "password", "secret").
+		On("/etc/init.d/network reload", "")
+}
+
+func TestMMCLI(t *testing.T) {
+	ucitest.UseStore(t)
+	uci := newUCI().
+		On("mmcli -J -L", mmList).
+		On("mmcli -J -m /org/freedesktop/ModemManager1/Modem/0", mmModem).
+		On("mmcli -J -m /org/freedesktop/ModemManager1/Modem/0 --signal-get", mmSignal).
+		On("mmcli -m /org/freedesktop/ModemManager1/Modem/0 --signal-setup=10", "").
+		On("mmcli -J -i /org/freedesktop/ModemManager1/SIM/0", mmSIM)
+	manager := cellular.NewManager(uci, cellular.MMCLI{Runner: uci}, cellular.UQMI{Runner: uci})
+	if err := manager.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := "Device.Cellular.Interface.1."
+	ucitest.ExpectStored(t, map[string]string{
+		"Device.Cellular.InterfaceNumberOfEntries":      "1",
+		prefix + "Enable":                               "true",
+		prefix + "Status":                               "Up",
+		prefix + "IMEI":                                 "867962040000001",
+		prefix + "RSSI":                                 "-65",
+		prefix + "X_ISPAPP_Model":                       "EM12",
+		prefix + "X_ISPAPP_SupportedAccessTechnologies": "GPRS,EDGE,UMTS,UMTSHSPA,LTE",
+		prefix + "X_ISPAPP_AccessTechnologies":          "UMTS,UMTSHSPA,LTE",
+		prefix + "X_ISPAPP_CurrentAccessTechnology":     "LTE",
+		prefix + "X_ISPAPP_SupportedLteBands":           "1,3,7,20,28",
+		prefix + "X_ISPAPP_LteBands":                    "1,3,20",
+		prefix + "X_ISPAPP_RSRP":                        "-98",
+		prefix + "X_ISPAPP_RSRQ":                        "-9",
+		prefix + "X_ISPAPP_SINR":                        "12",
+		prefix + "USIM.Status":                          "Valid",
+		prefix + "USIM.IMSI":                            "262011234567890",
+		prefix + "USIM.ICCID":                           "89490200001234567890",
+	})
+	if got := uci.Count("mmcli -m /org/freedesktop/ModemManager1/Modem/0 --signal-setup=10"); got != 1 {
+		t.Errorf("Expected the signal polling to be set up once, got %d", got)
+	}
+}
+
+func TestUQMI(t *testing.T) {
+	ucitest.UseStore(t)
+	uci := newUCI().
+		On("uqmi -s -d /dev/cdc-wdm0 --get-imei", `"867962040000002"`).
+		On("uqmi -s -d /dev/cdc-wdm0 --get-pin-status", `{"pin1_status":"disabled","pin1_verify_tries":3,"pin1_unlock_tries":10}`).
+		On("uqmi -s -d /dev/cdc-wdm0 --get-imsi", `"262021234567890"`).
+		On("uqmi -s -d /dev/cdc-wdm0 --get-iccid", `"89490200001234567891"`).
+		On("uqmi -s -d /dev/cdc-wdm0 --get-serving-system", `{"registration":"registered","plmn_mcc":262,"plmn_mnc":2,"plmn_description":"vodafone.de","roaming":false}`).
+		On("uqmi -s -d /dev/cdc-wdm0 --get-data-status", `"disconnected"`).
+		On("uqmi -s -d /dev/cdc-wdm0 --get-signal-info", `{"type":"lte","rssi":-71,"rsrq":-11,"rsrp":-104,"snr":6.8}`)
+	// mmcli is not installed
+	manager := cellular.NewManager(uci, cellular.MMCLI{Runner: uci}, cellular.UQMI{Runner: uci})
+	if err := manager.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := "Device.Cellular.Interface.1."
+	ucitest.ExpectStored(t, map[string]string{
+		prefix + "Status": "Dormant",
+		prefix + "IMEI":   "867962040000002",
+		prefix + "RSSI":   "-71",
+		prefix + "X_ISPAPP_CurrentAccessTechnology": "LTE",
+		prefix + "X_ISPAPP_RSRP":                    "-104",
+		prefix + "X_ISPAPP_SINR":                    "7",
+		prefix + "USIM.Status":                      "Valid",
+		prefix + "USIM.ICCID":                       "89490200001234567891",
+		// The qmi interface is numbered after the ModemManager one
+		"Device.Cellular.AccessPointNumberOfEntries": "2",
+		"Device.Cellular.AccessPoint.1.APN":          "internet.telekom",
+		"Device.Cellular.AccessPoint.2.APN":          "web.vodafone.de",
+		"Device.Cellular.AccessPoint.2.Username":     "vodafone",
+		"Device.Cellular.AccessPoint.2.Password":     "",
+	})
+	if got := uci.Option("network", "backup", "cellular_ap_instance"); got != "2" {
+		t.Errorf("Expected the access point to be numbered, got %q", got)
+	}
+}
+
+// fakePort answers AT commands like a Quectel RM500Q attached over EN-DC
+type fakePort struct {
+	answers map[string]string
+	out     bytes.Buffer
+}
+
+func (p *fakePort) Write(data []byte) (int, error) {
+	command := strings.TrimSuffix(string(data), "\r")
+	answer, ok := p.answers[command]
+	if !ok {
+		answer = "ERROR"
+	}
+	p.out.WriteString(command + "\r\r\n" + answer + "\r\n")
+	return len(data), nil
+}
+
+func (p *fakePort) Read(data []byte) (int, error) { return p.out.Read(data) }
+func (p *fakePort) Close() error                  { return nil }
+
+func TestAT(t *testing.T) {
+	ucitest.UseStore(t)
+	port := &fakePort{answers: map[string]string{
+		"ATE0":      "OK",
+		"AT+CFUN?":  "+CFUN: 1\r\n\r\nOK",
+		"AT+CGSN":   "867962040000003\r\n\r\nOK",
+		"AT+CGMM":   "RM500Q-GL\r\n\r\nOK",
+		"AT+CGMR":   "RM500QGLABR11A06M4G\r\n\r\nOK",
+		"AT+CPIN?":  "+CPIN: READY\r\n\r\nOK",
+		"AT+CIMI":   "262031234567890\r\n\r\nOK",
+		"AT+QCCID":  "+QCCID: 89490200001234567892\r\n\r\nOK",
+		"AT+CSQ":    "+CSQ: 24,99\r\n\r\nOK",
+		"AT+COPS?":  "+COPS: 0,0,\"o2 - de\",13\r\n\r\nOK",
+		"AT+CEREG?": "+CEREG: 0,1\r\n\r\nOK",
+		"AT+CREG?":  "+CREG: 0,1\r\n\r\nOK",
+		"AT+CGACT?": "+CGACT: 1,1\r\n+CGACT: 2,0\r\n\r\nOK",
+		`AT+QENG="servingcell"`: "+QENG: \"servingcell\",\"NOCONN\"\r\n" +
+			"+QENG: \"LTE\",\"FDD\",262,03,26D7A0A,301,1300,3,5,5,A5DC,-95,-10,-66,14,11,-,-,31\r\n" +
+			"+QENG: \"NR5G-NSA\",262,03,712,-89,18,-11,632448,78,12,1\r\n\r\nOK",
+	}}
+	var opened string
+	at := cellular.AT{Open: func(name string) (io.ReadWriteCloser, error) {
+		opened = name
+		return port, nil
+	}}
+	uci := newUCI().Section("network", "lte", "interface", "proto", "ncm", "device", "/dev/ttyUSB2")
+	if err := cellular.NewManager(uci, at).Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if opened != "/dev/ttyUSB2" {
+		t.Errorf("Expected the AT port of the ncm interface, got %q", opened)
+	}
+
+	prefix := "Device.Cellular.Interface.1."
+	ucitest.ExpectStored(t, map[string]string{
+		prefix + "Status":                                "Up",
+		prefix + "IMEI":                                  "867962040000003",
+		prefix + "X_ISPAPP_Model":                        "RM500Q-GL",
+		prefix + "RSSI":                                  "-65",
+		prefix + "X_ISPAPP_CurrentAccessTechnology":      "NR",
+		prefix + "USIM.ICCID":                            "89490200001234567892",
+		prefix + "X_ISPAPP_CellId":                       "40729098",
+		prefix + "X_ISPAPP_RSRP":                         "-95",
+		prefix + "X_ISPAPP_SINR":                         "14",
+		prefix + "X_ISPAPP_BandInfo":                     "B3",
+		prefix + "X_ISPAPP_5G_Band":                      "78",
+		prefix + "X_ISPAPP_5G_RSRP":                      "-89",
+		prefix + "X_ISPAPP_5G_PhysicalCellId":            "712",
+		prefix + "X_ISPAPP_CarrierInfoNumberOfEntries":   "1",
+		prefix + "X_ISPAPP_CarrierInfo.1.Fcn":            "1300",
+		prefix + "X_ISPAPP_CarrierInfo.1.Bandwidth":      "20",
+		prefix + "X_ISPAPP_CarrierInfo.1.PhysicalCellId": "301",
+	})
+}
+
+func TestScan(t *testing.T) {
+	ucitest.UseStore(t)
+	port := &fakePort{answers: map[string]string{
+		"ATE0":                  "OK",
+		`AT+QENG="servingcell"`: "+QENG: \"servingcell\",\"NOCONN\",\"LTE\",\"FDD\",262,03,26D7A0A,301,1300,3,5,5,A5DC,-95,-10,-66,14,11,-,-,31\r\n\r\nOK",
+		`AT+QENG="neighbourcell"`: "+QENG: \"neighbourcell intra\",\"LTE\",1300,302,-13,-101,-70,2,20,3,62,-,-\r\n" +
+			"+QENG: \"neighbourcell inter\",\"LTE\",6300,17,-14,-108,-75,0,12,2,10,20\r\n\r\nOK",
+	}}
+	at := cellular.AT{Port: "/dev/ttyUSB2", Open: func(string) (io.ReadWriteCloser, error) { return port, nil }}
+	cells, err := cellular.NewManager(newUCI(), cellular.UQMI{Runner: newUCI()}, at).Scan(context.Background(), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []device.CellDiagResult{
+		{Index: 1, Band: 3, Fcn: 1300, PhysicalCellId: 301, RSSI: -66, RSRP: -95, RSRQ: -10},
+		{Index: 2, Band: 3, Fcn: 1300, PhysicalCellId: 302, RSSI: -70, RSRP: -101, RSRQ: -13},
+		{Index: 3, Band: 20, Fcn: 6300, PhysicalCellId: 17, RSSI: -75, RSRP: -108, RSRQ: -14},
+	}
+	if !reflect.DeepEqual(cells, expected) {
+		t.Errorf("Expected the cells strongest first, got %+v", cells)
+	}
+}
+
+func TestSetAccessPoint(t *testing.T) {
+	ucitest.UseStore(t)
+	uci := newUCI()
+	registry := params.NewRegistry()
+	cellular.NewManager(uci).Register(registry)
+
+	faults := registry.Set([]soap.SetParameterValueStruct{
+		{Name: "Device.Cellular.AccessPoint.1.APN", Value: "internet.t-mobile"},
+		{Name: "Device.Cellular.AccessPoint.2.Password", Value: ""},
+	})
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	if got := uci.Option("network", "wwan", "apn"); got != "internet.t-mobile" {
+		t.Errorf("Expected the APN to be written, got %q", got)
+	}
+	if got := uci.Option("network", "backup", "password"); got != "" {
+		t.Errorf("Expected the password to be cleared, got %q", got)
+	}
+	if got := uci.Count("/etc/init.d/network reload"); got != 1 {
+		t.Errorf("Expected one network reload, got %d", got)
+	}
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		faults := registry.Set([]soap.SetParameterValueStruct{{Name: "Device.Cellular.Interface.1.IMEI", Value: "0"}})
+		if len(faults) != 1 || faults[0].Code != params.FaultNotWritable {
+			t.Errorf("Expected the modem to be read-only, got %v", faults)
+		}
+	})
+
+	t.Run("UnknownInstance", func(t *testing.T) {
+		faults := registry.Set([]soap.SetParameterValueStruct{{Name: "Device.Cellular.AccessPoint.3.APN", Value: "internet"}})
+		if len(faults) != 1 || faults[0].Code != params.FaultInvalidName {
+			t.Errorf("Expected an invalid name, got %v", faults)
+		}
+	})
+}
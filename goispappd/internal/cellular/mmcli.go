@@ -0,0 +1,249 @@
+package cellular
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// signalRefresh is the rate in seconds ModemManager polls the extended signal
+// information at once it is set up
+const signalRefresh = "10"
+
+// modemStatus maps the ModemManager modem states to the TR-181 Status
+var modemStatus = map[string]string{
+	"failed":        "Error",
+	"unknown":       "Unknown",
+	"initializing":  "Down",
+	"locked":        "Down",
+	"disabled":      "Down",
+	"disabling":     "Down",
+	"enabling":      "Down",
+	"enabled":       "Dormant",
+	"searching":     "Dormant",
+	"registered":    "Dormant",
+	"disconnecting": "Dormant",
+	"connecting":    "Dormant",
+	"connected":     "Up",
+}
+
+// MMCLI reads the modems from ModemManager with mmcli -J
+type MMCLI struct {
+	Runner exec.Runner
+}
+
+// mmModem is the output of mmcli -J -m
+type mmModem struct {
+	Modem struct {
+		ThreeGPP struct {
+			IMEI string `json:"imei"`
+		} `json:"3gpp"`
+		Generic struct {
+			AccessTechnologies    []string `json:"access-technologies"`
+			CurrentBands          []string `json:"current-bands"`
+			CurrentModes          string   `json:"current-modes"`
+			EquipmentIdentifier   string   `json:"equipment-identifier"`
+			Model                 string   `json:"model"`
+			Revision              string   `json:"revision"`
+			Sim                   string   `json:"sim"`
+			State                 string   `json:"state"`
+			StateFailedReason     string   `json:"state-failed-reason"`
+			SupportedBands        []string `json:"supported-bands"`
+			SupportedCapabilities []string `json:"supported-capabilities"`
+			UnlockRequired        string   `json:"unlock-required"`
+		} `json:"generic"`
+	} `json:"modem"`
+}
+
+// mmSignal is the output of mmcli -J -m --signal-get, values are decimal
+// strings or -- when unknown
+type mmSignal struct {
+	Modem struct {
+		Signal struct {
+			NR      map[string]string `json:"5g"`
+			LTE     map[string]string `json:"lte"`
+			UMTS    map[string]string `json:"umts"`
+			GSM     map[string]string `json:"gsm"`
+			Refresh struct {
+				Rate string `json:"rate"`
+			} `json:"refresh"`
+		} `json:"signal"`
+	} `json:"modem"`
+}
+
+// mmSIM is the output of mmcli -J -i
+type mmSIM struct {
+	SIM struct {
+		Properties struct {
+			ICCID string `json:"iccid"`
+			IMSI  string `json:"imsi"`
+		} `json:"properties"`
+	} `json:"sim"`
+}
+
+// query runs mmcli and decodes its JSON output into v
+func (b MMCLI) query(ctx context.Context, v any, args ...string) error {
+	output, err := ucicfg.Command(ctx, b.Runner, "mmcli", append([]string{"-J"}, args...)...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(output), v); err != nil {
+		return fmt.Errorf("mmcli %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// Interfaces implements Backend
+func (b MMCLI) Interfaces(ctx context.Context, _ []*uci.Section) ([]device.CellularInterface, error) {
+	var list struct {
+		Modems []string `json:"modem-list"`
+	}
+	if err := b.query(ctx, &list, "-L"); err != nil {
+		// ModemManager is not installed or not running
+		return nil, fmt.Errorf("%w: %v", ErrNoModem, err)
+	}
+	var interfaces []device.CellularInterface
+	for _, path := range list.Modems {
+		iface, err := b.modem(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces, nil
+}
+
+// modem reads one modem with its signal and SIM
+func (b MMCLI) modem(ctx context.Context, path string) (device.CellularInterface, error) {
+	var modem mmModem
+	if err := b.query(ctx, &modem, "-m", path); err != nil {
+		return device.CellularInterface{}, err
+	}
+	generic := modem.Modem.Generic
+	iface := device.CellularInterface{
+		Enable:            generic.State != "disabled" && generic.State != "disabling",
+		Status:            modemStatus[generic.State],
+		IMEI:              mmValue(modem.Modem.ThreeGPP.IMEI),
+		X_ISPAPP_Model:    mmValue(generic.Model),
+		X_ISPAPP_Revision: mmValue(generic.Revision),
+	}
+	if iface.Status == "" {
+		iface.Status = "Unknown"
+	}
+	if iface.IMEI == "" {
+		iface.IMEI = mmValue(generic.EquipmentIdentifier)
+	}
+
+	for _, capabilities := range generic.SupportedCapabilities {
+		for _, capability := range strings.Split(capabilities, ",") {
+			switch strings.TrimSpace(capability) {
+			case "gsm-umts":
+				iface.X_ISPAPP_SupportedAccessTechnologies = appendUnique(iface.X_ISPAPP_SupportedAccessTechnologies, "GPRS", "EDGE", "UMTS", "UMTSHSPA")
+			case "lte":
+				iface.X_ISPAPP_SupportedAccessTechnologies = appendUnique(iface.X_ISPAPP_SupportedAccessTechnologies, "LTE")
+			case "5gnr":
+				iface.X_ISPAPP_SupportedAccessTechnologies = appendUnique(iface.X_ISPAPP_SupportedAccessTechnologies, "NR")
+			}
+		}
+	}
+	// current-modes reads like "allowed: 3g, 4g; preferred: 4g"
+	allowed, _, _ := strings.Cut(strings.TrimPrefix(generic.CurrentModes, "allowed:"), ";")
+	for _, mode := range strings.Split(allowed, ",") {
+		iface.X_ISPAPP_AccessTechnologies = appendUnique(iface.X_ISPAPP_AccessTechnologies, modeTechnologies[strings.TrimSpace(mode)]...)
+	}
+	// The technologies in use are listed slowest first
+	for _, technology := range generic.AccessTechnologies {
+		if name, ok := accessTechnologies[technology]; ok {
+			iface.X_ISPAPP_CurrentAccessTechnology = name
+		}
+	}
+	iface.X_ISPAPP_SupportedLteBands, iface.X_ISPAPP_Supported5GBands = mmBands(generic.SupportedBands)
+	iface.X_ISPAPP_LteBands, iface.X_ISPAPP_5GBands = mmBands(generic.CurrentBands)
+
+	if err := b.signal(ctx, path, &iface); err != nil {
+		return device.CellularInterface{}, err
+	}
+
+	switch {
+	case mmValue(generic.Sim) == "" || generic.StateFailedReason == "sim-missing":
+		iface.USIM.Status = "None"
+	case strings.HasPrefix(generic.UnlockRequired, "sim-"):
+		iface.USIM.Status = "Blocked"
+	default:
+		var sim mmSIM
+		if err := b.query(ctx, &sim, "-i", generic.Sim); err != nil {
+			return device.CellularInterface{}, err
+		}
+		iface.USIM.IMSI = mmValue(sim.SIM.Properties.IMSI)
+		iface.USIM.ICCID = mmValue(sim.SIM.Properties.ICCID)
+		iface.USIM.Status = simStatus(iface.USIM)
+	}
+	return iface, nil
+}
+
+// signal reads the extended signal information. ModemManager only polls it
+// once a refresh rate is set, the first collect sets it up
+func (b MMCLI) signal(ctx context.Context, path string, iface *device.CellularInterface) error {
+	var signal mmSignal
+	if err := b.query(ctx, &signal, "-m", path, "--signal-get"); err != nil {
+		return err
+	}
+	s := signal.Modem.Signal
+	if s.Refresh.Rate == "" || s.Refresh.Rate == "0" {
+		// A modem without extended signal support refuses the setup
+		ucicfg.Command(ctx, b.Runner, "mmcli", "-m", path, "--signal-setup="+signalRefresh)
+	}
+	iface.X_ISPAPP_RSRP = mmNumber(s.LTE["rsrp"])
+	iface.X_ISPAPP_RSRQ = mmNumber(s.LTE["rsrq"])
+	iface.X_ISPAPP_SINR = mmNumber(s.LTE["snr"])
+	iface.X_ISPAPP_RSCP = mmNumber(s.UMTS["rscp"])
+	iface.X_ISPAPP_ECNO = mmNumber(s.UMTS["ecio"])
+	iface.X_ISPAPP_5G_RSRP = mmNumber(s.NR["rsrp"])
+	iface.X_ISPAPP_5G_RSRQ = mmNumber(s.NR["rsrq"])
+	iface.X_ISPAPP_5G_SINR = mmNumber(s.NR["snr"])
+	for _, rssi := range []string{s.LTE["rssi"], s.UMTS["rssi"], s.GSM["rssi"]} {
+		if iface.RSSI = mmNumber(rssi); iface.RSSI != 0 {
+			break
+		}
+	}
+	return nil
+}
+
+// mmValue returns a ModemManager value, empty for the -- of an unknown one
+func mmValue(value string) string {
+	if value == "--" {
+		return ""
+	}
+	return value
+}
+
+// mmNumber rounds a decimal ModemManager value, 0 when unknown
+func mmNumber(value string) int {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return int(math.Round(number))
+}
+
+// mmBands splits ModemManager band names like eutran-3 and ngran-78 into the
+// LTE and 5G band numbers
+func mmBands(bands []string) (lte, nr []string) {
+	for _, band := range bands {
+		if number, ok := strings.CutPrefix(band, "eutran-"); ok {
+			lte = append(lte, number)
+		}
+		if number, ok := strings.CutPrefix(band, "ngran-"); ok {
+			nr = append(nr, number)
+		}
+	}
+	return lte, nr
+}
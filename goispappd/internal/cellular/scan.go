@@ -0,0 +1,282 @@
+package cellular
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/uci"
+)
+
+// scanInterval is the time between two measurements of a cell scan
+const scanInterval = 2 * time.Second
+
+// CellReader is implemented by the backends listing the cells a modem
+// measures, the serving cell included
+type CellReader interface {
+	Cells(ctx context.Context, network []*uci.Section) ([]device.CellDiagResult, error)
+}
+
+// lteBands are the first downlink EARFCN of the LTE bands, from 3GPP TS
+// 36.101 table 5.7.3-1, in ascending order
+var lteBands = []struct{ earfcn, band int }{
+	{0, 1}, {600, 2}, {1200, 3}, {1950, 4}, {2400, 5}, {2650, 6}, {2750, 7}, {3450, 8},
+	{3800, 9}, {4150, 10}, {4750, 11}, {5010, 12}, {5180, 13}, {5280, 14}, {5380, 0},
+	{5730, 17}, {5850, 18}, {6000, 19}, {6150, 20}, {6450, 21}, {6600, 22}, {7500, 23},
+	{7700, 24}, {8040, 25}, {8690, 26}, {9040, 27}, {9210, 28}, {9660, 29}, {9770, 30},
+	{9870, 31}, {9920, 32}, {36000, 33}, {36200, 34}, {36350, 35}, {36950, 36},
+	{37550, 37}, {37750, 38}, {38250, 39}, {38650, 40}, {39650, 41}, {41590, 42},
+	{43590, 43}, {45590, 44}, {46590, 45}, {46790, 46}, {54540, 47}, {55240, 48},
+	{56740, 49}, {58240, 50}, {59140, 51}, {60140, 52}, {60255, 0}, {65536, 65},
+	{66436, 66}, {67336, 67}, {67536, 68}, {67836, 69}, {68336, 70}, {68586, 71},
+	{68936, 0},
+}
+
+// lteBand returns the band of an LTE downlink EARFCN, 0 when unknown
+func lteBand(earfcn int) int {
+	band := 0
+	for _, b := range lteBands {
+		if earfcn < b.earfcn {
+			break
+		}
+		band = b.band
+	}
+	return band
+}
+
+// Scan measures the cells the modem receives for duration. A cell seen
+// several times is reported once with its last measurement, the strongest
+// first, which is what aiming an antenna needs
+func (m *Manager) Scan(ctx context.Context, duration time.Duration) ([]device.CellDiagResult, error) {
+	m.mu.Lock()
+	points, err := m.load(ctx)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	network := make([]*uci.Section, len(points))
+	for i, p := range points {
+		network[i] = p.sec
+	}
+
+	type cellKey struct{ fcn, pci int }
+	cells := make(map[cellKey]device.CellDiagResult)
+	measure := func(reader CellReader) error {
+		measured, err := reader.Cells(ctx, network)
+		for _, cell := range measured {
+			cells[cellKey{cell.Fcn, cell.PhysicalCellId}] = cell
+		}
+		return err
+	}
+
+	// The first backend measuring cells runs the scan
+	var reader CellReader
+	failed := ErrNoModem
+	for _, backend := range m.backends {
+		candidate, ok := backend.(CellReader)
+		if !ok {
+			continue
+		}
+		err := measure(candidate)
+		if err == nil {
+			reader = candidate
+			break
+		}
+		if !errors.Is(err, ErrNoModem) && errors.Is(failed, ErrNoModem) {
+			failed = err
+		}
+	}
+	if reader == nil {
+		return nil, failed
+	}
+
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+	ticker := time.NewTicker(scanInterval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline.C:
+			done = true
+		case <-ticker.C:
+			// A failed measurement only misses one sample
+			measure(reader)
+		}
+	}
+
+	results := make([]device.CellDiagResult, 0, len(cells))
+	for _, cell := range cells {
+		results = append(results, cell)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].RSRP != results[j].RSRP {
+			return results[i].RSRP > results[j].RSRP
+		}
+		return results[i].Fcn < results[j].Fcn || results[i].Fcn == results[j].Fcn && results[i].PhysicalCellId < results[j].PhysicalCellId
+	})
+	for i := range results {
+		results[i].Index = i + 1
+	}
+	return results, nil
+}
+
+// Cells implements CellReader with the Quectel AT+QENG serving and neighbour
+// cell reports
+func (b AT) Cells(ctx context.Context, network []*uci.Section) ([]device.CellDiagResult, error) {
+	s, err := b.open(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	defer s.port.Close()
+
+	serving, err := s.command(ctx, `AT+QENG="servingcell"`)
+	if err != nil {
+		return nil, err
+	}
+	var cells []device.CellDiagResult
+	for _, line := range serving {
+		values := fields(line)
+		if len(values) > 2 && values[0] == "servingcell" {
+			values = values[2:]
+		}
+		switch {
+		case len(values) >= 15 && values[0] == "LTE":
+			cells = append(cells, device.CellDiagResult{
+				Band:           fieldNumber(values, 7),
+				Fcn:            fieldNumber(values, 6),
+				PhysicalCellId: fieldNumber(values, 5),
+				RSRP:           fieldNumber(values, 11),
+				RSRQ:           fieldNumber(values, 12),
+				RSSI:           fieldNumber(values, 13),
+			})
+		case len(values) >= 9 && values[0] == "NR5G-NSA":
+			cells = append(cells, device.CellDiagResult{
+				Band:           fieldNumber(values, 8),
+				Fcn:            fieldNumber(values, 7),
+				PhysicalCellId: fieldNumber(values, 3),
+				RSRP:           fieldNumber(values, 4),
+				RSRQ:           fieldNumber(values, 6),
+			})
+		}
+	}
+
+	// A modem without neighbours answers OK without lines
+	neighbours, _ := s.command(ctx, `AT+QENG="neighbourcell"`)
+	for _, line := range neighbours {
+		// "neighbourcell intra","LTE",<earfcn>,<PCID>,<RSRQ>,<RSRP>,<RSSI>,<SINR>,...
+		values := fields(line)
+		if len(values) < 7 || !strings.HasPrefix(values[0], "neighbourcell") || values[1] != "LTE" {
+			continue
+		}
+		earfcn := fieldNumber(values, 2)
+		cells = append(cells, device.CellDiagResult{
+			Band:           lteBand(earfcn),
+			Fcn:            earfcn,
+			PhysicalCellId: fieldNumber(values, 3),
+			RSRQ:           fieldNumber(values, 4),
+			RSRP:           fieldNumber(values, 5),
+			RSSI:           fieldNumber(values, 6),
+		})
+	}
+	return cells, nil
+}
+
+// uqmiCell is a cell of uqmi --get-cell-location-info
+type uqmiCell struct {
+	PhysicalCellID int     `json:"physical_cell_id"`
+	RSRQ           float64 `json:"rsrq"`
+	RSRP           float64 `json:"rsrp"`
+	RSSI           float64 `json:"rssi"`
+}
+
+// uqmiCellLocation is the LTE part of uqmi --get-cell-location-info
+type uqmiCellLocation struct {
+	Intra struct {
+		Channel int        `json:"channel"`
+		Cells   []uqmiCell `json:"cell"`
+	} `json:"intrafrequency_lte_info"`
+	Inter struct {
+		Frequencies []struct {
+			Channel int        `json:"channel"`
+			Cells   []uqmiCell `json:"cell"`
+		} `json:"frequency"`
+	} `json:"interfrequency_lte_info"`
+}
+
+// Cells implements CellReader with the NAS cell location of QMI
+func (b UQMI) Cells(ctx context.Context, network []*uci.Section) ([]device.CellDiagResult, error) {
+	devices := b.devices(network)
+	if len(devices) == 0 {
+		return nil, ErrNoModem
+	}
+	var location uqmiCellLocation
+	if err := b.query(ctx, devices[0], "--get-cell-location-info", &location); err != nil {
+		return nil, err
+	}
+	var cells []device.CellDiagResult
+	add := func(channel int, measured []uqmiCell) {
+		for _, cell := range measured {
+			cells = append(cells, device.CellDiagResult{
+				Band:           lteBand(channel),
+				Fcn:            channel,
+				PhysicalCellId: cell.PhysicalCellID,
+				RSSI:           int(math.Round(cell.RSSI)),
+				RSRP:           int(math.Round(cell.RSRP)),
+				RSRQ:           int(math.Round(cell.RSRQ)),
+			})
+		}
+	}
+	add(location.Intra.Channel, location.Intra.Cells)
+	for _, frequency := range location.Inter.Frequencies {
+		add(frequency.Channel, frequency.Cells)
+	}
+	return cells, nil
+}
+
+// Cells implements CellReader with the cell info of ModemManager 1.20 and
+// later, one "key: value" list per cell
+func (b MMCLI) Cells(ctx context.Context, _ []*uci.Section) ([]device.CellDiagResult, error) {
+	var list struct {
+		Modems []string `json:"modem-list"`
+	}
+	if err := b.query(ctx, &list, "-L"); err != nil || len(list.Modems) == 0 {
+		return nil, ErrNoModem
+	}
+	var info struct {
+		Modem struct {
+			CellInfo []string `json:"cell-info"`
+		} `json:"modem"`
+	}
+	if err := b.query(ctx, &info, "-m", list.Modems[0], "--get-cell-info"); err != nil {
+		return nil, err
+	}
+	var cells []device.CellDiagResult
+	for _, entry := range info.Modem.CellInfo {
+		properties := make(map[string]string)
+		for _, property := range strings.FieldsFunc(entry, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if key, value, ok := strings.Cut(property, ":"); ok {
+				properties[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+		if properties["cell type"] != "lte" {
+			continue
+		}
+		earfcn, _ := strconv.Atoi(properties["earfcn"])
+		pci, _ := strconv.ParseInt(properties["physical ci"], 16, 64)
+		cells = append(cells, device.CellDiagResult{
+			Band:           lteBand(earfcn),
+			Fcn:            earfcn,
+			PhysicalCellId: int(pci),
+			RSRP:           mmNumber(properties["rsrp"]),
+			RSRQ:           mmNumber(properties["rsrq"]),
+		})
+	}
+	return cells, nil
+}
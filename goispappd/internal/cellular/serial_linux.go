@@ -0,0 +1,43 @@
+package cellular
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openSerial opens an AT port in raw mode, the line discipline would echo
+// and translate the answers otherwise
+func openSerial(name string) (io.ReadWriteCloser, error) {
+	port, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := port.SyscallConn()
+	if err != nil {
+		port.Close()
+		return nil, err
+	}
+	var errno syscall.Errno
+	raw.Control(func(fd uintptr) {
+		var t syscall.Termios
+		if _, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCGETS, uintptr(unsafe.Pointer(&t))); errno != 0 {
+			return
+		}
+		t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+		t.Oflag &^= syscall.OPOST
+		t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+		t.Cflag &^= syscall.CSIZE | syscall.PARENB
+		t.Cflag |= syscall.CS8 | syscall.CREAD | syscall.CLOCAL
+		t.Cc[syscall.VMIN] = 1
+		t.Cc[syscall.VTIME] = 0
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+	})
+	if errno != 0 {
+		port.Close()
+		return nil, fmt.Errorf("%s: set raw mode: %w", name, errno)
+	}
+	return port, nil
+}
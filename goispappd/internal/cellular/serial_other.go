@@ -0,0 +1,13 @@
+//go:build !linux
+
+package cellular
+
+import (
+	"fmt"
+	"io"
+)
+
+// openSerial needs the termios ioctls of Linux
+func openSerial(name string) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("serial ports are only supported on Linux")
+}
@@ -0,0 +1,122 @@
+package cellular
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// UQMI reads QMI modems with uqmi
+type UQMI struct {
+	Runner exec.Runner
+	Device string // Control device, the device option of the qmi interfaces when empty
+}
+
+// uqmiSignal is the output of uqmi --get-signal-info
+type uqmiSignal struct {
+	Type string  `json:"type"`
+	RSSI float64 `json:"rssi"`
+	RSRQ float64 `json:"rsrq"`
+	RSRP float64 `json:"rsrp"`
+	SNR  float64 `json:"snr"`
+	ECIO float64 `json:"ecio"`
+}
+
+// query runs one uqmi command on device and decodes its JSON output into v
+func (b UQMI) query(ctx context.Context, device, command string, v any) error {
+	output, err := ucicfg.Command(ctx, b.Runner, "uqmi", "-s", "-d", device, command)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(output), v); err != nil {
+		return fmt.Errorf("uqmi %s: %w", command, err)
+	}
+	return nil
+}
+
+// devices returns the control devices of the modems
+func (b UQMI) devices(network []*uci.Section) []string {
+	if b.Device != "" {
+		return []string{b.Device}
+	}
+	var devices []string
+	for _, sec := range network {
+		if sec.Options["proto"] == "qmi" && sec.Options["device"] != "" {
+			devices = appendUnique(devices, sec.Options["device"])
+		}
+	}
+	return devices
+}
+
+// Interfaces implements Backend
+func (b UQMI) Interfaces(ctx context.Context, network []*uci.Section) ([]device.CellularInterface, error) {
+	devices := b.devices(network)
+	if len(devices) == 0 {
+		return nil, ErrNoModem
+	}
+	var interfaces []device.CellularInterface
+	for _, path := range devices {
+		iface := device.CellularInterface{Enable: true}
+		if err := b.query(ctx, path, "--get-imei", &iface.IMEI); err != nil {
+			// The modem is unplugged or uqmi is not installed
+			continue
+		}
+		b.radio(ctx, path, &iface)
+		interfaces = append(interfaces, iface)
+	}
+	if len(interfaces) == 0 {
+		return nil, ErrNoModem
+	}
+	return interfaces, nil
+}
+
+// radio reads the SIM, the registration and the signal of a modem, the values
+// the modem cannot tell in its state are left empty
+func (b UQMI) radio(ctx context.Context, path string, iface *device.CellularInterface) {
+	var pin struct {
+		Status string `json:"pin1_status"`
+	}
+	b.query(ctx, path, "--get-pin-status", &pin)
+	b.query(ctx, path, "--get-imsi", &iface.USIM.IMSI)
+	b.query(ctx, path, "--get-iccid", &iface.USIM.ICCID)
+	iface.USIM.Status = simStatus(iface.USIM)
+	if pin.Status == "not_verified" || pin.Status == "blocked" || pin.Status == "permanently_blocked" {
+		iface.USIM.Status = "Blocked"
+	}
+
+	var serving struct {
+		Registration string `json:"registration"`
+	}
+	var data string
+	b.query(ctx, path, "--get-serving-system", &serving)
+	b.query(ctx, path, "--get-data-status", &data)
+	switch {
+	case data == "connected":
+		iface.Status = "Up"
+	case serving.Registration == "registered":
+		iface.Status = "Dormant"
+	default:
+		iface.Status = "Down"
+	}
+
+	var signal uqmiSignal
+	if b.query(ctx, path, "--get-signal-info", &signal) != nil {
+		return
+	}
+	iface.X_ISPAPP_CurrentAccessTechnology = accessTechnologies[signal.Type]
+	iface.RSSI = int(math.Round(signal.RSSI))
+	switch signal.Type {
+	case "lte":
+		iface.X_ISPAPP_RSRP = int(math.Round(signal.RSRP))
+		iface.X_ISPAPP_RSRQ = int(math.Round(signal.RSRQ))
+		iface.X_ISPAPP_SINR = int(math.Round(signal.SNR))
+	case "wcdma":
+		iface.X_ISPAPP_ECNO = int(math.Round(signal.ECIO))
+	}
+}
@@ -9,8 +9,10 @@ import (
 	"github.com/Niceblueman/goispappd/internal/exec"
 )
 
-var InformCommands = map[string]func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error){
-	"Device.DeviceInfo.ManagementServer.URL": func(_ *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+// InformCommands maps parameter paths to getters run through a Runner, so the
+// same getter works locally, over SSH or against fixtures in tests
+var InformCommands = map[string]func(runner exec.Runner) (*exec.CommandResult, error){
+	"Device.DeviceInfo.ManagementServer.URL": func(_ exec.Runner) (*exec.CommandResult, error) {
 		// ManagementServer is from the yml config
 		cfg, err := config.LoadConfig()
 		if err != nil {
@@ -21,7 +23,7 @@ var InformCommands = map[string]func(exec *exec.Executor, sshhost *string) (*exe
 			Raw:     []byte(cfg.ACSURL),
 		}, nil
 	},
-	"Device.DeviceInfo.ManagementServer.Username": func(_ *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ManagementServer.Username": func(_ exec.Runner) (*exec.CommandResult, error) {
 		// ManagementServer is from the yml config
 		cfg, err := config.LoadConfig()
 		if err != nil {
@@ -32,7 +34,7 @@ var InformCommands = map[string]func(exec *exec.Executor, sshhost *string) (*exe
 			Raw:     []byte(cfg.Username),
 		}, nil
 	},
-	"Device.DeviceInfo.ManagementServer.Password": func(_ *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ManagementServer.Password": func(_ exec.Runner) (*exec.CommandResult, error) {
 		// ManagementServer is from the yml config
 		cfg, err := config.LoadConfig()
 		if err != nil {
@@ -43,14 +45,14 @@ var InformCommands = map[string]func(exec *exec.Executor, sshhost *string) (*exe
 			Raw:     []byte(cfg.Password),
 		}, nil
 	},
-	"Device.DeviceInfo.ManagementServer.PeriodicInformEnable": func(_ *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ManagementServer.PeriodicInformEnable": func(_ exec.Runner) (*exec.CommandResult, error) {
 		// ManagementServer static
 		return &exec.CommandResult{
 			Success: true,
 			Raw:     []byte("1"),
 		}, nil
 	},
-	"Device.DeviceInfo.ManagementServer.PeriodicInformInterval": func(_ *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ManagementServer.PeriodicInformInterval": func(_ exec.Runner) (*exec.CommandResult, error) {
 		// ManagementServer is from the yml config
 		cfg, err := config.LoadConfig()
 		if err != nil {
@@ -63,16 +65,13 @@ var InformCommands = map[string]func(exec *exec.Executor, sshhost *string) (*exe
 			Raw:     []byte(strconv.Itoa(interval)),
 		}, nil
 	},
-	"Device.OutsideIPAddress": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.OutsideIPAddress": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `curl -s "https://ip.longshot-router.com/json" 2>/dev/null | grep -o '"realIp":"[^"]*"' | cut -d':' -f2 | tr -d '"' || echo ""`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.ProvisioningCode": func(_ *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ProvisioningCode": func(_ exec.Runner) (*exec.CommandResult, error) {
 		cfg, err := config.LoadConfig()
 		if err != nil {
 			return nil, err
@@ -83,310 +82,263 @@ var InformCommands = map[string]func(exec *exec.Executor, sshhost *string) (*exe
 		}, nil
 	},
 
-	"Device.DeviceInfo.Manufacturer": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.Manufacturer": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			return nativeResult(identifier(releaseValue("etc/device_info", "DEVICE_MANUFACTURER", "OpenWrt")), nil)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /etc/device_info 2>/dev/null | grep "DEVICE_MANUFACTURER" | cut -f 2 -d '=' | sed -e "s/['\"]//g" -e "s/[]:@/?#[!$&()*+,;=]/_/g" | head -n1 | tr -d '\r\n' || echo "OpenWrt"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.ManufacturerOUI": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ManufacturerOUI": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			return nativeResult(hostInfo.ManufacturerOUI())
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /sys/class/net/eth0/address 2>/dev/null | cut -c 1-8 | tr -d ':' | tr '[:lower:]' '[:upper:]' || echo "000000"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.ManufacturerURL": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ManufacturerURL": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			return nativeResult(releaseValue("etc/device_info", "DEVICE_MANUFACTURER_URL", "https://openwrt.org/"), nil)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /etc/device_info 2>/dev/null | grep "DEVICE_MANUFACTURER_URL" | cut -f 2 -d '=' | sed -e "s/['\"]//g" | head -n1 | tr -d '\r\n' || echo "https://openwrt.org/"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.ModelName": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ModelName": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			if model, err := hostInfo.ReleaseValue("etc/device_info", "DEVICE_PRODUCT"); err == nil {
+				return nativeResult(identifier(model), nil)
+			}
+			name, _, err := hostInfo.BoardModel()
+			return nativeResult(name, err)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /etc/device_info 2>/dev/null | grep "DEVICE_PRODUCT" | cut -f 2 -d '=' | sed -e "s/['\"]//g" -e "s/[]:@/?#[!$&()*+,;=]/_/g" | head -n1 | tr -d '\r\n' || cat /tmp/board.json 2>/dev/null | grep "\"name\"" | cut -f 4 -d '"' | tr -d '\r\n' || echo "DR5332"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.Description": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.Description": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			name, _, err := hostInfo.BoardModel()
+			return nativeResult(name, err)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /tmp/board.json 2>/dev/null | grep "\"name\"" | cut -f 4 -d '"' | tr -d '\r\n' || echo "Qualcomm Technologies, Inc. IPQ5332/AP-MI01.2"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.ProductClass": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ProductClass": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			_, id, err := hostInfo.BoardModel()
+			return nativeResult(id, err)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /tmp/board.json 2>/dev/null | grep "\"id\"" | cut -f 4 -d '"' | tr -d '\r\n' || echo "qcom,ipq5332-ap-mi01.2"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.SerialNumber": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.SerialNumber": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			if serial, err := hostInfo.SerialNumber(); err == nil {
+				return nativeResult(serial, nil)
+			}
+			// uci keeps a serial set at provisioning time
+			return runner.Execute(context.Background(), "uci", "-q", "get", "system.@system[0].serial")
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /proc/cpuinfo 2>/dev/null | grep "Serial" | cut -f 2 -d ':' | tr -d ' \r\n' || uci get system.@system[0].serial 2>/dev/null | tr -d '\r\n' || echo "Unknown"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.SpecVersion": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.SpecVersion": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			return nativeResult(hostInfo.ReleaseValue("etc/openwrt_release", "DISTRIB_RELEASE"))
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /etc/openwrt_release 2>/dev/null | grep "DISTRIB_RELEASE" | cut -f 2 -d '=' | tr -d '"' | tr -d '\r\n' || echo "Unknown"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.HardwareVersion": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.HardwareVersion": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			return nativeResult(identifier(releaseValue("etc/device_info", "DEVICE_REVISION", "v0")), nil)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /etc/device_info 2>/dev/null | grep "DEVICE_REVISION" | cut -f 2 -d '=' | sed -e "s/['\"]//g" -e "s/[]:@/?#[!$&()*+,;=]/_/g" | head -n1 | tr -d '\r\n' || echo "v0"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.SoftwareVersion": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.SoftwareVersion": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			return nativeResult(hostInfo.SoftwareVersion())
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /etc/openwrt_version 2>/dev/null | tr -d '\r\n' || cat /etc/os-release 2>/dev/null | grep "VERSION=" | cut -f 2 -d '=' | tr -d '"' | tr -d '\r\n' || echo "Unknown"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.UpTime": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.UpTime": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			return nativeInt(hostInfo.UpTime())
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /proc/uptime 2>/dev/null | cut -f 1 -d ' ' | cut -f 1 -d '.' | tr -d '\r\n' || echo "0"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFileNumberOfEntries": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFileNumberOfEntries": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | wc -l | tr -d '\r\n' || echo "0"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.MemoryStatus.Total": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.MemoryStatus.Total": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			total, _, err := hostInfo.MemoryStatus()
+			return nativeInt(total, err)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /proc/meminfo 2>/dev/null | grep "MemTotal" | awk '{print $2}' | tr -d '\r\n' || echo "0"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.MemoryStatus.Free": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.MemoryStatus.Free": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			_, free, err := hostInfo.MemoryStatus()
+			return nativeInt(free, err)
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `cat /proc/meminfo 2>/dev/null | grep "MemFree" | awk '{print $2}' | tr -d '\r\n' || echo "0"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.ProcessStatus.CPUUsage": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.ProcessStatus.CPUUsage": func(runner exec.Runner) (*exec.CommandResult, error) {
+		if native(runner) {
+			return nativeInt(cpuSampler.Usage())
+		}
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
-		_cmd := `top -bn1 2>/dev/null | grep "%Cpu(s)" | awk '{print int($2 + $4)}' | tr -d '\r\n' || echo "0"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		// Busybox top has no %Cpu(s) line, sample /proc/stat twice instead
+		_cmd := `{ head -n1 /proc/stat; sleep 1; head -n1 /proc/stat; } | awk '{idle=$5+$6; total=0; for(i=2;i<=NF;i++) total+=$i; if(NR==1){pi=idle; pt=total} else if(total>pt){print int(100*(1-(idle-pi)/(total-pt)))} else {print 0}}'`
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.1.Name": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.1.Name": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n1 | tail -n1 | tr -d '\r\n' || echo "config"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.1.Description": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.1.Description": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n1 | tail -n1 | xargs -I {} sh -c 'echo "Configuration file for {}" | tr -d '\r\n'' || echo "Configuration file"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.1.UseForBackupRestore": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.1.UseForBackupRestore": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n1 | tail -n1 | grep -E "^(system|network|firewall|dhcp|wireless)$" >/dev/null && echo "true" || echo "false"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.2.Index": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.2.Index": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `echo "2"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.2.Name": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.2.Name": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n2 | tail -n1 | tr -d '\r\n' || echo "config"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.2.Description": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.2.Description": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n2 | tail -n1 | xargs -I {} sh -c 'echo "Configuration file for {}" | tr -d '\r\n'' || echo "Configuration file"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.2.UseForBackupRestore": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.2.UseForBackupRestore": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n2 | tail -n1 | grep -E "^(system|network|firewall|dhcp|wireless)$" >/dev/null && echo "true" || echo "false"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.3.Index": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.3.Index": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `echo "3"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.3.Name": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.3.Name": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n3 | tail -n1 | tr -d '\r\n' || echo "config"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.3.Description": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.3.Description": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n3 | tail -n1 | xargs -I {} sh -c 'echo "Configuration file for {}" | tr -d '\r\n'' || echo "Configuration file"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.3.UseForBackupRestore": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.3.UseForBackupRestore": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n3 | tail -n1 | grep -E "^(system|network|firewall|dhcp|wireless)$" >/dev/null && echo "true" || echo "false"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.4.Index": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.4.Index": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `echo "4"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.4.Name": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.4.Name": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n4 | tail -n1 | tr -d '\r\n' || echo "config"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.4.Description": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.4.Description": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n4 | tail -n1 | xargs -I {} sh -c 'echo "Configuration file for {}" | tr -d '\r\n'' || echo "Configuration file"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.4.UseForBackupRestore": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.4.UseForBackupRestore": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n4 | tail -n1 | grep -E "^(system|network|firewall|dhcp|wireless)$" >/dev/null && echo "true" || echo "false"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.5.Index": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.5.Index": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `echo "5"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.5.Name": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.5.Name": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n5 | tail -n1 | tr -d '\r\n' || echo "config"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.5.Description": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.5.Description": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n5 | tail -n1 | xargs -I {} sh -c 'echo "Configuration file for {}" | tr -d '\r\n'' || echo "Configuration file"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
-	"Device.DeviceInfo.VendorConfigFile.5.UseForBackupRestore": func(exec *exec.Executor, sshhost *string) (*exec.CommandResult, error) {
+	"Device.DeviceInfo.VendorConfigFile.5.UseForBackupRestore": func(runner exec.Runner) (*exec.CommandResult, error) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
 		defer cancel()
 		_cmd := `ls /etc/config 2>/dev/null | head -n5 | tail -n1 | grep -E "^(system|network|firewall|dhcp|wireless)$" >/dev/null && echo "true" || echo "false"`
-		if sshhost != nil {
-			return exec.SSHExecute(ctx, *sshhost, _cmd)
-		}
-		return exec.Execute(ctx, _cmd)
+		return runner.Execute(ctx, _cmd)
 	},
 }
@@ -0,0 +1,58 @@
+package commands_test
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/commands"
+	"github.com/Niceblueman/goispappd/internal/exec"
+)
+
+func TestInformCommandsWithFixtures(t *testing.T) {
+	runner := exec.NewFixtureRunner().
+		OnRegexp(`/sys/class/net/eth0/address`, exec.Fixture{Stdout: "9483C4"}).
+		OnRegexp(`/proc/uptime`, exec.Fixture{Stdout: "3600"}).
+		OnRegexp(`MemTotal`, exec.Fixture{Stderr: "cat: /proc/meminfo: No such file", ExitCode: 1})
+
+	tests := []struct {
+		path    string
+		want    string
+		success bool
+	}{
+		{"Device.DeviceInfo.ManufacturerOUI", "9483C4", true},
+		{"Device.DeviceInfo.UpTime", "3600", true},
+		{"Device.DeviceInfo.MemoryStatus.Total", "", false},
+	}
+	for _, tt := range tests {
+		getter := commands.InformCommands[tt.path]
+		if getter == nil {
+			t.Fatalf("No getter for %s", tt.path)
+		}
+		result, err := getter(runner)
+		if tt.success != (err == nil) {
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+			continue
+		}
+		if string(result.Raw) != tt.want || result.Success != tt.success {
+			t.Errorf("%s: expected %q, got %q (success %v)", tt.path, tt.want, result.Raw, result.Success)
+		}
+	}
+}
+
+func TestInformCommandsNative(t *testing.T) {
+	if _, err := os.Stat("/proc/uptime"); err != nil {
+		t.Skip("no procfs on this host")
+	}
+	// The local runner reads procfs directly, so no pipeline output is parsed
+	runner := exec.NewLocalRunner(exec.ExecConfig{})
+	for _, path := range []string{"Device.DeviceInfo.UpTime", "Device.DeviceInfo.MemoryStatus.Total", "Device.DeviceInfo.ProcessStatus.CPUUsage"} {
+		result, err := commands.InformCommands[path](runner)
+		if err != nil || !result.Success {
+			t.Fatalf("%s: unexpected error %v", path, err)
+		}
+		if _, err := strconv.Atoi(string(result.Raw)); err != nil {
+			t.Errorf("%s: expected a number, got %q", path, result.Raw)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/sysinfo"
+)
+
+var (
+	// hostInfo reads procfs and sysfs of the host the daemon runs on
+	hostInfo = sysinfo.NewReader("/")
+	// cpuSampler keeps the previous /proc/stat sample between Informs
+	cpuSampler = sysinfo.NewCPUSampler(hostInfo, time.Second)
+	// unsafeIdentifier matches the characters the shell getters replace with _
+	unsafeIdentifier = regexp.MustCompile(`[\]:@/?#\[!$&()*+,;=]`)
+)
+
+// native reports whether runner executes on this host, in which case getters
+// read the files directly instead of spawning sh; SSH and fixture runners keep
+// the shell pipelines
+func native(runner exec.Runner) bool {
+	_, ok := runner.(*exec.LocalRunner)
+	return ok
+}
+
+// nativeResult wraps a value read natively the way Execute wraps command output
+func nativeResult(value string, err error) (*exec.CommandResult, error) {
+	if err != nil {
+		return &exec.CommandResult{Type: exec.TypeString, Stdout: "", Stderr: err.Error(), ExitCode: 1}, err
+	}
+	return &exec.CommandResult{
+		Type:    exec.TypeString,
+		Stdout:  value,
+		Raw:     []byte(value),
+		Success: true,
+	}, nil
+}
+
+// nativeInt is nativeResult for numeric readers
+func nativeInt(value int, err error) (*exec.CommandResult, error) {
+	return nativeResult(strconv.Itoa(value), err)
+}
+
+// releaseValue reads key from a release file, falling back to def when it is missing
+func releaseValue(name, key, def string) string {
+	value, err := hostInfo.ReleaseValue(name, key)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// identifier replaces the characters not allowed in DeviceID fields
+func identifier(value string) string {
+	return unsafeIdentifier.ReplaceAllString(value, "_")
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/internal/config"
+	"github.com/Niceblueman/goispappd/internal/exec"
+)
+
+// ErrXCommandDenied is returned when a command does not match the X_Command allowlist
+var ErrXCommandDenied = errors.New("command not allowed")
+
+// RunXCommand executes an ACS supplied command line after checking it against the
+// configured allowlist. The command is split into argv and run without a shell,
+// so pipes and redirections are never interpreted.
+func RunXCommand(ctx context.Context, policy config.XCommandConfig, command string) (*exec.CommandResult, error) {
+	argv, err := SplitCommandLine(command)
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("command cannot be empty")
+	}
+	if !XCommandAllowed(policy, argv, command) {
+		return nil, fmt.Errorf("%w: %s", ErrXCommandDenied, argv[0])
+	}
+
+	executor := exec.NewExecutor(exec.ExecConfig{
+		Timeout:   policy.Timeout,
+		MaxOutput: policy.MaxOutput,
+	})
+	result, err := executor.NormalExecute(ctx, argv[0], argv[1:]...)
+	if result == nil {
+		// Spawn failures leave nothing to report but the error
+		return &exec.CommandResult{Stderr: err.Error(), ExitCode: -1}, nil
+	}
+	if errors.Is(err, exec.ErrTimeout) {
+		// The ACS gets what the command printed before it was killed
+		if result.Stderr != "" && !strings.HasSuffix(result.Stderr, "\n") {
+			result.Stderr += "\n"
+		}
+		result.Stderr += err.Error()
+	}
+	// A non-zero exit is a valid outcome for the ACS, not a failure of the RPC
+	return result, nil
+}
+
+// XCommandAllowed reports whether argv[0] is an allowed binary or the whole
+// command line matches one of the allowed patterns. A bare name must be on
+// the allowlist and found in PATH, a path must be one of the absolute paths
+// on the allowlist, so /tmp/echo is refused even when echo is allowed
+func XCommandAllowed(policy config.XCommandConfig, argv []string, command string) bool {
+	for _, binary := range policy.AllowedBinaries {
+		if binary != argv[0] {
+			continue
+		}
+		if filepath.IsAbs(binary) {
+			return true
+		}
+		if !strings.Contains(binary, "/") {
+			if _, err := osexec.LookPath(binary); err == nil {
+				return true
+			}
+		}
+	}
+	for _, pattern := range policy.AllowedPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(strings.TrimSpace(command)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitCommandLine splits a command line into arguments honouring single and
+// double quotes and backslash escapes
+func SplitCommandLine(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg, escaped := false, false
+
+	for _, r := range command {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inArg = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in command")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
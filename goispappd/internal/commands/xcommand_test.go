@@ -0,0 +1,121 @@
+package commands_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/commands"
+	"github.com/Niceblueman/goispappd/internal/config"
+)
+
+func TestXCommand(t *testing.T) {
+	policy := config.XCommandConfig{
+		AllowedBinaries: []string{"echo", "sh", "sleep", "/bin/false"},
+		AllowedPatterns: []string{`^cat /proc/(meminfo|loadavg)$`},
+		Timeout:         2 * time.Second,
+		MaxOutput:       16,
+	}
+
+	t.Run("SplitCommandLine", func(t *testing.T) {
+		args, err := commands.SplitCommandLine(`ping -c 3 "host name" 'a b' c\ d`)
+		if err != nil {
+			t.Fatalf("SplitCommandLine failed: %v", err)
+		}
+		want := []string{"ping", "-c", "3", "host name", "a b", "c d"}
+		if !reflect.DeepEqual(args, want) {
+			t.Errorf("Expected %q, got %q", want, args)
+		}
+		if _, err := commands.SplitCommandLine(`echo "unterminated`); err == nil {
+			t.Error("Expected error for unterminated quote")
+		}
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		tests := []struct {
+			command string
+			allowed bool
+		}{
+			{"echo hi", true},
+			{"/usr/bin/echo hi", false},
+			{"/tmp/echo hi", false},
+			{"./echo hi", false},
+			{"/bin/false", true},
+			{"/tmp/false", false},
+			{"false", false},
+			{"cat /proc/meminfo", true},
+			{"cat /etc/shadow", false},
+			{"rm -rf /", false},
+		}
+		for _, tt := range tests {
+			argv, _ := commands.SplitCommandLine(tt.command)
+			if got := commands.XCommandAllowed(policy, argv, tt.command); got != tt.allowed {
+				t.Errorf("XCommandAllowed(%q) = %v, expected %v", tt.command, got, tt.allowed)
+			}
+		}
+	})
+
+	t.Run("Denied", func(t *testing.T) {
+		_, err := commands.RunXCommand(context.Background(), policy, "rm -rf /tmp/x")
+		if !errors.Is(err, commands.ErrXCommandDenied) {
+			t.Errorf("Expected ErrXCommandDenied, got %v", err)
+		}
+	})
+
+	t.Run("NoShell", func(t *testing.T) {
+		result, err := commands.RunXCommand(context.Background(), policy, "echo a;b")
+		if err != nil {
+			t.Fatalf("RunXCommand failed: %v", err)
+		}
+		if strings.TrimSpace(string(result.Raw)) != "a;b" {
+			t.Errorf("Expected literal output a;b, got %q", result.Raw)
+		}
+	})
+
+	t.Run("ExitCodeAndStderr", func(t *testing.T) {
+		result, err := commands.RunXCommand(context.Background(), policy, `sh -c "echo oops >&2; exit 3"`)
+		if err != nil {
+			t.Fatalf("RunXCommand failed: %v", err)
+		}
+		if result.ExitCode != 3 {
+			t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+		}
+		if strings.TrimSpace(result.Stderr) != "oops" {
+			t.Errorf("Expected stderr oops, got %q", result.Stderr)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		result, err := commands.RunXCommand(context.Background(), policy, "echo 0123456789abcdefghijklmnop")
+		if err != nil {
+			t.Fatalf("RunXCommand failed: %v", err)
+		}
+		if len(result.Raw) != policy.MaxOutput {
+			t.Errorf("Expected %d bytes of output, got %d", policy.MaxOutput, len(result.Raw))
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		short := policy
+		short.Timeout = 100 * time.Millisecond
+		result, err := commands.RunXCommand(context.Background(), short, "sleep 5")
+		if err != nil {
+			t.Fatalf("RunXCommand failed: %v", err)
+		}
+		if result.ExitCode != -1 || !strings.Contains(result.Stderr, "timed out") {
+			t.Errorf("Expected timeout result, got exit %d stderr %q", result.ExitCode, result.Stderr)
+		}
+
+		// What the command printed before the timeout is kept
+		result, err = commands.RunXCommand(context.Background(), short, `sh -c "echo partial; echo warning >&2; exec sleep 5"`)
+		if err != nil {
+			t.Fatalf("RunXCommand failed: %v", err)
+		}
+		if string(result.Raw) != "partial\n" || !strings.HasPrefix(result.Stderr, "warning\ncommand timed out") || result.ExitCode != -1 {
+			t.Errorf("Expected the partial output with the timeout, got %q stderr %q exit %d", result.Raw, result.Stderr, result.ExitCode)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"time"
 
@@ -9,12 +10,27 @@ import (
 
 // Configuration holds the client configuration
 type Configuration struct {
-	ACSURL           string        `yaml:"acs_url"`
-	Username         string        `yaml:"username"`
-	Password         string        `yaml:"password"`
-	SerialNumber     string        `yaml:"serial_number"`
-	PeriodicInterval time.Duration `yaml:"periodic_interval"`
-	ProvisioningCode string        `yaml:"provisioning_code"`
+	ACSURL           string         `yaml:"acs_url"`
+	Username         string         `yaml:"username"`
+	Password         string         `yaml:"password"`
+	SerialNumber     string         `yaml:"serial_number"`
+	PeriodicInterval time.Duration  `yaml:"periodic_interval"`
+	ProvisioningCode string         `yaml:"provisioning_code"`
+	XCommand         XCommandConfig `yaml:"x_command"`
+	// RootDataModel is the root presented to the ACS, Device for TR-181 or
+	// InternetGatewayDevice for the TR-098 profiles, read at startup
+	RootDataModel string `yaml:"root_data_model"`
+	// TraceRouteProbe is UDP for the datagrams of traceroute(8) or ICMP for
+	// echo requests like traceroute -I
+	TraceRouteProbe string `yaml:"traceroute_probe"`
+}
+
+// XCommandConfig restricts which commands the ACS may run through X_Command
+type XCommandConfig struct {
+	AllowedBinaries []string      `yaml:"allowed_binaries"` // Binary names or absolute paths allowed as argv[0]
+	AllowedPatterns []string      `yaml:"allowed_patterns"` // Regular expressions matched against the whole command line
+	Timeout         time.Duration `yaml:"timeout"`          // Per-command timeout
+	MaxOutput       int           `yaml:"max_output"`       // Maximum bytes kept from each of stdout and stderr
 }
 
 // LoadConfig loads configuration from a YAML file /etc/cwmp/config.yaml
@@ -36,6 +52,8 @@ func LoadConfig() (*Configuration, error) {
 			SerialNumber:     "1234567890",
 			PeriodicInterval: 30 * time.Second, // Default periodic interval
 			ProvisioningCode: "",
+			RootDataModel:    "Device",
+			TraceRouteProbe:  "UDP",
 		}
 		data, err := yaml.Marshal(defaultConfig)
 		if err != nil {
@@ -51,9 +69,21 @@ func LoadConfig() (*Configuration, error) {
 	}
 	cfg := &Configuration{
 		PeriodicInterval: 30 * time.Second, // Default
+		RootDataModel:    "Device",
+		TraceRouteProbe:  "UDP",
+		XCommand: XCommandConfig{
+			Timeout:   30 * time.Second,
+			MaxOutput: 64 * 1024,
+		},
 	}
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
+	if cfg.RootDataModel != "Device" && cfg.RootDataModel != "InternetGatewayDevice" {
+		return nil, fmt.Errorf("root_data_model must be Device or InternetGatewayDevice, not %q", cfg.RootDataModel)
+	}
+	if cfg.TraceRouteProbe != "UDP" && cfg.TraceRouteProbe != "ICMP" {
+		return nil, fmt.Errorf("traceroute_probe must be UDP or ICMP, not %q", cfg.TraceRouteProbe)
+	}
 	return cfg, nil
 }
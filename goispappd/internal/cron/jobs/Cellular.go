@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/cellular"
+	"github.com/Niceblueman/goispappd/internal/exec"
+)
+
+// Device.Cellular. is read from ModemManager, uqmi or the AT port of the
+// modem, whichever finds one, the access points are the interface sections
+// of /etc/config/network with a cellular protocol
+//
+//	InterfaceNumberOfEntries               type: uint32
+//	AccessPointNumberOfEntries             type: uint32
+//	Interface.{i}.
+//	    Enable                             type: bool
+//	    Status                             type: enum
+//	    IMEI                               type: string(15)
+//	    RSSI                               type: int
+//	    X_ISPAPP_CurrentAccessTechnology   type: string
+//	    X_ISPAPP_RSRP, RSRQ, SINR, ...     type: int
+//	    X_ISPAPP_CarrierInfo.{i}.          type: object
+//	    USIM.
+//	        Status                         type: enum
+//	        IMSI                           type: string(15)
+//	        ICCID                          type: string(20)
+//	AccessPoint.{i}.
+//	    APN                                type: string(64), access: W
+//	    Username                           type: string(256), access: W
+//	    Password                           type: string(256), access: W
+func CellularCollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	manager := cellular.NewManager(executor, cellular.MMCLI{Runner: executor}, cellular.UQMI{Runner: executor}, cellular.AT{})
+	if err := manager.Collect(ctx); err != nil {
+		return &err
+	}
+	return nil
+}
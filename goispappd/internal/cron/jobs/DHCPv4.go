@@ -0,0 +1,47 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/dhcpv4"
+	"github.com/Niceblueman/goispappd/internal/exec"
+)
+
+// Device.DHCPv4.Server. is read from /etc/config/dhcp and the dnsmasq leases
+//
+//	PoolNumberOfEntries                    type: uint32
+//	Pool.{i}.
+//	    Enable                             type: bool, access: W
+//	    Status                             type: enum
+//	    Interface                          type: strongRef, access: W
+//	    MinAddress                         type: IPv4Address, access: W
+//	    MaxAddress                         type: IPv4Address, access: W
+//	    SubnetMask                         type: IPv4Address, access: W
+//	    DNSServers                         type: list<IPv4Address>, access: W
+//	    DomainName                         type: string(64), access: W
+//	    IPRouters                          type: list<IPv4Address>, access: W
+//	    LeaseTime                          type: int32[-1:], access: W
+//	    StaticAddress.{i}.
+//	        Enable                         type: bool, access: W
+//	        Chaddr                         type: MACAddress, access: W
+//	        Yiaddr                         type: IPv4Address, access: W
+//	    Client.{i}.
+//	        Chaddr                         type: MACAddress
+//	        IPv4Address.{i}.
+//	            IPAddress                  type: IPv4Address
+//	            LeaseTimeRemaining         type: dateTime
+func DHCPv4CollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := dhcpv4.NewManager(executor).Collect(ctx); err != nil {
+		return &err
+	}
+	return nil
+}
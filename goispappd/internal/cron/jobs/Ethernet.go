@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/Niceblueman/goispappd/internal/ethernet"
+	"github.com/Niceblueman/goispappd/internal/exec"
+)
+
+// Device.Ethernet. is read from /sys/class/net and the ethtool link modes,
+// the link down counters are kept by the daemon from the rtnetlink events
+//
+//	InterfaceNumberOfEntries               type: uint32
+//	LinkNumberOfEntries                    type: uint32
+//	Interface.{i}.
+//	    Enable                             type: bool
+//	    Status                             type: enum
+//	    Name                               type: string(64)
+//	    MACAddress                         type: MACAddress
+//	    MaxBitRate                         type: int(-1:)
+//	    CurrentBitRate                     type: uint32
+//	    DuplexMode                         type: enum
+//	    X_ISPAPP_LinkDowns                 type: uint32
+//	    Stats.                             type: object
+//	Link.{i}.
+//	    Enable                             type: bool
+//	    Status                             type: enum
+//	    Name                               type: string(64)
+//	    LowerLayers                        type: list<strongRef>
+//	    MACAddress                         type: MACAddress
+//	    Stats.                             type: object
+func EthernetCollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	if err := ethernet.NewManager(ethernet.SysfsReader{}).Collect(); err != nil {
+		return &err
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/firewall"
+)
+
+// Device.Firewall. is read from the rule, redirect and zone sections of
+// /etc/config/firewall and the conntrack counters of /proc
+//
+//	Enable                                 type: bool
+//	Config                                 type: enum
+//	ChainNumberOfEntries                   type: uint32
+//	Chain.{i}.
+//	    Enable                             type: bool
+//	    Name                               type: string
+//	    Creator                            type: enum
+//	    RuleNumberOfEntries                type: uint32
+//	    Rule.{i}.
+//	        Enable                         type: bool, access: W
+//	        Status                         type: enum
+//	        Order                          type: uint32[1:], access: W
+//	        Description                    type: string, access: W
+//	        Target                         type: enum, access: W
+//	        Log                            type: bool, access: W
+//	        SourceInterface                type: strongRef, access: W
+//	        SourceAllInterfaces            type: bool, access: W
+//	        DestInterface                  type: strongRef, access: W
+//	        DestAllInterfaces              type: bool, access: W
+//	        IPVersion                      type: int32[-1:15], access: W
+//	        DestIP, SourceIP               type: IPAddress, access: W
+//	        DestMask, SourceMask           type: IPAddress, access: W
+//	        DestIPExclude, SourceIPExclude type: bool, access: W
+//	        Protocol                       type: int32[-1:255], access: W
+//	        ProtocolExclude                type: bool, access: W
+//	        DestPort, SourcePort           type: int32[-1:65535], access: W
+//	        DestPortRangeMax               type: int32[-1:65535], access: W
+//	        SourcePortRangeMax             type: int32[-1:65535], access: W
+//	        DestPortExclude                type: bool, access: W
+//	        SourcePortExclude              type: bool, access: W
+//	X_ISPAPP_ConnTrack.
+//	    TotalEntries                       type: uint32
+//	    MaxEntries                         type: uint32
+//	X_ISPAPP_NAT.
+//	    ChainNumberOfEntries               type: uint32
+//	    Chain.{i}.                         dstnat (redirect DNAT), srcnat (redirect SNAT)
+//	        Rule.{i}.
+//	            Enable, Log                type: bool, access: W
+//	            Order                      type: uint32[1:], access: W
+//	            Description                type: string, access: W
+//	            Target                     type: string
+//	            SourceInterface            type: strongRef, access: W
+//	            DestInterface              type: strongRef, access: W
+//	            Protocol                   type: int32[-1:255], access: W
+//	            SourceIPRange, DestIPRange type: string, access: W
+//	            SourcePortList             type: string, access: W
+//	            DestPortList               type: string, access: W
+//	            ToAddresses, ToPorts       type: string, access: W
+func FirewallCollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := firewall.NewManager(executor).Collect(ctx); err != nil {
+		return &err
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/hosts"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci"
+)
+
+// Device.Hosts. merges the dnsmasq leases, the kernel neighbor table and the
+// WiFi stations stored by AccessPointCollectCmd
+//
+//	HostNumberOfEntries                    type: uint32
+//	Host.{i}.
+//	    PhysAddress                        type: string(64)
+//	    IPAddress                          type: IPAddress
+//	    DHCPClient                         type: list<strongRef>
+//	    AssociatedDevice                   type: strongRef
+//	    Layer1Interface                    type: strongRef
+//	    Layer3Interface                    type: strongRef
+//	    HostName                           type: string(64)
+//	    Active                             type: bool
+//	    LeaseTimeRemaining                 type: int32[-1:]
+func HostsCollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	var sources hosts.Sources
+	if leases, err := readFile(ctx, executor, hosts.LeasesPath); err != nil {
+		log.Printf("Failed to read DHCP leases: %v", err)
+	} else {
+		sources.Leases = hosts.ParseLeases(leases)
+	}
+	arp, err := readFile(ctx, executor, hosts.ARPPath)
+	if err != nil {
+		return &err
+	}
+	sources.Neighbors = hosts.ParseARP(arp)
+
+	if err := StoreHosts(sources, time.Now()); err != nil {
+		return &err
+	}
+	return nil
+}
+
+// readFile returns the content of a file on the device
+func readFile(ctx context.Context, executor exec.Runner, path string) (string, error) {
+	result, err := executor.Execute(ctx, "cat", path)
+	if err != nil {
+		return "", err
+	}
+	output, ok := result.Stdout.(string)
+	if !ok {
+		return "", fmt.Errorf("unexpected output type from cat %s", path)
+	}
+	return output, nil
+}
+
+// StoreHosts completes sources with the stations, DHCP clients, interfaces and
+// indices found in the tr069 store and rebuilds the Host table
+func StoreHosts(sources hosts.Sources, now time.Time) error {
+	return store.Update(func(config *uci.UCIConfig) error {
+		sources.Stations = storedStations(config)
+		sources.DHCPClients = storedReferences(config, "DHCPv4", `Server\.Pool\.\d+\.Client\.\d+\.`, "Chaddr", strings.ToLower)
+		sources.Interfaces = storedReferences(config, "IP", `Interface\.\d+\.`, "X_ISPAPP_Device", nil)
+		sources.Previous = storedIndices(config)
+		return setHosts(config, sources.Hosts(now))
+	})
+}
+
+// sectionOptions returns the options of the sections of one type
+func sectionOptions(config *uci.UCIConfig, sectionType string) map[string]string {
+	options := make(map[string]string)
+	for _, sec := range config.Sections {
+		if sec.SectionType != sectionType {
+			continue
+		}
+		for key, value := range sec.Options {
+			options[key] = value
+		}
+	}
+	return options
+}
+
+// storedReferences maps the values of parameter name of a stored table to the
+// table entry, e.g. Chaddr to Device.DHCPv4.Server.Pool.{i}.Client.{j}. The
+// first entry in name order wins when entries share a value, e.g. the wan and
+// wan6 interfaces of one device
+func storedReferences(config *uci.UCIConfig, sectionType, entry, name string, normalize func(string) string) map[string]string {
+	pattern := regexp.MustCompile(`^(` + entry + `)` + regexp.QuoteMeta(name) + `$`)
+	options := sectionOptions(config, sectionType)
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	references := make(map[string]string)
+	for _, key := range keys {
+		value := options[key]
+		if match := pattern.FindStringSubmatch(key); match != nil && value != "" {
+			if normalize != nil {
+				value = normalize(value)
+			}
+			if _, ok := references[value]; !ok {
+				references[value] = fmt.Sprintf("Device.%s.%s", sectionType, match[1])
+			}
+		}
+	}
+	return references
+}
+
+// storedStations lists the associated devices of the stored access points
+func storedStations(config *uci.UCIConfig) []hosts.Station {
+	pattern := regexp.MustCompile(`^AccessPoint\.(\d+)\.AssociatedDevice\.(\d+)\.MACAddress$`)
+	options := sectionOptions(config, "WiFi")
+	var stations []hosts.Station
+	for key, value := range options {
+		match := pattern.FindStringSubmatch(key)
+		if match == nil || value == "" {
+			continue
+		}
+		stations = append(stations, hosts.Station{
+			PhysAddress:      strings.ToLower(value),
+			AssociatedDevice: fmt.Sprintf("Device.WiFi.AccessPoint.%s.AssociatedDevice.%s.", match[1], match[2]),
+			Layer1Interface:  options[fmt.Sprintf("AccessPoint.%s.SSIDReference", match[1])],
+		})
+	}
+	return stations
+}
+
+// storedIndices maps the PhysAddress of the stored Host table to the index
+func storedIndices(config *uci.UCIConfig) map[string]int {
+	pattern := regexp.MustCompile(`^Host\.(\d+)\.PhysAddress$`)
+	indices := make(map[string]int)
+	for key, value := range sectionOptions(config, "Hosts") {
+		if match := pattern.FindStringSubmatch(key); match != nil {
+			index, _ := strconv.Atoi(match[1])
+			indices[value] = index
+		}
+	}
+	return indices
+}
+
+func setHosts(config *uci.UCIConfig, entries []device.HostEntry) error {
+	// Rebuild the section so hosts that left do not linger in the store
+	sections := config.Sections[:0]
+	for _, sec := range config.Sections {
+		if sec.SectionType != "Hosts" {
+			sections = append(sections, sec)
+		}
+	}
+	config.Sections = sections
+
+	for _, host := range entries {
+		sectionName := fmt.Sprintf("Host.%d.", host.Index)
+		config.Set("Hosts", fmt.Sprintf("%sPhysAddress", sectionName), host.PhysAddress, false)
+		config.Set("Hosts", fmt.Sprintf("%sIPAddress", sectionName), host.IPAddress, false)
+		config.Set("Hosts", fmt.Sprintf("%sDHCPClient", sectionName), host.DHCPClient, false)
+		config.Set("Hosts", fmt.Sprintf("%sAssociatedDevice", sectionName), host.AssociatedDevice, false)
+		config.Set("Hosts", fmt.Sprintf("%sLayer1Interface", sectionName), host.Layer1Interface, false)
+		config.Set("Hosts", fmt.Sprintf("%sLayer3Interface", sectionName), host.Layer3Interface, false)
+		config.Set("Hosts", fmt.Sprintf("%sHostName", sectionName), host.HostName, false)
+		config.Set("Hosts", fmt.Sprintf("%sActive", sectionName), fmt.Sprintf("%t", host.Active), false)
+		config.Set("Hosts", fmt.Sprintf("%sLeaseTimeRemaining", sectionName), fmt.Sprintf("%d", host.LeaseTimeRemaining), false)
+	}
+	config.Set("Hosts", "HostNumberOfEntries", fmt.Sprintf("%d", len(entries)), false)
+	return nil
+}
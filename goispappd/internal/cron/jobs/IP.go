@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/ip"
+)
+
+// Device.IP.Interface. is read from the interface sections of
+// /etc/config/network and ubus call network.interface dump
+//
+//	InterfaceNumberOfEntries               type: uint32
+//	Interface.{i}.
+//	    Enable                             type: bool, access: W
+//	    Status                             type: enum
+//	    Name                               type: string(64)
+//	    LowerLayers                        type: list<strongRef>
+//	    Type                               type: enum
+//	    X_ISPAPP_Device                    type: string
+//	    IPv4Address.{i}.
+//	        Enable                         type: bool
+//	        Status                         type: enum
+//	        IPAddress                      type: IPv4Address, access: W
+//	        SubnetMask                     type: IPv4Address, access: W
+//	        AddressingType                 type: enum
+//	    IPv6Address.{i}.
+//	        Enable                         type: bool
+//	        Status                         type: enum
+//	        IPAddressStatus                type: enum
+//	        IPAddress                      type: IPv6Address, access: W
+//	        Origin                         type: enum
+//	        PreferredLifetime              type: dateTime
+//	        ValidLifetime                  type: dateTime
+func IPCollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := ip.NewManager(executor).Collect(ctx); err != nil {
+		return &err
+	}
+	return nil
+}
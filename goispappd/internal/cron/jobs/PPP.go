@@ -0,0 +1,49 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/ppp"
+)
+
+// Device.PPP.Interface. is read from the pppoe, pppoa and ppp interface
+// sections of /etc/config/network and ubus call network.interface dump
+//
+//	InterfaceNumberOfEntries               type: uint32
+//	Interface.{i}.
+//	    Enable                             type: bool, access: W
+//	    Status                             type: enum
+//	    Name                               type: string(64)
+//	    LowerLayers                        type: list<strongRef>
+//	    ConnectionStatus                   type: enum
+//	    AutoDisconnectTime                 type: uint32, access: W
+//	    IdleDisconnectTime                 type: uint32, access: W
+//	    LCPEcho                            type: uint32
+//	    LCPEchoRetry                       type: uint32
+//	    Username                           type: string(64), access: W
+//	    Password                           type: string(64), access: W
+//	    EncryptionProtocol                 type: enum
+//	    ConnectionTrigger                  type: enum, access: W
+//	    X_ISPAPP_Type                      type: string
+//	    PPPoE.
+//	        ACName                         type: string(256), access: W
+//	        ServiceName                    type: string(256), access: W
+//	    IPCP.
+//	        LocalIPAddress                 type: IPv4Address
+//	        RemoteIPAddress                type: IPv4Address
+func PPPCollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := ppp.NewManager(executor).Collect(ctx); err != nil {
+		return &err
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/routing"
+)
+
+// Device.Routing. is read from the kernel routing tables over rtnetlink and
+// the route and route6 sections of /etc/config/network
+//
+//	RouterNumberOfEntries                  type: uint32
+//	Router.{i}.
+//	    Enable                             type: bool
+//	    Status                             type: enum
+//	    IPv4Forwarding.{i}.
+//	        Enable                         type: bool, access: W
+//	        Status                         type: enum
+//	        StaticRoute                    type: bool
+//	        DestIPAddress                  type: IPv4Address, access: W
+//	        DestSubnetMask                 type: IPv4Address, access: W
+//	        ForwardingPolicy               type: int32[-1:], access: W
+//	        GatewayIPAddress               type: IPv4Address, access: W
+//	        Interface                      type: strongRef, access: W
+//	        Origin                         type: enum
+//	        ForwardingMetric               type: int32[-1:], access: W
+//	    IPv6Forwarding.{i}.
+//	        Enable                         type: bool, access: W
+//	        Status                         type: enum
+//	        DestIPPrefix                   type: IPv6Prefix, access: W
+//	        ForwardingPolicy               type: int32[-1:], access: W
+//	        NextHop                        type: IPv6Address, access: W
+//	        Interface                      type: strongRef, access: W
+//	        Origin                         type: enum
+//	        ForwardingMetric               type: int32[-1:], access: W
+//	        ExpirationTime                 type: dateTime
+func RoutingCollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := routing.NewManager(executor, routing.NetlinkReader{}).Collect(ctx); err != nil {
+		return &err
+	}
+	return nil
+}
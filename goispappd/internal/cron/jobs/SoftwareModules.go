@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/software"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci"
+)
+
+// Device.SoftwareModules. is populated from opkg list-installed and procd services
+//
+//	DeploymentUnitNumberOfEntries          type: uint32
+//	DeploymentUnit.{i}.
+//	    UUID                               type: string(36)
+//	    DUID                               type: string(64)
+//	    Name                               type: string(64)
+//	    Status                             type: enum
+//	    Resolved                           type: bool
+//	    Version                            type: string(32)
+//	    ExecutionUnitList                  type: list<strongRef>
+//	    ExecutionEnvRef                    type: strongRef
+//	ExecutionUnitNumberOfEntries           type: uint32
+//	ExecutionUnit.{i}.
+//	    EUID                               type: string(64)
+//	    Name                               type: string(32)
+//	    Status                             type: enum
+//	    ExecutionEnvRef                    type: strongRef
+func SoftwareModulesCollectCmd(executor exec.Runner) *error {
+	if executor == nil {
+		_err := fmt.Errorf("failed to create executor")
+		return &_err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	manager := software.NewManager(executor)
+	units, err := manager.ListInstalled(ctx)
+	if err != nil {
+		return &err
+	}
+	services, err := manager.ListServices(ctx)
+	if err != nil {
+		log.Printf("Failed to list services: %v", err)
+	}
+	if err := StoreSoftwareModules(units, services); err != nil {
+		return &err
+	}
+	return nil
+}
+
+// StoreSoftwareModules writes deployment and execution units to the tr069 store
+func StoreSoftwareModules(units []software.DeploymentUnit, services []software.ExecutionUnit) error {
+	return store.Update(func(config *uci.UCIConfig) error {
+		return setSoftwareModules(config, units, services)
+	})
+}
+
+func setSoftwareModules(config *uci.UCIConfig, units []software.DeploymentUnit, services []software.ExecutionUnit) error {
+	// Rebuild the section so removed packages do not linger in the store
+	sections := config.Sections[:0]
+	for _, sec := range config.Sections {
+		if sec.SectionType != "SoftwareModules" {
+			sections = append(sections, sec)
+		}
+	}
+	config.Sections = sections
+
+	for i, service := range services {
+		index := i + 1
+		sectionName := fmt.Sprintf("ExecutionUnit.%d.", index)
+		config.Set("SoftwareModules", fmt.Sprintf("%sEUID", sectionName), service.EUID, false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sName", sectionName), service.Name, false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sStatus", sectionName), service.Status, false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sExecutionEnvRef", sectionName), software.ExecEnvRef, false)
+	}
+	config.Set("SoftwareModules", "ExecutionUnitNumberOfEntries", fmt.Sprintf("%d", len(services)), false)
+
+	for i, unit := range units {
+		index := i + 1
+		sectionName := fmt.Sprintf("DeploymentUnit.%d.", index)
+		config.Set("SoftwareModules", fmt.Sprintf("%sUUID", sectionName), unit.UUID, false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sDUID", sectionName), unit.Name, false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sName", sectionName), unit.Name, false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sStatus", sectionName), unit.Status, false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sResolved", sectionName), fmt.Sprintf("%t", unit.Resolved), false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sVersion", sectionName), unit.Version, false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sExecutionUnitList", sectionName), software.ExecutionUnitRefList(unit, services), false)
+		config.Set("SoftwareModules", fmt.Sprintf("%sExecutionEnvRef", sectionName), software.ExecEnvRef, false)
+	}
+	config.Set("SoftwareModules", "DeploymentUnitNumberOfEntries", fmt.Sprintf("%d", len(units)), false)
+	return nil
+}
@@ -5,12 +5,16 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/store"
 	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/wifi"
 )
 
 // the job will collect from openwrt and save into uci with key/value pairs under wifi section
@@ -35,9 +39,9 @@ import (
 //	        ErrorsReceived                 type: uint32, flags: deny-active-notif
 //	        DiscardPacketsSent             type: uint32, flags: deny-active-notif
 //	        DiscardPacketsReceived         type: uint32, flags: deny-active-notif
-func SSIDCollectCmd(executor *exec.Executor) *error {
+func SSIDCollectCmd(executor exec.Runner) *error {
 	_package := "Device"
-	uci, err := uci.LoadConfig("/etc/config/tr069", &_package)
+	uci, err := uci.LoadConfig(store.Path, &_package)
 	if err != nil {
 		return &err
 	}
@@ -48,7 +52,8 @@ func SSIDCollectCmd(executor *exec.Executor) *error {
 		return &_err
 	}
 	// Get all wifi interfaces from UCI
-	interfaces, err := getWiFiInterfaces(ctx, executor, uci)
+	backend := wifiBackend(executor)
+	interfaces, err := getWiFiInterfaces(ctx, executor, backend, uci)
 	if err != nil {
 		return &err
 	}
@@ -62,33 +67,36 @@ func SSIDCollectCmd(executor *exec.Executor) *error {
 
 	// Process each interface - Device.WiFi.SSID.{i}.
 	for i, iface := range interfaces {
-		index := i + 1
+		index := iface.Index
+		if index == 0 {
+			index = i + 1
+		}
 		sectionName := fmt.Sprintf("SSID.%d.", index)
 
 		// Basic interface properties following TR-069 naming
-		uci.Set("WIFI", fmt.Sprintf("%sEnable", sectionName), fmt.Sprintf("%t", iface.Enable), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStatus", sectionName), iface.Status, false)
-		uci.Set("WIFI", fmt.Sprintf("%sSSID", sectionName), iface.SSID, false)
-		uci.Set("WIFI", fmt.Sprintf("%sBSSID", sectionName), iface.BSSID, false)
-		uci.Set("WIFI", fmt.Sprintf("%sMACAddress", sectionName), iface.MACAddress, false)
-		uci.Set("WIFI", fmt.Sprintf("%sLowerLayers", sectionName), fmt.Sprintf("Device.WiFi.Radio.%s.", iface.Device), false)
+		uci.Set("WiFi", fmt.Sprintf("%sEnable", sectionName), fmt.Sprintf("%t", iface.Enable), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStatus", sectionName), iface.Status, false)
+		uci.Set("WiFi", fmt.Sprintf("%sSSID", sectionName), iface.SSID, false)
+		uci.Set("WiFi", fmt.Sprintf("%sBSSID", sectionName), iface.BSSID, false)
+		uci.Set("WiFi", fmt.Sprintf("%sMACAddress", sectionName), iface.MACAddress, false)
+		uci.Set("WiFi", fmt.Sprintf("%sLowerLayers", sectionName), iface.Radio, false)
 
 		// Get interface statistics
-		stats, err := getInterfaceStats(ctx, executor, iface.Name)
+		stats, err := getInterfaceStats(ctx, backend, iface.Name)
 		if err != nil {
 			log.Printf("Failed to get stats for interface %s: %v", iface.Name, err)
 			continue
 		}
 
 		// Save statistics - Device.WiFi.SSID.{i}.Stats.
-		uci.Set("WIFI", fmt.Sprintf("%sStats.BytesSent", sectionName), fmt.Sprintf("%d", stats.BytesSent), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStats.BytesReceived", sectionName), fmt.Sprintf("%d", stats.BytesReceived), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStats.PacketsSent", sectionName), fmt.Sprintf("%d", stats.PacketsSent), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStats.PacketsReceived", sectionName), fmt.Sprintf("%d", stats.PacketsReceived), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStats.ErrorsSent", sectionName), fmt.Sprintf("%d", stats.ErrorsSent), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStats.ErrorsReceived", sectionName), fmt.Sprintf("%d", stats.ErrorsReceived), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStats.DiscardPacketsSent", sectionName), fmt.Sprintf("%d", stats.DiscardPacketsSent), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStats.DiscardPacketsReceived", sectionName), fmt.Sprintf("%d", stats.DiscardPacketsReceived), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.BytesSent", sectionName), fmt.Sprintf("%d", stats.BytesSent), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.BytesReceived", sectionName), fmt.Sprintf("%d", stats.BytesReceived), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.PacketsSent", sectionName), fmt.Sprintf("%d", stats.PacketsSent), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.PacketsReceived", sectionName), fmt.Sprintf("%d", stats.PacketsReceived), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.ErrorsSent", sectionName), fmt.Sprintf("%d", stats.ErrorsSent), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.ErrorsReceived", sectionName), fmt.Sprintf("%d", stats.ErrorsReceived), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.DiscardPacketsSent", sectionName), fmt.Sprintf("%d", stats.DiscardPacketsSent), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.DiscardPacketsReceived", sectionName), fmt.Sprintf("%d", stats.DiscardPacketsReceived), false)
 	}
 
 	// Commit changes
@@ -113,12 +121,24 @@ func SSIDCollectCmd(executor *exec.Executor) *error {
 //	Channel                            type: uint32[1:255], access: W
 //	AutoChannelSupported               type: bool
 //	AutoChannelEnable                  type: bool, access: W
+//	OperatingChannelBandwidth          type: string, access: W
 //	X_ISAPP_SkipDFSChannels         type: enum, access: W
 //	Stats.
 //	    Noise                          type: int32
 //	X_ISPAPP_Stats.
 //	    OverallTxCCQ                   type: uint32[:100], flags: deny-active-notif
-func RadiosCollectCmd(executor *exec.Executor) {
+//	X_ISPAPP_ChannelSurveyNumberOfEntries type: uint32
+//	X_ISPAPP_ChannelSurvey.{i}.
+//	    Frequency                      type: uint32
+//	    Channel                        type: uint32
+//	    InUse                          type: bool
+//	    Noise                          type: int32
+//	    ActiveTime                     type: StatsCounter64, ms
+//	    BusyTime                       type: StatsCounter64, ms
+//	    ReceiveTime                    type: StatsCounter64, ms
+//	    TransmitTime                   type: StatsCounter64, ms
+//	    Utilization                    type: uint32[:100]
+func RadiosCollectCmd(executor exec.Runner) {
 	section := "Device"
 	uci, err := uci.LoadConfig("/etc/config/tr069", &section)
 	if err != nil {
@@ -142,29 +162,49 @@ func RadiosCollectCmd(executor *exec.Executor) {
 	}
 
 	// Save radio count - Device.WiFi.RadioNumberOfEntries
-	err = uci.Set("WIFI", "RadioNumberOfEntries", fmt.Sprintf("%d", len(radios)), false)
+	err = uci.Set("WiFi", "RadioNumberOfEntries", fmt.Sprintf("%d", len(radios)), false)
 	if err != nil {
 		log.Printf("Failed to set radio count: %v", err)
 	}
 
 	// Process each radio - Device.WiFi.Radio.{i}.
 	for i, radio := range radios {
-		index := i + 1
+		index := radio.Index
+		if index == 0 {
+			index = i + 1
+		}
 		sectionName := fmt.Sprintf("Radio.%d.", index)
 
 		// Basic radio properties following TR-069 naming
-		uci.Set("WIFI", fmt.Sprintf("%sEnable", sectionName), fmt.Sprintf("%t", radio.Enable), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStatus", sectionName), radio.Status, false)
-		uci.Set("WIFI", fmt.Sprintf("%sName", sectionName), radio.Name, false)
-		uci.Set("WIFI", fmt.Sprintf("%sSupportedFrequencyBands", sectionName), radio.SupportedFrequencyBands, false)
-		uci.Set("WIFI", fmt.Sprintf("%sOperatingFrequencyBand", sectionName), radio.OperatingFrequencyBand, false)
-		uci.Set("WIFI", fmt.Sprintf("%sSupportedStandards", sectionName), radio.SupportedStandards, false)
-		uci.Set("WIFI", fmt.Sprintf("%sOperatingStandards", sectionName), radio.OperatingStandards, false)
-		uci.Set("WIFI", fmt.Sprintf("%sPossibleChannels", sectionName), radio.PossibleChannels, false)
-		uci.Set("WIFI", fmt.Sprintf("%sChannel", sectionName), fmt.Sprintf("%d", radio.Channel), false)
-		uci.Set("WIFI", fmt.Sprintf("%sAutoChannelSupported", sectionName), fmt.Sprintf("%t", radio.AutoChannelSupported), false)
-		uci.Set("WIFI", fmt.Sprintf("%sAutoChannelEnable", sectionName), fmt.Sprintf("%t", radio.AutoChannelEnable), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStats.Noise", sectionName), fmt.Sprintf("%d", radio.Noise), false)
+		uci.Set("WiFi", fmt.Sprintf("%sEnable", sectionName), fmt.Sprintf("%t", radio.Enable), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStatus", sectionName), radio.Status, false)
+		uci.Set("WiFi", fmt.Sprintf("%sName", sectionName), radio.Name, false)
+		uci.Set("WiFi", fmt.Sprintf("%sSupportedFrequencyBands", sectionName), radio.SupportedFrequencyBands, false)
+		uci.Set("WiFi", fmt.Sprintf("%sOperatingFrequencyBand", sectionName), radio.OperatingFrequencyBand, false)
+		uci.Set("WiFi", fmt.Sprintf("%sSupportedStandards", sectionName), radio.SupportedStandards, false)
+		uci.Set("WiFi", fmt.Sprintf("%sOperatingStandards", sectionName), radio.OperatingStandards, false)
+		uci.Set("WiFi", fmt.Sprintf("%sOperatingChannelBandwidth", sectionName), radio.OperatingChannelBandwidth, false)
+		uci.Set("WiFi", fmt.Sprintf("%sPossibleChannels", sectionName), radio.PossibleChannels, false)
+		uci.Set("WiFi", fmt.Sprintf("%sChannel", sectionName), fmt.Sprintf("%d", radio.Channel), false)
+		uci.Set("WiFi", fmt.Sprintf("%sAutoChannelSupported", sectionName), fmt.Sprintf("%t", radio.AutoChannelSupported), false)
+		uci.Set("WiFi", fmt.Sprintf("%sAutoChannelEnable", sectionName), fmt.Sprintf("%t", radio.AutoChannelEnable), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStats.Noise", sectionName), fmt.Sprintf("%d", radio.Noise), false)
+		uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.OverallTxCCQ", sectionName), fmt.Sprintf("%d", radio.OverallTxCCQ), false)
+
+		// Channel survey - Device.WiFi.Radio.{i}.X_ISPAPP_ChannelSurvey.{j}.
+		uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_ChannelSurveyNumberOfEntries", sectionName), fmt.Sprintf("%d", len(radio.ChannelSurvey)), false)
+		for j, survey := range radio.ChannelSurvey {
+			surveySectionName := fmt.Sprintf("%sX_ISPAPP_ChannelSurvey.%d.", sectionName, j+1)
+			uci.Set("WiFi", fmt.Sprintf("%sFrequency", surveySectionName), fmt.Sprintf("%d", survey.Frequency), false)
+			uci.Set("WiFi", fmt.Sprintf("%sChannel", surveySectionName), fmt.Sprintf("%d", wifi.Channel(survey.Frequency)), false)
+			uci.Set("WiFi", fmt.Sprintf("%sInUse", surveySectionName), fmt.Sprintf("%t", survey.InUse), false)
+			uci.Set("WiFi", fmt.Sprintf("%sNoise", surveySectionName), fmt.Sprintf("%d", survey.Noise), false)
+			uci.Set("WiFi", fmt.Sprintf("%sActiveTime", surveySectionName), fmt.Sprintf("%d", survey.Active.Milliseconds()), false)
+			uci.Set("WiFi", fmt.Sprintf("%sBusyTime", surveySectionName), fmt.Sprintf("%d", survey.Busy.Milliseconds()), false)
+			uci.Set("WiFi", fmt.Sprintf("%sReceiveTime", surveySectionName), fmt.Sprintf("%d", survey.Receive.Milliseconds()), false)
+			uci.Set("WiFi", fmt.Sprintf("%sTransmitTime", surveySectionName), fmt.Sprintf("%d", survey.Transmit.Milliseconds()), false)
+			uci.Set("WiFi", fmt.Sprintf("%sUtilization", surveySectionName), fmt.Sprintf("%d", survey.Utilization()), false)
+		}
 	}
 
 	// Commit changes
@@ -188,12 +228,19 @@ func RadiosCollectCmd(executor *exec.Executor) {
 //     AssociatedDevice.{i}.
 //         MACAddress                     type: MACAddress, flags: deny-active-notif
 //         AuthenticationState            type: bool, flags: deny-active-notif
+//         LastDataDownlinkRate           type: uint32[1000:], kbps
+//         LastDataUplinkRate             type: uint32[1000:], kbps
 //         SignalStrength                 type: int32[-200:]
+//         Retransmissions                type: uint32[0:100]
+//         Active                         type: bool
 //         Stats.
 //             BytesSent                  type: StatsCounter64
 //             BytesReceived              type: StatsCounter64
 //             PacketsSent                type: StatsCounter64
 //             PacketsReceived            type: StatsCounter64
+//             ErrorsSent                 type: StatsCounter32
+//             RetransCount               type: StatsCounter32
+//             FailedRetransCount         type: StatsCounter32
 //         X_ISPAPP_Stats.
 //             TxFrames                   type: StatsCounter64, flags: deny-active-notif
 //             RxFrames                   type: StatsCounter64, flags: deny-active-notif
@@ -213,10 +260,13 @@ func RadiosCollectCmd(executor *exec.Executor) {
 //             SignalStrengthCh1          type: int32, flags: deny-active-notif
 //             StrengthAtRates            type: string, flags: deny-active-notif
 //             UpTime                     type: uint32, flags: deny-active-notif
+//             MinSignalStrength          type: int32, the last hour
+//             AvgSignalStrength          type: int32, the last hour
+//             SignalSamples              type: uint32, the last hour
 
-func AccessPointCollectCmd(executor *exec.Executor) {
+func AccessPointCollectCmd(executor exec.Runner) {
 	_package := "Device"
-	uci, err := uci.LoadConfig("/etc/config/tr069", &_package)
+	uci, err := uci.LoadConfig(store.Path, &_package)
 	if err != nil {
 		log.Printf("Failed to create UCI context: %v", err)
 		return
@@ -230,18 +280,17 @@ func AccessPointCollectCmd(executor *exec.Executor) {
 	defer cancel()
 
 	// Get all WiFi interfaces (access points)
-	interfaces, err := getWiFiInterfaces(ctx, executor, uci)
+	backend := wifiBackend(executor)
+	interfaces, err := getWiFiInterfaces(ctx, executor, backend, uci)
 	if err != nil {
 		log.Printf("Failed to get WiFi interfaces: %v", err)
 		return
 	}
 
-	// Filter for AP interfaces only
+	// Filter for AP interfaces only, hostapd.sh defaults the mode to ap
 	var accessPoints []WiFiInterface
 	for _, iface := range interfaces {
-		// Check if this is an AP interface by checking mode using executor
-		mode := getWirelessInterfaceMode(ctx, executor, iface.Name)
-		if mode == "ap" {
+		if iface.Mode == "" || iface.Mode == "ap" {
 			accessPoints = append(accessPoints, iface)
 		}
 	}
@@ -254,34 +303,37 @@ func AccessPointCollectCmd(executor *exec.Executor) {
 
 	// Process each access point - Device.WiFi.AccessPoint.{i}.
 	for i, ap := range accessPoints {
-		index := i + 1
+		index := ap.AccessPoint
+		if index == 0 {
+			index = i + 1
+		}
+		ssid := ap.Index
+		if ssid == 0 {
+			ssid = index
+		}
 		sectionName := fmt.Sprintf("AccessPoint.%d.", index)
 
 		// Basic access point properties following TR-069 naming
-		uci.Set("WIFI", fmt.Sprintf("%sEnable", sectionName), fmt.Sprintf("%t", ap.Enable), false)
-		uci.Set("WIFI", fmt.Sprintf("%sStatus", sectionName), getAPStatus(ap.Status), false)
-		uci.Set("WIFI", fmt.Sprintf("%sSSIDReference", sectionName), fmt.Sprintf("Device.WiFi.SSID.%d.", index), false)
-		uci.Set("WIFI", fmt.Sprintf("%sSSIDAdvertisementEnabled", sectionName), "true", false) // Default value
-
-		// Get security configuration
-		encryption, keyPassphrase := getSecurityConfig(ctx, executor, ap.Name)
+		uci.Set("WiFi", fmt.Sprintf("%sEnable", sectionName), fmt.Sprintf("%t", ap.Enable), false)
+		uci.Set("WiFi", fmt.Sprintf("%sStatus", sectionName), getAPStatus(ap.Status), false)
+		uci.Set("WiFi", fmt.Sprintf("%sSSIDReference", sectionName), fmt.Sprintf("Device.WiFi.SSID.%d.", ssid), false)
+		uci.Set("WiFi", fmt.Sprintf("%sSSIDAdvertisementEnabled", sectionName), fmt.Sprintf("%t", !ap.Hidden), false)
 
 		// Save security configuration - Device.WiFi.AccessPoint.{i}.Security.
-		uci.Set("WIFI", fmt.Sprintf("%sSecurity.ModesSupported", sectionName), "None,WPA-Personal,WPA2-Personal,WPA-WPA2-Personal,WPA-Enterprise,WPA2-Enterprise,WPA-WPA2-Enterprise", false)
-		uci.Set("WIFI", fmt.Sprintf("%sSecurity.ModeEnabled", sectionName), encryption, false)
-		if keyPassphrase != "" {
-			uci.Set("WIFI", fmt.Sprintf("%sSecurity.KeyPassphrase", sectionName), keyPassphrase, false)
-		}
+		// The passphrase is write-only and reads as an empty string
+		uci.Set("WiFi", fmt.Sprintf("%sSecurity.ModesSupported", sectionName), wifi.ModesSupported, false)
+		uci.Set("WiFi", fmt.Sprintf("%sSecurity.ModeEnabled", sectionName), wifi.SecurityMode(ap.Encryption), false)
+		uci.Set("WiFi", fmt.Sprintf("%sSecurity.KeyPassphrase", sectionName), "", false)
 
 		// Get associated devices
-		associatedDevices, err := getAssociatedDevices(ctx, executor, ap.Name)
+		associatedDevices, err := getAssociatedDevices(ctx, backend, stationHistory, ap.Name)
 		if err != nil {
 			log.Printf("Failed to get associated devices for %s: %v", ap.Name, err)
 			associatedDevices = []AssociatedDevice{} // Continue with empty list
 		}
 
 		// Save associated device count - Device.WiFi.AccessPoint.{i}.AssociatedDeviceNumberOfEntries
-		uci.Set("WIFI", fmt.Sprintf("%sAssociatedDeviceNumberOfEntries", sectionName), fmt.Sprintf("%d", len(associatedDevices)), false)
+		uci.Set("WiFi", fmt.Sprintf("%sAssociatedDeviceNumberOfEntries", sectionName), fmt.Sprintf("%d", len(associatedDevices)), false)
 
 		// Process each associated device - Device.WiFi.AccessPoint.{i}.AssociatedDevice.{j}.
 		for j, device := range associatedDevices {
@@ -289,109 +341,40 @@ func AccessPointCollectCmd(executor *exec.Executor) {
 			deviceSectionName := fmt.Sprintf("AccessPoint.%d.AssociatedDevice.%d.", index, deviceIndex)
 
 			// Basic device properties following TR-069 naming
-			uci.Set("WIFI", fmt.Sprintf("%sMACAddress", deviceSectionName), device.MACAddress, false)
-			uci.Set("WIFI", fmt.Sprintf("%sAuthenticationState", deviceSectionName), fmt.Sprintf("%t", device.AuthenticationState), false)
-			uci.Set("WIFI", fmt.Sprintf("%sSignalStrength", deviceSectionName), fmt.Sprintf("%d", device.SignalStrength), false)
+			uci.Set("WiFi", fmt.Sprintf("%sMACAddress", deviceSectionName), device.MACAddress, false)
+			uci.Set("WiFi", fmt.Sprintf("%sAuthenticationState", deviceSectionName), fmt.Sprintf("%t", device.AuthenticationState), false)
+			uci.Set("WiFi", fmt.Sprintf("%sLastDataDownlinkRate", deviceSectionName), fmt.Sprintf("%d", device.LastDataDownlinkRate), false)
+			uci.Set("WiFi", fmt.Sprintf("%sLastDataUplinkRate", deviceSectionName), fmt.Sprintf("%d", device.LastDataUplinkRate), false)
+			uci.Set("WiFi", fmt.Sprintf("%sSignalStrength", deviceSectionName), fmt.Sprintf("%d", device.SignalStrength), false)
+			uci.Set("WiFi", fmt.Sprintf("%sRetransmissions", deviceSectionName), fmt.Sprintf("%d", device.Retransmissions), false)
+			uci.Set("WiFi", fmt.Sprintf("%sActive", deviceSectionName), fmt.Sprintf("%t", device.Active), false)
 
 			// Save device statistics - Device.WiFi.AccessPoint.{i}.AssociatedDevice.{j}.Stats.
-			uci.Set("WIFI", fmt.Sprintf("%sStats.BytesSent", deviceSectionName), fmt.Sprintf("%d", device.Stats.BytesSent), false)
-			uci.Set("WIFI", fmt.Sprintf("%sStats.BytesReceived", deviceSectionName), fmt.Sprintf("%d", device.Stats.BytesReceived), false)
-			uci.Set("WIFI", fmt.Sprintf("%sStats.PacketsSent", deviceSectionName), fmt.Sprintf("%d", device.Stats.PacketsSent), false)
-			uci.Set("WIFI", fmt.Sprintf("%sStats.PacketsReceived", deviceSectionName), fmt.Sprintf("%d", device.Stats.PacketsReceived), false)
+			uci.Set("WiFi", fmt.Sprintf("%sStats.BytesSent", deviceSectionName), fmt.Sprintf("%d", device.Stats.BytesSent), false)
+			uci.Set("WiFi", fmt.Sprintf("%sStats.BytesReceived", deviceSectionName), fmt.Sprintf("%d", device.Stats.BytesReceived), false)
+			uci.Set("WiFi", fmt.Sprintf("%sStats.PacketsSent", deviceSectionName), fmt.Sprintf("%d", device.Stats.PacketsSent), false)
+			uci.Set("WiFi", fmt.Sprintf("%sStats.PacketsReceived", deviceSectionName), fmt.Sprintf("%d", device.Stats.PacketsReceived), false)
+			uci.Set("WiFi", fmt.Sprintf("%sStats.ErrorsSent", deviceSectionName), fmt.Sprintf("%d", device.FailedRetransCount), false)
+			uci.Set("WiFi", fmt.Sprintf("%sStats.RetransCount", deviceSectionName), fmt.Sprintf("%d", device.RetransCount), false)
+			uci.Set("WiFi", fmt.Sprintf("%sStats.FailedRetransCount", deviceSectionName), fmt.Sprintf("%d", device.FailedRetransCount), false)
 
 			// Save extended statistics - Device.WiFi.AccessPoint.{i}.AssociatedDevice.{j}.X_ISPAPP_Stats.
-			uci.Set("WIFI", fmt.Sprintf("%sX_ISPAPP_Stats.RxRate", deviceSectionName), device.RxRate, false)
-			uci.Set("WIFI", fmt.Sprintf("%sX_ISPAPP_Stats.TxRate", deviceSectionName), device.TxRate, false)
-			uci.Set("WIFI", fmt.Sprintf("%sX_ISPAPP_Stats.LastActivity", deviceSectionName), fmt.Sprintf("%d", device.LastActivity), false)
-		}
-	}
-
-	// Commit changes
-	err = uci.Save()
-	if err != nil {
-		log.Printf("Failed to commit UCI changes: %v", err)
-	}
-}
-
-// NeighboringWiFiDiagnostic.
-//     DiagnosticsState                   type: DiagnosticsState, access: W
-//     ResultNumberOfEntries              type: uint32
-//     Result.{i}.
-//         Radio                          type: strongRef
-//         SSID                           type: string(32)
-//         BSSID                          type: MACAddress
-//         Channel                        type: uint32[1:255]
-//         SignalStrength                 type: int32[-200:]
-//         OperatingFrequencyBand         type: enum
-//         OperatingStandards             type: list<string>
-//         OperatingChannelBandwidth      type: enum
-//         Noise                          type: int32[-200:]
-
-func NeighboringWiFiCollectCmd(executor *exec.Executor) {
-	_package := "Device"
-	uci, err := uci.LoadConfig("/etc/config/tr069", &_package)
-	if err != nil {
-		log.Printf("Failed to create UCI context: %v", err)
-		return
-	}
-
-	if executor == nil {
-		log.Printf("Failed to create executor")
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
-	defer cancel()
-
-	// Get all WiFi interfaces to perform scan
-	interfaces, err := getWiFiInterfaces(ctx, executor, uci)
-	if err != nil {
-		log.Printf("Failed to get WiFi interfaces: %v", err)
-		return
-	}
-
-	var allScanResults []NeighboringScanResult
-
-	// Perform scan on each interface
-	for _, iface := range interfaces {
-		if iface.Name != "" {
-			scanResults, err := performWiFiScan(ctx, executor, iface.Name)
-			if err != nil {
-				log.Printf("Failed to scan on interface %s: %v", iface.Name, err)
-				continue
-			}
-			allScanResults = append(allScanResults, scanResults...)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.TxFrames", deviceSectionName), fmt.Sprintf("%d", device.Stats.PacketsSent), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.RxFrames", deviceSectionName), fmt.Sprintf("%d", device.Stats.PacketsReceived), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.TxFrameBytes", deviceSectionName), fmt.Sprintf("%d", device.Stats.BytesSent), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.RxFrameBytes", deviceSectionName), fmt.Sprintf("%d", device.Stats.BytesReceived), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.TxCCQ", deviceSectionName), fmt.Sprintf("%d", device.TxCCQ), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.SignalToNoise", deviceSectionName), fmt.Sprintf("%d", device.SignalToNoise), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.RxRate", deviceSectionName), device.RxRate, false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.TxRate", deviceSectionName), device.TxRate, false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.LastActivity", deviceSectionName), fmt.Sprintf("%d", device.LastActivity), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.UpTime", deviceSectionName), fmt.Sprintf("%d", device.UpTime), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.MinSignalStrength", deviceSectionName), fmt.Sprintf("%d", device.MinSignalStrength), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.AvgSignalStrength", deviceSectionName), fmt.Sprintf("%d", device.AvgSignalStrength), false)
+			uci.Set("WiFi", fmt.Sprintf("%sX_ISPAPP_Stats.SignalSamples", deviceSectionName), fmt.Sprintf("%d", device.SignalSamples), false)
 		}
 	}
 
-	// Save scan result count - Device.WiFi.NeighboringWiFiDiagnostic.ResultNumberOfEntries
-	err = uci.Set("WiFi", "NeighboringWiFiDiagnostic.DiagnosticsState", "Complete", false)
-	if err != nil {
-		log.Printf("Failed to set diagnostics state: %v", err)
-	}
-
-	err = uci.Set("WiFi", "NeighboringWiFiDiagnostic.ResultNumberOfEntries", fmt.Sprintf("%d", len(allScanResults)), false)
-	if err != nil {
-		log.Printf("Failed to set scan result count: %v", err)
-	}
-
-	// Process each scan result - Device.WiFi.NeighboringWiFiDiagnostic.Result.{i}.
-	for i, result := range allScanResults {
-		index := i + 1
-		sectionName := fmt.Sprintf("NeighboringWiFiDiagnostic.Result.%d.", index)
-
-		// Basic scan result properties following TR-069 naming
-		uci.Set("WIFI", fmt.Sprintf("%sRadio", sectionName), fmt.Sprintf("Device.WiFi.Radio.%d.", 1), false) // Default to radio 1
-		uci.Set("WIFI", fmt.Sprintf("%sSSID", sectionName), result.SSID, false)
-		uci.Set("WIFI", fmt.Sprintf("%sBSSID", sectionName), result.BSSID, false)
-		uci.Set("WIFI", fmt.Sprintf("%sChannel", sectionName), fmt.Sprintf("%d", result.Channel), false)
-		uci.Set("WIFI", fmt.Sprintf("%sSignalStrength", sectionName), fmt.Sprintf("%d", result.SignalStrength), false)
-		uci.Set("WIFI", fmt.Sprintf("%sOperatingFrequencyBand", sectionName), result.OperatingFrequencyBand, false)
-		uci.Set("WIFI", fmt.Sprintf("%sOperatingStandards", sectionName), result.OperatingStandards, false)
-		uci.Set("WIFI", fmt.Sprintf("%sOperatingChannelBandwidth", sectionName), result.OperatingChannelBandwidth, false)
-		uci.Set("WIFI", fmt.Sprintf("%sNoise", sectionName), fmt.Sprintf("%d", result.Noise), false)
-	}
-
 	// Commit changes
 	err = uci.Save()
 	if err != nil {
@@ -401,30 +384,40 @@ func NeighboringWiFiCollectCmd(executor *exec.Executor) {
 
 // WiFiInterface represents a WiFi interface with its properties
 type WiFiInterface struct {
-	Name       string
-	Device     string
-	SSID       string
-	BSSID      string
-	MACAddress string
-	Enable     bool
-	Status     string
-	Network    string
+	Name        string
+	Device      string
+	SSID        string
+	BSSID       string
+	MACAddress  string
+	Enable      bool
+	Status      string
+	Network     string
+	Index       int    // SSID instance, 0 when the section is not numbered
+	AccessPoint int    // AccessPoint instance, 0 when not numbered or not in AP mode
+	Radio       string // Reference to the Radio of the device section
+	Mode        string
+	Hidden      bool
+	Encryption  string
 }
 
 // WiFiRadio represents a WiFi radio device
 type WiFiRadio struct {
-	Name                    string
-	Enable                  bool
-	Status                  string
-	SupportedFrequencyBands string
-	OperatingFrequencyBand  string
-	SupportedStandards      string
-	OperatingStandards      string
-	PossibleChannels        string
-	Channel                 int
-	AutoChannelSupported    bool
-	AutoChannelEnable       bool
-	Noise                   int
+	Name                      string
+	Enable                    bool
+	Status                    string
+	SupportedFrequencyBands   string
+	OperatingFrequencyBand    string
+	SupportedStandards        string
+	OperatingStandards        string
+	PossibleChannels          string
+	Index                     int // Radio instance, 0 when the section is not numbered
+	OperatingChannelBandwidth string
+	Channel                   int
+	AutoChannelSupported      bool
+	AutoChannelEnable         bool
+	Noise                     int
+	OverallTxCCQ              int
+	ChannelSurvey             []wifi.Survey
 }
 
 // WiFiStats represents WiFi interface statistics
@@ -441,37 +434,75 @@ type WiFiStats struct {
 
 // AssociatedDevice represents a device associated to an access point
 type AssociatedDevice struct {
-	MACAddress          string
-	AuthenticationState bool
-	SignalStrength      int32
-	TxRate              string
-	RxRate              string
-	LastActivity        uint32
-	Stats               WiFiStats
+	MACAddress           string
+	AuthenticationState  bool
+	SignalStrength       int32
+	LastDataDownlinkRate uint32 // kbit/s
+	LastDataUplinkRate   uint32 // kbit/s
+	Retransmissions      int    // Percent of the packets sent since the last collection
+	Active               bool
+	TxRate               string
+	RxRate               string
+	LastActivity         uint32 // Seconds
+	UpTime               uint32 // Seconds
+	TxCCQ                int
+	SignalToNoise        int32 // dB, 0 when the noise is unknown
+	RetransCount         uint64
+	FailedRetransCount   uint64
+	MinSignalStrength    int32 // Over the last hour
+	AvgSignalStrength    int32 // Over the last hour
+	SignalSamples        int
+	Stats                WiFiStats
 }
 
-// NeighboringScanResult represents a neighboring WiFi scan result
-type NeighboringScanResult struct {
-	SSID                      string
-	BSSID                     string
-	Channel                   int
-	SignalStrength            int32
-	OperatingFrequencyBand    string
-	OperatingStandards        string
-	OperatingChannelBandwidth string
-	Noise                     int32
+// stationHistory follows the signal of the stations between the collections
+var stationHistory = wifi.NewHistory(time.Hour)
+
+// wifiBackend reads the wireless interfaces over nl80211, with the shell
+// tools for the drivers outside mac80211
+func wifiBackend(executor exec.Runner) wifi.Backend {
+	return wifi.Fallback{wifi.NL80211{}, wifi.Shell{Runner: executor}}
+}
+
+// wifiManagers are the managers of the collectors by runner, the collections
+// through one runner number the wireless sections under the lock of one
+// manager
+var (
+	wifiManagersMu sync.Mutex
+	wifiManagers   = map[exec.Runner]*wifi.Manager{}
+)
+
+// wifiManager returns the manager of the collectors running through executor
+func wifiManager(executor exec.Runner) *wifi.Manager {
+	wifiManagersMu.Lock()
+	defer wifiManagersMu.Unlock()
+	manager, ok := wifiManagers[executor]
+	if !ok {
+		manager = wifi.NewManager(executor, wifiBackend(executor))
+		wifiManagers[executor] = manager
+	}
+	return manager
 }
 
-// getWiFiInterfaces retrieves all WiFi interfaces from UCI configuration
-func getWiFiInterfaces(ctx context.Context, executor *exec.Executor, uci *uci.UCIConfig) ([]WiFiInterface, error) {
+// getWiFiInterfaces retrieves all WiFi interfaces from UCI configuration,
+// with the state of their kernel interfaces read through backend
+func getWiFiInterfaces(ctx context.Context, executor exec.Runner, backend wifi.Backend, uci *uci.UCIConfig) ([]WiFiInterface, error) {
 	var interfaces []WiFiInterface
 	_ = uci // May be used in future for additional UCI queries
 
+	// Number the sections so the instances match the ones SetParameterValues writes
+	if err := wifiManager(executor).Number(ctx); err != nil {
+		log.Printf("Warning: could not number wireless sections: %v", err)
+	}
+
 	// First, get available wireless interfaces from the system
-	availableInterfaces, err := getAvailableWirelessInterfaces(ctx, executor)
+	kernelInterfaces, err := backend.Interfaces(ctx)
 	if err != nil {
 		log.Printf("Warning: could not get available wireless interfaces: %v", err)
-		availableInterfaces = make(map[string]string) // empty map as fallback
+	}
+	availableInterfaces := make(map[string]string)
+	for _, iface := range kernelInterfaces {
+		availableInterfaces[iface.Name] = fmt.Sprintf("phy%d", iface.PHY)
 	}
 
 	// Get wireless interfaces using UCI show command
@@ -488,17 +519,22 @@ func getWiFiInterfaces(ctx context.Context, executor *exec.Executor, uci *uci.UC
 	// Parse UCI wireless configuration - support both named interfaces and @wifi-iface format
 	ifaceRegex := regexp.MustCompile(`wireless\.(@wifi-iface\[(\d+)\]|(\w+))\.(\w+)=(.*)`)
 	sectionTypeRegex := regexp.MustCompile(`wireless\.(\w+)=wifi-iface`)
+	radioInstanceRegex := regexp.MustCompile(`wireless\.(\w+)\.` + wifi.RadioInstance + `='?(\d+)'?`)
 	ifaceMap := make(map[string]map[string]string)
 	wifiIfaceSections := make(map[string]bool)
+	radioInstances := make(map[string]string)
 
 	lines := strings.Split(output, "\n")
 
-	// First pass: identify wifi-iface sections
+	// First pass: identify wifi-iface sections and the instances of the radios
 	for _, line := range lines {
 		if matches := sectionTypeRegex.FindStringSubmatch(line); matches != nil {
 			sectionName := matches[1]
 			wifiIfaceSections[sectionName] = true
 		}
+		if matches := radioInstanceRegex.FindStringSubmatch(line); matches != nil {
+			radioInstances[matches[1]] = matches[2]
+		}
 	}
 
 	// Second pass: parse configuration for wifi-iface sections
@@ -536,8 +572,14 @@ func getWiFiInterfaces(ctx context.Context, executor *exec.Executor, uci *uci.UC
 		}
 	}
 
-	// Convert to WiFiInterface structs
-	for sectionName, config := range ifaceMap {
+	// Convert to WiFiInterface structs, in section order so the table indices stay stable
+	sectionNames := make([]string, 0, len(ifaceMap))
+	for sectionName := range ifaceMap {
+		sectionNames = append(sectionNames, sectionName)
+	}
+	sort.Strings(sectionNames)
+	for _, sectionName := range sectionNames {
+		config := ifaceMap[sectionName]
 		if config["ssid"] != "" {
 			// Determine interface name - use ifname if set, otherwise try to find matching interface
 			interfaceName := config["ifname"]
@@ -547,58 +589,40 @@ func getWiFiInterfaces(ctx context.Context, executor *exec.Executor, uci *uci.UC
 			}
 
 			iface := WiFiInterface{
-				Name:    interfaceName,
-				Device:  config["device"],
-				SSID:    config["ssid"],
-				Enable:  config["disabled"] != "1",
-				Network: config["network"],
+				Name:       interfaceName,
+				Device:     config["device"],
+				SSID:       config["ssid"],
+				Enable:     config["disabled"] != "1",
+				Network:    config["network"],
+				Mode:       config["mode"],
+				Hidden:     config["hidden"] == "1",
+				Encryption: config["encryption"],
+			}
+			iface.Index, _ = strconv.Atoi(config[wifi.SSIDInstance])
+			iface.AccessPoint, _ = strconv.Atoi(config[wifi.AccessPointInstance])
+			if radio, ok := radioInstances[iface.Device]; ok {
+				iface.Radio = fmt.Sprintf("Device.WiFi.Radio.%s.", radio)
 			}
 
 			// Get interface status and additional info
-			if iface.Name != "" {
-				status, bssid, mac := getInterfaceInfo(ctx, executor, iface.Name)
-				iface.Status = status
-				iface.BSSID = bssid
-				iface.MACAddress = mac
+			iface.Status = "Down"
+			for _, kernel := range kernelInterfaces {
+				if kernel.Name != iface.Name || iface.Name == "" {
+					continue
+				}
+				if kernel.Type == "AP" || kernel.Type == "managed" {
+					iface.Status = "Up"
+				}
+				// For AP mode, addr is both BSSID and MAC
+				iface.BSSID = kernel.MAC
+				iface.MACAddress = kernel.MAC
 			}
 
 			interfaces = append(interfaces, iface)
 		}
 	}
-
-	return interfaces, nil
-}
-
-// getAvailableWirelessInterfaces gets list of available wireless interfaces from the system
-func getAvailableWirelessInterfaces(ctx context.Context, executor *exec.Executor) (map[string]string, error) {
-	interfaces := make(map[string]string)
-
-	// Get wireless interfaces using iw
-	result, err := executor.Execute(ctx, "iw", "dev")
-	if err != nil {
-		return interfaces, fmt.Errorf("failed to get wireless interfaces: %w", err)
-	}
-
-	output, ok := result.Stdout.(string)
-	if !ok {
-		return interfaces, fmt.Errorf("unexpected output type from iw dev")
-	}
-
-	// Parse iw dev output to get interface names and their phy devices
-	lines := strings.Split(output, "\n")
-	var currentPhy string
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "phy#") {
-			// Extract phy name (e.g., "phy#0" -> "phy0")
-			currentPhy = strings.Replace(line, "phy#", "phy", 1)
-		} else if strings.HasPrefix(line, "Interface ") && currentPhy != "" {
-			// Extract interface name
-			interfaceName := strings.TrimPrefix(line, "Interface ")
-			interfaces[interfaceName] = currentPhy
-		}
-	}
+	// Numbered sections are listed in instance order
+	sort.SliceStable(interfaces, func(i, j int) bool { return interfaces[i].Index < interfaces[j].Index })
 
 	return interfaces, nil
 }
@@ -644,86 +668,25 @@ func findActualInterfaceName(config map[string]string, sectionName string, avail
 	return ""
 }
 
-// getInterfaceInfo gets interface status, BSSID and MAC address
-func getInterfaceInfo(ctx context.Context, executor *exec.Executor, ifaceName string) (status, bssid, mac string) {
-	// Get interface info using iw
-	result, err := executor.Execute(ctx, "iw", "dev", ifaceName, "info")
-	if err != nil {
-		return "Down", "", ""
-	}
-
-	output, ok := result.Stdout.(string)
-	if !ok {
-		return "Down", "", ""
-	}
-
-	status = "Down"
-	if strings.Contains(output, "type AP") || strings.Contains(output, "type managed") {
-		status = "Up"
-	}
-
-	// Extract BSSID
-	bssidRegex := regexp.MustCompile(`addr ([0-9a-fA-F:]{17})`)
-	if matches := bssidRegex.FindStringSubmatch(output); matches != nil {
-		bssid = matches[1]
-		mac = matches[1] // For AP mode, addr is both BSSID and MAC
-	}
-
-	return status, bssid, mac
-}
-
 // getInterfaceStats retrieves interface statistics
-func getInterfaceStats(ctx context.Context, executor *exec.Executor, ifaceName string) (WiFiStats, error) {
-	var stats WiFiStats
-
-	// Get stats from /proc/net/dev
-	result, err := executor.Execute(ctx, "cat", "/proc/net/dev")
+func getInterfaceStats(ctx context.Context, backend wifi.Backend, ifaceName string) (WiFiStats, error) {
+	stats, err := backend.Stats(ctx, ifaceName)
 	if err != nil {
-		return stats, fmt.Errorf("failed to read /proc/net/dev: %w", err)
+		return WiFiStats{}, err
 	}
-
-	output, ok := result.Stdout.(string)
-	if !ok {
-		return stats, fmt.Errorf("unexpected output type from /proc/net/dev")
-	}
-
-	// Parse interface statistics
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, ifaceName+":") {
-			fields := strings.Fields(line)
-			if len(fields) >= 17 {
-				// RX stats: bytes, packets, errs, drop, fifo, frame, compressed, multicast
-				stats.BytesReceived, _ = strconv.ParseUint(fields[1], 10, 64)
-				stats.PacketsReceived, _ = strconv.ParseUint(fields[2], 10, 64)
-				if val, err := strconv.ParseUint(fields[3], 10, 32); err == nil {
-					stats.ErrorsReceived = uint32(val)
-				}
-				if val, err := strconv.ParseUint(fields[4], 10, 32); err == nil {
-					stats.DiscardPacketsReceived = uint32(val)
-				}
-
-				// TX stats: bytes, packets, errs, drop, fifo, colls, carrier, compressed
-				stats.BytesSent, _ = strconv.ParseUint(fields[9], 10, 64)
-				stats.PacketsSent, _ = strconv.ParseUint(fields[10], 10, 64)
-				if val, err := strconv.ParseUint(fields[11], 10, 32); err == nil {
-					stats.ErrorsSent = uint32(val)
-				}
-				if val, err := strconv.ParseUint(fields[12], 10, 32); err == nil {
-					stats.DiscardPacketsSent = uint32(val)
-				}
-			}
-			break
-		}
-	}
-
-	return stats, nil
+	return WiFiStats(stats), nil
 }
 
-// getWiFiRadios retrieves all WiFi radio devices
-func getWiFiRadios(ctx context.Context, executor *exec.Executor, uci *uci.UCIConfig) ([]WiFiRadio, error) {
+// getWiFiRadios retrieves all WiFi radio devices, with the radio stats read
+// through the backends of the collectors' manager
+func getWiFiRadios(ctx context.Context, executor exec.Runner, _ *uci.UCIConfig) ([]WiFiRadio, error) {
 	var radios []WiFiRadio
-	_ = uci // May be used in future for additional UCI queries
+
+	// Number the sections so the instances match the ones SetParameterValues writes
+	manager := wifiManager(executor)
+	if err := manager.Number(ctx); err != nil {
+		log.Printf("Warning: could not number wireless sections: %v", err)
+	}
 
 	// Get wireless devices using UCI show command
 	result, err := executor.Execute(ctx, "uci", "show", "wireless")
@@ -736,31 +699,19 @@ func getWiFiRadios(ctx context.Context, executor *exec.Executor, uci *uci.UCICon
 		return nil, fmt.Errorf("unexpected output type from uci show")
 	}
 
-	// Parse UCI wireless configuration for wifi-device entries
-	deviceRegex := regexp.MustCompile(`wireless\.@wifi-device\[(\d+)\]\.(\w+)=(.*)`)
-	deviceMap := make(map[string]map[string]string)
-
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if matches := deviceRegex.FindStringSubmatch(line); matches != nil {
-			index := matches[1]
-			key := matches[2]
-			value := strings.Trim(matches[3], "'\"")
-
-			if deviceMap[index] == nil {
-				deviceMap[index] = make(map[string]string)
-			}
-			deviceMap[index][key] = value
+	// Parse UCI wireless configuration for wifi-device entries, named like
+	// radio0 or anonymous like @wifi-device[0]
+	for _, sec := range uci.ParseShow(output) {
+		if sec.SectionType != "wifi-device" {
+			continue
 		}
-	}
-
-	// Convert to WiFiRadio structs
-	for _, config := range deviceMap {
+		config := sec.Options
 		radio := WiFiRadio{
 			Name:                 config["type"],
 			Enable:               config["disabled"] != "1",
 			AutoChannelSupported: true, // Most modern radios support auto-channel
 		}
+		radio.Index, _ = strconv.Atoi(config[wifi.RadioInstance])
 
 		// Parse channel
 		if channel, err := strconv.Atoi(config["channel"]); err == nil {
@@ -780,7 +731,8 @@ func getWiFiRadios(ctx context.Context, executor *exec.Executor, uci *uci.UCICon
 		radio.SupportedFrequencyBands = bands
 		radio.OperatingFrequencyBand = bands // Assume operating same as supported for now
 		radio.SupportedStandards = standards
-		radio.OperatingStandards = config["hwmode"]
+		radio.OperatingStandards = wifi.OperatingStandards(config)
+		radio.OperatingChannelBandwidth = wifi.OperatingChannelBandwidth(config)
 		radio.PossibleChannels = channels
 
 		// Get radio status
@@ -788,12 +740,26 @@ func getWiFiRadios(ctx context.Context, executor *exec.Executor, uci *uci.UCICon
 
 		radios = append(radios, radio)
 	}
+	sort.SliceStable(radios, func(i, j int) bool { return radios[i].Index < radios[j].Index })
+
+	// Noise, CCQ and the channel survey of the radios the kernel drives
+	stats, err := manager.RadioStats(ctx)
+	if err != nil {
+		log.Printf("Warning: could not measure the radios: %v", err)
+	}
+	for i := range radios {
+		if measured, ok := stats[radios[i].Index]; ok {
+			radios[i].Noise = measured.Noise
+			radios[i].OverallTxCCQ = measured.OverallTxCCQ
+			radios[i].ChannelSurvey = measured.Survey
+		}
+	}
 
 	return radios, nil
 }
 
 // getRadioCapabilities gets supported frequency bands, standards and channels
-func getRadioCapabilities(ctx context.Context, executor *exec.Executor, phyName string) (bands, standards, channels string) {
+func getRadioCapabilities(ctx context.Context, executor exec.Runner, phyName string) (bands, standards, channels string) {
 	// Get PHY info using iw
 	result, err := executor.Execute(ctx, "iw", "phy", phyName, "info")
 	if err != nil {
@@ -827,7 +793,7 @@ func getRadioCapabilities(ctx context.Context, executor *exec.Executor, phyName
 }
 
 // getRadioStatus gets the status of a radio
-func getRadioStatus(ctx context.Context, executor *exec.Executor, phyName string) string {
+func getRadioStatus(ctx context.Context, executor exec.Runner, phyName string) string {
 	// Check if any interface on this PHY is up
 	result, err := executor.Execute(ctx, "iw", "dev")
 	if err != nil {
@@ -859,279 +825,79 @@ func getRadioStatus(ctx context.Context, executor *exec.Executor, phyName string
 }
 
 // getAssociatedDevices gets devices associated with an access point interface
-func getAssociatedDevices(ctx context.Context, executor *exec.Executor, ifaceName string) ([]AssociatedDevice, error) {
-	var devices []AssociatedDevice
-
-	// Use wlanconfig to get associated stations
-	result, err := executor.Execute(ctx, "wlanconfig", ifaceName, "list")
+func getAssociatedDevices(ctx context.Context, backend wifi.Backend, history *wifi.History, ifaceName string) ([]AssociatedDevice, error) {
+	stations, err := backend.Stations(ctx, ifaceName)
 	if err != nil {
-		return devices, nil // No error if no stations or interface not found
-	}
-
-	output, ok := result.Stdout.(string)
-	if !ok {
-		return devices, nil
-	}
-
-	// Parse wlanconfig output
-	lines := strings.Split(output, "\n")
-	var currentDevice *AssociatedDevice
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+		return nil, err
+	}
+	noise := interfaceNoise(ctx, backend, ifaceName)
+	now := time.Now()
+	devices := make([]AssociatedDevice, 0, len(stations))
+	for _, station := range stations {
+		summary := history.Add(station, now)
+		device := AssociatedDevice{
+			MACAddress:           station.MAC,
+			AuthenticationState:  station.Authorized,
+			SignalStrength:       int32(station.Signal),
+			LastDataDownlinkRate: uint32(station.TxRate),
+			LastDataUplinkRate:   uint32(station.RxRate),
+			Retransmissions:      summary.Retransmissions,
+			Active:               true, // Listed by the driver
+			TxRate:               formatRate(station.TxRate),
+			RxRate:               formatRate(station.RxRate),
+			LastActivity:         uint32(station.Inactive / time.Second),
+			UpTime:               uint32(station.Connected / time.Second),
+			RetransCount:         station.Retries,
+			FailedRetransCount:   station.Failed,
+			MinSignalStrength:    int32(summary.MinSignal),
+			AvgSignalStrength:    int32(summary.AvgSignal),
+			SignalSamples:        summary.Samples,
+			Stats: WiFiStats{
+				BytesSent:       station.BytesSent,
+				BytesReceived:   station.BytesReceived,
+				PacketsSent:     station.PacketsSent,
+				PacketsReceived: station.PacketsReceived,
+			},
 		}
-
-		// New client entry starts with MAC address (format: xx:xx:xx:xx:xx:xx)
-		macRegex := regexp.MustCompile(`^([0-9a-fA-F]{2}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2}:[0-9a-fA-F]{2})`)
-		if macMatch := macRegex.FindStringSubmatch(line); macMatch != nil {
-			// Save previous device if exists
-			if currentDevice != nil {
-				devices = append(devices, *currentDevice)
-			}
-
-			// Initialize new device
-			currentDevice = &AssociatedDevice{
-				MACAddress:          macMatch[1],
-				AuthenticationState: true, // If listed, assume authenticated
-				SignalStrength:      0,
-				TxRate:              "0M",
-				RxRate:              "0M",
-				LastActivity:        0,
-			}
-
-			// Parse the basic info from the main line
-			parts := strings.Fields(line)
-			if len(parts) >= 7 {
-				// Format: MAC AID CHAN TXRATE RXRATE RSSI MINRSSI MAXRSSI [IDLE] ...
-				// Extract RSSI (signal strength)
-				if rssi, err := strconv.ParseInt(parts[5], 10, 32); err == nil {
-					currentDevice.SignalStrength = int32(rssi)
-				}
-				// Extract TX rate
-				if len(parts) > 3 {
-					currentDevice.TxRate = parts[3]
-				}
-				// Extract RX rate
-				if len(parts) > 4 {
-					currentDevice.RxRate = parts[4]
-				}
-				// Extract idle time if available
-				if len(parts) > 8 {
-					if idle, err := strconv.ParseUint(parts[8], 10, 32); err == nil {
-						currentDevice.LastActivity = uint32(idle)
-					}
-				}
-			}
-		} else if currentDevice != nil {
-			// Parse additional device info from subsequent lines
-			if strings.Contains(line, "SNR") {
-				if snr := regexp.MustCompile(`SNR\s*:\s*(\d+)`).FindStringSubmatch(line); snr != nil {
-					// SNR can be used to improve signal strength calculation if needed
-					if snrVal, err := strconv.ParseInt(snr[1], 10, 32); err == nil {
-						// SNR is available but we're using RSSI as primary signal strength
-						_ = snrVal // Keep for potential future use
-					}
-				}
-			}
-
-			if strings.Contains(line, "Minimum Tx Power") {
-				// Additional power info if needed for extended stats
-			}
-
-			if strings.Contains(line, "Maximum Tx Power") {
-				// Additional power info if needed for extended stats
-			}
+		if attempts := station.PacketsSent + station.Retries + station.Failed; attempts > 0 {
+			device.TxCCQ = int(station.PacketsSent * 100 / attempts)
 		}
-	}
-
-	// Add the last device if exists
-	if currentDevice != nil {
-		devices = append(devices, *currentDevice)
-	}
-
-	return devices, nil
-}
-
-// getAPStatus converts interface status to AP status
-func getAPStatus(status string) string {
-	if status == "Up" {
-		return "Enabled"
-	}
-	return "Disabled"
-}
-
-// getSecurityConfig gets encryption and key passphrase using executor
-func getSecurityConfig(ctx context.Context, executor *exec.Executor, ifaceName string) (encryption, keyPassphrase string) {
-	// Get encryption type using executor
-	_encType := getWirelessInterfaceEncryption(ctx, executor, ifaceName)
-	if _encType == "" {
-		return "None", ""
-	}
-	// Convert UCI encryption to TR-069 format
-	switch {
-	case strings.HasPrefix(_encType, "psk2"):
-		encryption = "WPA2-Personal"
-	case strings.HasPrefix(_encType, "psk-mixed"):
-		encryption = "WPA-WPA2-Personal"
-	case strings.HasPrefix(_encType, "psk"):
-		encryption = "WPA-Personal"
-	case strings.HasPrefix(_encType, "wpa2"):
-		encryption = "WPA2-Enterprise"
-	case strings.HasPrefix(_encType, "wpa-mixed"):
-		encryption = "WPA-WPA2-Enterprise"
-	case strings.HasPrefix(_encType, "wpa"):
-		encryption = "WPA-Enterprise"
-	case strings.HasPrefix(_encType, "wep"):
-		encryption = "WEP-128" // Assume WEP-128 as default
-	default:
-		encryption = "None"
-	}
-
-	// Get key passphrase if available
-	if encryption != "None" {
-		_key := getWirelessInterfaceKey(ctx, executor, ifaceName)
-		if _key != "" {
-			keyPassphrase = _key
+		if noise != 0 && station.Signal != 0 {
+			device.SignalToNoise = int32(station.Signal - noise)
 		}
+		devices = append(devices, device)
 	}
-
-	return encryption, keyPassphrase
+	return devices, nil
 }
 
-// performWiFiScan performs WiFi scan on an interface and returns neighboring APs
-func performWiFiScan(ctx context.Context, executor *exec.Executor, ifaceName string) ([]NeighboringScanResult, error) {
-	var results []NeighboringScanResult
-
-	// Use iw scan to get neighboring WiFi networks
-	result, err := executor.Execute(ctx, "iw", "dev", ifaceName, "scan")
-	if err != nil {
-		return results, nil // No error if scan fails, just return empty results
-	}
-
-	output, ok := result.Stdout.(string)
+// interfaceNoise returns the noise of the operating channel of an interface
+// in dBm, 0 when the backend cannot survey it
+func interfaceNoise(ctx context.Context, backend wifi.Backend, ifaceName string) int {
+	surveyor, ok := backend.(wifi.Surveyor)
 	if !ok {
-		return results, nil
-	}
-
-	// Parse scan results
-	lines := strings.Split(output, "\n")
-	var currentResult *NeighboringScanResult
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// New BSS entry
-		if strings.HasPrefix(line, "BSS ") {
-			if currentResult != nil {
-				results = append(results, *currentResult)
-			}
-
-			// Extract BSSID
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				bssid := strings.TrimSuffix(parts[1], "(on")
-				currentResult = &NeighboringScanResult{
-					BSSID: bssid,
-					Noise: -95, // Default noise floor
-				}
-			}
-		} else if currentResult != nil {
-			// Parse BSS parameters
-			if strings.Contains(line, "freq:") {
-				freqStr := strings.TrimSpace(strings.Split(line, ":")[1])
-				if freq, err := strconv.Atoi(freqStr); err == nil {
-					currentResult.Channel = freqToChannel(freq)
-					currentResult.OperatingFrequencyBand = freqToBand(freq)
-				}
-			} else if strings.Contains(line, "signal:") {
-				signalStr := strings.TrimSpace(strings.Split(line, ":")[1])
-				signalStr = strings.Fields(signalStr)[0] // Remove "dBm"
-				if signal, err := strconv.ParseInt(signalStr, 10, 32); err == nil {
-					currentResult.SignalStrength = int32(signal)
-				}
-			} else if strings.Contains(line, "SSID:") {
-				ssid := strings.TrimSpace(strings.Split(line, ":")[1])
-				currentResult.SSID = ssid
-			}
-		}
+		return 0
 	}
-
-	// Add the last result if exists
-	if currentResult != nil {
-		results = append(results, *currentResult)
+	surveys, err := surveyor.Survey(ctx, ifaceName)
+	if err != nil {
+		return 0
 	}
-
-	return results, nil
-}
-
-// freqToChannel converts frequency to channel number
-func freqToChannel(freq int) int {
-	if freq >= 2412 && freq <= 2484 {
-		// 2.4 GHz band
-		if freq == 2484 {
-			return 14
+	for _, survey := range surveys {
+		if survey.InUse {
+			return survey.Noise
 		}
-		return (freq-2412)/5 + 1
-	} else if freq >= 5170 && freq <= 5825 {
-		// 5 GHz band
-		return (freq - 5000) / 5
 	}
 	return 0
 }
 
-// freqToBand converts frequency to band string
-func freqToBand(freq int) string {
-	if freq >= 2412 && freq <= 2484 {
-		return "2.4GHz"
-	} else if freq >= 5170 && freq <= 5825 {
-		return "5GHz"
-	}
-	return "Unknown"
+// formatRate formats a rate in kbit/s like the drivers print it, e.g. 866.7M
+func formatRate(kbps int) string {
+	return strconv.FormatFloat(float64(kbps)/1000, 'f', -1, 64) + "M"
 }
 
-// getWirelessInterfaceMode gets the mode of a wireless interface using executor
-func getWirelessInterfaceMode(ctx context.Context, executor *exec.Executor, ifaceName string) string {
-	result, err := executor.Execute(ctx, "uci", "get", fmt.Sprintf("wireless.%s.mode", ifaceName))
-	if err != nil {
-		return ""
-	}
-
-	output, ok := result.Stdout.(string)
-	if !ok {
-		return ""
-	}
-
-	return strings.TrimSpace(output)
-}
-
-// getWirelessInterfaceEncryption gets the encryption type of a wireless interface using executor
-func getWirelessInterfaceEncryption(ctx context.Context, executor *exec.Executor, ifaceName string) string {
-	result, err := executor.Execute(ctx, "uci", "get", fmt.Sprintf("wireless.%s.encryption", ifaceName))
-	if err != nil {
-		return ""
-	}
-
-	output, ok := result.Stdout.(string)
-	if !ok {
-		return ""
-	}
-
-	return strings.TrimSpace(output)
-}
-
-// getWirelessInterfaceKey gets the key/passphrase of a wireless interface using executor
-func getWirelessInterfaceKey(ctx context.Context, executor *exec.Executor, ifaceName string) string {
-	result, err := executor.Execute(ctx, "uci", "get", fmt.Sprintf("wireless.%s.key", ifaceName))
-	if err != nil {
-		return ""
-	}
-
-	output, ok := result.Stdout.(string)
-	if !ok {
-		return ""
+// getAPStatus converts interface status to AP status
+func getAPStatus(status string) string {
+	if status == "Up" {
+		return "Enabled"
 	}
-
-	return strings.TrimSpace(output)
+	return "Disabled"
 }
@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/store"
+)
+
+// TestHostsCollectorWithFixtures merges fixture leases and neighbors with the
+// stations and DHCP clients already in the store
+func TestHostsCollectorWithFixtures(t *testing.T) {
+	store.Path = filepath.Join(t.TempDir(), "tr069")
+	t.Cleanup(func() { store.Path = "/etc/config/tr069" })
+	err := store.Set(map[string]string{
+		"Device.WiFi.AccessPoint.1.SSIDReference":                 "Device.WiFi.SSID.1.",
+		"Device.WiFi.AccessPoint.1.AssociatedDevice.1.MACAddress": "AA:BB:CC:00:00:02",
+		"Device.DHCPv4.Server.Pool.1.Client.4.Chaddr":             "aa:bb:cc:00:00:01",
+		"Device.IP.Interface.1.X_ISPAPP_Device":                   "br-lan",
+		"Device.Hosts.Host.3.PhysAddress":                         "aa:bb:cc:00:00:02",
+		"Device.Hosts.Host.4.PhysAddress":                         "aa:bb:cc:00:00:05",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := exec.NewFixtureRunner().
+		On("cat /tmp/dhcp.leases", exec.Fixture{Stdout: "4102444800 aa:bb:cc:00:00:01 192.168.1.10 laptop *\n"}).
+		On("cat /proc/net/arp", exec.Fixture{Stdout: `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.10     0x1         0x2         aa:bb:cc:00:00:01     *        br-lan
+192.168.1.12     0x1         0x2         aa:bb:cc:00:00:02     *        br-lan
+`})
+	if err := HostsCollectCmd(runner); err != nil {
+		t.Fatalf("HostsCollectCmd failed: %v", *err)
+	}
+
+	values, err := store.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"HostNumberOfEntries":       "2",
+		"Host.3.PhysAddress":        "aa:bb:cc:00:00:02",
+		"Host.3.IPAddress":          "192.168.1.12",
+		"Host.3.AssociatedDevice":   "Device.WiFi.AccessPoint.1.AssociatedDevice.1.",
+		"Host.3.Layer1Interface":    "Device.WiFi.SSID.1.",
+		"Host.3.Layer3Interface":    "Device.IP.Interface.1.",
+		"Host.3.Active":             "true",
+		"Host.3.LeaseTimeRemaining": "0",
+		"Host.5.PhysAddress":        "aa:bb:cc:00:00:01",
+		"Host.5.HostName":           "laptop",
+		"Host.5.DHCPClient":         "Device.DHCPv4.Server.Pool.1.Client.4.",
+	}
+	for name, want := range expected {
+		if got := values["Device.Hosts."+name]; got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+	if _, ok := values["Device.Hosts.Host.4.PhysAddress"]; ok {
+		t.Error("Expected the host that left to be removed")
+	}
+}
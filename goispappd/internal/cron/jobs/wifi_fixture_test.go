@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+	"github.com/Niceblueman/goispappd/internal/wifi"
+)
+
+// TestWiFiCollectorsWithFixtures replays iw, procfs and wlanconfig output captured on an OpenWrt router
+// over its wireless config
+func TestWiFiCollectorsWithFixtures(t *testing.T) {
+	// The access point has no instance yet, the collector numbers it
+	runner := ucitest.New().
+		Section("wireless", "radio0", "wifi-device", "band", "2g", wifi.RadioInstance, "2").
+		Section("wireless", "default_radio0", "wifi-iface", "device", "radio0", "network", "lan", "mode", "ap",
+			"ssid", "ispapp", "encryption", "psk2", "hidden", "1", wifi.SSIDInstance, "3").
+		On("iw dev", `phy#1
+	Interface phy1-ap0
+		ifindex 10
+		wdev 0x100000002
+		addr 94:83:c4:a0:11:23
+		type AP
+phy#0
+	Interface phy0-ap0
+		ifindex 9
+		wdev 0x2
+		addr 94:83:c4:a0:11:22
+		ssid ispapp
+		type AP
+		channel 6 (2437 MHz), width: 20 MHz, center1: 2437 MHz
+`).
+		On("cat /proc/net/dev", `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+phy0-ap0: 123456     789    1    2    0     0          0         0   654321     987    3    4    0     0       0          0
+`).
+		On("wlanconfig phy0-ap0 list", `ADDR               AID CHAN TXRATE RXRATE RSSI MINRSSI MAXRSSI IDLE  TXSEQ  RXSEQ  CAPS        ACAPS     ERP    STATE MAXRATE(DOT11) HTCAPS ASSOCTIME    IEs   MODE PSMODE
+a4:c3:f0:12:34:56    1    6 144M     130M   -52       0      45    2      0   65535    EPs         0          b              0           AP   Q 00:12:31 RSN WME IEEE80211_MODE_11NG_HT20  0
+`).
+		On("iw dev phy0-ap0 survey dump", `Survey data from phy0-ap0
+	frequency:			2437 MHz [in use]
+	noise:				-95 dBm
+	channel active time:		1000 ms
+	channel busy time:		300 ms
+`)
+
+	ctx := context.Background()
+	backend := wifi.Shell{Runner: runner}
+	interfaces, err := getWiFiInterfaces(ctx, runner, backend, nil)
+	if err != nil {
+		t.Fatalf("getWiFiInterfaces failed: %v", err)
+	}
+	if len(interfaces) != 1 {
+		t.Fatalf("Expected 1 interface, got %d: %+v", len(interfaces), interfaces)
+	}
+	iface := interfaces[0]
+	if iface.Name != "phy0-ap0" || iface.SSID != "ispapp" || !iface.Enable || iface.Status != "Up" {
+		t.Errorf("Unexpected interface: %+v", iface)
+	}
+	if iface.BSSID != "94:83:c4:a0:11:22" {
+		t.Errorf("Expected BSSID from iw info, got %s", iface.BSSID)
+	}
+	if iface.Index != 3 || iface.AccessPoint != 1 || iface.Radio != "Device.WiFi.Radio.2." || !iface.Hidden {
+		t.Errorf("Expected the instances and options of the section, got %+v", iface)
+	}
+	if got := runner.Option("wireless", "default_radio0", wifi.AccessPointInstance); got != "1" {
+		t.Errorf("Expected the access point instance committed, got %q", got)
+	}
+
+	stats, err := getInterfaceStats(ctx, backend, "phy0-ap0")
+	if err != nil {
+		t.Fatalf("getInterfaceStats failed: %v", err)
+	}
+	if stats.BytesReceived != 123456 || stats.PacketsSent != 987 || stats.DiscardPacketsSent != 4 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	history := wifi.NewHistory(time.Hour)
+	devices, err := getAssociatedDevices(ctx, backend, history, "phy0-ap0")
+	if err != nil {
+		t.Fatalf("getAssociatedDevices failed: %v", err)
+	}
+	if len(devices) != 1 || devices[0].MACAddress != "a4:c3:f0:12:34:56" || devices[0].SignalStrength != -52 ||
+		devices[0].TxRate != "144M" || devices[0].RxRate != "130M" || devices[0].LastActivity != 2 {
+		t.Errorf("Unexpected associated devices: %+v", devices)
+	}
+	station := devices[0]
+	if station.LastDataDownlinkRate != 144000 || station.LastDataUplinkRate != 130000 || !station.Active ||
+		station.SignalToNoise != 43 || station.MinSignalStrength != -52 || station.AvgSignalStrength != -52 || station.SignalSamples != 1 {
+		t.Errorf("Expected the rates, the SNR over the surveyed noise and the first sample, got %+v", station)
+	}
+}
@@ -0,0 +1,102 @@
+package cwmp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// digestChallenge holds the parameters of a WWW-Authenticate: Digest challenge,
+// it is kept for the following requests so each one does not cost a 401
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	qop       string
+	algorithm string
+	nc        int
+}
+
+// parseDigestChallenge parses a Digest WWW-Authenticate header, nil when the header is not Digest
+func parseDigestChallenge(header string) *digestChallenge {
+	if !strings.HasPrefix(strings.ToLower(header), "digest ") {
+		return nil
+	}
+	params := map[string]string{}
+	quoted, start := false, len("Digest ")
+	fields := []string{}
+	for i := start; i < len(header); i++ {
+		switch header[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				fields = append(fields, header[start:i])
+				start = i + 1
+			}
+		}
+	}
+	fields = append(fields, header[start:])
+	for _, field := range fields {
+		key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if ok {
+			params[strings.ToLower(key)] = strings.Trim(value, `"`)
+		}
+	}
+
+	challenge := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: params["algorithm"],
+	}
+	// Only qop=auth is supported, auth-int would require hashing the body
+	for _, qop := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(qop) == "auth" {
+			challenge.qop = "auth"
+		}
+	}
+	return challenge
+}
+
+// authorization builds the Authorization header for a request to uri
+func (d *digestChallenge) authorization(username, password, method, uri string) string {
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+	cnonce := make([]byte, 8)
+	rand.Read(cnonce)
+	cnonceHex := hex.EncodeToString(cnonce)
+
+	ha1 := md5Hex(username + ":" + d.realm + ":" + password)
+	if strings.EqualFold(d.algorithm, "MD5-sess") {
+		ha1 = md5Hex(ha1 + ":" + d.nonce + ":" + cnonceHex)
+	}
+	ha2 := md5Hex(method + ":" + uri)
+
+	var response string
+	if d.qop == "" {
+		response = md5Hex(ha1 + ":" + d.nonce + ":" + ha2)
+	} else {
+		response = md5Hex(strings.Join([]string{ha1, d.nonce, nc, cnonceHex, d.qop, ha2}, ":"))
+	}
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, d.realm, d.nonce, uri, response)
+	if d.qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, d.qop, nc, cnonceHex)
+	}
+	if d.opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, d.opaque)
+	}
+	if d.algorithm != "" {
+		header += fmt.Sprintf(`, algorithm=%s`, d.algorithm)
+	}
+	return header
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,10 +7,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/cookiejar"
+	"sync"
 	"time"
 
 	"github.com/Niceblueman/goispappd/device"
 	"github.com/Niceblueman/goispappd/internal/config"
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/tr098"
 	"github.com/Niceblueman/goispappd/soap"
 	"github.com/sirupsen/logrus"
 )
@@ -23,18 +28,52 @@ type CWMPClient struct {
 	Handler    *Handler
 	dataModel  *device.Device
 	Response   *soap.ResponceEnvelope
+	sessionMu  sync.Mutex              // Serializes sessions, only one may be open towards the ACS
+	pendingMu  sync.Mutex              // Guards pending
+	pending    []*soap.RequestEnvelope // CPE requests sent once the next InformResponse arrives
+	digest     *digestChallenge        // Last Digest challenge of the ACS, nil while Basic auth is used
+	runner     exec.Runner             // Runs the collectors, locally unless replaced with SetRunner
+	tr098      *tr098.Translator       // Presents InternetGatewayDevice to the ACS, nil for Device
 }
 
 // NewCWMPClient initializes a new CWMP client
 func NewCWMPClient(config *config.Configuration, logger *logrus.Logger) *CWMPClient {
-	return &CWMPClient{
+	// The ACS may track the session with a cookie, the jar never fails without options
+	jar, _ := cookiejar.New(nil)
+	// The collectors and the handler share one runner, opkg runs of
+	// ChangeDUState may take minutes
+	runner := exec.NewLocalRunner(exec.ExecConfig{Timeout: 5 * time.Minute})
+	c := &CWMPClient{
 		config:     config,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		httpClient: &http.Client{Timeout: 30 * time.Second, Jar: jar},
 		logger:     logger,
 		dataModel:  &device.Device{},
-		Handler:    NewHandler(logger),
 		Response:   soap.NewResponceEnvelope(logger),
+		runner:     runner,
 	}
+	c.Handler = NewHandler(logger, runner, c.diagnosticsOptions()...)
+	c.Handler.client = c
+	if config.RootDataModel == tr098.RootInternetGatewayDevice {
+		c.tr098 = tr098.NewTranslator(c.Handler.params, c.Handler.wanInterfaces)
+		c.Handler.model = c.tr098
+	}
+	return c
+}
+
+// SetRunner replaces the runner used by the collectors, ChangeDUState and the
+// diagnostics, e.g. with an SSHRunner to manage a remote device or a
+// FixtureRunner in tests
+func (c *CWMPClient) SetRunner(runner exec.Runner, opts ...diagnostics.Option) {
+	c.runner = runner
+	c.Handler.setRunner(runner, append(c.diagnosticsOptions(), opts...)...)
+}
+
+// diagnosticsOptions are the diagnostics settings of the configuration
+func (c *CWMPClient) diagnosticsOptions() []diagnostics.Option {
+	if c.config.TraceRouteProbe == "ICMP" {
+		return []diagnostics.Option{diagnostics.WithProber(diagnostics.ICMPProber{})}
+	}
+	return nil
 }
 
 // Initialize sets up the client and loads initial data
@@ -44,37 +83,32 @@ func (c *CWMPClient) Initialize(ctx context.Context) error {
 	return nil
 }
 
+// SendEnvelope posts a CPE message within the current session and handles the ACS reply
 func (c *CWMPClient) SendEnvelope(envelope *soap.RequestEnvelope) error {
 	c.logger.Infof("Sending SOAP envelope: %s", envelope.XMLName.Local)
 	buf, err := xml.MarshalIndent(envelope, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal SOAP envelope: %w", err)
 	}
+	return c.exchange(buf)
+}
 
-	req, err := http.NewRequest("POST", c.config.ACSURL, bytes.NewReader(buf))
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("SOAPAction", "urn:dslforum-org:cwmp-1-2")
-	if c.config.Username != "" && c.config.Password != "" {
-		req.SetBasicAuth(c.config.Username, c.config.Password)
-	}
+// SendEmpty posts an empty body to tell the ACS the CPE has no more requests,
+// the ACS answers with its next RPC or closes the session with 204 No Content
+func (c *CWMPClient) SendEmpty() error {
+	c.logger.Info("Sending empty POST")
+	return c.exchange(nil)
+}
 
-	resp, err := c.httpClient.Do(req)
+// exchange posts body and dispatches the ACS reply, an empty reply ends the session
+func (c *CWMPClient) exchange(body []byte) error {
+	respBody, err := c.post(body)
 	if err != nil {
-		return fmt.Errorf("failed to send SOAP request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-OK status: %s", resp.Status)
+		return err
 	}
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		c.logger.Info("ACS closed the session")
+		return nil
 	}
 	if err := c.Response.Load(respBody, c.logger); err != nil {
 		return fmt.Errorf("failed to load SOAP response: %w", err)
@@ -82,12 +116,58 @@ func (c *CWMPClient) SendEnvelope(envelope *soap.RequestEnvelope) error {
 	return c.Handler.HandleResponse(c.Response)
 }
 
+// post sends body to the ACS and returns the reply body. A Digest challenge is
+// answered once and remembered for the rest of the session.
+func (c *CWMPClient) post(body []byte) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("POST", c.config.ACSURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+		}
+		if len(body) > 0 {
+			req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+			req.Header.Set("SOAPAction", "urn:dslforum-org:cwmp-1-2")
+		}
+		if c.config.Username != "" && c.config.Password != "" {
+			if c.digest != nil {
+				req.Header.Set("Authorization", c.digest.authorization(c.config.Username, c.config.Password, req.Method, req.URL.RequestURI()))
+			} else {
+				req.SetBasicAuth(c.config.Username, c.config.Password)
+			}
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send SOAP request: %w", err)
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return respBody, nil
+		case http.StatusNoContent:
+			return nil, nil
+		case http.StatusUnauthorized:
+			challenge := parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+			if attempt == 0 && challenge != nil && c.config.Username != "" {
+				c.digest = challenge
+				continue
+			}
+		}
+		return nil, fmt.Errorf("received non-OK status: %s", resp.Status)
+	}
+}
+
 // periodicInform sends periodic Inform messages to the ACS
 func (c *CWMPClient) periodicInform(ctx context.Context) {
 	ticker := time.NewTicker(c.config.PeriodicInterval)
 	defer ticker.Stop()
 	// run a cron job to automate data collection every 30s
-	
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -117,41 +197,63 @@ func (c *CWMPClient) periodicInform(ctx context.Context) {
 	}
 }
 
+// QueueRequest schedules a CPE initiated request, e.g. DUStateChangeComplete,
+// to be sent after the InformResponse of the next session
+func (c *CWMPClient) QueueRequest(envelope *soap.RequestEnvelope) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	c.pending = append(c.pending, envelope)
+}
+
+// sendPending sends the queued requests, the ones that could not be sent stay queued
+func (c *CWMPClient) sendPending() error {
+	c.pendingMu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.pendingMu.Unlock()
+
+	for i, envelope := range pending {
+		if err := c.SendEnvelope(envelope); err != nil {
+			c.pendingMu.Lock()
+			c.pending = append(pending[i:], c.pending...)
+			c.pendingMu.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
 // SendInform constructs and sends an Inform message
 func (c *CWMPClient) SendInform(eventCode string) error {
+	return c.SendInformEvents(soap.EventStruct{EventCode: eventCode})
+}
+
+// SendInformEvents opens a session with an Inform carrying the given events
+func (c *CWMPClient) SendInformEvents(events ...soap.EventStruct) error {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+
 	envelope := soap.NewRequestEnvelope()
-	envelope.LoadInformRequest()
+	envelope.LoadInformRequest(c.runner)
+	if c.tr098 != nil {
+		envelope.Body.Inform.ParameterList.Parameters = c.tr098.Values(envelope.Body.Inform.ParameterList.Parameters)
+	}
+	for _, event := range events {
+		envelope.AddEvent(event.EventCode, event.CommandKey)
+	}
 	body, err := xml.MarshalIndent(envelope, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal Inform XML: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.config.ACSURL, bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("SOAPAction", "urn:dslforum-org:cwmp-1-2")
-	if c.config.Username != "" && c.config.Password != "" {
-		req.SetBasicAuth(c.config.Username, c.config.Password)
-	}
-
-	resp, err := c.httpClient.Do(req)
+	respBody, err := c.post(body)
 	if err != nil {
 		return fmt.Errorf("failed to send Inform request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("received non-OK status: %s", resp.Status)
-	}
-
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
-	}
 	c.logger.Infof("Received SOAP response: %s", string(respBody))
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		return fmt.Errorf("ACS closed the session without InformResponse")
+	}
 	if err := c.Response.Load(respBody, c.logger); err != nil {
 		return fmt.Errorf("failed to load SOAP response: %w", err)
 	}
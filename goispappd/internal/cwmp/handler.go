@@ -1,6 +1,25 @@
 package cwmp
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/cellular"
+	"github.com/Niceblueman/goispappd/internal/commands"
+	"github.com/Niceblueman/goispappd/internal/cron/jobs"
+	"github.com/Niceblueman/goispappd/internal/dhcpv4"
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/ethernet"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/firewall"
+	"github.com/Niceblueman/goispappd/internal/ip"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/ppp"
+	"github.com/Niceblueman/goispappd/internal/routing"
+	"github.com/Niceblueman/goispappd/internal/software"
+	"github.com/Niceblueman/goispappd/internal/wifi"
 	"github.com/Niceblueman/goispappd/soap"
 	"github.com/sirupsen/logrus"
 )
@@ -23,19 +42,104 @@ var (
 		"TransferComplete",
 		"AutonomousTransferComplete",
 		"X_Command",
+		"ChangeDUState",
 	}
 )
 
+// dataModel answers the parameter RPCs, the registry itself or its TR-098
+// translation
+type dataModel interface {
+	Get(runner exec.Runner, names []string) ([]soap.ParameterValueStruct, *params.Fault)
+	Set(values []soap.SetParameterValueStruct) []*params.Fault
+	Names(path string, nextLevel bool) ([]soap.ParameterInfoStruct, *params.Fault)
+	AddObject(path string) (int, *params.Fault)
+	DeleteObject(path string) *params.Fault
+}
+
 type Handler struct {
 	// Handle incoming SOAP requests
-	logger *logrus.Logger
-	client *CWMPClient
+	logger      *logrus.Logger
+	client      *CWMPClient
+	software    *software.Manager
+	params      *params.Registry
+	model       dataModel // Root data model presented to the ACS
+	diagnostics *diagnostics.Manager
+	ethernet    *ethernet.Manager
+	ip          *ip.Manager
+	ppp         *ppp.Manager
+	dhcpv4      *dhcpv4.Manager
+	routing     *routing.Manager
+	firewall    *firewall.Manager
+	cellular    *cellular.Manager
+	wifi        *wifi.Manager
 }
 
-// NewHandler initializes a new CWMP handler
-func NewHandler(logger *logrus.Logger) *Handler {
-	return &Handler{
+// NewHandler initializes a new CWMP handler running its commands through runner
+func NewHandler(logger *logrus.Logger, runner exec.Runner, opts ...diagnostics.Option) *Handler {
+	h := &Handler{
 		logger: logger,
+		params: params.NewRegistry(),
+	}
+	h.model = h.params
+	h.setRunner(runner, opts...)
+	return h
+}
+
+// setRunner rebuilds the managers running commands on the device
+func (h *Handler) setRunner(runner exec.Runner, opts ...diagnostics.Option) {
+	h.software = software.NewManager(runner)
+	if h.ethernet == nil {
+		// The link down counters do not depend on the runner and are kept
+		h.ethernet = ethernet.NewManager(ethernet.SysfsReader{})
+		if err := h.ethernet.Start(); err != nil {
+			h.logger.WithError(err).Error("Failed to start the Ethernet link monitor")
+		}
+	}
+	h.ethernet.Register(h.params)
+	h.ip = ip.NewManager(runner)
+	h.ip.Register(h.params)
+	h.ppp = ppp.NewManager(runner)
+	h.ppp.Register(h.params)
+	h.dhcpv4 = dhcpv4.NewManager(runner)
+	h.dhcpv4.Register(h.params)
+	h.routing = routing.NewManager(runner, routing.NetlinkReader{})
+	h.routing.Register(h.params)
+	h.firewall = firewall.NewManager(runner)
+	h.firewall.Register(h.params)
+	h.cellular = cellular.NewManager(runner, cellular.MMCLI{Runner: runner}, cellular.UQMI{Runner: runner}, cellular.AT{})
+	h.cellular.Register(h.params)
+	h.wifi = wifi.NewManager(runner, wifi.NL80211{}, wifi.Shell{Runner: runner})
+	h.wifi.Register(h.params)
+	if h.diagnostics != nil {
+		h.diagnostics.Close()
+	}
+	opts = append([]diagnostics.Option{diagnostics.WithCellScanner(h.cellular), diagnostics.WithWiFiScanner(h.wifi)}, opts...)
+	h.diagnostics = diagnostics.NewManager(runner, h.diagnosticsComplete, opts...)
+	h.diagnostics.Register(h.params)
+	if err := h.diagnostics.Start(); err != nil {
+		h.logger.WithError(err).Error("Failed to start the UDP echo responder")
+	}
+}
+
+// wanInterfaces returns the Device.IP.Interface. references of the wan
+// firewall zone, the TR-098 WANIPConnection table
+func (h *Handler) wanInterfaces() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	refs, err := h.firewall.ZoneInterfaces(ctx, "wan")
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to read the wan zone interfaces")
+	}
+	return refs
+}
+
+// diagnosticsComplete reports finished diagnostics in a new session
+func (h *Handler) diagnosticsComplete() {
+	if h.client == nil {
+		return
+	}
+	if err := h.client.SendInform(diagnostics.EventDiagnosticsComplete); err != nil {
+		h.logger.WithError(err).Error("Failed to send DIAGNOSTICS COMPLETE")
 	}
 }
 
@@ -63,6 +167,8 @@ func (h *Handler) HandleResponse(resp *soap.ResponceEnvelope) error {
 		return h.handleInformResponse(resp.Body.InformResponse)
 	case "RequestXCommand":
 		return h.handleRequestXCommand(resp.Body.RequestXCommand)
+	case "ChangeDUState":
+		return h.handleChangeDUState(resp.Body.ChangeDUState)
 	case "TransferCompleteResponse":
 		return h.handleTransferCompleteResponse(resp.Body.TransferCompleteResponse)
 	case "RequestDownloadResponse":
@@ -90,48 +196,213 @@ func (h *Handler) handleGetRPCMethods(_ *soap.GetRPCMethods) error {
 }
 func (h *Handler) handleGetParameterValues(method *soap.GetParameterValues) error {
 	h.logger.Info("Handling GetParameterValues request")
-	// Implement logic to handle GetParameterValues
-	return nil
+	envelope := soap.NewRequestEnvelope()
+	values, fault := h.model.Get(h.client.runner, method.ParameterNames.Names)
+	if fault != nil {
+		h.logger.WithError(fault).Warn("GetParameterValues rejected")
+		envelope.LoadFault(fault.Code, fault.Message)
+		return h.client.SendEnvelope(envelope)
+	}
+	envelope.LoadGetParameterValuesResponse(values)
+	return h.client.SendEnvelope(envelope)
 }
 func (h *Handler) handleSetParameterValues(method *soap.SetParameterValues) error {
 	h.logger.Info("Handling SetParameterValues request")
-	// Implement logic to handle SetParameterValues
-	return nil
+	envelope := soap.NewRequestEnvelope()
+	if faults := h.model.Set(method.ParameterList.Params); len(faults) > 0 {
+		details := make([]soap.SetParameterValuesFault, 0, len(faults))
+		for _, fault := range faults {
+			h.logger.WithError(fault).Warn("SetParameterValues rejected")
+			details = append(details, soap.SetParameterValuesFault{
+				ParameterName: fault.Name,
+				FaultCode:     fault.Code,
+				FaultString:   fault.Message,
+			})
+		}
+		envelope.LoadSetParameterValuesFault(details)
+		return h.client.SendEnvelope(envelope)
+	}
+	envelope.LoadSetParameterValuesResponse(0, method.ParameterKey)
+	return h.client.SendEnvelope(envelope)
 }
 func (h *Handler) handleDownload(method *soap.Download) error {
 	h.logger.Info("Handling Download request")
 	// Implement logic to handle Download
-	return nil
+	return h.methodNotSupported("Download")
 }
 func (h *Handler) handleReboot(method *soap.Reboot) error {
 	h.logger.Info("Handling Reboot request")
 	// Implement logic to handle Reboot
-	return nil
+	return h.methodNotSupported("Reboot")
 }
 func (h *Handler) handleFactoryReset(method *soap.FactoryReset) error {
 	h.logger.Info("Handling FactoryReset request")
 	// Implement logic to handle FactoryReset
-	return nil
+	return h.methodNotSupported("FactoryReset")
 }
 func (h *Handler) handleAddObject(method *soap.AddObject) error {
-	h.logger.Info("Handling AddObject request")
-	// Implement logic to handle AddObject
-	return nil
+	h.logger.WithField("object", method.ObjectName).Info("Handling AddObject request")
+	envelope := soap.NewRequestEnvelope()
+	instance, fault := h.model.AddObject(method.ObjectName)
+	if fault != nil {
+		h.logger.WithError(fault).Warn("AddObject rejected")
+		envelope.LoadFault(fault.Code, fault.Message)
+		return h.client.SendEnvelope(envelope)
+	}
+	envelope.LoadAddObjectResponse(instance, 0)
+	return h.client.SendEnvelope(envelope)
 }
 func (h *Handler) handleDeleteObject(method *soap.DeleteObject) error {
-	h.logger.Info("Handling DeleteObject request")
-	// Implement logic to handle DeleteObject
-	return nil
+	h.logger.WithField("object", method.ObjectName).Info("Handling DeleteObject request")
+	envelope := soap.NewRequestEnvelope()
+	if fault := h.model.DeleteObject(method.ObjectName); fault != nil {
+		h.logger.WithError(fault).Warn("DeleteObject rejected")
+		envelope.LoadFault(fault.Code, fault.Message)
+		return h.client.SendEnvelope(envelope)
+	}
+	envelope.LoadDeleteObjectResponse(0)
+	return h.client.SendEnvelope(envelope)
 }
 func (h *Handler) handleInformResponse(method *soap.InformResponse) error {
+	if err := h.client.sendPending(); err != nil {
+		return err
+	}
+	// Hand the session over to the ACS
+	return h.client.SendEmpty()
+}
 
-	return nil
+// methodNotSupported answers an ACS request with fault 9000 so the session can go on
+func (h *Handler) methodNotSupported(method string) error {
+	h.logger.Warnf("%s is not supported yet", method)
+	envelope := soap.NewRequestEnvelope()
+	envelope.LoadFault(9000, "Method not supported")
+	return h.client.SendEnvelope(envelope)
 }
+
 func (h *Handler) handleRequestXCommand(method *soap.RequestXCommand) error {
 	h.logger.Info("Handling RequestXCommand request")
-	// Implement logic to handle RequestXCommand
-	return nil
+	audit := h.logger.WithFields(logrus.Fields{
+		"command_key": method.CommandKey,
+		"command":     method.Parameters.Command,
+	})
+
+	envelope := soap.NewRequestEnvelope()
+	result, err := commands.RunXCommand(context.Background(), h.client.config.XCommand, method.Parameters.Command)
+	if err != nil {
+		audit.WithError(err).Warn("X_Command rejected")
+		if errors.Is(err, commands.ErrXCommandDenied) {
+			envelope.LoadFault(9001, "Request denied")
+		} else {
+			envelope.LoadFault(9003, err.Error())
+		}
+		return h.client.SendEnvelope(envelope)
+	}
+
+	audit.WithField("exit_code", result.ExitCode).Info("X_Command executed")
+	envelope.LoadXCommandResponse(method.CommandKey, result)
+	return h.client.SendEnvelope(envelope)
+}
+func (h *Handler) handleChangeDUState(method *soap.ChangeDUState) error {
+	h.logger.WithField("command_key", method.CommandKey).Info("Handling ChangeDUState request")
+	// Operations may take minutes, results are reported in a new session
+	go h.runChangeDUState(method)
+
+	envelope := soap.NewRequestEnvelope()
+	envelope.LoadChangeDUStateResponse()
+	return h.client.SendEnvelope(envelope)
+}
+
+// runChangeDUState applies the operations in the order the ACS sent them and
+// reports the results in that order with DUStateChangeComplete and
+// "11 DU STATE CHANGE COMPLETE"
+func (h *Handler) runChangeDUState(method *soap.ChangeDUState) {
+	ctx := context.Background()
+	results := make([]soap.OpResultStruct, 0, len(method.Operations))
+	names := make([]string, 0, len(method.Operations))
+
+	for _, op := range method.Operations {
+		start := time.Now()
+		var unit *software.DeploymentUnit
+		var err error
+		failedState := "Installed"
+		switch op.Kind() {
+		case soap.InstallOp:
+			failedState = "Failed"
+			unit, err = h.software.Install(ctx, op.URL)
+		case soap.UpdateOp:
+			unit, err = h.software.Update(ctx, op.UUID, op.URL)
+		case soap.UninstallOp:
+			unit, err = h.software.Uninstall(ctx, op.UUID, op.Version)
+		default:
+			failedState = "Failed"
+			err = &software.OpError{Code: software.FaultInvalidArguments, Err: fmt.Errorf("unknown operation type %q", op.Type)}
+		}
+		results, names = h.appendOpResult(results, names, start, unit, op.UUID, failedState, err)
+	}
+
+	// Resolve references against the refreshed tables so they match the store
+	units, err := h.software.ListInstalled(ctx)
+	if err != nil {
+		h.logger.Errorf("Failed to list deployment units: %v", err)
+	}
+	services, err := h.software.ListServices(ctx)
+	if err != nil {
+		h.logger.Warnf("Failed to list execution units: %v", err)
+	}
+	if err := jobs.StoreSoftwareModules(units, services); err != nil {
+		h.logger.Errorf("Failed to store software modules: %v", err)
+	}
+	for i := range results {
+		for _, unit := range units {
+			if unit.Name == names[i] {
+				results[i].DeploymentUnitRef = software.DeploymentUnitRef(units, unit.Name)
+				results[i].ExecutionUnitRefList = software.ExecutionUnitRefList(unit, services)
+			}
+		}
+	}
+
+	envelope := soap.NewRequestEnvelope()
+	envelope.LoadDUStateChangeComplete(method.CommandKey, results)
+	h.client.QueueRequest(envelope)
+	if err := h.client.SendInformEvents(
+		soap.EventStruct{EventCode: "11 DU STATE CHANGE COMPLETE"},
+		soap.EventStruct{EventCode: "M ChangeDUState", CommandKey: method.CommandKey},
+	); err != nil {
+		h.logger.Errorf("Failed to report DU state change: %v", err)
+	}
+}
+
+// appendOpResult records the outcome of one operation, failedState is the
+// CurrentState reported when the operation did not complete
+func (h *Handler) appendOpResult(results []soap.OpResultStruct, names []string, start time.Time, unit *software.DeploymentUnit, uuid, failedState string, err error) ([]soap.OpResultStruct, []string) {
+	result := soap.OpResultStruct{
+		UUID:         uuid,
+		CurrentState: failedState,
+		StartTime:    soap.CWMPTime{Time: start},
+		CompleteTime: soap.CWMPTime{Time: time.Now()},
+	}
+	name := ""
+	if unit != nil {
+		name = unit.Name
+		result.UUID = unit.UUID
+		result.Version = unit.Version
+		result.Resolved = unit.Resolved
+		if err == nil {
+			result.CurrentState = unit.Status
+		}
+	}
+	if err != nil {
+		h.logger.WithField("uuid", uuid).Errorf("ChangeDUState operation failed: %v", err)
+		result.Fault.FaultCode = software.FaultInternalError
+		var opErr *software.OpError
+		if errors.As(err, &opErr) {
+			result.Fault.FaultCode = opErr.Code
+		}
+		result.Fault.FaultString = err.Error()
+	}
+	return append(results, result), append(names, name)
 }
+
 func (h *Handler) handleTransferCompleteResponse(method *soap.TransferCompleteResponse) error {
 	h.logger.Info("Handling TransferCompleteResponse request")
 	// Implement logic to handle TransferCompleteResponse
@@ -158,7 +429,14 @@ func (h *Handler) handleAutonomousTransferComplete(method *soap.AutonomousTransf
 	return nil
 }
 func (h *Handler) handleGetParameterNames(method *soap.GetParameterNames) error {
-	h.logger.Info("Handling GetParameterNames request")
-	// Implement logic to handle GetParameterNames
-	return nil
+	h.logger.WithField("path", method.ParameterPath).Info("Handling GetParameterNames request")
+	envelope := soap.NewRequestEnvelope()
+	parameters, fault := h.model.Names(method.ParameterPath, method.NextLevel)
+	if fault != nil {
+		h.logger.WithError(fault).Warn("GetParameterNames rejected")
+		envelope.LoadFault(fault.Code, fault.Message)
+		return h.client.SendEnvelope(envelope)
+	}
+	envelope.LoadGetParameterNamesResponse(parameters)
+	return h.client.SendEnvelope(envelope)
 }
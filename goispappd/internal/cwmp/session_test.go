@@ -0,0 +1,297 @@
+package cwmp_test
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/acstest"
+	"github.com/Niceblueman/goispappd/internal/config"
+	"github.com/Niceblueman/goispappd/internal/cwmp"
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/software"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestClient(t *testing.T, acsURL, username, password string) *cwmp.CWMPClient {
+	return newRootTestClient(t, acsURL, username, password, "Device")
+}
+
+// newRootTestClient creates a test client presenting the root data model root
+func newRootTestClient(t *testing.T, acsURL, username, password, root string) *cwmp.CWMPClient {
+	store.Path = filepath.Join(t.TempDir(), "tr069")
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client := cwmp.NewCWMPClient(&config.Configuration{
+		ACSURL:           acsURL,
+		Username:         username,
+		Password:         password,
+		PeriodicInterval: time.Minute,
+		RootDataModel:    root,
+		XCommand: config.XCommandConfig{
+			AllowedBinaries: []string{"echo"},
+			Timeout:         5 * time.Second,
+			MaxOutput:       1024,
+		},
+	}, logger)
+	// Keep the Inform collectors off the host running the tests
+	client.SetRunner(exec.NewFixtureRunner())
+	return client
+}
+
+func TestSession(t *testing.T) {
+	t.Run("InformOnly", func(t *testing.T) {
+		acs := acstest.NewServer()
+		defer acs.Close()
+
+		client := newTestClient(t, acs.URL, "", "")
+		if err := client.SendInform("2 PERIODIC"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		if methods := acs.Methods(); !reflect.DeepEqual(methods, []string{"Inform", ""}) {
+			t.Errorf("Expected Inform then empty POST, got %q", methods)
+		}
+		if inform := string(acs.Received("Inform")); !strings.Contains(inform, "<EventCode>2 PERIODIC</EventCode>") {
+			t.Errorf("Expected periodic event in Inform, got %s", inform)
+		}
+	})
+
+	t.Run("ScriptedRPCs", func(t *testing.T) {
+		acs := acstest.NewServer()
+		defer acs.Close()
+		acs.Script(
+			`<cwmp:GetRPCMethods/>`,
+			`<cwmp:RequestX_Command><CommandKey>k1</CommandKey><Parameters><Command>echo hello</Command></Parameters></cwmp:RequestX_Command>`,
+			`<cwmp:RequestX_Command><CommandKey>k2</CommandKey><Parameters><Command>rm -rf /</Command></Parameters></cwmp:RequestX_Command>`,
+			`<cwmp:Reboot><CommandKey>r1</CommandKey></cwmp:Reboot>`,
+		)
+
+		client := newTestClient(t, acs.URL, "", "")
+		if err := client.SendInform("1 BOOT"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		expected := []string{"Inform", "", "GetRPCMethodsResponse", "X_CommandResponse", "Fault", "Fault"}
+		if methods := acs.Methods(); !reflect.DeepEqual(methods, expected) {
+			t.Fatalf("Expected %q, got %q", expected, methods)
+		}
+		exchanges := acs.Exchanges()
+		if last := exchanges[len(exchanges)-1]; last.Status != 204 {
+			t.Errorf("Expected the session to end with 204, got %d", last.Status)
+		}
+		if body := string(exchanges[3].Request); !strings.Contains(body, "<Stdout>hello") || !strings.Contains(body, "<CommandKey>k1</CommandKey>") {
+			t.Errorf("Expected X_Command output, got %s", body)
+		}
+		if body := string(exchanges[4].Request); !strings.Contains(body, "<FaultCode>9001</FaultCode>") {
+			t.Errorf("Expected denied command fault, got %s", body)
+		}
+	})
+
+	t.Run("BasicAuth", func(t *testing.T) {
+		acs := acstest.NewServer(acstest.WithBasicAuth("cpe", "secret"))
+		defer acs.Close()
+
+		if err := newTestClient(t, acs.URL, "cpe", "secret").SendInform("2 PERIODIC"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		if err := newTestClient(t, acs.URL, "cpe", "wrong").SendInform("2 PERIODIC"); err == nil {
+			t.Error("Expected wrong credentials to fail")
+		}
+	})
+
+	t.Run("DigestAuth", func(t *testing.T) {
+		acs := acstest.NewServer(acstest.WithDigestAuth("cpe", "secret"))
+		defer acs.Close()
+		acs.Script(`<cwmp:GetRPCMethods/>`)
+
+		if err := newTestClient(t, acs.URL, "cpe", "secret").SendInform("2 PERIODIC"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		// Only the first request is challenged, the rest reuse the nonce
+		expected := []string{"Inform", "Inform", "", "GetRPCMethodsResponse"}
+		if methods := acs.Methods(); !reflect.DeepEqual(methods, expected) {
+			t.Errorf("Expected %q, got %q", expected, methods)
+		}
+		if err := newTestClient(t, acs.URL, "cpe", "wrong").SendInform("2 PERIODIC"); err == nil {
+			t.Error("Expected wrong credentials to fail")
+		}
+	})
+
+	t.Run("SessionCookie", func(t *testing.T) {
+		acs := acstest.NewServer(acstest.WithSessionCookie())
+		defer acs.Close()
+		acs.Script(`<cwmp:GetRPCMethods/>`)
+
+		if err := newTestClient(t, acs.URL, "", "").SendInform("2 PERIODIC"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		for _, exchange := range acs.Exchanges() {
+			if exchange.Status == 403 {
+				t.Fatalf("Request %q was sent without the session cookie", exchange.Method)
+			}
+		}
+		if acs.Sessions() != 1 {
+			t.Errorf("Expected one session, got %d", acs.Sessions())
+		}
+	})
+	t.Run("DiagnosticsComplete", func(t *testing.T) {
+		acs := acstest.NewServer()
+		defer acs.Close()
+		acs.Script(`<cwmp:SetParameterValues><ParameterList>` +
+			`<ParameterValueStruct><Name>Device.IP.Diagnostics.IPPing.Host</Name><Value>192.0.2.1</Value></ParameterValueStruct>` +
+			`<ParameterValueStruct><Name>Device.IP.Diagnostics.IPPing.NumberOfRepetitions</Name><Value>2</Value></ParameterValueStruct>` +
+			`<ParameterValueStruct><Name>Device.IP.Diagnostics.IPPing.DiagnosticsState</Name><Value>Requested</Value></ParameterValueStruct>` +
+			`</ParameterList><ParameterKey>diag1</ParameterKey></cwmp:SetParameterValues>`)
+
+		client := newTestClient(t, acs.URL, "", "")
+		release := make(chan struct{})
+		client.SetRunner(exec.NewFixtureRunner(), diagnostics.WithPinger(blockingPinger(release)))
+		if err := client.SendInform("2 PERIODIC"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		if body := string(acs.Received("SetParameterValuesResponse")); !strings.Contains(body, "<Status>0</Status>") {
+			t.Fatalf("Expected SetParameterValuesResponse, got %s", body)
+		}
+
+		// The ACS fetches the results in the session opened by the diagnostic
+		acs.Script(`<cwmp:GetParameterValues><ParameterNames><string>Device.IP.Diagnostics.IPPing.</string></ParameterNames></cwmp:GetParameterValues>`)
+		close(release)
+		deadline := time.Now().Add(5 * time.Second)
+		for acs.Received("GetParameterValuesResponse") == nil && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		exchanges := acs.Exchanges()
+		var informs []string
+		for _, exchange := range exchanges {
+			if exchange.Method == "Inform" {
+				informs = append(informs, string(exchange.Request))
+			}
+		}
+		if len(informs) != 2 || !strings.Contains(informs[1], "<EventCode>8 DIAGNOSTICS COMPLETE</EventCode>") {
+			t.Fatalf("Expected a second Inform with 8 DIAGNOSTICS COMPLETE, got %d Informs", len(informs))
+		}
+		body := string(acs.Received("GetParameterValuesResponse"))
+		for _, expected := range []string{
+			"<Name>Device.IP.Diagnostics.IPPing.DiagnosticsState</Name>",
+			">Complete</Value>",
+			"<Name>Device.IP.Diagnostics.IPPing.SuccessCount</Name>",
+			">2</Value>",
+		} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected %s in GetParameterValuesResponse, got %s", expected, body)
+			}
+		}
+	})
+	t.Run("ChangeDUState", func(t *testing.T) {
+		acs := acstest.NewServer()
+		defer acs.Close()
+		// Operations as ACSes send them, one element per operation typed with xsi:type
+		acs.Script(`<cwmp:ChangeDUState>` +
+			`<Operations xsi:type="cwmp:UninstallOpStruct"><UUID>` + software.PackageUUID("htop") + `</UUID><Version></Version><ExecutionEnvRef></ExecutionEnvRef></Operations>` +
+			`<Operations xsi:type="cwmp:InstallOpStruct"><URL>http://acs.example.com/packages/tcpdump_4.99.4-1_mipsel_24kc.ipk</URL><UUID></UUID><Username></Username><Password></Password><ExecutionEnvRef>Device.SoftwareModules.ExecEnv.1.</ExecutionEnvRef></Operations>` +
+			`<Operations xsi:type="cwmp:UpdateOpStruct"><UUID>00000000-0000-5000-8000-000000000000</UUID><Version></Version><URL></URL><Username></Username><Password></Password></Operations>` +
+			`<CommandKey>du1</CommandKey></cwmp:ChangeDUState>`)
+
+		client := newTestClient(t, acs.URL, "", "")
+		client.SetRunner(exec.NewFixtureRunner().
+			On("opkg list-installed", exec.Fixture{Stdout: "htop - 3.2.2-1\n"}).
+			On("opkg remove htop", exec.Fixture{}))
+		if err := client.SendInform("2 PERIODIC"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for acs.Received("DUStateChangeComplete") == nil && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		body := string(acs.Received("DUStateChangeComplete"))
+		if !strings.Contains(body, "<CommandKey>du1</CommandKey>") {
+			t.Fatalf("Expected DUStateChangeComplete for du1, got %s", body)
+		}
+		// The results follow the order of the operations
+		var positions []int
+		for _, expected := range []string{"<CurrentState>Uninstalled</CurrentState>", "<FaultCode>9010</FaultCode>", "<FaultCode>9028</FaultCode>"} {
+			position := strings.Index(body, expected)
+			if position < 0 {
+				t.Fatalf("Expected %s in DUStateChangeComplete, got %s", expected, body)
+			}
+			positions = append(positions, position)
+		}
+		if positions[0] > positions[1] || positions[1] > positions[2] {
+			t.Errorf("Expected uninstall, install then update results, got %s", body)
+		}
+	})
+	t.Run("GetParameterNames", func(t *testing.T) {
+		acs := acstest.NewServer()
+		defer acs.Close()
+		acs.Script(
+			`<cwmp:GetParameterNames><ParameterPath>Device.IP.Diagnostics.IPPing.</ParameterPath><NextLevel>true</NextLevel></cwmp:GetParameterNames>`,
+			`<cwmp:GetParameterNames><ParameterPath>Device.IP.Diagnostics.IPPing.Host</ParameterPath><NextLevel>1</NextLevel></cwmp:GetParameterNames>`,
+		)
+
+		client := newTestClient(t, acs.URL, "", "")
+		if err := client.SendInform("2 PERIODIC"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		expected := []string{"Inform", "", "GetParameterNamesResponse", "Fault"}
+		if methods := acs.Methods(); !reflect.DeepEqual(methods, expected) {
+			t.Fatalf("Expected %q, got %q", expected, methods)
+		}
+		body := string(acs.Received("GetParameterNamesResponse"))
+		if !strings.Contains(body, "<Name>Device.IP.Diagnostics.IPPing.Host</Name>") || !strings.Contains(body, "<Writable>true</Writable>") {
+			t.Errorf("Expected the writable Host parameter, got %s", body)
+		}
+		if strings.Contains(body, "<Name>Device.IP.Diagnostics.IPPing.</Name>") {
+			t.Errorf("Expected only the next level, got %s", body)
+		}
+		if fault := string(acs.Received("Fault")); !strings.Contains(fault, "9003") {
+			t.Errorf("Expected fault 9003 for NextLevel on a parameter, got %s", fault)
+		}
+	})
+
+	t.Run("InternetGatewayDevice", func(t *testing.T) {
+		acs := acstest.NewServer()
+		defer acs.Close()
+		acs.Script(
+			`<cwmp:GetParameterNames><ParameterPath>InternetGatewayDevice.</ParameterPath><NextLevel>true</NextLevel></cwmp:GetParameterNames>`,
+			`<cwmp:GetParameterValues><ParameterNames><string>Device.DeviceInfo.</string></ParameterNames></cwmp:GetParameterValues>`,
+		)
+
+		client := newRootTestClient(t, acs.URL, "", "", "InternetGatewayDevice")
+		if err := client.SendInform("2 PERIODIC"); err != nil {
+			t.Fatalf("SendInform failed: %v", err)
+		}
+		expected := []string{"Inform", "", "GetParameterNamesResponse", "Fault"}
+		if methods := acs.Methods(); !reflect.DeepEqual(methods, expected) {
+			t.Fatalf("Expected %q, got %q", expected, methods)
+		}
+		if inform := string(acs.Received("Inform")); strings.Contains(inform, "<Name>Device.") {
+			t.Errorf("Expected TR-098 names in the Inform, got %s", inform)
+		}
+		body := string(acs.Received("GetParameterNamesResponse"))
+		for _, object := range []string{"InternetGatewayDevice.DeviceInfo.", "InternetGatewayDevice.WANDevice."} {
+			if !strings.Contains(body, "<Name>"+object+"</Name>") {
+				t.Errorf("Expected %s in GetParameterNamesResponse, got %s", object, body)
+			}
+		}
+		if fault := string(acs.Received("Fault")); !strings.Contains(fault, "9005") {
+			t.Errorf("Expected fault 9005 for a TR-181 name, got %s", fault)
+		}
+	})
+}
+
+// blockingPinger answers every echo request in 1ms once release is closed
+type blockingPinger chan struct{}
+
+func (p blockingPinger) Ping(ctx context.Context, _ diagnostics.PingRequest) (time.Duration, error) {
+	select {
+	case <-p:
+		return time.Millisecond, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
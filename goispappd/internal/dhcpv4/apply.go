@@ -0,0 +1,425 @@
+package dhcpv4
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// applyTimeout bounds the uci calls and the dnsmasq reload of one request
+const applyTimeout = 30 * time.Second
+
+// poolParams are the parameters of Device.DHCPv4.Server.
+var poolParams = map[string]params.Param{
+	"PoolNumberOfEntries":                                    {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"Pool.{i}.Enable":                                        {Type: soap.TR069TypeBoolean, Writable: true},
+	"Pool.{i}.Status":                                        {Type: soap.TR069TypeString},
+	"Pool.{i}.Interface":                                     {Type: soap.TR069TypeString, Writable: true, Check: checkInterface},
+	"Pool.{i}.MinAddress":                                    {Type: soap.TR069TypeString, Writable: true, Check: checkIPv4},
+	"Pool.{i}.MaxAddress":                                    {Type: soap.TR069TypeString, Writable: true, Check: checkIPv4},
+	"Pool.{i}.SubnetMask":                                    {Type: soap.TR069TypeString, Writable: true, Check: checkMask},
+	"Pool.{i}.DNSServers":                                    {Type: soap.TR069TypeString, Writable: true, Check: checkIPv4List},
+	"Pool.{i}.DomainName":                                    {Type: soap.TR069TypeString, Writable: true},
+	"Pool.{i}.IPRouters":                                     {Type: soap.TR069TypeString, Writable: true, Check: checkIPv4List},
+	"Pool.{i}.LeaseTime":                                     {Type: soap.TR069TypeInt, Writable: true, Check: checkLeaseTime},
+	"Pool.{i}.StaticAddressNumberOfEntries":                  {Type: soap.TR069TypeUnsignedInt},
+	"Pool.{i}.ClientNumberOfEntries":                         {Type: soap.TR069TypeUnsignedInt},
+	"Pool.{i}.StaticAddress.{i}.Enable":                      {Type: soap.TR069TypeBoolean, Writable: true},
+	"Pool.{i}.StaticAddress.{i}.Chaddr":                      {Type: soap.TR069TypeString, Writable: true, Check: checkMAC},
+	"Pool.{i}.StaticAddress.{i}.Yiaddr":                      {Type: soap.TR069TypeString, Writable: true, Check: checkIPv4},
+	"Pool.{i}.Client.{i}.Chaddr":                             {Type: soap.TR069TypeString},
+	"Pool.{i}.Client.{i}.IPv4AddressNumberOfEntries":         {Type: soap.TR069TypeUnsignedInt},
+	"Pool.{i}.Client.{i}.IPv4Address.{i}.IPAddress":          {Type: soap.TR069TypeString},
+	"Pool.{i}.Client.{i}.IPv4Address.{i}.LeaseTimeRemaining": {Type: soap.TR069TypeDateTime},
+}
+
+func checkIPv4(value string) error {
+	if addr, err := netip.ParseAddr(value); err != nil || !addr.Is4() {
+		return fmt.Errorf("%q is not an IPv4 address", value)
+	}
+	return nil
+}
+
+func checkIPv4List(value string) error {
+	for _, item := range splitList(value) {
+		if err := checkIPv4(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkMask(value string) error {
+	if _, ok := maskBits(value); !ok {
+		return fmt.Errorf("%q is not a netmask", value)
+	}
+	return nil
+}
+
+func checkMAC(value string) error {
+	_, err := net.ParseMAC(value)
+	return err
+}
+
+func checkInterface(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := ucicfg.RefInstance(value, ipInterfaceRef); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkLeaseTime(value string) error {
+	if seconds, err := strconv.Atoi(value); err != nil || seconds < -1 {
+		return fmt.Errorf("%q is not a lease time", value)
+	}
+	return nil
+}
+
+// Register adds Device.DHCPv4.Server. to registry
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{
+		Prefix: Prefix,
+		Params: poolParams,
+		Apply:  m.apply,
+		Commit: m.save,
+		Revert: m.revert,
+		Add:    m.add,
+		Delete: m.delete,
+	})
+}
+
+// commit saves the dhcp config, reloads dnsmasq and refreshes the store
+func (m *Manager) commit(ctx context.Context) error {
+	if err := m.uci.Commit(ctx); err != nil {
+		return err
+	}
+	if _, err := ucicfg.Command(ctx, m.runner, "/etc/init.d/dnsmasq", "reload"); err != nil {
+		return err
+	}
+	return m.collect(ctx)
+}
+
+// save commits the values staged by apply
+func (m *Manager) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	return m.commit(ctx)
+}
+
+// revert discards the values staged by apply
+func (m *Manager) revert() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	m.uci.Restore(ctx)
+}
+
+// stage runs fn on the loaded config, its changes stay in the save directory
+func (m *Manager) stage(fn func(ctx context.Context, cfg *config) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, cfg)
+}
+
+// write stages fn and commits its changes, they are reverted when fn fails
+func (m *Manager) write(fn func(ctx context.Context, cfg *config) error) error {
+	if err := m.stage(fn); err != nil {
+		m.revert()
+		return err
+	}
+	return m.save()
+}
+
+// path splits a name below Prefix into the pool instance, the static address
+// instance (0 for pool parameters) and the parameter
+func path(name string) (pool, static int, param string, err error) {
+	parts := strings.Split(strings.TrimPrefix(name, Prefix), ".")
+	if len(parts) < 3 || parts[0] != "Pool" {
+		return 0, 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	if pool, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	if parts[2] != "StaticAddress" {
+		return pool, 0, strings.Join(parts[2:], "."), nil
+	}
+	if len(parts) < 4 {
+		return 0, 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	if static, err = strconv.Atoi(parts[3]); err != nil {
+		return 0, 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	return pool, static, strings.Join(parts[4:], "."), nil
+}
+
+// apply stages the values of one SetParameterValues request, the registry
+// commits or reverts them with the other objects of the request
+func (m *Manager) apply(values map[string]string) error {
+	return m.stage(func(ctx context.Context, cfg *config) error {
+		return m.applyValues(ctx, cfg, values)
+	})
+}
+
+func (m *Manager) applyValues(ctx context.Context, cfg *config, values map[string]string) error {
+	pools := make(map[*pool]map[string]string)
+	for name, value := range values {
+		index, static, param, err := path(name)
+		if err != nil {
+			return err
+		}
+		p := cfg.findPool(index)
+		if p == nil {
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		if static == 0 {
+			if pools[p] == nil {
+				pools[p] = make(map[string]string)
+			}
+			pools[p][param] = value
+			continue
+		}
+		h := cfg.findHost(index, static)
+		if h == nil {
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		if err := m.applyHost(ctx, h, param, value); err != nil {
+			return err
+		}
+	}
+	for p, changes := range pools {
+		if err := m.applyPool(ctx, cfg, p, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyHost maps a StaticAddress parameter to its host option
+func (m *Manager) applyHost(ctx context.Context, h *host, param, value string) error {
+	switch param {
+	case "Enable":
+		enable := soap.BooleanValues[strings.ToLower(value)]
+		if enable {
+			return m.uci.Set(ctx, h.section, "enable", "")
+		}
+		return m.uci.Set(ctx, h.section, "enable", "0")
+	case "Chaddr":
+		return m.uci.Set(ctx, h.section, "mac", strings.ToLower(value))
+	case "Yiaddr":
+		return m.uci.Set(ctx, h.section, "ip", value)
+	}
+	return nil
+}
+
+// applyPool maps the Pool parameters of one request to the dhcp options, the
+// address range is computed once the interface is known
+func (m *Manager) applyPool(ctx context.Context, cfg *config, p *pool, changes map[string]string) error {
+	if value, ok := changes["Enable"]; ok {
+		enable := soap.BooleanValues[strings.ToLower(value)]
+		ignore := "1"
+		if enable {
+			ignore = ""
+		}
+		if err := m.uci.Set(ctx, p.section, "ignore", ignore); err != nil {
+			return err
+		}
+	}
+	subnet := p.subnet
+	if value, ok := changes["Interface"]; ok {
+		network, err := cfg.interfaceNetwork(value)
+		if err != nil {
+			return err
+		}
+		if err := m.uci.Set(ctx, p.section, "interface", network); err != nil {
+			return err
+		}
+		subnet = netip.Prefix{}
+		if sec := cfg.networkSection(network); sec != nil {
+			_, subnet = interfaceSubnet(sec)
+		}
+	}
+	minAddress, minSet := changes["MinAddress"]
+	maxAddress, maxSet := changes["MaxAddress"]
+	if minSet || maxSet {
+		if !subnet.IsValid() {
+			return fmt.Errorf("pool %d has no interface subnet", p.Index)
+		}
+		min, _ := netip.ParseAddr(valueOr(minAddress, p.MinAddress))
+		max, _ := netip.ParseAddr(valueOr(maxAddress, p.MaxAddress))
+		if !subnet.Contains(min) || !subnet.Contains(max) || max.Less(min) {
+			return fmt.Errorf("range %s-%s is not within %s", min, max, subnet)
+		}
+		base := addrUint32(subnet.Masked().Addr())
+		start := addrUint32(min) - base
+		limit := addrUint32(max) - addrUint32(min) + 1
+		if err := m.uci.Set(ctx, p.section, "start", strconv.FormatUint(uint64(start), 10)); err != nil {
+			return err
+		}
+		if err := m.uci.Set(ctx, p.section, "limit", strconv.FormatUint(uint64(limit), 10)); err != nil {
+			return err
+		}
+	}
+	if value, ok := changes["SubnetMask"]; ok {
+		if err := m.uci.Set(ctx, p.section, "netmask", value); err != nil {
+			return err
+		}
+	}
+	if value, ok := changes["LeaseTime"]; ok {
+		seconds, _ := strconv.Atoi(value)
+		if err := m.uci.Set(ctx, p.section, "leasetime", leaseTime(seconds)); err != nil {
+			return err
+		}
+	}
+
+	options := p.options
+	for param, code := range map[string]string{"IPRouters": optionRouter, "DNSServers": optionDNS, "DomainName": optionDomain} {
+		value, ok := changes[param]
+		if !ok {
+			continue
+		}
+		var kept []string
+		for _, option := range options {
+			if optionCode(option) != code {
+				kept = append(kept, option)
+			}
+		}
+		if items := splitList(value); len(items) > 0 {
+			kept = append(kept, code+","+strings.Join(items, ","))
+		}
+		options = kept
+	}
+	if strings.Join(options, " ") == strings.Join(p.options, " ") {
+		return nil
+	}
+	return m.uci.SetList(ctx, p.section, "dhcp_option", options)
+}
+
+// interfaceNetwork returns the network interface numbered by a
+// Device.IP.Interface.{i}. reference, empty for an empty reference
+func (cfg *config) interfaceNetwork(ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	instance, err := ucicfg.RefInstance(ref, ipInterfaceRef)
+	if err != nil {
+		return "", err
+	}
+	for _, sec := range cfg.network {
+		if sec.SectionType == "interface" && sec.Options[interfaceInstance] == strconv.Itoa(instance) {
+			return sec.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no network interface for %s", ref)
+}
+
+// add creates a disabled Pool or StaticAddress entry
+func (m *Manager) add(name string) (int, error) {
+	var index int
+	err := m.write(func(ctx context.Context, cfg *config) error {
+		var err error
+		index, err = m.addSection(ctx, cfg, name)
+		return err
+	})
+	return index, err
+}
+
+// addSection adds the uci section of a new instance and returns its number
+func (m *Manager) addSection(ctx context.Context, cfg *config, name string) (int, error) {
+	var sectionType string
+	var options [][2]string
+	var index int
+	switch rest := strings.TrimPrefix(name, Prefix); {
+	case rest == "Pool.":
+		sectionType = "dhcp"
+		for _, p := range cfg.pools {
+			index = max(index, p.Index)
+		}
+		index++
+		options = [][2]string{{poolInstance, strconv.Itoa(index)}, {"ignore", "1"}}
+	case strings.HasPrefix(rest, "Pool.") && strings.HasSuffix(rest, ".StaticAddress."):
+		pool, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rest, "Pool."), ".StaticAddress."))
+		if err != nil || cfg.findPool(pool) == nil {
+			return 0, fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		sectionType = "host"
+		for _, h := range cfg.hosts {
+			index = max(index, h.Index)
+		}
+		index++
+		options = [][2]string{{hostInstance, strconv.Itoa(index)}, {hostPool, strconv.Itoa(pool)}, {"enable", "0"}}
+	default:
+		return 0, fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+
+	section, err := m.uci.Add(ctx, sectionType)
+	if err != nil {
+		return 0, err
+	}
+	for _, option := range options {
+		if err := m.uci.Set(ctx, section, option[0], option[1]); err != nil {
+			return 0, err
+		}
+	}
+	return index, nil
+}
+
+// delete removes a Pool with its StaticAddress entries or a single StaticAddress
+func (m *Manager) delete(name string) error {
+	return m.write(func(ctx context.Context, cfg *config) error {
+		return m.deleteSections(ctx, cfg, name)
+	})
+}
+
+// deleteSections removes the uci sections of an instance
+func (m *Manager) deleteSections(ctx context.Context, cfg *config, name string) error {
+	index, static, param, err := path(name + "Enable")
+	if err != nil || param != "Enable" {
+		return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	p := cfg.findPool(index)
+	if p == nil {
+		return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	var sections []string
+	if static == 0 {
+		sections = append(sections, p.section)
+		for _, h := range cfg.hosts {
+			if h.pool == index {
+				sections = append(sections, h.section)
+			}
+		}
+	} else {
+		h := cfg.findHost(index, static)
+		if h == nil {
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		sections = append(sections, h.section)
+	}
+	for _, section := range sections {
+		if err := m.uci.Delete(ctx, section); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,518 @@
+// Package dhcpv4 maps TR-181 Device.DHCPv4.Server to /etc/config/dhcp served
+// by dnsmasq. A Pool is a dhcp section, its StaticAddress entries are the host
+// sections and its Client entries the leases within the interface subnet.
+package dhcpv4
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/hosts"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// Prefix is the object mapped by the package
+const Prefix = "Device.DHCPv4.Server."
+
+// ipInterfaceRef is the prefix of the Interface references
+const ipInterfaceRef = "Device.IP.Interface."
+
+// UCI options numbering the instances, dhcp_pool_instance and ip_int_instance
+// are shared with the tr181 shell scripts
+const (
+	poolInstance      = "dhcp_pool_instance"
+	hostInstance      = "dhcp_host_instance"
+	hostPool          = "dhcp_host_pool"
+	interfaceInstance = "ip_int_instance"
+)
+
+// DHCP option codes of the dhcp_option entries mapped to parameters
+const (
+	optionRouter = "3"
+	optionDNS    = "6"
+	optionDomain = "15"
+)
+
+// optionNames are the dnsmasq names accepted for the mapped option codes
+var optionNames = map[string]string{
+	"option:router":      optionRouter,
+	"option:dns-server":  optionDNS,
+	"option:domain-name": optionDomain,
+}
+
+// OpenWrt defaults of a dhcp section
+const (
+	defaultStart     = 100
+	defaultLimit     = 150
+	defaultLeaseTime = "12h"
+)
+
+// infiniteTime is the TR-181 dateTime of a lease that never expires
+const infiniteTime = "9999-12-31T23:59:59Z"
+
+// Manager reads and writes the DHCPv4 server configuration with uci
+type Manager struct {
+	runner  exec.Runner
+	uci     *ucicfg.Config
+	numbers *ucicfg.Config // Instance numbers, committed apart from the requests
+	mu      sync.Mutex
+}
+
+// NewManager creates a Manager running uci and dnsmasq through runner
+func NewManager(runner exec.Runner) *Manager {
+	c := ucicfg.New(runner, "dhcp", "dhcpv4")
+	return &Manager{runner: runner, uci: c, numbers: c.Numbers()}
+}
+
+// pool is a dhcp section
+type pool struct {
+	device.DHCPv4ServerPool
+	section string
+	subnet  netip.Prefix // Interface subnet, invalid when the interface has no static address
+	options []string     // dhcp_option entries
+}
+
+// host is a host section
+type host struct {
+	device.DHCPv4StaticAddress
+	section string
+	pool    int // Instance of the pool holding the entry, 0 for none
+}
+
+// config is /etc/config/dhcp with its instance numbers
+type config struct {
+	pools   []*pool
+	hosts   []*host
+	network []*uci.Section
+}
+
+// load reads the dhcp and network configs, numbering the sections that have
+// no instance yet
+func (m *Manager) load(ctx context.Context) (*config, error) {
+	sections, err := m.uci.Show(ctx)
+	if err != nil {
+		return nil, err
+	}
+	network, err := ucicfg.Show(ctx, m.runner, "network")
+	if err != nil {
+		return nil, err
+	}
+	cfg := &config{network: network}
+
+	domain := ""
+	for _, sec := range sections {
+		if sec.SectionType == "dnsmasq" && domain == "" {
+			domain = sec.Options["domain"]
+		}
+	}
+	numbered := false
+	nextPool, nextHost := ucicfg.MaxInstance(sections, "dhcp", poolInstance), ucicfg.MaxInstance(sections, "host", hostInstance)
+	for _, sec := range sections {
+		switch sec.SectionType {
+		case "dhcp":
+			index, err := strconv.Atoi(sec.Options[poolInstance])
+			if err != nil {
+				nextPool++
+				index = nextPool
+				if err := m.numbers.Set(ctx, sec.Name, poolInstance, strconv.Itoa(index)); err != nil {
+					return nil, err
+				}
+				numbered = true
+			}
+			cfg.pools = append(cfg.pools, cfg.newPool(sec, index, domain))
+		case "host":
+			index, err := strconv.Atoi(sec.Options[hostInstance])
+			if err != nil {
+				nextHost++
+				index = nextHost
+				if err := m.numbers.Set(ctx, sec.Name, hostInstance, strconv.Itoa(index)); err != nil {
+					return nil, err
+				}
+				numbered = true
+			}
+			pool, _ := strconv.Atoi(sec.Options[hostPool])
+			cfg.hosts = append(cfg.hosts, &host{
+				DHCPv4StaticAddress: device.DHCPv4StaticAddress{
+					Index:  index,
+					Enable: sec.Options["enable"] != "0",
+					Chaddr: strings.ToLower(first(sec.Lists["mac"])),
+					Yiaddr: sec.Options["ip"],
+				},
+				section: sec.Name,
+				pool:    pool,
+			})
+		}
+	}
+
+	// Hosts belong to the pool they were added to, or else to the pool of
+	// their subnet. The link is kept so it survives address changes
+	for _, h := range cfg.hosts {
+		if h.pool != 0 {
+			continue
+		}
+		if p := cfg.poolOf(h.Yiaddr); p != nil {
+			h.pool = p.Index
+			if err := m.numbers.Set(ctx, h.section, hostPool, strconv.Itoa(p.Index)); err != nil {
+				return nil, err
+			}
+			numbered = true
+		}
+	}
+	if numbered {
+		if err := m.numbers.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(cfg.pools, func(i, j int) bool { return cfg.pools[i].Index < cfg.pools[j].Index })
+	sort.Slice(cfg.hosts, func(i, j int) bool { return cfg.hosts[i].Index < cfg.hosts[j].Index })
+	return cfg, nil
+}
+
+// newPool maps a dhcp section to a pool
+func (cfg *config) newPool(sec *uci.Section, index int, domain string) *pool {
+	p := &pool{section: sec.Name, options: sec.Lists["dhcp_option"]}
+	p.Index = index
+	p.Enable = sec.Options["ignore"] != "1"
+	p.LeaseTime = leaseSeconds(valueOr(sec.Options["leasetime"], defaultLeaseTime))
+
+	var address netip.Addr
+	if network := cfg.networkSection(sec.Options["interface"]); network != nil {
+		if instance := network.Options[interfaceInstance]; instance != "" {
+			p.Interface = ipInterfaceRef + instance + "."
+		}
+		address, p.subnet = interfaceSubnet(network)
+	}
+	mask := sec.Options["netmask"]
+	if mask == "" && p.subnet.IsValid() {
+		mask = prefixMask(p.subnet.Bits())
+	}
+	p.SubnetMask = mask
+
+	switch {
+	case !p.Enable:
+		p.Status = "Disabled"
+	case !p.subnet.IsValid():
+		p.Status = "Error_Misconfigured"
+	default:
+		p.Status = "Enabled"
+	}
+	if p.subnet.IsValid() {
+		start, err := strconv.Atoi(valueOr(sec.Options["start"], strconv.Itoa(defaultStart)))
+		if err != nil {
+			start = defaultStart
+		}
+		limit, err := strconv.Atoi(valueOr(sec.Options["limit"], strconv.Itoa(defaultLimit)))
+		if err != nil || limit < 1 {
+			limit = defaultLimit
+		}
+		p.MinAddress = offset(p.subnet.Masked().Addr(), start).String()
+		p.MaxAddress = offset(p.subnet.Masked().Addr(), start+limit-1).String()
+	}
+
+	// dnsmasq offers itself as router and DNS server unless told otherwise
+	p.IPRouters = optionValues(p.options, optionRouter)
+	p.DNSServers = optionValues(p.options, optionDNS)
+	if address.IsValid() {
+		if p.IPRouters == nil {
+			p.IPRouters = []string{address.String()}
+		}
+		if p.DNSServers == nil {
+			p.DNSServers = []string{address.String()}
+		}
+	}
+	p.DomainName = domain
+	if values := optionValues(p.options, optionDomain); len(values) > 0 {
+		p.DomainName = values[0]
+	}
+	return p
+}
+
+// networkSection returns the network interface section called name
+func (cfg *config) networkSection(name string) *uci.Section {
+	for _, sec := range cfg.network {
+		if sec.SectionType == "interface" && sec.Name == name && name != "" {
+			return sec
+		}
+	}
+	return nil
+}
+
+// poolOf returns the pool whose subnet holds address
+func (cfg *config) poolOf(address string) *pool {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return nil
+	}
+	for _, p := range cfg.pools {
+		if p.subnet.IsValid() && p.subnet.Contains(addr) {
+			return p
+		}
+	}
+	return nil
+}
+
+// findPool returns the pool with instance number index
+func (cfg *config) findPool(index int) *pool {
+	for _, p := range cfg.pools {
+		if p.Index == index {
+			return p
+		}
+	}
+	return nil
+}
+
+// findHost returns the static address index of pool
+func (cfg *config) findHost(pool, index int) *host {
+	for _, h := range cfg.hosts {
+		if h.pool == pool && h.Index == index {
+			return h
+		}
+	}
+	return nil
+}
+
+// Pools returns the pools with their static addresses and the clients of the
+// current leases
+func (m *Manager) Pools(ctx context.Context) ([]device.DHCPv4ServerPool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pools(ctx)
+}
+
+func (m *Manager) pools(ctx context.Context) ([]device.DHCPv4ServerPool, error) {
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A missing lease file only means dnsmasq handed out nothing yet
+	leases, _ := ucicfg.Command(ctx, m.runner, "cat", hosts.LeasesPath)
+
+	pools := make([]device.DHCPv4ServerPool, 0, len(cfg.pools))
+	for _, p := range cfg.pools {
+		result := p.DHCPv4ServerPool
+		for _, h := range cfg.hosts {
+			if h.pool == p.Index {
+				result.StaticAddresses = append(result.StaticAddresses, h.DHCPv4StaticAddress)
+			}
+		}
+		for _, lease := range hosts.ParseLeases(leases) {
+			if cfg.poolOf(lease.IPAddress) != p {
+				continue
+			}
+			expires := infiniteTime
+			if !lease.Expires.IsZero() {
+				expires = lease.Expires.UTC().Format(time.RFC3339)
+			}
+			result.Clients = append(result.Clients, device.DHCPv4ServerClient{
+				Index:                      len(result.Clients) + 1,
+				Chaddr:                     lease.PhysAddress,
+				IPv4AddressNumberOfEntries: 1,
+				IPv4Addresses: []device.DHCPv4ClientIPv4Address{{
+					Index:              1,
+					IPAddress:          lease.IPAddress,
+					LeaseTimeRemaining: expires,
+				}},
+			})
+		}
+		result.StaticAddressNumberOfEntries = len(result.StaticAddresses)
+		result.ClientNumberOfEntries = len(result.Clients)
+		pools = append(pools, result)
+	}
+	return pools, nil
+}
+
+// Collect stores the pools in the tr069 store
+func (m *Manager) Collect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.collect(ctx)
+}
+
+func (m *Manager) collect(ctx context.Context) error {
+	pools, err := m.pools(ctx)
+	if err != nil {
+		return err
+	}
+	return store.Replace([]string{Prefix}, Values(pools))
+}
+
+// Values flattens pools into parameters keyed by full name
+func Values(pools []device.DHCPv4ServerPool) map[string]string {
+	values := map[string]string{Prefix + "PoolNumberOfEntries": strconv.Itoa(len(pools))}
+	for _, p := range pools {
+		name := fmt.Sprintf("%sPool.%d.", Prefix, p.Index)
+		values[name+"Enable"] = strconv.FormatBool(p.Enable)
+		values[name+"Status"] = p.Status
+		values[name+"Interface"] = p.Interface
+		values[name+"MinAddress"] = p.MinAddress
+		values[name+"MaxAddress"] = p.MaxAddress
+		values[name+"SubnetMask"] = p.SubnetMask
+		values[name+"DNSServers"] = strings.Join(p.DNSServers, ",")
+		values[name+"DomainName"] = p.DomainName
+		values[name+"IPRouters"] = strings.Join(p.IPRouters, ",")
+		values[name+"LeaseTime"] = strconv.Itoa(p.LeaseTime)
+		values[name+"StaticAddressNumberOfEntries"] = strconv.Itoa(p.StaticAddressNumberOfEntries)
+		values[name+"ClientNumberOfEntries"] = strconv.Itoa(p.ClientNumberOfEntries)
+		for _, static := range p.StaticAddresses {
+			entry := fmt.Sprintf("%sStaticAddress.%d.", name, static.Index)
+			values[entry+"Enable"] = strconv.FormatBool(static.Enable)
+			values[entry+"Chaddr"] = static.Chaddr
+			values[entry+"Yiaddr"] = static.Yiaddr
+		}
+		for _, client := range p.Clients {
+			entry := fmt.Sprintf("%sClient.%d.", name, client.Index)
+			values[entry+"Chaddr"] = client.Chaddr
+			values[entry+"IPv4AddressNumberOfEntries"] = strconv.Itoa(client.IPv4AddressNumberOfEntries)
+			for _, address := range client.IPv4Addresses {
+				values[fmt.Sprintf("%sIPv4Address.%d.IPAddress", entry, address.Index)] = address.IPAddress
+				values[fmt.Sprintf("%sIPv4Address.%d.LeaseTimeRemaining", entry, address.Index)] = address.LeaseTimeRemaining
+			}
+		}
+	}
+	return values
+}
+
+// interfaceSubnet returns the static address and subnet of a network
+// interface, ipaddr is either an address with netmask or in CIDR notation
+func interfaceSubnet(network *uci.Section) (netip.Addr, netip.Prefix) {
+	value := first(network.Lists["ipaddr"])
+	if prefix, err := netip.ParsePrefix(value); err == nil && prefix.Addr().Is4() {
+		return prefix.Addr(), prefix
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil || !addr.Is4() {
+		return netip.Addr{}, netip.Prefix{}
+	}
+	bits, ok := maskBits(network.Options["netmask"])
+	if !ok {
+		return netip.Addr{}, netip.Prefix{}
+	}
+	return addr, netip.PrefixFrom(addr, bits)
+}
+
+// maskBits returns the prefix length of a dotted netmask
+func maskBits(mask string) (int, bool) {
+	addr, err := netip.ParseAddr(mask)
+	if err != nil || !addr.Is4() {
+		return 0, false
+	}
+	bits := addrUint32(addr)
+	ones := 0
+	for bits&0x80000000 != 0 {
+		ones++
+		bits <<= 1
+	}
+	return ones, bits == 0
+}
+
+// prefixMask returns the dotted netmask of a prefix length
+func prefixMask(bits int) string {
+	return netip.AddrFrom4(uint32Bytes(^uint32(0) << (32 - bits))).String()
+}
+
+// offset returns base plus n
+func offset(base netip.Addr, n int) netip.Addr {
+	return netip.AddrFrom4(uint32Bytes(addrUint32(base) + uint32(n)))
+}
+
+func addrUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
+
+func uint32Bytes(v uint32) [4]byte {
+	return [4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// leaseSeconds converts a dnsmasq lease time such as 12h, 1d2h or 3600 to
+// seconds, -1 for infinite
+func leaseSeconds(value string) int {
+	if value == "infinite" {
+		return -1
+	}
+	units := map[byte]int{'w': 7 * 24 * 3600, 'd': 24 * 3600, 'h': 3600, 'm': 60, 's': 1}
+	total, number := 0, 0
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= '0' && c <= '9':
+			number = number*10 + int(c-'0')
+		case units[c] != 0:
+			total += number * units[c]
+			number = 0
+		default:
+			return 0
+		}
+	}
+	return total + number
+}
+
+// leaseTime formats seconds as a dnsmasq lease time
+func leaseTime(seconds int) string {
+	switch {
+	case seconds < 0:
+		return "infinite"
+	case seconds%3600 == 0 && seconds > 0:
+		return fmt.Sprintf("%dh", seconds/3600)
+	case seconds%60 == 0 && seconds > 0:
+		return fmt.Sprintf("%dm", seconds/60)
+	}
+	return strconv.Itoa(seconds)
+}
+
+// optionValues returns the values of the dhcp_option entries with code, nil
+// when there is none
+func optionValues(options []string, code string) []string {
+	var values []string
+	for _, option := range options {
+		if optionCode(option) == code {
+			_, rest, _ := strings.Cut(option, ",")
+			values = append(values, splitList(rest)...)
+		}
+	}
+	return values
+}
+
+// optionCode returns the numeric code of a dhcp_option entry
+func optionCode(option string) string {
+	code, _, _ := strings.Cut(option, ",")
+	if numeric, ok := optionNames[code]; ok {
+		return numeric
+	}
+	return code
+}
+
+// splitList splits a comma separated list, skipping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
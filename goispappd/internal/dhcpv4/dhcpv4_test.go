@@ -0,0 +1,220 @@
+package dhcpv4_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/dhcpv4"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+)
+
+// newFakeUCI emulates uci over dhcp and network configs holding a lan and a
+// guest pool, with a dnsmasq leases file
+func newFakeUCI() *ucitest.UCI {
+	return ucitest.New().
+		Section("network", "lan", "interface", "proto", "static", "ipaddr", "192.168.1.1", "netmask", "255.255.255.0", "ip_int_instance", "1").
+		Section("network", "guest", "interface", "proto", "static", "ipaddr", "10.0.0.1/24", "ip_int_instance", "2").
+		Section("network", "wan", "interface", "proto", "dhcp").
+		Section("dhcp", "cfg01411c", "dnsmasq", "domain", "lan").
+		Section("dhcp", "lan", "dhcp", "interface", "lan", "start", "100", "limit", "150", "leasetime", "12h").
+		Section("dhcp", "wan", "dhcp", "interface", "wan", "ignore", "1").
+		Section("dhcp", "cfg02", "host", "name", "printer", "mac", "AA:BB:CC:00:00:10", "ip", "192.168.1.10").
+		List("dhcp", "lan", "dhcp_option", "6,1.1.1.1,8.8.8.8", "option:domain-name,home.arpa").
+		On("cat /tmp/dhcp.leases", "1700003600 aa:bb:cc:00:00:01 192.168.1.120 laptop *\n0 aa:bb:cc:00:00:10 192.168.1.10 printer *\n").
+		On("/etc/init.d/dnsmasq reload", "")
+}
+
+func newRegistry(t *testing.T) (*ucitest.UCI, *params.Registry) {
+	t.Helper()
+	ucitest.UseStore(t)
+	uci := newFakeUCI()
+	registry := params.NewRegistry()
+	dhcpv4.NewManager(uci).Register(registry)
+	return uci, registry
+}
+
+func TestPools(t *testing.T) {
+	uci := newFakeUCI()
+	pools, err := dhcpv4.NewManager(uci).Pools(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools, got %+v", pools)
+	}
+	lan, wan := pools[0], pools[1]
+	if lan.Index != 1 || lan.Status != "Enabled" || lan.Interface != "Device.IP.Interface.1." {
+		t.Errorf("Unexpected lan pool: %+v", lan)
+	}
+	if lan.MinAddress != "192.168.1.100" || lan.MaxAddress != "192.168.1.249" || lan.SubnetMask != "255.255.255.0" || lan.LeaseTime != 43200 {
+		t.Errorf("Unexpected lan range: %s-%s/%s %d", lan.MinAddress, lan.MaxAddress, lan.SubnetMask, lan.LeaseTime)
+	}
+	if !reflect.DeepEqual(lan.DNSServers, []string{"1.1.1.1", "8.8.8.8"}) || !reflect.DeepEqual(lan.IPRouters, []string{"192.168.1.1"}) || lan.DomainName != "home.arpa" {
+		t.Errorf("Unexpected lan options: %v %v %s", lan.DNSServers, lan.IPRouters, lan.DomainName)
+	}
+	if len(lan.StaticAddresses) != 1 || lan.StaticAddresses[0].Chaddr != "aa:bb:cc:00:00:10" || !lan.StaticAddresses[0].Enable {
+		t.Errorf("Expected the printer as static address, got %+v", lan.StaticAddresses)
+	}
+	if lan.ClientNumberOfEntries != 2 || lan.Clients[0].IPv4Addresses[0].LeaseTimeRemaining != "2023-11-14T23:13:20Z" ||
+		lan.Clients[1].IPv4Addresses[0].LeaseTimeRemaining != "9999-12-31T23:59:59Z" {
+		t.Errorf("Unexpected clients: %+v", lan.Clients)
+	}
+	if wan.Index != 2 || wan.Status != "Disabled" || wan.MinAddress != "" {
+		t.Errorf("Unexpected wan pool: %+v", wan)
+	}
+
+	// The numbers given to the sections are kept in the config
+	if uci.Option("dhcp", "lan", "dhcp_pool_instance") != "1" || uci.Option("dhcp", "cfg02", "dhcp_host_instance") != "1" || uci.Option("dhcp", "cfg02", "dhcp_host_pool") != "1" {
+		t.Errorf("Expected the instances to be committed, calls: %v", uci.Calls())
+	}
+	if uci.Count("/etc/init.d/dnsmasq reload") != 0 {
+		t.Error("Expected no dnsmasq reload for reading")
+	}
+}
+
+func TestSet(t *testing.T) {
+	uci, registry := newRegistry(t)
+	faults := registry.Set(ucitest.SetValues(
+		"Device.DHCPv4.Server.Pool.1.MinAddress", "192.168.1.50",
+		"Device.DHCPv4.Server.Pool.1.MaxAddress", "192.168.1.99",
+		"Device.DHCPv4.Server.Pool.1.DNSServers", "9.9.9.9",
+		"Device.DHCPv4.Server.Pool.1.IPRouters", "192.168.1.254",
+		"Device.DHCPv4.Server.Pool.1.LeaseTime", "3600",
+		"Device.DHCPv4.Server.Pool.2.Interface", "Device.IP.Interface.2.",
+		"Device.DHCPv4.Server.Pool.2.Enable", "true",
+	))
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	expected := map[string]string{
+		"lan.start":       "50",
+		"lan.limit":       "50",
+		"lan.leasetime":   "1h",
+		"lan.dhcp_option": "option:domain-name,home.arpa 3,192.168.1.254 6,9.9.9.9",
+		"wan.interface":   "guest",
+		"wan.ignore":      "",
+	}
+	for key, want := range expected {
+		name, option, _ := strings.Cut(key, ".")
+		if got := uci.Option("dhcp", name, option); got != want && !(key == "lan.dhcp_option" && sameItems(got, want)) {
+			t.Errorf("%s: expected %q, got %q", key, want, got)
+		}
+	}
+	if uci.Count("/etc/init.d/dnsmasq reload") != 1 {
+		t.Errorf("Expected one dnsmasq reload, got %d", uci.Count("/etc/init.d/dnsmasq reload"))
+	}
+	if status, _ := store.Get("Device.DHCPv4.Server.Pool.2.Status"); status != "Enabled" {
+		t.Errorf("Expected the store to be refreshed, got status %q", status)
+	}
+	if min, _ := store.Get("Device.DHCPv4.Server.Pool.2.MinAddress"); min != "10.0.0.100" {
+		t.Errorf("Expected the guest range, got %q", min)
+	}
+
+	t.Run("OutOfSubnet", func(t *testing.T) {
+		calls := len(uci.Calls())
+		faults := registry.Set(ucitest.SetValues(
+			"Device.DHCPv4.Server.Pool.1.LeaseTime", "600",
+			"Device.DHCPv4.Server.Pool.1.MinAddress", "192.168.2.10",
+		))
+		if len(faults) != 2 || faults[0].Code != params.FaultInternalError {
+			t.Fatalf("Expected an internal error, got %v", faults)
+		}
+		if got := uci.Option("dhcp", "lan", "leasetime"); got != "1h" {
+			t.Errorf("Expected the request to be reverted, got leasetime %q", got)
+		}
+		if got := uci.Staged("dhcp", "lan", "leasetime"); got != "1h" {
+			t.Errorf("Expected the leasetime to be restored, got %q staged", got)
+		}
+		for _, call := range uci.Calls()[calls:] {
+			if strings.Contains(call, " commit ") {
+				t.Errorf("Expected the failed request to leave the config alone, got %q", call)
+			}
+		}
+	})
+
+	t.Run("UnknownInstance", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues("Device.DHCPv4.Server.Pool.7.Enable", "true"))
+		if len(faults) != 1 || faults[0].Code != params.FaultInvalidName {
+			t.Errorf("Expected an invalid name, got %v", faults)
+		}
+	})
+}
+
+func sameItems(a, b string) bool {
+	x, y := strings.Fields(a), strings.Fields(b)
+	if len(x) != len(y) {
+		return false
+	}
+	seen := map[string]int{}
+	for _, item := range x {
+		seen[item]++
+	}
+	for _, item := range y {
+		if seen[item] == 0 {
+			return false
+		}
+		seen[item]--
+	}
+	return true
+}
+
+func TestAddDeleteObject(t *testing.T) {
+	uci, registry := newRegistry(t)
+
+	instance, fault := registry.AddObject("Device.DHCPv4.Server.Pool.1.StaticAddress.")
+	if fault != nil {
+		t.Fatalf("AddObject failed: %v", fault)
+	}
+	if instance != 2 {
+		t.Errorf("Expected instance 2 after the printer, got %d", instance)
+	}
+	faults := registry.Set(ucitest.SetValues(
+		fmt.Sprintf("Device.DHCPv4.Server.Pool.1.StaticAddress.%d.Chaddr", instance), "AA:BB:CC:00:00:20",
+		fmt.Sprintf("Device.DHCPv4.Server.Pool.1.StaticAddress.%d.Yiaddr", instance), "192.168.1.20",
+		fmt.Sprintf("Device.DHCPv4.Server.Pool.1.StaticAddress.%d.Enable", instance), "1",
+	))
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	if mac := uci.Option("dhcp", "cfg01new", "mac"); mac != "aa:bb:cc:00:00:20" {
+		t.Errorf("Expected the host section to hold the MAC address, got %q", mac)
+	}
+	if enable := uci.Option("dhcp", "cfg01new", "enable"); enable != "" {
+		t.Errorf("Expected the enable option to be removed, got %q", enable)
+	}
+	if count, _ := store.Get("Device.DHCPv4.Server.Pool.1.StaticAddressNumberOfEntries"); count != "2" {
+		t.Errorf("Expected 2 static addresses, got %q", count)
+	}
+
+	pool, fault := registry.AddObject("Device.DHCPv4.Server.Pool.")
+	if fault != nil || pool != 3 {
+		t.Fatalf("Expected pool 3, got %d %v", pool, fault)
+	}
+	if status, _ := store.Get("Device.DHCPv4.Server.Pool.3.Status"); status != "Disabled" {
+		t.Errorf("Expected a new pool to be disabled, got %q", status)
+	}
+
+	if fault := registry.DeleteObject("Device.DHCPv4.Server.Pool.1."); fault != nil {
+		t.Fatalf("DeleteObject failed: %v", fault)
+	}
+	if uci.Exists("dhcp", "lan") || uci.Exists("dhcp", "cfg02") || uci.Exists("dhcp", "cfg01new") {
+		t.Error("Expected the pool to be deleted with its static addresses")
+	}
+	if count, _ := store.Get("Device.DHCPv4.Server.PoolNumberOfEntries"); count != "2" {
+		t.Errorf("Expected 2 pools left, got %q", count)
+	}
+
+	for _, name := range []string{"Device.DHCPv4.Server.Pool.2.Client.", "Device.DHCPv4.Server.Pool.9.StaticAddress.", "Device.Hosts.Host."} {
+		if _, fault := registry.AddObject(name); fault == nil || fault.Code != params.FaultInvalidName {
+			t.Errorf("AddObject %s: expected an invalid name, got %v", name, fault)
+		}
+	}
+	if fault := registry.DeleteObject("Device.DHCPv4.Server.Pool.1."); fault == nil || fault.Code != params.FaultInvalidName {
+		t.Errorf("Expected deleting a deleted pool to fail, got %v", fault)
+	}
+}
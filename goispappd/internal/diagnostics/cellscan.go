@@ -0,0 +1,68 @@
+package diagnostics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const cellDiagnosticsPrefix = "Device.Cellular.X_ISPAPP_CellDiagnostics."
+
+// cellDiagnosticsParams are the parameters of the cell scan
+var cellDiagnosticsParams = map[string]params.Param{
+	"DiagnosticsState":           {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"Interface":                  {Type: soap.TR069TypeString, Writable: true},
+	"Seconds":                    {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "10", Check: params.Range(1, 600)},
+	"ResultNumberOfEntries":      {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"Results.{i}.Band":           {Type: soap.TR069TypeUnsignedInt},
+	"Results.{i}.Fcn":            {Type: soap.TR069TypeUnsignedInt},
+	"Results.{i}.PhysicalCellId": {Type: soap.TR069TypeUnsignedInt},
+	"Results.{i}.RSSI":           {Type: soap.TR069TypeInt},
+	"Results.{i}.RSRP":           {Type: soap.TR069TypeInt},
+	"Results.{i}.RSRQ":           {Type: soap.TR069TypeInt},
+}
+
+// CellScanner measures the cells the modem receives during a scan
+type CellScanner interface {
+	Scan(ctx context.Context, duration time.Duration) ([]device.CellDiagResult, error)
+}
+
+// WithCellScanner sets the modem scanner of the cell diagnostics, they fail
+// with Error_Internal without one
+func WithCellScanner(scanner CellScanner) Option {
+	return func(m *Manager) { m.cells = scanner }
+}
+
+// runCellDiagnostics scans the cells for Seconds and returns them strongest
+// first. The device has a single modem, Interface only documents the request
+func (m *Manager) runCellDiagnostics(ctx context.Context, in map[string]string) map[string]string {
+	if m.cells == nil {
+		return map[string]string{"DiagnosticsState": StateErrorInternal}
+	}
+	seconds, _ := strconv.Atoi(in["Seconds"])
+	cells, err := m.cells.Scan(ctx, time.Duration(seconds)*time.Second)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther, "ResultNumberOfEntries": "0"}
+	}
+	results := map[string]string{
+		"DiagnosticsState":      StateComplete,
+		"ResultNumberOfEntries": strconv.Itoa(len(cells)),
+	}
+	for _, cell := range cells {
+		name := "Results." + strconv.Itoa(cell.Index) + "."
+		results[name+"Band"] = strconv.Itoa(cell.Band)
+		results[name+"Fcn"] = strconv.Itoa(cell.Fcn)
+		results[name+"PhysicalCellId"] = strconv.Itoa(cell.PhysicalCellId)
+		results[name+"RSSI"] = strconv.Itoa(cell.RSSI)
+		results[name+"RSRP"] = strconv.Itoa(cell.RSRP)
+		results[name+"RSRQ"] = strconv.Itoa(cell.RSRQ)
+	}
+	return results
+}
@@ -0,0 +1,73 @@
+package diagnostics_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/store"
+)
+
+// fakeScanner returns scripted cells and records the requested duration
+type fakeScanner struct {
+	cells    []device.CellDiagResult
+	err      error
+	duration time.Duration
+}
+
+func (s *fakeScanner) Scan(_ context.Context, duration time.Duration) ([]device.CellDiagResult, error) {
+	s.duration = duration
+	return s.cells, s.err
+}
+
+func TestCellDiagnostics(t *testing.T) {
+	prefix := "Device.Cellular.X_ISPAPP_CellDiagnostics."
+
+	t.Run("Complete", func(t *testing.T) {
+		scanner := &fakeScanner{cells: []device.CellDiagResult{
+			{Index: 1, Band: 3, Fcn: 1300, PhysicalCellId: 301, RSSI: -66, RSRP: -95, RSRQ: -10},
+			{Index: 2, Band: 20, Fcn: 6300, PhysicalCellId: 17, RSSI: -75, RSRP: -108, RSRQ: -14},
+		}}
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithCellScanner(scanner))
+		set(t, registry,
+			prefix+"Interface", "Device.Cellular.Interface.1.",
+			prefix+"Seconds", "30",
+			prefix+"DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+
+		if scanner.duration != 30*time.Second {
+			t.Errorf("Expected a 30s scan, got %v", scanner.duration)
+		}
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			"DiagnosticsState":         "Complete",
+			"ResultNumberOfEntries":    "2",
+			"Results.1.Band":           "3",
+			"Results.1.RSRP":           "-95",
+			"Results.2.Fcn":            "6300",
+			"Results.2.PhysicalCellId": "17",
+			"Results.2.RSRQ":           "-14",
+		}
+		for name, want := range expected {
+			if got := values[prefix+name]; got != want {
+				t.Errorf("%s: expected %q, got %q", name, want, got)
+			}
+		}
+	})
+
+	t.Run("NoModem", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithCellScanner(&fakeScanner{err: errors.New("no cellular modem")}))
+		set(t, registry, prefix+"DiagnosticsState", "Requested")
+		wait(t, done)
+		if got, _ := store.Get(prefix + "DiagnosticsState"); got != "Error_Other" {
+			t.Errorf("Expected Error_Other, got %q", got)
+		}
+	})
+}
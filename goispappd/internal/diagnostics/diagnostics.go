@@ -0,0 +1,362 @@
+// Package diagnostics runs the TR-181 diagnostics the ACS requests by setting
+// DiagnosticsState to Requested, stores their results in the tr069 store and
+// reports them with the 8 DIAGNOSTICS COMPLETE event.
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/sysinfo"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// DiagnosticsState values
+const (
+	StateNone                       = "None"
+	StateRequested                  = "Requested"
+	StateComplete                   = "Complete"
+	StateErrorCannotResolveHostName = "Error_CannotResolveHostName"
+	StateErrorInternal              = "Error_Internal"
+	StateErrorOther                 = "Error_Other"
+	StateErrorMaxHopCountExceeded   = "Error_MaxHopCountExceeded"
+	StateErrorInitConnectionFailed  = "Error_InitConnectionFailed"
+	StateErrorNoResponse            = "Error_NoResponse"
+	StateErrorTransferFailed        = "Error_TransferFailed"
+	StateErrorDNSServerNotResolved  = "Error_DNSServerNotResolved"
+)
+
+// EventDiagnosticsComplete is the Inform event announcing finished diagnostics
+const EventDiagnosticsComplete = "8 DIAGNOSTICS COMPLETE"
+
+// maxRepetitions bounds NumberOfRepetitions, every repetition may wait for
+// Timeout and keeps the diagnostic running
+const maxRepetitions = 1000
+
+// unsignedInts reads the unsignedInt parameters of a diagnostic, err keeps
+// the first value that is not one
+type unsignedInts struct {
+	in  map[string]string
+	err error
+}
+
+// get parses the value of name as a uint32
+func (u *unsignedInts) get(name string) uint64 {
+	value, err := strconv.ParseUint(u.in[name], 10, 32)
+	if err != nil && u.err == nil {
+		u.err = fmt.Errorf("%s: %w", name, err)
+	}
+	return value
+}
+
+// Resolver looks up host names and addresses, *net.Resolver satisfies it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// diagnostic is a diagnostics object such as Device.IP.Diagnostics.IPPing.
+type diagnostic struct {
+	prefix string
+	params map[string]params.Param
+	tables []string // Result tables rebuilt by each run, relative to prefix
+	// run receives the inputs by relative name and returns the results to store,
+	// DiagnosticsState included
+	run func(ctx context.Context, inputs map[string]string) map[string]string
+}
+
+// Option configures a Manager
+type Option func(*Manager)
+
+// WithPinger replaces the ICMP pinger, e.g. with a fake in tests
+func WithPinger(pinger Pinger) Option {
+	return func(m *Manager) { m.pinger = pinger }
+}
+
+// WithProber replaces the TraceRoute prober
+func WithProber(prober Prober) Option {
+	return func(m *Manager) { m.prober = prober }
+}
+
+// WithResolver replaces the system resolver
+func WithResolver(resolver Resolver) Option {
+	return func(m *Manager) { m.resolver = resolver }
+}
+
+// WithSysinfo reads the interface byte counters with reader instead of the
+// runner
+func WithSysinfo(reader *sysinfo.Reader) Option {
+	return func(m *Manager) { m.sysfs = reader }
+}
+
+// WithDNSPort replaces port 53 of the NSLookup queries, e.g. for a test server
+func WithDNSPort(port int) Option {
+	return func(m *Manager) { m.dnsPort = port }
+}
+
+// Manager runs the requested diagnostics, at most one of each kind at a time
+type Manager struct {
+	runner   exec.Runner // Resolves Interface parameters through uci and ubus
+	notify   func()      // Called once a requested diagnostic finished
+	pinger   Pinger
+	prober   Prober
+	resolver Resolver
+	sysfs    *sysinfo.Reader // Byte counters of this host, nil to read them through runner
+	dnsPort  int
+	mu       sync.Mutex
+	running  map[string]context.CancelFunc // Keyed by object prefix
+	echo     *echoServer                   // UDPEchoConfig responder, nil when disabled
+	cells    CellScanner                   // Modem of the cell diagnostics, nil without
+	radios   WiFiScanner                   // Radios of the neighbour scan, nil without
+}
+
+// NewManager creates a Manager, notify is called after each finished
+// diagnostic and typically sends an Inform with EventDiagnosticsComplete
+func NewManager(runner exec.Runner, notify func(), opts ...Option) *Manager {
+	m := &Manager{
+		runner:   runner,
+		notify:   notify,
+		pinger:   ICMPPinger{},
+		prober:   UDPProber{},
+		resolver: net.DefaultResolver,
+		dnsPort:  53,
+		running:  make(map[string]context.CancelFunc),
+	}
+	if _, local := runner.(*exec.LocalRunner); local {
+		m.sysfs = sysinfo.NewReader("/")
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *Manager) diagnostics() []*diagnostic {
+	return []*diagnostic{
+		{prefix: ipPingPrefix, params: ipPingParams, run: m.runIPPing},
+		{prefix: traceRoutePrefix, params: traceRouteParams, tables: []string{"RouteHops."}, run: m.runTraceRoute},
+		{prefix: downloadPrefix, params: downloadParams, tables: []string{"PerConnectionResult."}, run: m.runDownload},
+		{prefix: uploadPrefix, params: uploadParams, tables: []string{"PerConnectionResult."}, run: m.runUpload},
+		{prefix: udpEchoPrefix, params: udpEchoParams, tables: []string{"IndividualPacketResult."}, run: m.runUDPEcho},
+		{prefix: serverSelectionPrefix, params: serverSelectionParams, run: m.runServerSelection},
+		{prefix: nsLookupPrefix, params: nsLookupParams, tables: []string{"Result."}, run: m.runNSLookup},
+		{prefix: cellDiagnosticsPrefix, params: cellDiagnosticsParams, tables: []string{"Results."}, run: m.runCellDiagnostics},
+		{prefix: neighboringWiFiPrefix, params: neighboringWiFiParams, tables: []string{"Result."}, run: m.runNeighboringWiFi},
+	}
+}
+
+// capabilities are the read-only parameters of Device.IP.Diagnostics.
+var capabilities = map[string]params.Param{
+	"IPv4PingSupported":                {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv6PingSupported":                {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv4TraceRouteSupported":          {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv6TraceRouteSupported":          {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv4DownloadDiagnosticsSupported": {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv6DownloadDiagnosticsSupported": {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv4UploadDiagnosticsSupported":   {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv6UploadDiagnosticsSupported":   {Type: soap.TR069TypeBoolean, Default: "true"},
+	"DownloadTransports":               {Type: soap.TR069TypeString, Default: "HTTP"},
+	"DownloadDiagnosticMaxConnections": {Type: soap.TR069TypeUnsignedInt, Default: strconv.Itoa(maxConnections)},
+	"UploadTransports":                 {Type: soap.TR069TypeString, Default: "HTTP"},
+	"UploadDiagnosticMaxConnections":   {Type: soap.TR069TypeUnsignedInt, Default: strconv.Itoa(maxConnections)},
+	"IPv4UDPEchoDiagnosticsSupported":  {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv6UDPEchoDiagnosticsSupported":  {Type: soap.TR069TypeBoolean, Default: "true"},
+	"UDPEchoDiagnosticsMaxResults":     {Type: soap.TR069TypeUnsignedInt, Default: strconv.Itoa(maxPacketResults)},
+	"IPv4ServerSelectionSupported":     {Type: soap.TR069TypeBoolean, Default: "true"},
+	"IPv6ServerSelectionSupported":     {Type: soap.TR069TypeBoolean, Default: "true"},
+}
+
+// Register adds the diagnostics objects to the parameter registry
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{Prefix: "Device.IP.Diagnostics.", Params: capabilities})
+	registry.Register(&params.Object{
+		Prefix: udpEchoConfigPrefix,
+		Params: udpEchoConfigParams,
+		Apply:  m.applyEchoConfig,
+		Values: m.echoStatistics,
+	})
+	for _, d := range m.diagnostics() {
+		registry.Register(&params.Object{
+			Prefix: d.prefix,
+			Params: d.params,
+			Apply:  m.apply(d),
+		})
+	}
+}
+
+// Start starts the UDP echo responder when UDPEchoConfig is enabled in the store
+func (m *Manager) Start() error {
+	return m.restartEcho()
+}
+
+// Close stops the running diagnostics and the UDP echo responder
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for prefix, cancel := range m.running {
+		cancel()
+		delete(m.running, prefix)
+	}
+	if m.echo != nil {
+		m.echo.close()
+		m.echo = nil
+	}
+}
+
+// apply stores the values set by the ACS and starts the diagnostic when requested
+func (m *Manager) apply(d *diagnostic) func(values map[string]string) error {
+	return func(values map[string]string) error {
+		m.stop(d.prefix)
+		requested := values[d.prefix+"DiagnosticsState"] == StateRequested
+		if !requested {
+			// Changing an input of a finished test discards its results
+			values[d.prefix+"DiagnosticsState"] = StateNone
+		}
+		if err := store.Set(values); err != nil {
+			return err
+		}
+		if requested {
+			m.start(d)
+		}
+		return nil
+	}
+}
+
+// stop cancels the running diagnostic of an object, its results are dropped
+func (m *Manager) stop(prefix string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cancel, ok := m.running[prefix]; ok {
+		cancel()
+		delete(m.running, prefix)
+	}
+}
+
+func (m *Manager) start(d *diagnostic) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.running[d.prefix] = cancel
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		results := d.run(ctx, m.inputs(d))
+
+		m.mu.Lock()
+		if ctx.Err() != nil {
+			// Stopped by a later SetParameterValues
+			m.mu.Unlock()
+			return
+		}
+		delete(m.running, d.prefix)
+		values := make(map[string]string, len(results))
+		for name, value := range results {
+			values[d.prefix+name] = value
+		}
+		tables := make([]string, 0, len(d.tables))
+		for _, table := range d.tables {
+			tables = append(tables, d.prefix+table)
+		}
+		err := store.Replace(tables, values)
+		m.mu.Unlock()
+
+		if err == nil && m.notify != nil {
+			m.notify()
+		}
+	}()
+}
+
+// inputs returns the stored parameters of d by relative name, defaults filled in
+func (m *Manager) inputs(d *diagnostic) map[string]string {
+	stored, _ := store.Values()
+	inputs := make(map[string]string, len(d.params))
+	for name, param := range d.params {
+		if !param.Writable {
+			continue
+		}
+		if value := stored[d.prefix+name]; value != "" {
+			inputs[name] = value
+		} else {
+			inputs[name] = param.Default
+		}
+	}
+	return inputs
+}
+
+// resolve returns the address of host for the ProtocolVersion Any, IPv4 or IPv6
+func (m *Manager) resolve(ctx context.Context, host, version string) (net.IP, error) {
+	addrs := []net.IPAddr{{IP: net.ParseIP(host)}}
+	if addrs[0].IP == nil {
+		var err error
+		if addrs, err = m.resolver.LookupIPAddr(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+	for _, addr := range addrs {
+		isV4 := addr.IP.To4() != nil
+		if version == "IPv4" && !isV4 || version == "IPv6" && isV4 {
+			continue
+		}
+		return addr.IP, nil
+	}
+	return nil, fmt.Errorf("no %s address for %s", version, host)
+}
+
+// device maps the Interface parameter to the Linux device the test is bound
+// to, it accepts a Device.IP.Interface.{i} path, a netifd interface name or a
+// device name
+func (m *Manager) device(ctx context.Context, iface string) (string, error) {
+	if iface == "" {
+		return "", nil
+	}
+	name := iface
+	if rest, ok := strings.CutPrefix(strings.TrimSuffix(iface, "."), "Device.IP.Interface."); ok {
+		index, err := strconv.Atoi(rest)
+		if err != nil || index < 1 {
+			return "", fmt.Errorf("invalid interface %s", iface)
+		}
+		if name, err = m.netifdInterface(ctx, index); err != nil {
+			return "", err
+		}
+	}
+	status, err := m.runner.Execute(ctx, "ubus", "call", "network.interface."+name, "status")
+	if err != nil {
+		// Not a netifd interface, use it as a device name
+		return name, nil
+	}
+	if fields, ok := status.Stdout.(map[string]interface{}); ok {
+		for _, key := range []string{"l3_device", "device"} {
+			if device, ok := fields[key].(string); ok && device != "" {
+				return device, nil
+			}
+		}
+	}
+	return name, nil
+}
+
+// netifdInterface returns the name of the index-th interface section of
+// /etc/config/network, the order Device.IP.Interface.{i} is numbered in
+func (m *Manager) netifdInterface(ctx context.Context, index int) (string, error) {
+	result, err := m.runner.Execute(ctx, "uci", "show", "network")
+	if err != nil {
+		return "", err
+	}
+	count := 0
+	for _, line := range strings.Split(string(result.Raw), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || value != "interface" || strings.Count(key, ".") != 1 {
+			continue
+		}
+		if count++; count == index {
+			return strings.TrimPrefix(key, "network."), nil
+		}
+	}
+	return "", fmt.Errorf("no Device.IP.Interface.%d", index)
+}
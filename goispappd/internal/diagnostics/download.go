@@ -0,0 +1,59 @@
+package diagnostics
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const downloadPrefix = "Device.IP.Diagnostics.DownloadDiagnostics."
+
+// downloadParams are the parameters of Device.IP.Diagnostics.DownloadDiagnostics.
+var downloadParams = map[string]params.Param{
+	"DiagnosticsState":                            {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"Interface":                                   {Type: soap.TR069TypeString, Writable: true},
+	"DownloadURL":                                 {Type: soap.TR069TypeString, Writable: true, Check: checkURL},
+	"DSCP":                                        {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 63)},
+	"EthernetPriority":                            {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 7)},
+	"ProtocolVersion":                             {Type: soap.TR069TypeString, Writable: true, Enum: []string{"Any", "IPv4", "IPv6"}, Default: "Any"},
+	"NumberOfConnections":                         {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "1", Check: params.Range(1, maxConnections)},
+	"EnablePerConnectionResults":                  {Type: soap.TR069TypeBoolean, Writable: true, Default: "false"},
+	"IPAddressUsed":                               {Type: soap.TR069TypeString},
+	"ROMTime":                                     {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"BOMTime":                                     {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"EOMTime":                                     {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"TestBytesReceived":                           {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TotalBytesReceived":                          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TotalBytesSent":                              {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TestBytesReceivedUnderFullLoading":           {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TotalBytesReceivedUnderFullLoading":          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TotalBytesSentUnderFullLoading":              {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"PeriodOfFullLoading":                         {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TCPOpenRequestTime":                          {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"TCPOpenResponseTime":                         {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"PerConnectionResultNumberOfEntries":          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"PerConnectionResult.{i}.ROMTime":             {Type: soap.TR069TypeDateTime},
+	"PerConnectionResult.{i}.BOMTime":             {Type: soap.TR069TypeDateTime},
+	"PerConnectionResult.{i}.EOMTime":             {Type: soap.TR069TypeDateTime},
+	"PerConnectionResult.{i}.TestBytesReceived":   {Type: soap.TR069TypeUnsignedInt},
+	"PerConnectionResult.{i}.TCPOpenRequestTime":  {Type: soap.TR069TypeDateTime},
+	"PerConnectionResult.{i}.TCPOpenResponseTime": {Type: soap.TR069TypeDateTime},
+}
+
+// runDownload fetches DownloadURL over NumberOfConnections parallel HTTP
+// connections and measures the TR-143 timestamps and byte counters
+func (m *Manager) runDownload(ctx context.Context, in map[string]string) map[string]string {
+	result, addr, state := m.runTransfer(ctx, in, in["DownloadURL"], 0)
+	if state != StateComplete {
+		if state == "" {
+			return nil
+		}
+		return map[string]string{"DiagnosticsState": state}
+	}
+	perConnection, _ := strconv.ParseBool(in["EnablePerConnectionResults"])
+	out := transferResults(result, perConnection, func(c *connectionResult) int64 { return c.Received.Load() }, "TestBytesReceived")
+	out["IPAddressUsed"] = addr
+	return out
+}
@@ -0,0 +1,137 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ErrSocket is returned when no ICMP socket can be opened, e.g. without CAP_NET_RAW
+var ErrSocket = errors.New("cannot open ICMP socket")
+
+// PingRequest describes a single echo request
+type PingRequest struct {
+	Addr      net.IP
+	Interface string // Linux device to bind to, empty to follow the routing table
+	DSCP      int
+	Size      int // ICMP payload size in bytes
+	Seq       int
+	Timeout   time.Duration
+}
+
+// Pinger sends one echo request and returns its round trip time
+type Pinger interface {
+	Ping(ctx context.Context, req PingRequest) (time.Duration, error)
+}
+
+// ICMPPinger sends echo requests over raw ICMP sockets and falls back to
+// unprivileged ping sockets when raw sockets are not permitted
+type ICMPPinger struct{}
+
+// Ping opens a socket per request so binding and DSCP can differ between tests
+func (ICMPPinger) Ping(ctx context.Context, req PingRequest) (time.Duration, error) {
+	conn, err := listenICMP(ctx, req.Addr, req.Interface, req.DSCP, true)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	id := os.Getpid() & 0xffff
+	if err := conn.SetDeadline(time.Now().Add(req.Timeout)); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if err := conn.sendEcho(id, req.Seq, req.Size); err != nil {
+		return 0, err
+	}
+	buf := make([]byte, req.Size+1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+		rtt := time.Since(start)
+		reply, err := icmp.ParseMessage(conn.protocol, buf[:n])
+		if err != nil || reply.Type != conn.reply {
+			continue
+		}
+		echo, ok := reply.Body.(*icmp.Echo)
+		if !ok || echo.Seq != req.Seq || conn.raw && echo.ID != id {
+			continue
+		}
+		if !sourceIP(from).Equal(req.Addr) {
+			continue
+		}
+		return rtt, nil
+	}
+}
+
+// icmpConn is an ICMP socket sending echo requests to one address
+type icmpConn struct {
+	net.PacketConn
+	dst      net.Addr
+	v6       bool
+	raw      bool // False for a ping socket, the kernel rewrites its echo identifier
+	protocol int
+	request  icmp.Type
+	reply    icmp.Type
+}
+
+// listenICMP opens a raw ICMP socket for addr, or an unprivileged ping socket
+// when ping is set and raw sockets are not permitted
+func listenICMP(ctx context.Context, addr net.IP, device string, dscp int, ping bool) (*icmpConn, error) {
+	c := &icmpConn{v6: addr.To4() == nil, protocol: 1, request: ipv4.ICMPTypeEcho, reply: ipv4.ICMPTypeEchoReply}
+	network, datagram := "ip4:icmp", "udp4"
+	if c.v6 {
+		network, datagram = "ip6:ipv6-icmp", "udp6"
+		c.protocol, c.request, c.reply = 58, ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	config := net.ListenConfig{Control: socketControl(device, dscp, c.v6)}
+	conn, err := config.ListenPacket(ctx, network, "")
+	c.raw, c.dst = err == nil, &net.IPAddr{IP: addr}
+	if !c.raw {
+		if !ping {
+			return nil, fmt.Errorf("%w: %v", ErrSocket, err)
+		}
+		if conn, err = config.ListenPacket(ctx, datagram, ""); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSocket, err)
+		}
+		c.dst = &net.UDPAddr{IP: addr}
+	}
+	c.PacketConn = conn
+	return c, nil
+}
+
+// sendEcho writes an echo request with size bytes of payload
+func (c *icmpConn) sendEcho(id, seq, size int) error {
+	message := icmp.Message{
+		Type: c.request,
+		Body: &icmp.Echo{ID: id, Seq: seq, Data: make([]byte, size)},
+	}
+	payload, err := message.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.WriteTo(payload, c.dst)
+	return err
+}
+
+func sourceIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.IPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+	return nil
+}
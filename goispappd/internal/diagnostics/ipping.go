@@ -0,0 +1,112 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const ipPingPrefix = "Device.IP.Diagnostics.IPPing."
+
+// ipPingParams are the parameters of Device.IP.Diagnostics.IPPing.
+var ipPingParams = map[string]params.Param{
+	"DiagnosticsState":            {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"Interface":                   {Type: soap.TR069TypeString, Writable: true},
+	"ProtocolVersion":             {Type: soap.TR069TypeString, Writable: true, Enum: []string{"Any", "IPv4", "IPv6"}, Default: "Any"},
+	"Host":                        {Type: soap.TR069TypeString, Writable: true},
+	"NumberOfRepetitions":         {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "3", Check: params.Range(1, maxRepetitions)},
+	"Timeout":                     {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "1000", Check: params.Range(1, 4294967295)},
+	"DataBlockSize":               {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "64", Check: params.Range(1, 65535)},
+	"DSCP":                        {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 63)},
+	"IPAddressUsed":               {Type: soap.TR069TypeString},
+	"SuccessCount":                {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"FailureCount":                {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"AverageResponseTime":         {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"MinimumResponseTime":         {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"MaximumResponseTime":         {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"AverageResponseTimeDetailed": {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"MinimumResponseTimeDetailed": {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"MaximumResponseTimeDetailed": {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+}
+
+// runIPPing sends NumberOfRepetitions echo requests to Host and returns the
+// success count and the response times in milliseconds and microseconds
+func (m *Manager) runIPPing(ctx context.Context, in map[string]string) map[string]string {
+	if in["Host"] == "" {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+	addr, err := m.resolve(ctx, in["Host"], in["ProtocolVersion"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorCannotResolveHostName}
+	}
+	device, err := m.device(ctx, in["Interface"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+	values := unsignedInts{in: in}
+	repetitions := int(values.get("NumberOfRepetitions"))
+	timeout := time.Duration(values.get("Timeout")) * time.Millisecond
+	size := int(values.get("DataBlockSize"))
+	dscp := int(values.get("DSCP"))
+	if values.err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+
+	var times []time.Duration
+	for seq := 1; seq <= repetitions; seq++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		rtt, err := m.pinger.Ping(ctx, PingRequest{
+			Addr:      addr,
+			Interface: device,
+			DSCP:      dscp,
+			Size:      size,
+			Seq:       seq,
+			Timeout:   timeout,
+		})
+		if errors.Is(err, ErrSocket) {
+			return map[string]string{"DiagnosticsState": StateErrorInternal}
+		}
+		if err == nil {
+			times = append(times, rtt)
+		}
+	}
+
+	minimum, average, maximum := responseTimes(times)
+	return map[string]string{
+		"DiagnosticsState":            StateComplete,
+		"IPAddressUsed":               addr.String(),
+		"SuccessCount":                strconv.Itoa(len(times)),
+		"FailureCount":                strconv.Itoa(repetitions - len(times)),
+		"MinimumResponseTime":         strconv.FormatInt(minimum.Milliseconds(), 10),
+		"AverageResponseTime":         strconv.FormatInt(average.Milliseconds(), 10),
+		"MaximumResponseTime":         strconv.FormatInt(maximum.Milliseconds(), 10),
+		"MinimumResponseTimeDetailed": strconv.FormatInt(minimum.Microseconds(), 10),
+		"AverageResponseTimeDetailed": strconv.FormatInt(average.Microseconds(), 10),
+		"MaximumResponseTimeDetailed": strconv.FormatInt(maximum.Microseconds(), 10),
+	}
+}
+
+// responseTimes returns the minimum, average and maximum, all zero without samples
+func responseTimes(times []time.Duration) (minimum, average, maximum time.Duration) {
+	if len(times) == 0 {
+		return 0, 0, 0
+	}
+	var total time.Duration
+	minimum = times[0]
+	for _, rtt := range times {
+		total += rtt
+		if rtt < minimum {
+			minimum = rtt
+		}
+		if rtt > maximum {
+			maximum = rtt
+		}
+	}
+	return minimum, total / time.Duration(len(times)), maximum
+}
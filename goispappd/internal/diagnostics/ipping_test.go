@@ -0,0 +1,215 @@
+package diagnostics_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// fakePinger answers each sequence number with a scripted round trip time,
+// a zero duration is a lost packet
+type fakePinger struct {
+	mu       sync.Mutex
+	times    map[int]time.Duration
+	requests []diagnostics.PingRequest
+}
+
+func (p *fakePinger) Ping(_ context.Context, req diagnostics.PingRequest) (time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	if rtt := p.times[req.Seq]; rtt > 0 {
+		return rtt, nil
+	}
+	return 0, errors.New("i/o timeout")
+}
+
+type fakeResolver map[string][]net.IPAddr
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	if addrs, ok := r[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r fakeResolver) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	for host, addrs := range r {
+		for _, ip := range addrs {
+			if ip.IP.String() == addr {
+				return []string{host + "."}, nil
+			}
+		}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+// newManager points the store to a temp file and returns a registry backed by
+// a Manager signalling done after each finished diagnostic
+func newManager(t *testing.T, pinger diagnostics.Pinger, opts ...diagnostics.Option) (*params.Registry, chan struct{}) {
+	t.Helper()
+	store.Path = filepath.Join(t.TempDir(), "tr069")
+	runner := exec.NewFixtureRunner().
+		On("ubus call network.interface.wan status", exec.Fixture{Stdout: `{"up": true, "device": "eth1", "l3_device": "eth1"}`})
+	resolver := fakeResolver{
+		"acs.example.com": {{IP: net.ParseIP("2001:db8::1")}, {IP: net.ParseIP("192.0.2.10")}},
+		"gw.example.com":  {{IP: net.ParseIP("198.51.100.1")}},
+	}
+
+	done := make(chan struct{}, 1)
+	opts = append([]diagnostics.Option{diagnostics.WithPinger(pinger), diagnostics.WithResolver(resolver)}, opts...)
+	manager := diagnostics.NewManager(runner, func() { done <- struct{}{} }, opts...)
+	registry := params.NewRegistry()
+	manager.Register(registry)
+	return registry, done
+}
+
+func wait(t *testing.T, done chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Diagnostic did not complete")
+	}
+}
+
+func set(t *testing.T, registry *params.Registry, values ...string) {
+	t.Helper()
+	var list []soap.SetParameterValueStruct
+	for i := 0; i < len(values); i += 2 {
+		list = append(list, soap.SetParameterValueStruct{Name: values[i], Value: values[i+1]})
+	}
+	if faults := registry.Set(list); len(faults) > 0 {
+		t.Fatalf("SetParameterValues failed: %v", faults[0])
+	}
+}
+
+func TestIPPing(t *testing.T) {
+	t.Run("Complete", func(t *testing.T) {
+		pinger := &fakePinger{times: map[int]time.Duration{1: 1500 * time.Microsecond, 2: 0, 3: 3200 * time.Microsecond, 4: 2100 * time.Microsecond}}
+		registry, done := newManager(t, pinger)
+		set(t, registry,
+			"Device.IP.Diagnostics.IPPing.Host", "acs.example.com",
+			"Device.IP.Diagnostics.IPPing.ProtocolVersion", "IPv4",
+			"Device.IP.Diagnostics.IPPing.Interface", "wan",
+			"Device.IP.Diagnostics.IPPing.NumberOfRepetitions", "4",
+			"Device.IP.Diagnostics.IPPing.Timeout", "500",
+			"Device.IP.Diagnostics.IPPing.DataBlockSize", "32",
+			"Device.IP.Diagnostics.IPPing.DSCP", "46",
+			"Device.IP.Diagnostics.IPPing.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			"DiagnosticsState":            "Complete",
+			"IPAddressUsed":               "192.0.2.10",
+			"SuccessCount":                "3",
+			"FailureCount":                "1",
+			"MinimumResponseTime":         "1",
+			"AverageResponseTime":         "2",
+			"MaximumResponseTime":         "3",
+			"MinimumResponseTimeDetailed": "1500",
+			"AverageResponseTimeDetailed": "2266",
+			"MaximumResponseTimeDetailed": "3200",
+		}
+		for name, want := range expected {
+			if got := values["Device.IP.Diagnostics.IPPing."+name]; got != want {
+				t.Errorf("%s: expected %q, got %q", name, want, got)
+			}
+		}
+		if len(pinger.requests) != 4 {
+			t.Fatalf("Expected 4 echo requests, got %d", len(pinger.requests))
+		}
+		req := pinger.requests[0]
+		if req.Interface != "eth1" || req.DSCP != 46 || req.Size != 32 || req.Timeout != 500*time.Millisecond {
+			t.Errorf("Unexpected request %+v", req)
+		}
+	})
+
+	t.Run("CannotResolveHostName", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{})
+		set(t, registry,
+			"Device.IP.Diagnostics.IPPing.Host", "unknown.example.com",
+			"Device.IP.Diagnostics.IPPing.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		if state, _ := store.Get("Device.IP.Diagnostics.IPPing.DiagnosticsState"); state != "Error_CannotResolveHostName" {
+			t.Errorf("Expected Error_CannotResolveHostName, got %q", state)
+		}
+	})
+
+	t.Run("InputChangeResetsState", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{times: map[int]time.Duration{1: time.Millisecond}})
+		set(t, registry,
+			"Device.IP.Diagnostics.IPPing.Host", "192.0.2.1",
+			"Device.IP.Diagnostics.IPPing.NumberOfRepetitions", "1",
+			"Device.IP.Diagnostics.IPPing.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		set(t, registry, "Device.IP.Diagnostics.IPPing.Host", "192.0.2.2")
+		if state, _ := store.Get("Device.IP.Diagnostics.IPPing.DiagnosticsState"); state != "None" {
+			t.Errorf("Expected None after changing Host, got %q", state)
+		}
+	})
+
+	t.Run("InvalidValues", func(t *testing.T) {
+		registry, _ := newManager(t, &fakePinger{})
+		faults := registry.Set([]soap.SetParameterValueStruct{
+			{Name: "Device.IP.Diagnostics.IPPing.DSCP", Value: "64"},
+			{Name: "Device.IP.Diagnostics.IPPing.NumberOfRepetitions", Value: "1001"},
+			{Name: "Device.IP.Diagnostics.IPPing.Timeout", Value: "soon"},
+			{Name: "Device.IP.Diagnostics.IPPing.SuccessCount", Value: "1"},
+			{Name: "Device.IP.Diagnostics.IPPing.DiagnosticsState", Value: "Complete"},
+			{Name: "Device.IP.Diagnostics.IPPing.Bogus", Value: "1"},
+		})
+		codes := make([]int, 0, len(faults))
+		for _, fault := range faults {
+			codes = append(codes, fault.Code)
+		}
+		expected := []int{params.FaultInvalidValue, params.FaultInvalidValue, params.FaultInvalidType, params.FaultNotWritable, params.FaultInvalidValue, params.FaultInvalidName}
+		if len(codes) != len(expected) {
+			t.Fatalf("Expected faults %v, got %v", expected, codes)
+		}
+		for i := range expected {
+			if codes[i] != expected[i] {
+				t.Errorf("Expected faults %v, got %v", expected, codes)
+				break
+			}
+		}
+		if _, ok := store.Get("Device.IP.Diagnostics.IPPing.DSCP"); ok {
+			t.Error("A rejected request must not be stored")
+		}
+	})
+}
+
+func TestICMPPingerLoopback(t *testing.T) {
+	rtt, err := diagnostics.ICMPPinger{}.Ping(context.Background(), diagnostics.PingRequest{
+		Addr:    net.ParseIP("127.0.0.1"),
+		Size:    56,
+		Seq:     1,
+		Timeout: time.Second,
+	})
+	if errors.Is(err, diagnostics.ErrSocket) {
+		t.Skipf("ICMP sockets not permitted: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if rtt <= 0 || rtt > time.Second {
+		t.Errorf("Unexpected round trip time %v", rtt)
+	}
+}
@@ -0,0 +1,280 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const nsLookupPrefix = "Device.DNS.Diagnostics.NSLookupDiagnostics."
+
+// Result.{i}.Status values
+const (
+	lookupSuccess               = "Success"
+	lookupDNSServerNotAvailable = "Error_DNSServerNotAvailable"
+	lookupHostNameNotResolved   = "Error_HostNameNotResolved"
+	lookupTimeout               = "Error_Timeout"
+	lookupOther                 = "Error_Other"
+)
+
+// dnsServerReference is the prefix of the DNSServer values naming a client server
+const dnsServerReference = "Device.DNS.Client.Server."
+
+// dnsUDPSize is the receive buffer of UDP answers, larger ones are truncated
+const dnsUDPSize = 1232
+
+// nsLookupParams are the parameters of Device.DNS.Diagnostics.NSLookupDiagnostics.
+var nsLookupParams = map[string]params.Param{
+	"DiagnosticsState":            {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"Interface":                   {Type: soap.TR069TypeString, Writable: true},
+	"HostName":                    {Type: soap.TR069TypeString, Writable: true},
+	"DNSServer":                   {Type: soap.TR069TypeString, Writable: true},
+	"Timeout":                     {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "5000", Check: params.Range(1, 4294967295)},
+	"NumberOfRepetitions":         {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "1", Check: params.Range(1, maxRepetitions)},
+	"SuccessCount":                {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"ResultNumberOfEntries":       {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"Result.{i}.Status":           {Type: soap.TR069TypeString},
+	"Result.{i}.AnswerType":       {Type: soap.TR069TypeString},
+	"Result.{i}.HostNameReturned": {Type: soap.TR069TypeString},
+	"Result.{i}.IPAddresses":      {Type: soap.TR069TypeString},
+	"Result.{i}.DNSServerIP":      {Type: soap.TR069TypeString},
+	"Result.{i}.ResponseTime":     {Type: soap.TR069TypeUnsignedInt},
+}
+
+// lookupResult is the outcome of one repetition
+type lookupResult struct {
+	Status        string
+	Authoritative bool
+	HostName      string
+	Addresses     []string
+	ResponseTime  time.Duration
+}
+
+// runNSLookup resolves HostName NumberOfRepetitions times, querying DNSServer
+// directly for A and AAAA records
+func (m *Manager) runNSLookup(ctx context.Context, in map[string]string) map[string]string {
+	name := strings.TrimSuffix(in["HostName"], ".")
+	values := unsignedInts{in: in}
+	repetitions := int(values.get("NumberOfRepetitions"))
+	timeout := time.Duration(values.get("Timeout")) * time.Millisecond
+	if values.err != nil || name == "" {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+	server, err := m.dnsServer(ctx, in["DNSServer"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorDNSServerNotResolved}
+	}
+	device, err := m.device(ctx, in["Interface"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+
+	out := make(map[string]string)
+	successes := 0
+	for i := 1; i <= repetitions; i++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+		result := m.lookup(ctx, server, device, name, timeout)
+		answerType := "None"
+		if result.Status == lookupSuccess {
+			successes++
+			answerType = "NonAuthoritative"
+			if result.Authoritative {
+				answerType = "Authoritative"
+			}
+		}
+		entry := fmt.Sprintf("Result.%d.", i)
+		out[entry+"Status"] = result.Status
+		out[entry+"AnswerType"] = answerType
+		out[entry+"HostNameReturned"] = result.HostName
+		out[entry+"IPAddresses"] = strings.Join(result.Addresses, ",")
+		out[entry+"DNSServerIP"] = server.String()
+		out[entry+"ResponseTime"] = strconv.FormatInt(result.ResponseTime.Milliseconds(), 10)
+	}
+	out["DiagnosticsState"] = StateComplete
+	out["SuccessCount"] = strconv.Itoa(successes)
+	out["ResultNumberOfEntries"] = strconv.Itoa(repetitions)
+	return out
+}
+
+// dnsServer maps the DNSServer parameter to an address, it accepts an IP
+// address, a host name, a Device.DNS.Client.Server.{i} reference or nothing
+// for the first nameserver of /etc/resolv.conf
+func (m *Manager) dnsServer(ctx context.Context, value string) (net.IP, error) {
+	value = strings.TrimSuffix(value, ".")
+	if strings.HasPrefix(value, dnsServerReference) {
+		stored, ok := store.Get(value + ".DNSServer")
+		if !ok {
+			return nil, fmt.Errorf("no %s", value)
+		}
+		value = stored
+	}
+	if value == "" {
+		servers, err := m.sysfs.Nameservers()
+		if err != nil {
+			return nil, err
+		}
+		if len(servers) == 0 {
+			return nil, fmt.Errorf("no nameserver in resolv.conf")
+		}
+		value = servers[0]
+	}
+	return m.resolve(ctx, value, "Any")
+}
+
+// lookup queries server for the A and AAAA records of name, ResponseTime is
+// the time of the first answer. The A answer stands when the AAAA query fails.
+func (m *Manager) lookup(ctx context.Context, server net.IP, device, name string, timeout time.Duration) lookupResult {
+	result := lookupResult{Status: lookupHostNameNotResolved}
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		start := time.Now()
+		answer, err := m.dnsQuery(ctx, server, device, name, qtype, timeout)
+		if qtype == dnsmessage.TypeA {
+			result.ResponseTime = time.Since(start)
+		}
+		if err != nil && len(result.Addresses) > 0 {
+			// The AAAA query failing does not undo the A answer
+			break
+		}
+		var netErr net.Error
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return lookupResult{Status: lookupDNSServerNotAvailable}
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return lookupResult{Status: lookupTimeout}
+		case err != nil:
+			return lookupResult{Status: lookupOther}
+		}
+		if answer.RCode != dnsmessage.RCodeSuccess {
+			if answer.RCode == dnsmessage.RCodeNameError {
+				break
+			}
+			continue
+		}
+		result.Authoritative = answer.Authoritative
+		hostName, addresses := answerAddresses(answer, name)
+		result.HostName = hostName
+		result.Addresses = append(result.Addresses, addresses...)
+	}
+	if len(result.Addresses) > 0 {
+		result.Status = lookupSuccess
+	} else {
+		result.HostName = ""
+	}
+	return result
+}
+
+// answerAddresses follows the CNAME chain of name and returns the final name
+// with its addresses
+func answerAddresses(answer *dnsmessage.Message, name string) (string, []string) {
+	canonical := strings.ToLower(name + ".")
+	// Bounded in case the chain loops
+	for hops, changed := 0, true; changed && hops < 8; hops++ {
+		changed = false
+		for _, rr := range answer.Answers {
+			if cname, ok := rr.Body.(*dnsmessage.CNAMEResource); ok && strings.EqualFold(rr.Header.Name.String(), canonical) {
+				canonical = strings.ToLower(cname.CNAME.String())
+				changed = true
+			}
+		}
+	}
+	var addresses []string
+	for _, rr := range answer.Answers {
+		if !strings.EqualFold(rr.Header.Name.String(), canonical) {
+			continue
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			addresses = append(addresses, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			addresses = append(addresses, net.IP(body.AAAA[:]).String())
+		}
+	}
+	return strings.TrimSuffix(canonical, "."), addresses
+}
+
+// dnsQuery sends a recursive query over UDP and retries over TCP when the
+// answer is truncated
+func (m *Manager) dnsQuery(ctx context.Context, server net.IP, device, name string, qtype dnsmessage.Type, timeout time.Duration) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, err
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Intn(1 << 16)), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := &net.Dialer{Control: socketControl(device, 0, server.To4() == nil)}
+	address := net.JoinHostPort(server.String(), strconv.Itoa(m.dnsPort))
+
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if _, err := conn.Write(packet); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, dnsUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var answer dnsmessage.Message
+		if answer.Unpack(buf[:n]) != nil || answer.ID != query.ID || !answer.Response {
+			continue
+		}
+		if !answer.Truncated {
+			return &answer, nil
+		}
+		break
+	}
+
+	tcp, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer tcp.Close()
+	tcp.SetDeadline(deadline)
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(packet)))
+	if _, err := tcp.Write(append(framed, packet...)); err != nil {
+		return nil, err
+	}
+	var length uint16
+	if err := binary.Read(tcp, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(tcp, data); err != nil {
+		return nil, err
+	}
+	var answer dnsmessage.Message
+	if err := answer.Unpack(data); err != nil {
+		return nil, err
+	}
+	return &answer, nil
+}
@@ -0,0 +1,218 @@
+package diagnostics_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/sysinfo"
+)
+
+// fakeDNS answers on a loopback port over UDP and TCP, big.example.com only
+// fits over TCP and the AAAA queries of v4only.example.com go unanswered
+type fakeDNS struct {
+	udp net.PacketConn
+	tcp net.Listener
+}
+
+func newFakeDNS(t *testing.T) (*fakeDNS, int) {
+	t.Helper()
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := tcp.Addr().(*net.TCPAddr).Port
+	udp, err := net.ListenPacket("udp", tcp.Addr().String())
+	if err != nil {
+		tcp.Close()
+		t.Skipf("UDP port %d is taken: %v", port, err)
+	}
+	s := &fakeDNS{udp: udp, tcp: tcp}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+	go s.serveUDP()
+	go s.serveTCP()
+	return s, port
+}
+
+func (s *fakeDNS) serveUDP() {
+	buf := make([]byte, 512)
+	for {
+		n, from, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if answer := s.answer(buf[:n], false); answer != nil {
+			s.udp.WriteTo(answer, from)
+		}
+	}
+}
+
+func (s *fakeDNS) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		var length uint16
+		if binary.Read(conn, binary.BigEndian, &length) == nil {
+			query := make([]byte, length)
+			if _, err := io.ReadFull(conn, query); err == nil {
+				answer := s.answer(query, true)
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(answer))), answer...))
+			}
+		}
+		conn.Close()
+	}
+}
+
+func (s *fakeDNS) answer(packet []byte, tcp bool) []byte {
+	var query dnsmessage.Message
+	if query.Unpack(packet) != nil || len(query.Questions) != 1 {
+		return nil
+	}
+	question := query.Questions[0]
+	header := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: 60}
+	answer := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+		Questions: query.Questions,
+	}
+	switch question.Name.String() {
+	case "www.example.com.":
+		answer.Authoritative = true
+		edge := dnsmessage.MustNewName("edge.example.net.")
+		answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.CNAMEResource{CNAME: edge}})
+		header.Name = edge
+		if question.Type == dnsmessage.TypeA {
+			answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 80}}})
+		} else {
+			answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 0x80}}})
+		}
+	case "big.example.com.":
+		if !tcp {
+			answer.Truncated = true
+			break
+		}
+		if question.Type == dnsmessage.TypeA {
+			answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte{198, 51, 100, 7}}})
+		}
+	case "v4only.example.com.":
+		if question.Type != dnsmessage.TypeA {
+			return nil
+		}
+		answer.Answers = append(answer.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: [4]byte{192, 0, 2, 4}}})
+	default:
+		answer.RCode = dnsmessage.RCodeNameError
+	}
+	data, _ := answer.Pack()
+	return data
+}
+
+func TestNSLookup(t *testing.T) {
+	_, port := newFakeDNS(t)
+	lookup := func(t *testing.T, values ...string) map[string]string {
+		t.Helper()
+		root := t.TempDir()
+		os.MkdirAll(filepath.Join(root, "etc"), 0o755)
+		os.WriteFile(filepath.Join(root, "etc/resolv.conf"), []byte("nameserver 127.0.0.1\n"), 0o644)
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithDNSPort(port), diagnostics.WithSysinfo(sysinfo.NewReader(root)))
+		set(t, registry, append(values, "Device.DNS.Diagnostics.NSLookupDiagnostics.DiagnosticsState", "Requested")...)
+		wait(t, done)
+		stored, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := make(map[string]string)
+		for name, value := range stored {
+			result[name[len("Device.DNS.Diagnostics.NSLookupDiagnostics."):]] = value
+		}
+		return result
+	}
+	check := func(t *testing.T, values, expected map[string]string) {
+		t.Helper()
+		for name, want := range expected {
+			if got := values[name]; got != want {
+				t.Errorf("%s: expected %q, got %q", name, want, got)
+			}
+		}
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		values := lookup(t,
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.HostName", "www.example.com",
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.DNSServer", "127.0.0.1",
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.NumberOfRepetitions", "2",
+		)
+		check(t, values, map[string]string{
+			"DiagnosticsState":          "Complete",
+			"SuccessCount":              "2",
+			"ResultNumberOfEntries":     "2",
+			"Result.1.Status":           "Success",
+			"Result.1.AnswerType":       "Authoritative",
+			"Result.1.HostNameReturned": "edge.example.net",
+			"Result.1.IPAddresses":      "192.0.2.80,2001:db8::80",
+			"Result.1.DNSServerIP":      "127.0.0.1",
+			"Result.2.Status":           "Success",
+		})
+	})
+
+	t.Run("HostNameNotResolved", func(t *testing.T) {
+		values := lookup(t, "Device.DNS.Diagnostics.NSLookupDiagnostics.HostName", "missing.example.com")
+		check(t, values, map[string]string{
+			"DiagnosticsState":     "Complete",
+			"SuccessCount":         "0",
+			"Result.1.Status":      "Error_HostNameNotResolved",
+			"Result.1.AnswerType":  "None",
+			"Result.1.DNSServerIP": "127.0.0.1",
+		})
+	})
+
+	t.Run("TruncatedOverTCP", func(t *testing.T) {
+		values := lookup(t, "Device.DNS.Diagnostics.NSLookupDiagnostics.HostName", "big.example.com")
+		check(t, values, map[string]string{
+			"Result.1.Status":      "Success",
+			"Result.1.AnswerType":  "NonAuthoritative",
+			"Result.1.IPAddresses": "198.51.100.7",
+		})
+	})
+
+	t.Run("AAAATimeout", func(t *testing.T) {
+		values := lookup(t,
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.HostName", "v4only.example.com",
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.Timeout", "200",
+		)
+		check(t, values, map[string]string{
+			"SuccessCount":         "1",
+			"Result.1.Status":      "Success",
+			"Result.1.IPAddresses": "192.0.2.4",
+		})
+	})
+
+	t.Run("DNSServerNotResolved", func(t *testing.T) {
+		values := lookup(t,
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.HostName", "www.example.com",
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.DNSServer", "unknown.example.com",
+		)
+		check(t, values, map[string]string{"DiagnosticsState": "Error_DNSServerNotResolved"})
+	})
+
+	t.Run("DNSServerNotAvailable", func(t *testing.T) {
+		values := lookup(t,
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.HostName", "www.example.com",
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.DNSServer", "127.0.0.2",
+			"Device.DNS.Diagnostics.NSLookupDiagnostics.Timeout", "500",
+		)
+		if status := values["Result.1.Status"]; status != "Error_DNSServerNotAvailable" && status != "Error_Timeout" {
+			t.Errorf("Expected Error_DNSServerNotAvailable, got %q", status)
+		}
+	})
+}
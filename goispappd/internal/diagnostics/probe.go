@@ -0,0 +1,224 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// traceRoutePort is the first destination port of the probes, as in traceroute(8)
+const traceRoutePort = 33434
+
+// ProbeRequest describes a single TraceRoute probe
+type ProbeRequest struct {
+	Addr      net.IP
+	Interface string // Linux device to bind to, empty to follow the routing table
+	DSCP      int
+	Size      int // UDP payload size in bytes
+	TTL       int
+	Seq       int // Distinguishes the probes, selects the destination port
+	Timeout   time.Duration
+}
+
+// ProbeReply is the ICMP answer to a probe
+type ProbeReply struct {
+	From    net.IP
+	RTT     time.Duration
+	Code    int  // ICMP code of the answer
+	Reached bool // The destination answered instead of a router on the way
+}
+
+// Prober sends one probe and waits for the ICMP answer
+type Prober interface {
+	Probe(ctx context.Context, req ProbeRequest) (ProbeReply, error)
+}
+
+// UDPProber sends UDP datagrams with a limited TTL and reads the time
+// exceeded and port unreachable answers from a raw ICMP socket
+type UDPProber struct{}
+
+// Probe opens its sockets per probe so binding and DSCP can differ between tests
+func (UDPProber) Probe(ctx context.Context, req ProbeRequest) (ProbeReply, error) {
+	v6 := req.Addr.To4() == nil
+	network, datagram, protocol := "ip4:icmp", "udp4", 1
+	if v6 {
+		network, datagram, protocol = "ip6:ipv6-icmp", "udp6", 58
+	}
+
+	listener, err := (&net.ListenConfig{Control: socketControl(req.Interface, 0, v6)}).ListenPacket(ctx, network, "")
+	if err != nil {
+		return ProbeReply{}, fmt.Errorf("%w: %v", ErrSocket, err)
+	}
+	defer listener.Close()
+	sender, err := (&net.ListenConfig{Control: socketControl(req.Interface, req.DSCP, v6)}).ListenPacket(ctx, datagram, "")
+	if err != nil {
+		return ProbeReply{}, fmt.Errorf("%w: %v", ErrSocket, err)
+	}
+	defer sender.Close()
+	if v6 {
+		err = ipv6.NewPacketConn(sender).SetHopLimit(req.TTL)
+	} else {
+		err = ipv4.NewPacketConn(sender).SetTTL(req.TTL)
+	}
+	if err != nil {
+		return ProbeReply{}, err
+	}
+	stop := context.AfterFunc(ctx, func() { listener.Close() })
+	defer stop()
+
+	srcPort := sender.LocalAddr().(*net.UDPAddr).Port
+	dstPort := traceRoutePort + req.Seq
+	if err := listener.SetReadDeadline(time.Now().Add(req.Timeout)); err != nil {
+		return ProbeReply{}, err
+	}
+	start := time.Now()
+	if _, err := sender.WriteTo(make([]byte, req.Size), &net.UDPAddr{IP: req.Addr, Port: dstPort}); err != nil {
+		return ProbeReply{}, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := listener.ReadFrom(buf)
+		if err != nil {
+			return ProbeReply{}, err
+		}
+		rtt := time.Since(start)
+		message, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil {
+			continue
+		}
+		var quoted []byte
+		reached := false
+		switch body := message.Body.(type) {
+		case *icmp.TimeExceeded:
+			quoted = body.Data
+		case *icmp.DstUnreach:
+			quoted = body.Data
+			// Port unreachable comes from the destination itself
+			reached = message.Type == ipv4.ICMPTypeDestinationUnreachable && message.Code == 3 ||
+				message.Type == ipv6.ICMPTypeDestinationUnreachable && message.Code == 4
+		default:
+			continue
+		}
+		if src, dst, ok := quotedPorts(quoted, v6); !ok || src != srcPort || dst != dstPort {
+			continue
+		}
+		return ProbeReply{
+			From:    sourceIP(from),
+			RTT:     rtt,
+			Code:    message.Code,
+			Reached: reached,
+		}, nil
+	}
+}
+
+// ICMPProber sends echo requests with a limited TTL like traceroute -I, for
+// the paths dropping the UDP probes. It needs a raw ICMP socket to read the
+// time exceeded answers.
+type ICMPProber struct{}
+
+// Probe opens its socket per probe so binding and DSCP can differ between tests
+func (ICMPProber) Probe(ctx context.Context, req ProbeRequest) (ProbeReply, error) {
+	conn, err := listenICMP(ctx, req.Addr, req.Interface, req.DSCP, false)
+	if err != nil {
+		return ProbeReply{}, err
+	}
+	defer conn.Close()
+	if conn.v6 {
+		err = ipv6.NewPacketConn(conn.PacketConn).SetHopLimit(req.TTL)
+	} else {
+		err = ipv4.NewPacketConn(conn.PacketConn).SetTTL(req.TTL)
+	}
+	if err != nil {
+		return ProbeReply{}, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	id := os.Getpid() & 0xffff
+	if err := conn.SetReadDeadline(time.Now().Add(req.Timeout)); err != nil {
+		return ProbeReply{}, err
+	}
+	start := time.Now()
+	if err := conn.sendEcho(id, req.Seq, req.Size); err != nil {
+		return ProbeReply{}, err
+	}
+
+	buf := make([]byte, req.Size+1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return ProbeReply{}, err
+		}
+		rtt := time.Since(start)
+		message, err := icmp.ParseMessage(conn.protocol, buf[:n])
+		if err != nil {
+			continue
+		}
+		var quoted []byte
+		switch body := message.Body.(type) {
+		case *icmp.Echo:
+			if message.Type != conn.reply || body.ID != id || body.Seq != req.Seq || !sourceIP(from).Equal(req.Addr) {
+				continue
+			}
+			return ProbeReply{From: sourceIP(from), RTT: rtt, Reached: true}, nil
+		case *icmp.TimeExceeded:
+			quoted = body.Data
+		case *icmp.DstUnreach:
+			quoted = body.Data
+		default:
+			continue
+		}
+		if echoID, echoSeq, ok := quotedEcho(quoted, conn.v6); !ok || echoID != id || echoSeq != req.Seq {
+			continue
+		}
+		return ProbeReply{
+			From:    sourceIP(from),
+			RTT:     rtt,
+			Code:    message.Code,
+			Reached: sourceIP(from).Equal(req.Addr),
+		}, nil
+	}
+}
+
+// quotedTransport returns what follows the IP header of the datagram quoted
+// in an ICMP error
+func quotedTransport(data []byte, v6 bool) []byte {
+	headerLen := 40
+	if !v6 {
+		if len(data) < 1 {
+			return nil
+		}
+		headerLen = int(data[0]&0x0f) * 4
+	}
+	if len(data) < headerLen {
+		return nil
+	}
+	return data[headerLen:]
+}
+
+// quotedPorts returns the UDP ports of the datagram quoted in an ICMP error
+func quotedPorts(data []byte, v6 bool) (src, dst int, ok bool) {
+	udp := quotedTransport(data, v6)
+	if len(udp) < 4 {
+		return 0, 0, false
+	}
+	return int(binary.BigEndian.Uint16(udp[0:2])), int(binary.BigEndian.Uint16(udp[2:4])), true
+}
+
+// quotedEcho returns the identifier and sequence number of the echo request
+// quoted in an ICMP error
+func quotedEcho(data []byte, v6 bool) (id, seq int, ok bool) {
+	echo := quotedTransport(data, v6)
+	if len(echo) < 8 {
+		return 0, 0, false
+	}
+	return int(binary.BigEndian.Uint16(echo[4:6])), int(binary.BigEndian.Uint16(echo[6:8])), true
+}
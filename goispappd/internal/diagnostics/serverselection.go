@@ -0,0 +1,152 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const serverSelectionPrefix = "Device.IP.Diagnostics.ServerSelectionDiagnostics."
+
+// maxHosts is the size limit of HostList
+const maxHosts = 10
+
+// serverSelectionParams are the parameters of Device.IP.Diagnostics.ServerSelectionDiagnostics.
+var serverSelectionParams = map[string]params.Param{
+	"DiagnosticsState":    {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"Interface":           {Type: soap.TR069TypeString, Writable: true},
+	"ProtocolVersion":     {Type: soap.TR069TypeString, Writable: true, Enum: []string{"Any", "IPv4", "IPv6"}, Default: "Any"},
+	"Protocol":            {Type: soap.TR069TypeString, Writable: true, Enum: []string{"ICMP", "UDP Echo"}, Default: "ICMP"},
+	"HostList":            {Type: soap.TR069TypeString, Writable: true, Check: checkHostList},
+	"Port":                {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 65535)},
+	"NumberOfRepetitions": {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "3", Check: params.Range(1, maxRepetitions)},
+	"Timeout":             {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "1000", Check: params.Range(1, 4294967295)},
+	"FastestHost":         {Type: soap.TR069TypeString},
+	"MinimumResponseTime": {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"AverageResponseTime": {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"MaximumResponseTime": {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"IPAddressUsed":       {Type: soap.TR069TypeString},
+}
+
+// checkHostList accepts up to maxHosts comma separated hosts
+func checkHostList(value string) error {
+	if len(splitList(value)) > maxHosts {
+		return fmt.Errorf("more than %d hosts", maxHosts)
+	}
+	return nil
+}
+
+// splitList splits a TR-069 comma separated list, skipping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// runServerSelection probes every host of HostList with ICMP echo or UDP echo
+// requests and reports the host with the lowest average response time
+func (m *Manager) runServerSelection(ctx context.Context, in map[string]string) map[string]string {
+	hosts := splitList(in["HostList"])
+	values := unsignedInts{in: in}
+	port := int(values.get("Port"))
+	repetitions := int(values.get("NumberOfRepetitions"))
+	timeout := time.Duration(values.get("Timeout")) * time.Millisecond
+	udp := in["Protocol"] == "UDP Echo"
+	if values.err != nil || len(hosts) == 0 || udp && port == 0 {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+	device, err := m.device(ctx, in["Interface"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+
+	var fastest string
+	var fastestAddr net.IP
+	var fastestTimes []time.Duration
+	var fastestAverage time.Duration
+	resolved := false
+	for _, host := range hosts {
+		addr, err := m.resolve(ctx, host, in["ProtocolVersion"])
+		if err != nil {
+			continue
+		}
+		resolved = true
+		var times []time.Duration
+		if udp {
+			times = echoTimes(ctx, addr, port, device, repetitions, timeout)
+		} else {
+			times, err = m.pingTimes(ctx, addr, device, repetitions, timeout)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return map[string]string{"DiagnosticsState": StateErrorInternal}
+		}
+		if len(times) == 0 {
+			continue
+		}
+		if _, average, _ := responseTimes(times); fastest == "" || average < fastestAverage {
+			fastest, fastestAddr, fastestTimes, fastestAverage = host, addr, times, average
+		}
+	}
+	if !resolved {
+		return map[string]string{"DiagnosticsState": StateErrorCannotResolveHostName}
+	}
+	if fastest == "" {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+
+	minimum, average, maximum := responseTimes(fastestTimes)
+	return map[string]string{
+		"DiagnosticsState":    StateComplete,
+		"FastestHost":         fastest,
+		"IPAddressUsed":       fastestAddr.String(),
+		"MinimumResponseTime": strconv.FormatInt(minimum.Microseconds(), 10),
+		"AverageResponseTime": strconv.FormatInt(average.Microseconds(), 10),
+		"MaximumResponseTime": strconv.FormatInt(maximum.Microseconds(), 10),
+	}
+}
+
+// pingTimes returns the round trip times of the answered echo requests
+func (m *Manager) pingTimes(ctx context.Context, addr net.IP, device string, repetitions int, timeout time.Duration) ([]time.Duration, error) {
+	var times []time.Duration
+	for seq := 1; seq <= repetitions && ctx.Err() == nil; seq++ {
+		rtt, err := m.pinger.Ping(ctx, PingRequest{Addr: addr, Interface: device, Size: 64, Seq: seq, Timeout: timeout})
+		if errors.Is(err, ErrSocket) {
+			return nil, err
+		}
+		if err == nil {
+			times = append(times, rtt)
+		}
+	}
+	return times, nil
+}
+
+// echoTimes returns the round trip times of the answered UDP echo requests,
+// none when the host is unreachable
+func echoTimes(ctx context.Context, addr net.IP, port int, device string, repetitions int, timeout time.Duration) []time.Duration {
+	conn, err := dialEcho(ctx, addr, port, device, 0, echoPlusHeader)
+	if err != nil {
+		return nil
+	}
+	defer conn.close()
+	var times []time.Duration
+	for seq := 1; seq <= repetitions && ctx.Err() == nil; seq++ {
+		if reply, err := conn.echo(uint32(seq), timeout); err == nil {
+			times = append(times, reply.Received.Sub(reply.Sent))
+		}
+	}
+	return times
+}
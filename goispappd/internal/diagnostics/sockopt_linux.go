@@ -0,0 +1,48 @@
+package diagnostics
+
+import (
+	"syscall"
+)
+
+// socketControl binds the socket to a device and sets the DSCP before it is used
+func socketControl(device string, dscp int, v6 bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if device != "" {
+				if sockErr = syscall.BindToDevice(int(fd), device); sockErr != nil {
+					return
+				}
+			}
+			if dscp > 0 {
+				if v6 {
+					sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, dscp<<2)
+				} else {
+					sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, dscp<<2)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+// withPriority extends control with SO_PRIORITY, which the egress VLAN maps to
+// the Ethernet priority
+func withPriority(control func(network, address string, c syscall.RawConn) error, priority int) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if err := control(network, address, c); err != nil || priority == 0 {
+			return err
+		}
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PRIORITY, priority)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !linux
+
+package diagnostics
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// socketControl only supports the defaults outside Linux, binding to a device
+// and setting the DSCP need Linux socket options
+func socketControl(device string, dscp int, v6 bool) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if device != "" || dscp > 0 {
+			return fmt.Errorf("interface binding and DSCP are only supported on Linux")
+		}
+		return nil
+	}
+}
+
+// withPriority only supports the default priority outside Linux
+func withPriority(control func(network, address string, c syscall.RawConn) error, priority int) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		if priority > 0 {
+			return fmt.Errorf("Ethernet priority is only supported on Linux")
+		}
+		return control(network, address, c)
+	}
+}
@@ -0,0 +1,133 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const traceRoutePrefix = "Device.IP.Diagnostics.TraceRoute."
+
+// traceRouteParams are the parameters of Device.IP.Diagnostics.TraceRoute.
+var traceRouteParams = map[string]params.Param{
+	"DiagnosticsState":          {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"Interface":                 {Type: soap.TR069TypeString, Writable: true},
+	"ProtocolVersion":           {Type: soap.TR069TypeString, Writable: true, Enum: []string{"Any", "IPv4", "IPv6"}, Default: "Any"},
+	"Host":                      {Type: soap.TR069TypeString, Writable: true},
+	"NumberOfTries":             {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "3", Check: params.Range(1, 3)},
+	"Timeout":                   {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "5000", Check: params.Range(1, 4294967295)},
+	"DataBlockSize":             {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "38", Check: params.Range(1, 65535)},
+	"DSCP":                      {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 63)},
+	"MaxHopCount":               {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "30", Check: params.Range(1, 64)},
+	"IPAddressUsed":             {Type: soap.TR069TypeString},
+	"ResponseTime":              {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"RouteHopsNumberOfEntries":  {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"RouteHops.{i}.Host":        {Type: soap.TR069TypeString},
+	"RouteHops.{i}.HostAddress": {Type: soap.TR069TypeString},
+	"RouteHops.{i}.ErrorCode":   {Type: soap.TR069TypeUnsignedInt},
+	"RouteHops.{i}.RTTimes":     {Type: soap.TR069TypeString},
+}
+
+// runTraceRoute probes Host with an increasing TTL until it answers or
+// MaxHopCount is reached, recording every hop in RouteHops. The probes are
+// UDP datagrams unless the Manager was given the ICMPProber.
+func (m *Manager) runTraceRoute(ctx context.Context, in map[string]string) map[string]string {
+	if in["Host"] == "" {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+	addr, err := m.resolve(ctx, in["Host"], in["ProtocolVersion"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorCannotResolveHostName}
+	}
+	device, err := m.device(ctx, in["Interface"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+	values := unsignedInts{in: in}
+	tries := int(values.get("NumberOfTries"))
+	timeout := time.Duration(values.get("Timeout")) * time.Millisecond
+	size := int(values.get("DataBlockSize"))
+	dscp := int(values.get("DSCP"))
+	maxHops := int(values.get("MaxHopCount"))
+	if values.err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+
+	out := map[string]string{
+		"DiagnosticsState": StateErrorMaxHopCountExceeded,
+		"IPAddressUsed":    addr.String(),
+		"ResponseTime":     "0",
+	}
+	seq := 0
+	hops := 0
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		var rtts []string
+		var answered []time.Duration
+		var last ProbeReply
+		reached := false
+		for try := 0; try < tries; try++ {
+			if ctx.Err() != nil {
+				return nil
+			}
+			seq++
+			reply, err := m.prober.Probe(ctx, ProbeRequest{
+				Addr:      addr,
+				Interface: device,
+				DSCP:      dscp,
+				Size:      size,
+				TTL:       ttl,
+				Seq:       seq,
+				Timeout:   timeout,
+			})
+			if errors.Is(err, ErrSocket) {
+				return map[string]string{"DiagnosticsState": StateErrorInternal}
+			}
+			if err != nil {
+				// Lost probes are reported with a zero round trip time
+				rtts = append(rtts, "0")
+				continue
+			}
+			last = reply
+			answered = append(answered, reply.RTT)
+			rtts = append(rtts, strconv.FormatInt(reply.RTT.Milliseconds(), 10))
+			reached = reached || reply.Reached || reply.From.Equal(addr)
+		}
+
+		hops++
+		hop := fmt.Sprintf("RouteHops.%d.", hops)
+		out[hop+"Host"] = ""
+		out[hop+"HostAddress"] = ""
+		if last.From != nil {
+			out[hop+"Host"] = m.hostName(ctx, last.From.String())
+			out[hop+"HostAddress"] = last.From.String()
+		}
+		out[hop+"ErrorCode"] = strconv.Itoa(last.Code)
+		out[hop+"RTTimes"] = strings.Join(rtts, ",")
+
+		if reached {
+			_, average, _ := responseTimes(answered)
+			out["DiagnosticsState"] = StateComplete
+			out["ResponseTime"] = strconv.FormatInt(average.Milliseconds(), 10)
+			break
+		}
+	}
+	out["RouteHopsNumberOfEntries"] = strconv.Itoa(hops)
+	return out
+}
+
+// hostName returns the reverse DNS name of addr, or addr when it has none
+func (m *Manager) hostName(ctx context.Context, addr string) string {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	names, err := m.resolver.LookupAddr(ctx, addr)
+	if err != nil || len(names) == 0 {
+		return addr
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
@@ -0,0 +1,150 @@
+package diagnostics_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/store"
+)
+
+// fakeProber answers by TTL, a missing TTL loses every probe and the
+// destination answers any TTL at or above reachedAt
+type fakeProber struct {
+	mu        sync.Mutex
+	hops      map[int]string
+	dest      net.IP
+	reachedAt int
+	requests  []diagnostics.ProbeRequest
+}
+
+func (p *fakeProber) Probe(_ context.Context, req diagnostics.ProbeRequest) (diagnostics.ProbeReply, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.requests = append(p.requests, req)
+	rtt := time.Duration(req.TTL*10) * time.Millisecond
+	if p.reachedAt > 0 && req.TTL >= p.reachedAt {
+		return diagnostics.ProbeReply{From: p.dest, RTT: rtt, Code: 3, Reached: true}, nil
+	}
+	if hop, ok := p.hops[req.TTL]; ok {
+		return diagnostics.ProbeReply{From: net.ParseIP(hop), RTT: rtt}, nil
+	}
+	return diagnostics.ProbeReply{}, errors.New("i/o timeout")
+}
+
+func TestTraceRoute(t *testing.T) {
+	t.Run("Complete", func(t *testing.T) {
+		prober := &fakeProber{hops: map[int]string{1: "198.51.100.1"}, dest: net.ParseIP("192.0.2.10"), reachedAt: 3}
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithProber(prober))
+		set(t, registry,
+			"Device.IP.Diagnostics.TraceRoute.Host", "acs.example.com",
+			"Device.IP.Diagnostics.TraceRoute.ProtocolVersion", "IPv4",
+			"Device.IP.Diagnostics.TraceRoute.NumberOfTries", "2",
+			"Device.IP.Diagnostics.TraceRoute.Timeout", "1000",
+			"Device.IP.Diagnostics.TraceRoute.DSCP", "8",
+			"Device.IP.Diagnostics.TraceRoute.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			"DiagnosticsState":         "Complete",
+			"ResponseTime":             "30",
+			"RouteHopsNumberOfEntries": "3",
+			"RouteHops.1.Host":         "gw.example.com",
+			"RouteHops.1.HostAddress":  "198.51.100.1",
+			"RouteHops.1.ErrorCode":    "0",
+			"RouteHops.1.RTTimes":      "10,10",
+			"RouteHops.2.RTTimes":      "0,0",
+			"RouteHops.3.Host":         "acs.example.com",
+			"RouteHops.3.HostAddress":  "192.0.2.10",
+			"RouteHops.3.ErrorCode":    "3",
+			"RouteHops.3.RTTimes":      "30,30",
+		}
+		for name, want := range expected {
+			if got := values["Device.IP.Diagnostics.TraceRoute."+name]; got != want {
+				t.Errorf("%s: expected %q, got %q", name, want, got)
+			}
+		}
+		if len(prober.requests) != 6 {
+			t.Fatalf("Expected 6 probes, got %d", len(prober.requests))
+		}
+		if req := prober.requests[5]; req.TTL != 3 || req.DSCP != 8 || req.Size != 38 || req.Timeout != time.Second {
+			t.Errorf("Unexpected probe %+v", req)
+		}
+
+		// A shorter route replaces the hops of the previous run
+		prober.reachedAt = 1
+		set(t, registry, "Device.IP.Diagnostics.TraceRoute.DiagnosticsState", "Requested")
+		wait(t, done)
+		if _, ok := store.Get("Device.IP.Diagnostics.TraceRoute.RouteHops.3.HostAddress"); ok {
+			t.Error("Expected the hops of the previous run to be removed")
+		}
+		if count, _ := store.Get("Device.IP.Diagnostics.TraceRoute.RouteHopsNumberOfEntries"); count != "1" {
+			t.Errorf("Expected 1 hop, got %q", count)
+		}
+	})
+
+	t.Run("MaxHopCountExceeded", func(t *testing.T) {
+		prober := &fakeProber{hops: map[int]string{1: "198.51.100.1", 2: "198.51.100.2"}}
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithProber(prober))
+		set(t, registry,
+			"Device.IP.Diagnostics.TraceRoute.Host", "192.0.2.99",
+			"Device.IP.Diagnostics.TraceRoute.NumberOfTries", "1",
+			"Device.IP.Diagnostics.TraceRoute.MaxHopCount", "2",
+			"Device.IP.Diagnostics.TraceRoute.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		if state, _ := store.Get("Device.IP.Diagnostics.TraceRoute.DiagnosticsState"); state != "Error_MaxHopCountExceeded" {
+			t.Errorf("Expected Error_MaxHopCountExceeded, got %q", state)
+		}
+		if count, _ := store.Get("Device.IP.Diagnostics.TraceRoute.RouteHopsNumberOfEntries"); count != "2" {
+			t.Errorf("Expected 2 hops, got %q", count)
+		}
+	})
+}
+
+func TestUDPProberLoopback(t *testing.T) {
+	reply, err := diagnostics.UDPProber{}.Probe(context.Background(), diagnostics.ProbeRequest{
+		Addr:    net.ParseIP("127.0.0.1"),
+		Size:    38,
+		TTL:     1,
+		Seq:     1,
+		Timeout: time.Second,
+	})
+	if errors.Is(err, diagnostics.ErrSocket) {
+		t.Skipf("ICMP sockets not permitted: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if !reply.Reached || !reply.From.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("Expected port unreachable from loopback, got %+v", reply)
+	}
+}
+
+func TestICMPProberLoopback(t *testing.T) {
+	reply, err := diagnostics.ICMPProber{}.Probe(context.Background(), diagnostics.ProbeRequest{
+		Addr:    net.ParseIP("127.0.0.1"),
+		Size:    38,
+		TTL:     1,
+		Seq:     1,
+		Timeout: time.Second,
+	})
+	if errors.Is(err, diagnostics.ErrSocket) {
+		t.Skipf("ICMP sockets not permitted: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if !reply.Reached || !reply.From.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("Expected an echo reply from loopback, got %+v", reply)
+	}
+}
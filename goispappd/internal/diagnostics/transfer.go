@@ -0,0 +1,464 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// maxConnections is reported as Download/UploadDiagnosticMaxConnections
+const maxConnections = 8
+
+// timeLayout formats the TR-143 timestamps with microsecond precision
+const timeLayout = "2006-01-02T15:04:05.000000Z"
+
+// unknownTime is the TR-069 dateTime of an unknown time
+const unknownTime = "0001-01-01T00:00:00Z"
+
+// transfer describes an HTTP throughput test, Upload is the TestFileLength
+// sent by each connection and zero for a download
+type transfer struct {
+	URL         *url.URL
+	Addr        net.IP
+	Device      string // Linux device to bind to, empty to follow the routing table
+	DSCP        int
+	Priority    int
+	Connections int
+	Upload      int64
+}
+
+// connectionResult holds the TR-143 timestamps and test bytes of one connection
+type connectionResult struct {
+	TCPOpenRequest  time.Time
+	TCPOpenResponse time.Time
+	ROM             time.Time
+	BOM             time.Time
+	EOM             time.Time
+	Received        atomic.Int64
+	Sent            atomic.Int64
+}
+
+// transferResult aggregates the connections of a test
+type transferResult struct {
+	Connections []*connectionResult
+	// Interface counters of Device, over the whole test and the full loading period
+	TotalReceived, TotalSent                       uint64
+	TotalReceivedFullLoading, TotalSentFullLoading uint64
+	TestBytesFullLoading                           int64
+	FullLoading                                    time.Duration
+}
+
+// fullLoading tracks the period in which every connection transfers data
+type fullLoading struct {
+	mu       sync.Mutex
+	pending  int          // Connections that have not begun transferring
+	done     bool         // A connection finished, the period is over
+	bytes    atomic.Int64 // Test bytes of all connections
+	counters func() byteCounters
+
+	start, end                 time.Time
+	startBytes, endBytes       int64
+	startCounters, endCounters byteCounters
+}
+
+// byteCounters is a sample of the byte counters of an interface, ok is false
+// when they could not be read
+type byteCounters struct {
+	rx, tx uint64
+	ok     bool
+}
+
+// since returns the bytes counted after previous, zero when a sample is
+// missing or a counter went backwards, e.g. as the interface was recreated
+func (c byteCounters) since(previous byteCounters) (rx, tx uint64) {
+	if !c.ok || !previous.ok || c.rx < previous.rx || c.tx < previous.tx {
+		return 0, 0
+	}
+	return c.rx - previous.rx, c.tx - previous.tx
+}
+
+func (l *fullLoading) begin() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending--; l.pending == 0 && !l.done {
+		l.start = time.Now()
+		l.startBytes = l.bytes.Load()
+		l.startCounters = l.counters()
+	}
+}
+
+func (l *fullLoading) finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.done {
+		return
+	}
+	l.done = true
+	if !l.start.IsZero() {
+		l.end = time.Now()
+		l.endBytes = l.bytes.Load()
+		l.endCounters = l.counters()
+	}
+}
+
+// countingConn counts the bytes a connection reads and writes
+type countingConn struct {
+	net.Conn
+	result  *connectionResult
+	loading *fullLoading
+	upload  bool
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.result.Received.Add(int64(n))
+	if !c.upload {
+		c.loading.bytes.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.result.Sent.Add(int64(n))
+	if c.upload {
+		c.loading.bytes.Add(int64(n))
+	}
+	return n, err
+}
+
+// transferError carries the DiagnosticsState of a failed test
+type transferError struct {
+	state string
+	err   error
+}
+
+func (e *transferError) Error() string {
+	return fmt.Sprintf("%s: %v", e.state, e.err)
+}
+
+// run opens the connections at once and waits for every one to finish, the
+// first failure cancels the others
+func (t *transfer) run(ctx context.Context, counters func() byteCounters) (*transferResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	loading := &fullLoading{pending: t.Connections, counters: counters}
+	result := &transferResult{Connections: make([]*connectionResult, t.Connections)}
+	start := counters()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var failure error
+	for i := range result.Connections {
+		result.Connections[i] = &connectionResult{}
+		wg.Add(1)
+		go func(c *connectionResult) {
+			defer wg.Done()
+			if err := t.connection(ctx, c, loading); err != nil {
+				once.Do(func() {
+					failure = err
+					cancel()
+				})
+			}
+		}(result.Connections[i])
+	}
+	wg.Wait()
+	if failure != nil {
+		return nil, failure
+	}
+
+	result.TotalReceived, result.TotalSent = counters().since(start)
+	if !loading.end.IsZero() {
+		result.FullLoading = loading.end.Sub(loading.start)
+		result.TestBytesFullLoading = loading.endBytes - loading.startBytes
+		result.TotalReceivedFullLoading, result.TotalSentFullLoading = loading.endCounters.since(loading.startCounters)
+	}
+	return result, nil
+}
+
+// connection runs the GET or PUT of a single connection
+func (t *transfer) connection(ctx context.Context, c *connectionResult, loading *fullLoading) error {
+	v6 := t.Addr.To4() == nil
+	dialer := &net.Dialer{Control: withPriority(socketControl(t.Device, t.DSCP, v6), t.Priority)}
+	dialed := false
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, address string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+			c.TCPOpenRequest = time.Now()
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(t.Addr.String(), port))
+			if err != nil {
+				return nil, err
+			}
+			c.TCPOpenResponse = time.Now()
+			dialed = true
+			return &countingConn{Conn: conn, result: c, loading: loading, upload: t.Upload > 0}, nil
+		},
+		DisableKeepAlives:     true,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+	defer transport.CloseIdleConnections()
+
+	method := http.MethodGet
+	var body io.Reader
+	if t.Upload > 0 {
+		method = http.MethodPut
+		body = &firstRead{Reader: io.LimitReader(zeros{}, t.Upload), fn: func() {
+			c.BOM = time.Now()
+			loading.begin()
+		}}
+	}
+	trace := &httptrace.ClientTrace{
+		WroteHeaders: func() { c.ROM = time.Now() },
+		GotFirstResponseByte: func() {
+			if t.Upload == 0 {
+				c.BOM = time.Now()
+				loading.begin()
+			}
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, t.URL.String(), body)
+	if err != nil {
+		return &transferError{StateErrorInternal, err}
+	}
+	req.ContentLength = t.Upload
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		switch {
+		case !dialed:
+			return &transferError{StateErrorInitConnectionFailed, err}
+		case errors.Is(err, context.DeadlineExceeded) || c.BOM.IsZero() && t.Upload == 0:
+			return &transferError{StateErrorNoResponse, err}
+		}
+		return &transferError{StateErrorTransferFailed, err}
+	}
+	defer resp.Body.Close()
+	if t.Upload > 0 {
+		// The upload ends with the response of the server
+		c.EOM = time.Now()
+		loading.finish()
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &transferError{StateErrorTransferFailed, fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return &transferError{StateErrorTransferFailed, err}
+	}
+	if t.Upload == 0 {
+		c.EOM = time.Now()
+		loading.finish()
+	}
+	return nil
+}
+
+// firstRead calls fn before the first read of the request body
+type firstRead struct {
+	io.Reader
+	once sync.Once
+	fn   func()
+}
+
+func (r *firstRead) Read(b []byte) (int, error) {
+	r.once.Do(r.fn)
+	return r.Reader.Read(b)
+}
+
+// zeros is the content of the uploaded test file
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	clear(b)
+	return len(b), nil
+}
+
+// transferResults formats the results of a download or upload test, bytes
+// returns the test bytes of a connection in the direction of the test
+func transferResults(result *transferResult, perConnection bool, bytes func(*connectionResult) int64, testBytes string) map[string]string {
+	var rom, bom, eom, tcpRequest, tcpResponse time.Time
+	var total int64
+	for i, c := range result.Connections {
+		if i == 0 || c.ROM.Before(rom) {
+			rom = c.ROM
+		}
+		if i == 0 || c.BOM.Before(bom) {
+			bom = c.BOM
+		}
+		if c.EOM.After(eom) {
+			eom = c.EOM
+		}
+		if i == 0 || c.TCPOpenRequest.Before(tcpRequest) {
+			tcpRequest = c.TCPOpenRequest
+		}
+		if i == 0 || c.TCPOpenResponse.Before(tcpResponse) {
+			tcpResponse = c.TCPOpenResponse
+		}
+		total += bytes(c)
+	}
+	out := map[string]string{
+		"DiagnosticsState":                   StateComplete,
+		"ROMTime":                            timestamp(rom),
+		"BOMTime":                            timestamp(bom),
+		"EOMTime":                            timestamp(eom),
+		"TCPOpenRequestTime":                 timestamp(tcpRequest),
+		"TCPOpenResponseTime":                timestamp(tcpResponse),
+		testBytes:                            strconv.FormatInt(total, 10),
+		testBytes + "UnderFullLoading":       strconv.FormatInt(result.TestBytesFullLoading, 10),
+		"TotalBytesReceived":                 strconv.FormatUint(result.TotalReceived, 10),
+		"TotalBytesSent":                     strconv.FormatUint(result.TotalSent, 10),
+		"TotalBytesReceivedUnderFullLoading": strconv.FormatUint(result.TotalReceivedFullLoading, 10),
+		"TotalBytesSentUnderFullLoading":     strconv.FormatUint(result.TotalSentFullLoading, 10),
+		"PeriodOfFullLoading":                strconv.FormatInt(result.FullLoading.Microseconds(), 10),
+		"PerConnectionResultNumberOfEntries": "0",
+	}
+	if !perConnection {
+		return out
+	}
+	out["PerConnectionResultNumberOfEntries"] = strconv.Itoa(len(result.Connections))
+	for i, c := range result.Connections {
+		entry := fmt.Sprintf("PerConnectionResult.%d.", i+1)
+		out[entry+"ROMTime"] = timestamp(c.ROM)
+		out[entry+"BOMTime"] = timestamp(c.BOM)
+		out[entry+"EOMTime"] = timestamp(c.EOM)
+		out[entry+"TCPOpenRequestTime"] = timestamp(c.TCPOpenRequest)
+		out[entry+"TCPOpenResponseTime"] = timestamp(c.TCPOpenResponse)
+		out[entry+testBytes] = strconv.FormatInt(bytes(c), 10)
+	}
+	return out
+}
+
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return unknownTime
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+// checkURL accepts an empty value or an HTTP URL with a host
+func checkURL(value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Hostname() == "" {
+		return fmt.Errorf("unsupported URL %s", value)
+	}
+	return nil
+}
+
+// interfaceCounters returns a reader of the byte counters of device. They are
+// read from this host with sysfs, otherwise through the runner on the device
+func (m *Manager) interfaceCounters(ctx context.Context, device string) func() byteCounters {
+	return func() byteCounters {
+		if device == "" || strings.Contains(device, "/") || device == ".." {
+			return byteCounters{}
+		}
+		if m.sysfs != nil {
+			rx, tx, err := m.sysfs.InterfaceBytes(device)
+			return byteCounters{rx: rx, tx: tx, ok: err == nil}
+		}
+		statistics := "/sys/class/net/" + device + "/statistics/"
+		result, err := m.runner.Execute(ctx, "cat", statistics+"rx_bytes", statistics+"tx_bytes")
+		if err != nil {
+			return byteCounters{}
+		}
+		fields := strings.Fields(string(result.Raw))
+		if len(fields) != 2 {
+			return byteCounters{}
+		}
+		rx, rxErr := strconv.ParseUint(fields[0], 10, 64)
+		tx, txErr := strconv.ParseUint(fields[1], 10, 64)
+		return byteCounters{rx: rx, tx: tx, ok: rxErr == nil && txErr == nil}
+	}
+}
+
+// egressDevice returns the device the routing table sends traffic for addr
+// through, a connected UDP socket selects the source address without sending
+func egressDevice(addr net.IP) string {
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: addr, Port: 9})
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(local) {
+				return iface.Name
+			}
+		}
+	}
+	return ""
+}
+
+// runTransfer resolves the URL of a download or upload test and runs it, the
+// state is StateComplete with a result, an error state otherwise and empty
+// when the test was stopped
+func (m *Manager) runTransfer(ctx context.Context, in map[string]string, rawURL string, upload int64) (result *transferResult, addrUsed, state string) {
+	u, err := url.Parse(rawURL)
+	if rawURL == "" || err != nil {
+		return nil, "", StateErrorOther
+	}
+	addr, err := m.resolve(ctx, u.Hostname(), in["ProtocolVersion"])
+	if err != nil {
+		return nil, "", StateErrorCannotResolveHostName
+	}
+	device, err := m.device(ctx, in["Interface"])
+	if err != nil {
+		return nil, "", StateErrorOther
+	}
+	// The egress device of this host only carries the test when the counters
+	// are read here, a remote device reports them for a named interface only
+	counted := device
+	if counted == "" && m.sysfs != nil {
+		counted = egressDevice(addr)
+	}
+	connections, _ := strconv.Atoi(in["NumberOfConnections"])
+	dscp, _ := strconv.Atoi(in["DSCP"])
+	priority, _ := strconv.Atoi(in["EthernetPriority"])
+
+	t := &transfer{
+		URL:         u,
+		Addr:        addr,
+		Device:      device,
+		DSCP:        dscp,
+		Priority:    priority,
+		Connections: connections,
+		Upload:      upload,
+	}
+	result, err = t.run(ctx, m.interfaceCounters(ctx, counted))
+	var failed *transferError
+	switch {
+	case ctx.Err() != nil:
+		return nil, "", ""
+	case errors.As(err, &failed):
+		return nil, "", failed.state
+	case err != nil:
+		return nil, "", StateErrorInternal
+	}
+	return result, addr.String(), StateComplete
+}
@@ -0,0 +1,265 @@
+package diagnostics_test
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/sysinfo"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+func soapValues(name, value string) []soap.SetParameterValueStruct {
+	return []soap.SetParameterValueStruct{{Name: name, Value: value}}
+}
+
+// fakeCounters serves the loopback byte counters from a fixture root the test
+// server bumps while it transfers
+type fakeCounters struct {
+	mu     sync.Mutex
+	dir    string
+	rx, tx uint64
+}
+
+func newFakeCounters(t *testing.T) (*fakeCounters, *sysinfo.Reader) {
+	t.Helper()
+	root := t.TempDir()
+	c := &fakeCounters{dir: filepath.Join(root, "sys/class/net/lo/statistics")}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c.add(1000, 1000)
+	return c, sysinfo.NewReader(root)
+}
+
+func (c *fakeCounters) add(rx, tx uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rx += rx
+	c.tx += tx
+	os.WriteFile(filepath.Join(c.dir, "rx_bytes"), []byte(strconv.FormatUint(c.rx, 10)), 0o644)
+	os.WriteFile(filepath.Join(c.dir, "tx_bytes"), []byte(strconv.FormatUint(c.tx, 10)), 0o644)
+}
+
+// reset restarts the counters at zero, as when the interface is recreated
+func (c *fakeCounters) reset() {
+	c.mu.Lock()
+	c.rx, c.tx = 0, 0
+	c.mu.Unlock()
+	c.add(0, 0)
+}
+
+func TestDownloadDiagnostics(t *testing.T) {
+	counters, reader := newFakeCounters(t)
+	const size = 256 * 1024
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reset.bin" {
+			counters.reset()
+		} else if r.URL.Path != "/file.bin" {
+			http.NotFound(w, r)
+			return
+		}
+		requests.Add(1)
+		counters.add(size, 100)
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Write(make([]byte, size))
+	}))
+	defer server.Close()
+
+	t.Run("Complete", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithSysinfo(reader))
+		set(t, registry,
+			"Device.IP.Diagnostics.DownloadDiagnostics.DownloadURL", server.URL+"/file.bin",
+			"Device.IP.Diagnostics.DownloadDiagnostics.NumberOfConnections", "3",
+			"Device.IP.Diagnostics.DownloadDiagnostics.EnablePerConnectionResults", "true",
+			"Device.IP.Diagnostics.DownloadDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		get := func(name string) string { return values["Device.IP.Diagnostics.DownloadDiagnostics."+name] }
+		if state := get("DiagnosticsState"); state != "Complete" {
+			t.Fatalf("Expected Complete, got %q", state)
+		}
+		if requests.Load() != 3 {
+			t.Errorf("Expected 3 requests, got %d", requests.Load())
+		}
+		if received, _ := strconv.Atoi(get("TestBytesReceived")); received < 3*size {
+			t.Errorf("Expected at least %d test bytes, got %d", 3*size, received)
+		}
+		if get("TotalBytesReceived") != strconv.Itoa(3*size) || get("TotalBytesSent") != "300" {
+			t.Errorf("Expected the interface counters to grow by %d/300, got %s/%s", 3*size, get("TotalBytesReceived"), get("TotalBytesSent"))
+		}
+		if get("IPAddressUsed") != "127.0.0.1" {
+			t.Errorf("Expected IPAddressUsed 127.0.0.1, got %q", get("IPAddressUsed"))
+		}
+		if get("PerConnectionResultNumberOfEntries") != "3" {
+			t.Fatalf("Expected 3 per connection results, got %q", get("PerConnectionResultNumberOfEntries"))
+		}
+		for _, entry := range []string{"PerConnectionResult.1.", "PerConnectionResult.2.", "PerConnectionResult.3."} {
+			if received, _ := strconv.Atoi(get(entry + "TestBytesReceived")); received < size {
+				t.Errorf("%s: expected at least %d bytes, got %d", entry, size, received)
+			}
+		}
+
+		// The timestamps follow the TR-143 order
+		var previous time.Time
+		for _, name := range []string{"TCPOpenRequestTime", "TCPOpenResponseTime", "ROMTime", "BOMTime", "EOMTime"} {
+			stamp, err := time.Parse(time.RFC3339Nano, get(name))
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if stamp.Before(previous) {
+				t.Errorf("%s %v is before %v", name, stamp, previous)
+			}
+			previous = stamp
+		}
+	})
+
+	t.Run("CountersReset", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithSysinfo(reader))
+		set(t, registry,
+			"Device.IP.Diagnostics.DownloadDiagnostics.DownloadURL", server.URL+"/reset.bin",
+			"Device.IP.Diagnostics.DownloadDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"TotalBytesReceived", "TotalBytesSent", "TotalBytesReceivedUnderFullLoading", "TotalBytesSentUnderFullLoading"} {
+			if got := values["Device.IP.Diagnostics.DownloadDiagnostics."+name]; got != "0" {
+				t.Errorf("%s: expected 0 after the counters went backwards, got %q", name, got)
+			}
+		}
+	})
+
+	t.Run("RemoteCounters", func(t *testing.T) {
+		// The fixture runner stands for a remote device without counters
+		// for the loopback this host sends the test through
+		registry, done := newManager(t, &fakePinger{})
+		set(t, registry,
+			"Device.IP.Diagnostics.DownloadDiagnostics.DownloadURL", server.URL+"/file.bin",
+			"Device.IP.Diagnostics.DownloadDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state := values["Device.IP.Diagnostics.DownloadDiagnostics.DiagnosticsState"]; state != "Complete" {
+			t.Fatalf("Expected Complete, got %q", state)
+		}
+		if got := values["Device.IP.Diagnostics.DownloadDiagnostics.TotalBytesReceived"]; got != "0" {
+			t.Errorf("Expected no counters of this host, got %q received", got)
+		}
+	})
+
+	t.Run("TransferFailed", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithSysinfo(reader))
+		set(t, registry,
+			"Device.IP.Diagnostics.DownloadDiagnostics.DownloadURL", server.URL+"/missing",
+			"Device.IP.Diagnostics.DownloadDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		if state, _ := store.Get("Device.IP.Diagnostics.DownloadDiagnostics.DiagnosticsState"); state != "Error_TransferFailed" {
+			t.Errorf("Expected Error_TransferFailed, got %q", state)
+		}
+	})
+
+	t.Run("InitConnectionFailed", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		closed := "http://" + listener.Addr().String() + "/file.bin"
+		listener.Close()
+
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithSysinfo(reader))
+		set(t, registry,
+			"Device.IP.Diagnostics.DownloadDiagnostics.DownloadURL", closed,
+			"Device.IP.Diagnostics.DownloadDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		if state, _ := store.Get("Device.IP.Diagnostics.DownloadDiagnostics.DiagnosticsState"); state != "Error_InitConnectionFailed" {
+			t.Errorf("Expected Error_InitConnectionFailed, got %q", state)
+		}
+	})
+
+	t.Run("UnsupportedURL", func(t *testing.T) {
+		registry, _ := newManager(t, &fakePinger{})
+		for _, value := range []string{"ftp://192.0.2.1/file.bin", "http://"} {
+			if faults := registry.Set(soapValues("Device.IP.Diagnostics.DownloadDiagnostics.DownloadURL", value)); len(faults) != 1 {
+				t.Errorf("Expected a fault for %s, got %v", value, faults)
+			}
+		}
+		if faults := registry.Set(soapValues("Device.IP.Diagnostics.DownloadDiagnostics.NumberOfConnections", "9")); len(faults) != 1 {
+			t.Errorf("Expected a fault above DownloadDiagnosticMaxConnections, got %v", faults)
+		}
+	})
+}
+
+func TestUploadDiagnostics(t *testing.T) {
+	counters, reader := newFakeCounters(t)
+	var received atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		n, _ := io.Copy(io.Discard, r.Body)
+		received.Add(n)
+		counters.add(0, uint64(n))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	registry, done := newManager(t, &fakePinger{}, diagnostics.WithSysinfo(reader))
+	set(t, registry,
+		"Device.IP.Diagnostics.UploadDiagnostics.UploadURL", server.URL+"/upload",
+		"Device.IP.Diagnostics.UploadDiagnostics.TestFileLength", "100000",
+		"Device.IP.Diagnostics.UploadDiagnostics.NumberOfConnections", "2",
+		"Device.IP.Diagnostics.UploadDiagnostics.DiagnosticsState", "Requested",
+	)
+	wait(t, done)
+
+	values, err := store.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(name string) string { return values["Device.IP.Diagnostics.UploadDiagnostics."+name] }
+	if state := get("DiagnosticsState"); state != "Complete" {
+		t.Fatalf("Expected Complete, got %q", state)
+	}
+	if received.Load() != 200000 {
+		t.Errorf("Expected the server to receive 200000 bytes, got %d", received.Load())
+	}
+	if sent, _ := strconv.Atoi(get("TestBytesSent")); sent < 200000 {
+		t.Errorf("Expected at least 200000 test bytes, got %d", sent)
+	}
+	if get("TotalBytesSent") != "200000" {
+		t.Errorf("Expected the interface to send 200000 bytes, got %s", get("TotalBytesSent"))
+	}
+	if get("PerConnectionResultNumberOfEntries") != "0" {
+		t.Errorf("Expected no per connection results, got %q", get("PerConnectionResultNumberOfEntries"))
+	}
+	bom, _ := time.Parse(time.RFC3339Nano, get("BOMTime"))
+	eom, _ := time.Parse(time.RFC3339Nano, get("EOMTime"))
+	if bom.IsZero() || eom.Before(bom) {
+		t.Errorf("Unexpected BOMTime %s and EOMTime %s", get("BOMTime"), get("EOMTime"))
+	}
+}
@@ -0,0 +1,181 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const udpEchoPrefix = "Device.IP.Diagnostics.UDPEchoDiagnostics."
+
+// maxPacketResults is reported as UDPEchoDiagnosticsMaxResults, later packets
+// are counted without an IndividualPacketResult
+const maxPacketResults = 1000
+
+// udpEchoParams are the parameters of Device.IP.Diagnostics.UDPEchoDiagnostics.
+var udpEchoParams = map[string]params.Param{
+	"DiagnosticsState":                      {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"Interface":                             {Type: soap.TR069TypeString, Writable: true},
+	"Host":                                  {Type: soap.TR069TypeString, Writable: true},
+	"Port":                                  {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 65535)},
+	"NumberOfRepetitions":                   {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "1", Check: params.Range(1, maxRepetitions)},
+	"Timeout":                               {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "5000", Check: params.Range(1, 4294967295)},
+	"DataBlockSize":                         {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "24", Check: params.Range(echoPlusHeader, 65535)},
+	"DSCP":                                  {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 63)},
+	"InterTransmissionTime":                 {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "1000", Check: params.Range(1, 65535)},
+	"ProtocolVersion":                       {Type: soap.TR069TypeString, Writable: true, Enum: []string{"Any", "IPv4", "IPv6"}, Default: "Any"},
+	"EnableIndividualPacketResults":         {Type: soap.TR069TypeBoolean, Writable: true, Default: "false"},
+	"IPAddressUsed":                         {Type: soap.TR069TypeString},
+	"SuccessCount":                          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"FailureCount":                          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"AverageResponseTime":                   {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"MinimumResponseTime":                   {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"MaximumResponseTime":                   {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"IndividualPacketResultNumberOfEntries": {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"IndividualPacketResult.{i}.PacketSuccess":             {Type: soap.TR069TypeBoolean},
+	"IndividualPacketResult.{i}.PacketSendTime":            {Type: soap.TR069TypeDateTime},
+	"IndividualPacketResult.{i}.PacketReceiveTime":         {Type: soap.TR069TypeDateTime},
+	"IndividualPacketResult.{i}.TestGenSN":                 {Type: soap.TR069TypeUnsignedInt},
+	"IndividualPacketResult.{i}.TestRespSN":                {Type: soap.TR069TypeUnsignedInt},
+	"IndividualPacketResult.{i}.TestRespRcvTimeStamp":      {Type: soap.TR069TypeUnsignedInt},
+	"IndividualPacketResult.{i}.TestRespReplyTimeStamp":    {Type: soap.TR069TypeUnsignedInt},
+	"IndividualPacketResult.{i}.TestRespReplyFailureCount": {Type: soap.TR069TypeUnsignedInt},
+}
+
+// echoReply is the answer to one UDPEchoPlus request
+type echoReply struct {
+	Sent, Received time.Time
+	RespSN         uint32
+	RecvTimeStamp  uint32
+	ReplyTimeStamp uint32
+	FailureCount   uint32
+}
+
+// echoConn sends UDPEchoPlus requests to one responder
+type echoConn struct {
+	conn net.Conn
+	size int
+	stop func() bool
+}
+
+func dialEcho(ctx context.Context, addr net.IP, port int, device string, dscp, size int) (*echoConn, error) {
+	dialer := &net.Dialer{Control: socketControl(device, dscp, addr.To4() == nil)}
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(addr.String(), strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	return &echoConn{conn: conn, size: size, stop: stop}, nil
+}
+
+// echo sends the request with TestGenSN seq and waits for its answer, late
+// answers to earlier requests are skipped
+func (c *echoConn) echo(seq uint32, timeout time.Duration) (echoReply, error) {
+	packet := make([]byte, max(c.size, echoPlusHeader))
+	binary.BigEndian.PutUint32(packet[0:4], seq)
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return echoReply{}, err
+	}
+	reply := echoReply{Sent: time.Now()}
+	if _, err := c.conn.Write(packet); err != nil {
+		return reply, err
+	}
+	buf := make([]byte, len(packet)+64)
+	for {
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			return reply, err
+		}
+		if n < echoPlusHeader || binary.BigEndian.Uint32(buf[0:4]) != seq {
+			continue
+		}
+		reply.Received = time.Now()
+		reply.RespSN = binary.BigEndian.Uint32(buf[4:8])
+		reply.RecvTimeStamp = binary.BigEndian.Uint32(buf[8:12])
+		reply.ReplyTimeStamp = binary.BigEndian.Uint32(buf[12:16])
+		reply.FailureCount = binary.BigEndian.Uint32(buf[16:20])
+		return reply, nil
+	}
+}
+
+func (c *echoConn) close() {
+	c.stop()
+	c.conn.Close()
+}
+
+// runUDPEcho sends NumberOfRepetitions UDPEchoPlus requests to Host:Port,
+// InterTransmissionTime apart
+func (m *Manager) runUDPEcho(ctx context.Context, in map[string]string) map[string]string {
+	values := unsignedInts{in: in}
+	port := int(values.get("Port"))
+	repetitions := int(values.get("NumberOfRepetitions"))
+	timeout := time.Duration(values.get("Timeout")) * time.Millisecond
+	size := int(values.get("DataBlockSize"))
+	dscp := int(values.get("DSCP"))
+	interval := time.Duration(values.get("InterTransmissionTime")) * time.Millisecond
+	if values.err != nil || in["Host"] == "" || port == 0 {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+	addr, err := m.resolve(ctx, in["Host"], in["ProtocolVersion"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorCannotResolveHostName}
+	}
+	device, err := m.device(ctx, in["Interface"])
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther}
+	}
+	individual, _ := strconv.ParseBool(in["EnableIndividualPacketResults"])
+
+	conn, err := dialEcho(ctx, addr, port, device, dscp, size)
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorInternal}
+	}
+	defer conn.close()
+
+	out := map[string]string{"IndividualPacketResultNumberOfEntries": "0"}
+	var times []time.Duration
+	for seq := 1; seq <= repetitions; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		reply, err := conn.echo(uint32(seq), timeout)
+		if err == nil {
+			times = append(times, reply.Received.Sub(reply.Sent))
+		}
+		if !individual || seq > maxPacketResults {
+			continue
+		}
+		entry := fmt.Sprintf("IndividualPacketResult.%d.", seq)
+		out[entry+"PacketSuccess"] = strconv.FormatBool(err == nil)
+		out[entry+"PacketSendTime"] = timestamp(reply.Sent)
+		out[entry+"PacketReceiveTime"] = timestamp(reply.Received)
+		out[entry+"TestGenSN"] = strconv.Itoa(seq)
+		out[entry+"TestRespSN"] = strconv.FormatUint(uint64(reply.RespSN), 10)
+		out[entry+"TestRespRcvTimeStamp"] = strconv.FormatUint(uint64(reply.RecvTimeStamp), 10)
+		out[entry+"TestRespReplyTimeStamp"] = strconv.FormatUint(uint64(reply.ReplyTimeStamp), 10)
+		out[entry+"TestRespReplyFailureCount"] = strconv.FormatUint(uint64(reply.FailureCount), 10)
+		out["IndividualPacketResultNumberOfEntries"] = strconv.Itoa(seq)
+	}
+
+	minimum, average, maximum := responseTimes(times)
+	out["DiagnosticsState"] = StateComplete
+	out["IPAddressUsed"] = addr.String()
+	out["SuccessCount"] = strconv.Itoa(len(times))
+	out["FailureCount"] = strconv.Itoa(repetitions - len(times))
+	out["MinimumResponseTime"] = strconv.FormatInt(minimum.Milliseconds(), 10)
+	out["AverageResponseTime"] = strconv.FormatInt(average.Milliseconds(), 10)
+	out["MaximumResponseTime"] = strconv.FormatInt(maximum.Milliseconds(), 10)
+	return out
+}
@@ -0,0 +1,188 @@
+package diagnostics_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+)
+
+// freeUDPPort returns a loopback port nothing listens on
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// enableResponder starts the UDPEchoConfig responder and stops it after the test
+func enableResponder(t *testing.T, registry *params.Registry, plus bool) int {
+	t.Helper()
+	port := freeUDPPort(t)
+	set(t, registry,
+		"Device.IP.Diagnostics.UDPEchoConfig.UDPPort", strconv.Itoa(port),
+		"Device.IP.Diagnostics.UDPEchoConfig.EchoPlusEnabled", strconv.FormatBool(plus),
+		"Device.IP.Diagnostics.UDPEchoConfig.Enable", "true",
+	)
+	t.Cleanup(func() { set(t, registry, "Device.IP.Diagnostics.UDPEchoConfig.Enable", "false") })
+	return port
+}
+
+func get(t *testing.T, registry *params.Registry, name string) string {
+	t.Helper()
+	values, fault := registry.Get(exec.NewFixtureRunner(), []string{name})
+	if fault != nil {
+		t.Fatalf("GetParameterValues %s failed: %v", name, fault)
+	}
+	return values[0].Value.Content
+}
+
+func TestUDPEcho(t *testing.T) {
+	t.Run("EchoPlus", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{})
+		port := enableResponder(t, registry, true)
+		set(t, registry,
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.Host", "127.0.0.1",
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.Port", strconv.Itoa(port),
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.NumberOfRepetitions", "3",
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.InterTransmissionTime", "10",
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.DataBlockSize", "64",
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.EnableIndividualPacketResults", "true",
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			"DiagnosticsState":                                   "Complete",
+			"IPAddressUsed":                                      "127.0.0.1",
+			"SuccessCount":                                       "3",
+			"FailureCount":                                       "0",
+			"IndividualPacketResultNumberOfEntries":              "3",
+			"IndividualPacketResult.1.PacketSuccess":             "true",
+			"IndividualPacketResult.1.TestGenSN":                 "1",
+			"IndividualPacketResult.1.TestRespSN":                "0",
+			"IndividualPacketResult.3.TestGenSN":                 "3",
+			"IndividualPacketResult.3.TestRespSN":                "2",
+			"IndividualPacketResult.3.TestRespReplyFailureCount": "0",
+		}
+		for name, want := range expected {
+			if got := values["Device.IP.Diagnostics.UDPEchoDiagnostics."+name]; got != want {
+				t.Errorf("%s: expected %q, got %q", name, want, got)
+			}
+		}
+		first, _ := strconv.Atoi(values["Device.IP.Diagnostics.UDPEchoDiagnostics.IndividualPacketResult.1.TestRespRcvTimeStamp"])
+		last, _ := strconv.Atoi(values["Device.IP.Diagnostics.UDPEchoDiagnostics.IndividualPacketResult.3.TestRespRcvTimeStamp"])
+		if last-first < 20000 {
+			t.Errorf("Expected the responder timestamps 20ms apart, got %d and %d", first, last)
+		}
+
+		// The responder counts the packets it answered
+		if received := get(t, registry, "Device.IP.Diagnostics.UDPEchoConfig.PacketsReceived"); received != "3" {
+			t.Errorf("Expected 3 packets received, got %s", received)
+		}
+		if responded := get(t, registry, "Device.IP.Diagnostics.UDPEchoConfig.BytesResponded"); responded != "192" {
+			t.Errorf("Expected 192 bytes responded, got %s", responded)
+		}
+		if first := get(t, registry, "Device.IP.Diagnostics.UDPEchoConfig.TimeFirstPacketReceived"); first == "0001-01-01T00:00:00Z" {
+			t.Error("Expected TimeFirstPacketReceived to be set")
+		}
+	})
+
+	t.Run("SourceIPAddress", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{})
+		port := enableResponder(t, registry, false)
+		set(t, registry, "Device.IP.Diagnostics.UDPEchoConfig.SourceIPAddress", "192.0.2.1")
+		set(t, registry,
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.Host", "127.0.0.1",
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.Port", strconv.Itoa(port),
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.Timeout", "100",
+			"Device.IP.Diagnostics.UDPEchoDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		if failures, _ := store.Get("Device.IP.Diagnostics.UDPEchoDiagnostics.FailureCount"); failures != "1" {
+			t.Errorf("Expected the packet from another source to be ignored, got FailureCount %q", failures)
+		}
+		if received := get(t, registry, "Device.IP.Diagnostics.UDPEchoConfig.PacketsReceived"); received != "0" {
+			t.Errorf("Expected no packets received, got %s", received)
+		}
+	})
+}
+
+// addrPinger answers the listed addresses with a fixed round trip time
+type addrPinger map[string]time.Duration
+
+func (p addrPinger) Ping(_ context.Context, req diagnostics.PingRequest) (time.Duration, error) {
+	if rtt, ok := p[req.Addr.String()]; ok {
+		return rtt, nil
+	}
+	return 0, errors.New("i/o timeout")
+}
+
+func TestServerSelection(t *testing.T) {
+	t.Run("ICMP", func(t *testing.T) {
+		pinger := addrPinger{"192.0.2.10": 30 * time.Millisecond, "198.51.100.1": 1200 * time.Microsecond}
+		registry, done := newManager(t, pinger)
+		set(t, registry,
+			"Device.IP.Diagnostics.ServerSelectionDiagnostics.HostList", "acs.example.com, gw.example.com,unknown.example.com,192.0.2.99",
+			"Device.IP.Diagnostics.ServerSelectionDiagnostics.ProtocolVersion", "IPv4",
+			"Device.IP.Diagnostics.ServerSelectionDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			"DiagnosticsState":    "Complete",
+			"FastestHost":         "gw.example.com",
+			"IPAddressUsed":       "198.51.100.1",
+			"MinimumResponseTime": "1200",
+			"AverageResponseTime": "1200",
+			"MaximumResponseTime": "1200",
+		}
+		for name, want := range expected {
+			if got := values["Device.IP.Diagnostics.ServerSelectionDiagnostics."+name]; got != want {
+				t.Errorf("%s: expected %q, got %q", name, want, got)
+			}
+		}
+	})
+
+	t.Run("UDPEcho", func(t *testing.T) {
+		registry, done := newManager(t, addrPinger{})
+		port := enableResponder(t, registry, true)
+		set(t, registry,
+			"Device.IP.Diagnostics.ServerSelectionDiagnostics.HostList", "192.0.2.99,127.0.0.1",
+			"Device.IP.Diagnostics.ServerSelectionDiagnostics.Protocol", "UDP Echo",
+			"Device.IP.Diagnostics.ServerSelectionDiagnostics.Port", strconv.Itoa(port),
+			"Device.IP.Diagnostics.ServerSelectionDiagnostics.Timeout", "100",
+			"Device.IP.Diagnostics.ServerSelectionDiagnostics.DiagnosticsState", "Requested",
+		)
+		wait(t, done)
+		if fastest, _ := store.Get("Device.IP.Diagnostics.ServerSelectionDiagnostics.FastestHost"); fastest != "127.0.0.1" {
+			t.Errorf("Expected 127.0.0.1 to be the fastest host, got %q", fastest)
+		}
+	})
+
+	t.Run("TooManyHosts", func(t *testing.T) {
+		registry, _ := newManager(t, addrPinger{})
+		list := "h1,h2,h3,h4,h5,h6,h7,h8,h9,h10,h11"
+		if faults := registry.Set(soapValues("Device.IP.Diagnostics.ServerSelectionDiagnostics.HostList", list)); len(faults) != 1 {
+			t.Errorf("Expected a fault for 11 hosts, got %v", faults)
+		}
+	})
+}
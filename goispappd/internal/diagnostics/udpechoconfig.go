@@ -0,0 +1,202 @@
+package diagnostics
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const udpEchoConfigPrefix = "Device.IP.Diagnostics.UDPEchoConfig."
+
+// echoPlusHeader is the size of the TR-143 UDPEchoPlus fields: TestGenSN,
+// TestRespSN, TestRespRecvTimeStamp, TestRespReplyTimeStamp and
+// TestRespReplyFailureCount, each a 32 bit big endian integer
+const echoPlusHeader = 20
+
+// udpEchoConfigParams are the parameters of Device.IP.Diagnostics.UDPEchoConfig.
+var udpEchoConfigParams = map[string]params.Param{
+	"Enable":                  {Type: soap.TR069TypeBoolean, Writable: true, Default: "false"},
+	"Interface":               {Type: soap.TR069TypeString, Writable: true},
+	"SourceIPAddress":         {Type: soap.TR069TypeString, Writable: true, Check: checkIP},
+	"UDPPort":                 {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 65535)},
+	"EchoPlusEnabled":         {Type: soap.TR069TypeBoolean, Writable: true, Default: "false"},
+	"EchoPlusSupported":       {Type: soap.TR069TypeBoolean, Default: "true"},
+	"PacketsReceived":         {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"PacketsResponded":        {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"BytesReceived":           {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"BytesResponded":          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TimeFirstPacketReceived": {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"TimeLastPacketReceived":  {Type: soap.TR069TypeDateTime, Default: unknownTime},
+}
+
+// checkIP accepts an empty value or an IP address
+func checkIP(value string) error {
+	if value != "" && net.ParseIP(value) == nil {
+		return fmt.Errorf("invalid IP address %s", value)
+	}
+	return nil
+}
+
+// echoServer answers UDP echo requests, filling in the UDPEchoPlus fields
+// when enabled
+type echoServer struct {
+	conn    net.PacketConn
+	source  net.IP // Only packets from this address are answered when set
+	plus    bool
+	started time.Time // Origin of the UDPEchoPlus timestamps
+
+	mu               sync.Mutex
+	respSN           uint32
+	failures         uint32
+	packetsReceived  uint64
+	packetsResponded uint64
+	bytesReceived    uint64
+	bytesResponded   uint64
+	firstReceived    time.Time
+	lastReceived     time.Time
+}
+
+// listenEcho starts a responder on port, bound to device when set
+func listenEcho(device string, port int, source net.IP, plus bool) (*echoServer, error) {
+	config := &net.ListenConfig{Control: socketControl(device, 0, false)}
+	conn, err := config.ListenPacket(context.Background(), "udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	s := &echoServer{conn: conn, source: source, plus: plus, started: time.Now()}
+	go s.serve()
+	return s, nil
+}
+
+func (s *echoServer) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, from, err := s.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		received := time.Now()
+		if s.source != nil && !sourceIP(from).Equal(s.source) {
+			continue
+		}
+
+		s.mu.Lock()
+		if s.firstReceived.IsZero() {
+			s.firstReceived = received
+		}
+		s.lastReceived = received
+		s.packetsReceived++
+		s.bytesReceived += uint64(n)
+		packet := buf[:n]
+		if s.plus && n >= echoPlusHeader {
+			binary.BigEndian.PutUint32(packet[4:8], s.respSN)
+			binary.BigEndian.PutUint32(packet[8:12], s.timestamp(received))
+			binary.BigEndian.PutUint32(packet[16:20], s.failures)
+			binary.BigEndian.PutUint32(packet[12:16], s.timestamp(time.Now()))
+		}
+		if _, err := s.conn.WriteTo(packet, from); err != nil {
+			s.failures++
+		} else {
+			s.respSN++
+			s.packetsResponded++
+			s.bytesResponded += uint64(n)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// timestamp returns the microseconds since the responder started, wrapping at 32 bits
+func (s *echoServer) timestamp(t time.Time) uint32 {
+	return uint32(t.Sub(s.started).Microseconds())
+}
+
+func (s *echoServer) close() {
+	s.conn.Close()
+}
+
+// statistics returns the counters by relative name
+func (s *echoServer) statistics() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]string{
+		"PacketsReceived":         strconv.FormatUint(s.packetsReceived, 10),
+		"PacketsResponded":        strconv.FormatUint(s.packetsResponded, 10),
+		"BytesReceived":           strconv.FormatUint(s.bytesReceived, 10),
+		"BytesResponded":          strconv.FormatUint(s.bytesResponded, 10),
+		"TimeFirstPacketReceived": timestamp(s.firstReceived),
+		"TimeLastPacketReceived":  timestamp(s.lastReceived),
+	}
+}
+
+// applyEchoConfig stores the UDPEchoConfig values and restarts the responder
+func (m *Manager) applyEchoConfig(values map[string]string) error {
+	if err := store.Set(values); err != nil {
+		return err
+	}
+	return m.restartEcho()
+}
+
+// restartEcho (re)starts the responder from the stored UDPEchoConfig, the
+// counters restart with it
+func (m *Manager) restartEcho() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.echo != nil {
+		m.echo.close()
+		m.echo = nil
+	}
+
+	stored, err := store.Values()
+	if err != nil {
+		return err
+	}
+	in := make(map[string]string)
+	for name, param := range udpEchoConfigParams {
+		if value, ok := stored[udpEchoConfigPrefix+name]; ok && value != "" {
+			in[name] = value
+		} else {
+			in[name] = param.Default
+		}
+	}
+	if enabled, _ := strconv.ParseBool(in["Enable"]); !enabled {
+		return nil
+	}
+	port, _ := strconv.Atoi(in["UDPPort"])
+	if port == 0 {
+		return fmt.Errorf("UDPEchoConfig.UDPPort is not set")
+	}
+	device, err := m.device(context.Background(), in["Interface"])
+	if err != nil {
+		return err
+	}
+	plus, _ := strconv.ParseBool(in["EchoPlusEnabled"])
+	m.echo, err = listenEcho(device, port, net.ParseIP(in["SourceIPAddress"]), plus)
+	return err
+}
+
+// echoStatistics returns the live counters of the responder by full name
+func (m *Manager) echoStatistics() map[string]string {
+	m.mu.Lock()
+	echo := m.echo
+	m.mu.Unlock()
+	if echo == nil {
+		return nil
+	}
+	values := make(map[string]string)
+	for name, value := range echo.statistics() {
+		values[udpEchoConfigPrefix+name] = value
+	}
+	return values
+}
@@ -0,0 +1,61 @@
+package diagnostics
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const uploadPrefix = "Device.IP.Diagnostics.UploadDiagnostics."
+
+// uploadParams are the parameters of Device.IP.Diagnostics.UploadDiagnostics.
+var uploadParams = map[string]params.Param{
+	"DiagnosticsState":                            {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"Interface":                                   {Type: soap.TR069TypeString, Writable: true},
+	"UploadURL":                                   {Type: soap.TR069TypeString, Writable: true, Check: checkURL},
+	"DSCP":                                        {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 63)},
+	"EthernetPriority":                            {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "0", Check: params.Range(0, 7)},
+	"TestFileLength":                              {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "1048576", Check: params.Range(1, 4294967295)},
+	"ProtocolVersion":                             {Type: soap.TR069TypeString, Writable: true, Enum: []string{"Any", "IPv4", "IPv6"}, Default: "Any"},
+	"NumberOfConnections":                         {Type: soap.TR069TypeUnsignedInt, Writable: true, Default: "1", Check: params.Range(1, maxConnections)},
+	"EnablePerConnectionResults":                  {Type: soap.TR069TypeBoolean, Writable: true, Default: "false"},
+	"IPAddressUsed":                               {Type: soap.TR069TypeString},
+	"ROMTime":                                     {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"BOMTime":                                     {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"EOMTime":                                     {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"TestBytesSent":                               {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TotalBytesReceived":                          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TotalBytesSent":                              {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TestBytesSentUnderFullLoading":               {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TotalBytesReceivedUnderFullLoading":          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TotalBytesSentUnderFullLoading":              {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"PeriodOfFullLoading":                         {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"TCPOpenRequestTime":                          {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"TCPOpenResponseTime":                         {Type: soap.TR069TypeDateTime, Default: unknownTime},
+	"PerConnectionResultNumberOfEntries":          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"PerConnectionResult.{i}.ROMTime":             {Type: soap.TR069TypeDateTime},
+	"PerConnectionResult.{i}.BOMTime":             {Type: soap.TR069TypeDateTime},
+	"PerConnectionResult.{i}.EOMTime":             {Type: soap.TR069TypeDateTime},
+	"PerConnectionResult.{i}.TestBytesSent":       {Type: soap.TR069TypeUnsignedInt},
+	"PerConnectionResult.{i}.TCPOpenRequestTime":  {Type: soap.TR069TypeDateTime},
+	"PerConnectionResult.{i}.TCPOpenResponseTime": {Type: soap.TR069TypeDateTime},
+}
+
+// runUpload sends TestFileLength bytes to UploadURL with an HTTP PUT on each
+// of NumberOfConnections parallel connections
+func (m *Manager) runUpload(ctx context.Context, in map[string]string) map[string]string {
+	length, _ := strconv.ParseInt(in["TestFileLength"], 10, 64)
+	result, addr, state := m.runTransfer(ctx, in, in["UploadURL"], length)
+	if state != StateComplete {
+		if state == "" {
+			return nil
+		}
+		return map[string]string{"DiagnosticsState": state}
+	}
+	perConnection, _ := strconv.ParseBool(in["EnablePerConnectionResults"])
+	out := transferResults(result, perConnection, func(c *connectionResult) int64 { return c.Sent.Load() }, "TestBytesSent")
+	out["IPAddressUsed"] = addr
+	return out
+}
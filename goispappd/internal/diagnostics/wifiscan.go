@@ -0,0 +1,70 @@
+package diagnostics
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+const neighboringWiFiPrefix = "Device.WiFi.NeighboringWiFiDiagnostic."
+
+// neighboringWiFiParams are the parameters of the neighbour scan
+var neighboringWiFiParams = map[string]params.Param{
+	"DiagnosticsState":                     {Type: soap.TR069TypeString, Writable: true, Enum: []string{StateRequested}, Default: StateNone},
+	"ResultNumberOfEntries":                {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"Result.{i}.Radio":                     {Type: soap.TR069TypeString},
+	"Result.{i}.SSID":                      {Type: soap.TR069TypeString},
+	"Result.{i}.BSSID":                     {Type: soap.TR069TypeString},
+	"Result.{i}.Channel":                   {Type: soap.TR069TypeUnsignedInt},
+	"Result.{i}.SignalStrength":            {Type: soap.TR069TypeInt},
+	"Result.{i}.OperatingFrequencyBand":    {Type: soap.TR069TypeString},
+	"Result.{i}.OperatingStandards":        {Type: soap.TR069TypeString},
+	"Result.{i}.OperatingChannelBandwidth": {Type: soap.TR069TypeString},
+	"Result.{i}.Noise":                     {Type: soap.TR069TypeInt},
+}
+
+// WiFiScanner lists the networks the radios hear
+type WiFiScanner interface {
+	Scan(ctx context.Context) ([]device.NeighboringWiFiResult, error)
+}
+
+// WithWiFiScanner sets the radios of the neighbour scan, it fails with
+// Error_Internal without them
+func WithWiFiScanner(scanner WiFiScanner) Option {
+	return func(m *Manager) { m.radios = scanner }
+}
+
+// runNeighboringWiFi scans the neighbouring networks of every radio
+func (m *Manager) runNeighboringWiFi(ctx context.Context, _ map[string]string) map[string]string {
+	if m.radios == nil {
+		return map[string]string{"DiagnosticsState": StateErrorInternal}
+	}
+	networks, err := m.radios.Scan(ctx)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return map[string]string{"DiagnosticsState": StateErrorOther, "ResultNumberOfEntries": "0"}
+	}
+	results := map[string]string{
+		"DiagnosticsState":      StateComplete,
+		"ResultNumberOfEntries": strconv.Itoa(len(networks)),
+	}
+	for i, network := range networks {
+		name := "Result." + strconv.Itoa(i+1) + "."
+		results[name+"Radio"] = network.Radio
+		results[name+"SSID"] = network.SSID
+		results[name+"BSSID"] = network.BSSID
+		results[name+"Channel"] = strconv.Itoa(network.Channel)
+		results[name+"SignalStrength"] = strconv.Itoa(network.SignalStrength)
+		results[name+"OperatingFrequencyBand"] = network.OperatingFrequencyBand
+		results[name+"OperatingStandards"] = strings.Join(network.OperatingStandards, ",")
+		results[name+"OperatingChannelBandwidth"] = network.OperatingChannelBandwidth
+		results[name+"Noise"] = strconv.Itoa(network.Noise)
+	}
+	return results
+}
@@ -0,0 +1,76 @@
+package diagnostics_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/diagnostics"
+	"github.com/Niceblueman/goispappd/internal/store"
+)
+
+// fakeRadios returns scripted neighbours
+type fakeRadios struct {
+	networks []device.NeighboringWiFiResult
+	err      error
+}
+
+func (r *fakeRadios) Scan(context.Context) ([]device.NeighboringWiFiResult, error) {
+	return r.networks, r.err
+}
+
+func TestNeighboringWiFiDiagnostic(t *testing.T) {
+	prefix := "Device.WiFi.NeighboringWiFiDiagnostic."
+
+	t.Run("Complete", func(t *testing.T) {
+		radios := &fakeRadios{networks: []device.NeighboringWiFiResult{
+			{Radio: "Device.WiFi.Radio.2.", SSID: "office", BSSID: "3c:37:86:aa:bb:02", Channel: 36, SignalStrength: -60,
+				OperatingFrequencyBand: "5GHz", OperatingStandards: []string{"a", "n", "ac"}, OperatingChannelBandwidth: "80MHz", Noise: -95},
+			{Radio: "Device.WiFi.Radio.1.", SSID: "neighbour", BSSID: "3c:37:86:aa:bb:01", Channel: 6, SignalStrength: -71,
+				OperatingFrequencyBand: "2.4GHz", OperatingStandards: []string{"b", "g", "n"}, OperatingChannelBandwidth: "20MHz", Noise: -95},
+		}}
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithWiFiScanner(radios))
+		set(t, registry, prefix+"DiagnosticsState", "Requested")
+		wait(t, done)
+
+		values, err := store.Values()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{
+			"DiagnosticsState":                   "Complete",
+			"ResultNumberOfEntries":              "2",
+			"Result.1.Radio":                     "Device.WiFi.Radio.2.",
+			"Result.1.OperatingStandards":        "a,n,ac",
+			"Result.1.OperatingChannelBandwidth": "80MHz",
+			"Result.2.Radio":                     "Device.WiFi.Radio.1.",
+			"Result.2.BSSID":                     "3c:37:86:aa:bb:01",
+			"Result.2.Channel":                   "6",
+			"Result.2.SignalStrength":            "-71",
+			"Result.2.Noise":                     "-95",
+		}
+		for name, want := range expected {
+			if got := values[prefix+name]; got != want {
+				t.Errorf("%s: expected %q, got %q", name, want, got)
+			}
+		}
+
+		// A later scan replaces the results of the earlier one
+		radios.networks = radios.networks[:1]
+		set(t, registry, prefix+"DiagnosticsState", "Requested")
+		wait(t, done)
+		if got, _ := store.Get(prefix + "Result.2.BSSID"); got != "" {
+			t.Errorf("Expected the second result to be dropped, got %q", got)
+		}
+	})
+
+	t.Run("NoRadio", func(t *testing.T) {
+		registry, done := newManager(t, &fakePinger{}, diagnostics.WithWiFiScanner(&fakeRadios{err: errors.New("no wireless backend")}))
+		set(t, registry, prefix+"DiagnosticsState", "Requested")
+		wait(t, done)
+		if got, _ := store.Get(prefix + "DiagnosticsState"); got != "Error_Other" {
+			t.Errorf("Expected Error_Other, got %q", got)
+		}
+	})
+}
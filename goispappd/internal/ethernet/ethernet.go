@@ -0,0 +1,361 @@
+// Package ethernet maps TR-181 Device.Ethernet to the network devices of
+// /sys/class/net. An Interface is a physical port, a DSA switch port
+// included, and a Link is a layer 2 device IP runs on: a bridge, a port
+// outside any bridge or a VLAN.
+package ethernet
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mdlayher/netlink"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// Prefix is the object mapped by the package
+const Prefix = "Device.Ethernet."
+
+// Tables below Prefix, also the prefixes of their references
+const (
+	interfacePrefix = Prefix + "Interface."
+	linkPrefix      = Prefix + "Link."
+)
+
+// statsParams are the Stats parameters of the Interface and Link tables
+var statsParams = []string{
+	"BytesSent", "BytesReceived", "PacketsSent", "PacketsReceived",
+	"ErrorsSent", "ErrorsReceived", "DiscardPacketsSent", "DiscardPacketsReceived",
+}
+
+// ethernetParams are the parameters of Device.Ethernet.
+var ethernetParams = func() map[string]params.Param {
+	p := map[string]params.Param{
+		"InterfaceNumberOfEntries":         {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+		"LinkNumberOfEntries":              {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+		"Interface.{i}.Enable":             {Type: soap.TR069TypeBoolean},
+		"Interface.{i}.Status":             {Type: soap.TR069TypeString},
+		"Interface.{i}.Name":               {Type: soap.TR069TypeString},
+		"Interface.{i}.LowerLayers":        {Type: soap.TR069TypeString},
+		"Interface.{i}.MACAddress":         {Type: soap.TR069TypeString},
+		"Interface.{i}.MaxBitRate":         {Type: soap.TR069TypeInt},
+		"Interface.{i}.CurrentBitRate":     {Type: soap.TR069TypeUnsignedInt},
+		"Interface.{i}.DuplexMode":         {Type: soap.TR069TypeString},
+		"Interface.{i}.X_ISPAPP_LinkDowns": {Type: soap.TR069TypeUnsignedInt},
+		"Link.{i}.Enable":                  {Type: soap.TR069TypeBoolean},
+		"Link.{i}.Status":                  {Type: soap.TR069TypeString},
+		"Link.{i}.Name":                    {Type: soap.TR069TypeString},
+		"Link.{i}.LowerLayers":             {Type: soap.TR069TypeString},
+		"Link.{i}.MACAddress":              {Type: soap.TR069TypeString},
+	}
+	for _, stat := range statsParams {
+		p["Interface.{i}.Stats."+stat] = params.Param{Type: soap.TR069TypeUnsignedInt}
+		p["Link.{i}.Stats."+stat] = params.Param{Type: soap.TR069TypeUnsignedInt}
+	}
+	return p
+}()
+
+// operStatus maps the RFC 2863 operstate of sysfs to the TR-181 Status
+var operStatus = map[string]string{
+	"up":             "Up",
+	"down":           "Down",
+	"dormant":        "Dormant",
+	"lowerlayerdown": "LowerLayerDown",
+	"notpresent":     "NotPresent",
+}
+
+// Manager reads the Ethernet devices and counts their link down events
+type Manager struct {
+	reader    Reader
+	mu        sync.Mutex
+	conn      *netlink.Conn   // Link event subscription, nil until Start
+	carrier   map[string]bool // Carrier of each device as of the last event
+	linkDowns map[string]int  // Carrier losses by device since Start
+}
+
+// NewManager creates a Manager reading the devices with reader
+func NewManager(reader Reader) *Manager {
+	return &Manager{reader: reader, carrier: map[string]bool{}, linkDowns: map[string]int{}}
+}
+
+// Register adds Device.Ethernet. to registry, the link down counters are
+// served live
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{
+		Prefix: Prefix,
+		Params: ethernetParams,
+		Values: m.live,
+	})
+}
+
+// live returns the link down counters of the stored interfaces
+func (m *Manager) live() map[string]string {
+	stored, err := store.Values()
+	if err != nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn == nil {
+		return nil
+	}
+	values := make(map[string]string)
+	for name, index := range storedIndices(stored, interfacePrefix) {
+		values[fmt.Sprintf("%s%d.X_ISPAPP_LinkDowns", interfacePrefix, index)] = strconv.Itoa(m.linkDowns[name])
+	}
+	return values
+}
+
+// storedName matches the stored Name of the Interface and Link entries
+var storedName = regexp.MustCompile(`^(` + regexp.QuoteMeta(interfacePrefix) + `|` + regexp.QuoteMeta(linkPrefix) + `)(\d+)\.Name$`)
+
+// storedIndices maps the Name of the stored entries of a table to their index
+func storedIndices(stored map[string]string, prefix string) map[string]int {
+	indices := make(map[string]int)
+	for key, value := range stored {
+		if match := storedName.FindStringSubmatch(key); match != nil && match[1] == prefix && value != "" {
+			indices[value], _ = strconv.Atoi(match[2])
+		}
+	}
+	return indices
+}
+
+// number keeps the stored index of each name and numbers the new names after
+// the highest one in name order
+func number(names []string, stored map[string]int) map[string]int {
+	indices := make(map[string]int)
+	used := make(map[int]bool)
+	highest := 0
+	for _, index := range stored {
+		highest = max(highest, index)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if index, ok := stored[name]; ok && !used[index] {
+			indices[name] = index
+			used[index] = true
+		}
+	}
+	for _, name := range names {
+		if _, ok := indices[name]; !ok {
+			highest++
+			indices[name] = highest
+		}
+	}
+	return indices
+}
+
+// status maps the state of a device to the TR-181 Status, a device without
+// RFC 2863 support reports unknown and is up when it has a carrier
+func status(d Device) string {
+	if s, ok := operStatus[d.OperState]; ok {
+		return s
+	}
+	if d.OperState == "unknown" {
+		if d.Up && d.Carrier {
+			return "Up"
+		}
+		return "Down"
+	}
+	return "Unknown"
+}
+
+// isInterface reports whether a device is a physical Ethernet port
+func isInterface(d Device) bool {
+	return d.Type == arphrdEther && d.Physical && !d.Wireless && !d.Conduit
+}
+
+// isLink reports whether a device is a layer 2 device IP can run on, the
+// ports of a bridge are carried by the bridge link
+func isLink(d Device, byName map[string]Device) bool {
+	if d.Type != arphrdEther || d.Wireless || d.Conduit {
+		return false
+	}
+	for _, upper := range d.Uppers {
+		if byName[upper].Bridge {
+			return false
+		}
+	}
+	return d.Physical || d.Bridge || len(d.Lowers) > 0
+}
+
+// Ethernet returns the Ethernet interfaces and links
+func (m *Manager) Ethernet() (*device.EthernetDevice, error) {
+	stored, err := store.Values()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ethernet(stored)
+}
+
+func (m *Manager) ethernet(stored map[string]string) (*device.EthernetDevice, error) {
+	devices, err := m.reader.Devices()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]Device)
+	var ports, links []string
+	for _, d := range devices {
+		byName[d.Name] = d
+		if isInterface(d) {
+			ports = append(ports, d.Name)
+		}
+	}
+	for _, d := range devices {
+		if isLink(d, byName) {
+			links = append(links, d.Name)
+		}
+	}
+	portIndices := number(ports, storedIndices(stored, interfacePrefix))
+	linkIndices := number(links, storedIndices(stored, linkPrefix))
+
+	// reference resolves a device to its Interface, or to its Link when it is
+	// no port, e.g. the parent of a VLAN
+	reference := func(name string) string {
+		if index, ok := portIndices[name]; ok {
+			return fmt.Sprintf("%s%d.", interfacePrefix, index)
+		}
+		if index, ok := linkIndices[name]; ok {
+			return fmt.Sprintf("%s%d.", linkPrefix, index)
+		}
+		return ""
+	}
+
+	eth := &device.EthernetDevice{}
+	for _, name := range ports {
+		d := byName[name]
+		iface := device.EthernetInterface{
+			Index:              portIndices[name],
+			Enable:             d.Up,
+			Status:             status(d),
+			Name:               name,
+			MACAddress:         d.MAC,
+			MaxBitRate:         d.MaxSpeed,
+			DuplexMode:         "Auto",
+			X_ISPAPP_LinkDowns: m.linkDowns[name],
+			Stats:              d.Stats,
+		}
+		if iface.Status == "Up" {
+			iface.CurrentBitRate = d.Speed
+			switch d.Duplex {
+			case "full":
+				iface.DuplexMode = "Full"
+			case "half":
+				iface.DuplexMode = "Half"
+			}
+		}
+		eth.Interfaces = append(eth.Interfaces, iface)
+	}
+	for _, name := range links {
+		d := byName[name]
+		link := device.EthernetLink{
+			Index:      linkIndices[name],
+			Enable:     d.Up,
+			Status:     status(d),
+			Name:       name,
+			MACAddress: d.MAC,
+			Stats:      d.Stats,
+		}
+		var lowers []string
+		switch {
+		case isInterface(d):
+			lowers = []string{reference(name)}
+		case d.Bridge:
+			// The bridge ports, a VLAN port stands for the port it is on
+			for _, port := range d.Lowers {
+				if ref := reference(port); strings.HasPrefix(ref, interfacePrefix) {
+					lowers = append(lowers, ref)
+					continue
+				}
+				for _, lower := range byName[port].Lowers {
+					if ref := reference(lower); ref != "" {
+						lowers = append(lowers, ref)
+					}
+				}
+			}
+		default:
+			for _, lower := range d.Lowers {
+				if ref := reference(lower); ref != "" {
+					lowers = append(lowers, ref)
+				}
+			}
+		}
+		link.LowerLayers = strings.Join(lowers, ",")
+		eth.Links = append(eth.Links, link)
+	}
+	sort.Slice(eth.Interfaces, func(i, j int) bool { return eth.Interfaces[i].Index < eth.Interfaces[j].Index })
+	sort.Slice(eth.Links, func(i, j int) bool { return eth.Links[i].Index < eth.Links[j].Index })
+	eth.InterfaceNumberOfEntries = len(eth.Interfaces)
+	eth.LinkNumberOfEntries = len(eth.Links)
+	return eth, nil
+}
+
+// Collect stores the Ethernet interfaces and links in the tr069 store
+func (m *Manager) Collect() error {
+	stored, err := store.Values()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	eth, err := m.ethernet(stored)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return store.Replace([]string{interfacePrefix, linkPrefix}, Values(eth))
+}
+
+// Values flattens the Ethernet interfaces and links into parameters keyed by
+// full name
+func Values(eth *device.EthernetDevice) map[string]string {
+	values := map[string]string{
+		Prefix + "InterfaceNumberOfEntries": strconv.Itoa(eth.InterfaceNumberOfEntries),
+		Prefix + "LinkNumberOfEntries":      strconv.Itoa(eth.LinkNumberOfEntries),
+	}
+	stats := func(name string, s device.InterfaceStats) {
+		for stat, value := range map[string]uint64{
+			"BytesSent":              s.BytesSent,
+			"BytesReceived":          s.BytesReceived,
+			"PacketsSent":            s.PacketsSent,
+			"PacketsReceived":        s.PacketsReceived,
+			"ErrorsSent":             uint64(s.ErrorsSent),
+			"ErrorsReceived":         uint64(s.ErrorsReceived),
+			"DiscardPacketsSent":     uint64(s.DiscardPacketsSent),
+			"DiscardPacketsReceived": uint64(s.DiscardPacketsReceived),
+		} {
+			values[name+"Stats."+stat] = strconv.FormatUint(value, 10)
+		}
+	}
+	for _, i := range eth.Interfaces {
+		name := fmt.Sprintf("%s%d.", interfacePrefix, i.Index)
+		values[name+"Enable"] = strconv.FormatBool(i.Enable)
+		values[name+"Status"] = i.Status
+		values[name+"Name"] = i.Name
+		values[name+"LowerLayers"] = i.LowerLayers
+		values[name+"MACAddress"] = i.MACAddress
+		values[name+"MaxBitRate"] = strconv.Itoa(i.MaxBitRate)
+		values[name+"CurrentBitRate"] = strconv.Itoa(i.CurrentBitRate)
+		values[name+"DuplexMode"] = i.DuplexMode
+		values[name+"X_ISPAPP_LinkDowns"] = strconv.Itoa(i.X_ISPAPP_LinkDowns)
+		stats(name, i.Stats)
+	}
+	for _, l := range eth.Links {
+		name := fmt.Sprintf("%s%d.", linkPrefix, l.Index)
+		values[name+"Enable"] = strconv.FormatBool(l.Enable)
+		values[name+"Status"] = l.Status
+		values[name+"Name"] = l.Name
+		values[name+"LowerLayers"] = l.LowerLayers
+		values[name+"MACAddress"] = l.MACAddress
+		stats(name, l.Stats)
+	}
+	return values
+}
@@ -0,0 +1,122 @@
+package ethernet_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Niceblueman/goispappd/internal/ethernet"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// netDevice adds the attributes of one device to fsys
+func netDevice(fsys fstest.MapFS, name string, attributes ...string) {
+	for i := 0; i < len(attributes); i += 2 {
+		fsys[name+"/"+attributes[i]] = &fstest.MapFile{Data: []byte(attributes[i+1] + "\n")}
+	}
+}
+
+// newSysfs emulates a router with a DSA switch: lan1 and lan2 are bridged in
+// br-lan, wan carries a VLAN, and the conduit, the radio and the loopback are
+// no Ethernet
+func newSysfs() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	netDevice(fsys, "lo", "type", "772", "flags", "0x9", "operstate", "unknown", "address", "00:00:00:00:00:00")
+	netDevice(fsys, "eth0", "type", "1", "flags", "0x1003", "operstate", "up", "carrier", "1",
+		"address", "02:00:00:00:00:01", "device", "", "dsa/tagging", "mtk")
+	netDevice(fsys, "lan1", "type", "1", "flags", "0x1003", "operstate", "up", "carrier", "1",
+		"address", "02:00:00:00:00:01", "device", "", "speed", "1000", "duplex", "full",
+		"upper_br-lan", "", "statistics/rx_bytes", "1500", "statistics/tx_bytes", "3000",
+		"statistics/rx_packets", "10", "statistics/tx_packets", "20", "statistics/rx_dropped", "1")
+	netDevice(fsys, "lan2", "type", "1", "flags", "0x1003", "operstate", "lowerlayerdown", "carrier", "0",
+		"address", "02:00:00:00:00:01", "device", "", "speed", "-1", "duplex", "unknown", "upper_br-lan", "")
+	netDevice(fsys, "wan", "type", "1", "flags", "0x1003", "operstate", "up", "carrier", "1",
+		"address", "02:00:00:00:00:02", "device", "", "speed", "100", "duplex", "half", "upper_wan.100", "")
+	netDevice(fsys, "br-lan", "type", "1", "flags", "0x1003", "operstate", "up", "carrier", "1",
+		"address", "02:00:00:00:00:01", "bridge/stp_state", "0", "lower_lan1", "", "lower_lan2", "",
+		"statistics/rx_bytes", "4096")
+	netDevice(fsys, "wan.100", "type", "1", "flags", "0x1003", "operstate", "up", "carrier", "1",
+		"address", "02:00:00:00:00:02", "lower_wan", "")
+	netDevice(fsys, "phy0-ap0", "type", "1", "flags", "0x1003", "operstate", "up", "carrier", "1",
+		"address", "02:00:00:00:00:03", "device", "", "phy80211/index", "0", "upper_br-lan", "")
+	return fsys
+}
+
+// maxSpeed stands in for ethtool, the conduit has no link modes
+func maxSpeed(name string) (int, error) {
+	switch name {
+	case "lan1", "lan2":
+		return 1000, nil
+	case "wan":
+		return 2500, nil
+	}
+	return 0, errors.New("operation not supported")
+}
+
+func expectStored(t *testing.T, expected map[string]string) {
+	t.Helper()
+	for name, want := range expected {
+		if got, _ := store.Get(name); got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	store.Path = filepath.Join(t.TempDir(), "tr069")
+	t.Cleanup(func() { store.Path = "/etc/config/tr069" })
+	// wan was seen before and keeps its instance
+	if err := store.Set(map[string]string{"Device.Ethernet.Interface.1.Name": "wan"}); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := ethernet.NewManager(ethernet.SysfsReader{FS: newSysfs(), MaxSpeed: maxSpeed})
+	if err := manager.Collect(); err != nil {
+		t.Fatal(err)
+	}
+
+	interfaces, links := "Device.Ethernet.Interface.", "Device.Ethernet.Link."
+	expectStored(t, map[string]string{
+		"Device.Ethernet.InterfaceNumberOfEntries":    "3",
+		"Device.Ethernet.LinkNumberOfEntries":         "3",
+		interfaces + "1.Name":                         "wan",
+		interfaces + "1.MaxBitRate":                   "2500",
+		interfaces + "1.CurrentBitRate":               "100",
+		interfaces + "1.DuplexMode":                   "Half",
+		interfaces + "2.Name":                         "lan1",
+		interfaces + "2.Status":                       "Up",
+		interfaces + "2.Enable":                       "true",
+		interfaces + "2.MACAddress":                   "02:00:00:00:00:01",
+		interfaces + "2.DuplexMode":                   "Full",
+		interfaces + "2.X_ISPAPP_LinkDowns":           "0",
+		interfaces + "2.Stats.BytesReceived":          "1500",
+		interfaces + "2.Stats.PacketsSent":            "20",
+		interfaces + "2.Stats.DiscardPacketsReceived": "1",
+		interfaces + "3.Name":                         "lan2",
+		interfaces + "3.Status":                       "LowerLayerDown",
+		interfaces + "3.CurrentBitRate":               "0",
+		interfaces + "3.DuplexMode":                   "Auto",
+		links + "1.Name":                              "br-lan",
+		links + "1.LowerLayers":                       interfaces + "2.," + interfaces + "3.",
+		links + "1.Stats.BytesReceived":               "4096",
+		links + "2.Name":                              "wan",
+		links + "2.LowerLayers":                       interfaces + "1.",
+		links + "3.Name":                              "wan.100",
+		links + "3.LowerLayers":                       interfaces + "1.",
+	})
+	if got, _ := store.Get(interfaces + "4.Name"); got != "" {
+		t.Errorf("Expected no more interfaces, got %q", got)
+	}
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		registry := params.NewRegistry()
+		manager.Register(registry)
+		faults := registry.Set([]soap.SetParameterValueStruct{{Name: interfaces + "1.MaxBitRate", Value: "1000"}})
+		if len(faults) != 1 || faults[0].Code != params.FaultNotWritable {
+			t.Errorf("Expected the interfaces to be read-only, got %v", faults)
+		}
+	})
+}
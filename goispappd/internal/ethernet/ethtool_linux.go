@@ -0,0 +1,69 @@
+package ethernet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// ethtool ioctl values from linux/ethtool.h and linux/sockios.h
+const (
+	siocEthtool          = 0x8946 // SIOCETHTOOL
+	ethtoolGLinkSettings = 0x4c   // ETHTOOL_GLINKSETTINGS
+	linkSettingsLength   = 48     // sizeof(struct ethtool_link_settings)
+	linkModeNwords       = 15     // Offset of link_mode_masks_nwords
+)
+
+// ifreq is struct ifreq with ifr_data
+type ifreq struct {
+	name [syscall.IFNAMSIZ]byte
+	data uintptr
+	_    [16]byte
+}
+
+// ethtoolMaxSpeed returns the highest speed a device supports. The size of
+// the link mode bitmaps is negotiated first, the kernel answers a request
+// without bitmaps with their size negated
+func ethtoolMaxSpeed(name string) (int, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.Close(fd)
+
+	settings := make([]byte, linkSettingsLength)
+	if err := linkSettings(fd, name, settings); err != nil {
+		return 0, err
+	}
+	nwords := -int(int8(settings[linkModeNwords]))
+	if nwords <= 0 {
+		return 0, fmt.Errorf("%s: no link mode bitmaps", name)
+	}
+	// supported, advertising and lp_advertising follow the settings
+	settings = make([]byte, linkSettingsLength+3*4*nwords)
+	settings[linkModeNwords] = byte(nwords)
+	if err := linkSettings(fd, name, settings); err != nil {
+		return 0, err
+	}
+	supported := make([]uint32, nwords)
+	for i := range supported {
+		supported[i] = binary.NativeEndian.Uint32(settings[linkSettingsLength+4*i:])
+	}
+	return maxLinkSpeed(supported), nil
+}
+
+// linkSettings runs ETHTOOL_GLINKSETTINGS with settings as its buffer
+func linkSettings(fd int, name string, settings []byte) error {
+	binary.NativeEndian.PutUint32(settings, ethtoolGLinkSettings)
+	var request ifreq
+	copy(request.name[:len(request.name)-1], name)
+	request.data = uintptr(unsafe.Pointer(&settings[0]))
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), siocEthtool, uintptr(unsafe.Pointer(&request)))
+	runtime.KeepAlive(settings)
+	if errno != 0 {
+		return fmt.Errorf("ethtool %s: %w", name, errno)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package ethernet
+
+import "fmt"
+
+// ethtoolMaxSpeed needs the ethtool ioctl of Linux
+func ethtoolMaxSpeed(name string) (int, error) {
+	return 0, fmt.Errorf("ethtool is only supported on Linux")
+}
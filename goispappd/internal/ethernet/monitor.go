@@ -0,0 +1,105 @@
+package ethernet
+
+import (
+	"fmt"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+// rtnetlink values from linux/rtnetlink.h and linux/if_link.h, spelled out so
+// the parsing builds on every platform
+const (
+	netlinkRoute   = 0       // NETLINK_ROUTE
+	rtnlgrpLink    = 1       // RTNLGRP_LINK
+	rtmNewLink     = 16      // RTM_NEWLINK
+	iflaIfname     = 3       // IFLA_IFNAME
+	ifinfoLength   = 16      // sizeof(struct ifinfomsg)
+	iffLowerUp     = 0x10000 // IFF_LOWER_UP
+	ifinfoFlagsPos = 8       // Offset of ifi_flags
+)
+
+// Start counts the link down events of the devices until Close, the carrier
+// of every device is read first so the first event of a device is counted
+func (m *Manager) Start() error {
+	devices, err := m.reader.Devices()
+	if err != nil {
+		return err
+	}
+	conn, err := netlink.Dial(netlinkRoute, &netlink.Config{Groups: rtnlgrpLink})
+	if err != nil {
+		return fmt.Errorf("dial rtnetlink: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn != nil {
+		m.conn.Close()
+	}
+	m.conn = conn
+	for _, d := range devices {
+		m.carrier[d.Name] = d.Carrier
+	}
+	go m.watch(conn)
+	return nil
+}
+
+// Close stops counting the link down events
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+}
+
+// watch receives the link events until conn is closed
+func (m *Manager) watch(conn *netlink.Conn) {
+	for {
+		messages, err := conn.Receive()
+		if err != nil {
+			return
+		}
+		for _, message := range messages {
+			if message.Header.Type != rtmNewLink {
+				continue
+			}
+			if name, lowerUp, ok := parseLink(message.Data); ok {
+				m.linkEvent(name, lowerUp)
+			}
+		}
+	}
+}
+
+// linkEvent counts a link down when the carrier of a device is lost
+func (m *Manager) linkEvent(name string, lowerUp bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if up, known := m.carrier[name]; known && up && !lowerUp {
+		m.linkDowns[name]++
+	}
+	m.carrier[name] = lowerUp
+}
+
+// parseLink decodes an RTM_NEWLINK payload into the device name and whether
+// it has a carrier
+func parseLink(data []byte) (name string, lowerUp bool, ok bool) {
+	if len(data) < ifinfoLength {
+		return "", false, false
+	}
+	flags := nlenc.Uint32(data[ifinfoFlagsPos : ifinfoFlagsPos+4])
+	attrs, err := netlink.NewAttributeDecoder(data[ifinfoLength:])
+	if err != nil {
+		return "", false, false
+	}
+	for attrs.Next() {
+		if attrs.Type() == iflaIfname {
+			name = attrs.String()
+		}
+	}
+	if attrs.Err() != nil || name == "" {
+		return "", false, false
+	}
+	return name, flags&iffLowerUp != 0, true
+}
@@ -0,0 +1,58 @@
+package ethernet
+
+import (
+	"testing"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+// newLink encodes an RTM_NEWLINK payload
+func newLink(t *testing.T, name string, flags uint32) []byte {
+	t.Helper()
+	header := make([]byte, ifinfoLength)
+	nlenc.PutUint32(header[ifinfoFlagsPos:ifinfoFlagsPos+4], flags)
+	encoder := netlink.NewAttributeEncoder()
+	encoder.String(iflaIfname, name)
+	attrs, err := encoder.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(header, attrs...)
+}
+
+func TestLinkEvents(t *testing.T) {
+	m := NewManager(nil)
+	m.carrier["lan1"] = true
+	for _, flags := range []uint32{0x1003, 0x1003 | iffLowerUp, 0x1003, 0x1003, 0x1003 | iffLowerUp, 0x1003} {
+		name, lowerUp, ok := parseLink(newLink(t, "lan1", flags))
+		if !ok || name != "lan1" {
+			t.Fatalf("Expected an event of lan1, got %q", name)
+		}
+		m.linkEvent(name, lowerUp)
+	}
+	// Only the transitions from up count, the first event included
+	if m.linkDowns["lan1"] != 3 {
+		t.Errorf("Expected 3 link downs, got %d", m.linkDowns["lan1"])
+	}
+
+	if _, _, ok := parseLink([]byte{0, 1}); ok {
+		t.Error("Expected a short payload to be rejected")
+	}
+}
+
+func TestMaxLinkSpeed(t *testing.T) {
+	for _, tc := range []struct {
+		supported []uint32
+		want      int
+	}{
+		{nil, -1},
+		{[]uint32{0x3f}, 1000},                 // 10/100/1000baseT
+		{[]uint32{0x0f, 1 << (47 - 32)}, 2500}, // 2500baseT
+		{[]uint32{1 << 6}, -1},                 // Autoneg only
+	} {
+		if got := maxLinkSpeed(tc.supported); got != tc.want {
+			t.Errorf("%x: expected %d, got %d", tc.supported, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package ethernet
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/device"
+)
+
+// sysfsNet is where the kernel lists the network devices
+const sysfsNet = "/sys/class/net"
+
+// Values of /sys/class/net/<device>/type and flags
+const (
+	arphrdEther = 1   // ARPHRD_ETHER
+	iffUp       = 0x1 // IFF_UP
+)
+
+// Device is a network device of /sys/class/net
+type Device struct {
+	Name      string
+	Index     int // ifindex
+	Link      int // iflink, the ifindex of the conduit of a DSA port
+	Type      int // ARPHRD type, 1 for Ethernet
+	MAC       string
+	Up        bool   // IFF_UP
+	OperState string // RFC 2863 state, e.g. up or lowerlayerdown
+	Carrier   bool
+	Speed     int    // Negotiated speed in Mbps, 0 when unknown
+	Duplex    string // full, half or unknown
+	MaxSpeed  int    // Highest supported speed in Mbps, -1 when unknown
+	Physical  bool   // Backed by hardware, e.g. a PHY or a DSA switch port
+	Wireless  bool
+	Bridge    bool
+	Conduit   bool     // DSA conduit carrying the switch ports
+	Uppers    []string // Devices stacked on this one, e.g. its bridge
+	Lowers    []string // Devices this one is stacked on, e.g. the parent of a VLAN
+	Stats     device.InterfaceStats
+}
+
+// Reader lists the network devices
+type Reader interface {
+	Devices() ([]Device, error)
+}
+
+// SysfsReader reads the devices from /sys/class/net and their supported link
+// modes with ethtool
+type SysfsReader struct {
+	FS       fs.FS                          // /sys/class/net when nil
+	MaxSpeed func(name string) (int, error) // The ethtool ioctl when nil
+}
+
+// Devices implements Reader
+func (r SysfsReader) Devices() ([]Device, error) {
+	fsys, maxSpeed := r.FS, r.MaxSpeed
+	if fsys == nil {
+		fsys = os.DirFS(sysfsNet)
+	}
+	if maxSpeed == nil {
+		maxSpeed = ethtoolMaxSpeed
+	}
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("list network devices: %w", err)
+	}
+	var devices []Device
+	for _, entry := range entries {
+		d, err := readDevice(fsys, entry.Name())
+		if err != nil {
+			// The device went away while it was read
+			continue
+		}
+		d.MaxSpeed = -1
+		if d.Physical && d.Type == arphrdEther && !d.Wireless {
+			if speed, err := maxSpeed(d.Name); err == nil && speed > 0 {
+				d.MaxSpeed = speed
+			}
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// readDevice reads the attributes of one device
+func readDevice(fsys fs.FS, name string) (Device, error) {
+	read := func(attribute string) string {
+		data, err := fs.ReadFile(fsys, name+"/"+attribute)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	number := func(attribute string) int {
+		value, err := strconv.ParseInt(read(attribute), 0, 64)
+		if err != nil {
+			return 0
+		}
+		return int(value)
+	}
+	exists := func(attribute string) bool {
+		_, err := fs.Stat(fsys, name+"/"+attribute)
+		return err == nil
+	}
+
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return Device{}, err
+	}
+	d := Device{
+		Name:      name,
+		Index:     number("ifindex"),
+		Link:      number("iflink"),
+		Type:      number("type"),
+		MAC:       read("address"),
+		Up:        number("flags")&iffUp != 0,
+		OperState: read("operstate"),
+		Carrier:   read("carrier") == "1",
+		Duplex:    read("duplex"),
+		Physical:  exists("device"),
+		Wireless:  exists("wireless") || exists("phy80211"),
+		Bridge:    exists("bridge"),
+		Conduit:   exists("dsa"),
+	}
+	// speed reads -1 or fails with EINVAL while the link is down
+	if speed := number("speed"); speed > 0 {
+		d.Speed = speed
+	}
+	for _, entry := range entries {
+		if upper, ok := strings.CutPrefix(entry.Name(), "upper_"); ok {
+			d.Uppers = append(d.Uppers, upper)
+		}
+		if lower, ok := strings.CutPrefix(entry.Name(), "lower_"); ok {
+			d.Lowers = append(d.Lowers, lower)
+		}
+	}
+	counter := func(attribute string) uint64 {
+		value, _ := strconv.ParseUint(read("statistics/"+attribute), 10, 64)
+		return value
+	}
+	d.Stats = device.InterfaceStats{
+		BytesSent:              counter("tx_bytes"),
+		BytesReceived:          counter("rx_bytes"),
+		PacketsSent:            counter("tx_packets"),
+		PacketsReceived:        counter("rx_packets"),
+		ErrorsSent:             uint32(counter("tx_errors")),
+		ErrorsReceived:         uint32(counter("rx_errors")),
+		DiscardPacketsSent:     uint32(counter("tx_dropped")),
+		DiscardPacketsReceived: uint32(counter("rx_dropped")),
+	}
+	return d, nil
+}
+
+// linkModeSpeeds are the speeds in Mbps of the ethtool link mode bits, from
+// enum ethtool_link_mode_bit_indices. Modes past 5000baseT are not found on
+// the ports of a CPE and are left out
+var linkModeSpeeds = map[int]int{
+	0: 10, 1: 10, 2: 100, 3: 100, 4: 1000, 5: 1000, 12: 10000, 15: 2500, 17: 1000,
+	18: 10000, 19: 10000, 21: 20000, 22: 20000, 23: 40000, 24: 40000,
+	25: 40000, 26: 40000, 27: 56000, 28: 56000, 29: 56000, 30: 56000, 31: 25000,
+	32: 25000, 33: 25000, 34: 50000, 35: 50000, 36: 100000, 37: 100000, 38: 100000,
+	39: 100000, 40: 50000, 41: 1000, 42: 10000, 43: 10000, 44: 10000, 45: 10000,
+	46: 10000, 47: 2500, 48: 5000,
+}
+
+// maxLinkSpeed returns the highest speed of a supported link modes bitmap, -1
+// when none is known
+func maxLinkSpeed(supported []uint32) int {
+	highest := -1
+	for bit, speed := range linkModeSpeeds {
+		if word := bit / 32; word < len(supported) && supported[word]&(1<<(bit%32)) != 0 {
+			highest = max(highest, speed)
+		}
+	}
+	return highest
+}
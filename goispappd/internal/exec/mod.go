@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -26,17 +27,19 @@ const (
 
 // CommandResult holds the result of a command execution
 type CommandResult struct {
-	Type    OutputType
-	Stdout  interface{}
-	Stderr  string
-	Raw     []byte
-	Success bool
+	Type     OutputType
+	Stdout   interface{}
+	Stderr   string
+	Raw      []byte
+	Success  bool
+	ExitCode int // Process exit status, -1 when the command never exited
 }
 
 // ExecConfig holds configuration for command execution
 type ExecConfig struct {
 	Timeout     time.Duration
 	Credentials *SSHCredentials
+	MaxOutput   int // Maximum bytes captured from stdout and stderr each, 0 means unlimited
 }
 
 // SSHCredentials holds SSH authentication details
@@ -48,6 +51,9 @@ type SSHCredentials struct {
 	PrivateKeyPath string // NEW: path to private key file
 }
 
+// ErrTimeout is returned when a command runs past the configured timeout
+var ErrTimeout = errors.New("command timed out")
+
 // Executor manages command execution
 type Executor struct {
 	config ExecConfig
@@ -72,26 +78,31 @@ func (e *Executor) NormalExecute(ctx context.Context, command string, args ...st
 
 	cmd := exec.CommandContext(ctx, command, args...)
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	stdout := newCappedBuffer(e.config.MaxOutput)
+	stderr := newCappedBuffer(e.config.MaxOutput)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	err := cmd.Run()
 	result := &CommandResult{
-		Raw:     stdout.Bytes(),
-		Stderr:  stderr.String(),
-		Success: err == nil,
+		Raw:      stdout.Bytes(),
+		Stderr:   stderr.String(),
+		Success:  err == nil,
+		ExitCode: exitCode(err),
 	}
 
 	if ctx.Err() == context.DeadlineExceeded {
-		return nil, fmt.Errorf("command timed out after %v", e.config.Timeout)
+		// The output captured before the command was killed goes with the error
+		result.ExitCode = -1
+		result, _ = parseOutput(result)
+		return result, fmt.Errorf("%w after %v", ErrTimeout, e.config.Timeout)
 	}
 
 	if err != nil {
 		return result, fmt.Errorf("command execution failed: %w", err)
 	}
 
-	return e.parseOutput(result)
+	return parseOutput(result)
 }
 
 // SSHExecute runs a command over SSH
@@ -117,9 +128,10 @@ func (e *Executor) SSHExecute(ctx context.Context, host, command string) (*Comma
 	}
 	defer session.Close()
 
-	var stdout, stderr bytes.Buffer
-	session.Stdout = &stdout
-	session.Stderr = &stderr
+	stdout := newCappedBuffer(e.config.MaxOutput)
+	stderr := newCappedBuffer(e.config.MaxOutput)
+	session.Stdout = stdout
+	session.Stderr = stderr
 
 	ctx, cancel := context.WithTimeout(ctx, e.config.Timeout)
 	defer cancel()
@@ -133,8 +145,10 @@ func (e *Executor) SSHExecute(ctx context.Context, host, command string) (*Comma
 	case err = <-errChan:
 		if err != nil {
 			return &CommandResult{
-				Stderr:  stderr.String(),
-				Success: false,
+				Raw:      stdout.Bytes(),
+				Stderr:   stderr.String(),
+				Success:  false,
+				ExitCode: exitCode(err),
 			}, fmt.Errorf("SSH command execution failed: %w", err)
 		}
 	case <-ctx.Done():
@@ -147,9 +161,53 @@ func (e *Executor) SSHExecute(ctx context.Context, host, command string) (*Comma
 		Success: true,
 	}
 
-	return e.parseOutput(result)
+	return parseOutput(result)
+}
+
+// exitCode extracts the process exit status from a local or SSH execution error
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var localErr *exec.ExitError
+	if errors.As(err, &localErr) {
+		return localErr.ExitCode()
+	}
+	var sshErr *ssh.ExitError
+	if errors.As(err, &sshErr) {
+		return sshErr.ExitStatus()
+	}
+	return -1
+}
+
+// cappedBuffer keeps at most limit bytes and silently discards the rest,
+// so a chatty command cannot exhaust memory on small devices. The buffer is
+// not embedded so io.Copy cannot bypass Write through bytes.Buffer.ReadFrom.
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
 }
 
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.limit <= 0 {
+		return b.buf.Write(p)
+	}
+	if room := b.limit - b.buf.Len(); room < len(p) {
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) Bytes() []byte  { return b.buf.Bytes() }
+func (b *cappedBuffer) String() string { return b.buf.String() }
+
 // buildSSHConfig creates SSH client configuration
 func (e *Executor) buildSSHConfig() (*ssh.ClientConfig, error) {
 	config := &ssh.ClientConfig{
@@ -206,7 +264,7 @@ func (e *Executor) Execute(ctx context.Context, command string, args ...string)
 }
 
 // parseOutput determines the output type and parses accordingly
-func (e *Executor) parseOutput(result *CommandResult) (*CommandResult, error) {
+func parseOutput(result *CommandResult) (*CommandResult, error) {
 	if len(result.Raw) == 0 {
 		result.Type = TypeString
 		result.Stdout = ""
@@ -0,0 +1,149 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Runner runs a command on the managed device. A command given without args
+// is a shell command line and may use pipes, redirections and ||.
+type Runner interface {
+	Execute(ctx context.Context, command string, args ...string) (*CommandResult, error)
+}
+
+// LocalRunner runs commands on the host the client is running on
+type LocalRunner struct {
+	executor *Executor
+}
+
+// NewLocalRunner creates a Runner executing commands locally
+func NewLocalRunner(config ExecConfig) *LocalRunner {
+	return &LocalRunner{executor: NewExecutor(config)}
+}
+
+// Execute runs command with args directly, or through sh -c when there are no args
+func (r *LocalRunner) Execute(ctx context.Context, command string, args ...string) (*CommandResult, error) {
+	if len(args) == 0 {
+		return r.executor.NormalExecute(ctx, "sh", "-c", command)
+	}
+	return r.executor.NormalExecute(ctx, command, args...)
+}
+
+// SSHRunner runs commands on a remote device over SSH
+type SSHRunner struct {
+	executor *Executor
+	host     string
+}
+
+// NewSSHRunner creates a Runner executing commands on host ("address:port")
+func NewSSHRunner(config ExecConfig, host string) *SSHRunner {
+	return &SSHRunner{executor: NewExecutor(config), host: host}
+}
+
+// Execute runs the command through the remote shell, args are quoted
+func (r *SSHRunner) Execute(ctx context.Context, command string, args ...string) (*CommandResult, error) {
+	line := command
+	for _, arg := range args {
+		line += " " + shellQuote(arg)
+	}
+	return r.executor.SSHExecute(ctx, r.host, line)
+}
+
+// shellQuote quotes arg for a POSIX shell when it contains special characters
+func shellQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]{}#~!") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// Fixture is the canned outcome of a command replayed by FixtureRunner
+type Fixture struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Err      error // Returned as is, e.g. to simulate a timeout
+}
+
+type patternFixture struct {
+	pattern *regexp.Regexp
+	fixture Fixture
+}
+
+// FixtureRunner replays canned outputs so collectors can be tested without a
+// device. Commands are matched on their command line, command and args joined
+// by single spaces, first exactly and then against regexps in registration order.
+type FixtureRunner struct {
+	mu       sync.Mutex
+	exact    map[string]Fixture
+	patterns []patternFixture
+	calls    []string
+}
+
+// NewFixtureRunner creates a FixtureRunner without fixtures
+func NewFixtureRunner() *FixtureRunner {
+	return &FixtureRunner{exact: make(map[string]Fixture)}
+}
+
+// On registers a fixture for an exact command line
+func (r *FixtureRunner) On(commandLine string, fixture Fixture) *FixtureRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exact[commandLine] = fixture
+	return r
+}
+
+// OnRegexp registers a fixture for command lines matching pattern
+func (r *FixtureRunner) OnRegexp(pattern string, fixture Fixture) *FixtureRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, patternFixture{pattern: regexp.MustCompile(pattern), fixture: fixture})
+	return r
+}
+
+// Calls returns the command lines executed so far
+func (r *FixtureRunner) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+// Execute replays the fixture registered for the command line, an unknown
+// command fails like a missing binary with exit code 127
+func (r *FixtureRunner) Execute(_ context.Context, command string, args ...string) (*CommandResult, error) {
+	line := strings.Join(append([]string{command}, args...), " ")
+
+	r.mu.Lock()
+	r.calls = append(r.calls, line)
+	fixture, ok := r.exact[line]
+	if !ok {
+		for _, candidate := range r.patterns {
+			if candidate.pattern.MatchString(line) {
+				fixture, ok = candidate.fixture, true
+				break
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		fixture = Fixture{Stderr: fmt.Sprintf("no fixture for %q", line), ExitCode: 127}
+	}
+	if fixture.Err != nil {
+		return nil, fixture.Err
+	}
+
+	result := &CommandResult{
+		Raw:      []byte(fixture.Stdout),
+		Stderr:   fixture.Stderr,
+		Success:  fixture.ExitCode == 0,
+		ExitCode: fixture.ExitCode,
+	}
+	if fixture.ExitCode != 0 {
+		return result, fmt.Errorf("command execution failed: exit status %d", fixture.ExitCode)
+	}
+	return parseOutput(result)
+}
@@ -0,0 +1,81 @@
+package exec_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+)
+
+func TestRunners(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("FixtureExact", func(t *testing.T) {
+		runner := exec.NewFixtureRunner().On("iw dev", exec.Fixture{Stdout: "phy#0\n\tInterface wlan0\n"})
+		result, err := runner.Execute(ctx, "iw", "dev")
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if result.Type != exec.TypeString || result.Stdout != "phy#0\n\tInterface wlan0" {
+			t.Errorf("Expected parsed string output, got %v %q", result.Type, result.Stdout)
+		}
+	})
+
+	t.Run("FixtureRegexpAndJSON", func(t *testing.T) {
+		runner := exec.NewFixtureRunner().
+			OnRegexp(`^ubus call network\.interface\.\w+ status$`, exec.Fixture{Stdout: `{"up":true}`})
+		result, err := runner.Execute(ctx, "ubus", "call", "network.interface.wan", "status")
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if result.Type != exec.TypeJSON || !reflect.DeepEqual(result.Stdout, map[string]interface{}{"up": true}) {
+			t.Errorf("Expected parsed JSON output, got %v %v", result.Type, result.Stdout)
+		}
+	})
+
+	t.Run("FixtureFailures", func(t *testing.T) {
+		timeout := errors.New("command timed out")
+		runner := exec.NewFixtureRunner().
+			On("false", exec.Fixture{Stderr: "boom", ExitCode: 1}).
+			On("sleep 60", exec.Fixture{Err: timeout})
+
+		result, err := runner.Execute(ctx, "false")
+		if err == nil || result.Success || result.ExitCode != 1 || result.Stderr != "boom" {
+			t.Errorf("Expected exit code 1 with stderr, got %+v %v", result, err)
+		}
+		if _, err := runner.Execute(ctx, "sleep", "60"); !errors.Is(err, timeout) {
+			t.Errorf("Expected fixture error, got %v", err)
+		}
+		result, err = runner.Execute(ctx, "unknown")
+		if err == nil || result.ExitCode != 127 {
+			t.Errorf("Expected exit code 127 for unknown command, got %+v %v", result, err)
+		}
+		if calls := runner.Calls(); !reflect.DeepEqual(calls, []string{"false", "sleep 60", "unknown"}) {
+			t.Errorf("Unexpected calls %q", calls)
+		}
+	})
+
+	t.Run("LocalShellLine", func(t *testing.T) {
+		runner := exec.NewLocalRunner(exec.ExecConfig{})
+		result, err := runner.Execute(ctx, `printf 'a\nb\n' | grep b || echo missing`)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if result.Stdout != "b" {
+			t.Errorf("Expected pipeline output b, got %q", result.Stdout)
+		}
+	})
+
+	t.Run("LocalArgs", func(t *testing.T) {
+		runner := exec.NewLocalRunner(exec.ExecConfig{})
+		result, err := runner.Execute(ctx, "echo", "a|b")
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if result.Stdout != "a|b" {
+			t.Errorf("Expected args passed verbatim, got %q", result.Stdout)
+		}
+	})
+}
@@ -0,0 +1,668 @@
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// applyTimeout bounds the uci calls and the fw4 reload of one request
+const applyTimeout = 30 * time.Second
+
+// firewallParams are the parameters of Device.Firewall.
+var firewallParams = map[string]params.Param{
+	"Enable":                          {Type: soap.TR069TypeBoolean},
+	"Config":                          {Type: soap.TR069TypeString},
+	"ChainNumberOfEntries":            {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"X_ISPAPP_ConnTrack.TotalEntries": {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"X_ISPAPP_ConnTrack.MaxEntries":   {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+
+	"Chain.{i}.Enable":                                {Type: soap.TR069TypeBoolean},
+	"Chain.{i}.Name":                                  {Type: soap.TR069TypeString},
+	"Chain.{i}.Creator":                               {Type: soap.TR069TypeString},
+	"Chain.{i}.RuleNumberOfEntries":                   {Type: soap.TR069TypeUnsignedInt},
+	"Chain.{i}.Rule.{i}.Enable":                       {Type: soap.TR069TypeBoolean, Writable: true},
+	"Chain.{i}.Rule.{i}.Status":                       {Type: soap.TR069TypeString},
+	"Chain.{i}.Rule.{i}.Order":                        {Type: soap.TR069TypeUnsignedInt, Writable: true, Check: params.Range(1, 65535)},
+	"Chain.{i}.Rule.{i}.Description":                  {Type: soap.TR069TypeString, Writable: true},
+	"Chain.{i}.Rule.{i}.Target":                       {Type: soap.TR069TypeString, Writable: true, Enum: []string{"Drop", "Accept", "Reject"}},
+	"Chain.{i}.Rule.{i}.Log":                          {Type: soap.TR069TypeBoolean, Writable: true},
+	"Chain.{i}.Rule.{i}.SourceInterface":              {Type: soap.TR069TypeString, Writable: true, Check: checkInterface},
+	"Chain.{i}.Rule.{i}.SourceAllInterfaces":          {Type: soap.TR069TypeBoolean, Writable: true},
+	"Chain.{i}.Rule.{i}.DestInterface":                {Type: soap.TR069TypeString, Writable: true, Check: checkInterface},
+	"Chain.{i}.Rule.{i}.DestAllInterfaces":            {Type: soap.TR069TypeBoolean, Writable: true},
+	"Chain.{i}.Rule.{i}.IPVersion":                    {Type: soap.TR069TypeInt, Writable: true, Enum: []string{"-1", "4", "6"}},
+	"Chain.{i}.Rule.{i}.DestIP":                       {Type: soap.TR069TypeString, Writable: true, Check: checkAddress},
+	"Chain.{i}.Rule.{i}.DestMask":                     {Type: soap.TR069TypeString, Writable: true, Check: checkMask},
+	"Chain.{i}.Rule.{i}.DestIPExclude":                {Type: soap.TR069TypeBoolean, Writable: true},
+	"Chain.{i}.Rule.{i}.SourceIP":                     {Type: soap.TR069TypeString, Writable: true, Check: checkAddress},
+	"Chain.{i}.Rule.{i}.SourceMask":                   {Type: soap.TR069TypeString, Writable: true, Check: checkMask},
+	"Chain.{i}.Rule.{i}.SourceIPExclude":              {Type: soap.TR069TypeBoolean, Writable: true},
+	"Chain.{i}.Rule.{i}.Protocol":                     {Type: soap.TR069TypeInt, Writable: true, Check: checkProtocol},
+	"Chain.{i}.Rule.{i}.ProtocolExclude":              {Type: soap.TR069TypeBoolean, Writable: true},
+	"Chain.{i}.Rule.{i}.DestPort":                     {Type: soap.TR069TypeInt, Writable: true, Check: checkPort},
+	"Chain.{i}.Rule.{i}.DestPortRangeMax":             {Type: soap.TR069TypeInt, Writable: true, Check: checkPort},
+	"Chain.{i}.Rule.{i}.DestPortExclude":              {Type: soap.TR069TypeBoolean, Writable: true},
+	"Chain.{i}.Rule.{i}.SourcePort":                   {Type: soap.TR069TypeInt, Writable: true, Check: checkPort},
+	"Chain.{i}.Rule.{i}.SourcePortRangeMax":           {Type: soap.TR069TypeInt, Writable: true, Check: checkPort},
+	"Chain.{i}.Rule.{i}.SourcePortExclude":            {Type: soap.TR069TypeBoolean, Writable: true},
+	"X_ISPAPP_NAT.ChainNumberOfEntries":               {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"X_ISPAPP_NAT.Chain.{i}.Enable":                   {Type: soap.TR069TypeBoolean},
+	"X_ISPAPP_NAT.Chain.{i}.Name":                     {Type: soap.TR069TypeString},
+	"X_ISPAPP_NAT.Chain.{i}.RuleNumberOfEntries":      {Type: soap.TR069TypeUnsignedInt},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.Enable":          {Type: soap.TR069TypeBoolean, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.Order":           {Type: soap.TR069TypeUnsignedInt, Writable: true, Check: params.Range(1, 65535)},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.Description":     {Type: soap.TR069TypeString, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.Target":          {Type: soap.TR069TypeString},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.Log":             {Type: soap.TR069TypeBoolean, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.SourceInterface": {Type: soap.TR069TypeString, Writable: true, Check: checkInterface},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.DestInterface":   {Type: soap.TR069TypeString, Writable: true, Check: checkInterface},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.Protocol":        {Type: soap.TR069TypeInt, Writable: true, Check: checkProtocol},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.ProtocolExclude": {Type: soap.TR069TypeBoolean, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.SourceIPRange":   {Type: soap.TR069TypeString, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.SourcePortList":  {Type: soap.TR069TypeString, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.DestIPRange":     {Type: soap.TR069TypeString, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.DestPortList":    {Type: soap.TR069TypeString, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.ToAddresses":     {Type: soap.TR069TypeString, Writable: true},
+	"X_ISPAPP_NAT.Chain.{i}.Rule.{i}.ToPorts":         {Type: soap.TR069TypeString, Writable: true},
+}
+
+func checkInterface(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := ucicfg.RefInstance(value, ipInterfaceRef); err != nil {
+		return err
+	}
+	return nil
+}
+
+func checkAddress(value string) error {
+	if value == "" {
+		return nil
+	}
+	_, err := netip.ParseAddr(value)
+	return err
+}
+
+func checkMask(value string) error {
+	if _, ok := maskBits(value); !ok && value != "" {
+		return fmt.Errorf("%q is not a mask", value)
+	}
+	return nil
+}
+
+func checkProtocol(value string) error {
+	if protocol, err := strconv.Atoi(value); err != nil || protocol < -1 || protocol > 255 {
+		return fmt.Errorf("%q is not a protocol number", value)
+	}
+	return nil
+}
+
+func checkPort(value string) error {
+	if port, err := strconv.Atoi(value); err != nil || port < -1 || port > 65535 {
+		return fmt.Errorf("%q is not a port", value)
+	}
+	return nil
+}
+
+// Register adds Device.Firewall. to registry
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{
+		Prefix: Prefix,
+		Params: firewallParams,
+		Apply:  m.apply,
+		Commit: m.save,
+		Revert: m.revert,
+		Add:    m.add,
+		Delete: m.delete,
+	})
+}
+
+// commit saves the firewall config, reloads fw4 and refreshes the store
+func (m *Manager) commit(ctx context.Context) error {
+	if err := m.uci.Commit(ctx); err != nil {
+		return err
+	}
+	if _, err := ucicfg.Command(ctx, m.runner, "fw4", "reload"); err != nil {
+		return err
+	}
+	return m.collect(ctx)
+}
+
+// save commits the values staged by apply
+func (m *Manager) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	return m.commit(ctx)
+}
+
+// revert discards the values staged by apply
+func (m *Manager) revert() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	m.uci.Restore(ctx)
+}
+
+// stage runs fn on the loaded config, its changes stay in the save directory
+func (m *Manager) stage(fn func(ctx context.Context, cfg *config) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, cfg)
+}
+
+// write stages fn and commits its changes, they are reverted when fn fails
+func (m *Manager) write(fn func(ctx context.Context, cfg *config) error) error {
+	if err := m.stage(fn); err != nil {
+		m.revert()
+		return err
+	}
+	return m.save()
+}
+
+// chainRef is a rule table, Chain 1 or a NAT chain
+type chainRef struct {
+	nat      bool
+	instance int
+}
+
+// path splits a name into its chain, the rule instance and the parameter
+func path(name string) (chain chainRef, index int, param string, err error) {
+	rest := strings.TrimPrefix(name, Prefix)
+	rest, chain.nat = strings.CutPrefix(rest, "X_ISPAPP_NAT.")
+	parts := strings.SplitN(rest, ".", 5)
+	if len(parts) < 4 || parts[0] != "Chain" || parts[2] != "Rule" {
+		return chainRef{}, 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	chain.instance, err = strconv.Atoi(parts[1])
+	if err != nil || chain.instance < 1 || (!chain.nat && chain.instance != 1) || (chain.nat && chain.instance > len(natChains)) {
+		return chainRef{}, 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	if index, err = strconv.Atoi(parts[3]); err != nil {
+		return chainRef{}, 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	if len(parts) == 5 {
+		param = parts[4]
+	}
+	return chain, index, param, nil
+}
+
+// chain returns the sections of a chain in order
+func (cfg *config) chain(chain chainRef) []*entry {
+	if chain.nat {
+		return cfg.natChain(chain.instance)
+	}
+	return cfg.rules
+}
+
+// find returns the rule index of a chain
+func (cfg *config) find(chain chainRef, index int) *entry {
+	for _, e := range cfg.chain(chain) {
+		if e.index == index {
+			return e
+		}
+	}
+	return nil
+}
+
+// apply stages the values of one SetParameterValues request, the registry
+// commits or reverts them with the other objects of the request
+func (m *Manager) apply(values map[string]string) error {
+	return m.stage(func(ctx context.Context, cfg *config) error {
+		type ruleRef struct {
+			chain chainRef
+			e     *entry
+		}
+		changes := make(map[ruleRef]map[string]string)
+		for name, value := range values {
+			chain, index, param, err := path(name)
+			if err != nil {
+				return err
+			}
+			e := cfg.find(chain, index)
+			if e == nil {
+				return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+			}
+			ref := ruleRef{chain, e}
+			if changes[ref] == nil {
+				changes[ref] = make(map[string]string)
+			}
+			changes[ref][param] = value
+		}
+
+		var moves []ruleRef
+		for ref, values := range changes {
+			var err error
+			if ref.chain.nat {
+				err = m.applyNAT(ctx, cfg, ref.e, values)
+			} else {
+				err = m.applyRule(ctx, cfg, ref.e, values)
+			}
+			if err != nil {
+				return err
+			}
+			if _, ok := values["Order"]; ok {
+				moves = append(moves, ref)
+			}
+		}
+		// Rules are moved in the order they ask for, so a request setting
+		// the Order of several rules of a chain gets them all
+		sort.Slice(moves, func(i, j int) bool {
+			a, _ := strconv.Atoi(changes[moves[i]]["Order"])
+			b, _ := strconv.Atoi(changes[moves[j]]["Order"])
+			return a < b
+		})
+		for _, ref := range moves {
+			order, _ := strconv.Atoi(changes[ref]["Order"])
+			if err := m.move(ctx, cfg, ref.chain, ref.e, order); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// move reorders the section of e so it takes position order of its chain.
+// uci reorder takes the final position among all sections of the config,
+// which is the current position of the rule holding order in either
+// direction of the move
+func (m *Manager) move(ctx context.Context, cfg *config, chain chainRef, e *entry, order int) error {
+	entries := cfg.chain(chain)
+	order = min(order, len(entries))
+	occupant := entries[order-1]
+	if occupant == e {
+		return nil
+	}
+	position := indexOf(cfg.order, occupant.sec.Name)
+	if err := m.uci.Reorder(ctx, e.sec.Name, position); err != nil {
+		return err
+	}
+	// Keep the loaded order in step with uci for the next move
+	cfg.order = insert(remove(cfg.order, e.sec.Name), position, e.sec.Name)
+	list := &cfg.rules
+	if chain.nat {
+		list = &cfg.redirects
+	}
+	var reordered []*entry
+	for _, name := range cfg.order {
+		for _, other := range *list {
+			if other.sec.Name == name {
+				reordered = append(reordered, other)
+			}
+		}
+	}
+	*list = reordered
+	return nil
+}
+
+func indexOf(names []string, name string) int {
+	for i, other := range names {
+		if other == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func remove(names []string, name string) []string {
+	var kept []string
+	for _, other := range names {
+		if other != name {
+			kept = append(kept, other)
+		}
+	}
+	return kept
+}
+
+func insert(names []string, position int, name string) []string {
+	position = min(max(position, 0), len(names))
+	return append(names[:position:position], append([]string{name}, names[position:]...)...)
+}
+
+// zoneOf returns the zone holding the network numbered by a
+// Device.IP.Interface.{i}. reference, empty for an empty reference
+func (cfg *config) zoneOf(ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	instance, err := ucicfg.RefInstance(ref, ipInterfaceRef)
+	if err != nil {
+		return "", err
+	}
+	network := ""
+	for _, sec := range cfg.network {
+		if sec.SectionType == "interface" && sec.Options[interfaceInstance] == strconv.Itoa(instance) {
+			network = sec.Name
+		}
+	}
+	if network == "" {
+		return "", fmt.Errorf("no network interface for %s", ref)
+	}
+	for _, z := range cfg.zones {
+		for _, member := range strings.Fields(z.Options["network"]) {
+			if member == network {
+				return z.Options["name"], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no firewall zone holds %s", network)
+}
+
+// setCommon writes the parameters rules and redirects share
+func (m *Manager) setCommon(ctx context.Context, e *entry, changes map[string]string) error {
+	if value, ok := changes["Enable"]; ok {
+		enabled := "0"
+		if soap.BooleanValues[strings.ToLower(value)] {
+			enabled = ""
+		}
+		if err := m.uci.Set(ctx, e.sec.Name, "enabled", enabled); err != nil {
+			return err
+		}
+	}
+	if value, ok := changes["Log"]; ok {
+		log := ""
+		if soap.BooleanValues[strings.ToLower(value)] {
+			log = "1"
+		}
+		if err := m.uci.Set(ctx, e.sec.Name, "log", log); err != nil {
+			return err
+		}
+	}
+	if value, ok := changes["Description"]; ok {
+		if err := m.uci.Set(ctx, e.sec.Name, "name", value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRule maps the parameters of a Chain 1 rule to its options. Address,
+// protocol and port parameters are merged with the current values since fw4
+// keeps each group in a single option
+func (m *Manager) applyRule(ctx context.Context, cfg *config, e *entry, changes map[string]string) error {
+	if err := m.setCommon(ctx, e, changes); err != nil {
+		return err
+	}
+	r := cfg.filterRule(e, 0)
+	flag := func(param string, current *bool) {
+		if value, ok := changes[param]; ok {
+			*current = soap.BooleanValues[strings.ToLower(value)]
+		}
+	}
+	number := func(param string, current *int) {
+		if value, ok := changes[param]; ok {
+			*current, _ = strconv.Atoi(value)
+		}
+	}
+	text := func(param string, current *string) {
+		if value, ok := changes[param]; ok {
+			*current = value
+		}
+	}
+	changed := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := changes[name]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if value, ok := changes["Target"]; ok {
+		if err := m.uci.Set(ctx, e.sec.Name, "target", strings.ToUpper(value)); err != nil {
+			return err
+		}
+	}
+	for _, zone := range []struct {
+		option, iface, all string
+		current            *string
+		allCurrent         *bool
+	}{
+		{"src", "SourceInterface", "SourceAllInterfaces", &r.SourceInterface, &r.SourceAllInterfaces},
+		{"dest", "DestInterface", "DestAllInterfaces", &r.DestInterface, &r.DestAllInterfaces},
+	} {
+		if !changed(zone.iface, zone.all) {
+			continue
+		}
+		text(zone.iface, zone.current)
+		flag(zone.all, zone.allCurrent)
+		value := "*"
+		if !*zone.allCurrent {
+			var err error
+			if value, err = cfg.zoneOf(*zone.current); err != nil {
+				return err
+			}
+		}
+		if err := m.uci.Set(ctx, e.sec.Name, zone.option, value); err != nil {
+			return err
+		}
+	}
+	if changed("IPVersion") {
+		number("IPVersion", &r.IPVersion)
+		family := map[int]string{4: "ipv4", 6: "ipv6"}[r.IPVersion]
+		if err := m.uci.Set(ctx, e.sec.Name, "family", family); err != nil {
+			return err
+		}
+	}
+	for _, address := range []struct {
+		option, ip, mask, exclude string
+		currentIP, currentMask    *string
+		currentExclude            *bool
+	}{
+		{"src_ip", "SourceIP", "SourceMask", "SourceIPExclude", &r.SourceIP, &r.SourceMask, &r.SourceIPExclude},
+		{"dest_ip", "DestIP", "DestMask", "DestIPExclude", &r.DestIP, &r.DestMask, &r.DestIPExclude},
+	} {
+		if !changed(address.ip, address.mask, address.exclude) {
+			continue
+		}
+		text(address.ip, address.currentIP)
+		text(address.mask, address.currentMask)
+		flag(address.exclude, address.currentExclude)
+		value, err := formatAddress(*address.currentIP, *address.currentMask, *address.currentExclude)
+		if err != nil {
+			return err
+		}
+		if err := m.uci.Set(ctx, e.sec.Name, address.option, value); err != nil {
+			return err
+		}
+	}
+	if changed("Protocol", "ProtocolExclude") {
+		number("Protocol", &r.Protocol)
+		flag("ProtocolExclude", &r.ProtocolExclude)
+		if err := m.uci.Set(ctx, e.sec.Name, "proto", formatProtocol(r.Protocol, r.ProtocolExclude)); err != nil {
+			return err
+		}
+	}
+	for _, port := range []struct {
+		option, port, rangeMax, exclude string
+		current, currentMax             *int
+		currentExclude                  *bool
+	}{
+		{"src_port", "SourcePort", "SourcePortRangeMax", "SourcePortExclude", &r.SourcePort, &r.SourcePortRangeMax, &r.SourcePortExclude},
+		{"dest_port", "DestPort", "DestPortRangeMax", "DestPortExclude", &r.DestPort, &r.DestPortRangeMax, &r.DestPortExclude},
+	} {
+		if !changed(port.port, port.rangeMax, port.exclude) {
+			continue
+		}
+		number(port.port, port.current)
+		number(port.rangeMax, port.currentMax)
+		flag(port.exclude, port.currentExclude)
+		value, err := formatPort(*port.current, *port.currentMax, *port.currentExclude)
+		if err != nil {
+			return err
+		}
+		if err := m.uci.Set(ctx, e.sec.Name, port.option, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyNAT maps the parameters of a NAT rule to its redirect options
+func (m *Manager) applyNAT(ctx context.Context, cfg *config, e *entry, changes map[string]string) error {
+	if err := m.setCommon(ctx, e, changes); err != nil {
+		return err
+	}
+	for param, option := range map[string]string{"SourceInterface": "src", "DestInterface": "dest"} {
+		value, ok := changes[param]
+		if !ok {
+			continue
+		}
+		zone, err := cfg.zoneOf(value)
+		if err != nil {
+			return err
+		}
+		if err := m.uci.Set(ctx, e.sec.Name, option, zone); err != nil {
+			return err
+		}
+	}
+	_, protocolSet := changes["Protocol"]
+	_, excludeSet := changes["ProtocolExclude"]
+	if protocolSet || excludeSet {
+		protocol, exclude := parseProtocol(e.sec.Options["proto"])
+		if value, ok := changes["Protocol"]; ok {
+			protocol, _ = strconv.Atoi(value)
+		}
+		if value, ok := changes["ProtocolExclude"]; ok {
+			exclude = soap.BooleanValues[strings.ToLower(value)]
+		}
+		if err := m.uci.Set(ctx, e.sec.Name, "proto", formatProtocol(protocol, exclude)); err != nil {
+			return err
+		}
+	}
+	for param, option := range natOptions(redirectTarget(e.sec)) {
+		if value, ok := changes[param]; ok {
+			if err := m.uci.Set(ctx, e.sec.Name, option, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// formatAddress builds an fw4 address from an address, a mask and negation
+func formatAddress(address, mask string, exclude bool) (string, error) {
+	if address == "" {
+		return "", nil
+	}
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return "", err
+	}
+	value := addr.String()
+	if mask != "" {
+		bits, ok := maskBits(mask)
+		maskAddr, _ := netip.ParseAddr(mask)
+		if !ok || maskAddr.Is4() != addr.Is4() {
+			return "", fmt.Errorf("%s is not a mask for %s", mask, address)
+		}
+		value = netip.PrefixFrom(addr, bits).String()
+	}
+	if exclude {
+		value = "!" + value
+	}
+	return value, nil
+}
+
+// formatProtocol builds an fw4 proto option, all for -1
+func formatProtocol(protocol int, exclude bool) string {
+	if protocol < 0 {
+		return "all"
+	}
+	value := strconv.Itoa(protocol)
+	for name, number := range protocols {
+		// icmpv6 and ipv6-icmp share 58, fw4 knows both
+		if number == protocol && name != "ipv6-icmp" {
+			value = name
+		}
+	}
+	if exclude {
+		value = "!" + value
+	}
+	return value
+}
+
+// formatPort builds an fw4 port or port range
+func formatPort(port, rangeMax int, exclude bool) (string, error) {
+	if port < 0 {
+		return "", nil
+	}
+	value := strconv.Itoa(port)
+	if rangeMax >= 0 && rangeMax != port {
+		if rangeMax < port {
+			return "", fmt.Errorf("port range %d-%d is empty", port, rangeMax)
+		}
+		value = fmt.Sprintf("%d-%d", port, rangeMax)
+	}
+	if exclude {
+		value = "!" + value
+	}
+	return value, nil
+}
+
+// add creates a disabled rule at the end of a chain
+func (m *Manager) add(name string) (int, error) {
+	var index int
+	err := m.write(func(ctx context.Context, cfg *config) error {
+		chain, _, _, err := path(name + "0.")
+		if err != nil || !strings.HasSuffix(name, ".Rule.") {
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		sectionType, option, target := "rule", ruleInstance, defaultRuleTarget
+		entries := cfg.rules
+		if chain.nat {
+			sectionType, option, target = "redirect", redirectInstance, natChains[chain.instance-1].target
+			entries = cfg.redirects
+		}
+		for _, e := range entries {
+			index = max(index, e.index)
+		}
+		index++
+
+		section, err := m.uci.Add(ctx, sectionType)
+		if err != nil {
+			return err
+		}
+		for _, o := range [][2]string{{option, strconv.Itoa(index)}, {"target", target}, {"enabled", "0"}} {
+			if err := m.uci.Set(ctx, section, o[0], o[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return index, err
+}
+
+// delete removes a rule of a chain
+func (m *Manager) delete(name string) error {
+	return m.write(func(ctx context.Context, cfg *config) error {
+		chain, index, param, err := path(name)
+		if err != nil || param != "" {
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		e := cfg.find(chain, index)
+		if e == nil {
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		return m.uci.Delete(ctx, e.sec.Name)
+	})
+}
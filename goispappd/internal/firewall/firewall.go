@@ -0,0 +1,548 @@
+// Package firewall maps TR-181 Device.Firewall to /etc/config/firewall served
+// by fw4. Chain 1 holds the rule sections in config order and the vendor
+// X_ISPAPP_NAT chains the redirect sections, dstnat the DNAT and srcnat the
+// SNAT ones. Rules name zones, an Interface is the first network of its zone.
+package firewall
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// Prefix is the object mapped by the package
+const Prefix = "Device.Firewall."
+
+// Tables below Prefix
+const (
+	chainPrefix = Prefix + "Chain.1."
+	natPrefix   = Prefix + "X_ISPAPP_NAT."
+)
+
+// ipInterfaceRef is the prefix of the Interface references
+const ipInterfaceRef = "Device.IP.Interface."
+
+// UCI options numbering the instances, ip_int_instance is shared with the
+// tr181 shell scripts
+const (
+	ruleInstance      = "fw_rule_instance"
+	redirectInstance  = "fw_redirect_instance"
+	interfaceInstance = "ip_int_instance"
+)
+
+// Connection tracking counters
+const (
+	conntrackCount = "/proc/sys/net/netfilter/nf_conntrack_count"
+	conntrackMax   = "/proc/sys/net/netfilter/nf_conntrack_max"
+)
+
+// fw4 defaults of options left unset
+const (
+	defaultRuleTarget     = "DROP"
+	defaultRedirectTarget = "DNAT"
+)
+
+// natChains are the X_ISPAPP_NAT chains by instance with their redirect target
+var natChains = []struct{ name, target string }{
+	{"dstnat", "DNAT"},
+	{"srcnat", "SNAT"},
+}
+
+// targets maps the fw4 rule targets to the TR-181 ones
+var targets = map[string]string{"ACCEPT": "Accept", "DROP": "Drop", "REJECT": "Reject"}
+
+// protocols are the protocol names fw4 accepts besides numbers
+var protocols = map[string]int{
+	"icmp": 1, "igmp": 2, "tcp": 6, "udp": 17, "gre": 47, "esp": 50, "ah": 51,
+	"icmpv6": 58, "ipv6-icmp": 58, "sctp": 132,
+}
+
+// Manager reads and writes the firewall configuration with uci
+type Manager struct {
+	runner  exec.Runner
+	uci     *ucicfg.Config
+	numbers *ucicfg.Config // Instance numbers, committed apart from the requests
+	mu      sync.Mutex
+}
+
+// NewManager creates a Manager running uci and fw4 through runner
+func NewManager(runner exec.Runner) *Manager {
+	c := ucicfg.New(runner, "firewall", "firewall")
+	return &Manager{runner: runner, uci: c, numbers: c.Numbers()}
+}
+
+// entry is a rule or redirect section
+type entry struct {
+	sec   *uci.Section
+	index int
+}
+
+// config is /etc/config/firewall with its instance numbers
+type config struct {
+	rules     []*entry // rule sections in config order
+	redirects []*entry // redirect sections in config order
+	zones     []*uci.Section
+	network   []*uci.Section
+	order     []string // Names of every firewall section in config order
+}
+
+// load reads the firewall and network configs, numbering the sections that
+// have no instance yet
+func (m *Manager) load(ctx context.Context) (*config, error) {
+	sections, err := m.uci.Show(ctx)
+	if err != nil {
+		return nil, err
+	}
+	network, err := ucicfg.Show(ctx, m.runner, "network")
+	if err != nil {
+		return nil, err
+	}
+	cfg := &config{network: network}
+
+	numbered := false
+	nextRule, nextRedirect := ucicfg.MaxInstance(sections, "rule", ruleInstance), ucicfg.MaxInstance(sections, "redirect", redirectInstance)
+	for _, sec := range sections {
+		cfg.order = append(cfg.order, sec.Name)
+		var option string
+		var next *int
+		var entries *[]*entry
+		switch sec.SectionType {
+		case "zone":
+			cfg.zones = append(cfg.zones, sec)
+			continue
+		case "rule":
+			option, next, entries = ruleInstance, &nextRule, &cfg.rules
+		case "redirect":
+			option, next, entries = redirectInstance, &nextRedirect, &cfg.redirects
+		default:
+			continue
+		}
+		index, err := strconv.Atoi(sec.Options[option])
+		if err != nil {
+			*next++
+			index = *next
+			if err := m.numbers.Set(ctx, sec.Name, option, strconv.Itoa(index)); err != nil {
+				return nil, err
+			}
+			numbered = true
+		}
+		*entries = append(*entries, &entry{sec: sec, index: index})
+	}
+	if numbered {
+		if err := m.numbers.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// natChain returns the redirects of X_ISPAPP_NAT chain instance, in order
+func (cfg *config) natChain(instance int) []*entry {
+	var entries []*entry
+	for _, e := range cfg.redirects {
+		if redirectTarget(e.sec) == natChains[instance-1].target {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// redirectTarget returns DNAT or SNAT
+func redirectTarget(sec *uci.Section) string {
+	return strings.ToUpper(valueOr(sec.Options["target"], defaultRedirectTarget))
+}
+
+// zone returns the zone called name
+func (cfg *config) zone(name string) *uci.Section {
+	for _, z := range cfg.zones {
+		if z.Options["name"] == name && name != "" {
+			return z
+		}
+	}
+	return nil
+}
+
+// zoneInterface returns the Device.IP.Interface. reference of the first
+// numbered network of a zone
+func (cfg *config) zoneInterface(name string) string {
+	if refs := cfg.zoneInterfaces(name); len(refs) > 0 {
+		return refs[0]
+	}
+	return ""
+}
+
+// zoneInterfaces returns the Device.IP.Interface. references of the numbered
+// networks of a zone in the order the zone lists them
+func (cfg *config) zoneInterfaces(name string) []string {
+	z := cfg.zone(name)
+	if z == nil {
+		return nil
+	}
+	var refs []string
+	for _, network := range strings.Fields(z.Options["network"]) {
+		for _, sec := range cfg.network {
+			if sec.SectionType == "interface" && sec.Name == network && sec.Options[interfaceInstance] != "" {
+				refs = append(refs, ipInterfaceRef+sec.Options[interfaceInstance]+".")
+			}
+		}
+	}
+	return refs
+}
+
+// ZoneInterfaces returns the Device.IP.Interface. references of the networks
+// of the zone called name, none when there is no such zone
+func (m *Manager) ZoneInterfaces(ctx context.Context, name string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.zoneInterfaces(name), nil
+}
+
+// filterRule maps a rule section at position order of Chain 1
+func (cfg *config) filterRule(e *entry, order int) device.FirewallRule {
+	o := e.sec.Options
+	r := device.FirewallRule{
+		Index:       e.index,
+		Enable:      o["enabled"] != "0",
+		Order:       order,
+		Description: o["name"],
+		Log:         o["log"] == "1",
+		IPVersion:   -1,
+	}
+	target := strings.ToUpper(valueOr(o["target"], defaultRuleTarget))
+	if r.Target = targets[target]; r.Target == "" {
+		r.Target = "X_ISPAPP_" + target
+	}
+
+	misconfigured := false
+	r.SourceAllInterfaces = o["src"] == "*"
+	if !r.SourceAllInterfaces && o["src"] != "" {
+		r.SourceInterface = cfg.zoneInterface(o["src"])
+		misconfigured = cfg.zone(o["src"]) == nil
+	}
+	r.DestAllInterfaces = o["dest"] == "*"
+	if !r.DestAllInterfaces && o["dest"] != "" {
+		r.DestInterface = cfg.zoneInterface(o["dest"])
+		misconfigured = misconfigured || cfg.zone(o["dest"]) == nil
+	}
+	switch o["family"] {
+	case "ipv4":
+		r.IPVersion = 4
+	case "ipv6":
+		r.IPVersion = 6
+	}
+	r.SourceIP, r.SourceMask, r.SourceIPExclude = parseAddress(first(o["src_ip"]))
+	r.DestIP, r.DestMask, r.DestIPExclude = parseAddress(first(o["dest_ip"]))
+	r.Protocol, r.ProtocolExclude = parseProtocol(o["proto"])
+	r.SourcePort, r.SourcePortRangeMax, r.SourcePortExclude = parsePort(first(o["src_port"]))
+	r.DestPort, r.DestPortRangeMax, r.DestPortExclude = parsePort(first(o["dest_port"]))
+
+	switch {
+	case !r.Enable:
+		r.Status = "Disabled"
+	case misconfigured:
+		r.Status = "Error_Misconfigured"
+	default:
+		r.Status = "Enabled"
+	}
+	return r
+}
+
+// natOptions maps the address and port parameters of a NAT rule to the
+// redirect options. A DNAT redirect matches the original destination with
+// src_dip and src_dport and translates it to dest_ip and dest_port, a SNAT
+// redirect translates the source to src_dip and src_dport
+func natOptions(target string) map[string]string {
+	if target == "SNAT" {
+		return map[string]string{
+			"SourceIPRange":  "src_ip",
+			"SourcePortList": "src_port",
+			"DestIPRange":    "dest_ip",
+			"DestPortList":   "dest_port",
+			"ToAddresses":    "src_dip",
+			"ToPorts":        "src_dport",
+		}
+	}
+	return map[string]string{
+		"SourceIPRange":  "src_ip",
+		"SourcePortList": "src_port",
+		"DestIPRange":    "src_dip",
+		"DestPortList":   "src_dport",
+		"ToAddresses":    "dest_ip",
+		"ToPorts":        "dest_port",
+	}
+}
+
+// natRule maps a redirect section at position order of its NAT chain, the
+// addresses and ports keep the fw4 syntax
+func (cfg *config) natRule(e *entry, order int) device.XMikrotikFirewallRule {
+	o := e.sec.Options
+	r := device.XMikrotikFirewallRule{
+		Index:           e.index,
+		Enable:          o["enabled"] != "0",
+		Order:           order,
+		Description:     o["name"],
+		Target:          redirectTarget(e.sec),
+		Log:             o["log"] == "1",
+		SourceInterface: cfg.zoneInterface(o["src"]),
+		DestInterface:   cfg.zoneInterface(o["dest"]),
+	}
+	r.Protocol, r.ProtocolExclude = parseProtocol(o["proto"])
+	values := map[string]*string{
+		"SourceIPRange":  &r.SourceIPRange,
+		"SourcePortList": &r.SourcePortList,
+		"DestIPRange":    &r.DestIPRange,
+		"DestPortList":   &r.DestPortList,
+		"ToAddresses":    &r.ToAddresses,
+		"ToPorts":        &r.ToPorts,
+	}
+	for param, option := range natOptions(r.Target) {
+		*values[param] = o[option]
+	}
+	return r
+}
+
+// parseAddress splits an fw4 address such as !10.0.0.0/8 into address, mask
+// and negation, the mask is empty for a host address
+func parseAddress(value string) (address, mask string, exclude bool) {
+	value, exclude = strings.CutPrefix(value, "!")
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		if prefix.Bits() == prefix.Addr().BitLen() {
+			return prefix.Addr().String(), "", exclude
+		}
+		return prefix.Addr().String(), maskString(prefix.Bits(), prefix.Addr().Is4()), exclude
+	}
+	return value, "", exclude && value != ""
+}
+
+// maskString returns the mask of a prefix length as an address
+func maskString(bits int, v4 bool) string {
+	b := make([]byte, 16)
+	if v4 {
+		b = b[:4]
+	}
+	for i := 0; i < bits && i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr.String()
+}
+
+// maskBits returns the prefix length of a mask address
+func maskBits(mask string) (int, bool) {
+	addr, err := netip.ParseAddr(mask)
+	if err != nil {
+		return 0, false
+	}
+	ones, zero := 0, false
+	for _, b := range addr.AsSlice() {
+		for bit := 7; bit >= 0; bit-- {
+			switch set := b&(1<<bit) != 0; {
+			case set && zero:
+				return 0, false
+			case set:
+				ones++
+			default:
+				zero = true
+			}
+		}
+	}
+	return ones, true
+}
+
+// parseProtocol returns the protocol number of an fw4 proto option, -1 for
+// all and for several protocols such as the default tcp udp
+func parseProtocol(value string) (int, bool) {
+	value, exclude := strings.CutPrefix(strings.TrimSpace(value), "!")
+	names := strings.Fields(value)
+	if len(names) != 1 {
+		return -1, false
+	}
+	if number, ok := protocols[strings.ToLower(names[0])]; ok {
+		return number, exclude
+	}
+	if number, err := strconv.Atoi(names[0]); err == nil {
+		return number, exclude
+	}
+	return -1, false
+}
+
+// parsePort splits an fw4 port such as !1000-2000 into the first and last
+// port and negation, -1 when unset
+func parsePort(value string) (port, rangeMax int, exclude bool) {
+	value, exclude = strings.CutPrefix(value, "!")
+	low, high, isRange := strings.Cut(strings.ReplaceAll(value, ":", "-"), "-")
+	port, err := strconv.Atoi(low)
+	if err != nil {
+		return -1, -1, false
+	}
+	rangeMax = -1
+	if isRange {
+		if rangeMax, err = strconv.Atoi(high); err != nil {
+			rangeMax = -1
+		}
+	}
+	return port, rangeMax, exclude
+}
+
+// Firewall returns the filter chain, the NAT chains and the conntrack counters
+func (m *Manager) Firewall(ctx context.Context) (*device.FirewallDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.firewall(ctx)
+}
+
+func (m *Manager) firewall(ctx context.Context) (*device.FirewallDevice, error) {
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fw := &device.FirewallDevice{Enable: true, Config: "Advanced"}
+
+	chain := device.FirewallChain{Index: 1, Enable: true, Name: "Filter", Creator: "Defaults"}
+	for i, e := range cfg.rules {
+		chain.Rules = append(chain.Rules, cfg.filterRule(e, i+1))
+	}
+	chain.RuleNumberOfEntries = len(chain.Rules)
+	fw.Chains = []device.FirewallChain{chain}
+	fw.ChainNumberOfEntries = len(fw.Chains)
+
+	for i, nat := range natChains {
+		chain := device.XMikrotikFirewallChain{Index: i + 1, Enable: true, Name: nat.name}
+		for order, e := range cfg.natChain(i + 1) {
+			chain.Rules = append(chain.Rules, cfg.natRule(e, order+1))
+		}
+		chain.RuleNumberOfEntries = len(chain.Rules)
+		fw.X_ISPAPP_NAT.Chains = append(fw.X_ISPAPP_NAT.Chains, chain)
+	}
+	fw.X_ISPAPP_NAT.ChainNumberOfEntries = len(fw.X_ISPAPP_NAT.Chains)
+
+	// The counters are missing while the conntrack module is not loaded
+	fw.X_ISPAPP_ConnTrack.TotalEntries = m.counter(ctx, conntrackCount)
+	fw.X_ISPAPP_ConnTrack.MaxEntries = m.counter(ctx, conntrackMax)
+	return fw, nil
+}
+
+// counter reads a number from /proc, 0 when it cannot be read
+func (m *Manager) counter(ctx context.Context, path string) int {
+	output, err := ucicfg.Command(ctx, m.runner, "cat", path)
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.Atoi(strings.TrimSpace(output))
+	return value
+}
+
+// Collect stores the firewall in the tr069 store
+func (m *Manager) Collect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.collect(ctx)
+}
+
+func (m *Manager) collect(ctx context.Context) error {
+	fw, err := m.firewall(ctx)
+	if err != nil {
+		return err
+	}
+	return store.Replace([]string{Prefix + "Chain.", natPrefix}, Values(fw))
+}
+
+// Values flattens the firewall into parameters keyed by full name
+func Values(fw *device.FirewallDevice) map[string]string {
+	values := map[string]string{
+		Prefix + "Enable":                          strconv.FormatBool(fw.Enable),
+		Prefix + "Config":                          fw.Config,
+		Prefix + "ChainNumberOfEntries":            strconv.Itoa(fw.ChainNumberOfEntries),
+		Prefix + "X_ISPAPP_ConnTrack.TotalEntries": strconv.Itoa(fw.X_ISPAPP_ConnTrack.TotalEntries),
+		Prefix + "X_ISPAPP_ConnTrack.MaxEntries":   strconv.Itoa(fw.X_ISPAPP_ConnTrack.MaxEntries),
+		natPrefix + "ChainNumberOfEntries":         strconv.Itoa(fw.X_ISPAPP_NAT.ChainNumberOfEntries),
+	}
+	for _, c := range fw.Chains {
+		name := fmt.Sprintf("%sChain.%d.", Prefix, c.Index)
+		values[name+"Enable"] = strconv.FormatBool(c.Enable)
+		values[name+"Name"] = c.Name
+		values[name+"Creator"] = c.Creator
+		values[name+"RuleNumberOfEntries"] = strconv.Itoa(c.RuleNumberOfEntries)
+		for _, r := range c.Rules {
+			rule := fmt.Sprintf("%sRule.%d.", name, r.Index)
+			values[rule+"Enable"] = strconv.FormatBool(r.Enable)
+			values[rule+"Status"] = r.Status
+			values[rule+"Order"] = strconv.Itoa(r.Order)
+			values[rule+"Description"] = r.Description
+			values[rule+"Target"] = r.Target
+			values[rule+"Log"] = strconv.FormatBool(r.Log)
+			values[rule+"SourceInterface"] = r.SourceInterface
+			values[rule+"SourceAllInterfaces"] = strconv.FormatBool(r.SourceAllInterfaces)
+			values[rule+"DestInterface"] = r.DestInterface
+			values[rule+"DestAllInterfaces"] = strconv.FormatBool(r.DestAllInterfaces)
+			values[rule+"IPVersion"] = strconv.Itoa(r.IPVersion)
+			values[rule+"DestIP"] = r.DestIP
+			values[rule+"DestMask"] = r.DestMask
+			values[rule+"DestIPExclude"] = strconv.FormatBool(r.DestIPExclude)
+			values[rule+"SourceIP"] = r.SourceIP
+			values[rule+"SourceMask"] = r.SourceMask
+			values[rule+"SourceIPExclude"] = strconv.FormatBool(r.SourceIPExclude)
+			values[rule+"Protocol"] = strconv.Itoa(r.Protocol)
+			values[rule+"ProtocolExclude"] = strconv.FormatBool(r.ProtocolExclude)
+			values[rule+"DestPort"] = strconv.Itoa(r.DestPort)
+			values[rule+"DestPortRangeMax"] = strconv.Itoa(r.DestPortRangeMax)
+			values[rule+"DestPortExclude"] = strconv.FormatBool(r.DestPortExclude)
+			values[rule+"SourcePort"] = strconv.Itoa(r.SourcePort)
+			values[rule+"SourcePortRangeMax"] = strconv.Itoa(r.SourcePortRangeMax)
+			values[rule+"SourcePortExclude"] = strconv.FormatBool(r.SourcePortExclude)
+		}
+	}
+	for _, c := range fw.X_ISPAPP_NAT.Chains {
+		name := fmt.Sprintf("%sChain.%d.", natPrefix, c.Index)
+		values[name+"Enable"] = strconv.FormatBool(c.Enable)
+		values[name+"Name"] = c.Name
+		values[name+"RuleNumberOfEntries"] = strconv.Itoa(c.RuleNumberOfEntries)
+		for _, r := range c.Rules {
+			rule := fmt.Sprintf("%sRule.%d.", name, r.Index)
+			values[rule+"Enable"] = strconv.FormatBool(r.Enable)
+			values[rule+"Order"] = strconv.Itoa(r.Order)
+			values[rule+"Description"] = r.Description
+			values[rule+"Target"] = r.Target
+			values[rule+"Log"] = strconv.FormatBool(r.Log)
+			values[rule+"SourceInterface"] = r.SourceInterface
+			values[rule+"DestInterface"] = r.DestInterface
+			values[rule+"Protocol"] = strconv.Itoa(r.Protocol)
+			values[rule+"ProtocolExclude"] = strconv.FormatBool(r.ProtocolExclude)
+			values[rule+"SourceIPRange"] = r.SourceIPRange
+			values[rule+"SourcePortList"] = r.SourcePortList
+			values[rule+"DestIPRange"] = r.DestIPRange
+			values[rule+"DestPortList"] = r.DestPortList
+			values[rule+"ToAddresses"] = r.ToAddresses
+			values[rule+"ToPorts"] = r.ToPorts
+		}
+	}
+	return values
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// first returns the first word of a value
+func first(value string) string {
+	if fields := strings.Fields(value); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
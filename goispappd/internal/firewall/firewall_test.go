@@ -0,0 +1,245 @@
+package firewall_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/firewall"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+)
+
+// newUCI emulates the fw4 defaults with a port forward and a masquerade rule
+func newUCI() *ucitest.UCI {
+	uci := ucitest.New().
+		Section("network", "lan", "interface", "proto", "static", "device", "br-lan", "ip_int_instance", "1").
+		Section("network", "wan", "interface", "proto", "dhcp", "device", "eth1", "ip_int_instance", "2").
+		Section("network", "wan6", "interface", "proto", "dhcpv6", "device", "@wan", "ip_int_instance", "3").
+		Section("firewall", "cfg01dc81", "defaults", "input", "REJECT", "forward", "REJECT").
+		Section("firewall", "cfg02dc81", "zone", "name", "lan", "input", "ACCEPT").
+		Section("firewall", "cfg03dc81", "zone", "name", "wan", "input", "REJECT", "masq", "1").
+		Section("firewall", "cfg04ad58", "rule", "name", "Allow-DHCP-Renew", "src", "wan", "proto", "udp", "dest_port", "68", "target", "ACCEPT", "family", "ipv4").
+		Section("firewall", "cfg05ad58", "rule", "name", "Allow-Ping", "src", "wan", "proto", "icmp", "target", "ACCEPT").
+		Section("firewall", "cfg06ad58", "rule", "name", "Block-Office", "src", "lan", "dest", "*", "src_ip", "!10.0.0.0/8", "dest_port", "6881-6889", "enabled", "0").
+		Section("firewall", "cfg07ad58", "rule", "name", "Guest", "src", "guest", "target", "REJECT").
+		Section("firewall", "web", "redirect", "name", "Web", "src", "wan", "src_dport", "8080", "dest", "lan", "dest_ip", "192.168.1.10", "dest_port", "80", "proto", "tcp").
+		Section("firewall", "snat", "redirect", "name", "Office", "src", "lan", "dest", "wan", "src_dip", "192.0.2.10", "target", "SNAT")
+	uci.List("firewall", "cfg02dc81", "network", "lan")
+	uci.List("firewall", "cfg03dc81", "network", "wan", "wan6")
+	return uci.
+		On("fw4 reload", "").
+		On("cat /proc/sys/net/netfilter/nf_conntrack_count", "42\n").
+		On("cat /proc/sys/net/netfilter/nf_conntrack_max", "16384\n")
+}
+
+func newRegistry(t *testing.T) (*ucitest.UCI, *params.Registry) {
+	t.Helper()
+	ucitest.UseStore(t)
+
+	uci := newUCI()
+	manager := firewall.NewManager(uci)
+	if err := manager.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	registry := params.NewRegistry()
+	manager.Register(registry)
+	return uci, registry
+}
+
+func TestCollect(t *testing.T) {
+	uci, _ := newRegistry(t)
+
+	rule := "Device.Firewall.Chain.1.Rule."
+	nat := "Device.Firewall.X_ISPAPP_NAT.Chain."
+	ucitest.ExpectStored(t, map[string]string{
+		"Device.Firewall.Enable":                          "true",
+		"Device.Firewall.ChainNumberOfEntries":            "1",
+		"Device.Firewall.X_ISPAPP_ConnTrack.TotalEntries": "42",
+		"Device.Firewall.X_ISPAPP_ConnTrack.MaxEntries":   "16384",
+		"Device.Firewall.Chain.1.RuleNumberOfEntries":     "4",
+		rule + "1.Description":                            "Allow-DHCP-Renew",
+		rule + "1.Status":                                 "Enabled",
+		rule + "1.Order":                                  "1",
+		rule + "1.Target":                                 "Accept",
+		rule + "1.SourceInterface":                        "Device.IP.Interface.2.",
+		rule + "1.IPVersion":                              "4",
+		rule + "1.Protocol":                               "17",
+		rule + "1.DestPort":                               "68",
+		rule + "1.DestPortRangeMax":                       "-1",
+		rule + "2.Protocol":                               "1",
+		rule + "2.IPVersion":                              "-1",
+		rule + "3.Status":                                 "Disabled",
+		rule + "3.Target":                                 "Drop",
+		rule + "3.SourceInterface":                        "Device.IP.Interface.1.",
+		rule + "3.DestAllInterfaces":                      "true",
+		rule + "3.SourceIP":                               "10.0.0.0",
+		rule + "3.SourceMask":                             "255.0.0.0",
+		rule + "3.SourceIPExclude":                        "true",
+		rule + "3.DestPort":                               "6881",
+		rule + "3.DestPortRangeMax":                       "6889",
+		rule + "3.Protocol":                               "-1",
+		// The guest zone does not exist
+		rule + "4.Status": "Error_Misconfigured",
+		"Device.Firewall.X_ISPAPP_NAT.ChainNumberOfEntries": "2",
+		nat + "1.Name":                   "dstnat",
+		nat + "1.RuleNumberOfEntries":    "1",
+		nat + "1.Rule.1.Target":          "DNAT",
+		nat + "1.Rule.1.DestPortList":    "8080",
+		nat + "1.Rule.1.ToAddresses":     "192.168.1.10",
+		nat + "1.Rule.1.ToPorts":         "80",
+		nat + "1.Rule.1.SourceInterface": "Device.IP.Interface.2.",
+		nat + "1.Rule.1.Protocol":        "6",
+		nat + "2.Name":                   "srcnat",
+		nat + "2.Rule.2.Target":          "SNAT",
+		nat + "2.Rule.2.ToAddresses":     "192.0.2.10",
+	})
+	if got := uci.Option("firewall", "cfg07ad58", "fw_rule_instance"); got != "4" {
+		t.Errorf("Expected the rules to be numbered, got %q", got)
+	}
+	if got := uci.Option("firewall", "snat", "fw_redirect_instance"); got != "2" {
+		t.Errorf("Expected the redirects to be numbered, got %q", got)
+	}
+}
+
+func TestSet(t *testing.T) {
+	uci, registry := newRegistry(t)
+	rule := "Device.Firewall.Chain.1.Rule."
+
+	faults := registry.Set(ucitest.SetValues(
+		rule+"3.Enable", "true",
+		rule+"3.Target", "Reject",
+		rule+"3.SourceIPExclude", "false",
+		rule+"3.SourceMask", "255.255.0.0",
+		rule+"3.DestPortRangeMax", "-1",
+		rule+"3.Protocol", "6",
+		rule+"3.DestInterface", "Device.IP.Interface.3.",
+		rule+"3.DestAllInterfaces", "false",
+		rule+"3.IPVersion", "6",
+		rule+"3.Log", "true",
+	))
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	for option, want := range map[string]string{
+		"enabled":   "",
+		"target":    "REJECT",
+		"src_ip":    "10.0.0.0/16",
+		"dest_port": "6881",
+		"proto":     "tcp",
+		"dest":      "wan",
+		"family":    "ipv6",
+		"log":       "1",
+	} {
+		if got := uci.Option("firewall", "cfg06ad58", option); got != want {
+			t.Errorf("%s: expected %q, got %q", option, want, got)
+		}
+	}
+	if got := uci.Count("fw4 reload"); got != 1 {
+		t.Errorf("Expected one fw4 reload, got %d", got)
+	}
+	ucitest.ExpectStored(t, map[string]string{rule + "3.Status": "Enabled", rule + "3.SourceMask": "255.255.0.0"})
+
+	t.Run("NAT", func(t *testing.T) {
+		nat := "Device.Firewall.X_ISPAPP_NAT.Chain."
+		faults := registry.Set(ucitest.SetValues(
+			nat+"1.Rule.1.DestPortList", "8443",
+			nat+"1.Rule.1.ToPorts", "443",
+			nat+"2.Rule.2.ToAddresses", "192.0.2.11",
+		))
+		if len(faults) > 0 {
+			t.Fatalf("Set failed: %v", faults[0])
+		}
+		for _, option := range [][3]string{
+			{"web", "src_dport", "8443"},
+			{"web", "dest_port", "443"},
+			{"snat", "src_dip", "192.0.2.11"},
+		} {
+			if got := uci.Option("firewall", option[0], option[1]); got != option[2] {
+				t.Errorf("%s.%s: expected %q, got %q", option[0], option[1], option[2], got)
+			}
+		}
+	})
+
+	t.Run("Order", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(rule+"4.Order", "1", rule+"1.Order", "3"))
+		if len(faults) > 0 {
+			t.Fatalf("Set failed: %v", faults[0])
+		}
+		want := []string{"cfg07ad58", "cfg05ad58", "cfg04ad58", "cfg06ad58"}
+		if got := uci.Sections("firewall", "rule"); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected rules %v, got %v", want, got)
+		}
+		ucitest.ExpectStored(t, map[string]string{rule + "4.Order": "1", rule + "1.Order": "3", rule + "3.Order": "4"})
+	})
+
+	t.Run("UnknownZone", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(
+			rule+"2.Log", "true",
+			rule+"2.SourceInterface", "Device.IP.Interface.9.",
+		))
+		if len(faults) != 2 || faults[0].Code != params.FaultInternalError {
+			t.Fatalf("Expected an internal error, got %v", faults)
+		}
+		if got := uci.Option("firewall", "cfg05ad58", "log"); got != "" {
+			t.Errorf("Expected the request to be reverted, got log %q", got)
+		}
+	})
+
+	t.Run("UnknownInstance", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(rule+"9.Enable", "true"))
+		if len(faults) != 1 || faults[0].Code != params.FaultInvalidName {
+			t.Errorf("Expected an invalid name, got %v", faults)
+		}
+	})
+}
+
+func TestAddDeleteObject(t *testing.T) {
+	uci, registry := newRegistry(t)
+	rule := "Device.Firewall.Chain.1.Rule."
+	nat := "Device.Firewall.X_ISPAPP_NAT.Chain.2.Rule."
+
+	instance, fault := registry.AddObject(rule)
+	if fault != nil {
+		t.Fatalf("AddObject failed: %v", fault)
+	}
+	if instance != 5 {
+		t.Errorf("Expected instance 5, got %d", instance)
+	}
+	ucitest.ExpectStored(t, map[string]string{rule + "5.Status": "Disabled", rule + "5.Target": "Drop", rule + "5.Order": "5"})
+
+	instance, fault = registry.AddObject(nat)
+	if fault != nil {
+		t.Fatalf("AddObject failed: %v", fault)
+	}
+	if instance != 3 {
+		t.Errorf("Expected instance 3 after both redirects, got %d", instance)
+	}
+	ucitest.ExpectStored(t, map[string]string{nat + "3.Target": "SNAT", nat + "3.Enable": "false"})
+
+	if fault := registry.DeleteObject(rule + "2."); fault != nil {
+		t.Fatalf("DeleteObject failed: %v", fault)
+	}
+	if uci.Exists("firewall", "cfg05ad58") {
+		t.Error("Expected the rule section to be deleted")
+	}
+	ucitest.ExpectStored(t, map[string]string{"Device.Firewall.Chain.1.RuleNumberOfEntries": "4", rule + "2.Description": "", rule + "3.Order": "2"})
+
+	if fault := registry.DeleteObject(rule + "2."); fault == nil || fault.Code != params.FaultInvalidName {
+		t.Errorf("Expected deleting a missing rule to fail, got %v", fault)
+	}
+}
+
+func TestZoneInterfaces(t *testing.T) {
+	manager := firewall.NewManager(newUCI())
+	refs, err := manager.ZoneInterfaces(context.Background(), "wan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Device.IP.Interface.2.", "Device.IP.Interface.3."}; !reflect.DeepEqual(refs, expected) {
+		t.Errorf("Expected %v, got %v", expected, refs)
+	}
+	if refs, _ := manager.ZoneInterfaces(context.Background(), "guest"); refs != nil {
+		t.Errorf("Expected no interface of a missing zone, got %v", refs)
+	}
+}
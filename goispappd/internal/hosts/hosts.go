@@ -0,0 +1,172 @@
+// Package hosts builds the TR-181 Device.Hosts.Host table on OpenWrt from the
+// dnsmasq lease file, the kernel neighbor table and the WiFi station lists.
+package hosts
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+)
+
+// LeasesPath is the dnsmasq lease file
+const LeasesPath = "/tmp/dhcp.leases"
+
+// ARPPath is the kernel IPv4 neighbor table
+const ARPPath = "/proc/net/arp"
+
+// atfComplete is the ATF_COM flag of /proc/net/arp, set once the neighbor answered
+const atfComplete = 0x2
+
+// Lease is a dnsmasq DHCP lease
+type Lease struct {
+	PhysAddress string    // Client MAC address, lower case
+	IPAddress   string    // Leased address
+	HostName    string    // Host name sent by the client, empty when unknown
+	ClientID    string    // DHCP client identifier, empty when unknown
+	Expires     time.Time // Zero for an infinite lease
+}
+
+// Neighbor is an entry of the kernel neighbor table
+type Neighbor struct {
+	IPAddress   string // Neighbor address
+	PhysAddress string // Neighbor MAC address, lower case
+	Device      string // Linux device the neighbor was seen on
+	Reachable   bool   // Whether the neighbor answered address resolution
+}
+
+// Station is a WiFi client associated with one of the access points
+type Station struct {
+	PhysAddress      string // Station MAC address, lower case
+	AssociatedDevice string // Device.WiFi.AccessPoint.{i}.AssociatedDevice.{j}. reference
+	Layer1Interface  string // Device.WiFi.SSID.{i}. reference of the access point
+}
+
+// ParseLeases parses the dnsmasq lease file, one "expiry mac ip hostname
+// clientid" line per lease with "*" for unknown fields
+func ParseLeases(data string) []Lease {
+	var leases []Lease
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			// DUID line of DHCPv6 leases or garbage
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		lease := Lease{PhysAddress: strings.ToLower(fields[1]), IPAddress: fields[2]}
+		if expiry > 0 {
+			lease.Expires = time.Unix(expiry, 0)
+		}
+		if fields[3] != "*" {
+			lease.HostName = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "*" {
+			lease.ClientID = fields[4]
+		}
+		leases = append(leases, lease)
+	}
+	return leases
+}
+
+// ParseARP parses /proc/net/arp, skipping the header and incomplete entries
+func ParseARP(data string) []Neighbor {
+	var neighbors []Neighbor
+	for _, line := range strings.Split(data, "\n") {
+		// IP address, HW type, Flags, HW address, Mask, Device
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] == "IP" {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil || fields[3] == "00:00:00:00:00:00" {
+			continue
+		}
+		neighbors = append(neighbors, Neighbor{
+			IPAddress:   fields[0],
+			PhysAddress: strings.ToLower(fields[3]),
+			Device:      fields[5],
+			Reachable:   flags&atfComplete != 0,
+		})
+	}
+	return neighbors
+}
+
+// Sources are the inputs of one Hosts table collection
+type Sources struct {
+	Leases      []Lease
+	Neighbors   []Neighbor
+	Stations    []Station
+	DHCPClients map[string]string // DHCPv4 server client references by MAC address
+	Interfaces  map[string]string // Device.IP.Interface.{i}. references by Linux device
+	Previous    map[string]int    // Indices of the stored Host table by MAC address
+}
+
+// Hosts merges the sources into one entry per MAC address sorted by index.
+// Hosts already in the stored table keep their index, new hosts are numbered
+// after the highest stored index
+func (s Sources) Hosts(now time.Time) []device.HostEntry {
+	byMAC := make(map[string]*device.HostEntry)
+	entry := func(mac string) *device.HostEntry {
+		host, ok := byMAC[mac]
+		if !ok {
+			host = &device.HostEntry{PhysAddress: mac}
+			byMAC[mac] = host
+		}
+		return host
+	}
+
+	for _, lease := range s.Leases {
+		host := entry(lease.PhysAddress)
+		host.IPAddress = lease.IPAddress
+		host.HostName = lease.HostName
+		host.DHCPClient = s.DHCPClients[lease.PhysAddress]
+		host.LeaseTimeRemaining = -1
+		if !lease.Expires.IsZero() {
+			host.LeaseTimeRemaining = int32(max(lease.Expires.Sub(now)/time.Second, 0))
+		}
+	}
+	for _, neighbor := range s.Neighbors {
+		host := entry(neighbor.PhysAddress)
+		if host.IPAddress == "" {
+			host.IPAddress = neighbor.IPAddress
+		}
+		host.Layer3Interface = s.Interfaces[neighbor.Device]
+		host.Active = host.Active || neighbor.Reachable
+	}
+	for _, station := range s.Stations {
+		host := entry(station.PhysAddress)
+		host.AssociatedDevice = station.AssociatedDevice
+		host.Layer1Interface = station.Layer1Interface
+		host.Active = true
+	}
+
+	// Indices of hosts that just left are not handed out again right away
+	next := 0
+	for _, index := range s.Previous {
+		next = max(next, index)
+	}
+	// New hosts are numbered in MAC order so a collection is deterministic
+	macs := make([]string, 0, len(byMAC))
+	for mac := range byMAC {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	hosts := make([]device.HostEntry, 0, len(byMAC))
+	for _, mac := range macs {
+		host := byMAC[mac]
+		if index, ok := s.Previous[mac]; ok {
+			host.Index = index
+		} else {
+			next++
+			host.Index = next
+		}
+		hosts = append(hosts, *host)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Index < hosts[j].Index })
+	return hosts
+}
@@ -0,0 +1,74 @@
+package hosts_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/hosts"
+)
+
+const leases = `1700003600 AA:BB:CC:00:00:01 192.168.1.10 laptop 01:aa:bb:cc:00:00:01
+0 aa:bb:cc:00:00:02 192.168.1.11 * *
+duid 00:01:00:01:2c:5f:1a:3b:94:83:c4:a0:11:22
+`
+
+const arp = `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.10     0x1         0x2         aa:bb:cc:00:00:01     *        br-lan
+192.168.1.20     0x1         0x2         aa:bb:cc:00:00:03     *        br-lan
+192.168.1.30     0x1         0x0         00:00:00:00:00:00     *        br-lan
+192.168.1.11     0x1         0x0         aa:bb:cc:00:00:02     *        br-lan
+`
+
+func TestParse(t *testing.T) {
+	parsed := hosts.ParseLeases(leases)
+	if len(parsed) != 2 {
+		t.Fatalf("Expected 2 leases, got %+v", parsed)
+	}
+	if parsed[0].PhysAddress != "aa:bb:cc:00:00:01" || parsed[0].HostName != "laptop" || parsed[0].Expires.Unix() != 1700003600 {
+		t.Errorf("Unexpected lease: %+v", parsed[0])
+	}
+	if parsed[1].HostName != "" || parsed[1].ClientID != "" || !parsed[1].Expires.IsZero() {
+		t.Errorf("Expected an anonymous infinite lease, got %+v", parsed[1])
+	}
+
+	neighbors := hosts.ParseARP(arp)
+	if len(neighbors) != 3 {
+		t.Fatalf("Expected 3 neighbors, got %+v", neighbors)
+	}
+	if !neighbors[0].Reachable || neighbors[2].Reachable || neighbors[2].Device != "br-lan" {
+		t.Errorf("Unexpected neighbors: %+v", neighbors)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	sources := hosts.Sources{
+		Leases:    hosts.ParseLeases(leases),
+		Neighbors: hosts.ParseARP(arp),
+		Stations: []hosts.Station{{
+			PhysAddress:      "aa:bb:cc:00:00:04",
+			AssociatedDevice: "Device.WiFi.AccessPoint.1.AssociatedDevice.1.",
+			Layer1Interface:  "Device.WiFi.SSID.1.",
+		}},
+		DHCPClients: map[string]string{"aa:bb:cc:00:00:01": "Device.DHCPv4.Server.Pool.1.Client.3."},
+		Interfaces:  map[string]string{"br-lan": "Device.IP.Interface.1."},
+		Previous:    map[string]int{"aa:bb:cc:00:00:03": 2, "aa:bb:cc:00:00:09": 5},
+	}
+	got := sources.Hosts(time.Unix(1700000000, 0))
+	expected := []device.HostEntry{
+		{Index: 2, PhysAddress: "aa:bb:cc:00:00:03", IPAddress: "192.168.1.20", Layer3Interface: "Device.IP.Interface.1.", Active: true},
+		{Index: 6, PhysAddress: "aa:bb:cc:00:00:01", IPAddress: "192.168.1.10", HostName: "laptop", DHCPClient: "Device.DHCPv4.Server.Pool.1.Client.3.",
+			Layer3Interface: "Device.IP.Interface.1.", Active: true, LeaseTimeRemaining: 3600},
+		{Index: 7, PhysAddress: "aa:bb:cc:00:00:02", IPAddress: "192.168.1.11", Layer3Interface: "Device.IP.Interface.1.", LeaseTimeRemaining: -1},
+		{Index: 8, PhysAddress: "aa:bb:cc:00:00:04", AssociatedDevice: "Device.WiFi.AccessPoint.1.AssociatedDevice.1.",
+			Layer1Interface: "Device.WiFi.SSID.1.", Active: true},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %d hosts, got %+v", len(expected), got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Host %d:\nexpected %+v\ngot      %+v", i, expected[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package ip
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// applyTimeout bounds the uci calls and the network reload of one request
+const applyTimeout = 30 * time.Second
+
+// interfaceParams are the parameters of Device.IP.
+var interfaceParams = map[string]params.Param{
+	"InterfaceNumberOfEntries":                        {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"Interface.{i}.Enable":                            {Type: soap.TR069TypeBoolean, Writable: true},
+	"Interface.{i}.Status":                            {Type: soap.TR069TypeString},
+	"Interface.{i}.Name":                              {Type: soap.TR069TypeString},
+	"Interface.{i}.LowerLayers":                       {Type: soap.TR069TypeString},
+	"Interface.{i}.Type":                              {Type: soap.TR069TypeString},
+	"Interface.{i}.X_ISPAPP_Device":                   {Type: soap.TR069TypeString},
+	"Interface.{i}.IPv4AddressNumberOfEntries":        {Type: soap.TR069TypeUnsignedInt},
+	"Interface.{i}.IPv6AddressNumberOfEntries":        {Type: soap.TR069TypeUnsignedInt},
+	"Interface.{i}.IPv4Address.{i}.Enable":            {Type: soap.TR069TypeBoolean},
+	"Interface.{i}.IPv4Address.{i}.Status":            {Type: soap.TR069TypeString},
+	"Interface.{i}.IPv4Address.{i}.IPAddress":         {Type: soap.TR069TypeString, Writable: true, Check: checkIPv4},
+	"Interface.{i}.IPv4Address.{i}.SubnetMask":        {Type: soap.TR069TypeString, Writable: true, Check: checkMask},
+	"Interface.{i}.IPv4Address.{i}.AddressingType":    {Type: soap.TR069TypeString},
+	"Interface.{i}.IPv6Address.{i}.Enable":            {Type: soap.TR069TypeBoolean},
+	"Interface.{i}.IPv6Address.{i}.Status":            {Type: soap.TR069TypeString},
+	"Interface.{i}.IPv6Address.{i}.IPAddressStatus":   {Type: soap.TR069TypeString},
+	"Interface.{i}.IPv6Address.{i}.IPAddress":         {Type: soap.TR069TypeString, Writable: true, Check: checkIPv6},
+	"Interface.{i}.IPv6Address.{i}.Origin":            {Type: soap.TR069TypeString},
+	"Interface.{i}.IPv6Address.{i}.PreferredLifetime": {Type: soap.TR069TypeDateTime},
+	"Interface.{i}.IPv6Address.{i}.ValidLifetime":     {Type: soap.TR069TypeDateTime},
+}
+
+func checkIPv4(value string) error {
+	if addr, err := netip.ParseAddr(value); err != nil || !addr.Is4() {
+		return fmt.Errorf("%q is not an IPv4 address", value)
+	}
+	return nil
+}
+
+func checkMask(value string) error {
+	if mask, err := netip.ParseAddr(value); err != nil || maskBits(mask) < 0 {
+		return fmt.Errorf("%q is not a subnet mask", value)
+	}
+	return nil
+}
+
+func checkIPv6(value string) error {
+	if addr, err := netip.ParseAddr(value); err != nil || !addr.Is6() || addr.Is4In6() {
+		return fmt.Errorf("%q is not an IPv6 address", value)
+	}
+	return nil
+}
+
+// Register adds Device.IP.Interface. to registry
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{
+		Prefix: Prefix,
+		Params: interfaceParams,
+		Apply:  m.apply,
+		Commit: m.save,
+		Revert: m.revert,
+	})
+}
+
+// commit saves the network config, reloads netifd and refreshes the store
+func (m *Manager) commit(ctx context.Context) error {
+	if err := m.uci.Commit(ctx); err != nil {
+		return err
+	}
+	if _, err := ucicfg.Command(ctx, m.runner, "/etc/init.d/network", "reload"); err != nil {
+		return err
+	}
+	return m.collect(ctx)
+}
+
+// path splits a name below Device.IP.Interface. into the interface instance,
+// the address table and instance, and the parameter
+func path(name string) (index int, table string, address int, param string, err error) {
+	rest := strings.TrimPrefix(name, interfacePrefix)
+	parts := strings.Split(rest, ".")
+	index, err = strconv.Atoi(parts[0])
+	if err != nil || len(parts) < 2 {
+		return 0, "", 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	if len(parts) == 2 {
+		return index, "", 0, parts[1], nil
+	}
+	if len(parts) != 4 {
+		return 0, "", 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	address, err = strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, "", 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	return index, parts[1], address, parts[3], nil
+}
+
+// change is the parameters of one request for an interface
+type change struct {
+	enable string
+	v4     map[int]map[string]string // Parameters by IPv4Address instance
+	v6     map[int]string            // IPAddress by IPv6Address instance
+}
+
+// save commits the values staged by apply
+func (m *Manager) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	return m.commit(ctx)
+}
+
+// revert discards the values staged by apply
+func (m *Manager) revert() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	m.uci.Restore(ctx)
+}
+
+// apply stages the values of one SetParameterValues request, the registry
+// commits or reverts them with the other objects of the request
+func (m *Manager) apply(values map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	changes := make(map[int]*change)
+	for name, value := range values {
+		index, table, address, param, err := path(name)
+		if err != nil {
+			return err
+		}
+		if changes[index] == nil {
+			changes[index] = &change{v4: map[int]map[string]string{}, v6: map[int]string{}}
+		}
+		c := changes[index]
+		switch table {
+		case "":
+			c.enable = value
+		case "IPv4Address":
+			if c.v4[address] == nil {
+				c.v4[address] = make(map[string]string)
+			}
+			c.v4[address][param] = value
+		case "IPv6Address":
+			c.v6[address] = value
+		}
+	}
+
+	indices := make([]int, 0, len(changes))
+	for index := range changes {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		i := cfg.find(index)
+		if i == nil {
+			err = fmt.Errorf("%w: %s%d.", params.ErrInvalidName, interfacePrefix, index)
+		} else {
+			err = m.applyInterface(ctx, cfg, i, changes[index])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyInterface writes the changes of one interface. Only the addresses of
+// the static protocol are configured, the others are read-only
+func (m *Manager) applyInterface(ctx context.Context, cfg *config, i *iface, c *change) error {
+	if c.enable != "" {
+		disabled := ""
+		if !soap.BooleanValues[strings.ToLower(c.enable)] {
+			disabled = "1"
+		}
+		if err := m.uci.Set(ctx, i.sec.Name, "disabled", disabled); err != nil {
+			return err
+		}
+	}
+	name := fmt.Sprintf("%s%d.", interfacePrefix, i.index)
+	entries := cfg.ipInterface(i, nil, time.Now())
+
+	if len(c.v4) > 0 {
+		prefixes := i.staticIPv4()
+		for address, values := range c.v4 {
+			if address < 1 || address > len(entries.IPv4Addresses) {
+				return fmt.Errorf("%w: %sIPv4Address.%d.", params.ErrInvalidName, name, address)
+			}
+			if address > len(prefixes) {
+				return fmt.Errorf("%w: %sIPv4Address.%d. is assigned by %s", params.ErrNotWritable, name, address, i.proto())
+			}
+			prefix := prefixes[address-1]
+			addr, bits := prefix.Addr(), prefix.Bits()
+			if value, ok := values["IPAddress"]; ok {
+				addr = netip.MustParseAddr(value)
+			}
+			if value, ok := values["SubnetMask"]; ok {
+				bits = maskBits(netip.MustParseAddr(value))
+			}
+			if bits < 0 {
+				bits = 32
+			}
+			if !addr.IsValid() {
+				return fmt.Errorf("%sIPv4Address.%d. has no address to apply the mask to", name, address)
+			}
+			prefixes[address-1] = netip.PrefixFrom(addr, bits)
+		}
+		if err := m.writeIPv4(ctx, i, prefixes); err != nil {
+			return err
+		}
+	}
+
+	if len(c.v6) > 0 {
+		prefixes := i.staticIPv6()
+		for address, value := range c.v6 {
+			if address < 1 || address > len(entries.IPv6Addresses) {
+				return fmt.Errorf("%w: %sIPv6Address.%d.", params.ErrInvalidName, name, address)
+			}
+			if address > len(prefixes) {
+				return fmt.Errorf("%w: %sIPv6Address.%d. is assigned by %s", params.ErrNotWritable, name, address, i.proto())
+			}
+			bits := prefixes[address-1].Bits()
+			if bits < 0 {
+				bits = defaultIPv6Length
+			}
+			prefixes[address-1] = netip.PrefixFrom(netip.MustParseAddr(value), bits)
+		}
+		items := make([]string, len(prefixes))
+		for k, prefix := range prefixes {
+			items[k] = prefix.String()
+		}
+		if err := m.uci.SetList(ctx, i.sec.Name, "ip6addr", items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeIPv4 writes the IPv4 addresses of a static interface, a single address
+// keeps the ipaddr and netmask form OpenWrt configures by default
+func (m *Manager) writeIPv4(ctx context.Context, i *iface, prefixes []netip.Prefix) error {
+	if len(prefixes) == 1 && !strings.Contains(i.sec.Options["ipaddr"], "/") {
+		if err := m.uci.Set(ctx, i.sec.Name, "ipaddr", prefixes[0].Addr().String()); err != nil {
+			return err
+		}
+		return m.uci.Set(ctx, i.sec.Name, "netmask", maskString(prefixes[0].Bits()))
+	}
+	items := make([]string, len(prefixes))
+	for k, prefix := range prefixes {
+		items[k] = prefix.String()
+	}
+	if err := m.uci.Set(ctx, i.sec.Name, "netmask", ""); err != nil {
+		return err
+	}
+	return m.uci.SetList(ctx, i.sec.Name, "ipaddr", items)
+}
@@ -0,0 +1,534 @@
+// Package ip maps TR-181 Device.IP.Interface to the interface sections of
+// /etc/config/network and their state in netifd. An Interface is a netifd
+// interface, its addresses are the configured ones for the static protocol
+// and the ones netifd learned otherwise.
+package ip
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// Prefix is the object mapped by the package
+const Prefix = "Device.IP."
+
+// interfacePrefix is the Interface table, also the prefix of its references
+const interfacePrefix = Prefix + "Interface."
+
+// interfaceInstance numbers the interface sections, it is shared with the
+// tr181 shell scripts
+const interfaceInstance = "ip_int_instance"
+
+// infiniteTime is the TR-181 dateTime of a lifetime that never ends
+const infiniteTime = "9999-12-31T23:59:59Z"
+
+// defaultIPv6Length is the prefix length of an ip6addr without one
+const defaultIPv6Length = 64
+
+// ipcpProtos are the protocols whose IPv4 address is negotiated by IPCP
+var ipcpProtos = map[string]bool{"ppp": true, "pppoe": true, "pppoa": true, "pptp": true, "l2tp": true, "3g": true}
+
+// tunnelProtos are the protocols of tunnel interfaces
+var tunnelProtos = map[string]bool{
+	"gre": true, "gretap": true, "grev6": true, "grev6tap": true, "ipip": true, "6in4": true, "6to4": true,
+	"6rd": true, "dslite": true, "map": true, "464xlat": true, "vti": true, "vxlan": true, "wireguard": true,
+}
+
+// pppProtos are the protocols whose layer 3 device is the pppd one netifd
+// names <proto>-<interface>
+var pppProtos = map[string]bool{"ppp": true, "pppoe": true, "pppoa": true}
+
+// lowerLayers are the stored tables whose Name parameter is a Linux device,
+// an Interface carried by that device has the entry as its LowerLayers
+var lowerLayers = regexp.MustCompile(`^(Device\.(?:Ethernet\.Link|PPP\.Interface)\.\d+\.)Name$`)
+
+// Manager reads the IP interfaces from netifd and writes them with uci
+type Manager struct {
+	runner  exec.Runner
+	uci     *ucicfg.Config
+	numbers *ucicfg.Config // Instance numbers, committed apart from the requests
+	mu      sync.Mutex
+}
+
+// NewManager creates a Manager running uci, ubus and netifd through runner
+func NewManager(runner exec.Runner) *Manager {
+	c := ucicfg.New(runner, "network", "ip")
+	return &Manager{runner: runner, uci: c, numbers: c.Numbers()}
+}
+
+// status is an interface of ubus call network.interface dump
+type status struct {
+	Interface   string    `json:"interface"`
+	Up          bool      `json:"up"`
+	Pending     bool      `json:"pending"`
+	Available   bool      `json:"available"`
+	Proto       string    `json:"proto"`
+	L3Device    string    `json:"l3_device"`
+	Device      string    `json:"device"`
+	IPv4Address []address `json:"ipv4-address"`
+	IPv6Address []address `json:"ipv6-address"`
+	Assignments []struct {
+		LocalAddress *address `json:"local-address"`
+	} `json:"ipv6-prefix-assignment"`
+}
+
+// address is an address of the dump, lifetimes are seconds and missing when
+// infinite
+type address struct {
+	Address   string `json:"address"`
+	Mask      int    `json:"mask"`
+	Preferred *int64 `json:"preferred"`
+	Valid     *int64 `json:"valid"`
+}
+
+// iface is an interface section with its instance and netifd state
+type iface struct {
+	sec    *uci.Section
+	index  int
+	status *status // nil when netifd does not know the interface
+}
+
+// config is the network config with its instance numbers
+type config struct {
+	interfaces []*iface
+	dumped     bool // Whether netifd answered, interfaces are Unknown otherwise
+}
+
+// load reads the network config and the netifd state, numbering the
+// interface sections that have no instance yet
+func (m *Manager) load(ctx context.Context) (*config, error) {
+	sections, err := m.uci.Show(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{}
+	statuses := make(map[string]*status)
+	if output, err := ucicfg.Command(ctx, m.runner, "ubus", "call", "network.interface", "dump"); err == nil {
+		var dump struct {
+			Interface []*status `json:"interface"`
+		}
+		if json.Unmarshal([]byte(output), &dump) == nil {
+			cfg.dumped = true
+			for _, s := range dump.Interface {
+				statuses[s.Interface] = s
+			}
+		}
+	}
+
+	numbered := false
+	next := ucicfg.MaxInstance(sections, "interface", interfaceInstance)
+	for _, sec := range sections {
+		// Alias sections of old releases are not interfaces of their own
+		if sec.SectionType != "interface" || sec.Options["type"] == "alias" {
+			continue
+		}
+		index, err := strconv.Atoi(sec.Options[interfaceInstance])
+		if err != nil {
+			next++
+			index = next
+			if err := m.numbers.Set(ctx, sec.Name, interfaceInstance, strconv.Itoa(index)); err != nil {
+				return nil, err
+			}
+			numbered = true
+		}
+		cfg.interfaces = append(cfg.interfaces, &iface{sec: sec, index: index, status: statuses[sec.Name]})
+	}
+	if numbered {
+		if err := m.numbers.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(cfg.interfaces, func(i, j int) bool { return cfg.interfaces[i].index < cfg.interfaces[j].index })
+	return cfg, nil
+}
+
+// find returns the interface numbered index
+func (cfg *config) find(index int) *iface {
+	for _, i := range cfg.interfaces {
+		if i.index == index {
+			return i
+		}
+	}
+	return nil
+}
+
+// proto returns the running protocol, the configured one while netifd does
+// not know the interface
+func (i *iface) proto() string {
+	if i.status != nil && i.status.Proto != "" {
+		return i.status.Proto
+	}
+	return i.sec.Options["proto"]
+}
+
+// device returns the layer 3 device, the configured device while the
+// interface is down
+func (i *iface) device() string {
+	if i.status != nil && i.status.L3Device != "" {
+		return i.status.L3Device
+	}
+	if proto := i.proto(); pppProtos[proto] {
+		return proto + "-" + i.sec.Name
+	}
+	// ifname before OpenWrt 21.02, an @ alias has no device of its own
+	device := first(valueOr(i.sec.Options["device"], i.sec.Options["ifname"]))
+	if strings.HasPrefix(device, "@") {
+		return ""
+	}
+	return device
+}
+
+// staticIPv4 returns the configured IPv4 addresses, the single ipaddr and
+// netmask form or a list of CIDR addresses. Invalid items are kept invalid so
+// the entries keep their indices
+func (i *iface) staticIPv4() []netip.Prefix {
+	if i.proto() != "static" {
+		return nil
+	}
+	items := i.sec.Lists["ipaddr"]
+	var prefixes []netip.Prefix
+	for _, item := range items {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			addr, _ := netip.ParseAddr(item)
+			bits := 32
+			if mask, err := netip.ParseAddr(i.sec.Options["netmask"]); err == nil && len(items) == 1 {
+				bits = maskBits(mask)
+			}
+			prefix = netip.PrefixFrom(addr, bits)
+		}
+		if !prefix.Addr().Is4() {
+			prefix = netip.Prefix{}
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// staticIPv6 returns the configured IPv6 addresses
+func (i *iface) staticIPv6() []netip.Prefix {
+	if i.proto() != "static" {
+		return nil
+	}
+	var prefixes []netip.Prefix
+	for _, item := range i.sec.Lists["ip6addr"] {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			addr, _ := netip.ParseAddr(item)
+			prefix = netip.PrefixFrom(addr, defaultIPv6Length)
+		}
+		if !prefix.Addr().Is6() {
+			prefix = netip.Prefix{}
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// interfaceStatus maps the netifd state to the TR-181 Status
+func (cfg *config) interfaceStatus(i *iface, enable bool) string {
+	switch {
+	case !cfg.dumped:
+		return "Unknown"
+	case i.status != nil && i.status.Up:
+		return "Up"
+	case !enable || i.status == nil:
+		return "Down"
+	case i.status.Pending:
+		return "Dormant"
+	case !i.status.Available:
+		return "LowerLayerDown"
+	default:
+		return "Down"
+	}
+}
+
+// interfaceType returns Loopback, Tunnel or Normal
+func (i *iface) interfaceType() string {
+	switch {
+	case i.sec.Name == "loopback" || i.device() == "lo":
+		return "Loopback"
+	case tunnelProtos[i.proto()]:
+		return "Tunnel"
+	default:
+		return "Normal"
+	}
+}
+
+// addressingType returns how a learned IPv4 address was assigned
+func (i *iface) addressingType(addr netip.Addr) string {
+	switch proto := i.proto(); {
+	case addr.IsLinkLocalUnicast():
+		return "AutoIP"
+	case proto == "dhcp":
+		return "DHCP"
+	case ipcpProtos[proto]:
+		return "IPCP"
+	default:
+		return "X_ISPAPP_Dynamic"
+	}
+}
+
+// ipInterface maps an interface, devices holds the lower layer references by
+// Linux device
+func (cfg *config) ipInterface(i *iface, devices map[string]string, now time.Time) device.IPInterface {
+	ip := device.IPInterface{
+		Index:           i.index,
+		Enable:          i.sec.Options["disabled"] != "1",
+		Name:            i.sec.Name,
+		Type:            i.interfaceType(),
+		X_ISPAPP_Device: i.device(),
+	}
+	ip.Status = cfg.interfaceStatus(i, ip.Enable)
+	ip.LowerLayers = devices[ip.X_ISPAPP_Device]
+
+	var learned4, learned6 []address
+	if i.status != nil && i.status.Up {
+		learned4 = i.status.IPv4Address
+		learned6 = i.status.IPv6Address
+		for _, assignment := range i.status.Assignments {
+			if assignment.LocalAddress != nil {
+				learned6 = append(learned6, *assignment.LocalAddress)
+			}
+		}
+	}
+
+	addressStatus := func(valid bool) string {
+		switch {
+		case !valid:
+			return "Error_Misconfigured"
+		case !ip.Enable:
+			return "Disabled"
+		default:
+			return "Enabled"
+		}
+	}
+	configured := make(map[netip.Addr]bool)
+	for _, prefix := range i.staticIPv4() {
+		entry := device.IPv4AddressEntry{
+			Index:          len(ip.IPv4Addresses) + 1,
+			Enable:         ip.Enable,
+			Status:         addressStatus(prefix.IsValid()),
+			AddressingType: "Static",
+		}
+		if prefix.IsValid() {
+			entry.IPAddress = prefix.Addr().String()
+			entry.SubnetMask = maskString(prefix.Bits())
+			configured[prefix.Addr()] = true
+		}
+		ip.IPv4Addresses = append(ip.IPv4Addresses, entry)
+	}
+	for _, learned := range learned4 {
+		addr, err := netip.ParseAddr(learned.Address)
+		if err != nil || configured[addr] {
+			continue
+		}
+		ip.IPv4Addresses = append(ip.IPv4Addresses, device.IPv4AddressEntry{
+			Index:          len(ip.IPv4Addresses) + 1,
+			Enable:         true,
+			Status:         "Enabled",
+			IPAddress:      addr.String(),
+			SubnetMask:     maskString(learned.Mask),
+			AddressingType: i.addressingType(addr),
+		})
+	}
+	ip.IPv4AddressNumberOfEntries = len(ip.IPv4Addresses)
+
+	for _, prefix := range i.staticIPv6() {
+		entry := device.IPv6AddressEntry{
+			Index:             len(ip.IPv6Addresses) + 1,
+			Enable:            ip.Enable,
+			Status:            addressStatus(prefix.IsValid()),
+			IPAddressStatus:   "Preferred",
+			Origin:            "Static",
+			PreferredLifetime: infiniteTime,
+			ValidLifetime:     infiniteTime,
+		}
+		if prefix.IsValid() {
+			entry.IPAddress = prefix.Addr().String()
+			configured[prefix.Addr()] = true
+		}
+		ip.IPv6Addresses = append(ip.IPv6Addresses, entry)
+	}
+	for _, learned := range learned6 {
+		addr, err := netip.ParseAddr(learned.Address)
+		if err != nil || configured[addr] {
+			continue
+		}
+		configured[addr] = true
+		entry := device.IPv6AddressEntry{
+			Index:             len(ip.IPv6Addresses) + 1,
+			Enable:            true,
+			Status:            "Enabled",
+			IPAddressStatus:   "Preferred",
+			IPAddress:         addr.String(),
+			Origin:            "AutoConfigured",
+			PreferredLifetime: lifetime(learned.Preferred, now),
+			ValidLifetime:     lifetime(learned.Valid, now),
+		}
+		if i.proto() == "dhcpv6" {
+			entry.Origin = "DHCPv6"
+		}
+		if learned.Preferred != nil && *learned.Preferred <= 0 {
+			entry.IPAddressStatus = "Deprecated"
+		}
+		ip.IPv6Addresses = append(ip.IPv6Addresses, entry)
+	}
+	ip.IPv6AddressNumberOfEntries = len(ip.IPv6Addresses)
+	return ip
+}
+
+// lifetime returns the dateTime a lifetime in seconds ends
+func lifetime(seconds *int64, now time.Time) string {
+	if seconds == nil {
+		return infiniteTime
+	}
+	return now.Add(time.Duration(*seconds) * time.Second).UTC().Format(time.RFC3339)
+}
+
+// maskString returns the dotted IPv4 mask of a prefix length
+func maskString(bits int) string {
+	if bits < 0 || bits > 32 {
+		return ""
+	}
+	mask := uint32(0xffffffff) << (32 - bits)
+	if bits == 0 {
+		mask = 0
+	}
+	return netip.AddrFrom4([4]byte{byte(mask >> 24), byte(mask >> 16), byte(mask >> 8), byte(mask)}).String()
+}
+
+// maskBits returns the prefix length of a dotted IPv4 mask, -1 for a mask
+// with holes
+func maskBits(mask netip.Addr) int {
+	if !mask.Is4() {
+		return -1
+	}
+	b := mask.As4()
+	value := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	bits := 0
+	for value&0x80000000 != 0 {
+		bits++
+		value <<= 1
+	}
+	if value != 0 {
+		return -1
+	}
+	return bits
+}
+
+// IP returns the IP interfaces with their addresses
+func (m *Manager) IP(ctx context.Context) (*device.IPDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, err := store.Values()
+	if err != nil {
+		return nil, err
+	}
+	return m.ip(ctx, stored)
+}
+
+func (m *Manager) ip(ctx context.Context, stored map[string]string) (*device.IPDevice, error) {
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	devices := make(map[string]string)
+	for name, value := range stored {
+		if match := lowerLayers.FindStringSubmatch(name); match != nil && value != "" {
+			devices[value] = match[1]
+		}
+	}
+	now := time.Now()
+	ip := &device.IPDevice{}
+	for _, i := range cfg.interfaces {
+		ip.Interfaces = append(ip.Interfaces, cfg.ipInterface(i, devices, now))
+	}
+	ip.InterfaceNumberOfEntries = len(ip.Interfaces)
+	return ip, nil
+}
+
+// Collect stores the IP interfaces in the tr069 store
+func (m *Manager) Collect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.collect(ctx)
+}
+
+func (m *Manager) collect(ctx context.Context) error {
+	stored, err := store.Values()
+	if err != nil {
+		return err
+	}
+	ip, err := m.ip(ctx, stored)
+	if err != nil {
+		return err
+	}
+	return store.Replace([]string{interfacePrefix}, Values(ip))
+}
+
+// Values flattens the IP interfaces into parameters keyed by full name
+func Values(ip *device.IPDevice) map[string]string {
+	values := map[string]string{
+		Prefix + "InterfaceNumberOfEntries": strconv.Itoa(ip.InterfaceNumberOfEntries),
+	}
+	for _, i := range ip.Interfaces {
+		name := fmt.Sprintf("%s%d.", interfacePrefix, i.Index)
+		values[name+"Enable"] = strconv.FormatBool(i.Enable)
+		values[name+"Status"] = i.Status
+		values[name+"Name"] = i.Name
+		values[name+"LowerLayers"] = i.LowerLayers
+		values[name+"Type"] = i.Type
+		values[name+"X_ISPAPP_Device"] = i.X_ISPAPP_Device
+		values[name+"IPv4AddressNumberOfEntries"] = strconv.Itoa(i.IPv4AddressNumberOfEntries)
+		values[name+"IPv6AddressNumberOfEntries"] = strconv.Itoa(i.IPv6AddressNumberOfEntries)
+		for _, a := range i.IPv4Addresses {
+			address := fmt.Sprintf("%sIPv4Address.%d.", name, a.Index)
+			values[address+"Enable"] = strconv.FormatBool(a.Enable)
+			values[address+"Status"] = a.Status
+			values[address+"IPAddress"] = a.IPAddress
+			values[address+"SubnetMask"] = a.SubnetMask
+			values[address+"AddressingType"] = a.AddressingType
+		}
+		for _, a := range i.IPv6Addresses {
+			address := fmt.Sprintf("%sIPv6Address.%d.", name, a.Index)
+			values[address+"Enable"] = strconv.FormatBool(a.Enable)
+			values[address+"Status"] = a.Status
+			values[address+"IPAddressStatus"] = a.IPAddressStatus
+			values[address+"IPAddress"] = a.IPAddress
+			values[address+"Origin"] = a.Origin
+			values[address+"PreferredLifetime"] = a.PreferredLifetime
+			values[address+"ValidLifetime"] = a.ValidLifetime
+		}
+	}
+	return values
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// first returns the first item of a space separated list
+func first(value string) string {
+	item, _, _ := strings.Cut(value, " ")
+	return item
+}
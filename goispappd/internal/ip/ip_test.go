@@ -0,0 +1,162 @@
+package ip_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/ip"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+)
+
+const interfaceDump = `{"interface":[
+{"interface":"loopback","up":true,"available":true,"proto":"static","l3_device":"lo","device":"lo",
+ "ipv4-address":[{"address":"127.0.0.1","mask":8}],"ipv6-address":[],"ipv6-prefix-assignment":[]},
+{"interface":"lan","up":true,"available":true,"proto":"static","l3_device":"br-lan","device":"br-lan",
+ "ipv4-address":[{"address":"192.168.1.1","mask":24}],"ipv6-address":[],
+ "ipv6-prefix-assignment":[{"address":"2001:db8:0:10::","mask":64,"local-address":{"address":"2001:db8:0:10::1","mask":64}}]},
+{"interface":"wan","up":true,"available":true,"proto":"dhcp","l3_device":"eth1","device":"eth1",
+ "ipv4-address":[{"address":"192.0.2.20","mask":24}],"ipv6-address":[],"ipv6-prefix-assignment":[]},
+{"interface":"wan6","up":true,"available":true,"proto":"dhcpv6","l3_device":"eth1","device":"eth1",
+ "ipv4-address":[],"ipv6-address":[{"address":"2001:db8::20","mask":128,"preferred":3600,"valid":7200}],
+ "ipv6-prefix-assignment":[]},
+{"interface":"vpn","up":false,"pending":true,"available":true,"proto":"wireguard","device":"vpn",
+ "ipv4-address":[],"ipv6-address":[],"ipv6-prefix-assignment":[]}]}`
+
+// newUCI emulates the default network config with a wireguard tunnel, the
+// interfaces the shell scripts did not number yet get the next instances
+func newUCI() *ucitest.UCI {
+	return ucitest.New().
+		Section("network", "loopback", "interface", "device", "lo", "proto", "static", "ipaddr", "127.0.0.1", "netmask", "255.0.0.0", "ip_int_instance", "1").
+		Section("network", "lan", "interface", "device", "br-lan", "proto", "static", "ipaddr", "192.168.1.1", "netmask", "255.255.255.0", "ip6assign", "64", "ip_int_instance", "2").
+		Section("network", "wan", "interface", "device", "eth1", "proto", "dhcp").
+		Section("network", "wan6", "interface", "device", "eth1", "proto", "dhcpv6").
+		Section("network", "vpn", "interface", "proto", "wireguard").
+		Section("network", "office", "interface", "device", "br-lan", "proto", "static", "disabled", "1").
+		List("network", "office", "ipaddr", "10.0.0.1/8", "172.16.0.1/12").
+		List("network", "office", "ip6addr", "fd00:1::1/48").
+		On("ubus call network.interface dump", interfaceDump).
+		On("/etc/init.d/network reload", "")
+}
+
+func newRegistry(t *testing.T) (*ucitest.UCI, *params.Registry) {
+	t.Helper()
+	ucitest.UseStore(t)
+	if err := store.Set(map[string]string{"Device.Ethernet.Link.1.Name": "br-lan"}); err != nil {
+		t.Fatal(err)
+	}
+
+	uci := newUCI()
+	manager := ip.NewManager(uci)
+	if err := manager.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	registry := params.NewRegistry()
+	manager.Register(registry)
+	return uci, registry
+}
+
+func TestCollect(t *testing.T) {
+	uci, _ := newRegistry(t)
+
+	prefix := "Device.IP.Interface."
+	ucitest.ExpectStored(t, map[string]string{
+		"Device.IP.InterfaceNumberOfEntries":      "6",
+		prefix + "1.Type":                         "Loopback",
+		prefix + "1.IPv4Address.1.SubnetMask":     "255.0.0.0",
+		prefix + "2.Name":                         "lan",
+		prefix + "2.Status":                       "Up",
+		prefix + "2.Type":                         "Normal",
+		prefix + "2.LowerLayers":                  "Device.Ethernet.Link.1.",
+		prefix + "2.X_ISPAPP_Device":              "br-lan",
+		prefix + "2.IPv4AddressNumberOfEntries":   "1",
+		prefix + "2.IPv4Address.1.IPAddress":      "192.168.1.1",
+		prefix + "2.IPv4Address.1.SubnetMask":     "255.255.255.0",
+		prefix + "2.IPv4Address.1.AddressingType": "Static",
+		prefix + "2.IPv4Address.1.Status":         "Enabled",
+		prefix + "2.IPv6Address.1.IPAddress":      "2001:db8:0:10::1",
+		prefix + "2.IPv6Address.1.Origin":         "AutoConfigured",
+		prefix + "2.IPv6Address.1.ValidLifetime":  "9999-12-31T23:59:59Z",
+		// The interfaces without instance are numbered in section order
+		prefix + "3.Name":                          "wan",
+		prefix + "3.X_ISPAPP_Device":               "eth1",
+		prefix + "3.LowerLayers":                   "",
+		prefix + "3.IPv4Address.1.IPAddress":       "192.0.2.20",
+		prefix + "3.IPv4Address.1.AddressingType":  "DHCP",
+		prefix + "4.Name":                          "wan6",
+		prefix + "4.IPv4AddressNumberOfEntries":    "0",
+		prefix + "4.IPv6Address.1.IPAddress":       "2001:db8::20",
+		prefix + "4.IPv6Address.1.Origin":          "DHCPv6",
+		prefix + "4.IPv6Address.1.IPAddressStatus": "Preferred",
+		prefix + "5.Status":                        "Dormant",
+		prefix + "5.Type":                          "Tunnel",
+		prefix + "6.Enable":                        "false",
+		prefix + "6.Status":                        "Down",
+		prefix + "6.IPv4AddressNumberOfEntries":    "2",
+		prefix + "6.IPv4Address.2.IPAddress":       "172.16.0.1",
+		prefix + "6.IPv4Address.2.SubnetMask":      "255.240.0.0",
+		prefix + "6.IPv4Address.2.Status":          "Disabled",
+		prefix + "6.IPv6Address.1.IPAddress":       "fd00:1::1",
+		prefix + "6.IPv6Address.1.Origin":          "Static",
+	})
+	if got := uci.Option("network", "vpn", "ip_int_instance"); got != "5" {
+		t.Errorf("Expected the interface to be numbered, got %q", got)
+	}
+
+	preferred, _ := store.Get(prefix + "4.IPv6Address.1.PreferredLifetime")
+	if at, err := time.Parse(time.RFC3339, preferred); err != nil || time.Until(at) < 59*time.Minute || time.Until(at) > time.Hour {
+		t.Errorf("Expected the address to be preferred for an hour, got %q", preferred)
+	}
+}
+
+func TestSet(t *testing.T) {
+	uci, registry := newRegistry(t)
+	prefix := "Device.IP.Interface."
+
+	faults := registry.Set(ucitest.SetValues(
+		prefix+"2.IPv4Address.1.IPAddress", "192.168.2.1",
+		prefix+"6.IPv4Address.2.SubnetMask", "255.255.0.0",
+		prefix+"6.IPv6Address.1.IPAddress", "fd00:2::1",
+		prefix+"6.Enable", "true",
+	))
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	for _, option := range [][3]string{
+		{"lan", "ipaddr", "192.168.2.1"},
+		{"lan", "netmask", "255.255.255.0"},
+		{"office", "ipaddr", "10.0.0.1/8 172.16.0.1/16"},
+		{"office", "ip6addr", "fd00:2::1/48"},
+		{"office", "disabled", ""},
+	} {
+		if got := uci.Option("network", option[0], option[1]); got != option[2] {
+			t.Errorf("%s.%s: expected %q, got %q", option[0], option[1], option[2], got)
+		}
+	}
+	if got := uci.Count("/etc/init.d/network reload"); got != 1 {
+		t.Errorf("Expected one network reload, got %d", got)
+	}
+	ucitest.ExpectStored(t, map[string]string{prefix + "6.Enable": "true", prefix + "6.IPv4Address.2.SubnetMask": "255.255.0.0"})
+
+	t.Run("Learned", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(
+			prefix+"2.IPv4Address.1.SubnetMask", "255.255.0.0",
+			prefix+"3.IPv4Address.1.IPAddress", "192.0.2.21",
+		))
+		if len(faults) != 2 || faults[0].Code != params.FaultNotWritable {
+			t.Fatalf("Expected a learned address to be read-only, got %v", faults)
+		}
+		if got := uci.Option("network", "lan", "netmask"); got != "255.255.255.0" {
+			t.Errorf("Expected the request to be reverted, got netmask %q", got)
+		}
+	})
+
+	t.Run("UnknownInstance", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(prefix+"2.IPv4Address.3.IPAddress", "192.168.3.1"))
+		if len(faults) != 1 || faults[0].Code != params.FaultInvalidName {
+			t.Errorf("Expected an invalid name, got %v", faults)
+		}
+	})
+}
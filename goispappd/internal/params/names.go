@@ -0,0 +1,98 @@
+package params
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/internal/commands"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// Names answers GetParameterNames: the parameter named by path, or the
+// parameters and objects below the object path, only its children when
+// nextLevel is set
+func (r *Registry) Names(path string, nextLevel bool) ([]soap.ParameterInfoStruct, *Fault) {
+	values, err := store.Values()
+	if err != nil {
+		return nil, &Fault{Code: FaultInternalError, Message: err.Error()}
+	}
+	for name, value := range r.live(path) {
+		values[name] = value
+	}
+	for name := range commands.InformCommands {
+		values[name] = ""
+	}
+	for _, name := range r.names() {
+		values[name] = ""
+	}
+
+	parameters := make([]soap.ParameterInfoStruct, 0, len(values))
+	for name := range values {
+		_, param, _ := r.find(name)
+		parameters = append(parameters, soap.ParameterInfoStruct{Name: name, Writable: param.Writable})
+	}
+	return Subtree(parameters, path, nextLevel, r.writableObject)
+}
+
+// writableObject reports whether AddObject accepts the table path or
+// DeleteObject the instance path
+func (r *Registry) writableObject(path string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, object := range r.objects {
+		if object.Add != nil && object.table(path, false) || object.Delete != nil && object.table(path, true) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subtree selects the answer of GetParameterNames from the full list of
+// parameters, adding the objects they belong to. writable tells whether an
+// object is writable, a nil one makes them all read-only
+func Subtree(parameters []soap.ParameterInfoStruct, path string, nextLevel bool, writable func(object string) bool) ([]soap.ParameterInfoStruct, *Fault) {
+	if path != "" && !strings.HasSuffix(path, ".") {
+		if nextLevel {
+			return nil, &Fault{Name: path, Code: FaultInvalidArguments, Message: "NextLevel must be false for a parameter"}
+		}
+		for _, parameter := range parameters {
+			if parameter.Name == path {
+				return []soap.ParameterInfoStruct{parameter}, nil
+			}
+		}
+		return nil, &Fault{Name: path, Code: FaultInvalidName, Message: "Invalid parameter name"}
+	}
+
+	found := make(map[string]soap.ParameterInfoStruct)
+	for _, parameter := range parameters {
+		if !strings.HasPrefix(parameter.Name, path) {
+			continue
+		}
+		found[parameter.Name] = parameter
+		// The objects between path and the parameter, path included
+		for end := strings.LastIndex(parameter.Name, "."); end >= len(path)-1 && end > 0; end = strings.LastIndex(parameter.Name[:end], ".") {
+			object := parameter.Name[:end+1]
+			if _, ok := found[object]; ok {
+				break
+			}
+			found[object] = soap.ParameterInfoStruct{Name: object, Writable: writable != nil && writable(object)}
+		}
+	}
+	if len(found) == 0 {
+		return nil, &Fault{Name: path, Code: FaultInvalidName, Message: "Invalid parameter name"}
+	}
+
+	result := make([]soap.ParameterInfoStruct, 0, len(found))
+	for name, info := range found {
+		if nextLevel {
+			rest := strings.TrimSuffix(strings.TrimPrefix(name, path), ".")
+			if rest == "" || strings.Contains(rest, ".") {
+				continue
+			}
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
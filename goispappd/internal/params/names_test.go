@@ -0,0 +1,83 @@
+package params_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+func TestNames(t *testing.T) {
+	store.Path = filepath.Join(t.TempDir(), "tr069")
+	t.Cleanup(func() { store.Path = "/etc/config/tr069" })
+	if err := store.Set(map[string]string{"Device.DHCPv4.Server.Pool.1.MinAddress": "192.168.1.100"}); err != nil {
+		t.Fatalf("store.Set failed: %v", err)
+	}
+	registry := params.NewRegistry()
+	registry.Register(&params.Object{
+		Prefix: "Device.DHCPv4.Server.",
+		Params: map[string]params.Param{
+			"PoolNumberOfEntries":   {Type: soap.TR069TypeUnsignedInt, Default: "1"},
+			"Pool.{i}.MinAddress":   {Type: soap.TR069TypeString, Writable: true},
+			"Pool.{i}.ClientNumber": {Type: soap.TR069TypeUnsignedInt},
+		},
+		Apply:  func(map[string]string) error { return nil },
+		Values: func() map[string]string { return map[string]string{"Device.DHCPv4.Server.Pool.1.ClientNumber": "2"} },
+		Add:    func(string) (int, error) { return 2, nil },
+		Delete: func(string) error { return nil },
+	})
+
+	t.Run("Subtree", func(t *testing.T) {
+		infos, fault := registry.Names("Device.DHCPv4.Server.", false)
+		if fault != nil {
+			t.Fatalf("Names failed: %v", fault)
+		}
+		expected := []soap.ParameterInfoStruct{
+			{Name: "Device.DHCPv4.Server."},
+			{Name: "Device.DHCPv4.Server.Pool.", Writable: true},
+			{Name: "Device.DHCPv4.Server.Pool.1.", Writable: true},
+			{Name: "Device.DHCPv4.Server.Pool.1.ClientNumber"},
+			{Name: "Device.DHCPv4.Server.Pool.1.MinAddress", Writable: true},
+			{Name: "Device.DHCPv4.Server.PoolNumberOfEntries"},
+		}
+		if !reflect.DeepEqual(infos, expected) {
+			t.Errorf("Expected %v, got %v", expected, infos)
+		}
+	})
+
+	t.Run("NextLevel", func(t *testing.T) {
+		infos, fault := registry.Names("", true)
+		if fault != nil {
+			t.Fatalf("Names failed: %v", fault)
+		}
+		if expected := []soap.ParameterInfoStruct{{Name: "Device."}}; !reflect.DeepEqual(infos, expected) {
+			t.Errorf("Expected %v, got %v", expected, infos)
+		}
+		infos, fault = registry.Names("Device.DHCPv4.Server.Pool.", true)
+		if fault != nil {
+			t.Fatalf("Names failed: %v", fault)
+		}
+		if expected := []soap.ParameterInfoStruct{{Name: "Device.DHCPv4.Server.Pool.1.", Writable: true}}; !reflect.DeepEqual(infos, expected) {
+			t.Errorf("Expected %v, got %v", expected, infos)
+		}
+	})
+
+	t.Run("Parameter", func(t *testing.T) {
+		infos, fault := registry.Names("Device.DHCPv4.Server.Pool.1.MinAddress", false)
+		if fault != nil {
+			t.Fatalf("Names failed: %v", fault)
+		}
+		if expected := []soap.ParameterInfoStruct{{Name: "Device.DHCPv4.Server.Pool.1.MinAddress", Writable: true}}; !reflect.DeepEqual(infos, expected) {
+			t.Errorf("Expected %v, got %v", expected, infos)
+		}
+		if _, fault := registry.Names("Device.DHCPv4.Server.Pool.1.MinAddress", true); fault == nil || fault.Code != params.FaultInvalidArguments {
+			t.Errorf("Expected fault 9003 for NextLevel on a parameter, got %v", fault)
+		}
+		if _, fault := registry.Names("Device.DHCPv4.Server.Pool.7.", false); fault == nil || fault.Code != params.FaultInvalidName {
+			t.Errorf("Expected fault 9005 for a missing instance, got %v", fault)
+		}
+	})
+}
@@ -0,0 +1,465 @@
+// Package params answers GetParameterValues and SetParameterValues from the
+// DeviceInfo getters, the tr069 store and the objects registered by the
+// subsystems owning writable parameters.
+package params
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/commands"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// CWMP fault codes of the parameter RPCs
+const (
+	FaultInternalError    = 9002
+	FaultInvalidArguments = 9003
+	FaultInvalidName      = 9005
+	FaultInvalidType      = 9006
+	FaultInvalidValue     = 9007
+	FaultNotWritable      = 9008
+)
+
+// Fault is the error returned for a single parameter
+type Fault struct {
+	Name    string
+	Code    int
+	Message string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("%s: %s (%d)", f.Name, f.Message, f.Code)
+}
+
+// Param describes a parameter of an Object
+type Param struct {
+	Type     string   // xsd type, values are checked against it before Apply
+	Writable bool     // false for results such as SuccessCount
+	Enum     []string // Allowed values, empty for any
+	Default  string   // Value returned while nothing is stored
+	// Check rejects values outside the allowed range with FaultInvalidValue
+	Check func(value string) error
+}
+
+// Range returns a Check accepting unsigned integers between min and max
+func Range(min, max uint64) func(value string) error {
+	return func(value string) error {
+		number, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if number < min || number > max {
+			return fmt.Errorf("%d is out of range [%d, %d]", number, min, max)
+		}
+		return nil
+	}
+}
+
+// Object owns the parameters below Prefix
+type Object struct {
+	Prefix string           // e.g. Device.IP.Diagnostics.IPPing.
+	Params map[string]Param // Names relative to Prefix, {i} matches an instance number
+	// Apply receives the validated values of one request keyed by full name.
+	// An object with Commit only stages them
+	Apply func(values map[string]string) error
+	// Commit optionally makes the values staged by Apply effective, it is
+	// called once every object of the request staged its values
+	Commit func() error
+	// Revert optionally discards the values staged by Apply, it is called
+	// when an object of the request fails, the failing one included
+	Revert func()
+	// Values optionally returns live values keyed by full name, e.g. counters,
+	// they take precedence over the store
+	Values func() map[string]string
+	// Add optionally creates an instance of the table named by path, e.g.
+	// Device.DHCPv4.Server.Pool., and returns its instance number
+	Add func(path string) (int, error)
+	// Delete optionally removes the instance named by path, e.g.
+	// Device.DHCPv4.Server.Pool.2.
+	Delete func(path string) error
+}
+
+// ErrInvalidName is wrapped by Apply, Add and Delete errors about instances
+// that do not exist, they are reported with FaultInvalidName
+var ErrInvalidName = errors.New("no such instance")
+
+// ErrNotWritable is wrapped by Apply errors about instances whose parameters
+// are read-only, e.g. learned routes, they are reported with FaultNotWritable
+var ErrNotWritable = errors.New("read-only instance")
+
+// ErrInvalidValue is wrapped by Apply errors about values the parameter type
+// allows but the instance does not, e.g. a channel outside the band of the
+// radio, they are reported with FaultInvalidValue
+var ErrInvalidValue = errors.New("invalid value for the instance")
+
+// lookup returns the definition of a full parameter name
+func (o *Object) lookup(name string) (Param, bool) {
+	rest, ok := strings.CutPrefix(name, o.Prefix)
+	if !ok {
+		return Param{}, false
+	}
+	if param, ok := o.Params[rest]; ok {
+		return param, true
+	}
+	for pattern, param := range o.Params {
+		if match(pattern, rest) {
+			return param, true
+		}
+	}
+	return Param{}, false
+}
+
+// table reports whether path names one of the tables of the object, or one of
+// their instances when instance is set
+func (o *Object) table(path string, instance bool) bool {
+	rest, ok := strings.CutPrefix(path, o.Prefix)
+	if !ok || !strings.HasSuffix(rest, ".") {
+		return false
+	}
+	for pattern := range o.Params {
+		// Every {i} of a parameter ends a table path
+		for i := 0; i < len(pattern); {
+			k := strings.Index(pattern[i:], "{i}.")
+			if k < 0 {
+				break
+			}
+			end := i + k
+			if instance {
+				end += len("{i}.")
+			}
+			if match(strings.TrimSuffix(pattern[:end], "."), strings.TrimSuffix(rest, ".")) {
+				return true
+			}
+			i += k + len("{i}.")
+		}
+	}
+	return false
+}
+
+// match compares a relative name with a pattern, {i} matches an instance number
+func match(pattern, name string) bool {
+	patternParts := strings.Split(pattern, ".")
+	parts := strings.Split(name, ".")
+	if len(patternParts) != len(parts) {
+		return false
+	}
+	for i, part := range patternParts {
+		if part == "{i}" {
+			if _, err := strconv.ParseUint(parts[i], 10, 32); err != nil {
+				return false
+			}
+		} else if part != parts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Registry holds the registered objects
+type Registry struct {
+	mu      sync.RWMutex
+	objects []*Object
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds an object, a later object with the same prefix replaces the earlier one
+func (r *Registry) Register(object *Object) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, existing := range r.objects {
+		if existing.Prefix == object.Prefix {
+			r.objects[i] = object
+			return
+		}
+	}
+	r.objects = append(r.objects, object)
+}
+
+// names returns the full names of the registered parameters without instance numbers
+func (r *Registry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var names []string
+	for _, object := range r.objects {
+		for name := range object.Params {
+			if !strings.Contains(name, "{i}") {
+				names = append(names, object.Prefix+name)
+			}
+		}
+	}
+	return names
+}
+
+// live collects the values of the objects reporting their own, only of the
+// objects within or above one of names
+func (r *Registry) live(names ...string) map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	values := make(map[string]string)
+	for _, object := range r.objects {
+		if object.Values == nil || !overlaps(object.Prefix, names) {
+			continue
+		}
+		for name, value := range object.Values() {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// overlaps reports whether one of names is in the object at prefix or a
+// partial path above it
+func overlaps(prefix string, names []string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) || strings.HasPrefix(prefix, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// find returns the object and definition of a full parameter name
+func (r *Registry) find(name string) (*Object, Param, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, object := range r.objects {
+		if param, ok := object.lookup(name); ok {
+			return object, param, true
+		}
+	}
+	return nil, Param{}, false
+}
+
+// Set validates every value first and applies them only when all are valid.
+// The objects with Commit stage their values first and the others apply them,
+// a failure reverts the staged values so the request has no effect. Once all
+// succeeded the staged values are committed, an object failing its commit
+// leaves the objects committed before it in effect
+func (r *Registry) Set(values []soap.SetParameterValueStruct) []*Fault {
+	var faults []*Fault
+	grouped := make(map[*Object]map[string]string)
+	var order []*Object
+	for _, value := range values {
+		object, param, ok := r.find(value.Name)
+		if !ok {
+			faults = append(faults, &Fault{Name: value.Name, Code: FaultInvalidName, Message: "Invalid parameter name"})
+			continue
+		}
+		if !param.Writable {
+			faults = append(faults, &Fault{Name: value.Name, Code: FaultNotWritable, Message: "Attempt to set a non-writable parameter"})
+			continue
+		}
+		if fault := validate(value.Name, value.Value, param); fault != nil {
+			faults = append(faults, fault)
+			continue
+		}
+		if grouped[object] == nil {
+			grouped[object] = make(map[string]string)
+			order = append(order, object)
+		}
+		grouped[object][value.Name] = value.Value
+	}
+	if len(faults) > 0 {
+		return faults
+	}
+
+	// The objects that cannot take their values back go last
+	sort.SliceStable(order, func(i, j int) bool { return order[i].Commit != nil && order[j].Commit == nil })
+	var staged []*Object
+	for _, object := range order {
+		if object.Commit != nil {
+			staged = append(staged, object)
+		}
+		if err := object.Apply(grouped[object]); err != nil {
+			for _, object := range staged {
+				if object.Revert != nil {
+					object.Revert()
+				}
+			}
+			return parameterFaults(grouped[object], err)
+		}
+	}
+	for _, object := range staged {
+		if err := object.Commit(); err != nil {
+			return parameterFaults(grouped[object], err)
+		}
+	}
+	return nil
+}
+
+// parameterFaults reports the error of an object for each of its values
+func parameterFaults(values map[string]string, err error) []*Fault {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	faults := make([]*Fault, len(names))
+	for i, name := range names {
+		faults[i] = objectFault(name, err)
+	}
+	return faults
+}
+
+// objectFault maps an error of an object to its fault
+func objectFault(name string, err error) *Fault {
+	if errors.Is(err, ErrInvalidName) {
+		return &Fault{Name: name, Code: FaultInvalidName, Message: "Invalid parameter name"}
+	}
+	if errors.Is(err, ErrNotWritable) {
+		return &Fault{Name: name, Code: FaultNotWritable, Message: "Attempt to set a non-writable parameter"}
+	}
+	if errors.Is(err, ErrInvalidValue) {
+		return &Fault{Name: name, Code: FaultInvalidValue, Message: "Invalid parameter value"}
+	}
+	return &Fault{Name: name, Code: FaultInternalError, Message: err.Error()}
+}
+
+// AddObject creates an instance of the table named by path and returns its number
+func (r *Registry) AddObject(path string) (int, *Fault) {
+	r.mu.RLock()
+	var owner *Object
+	for _, object := range r.objects {
+		if object.Add != nil && object.table(path, false) {
+			owner = object
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if owner == nil {
+		return 0, &Fault{Name: path, Code: FaultInvalidName, Message: "Invalid parameter name"}
+	}
+	instance, err := owner.Add(path)
+	if err != nil {
+		return 0, objectFault(path, err)
+	}
+	return instance, nil
+}
+
+// DeleteObject removes the table instance named by path
+func (r *Registry) DeleteObject(path string) *Fault {
+	r.mu.RLock()
+	var owner *Object
+	for _, object := range r.objects {
+		if object.Delete != nil && object.table(path, true) {
+			owner = object
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if owner == nil {
+		return &Fault{Name: path, Code: FaultInvalidName, Message: "Invalid parameter name"}
+	}
+	if err := owner.Delete(path); err != nil {
+		return objectFault(path, err)
+	}
+	return nil
+}
+
+// validate checks a value against the xsd type and allowed values of param
+func validate(name, value string, param Param) *Fault {
+	var err error
+	switch param.Type {
+	case soap.TR069TypeUnsignedInt:
+		_, err = strconv.ParseUint(value, 10, 32)
+	case soap.TR069TypeInt:
+		_, err = strconv.ParseInt(value, 10, 32)
+	case soap.TR069TypeBoolean:
+		if _, ok := soap.BooleanValues[strings.ToLower(value)]; !ok {
+			err = fmt.Errorf("invalid boolean")
+		}
+	case soap.TR069TypeDateTime:
+		_, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return &Fault{Name: name, Code: FaultInvalidType, Message: "Invalid parameter type"}
+	}
+	if param.Check != nil && param.Check(value) != nil {
+		return &Fault{Name: name, Code: FaultInvalidValue, Message: "Invalid parameter value"}
+	}
+	if len(param.Enum) > 0 {
+		for _, allowed := range param.Enum {
+			if value == allowed {
+				return nil
+			}
+		}
+		return &Fault{Name: name, Code: FaultInvalidValue, Message: "Invalid parameter value"}
+	}
+	return nil
+}
+
+// Get resolves the requested names, a name ending with a dot returns the whole subtree
+func (r *Registry) Get(runner exec.Runner, names []string) ([]soap.ParameterValueStruct, *Fault) {
+	values, err := store.Values()
+	if err != nil {
+		return nil, &Fault{Code: FaultInternalError, Message: err.Error()}
+	}
+	for name, value := range r.live(names...) {
+		values[name] = value
+	}
+
+	var result []soap.ParameterValueStruct
+	for _, name := range names {
+		var matched []string
+		if strings.HasSuffix(name, ".") {
+			seen := make(map[string]bool)
+			candidates := r.names()
+			for key := range values {
+				candidates = append(candidates, key)
+			}
+			for key := range commands.InformCommands {
+				candidates = append(candidates, key)
+			}
+			for _, key := range candidates {
+				if strings.HasPrefix(key, name) && !seen[key] {
+					seen[key] = true
+					matched = append(matched, key)
+				}
+			}
+			sort.Strings(matched)
+		} else {
+			matched = []string{name}
+		}
+		if len(matched) == 0 {
+			return nil, &Fault{Name: name, Code: FaultInvalidName, Message: "Invalid parameter name"}
+		}
+
+		for _, key := range matched {
+			value, ok := values[key]
+			if !ok {
+				getter := commands.InformCommands[key]
+				if getter == nil {
+					_, param, known := r.find(key)
+					if !known {
+						return nil, &Fault{Name: key, Code: FaultInvalidName, Message: "Invalid parameter name"}
+					}
+					value = param.Default
+				} else if output, err := getter(runner); err == nil && output.Success {
+					value = string(output.Raw)
+				}
+			}
+			result = append(result, soap.ParameterValueStruct{Name: key, Value: r.typed(key, value)})
+		}
+	}
+	return result, nil
+}
+
+// typed returns the value with the registered type, or the type detected from the content
+func (r *Registry) typed(name, value string) soap.Value {
+	if _, param, ok := r.find(name); ok && param.Type != "" {
+		return soap.Value{Type: param.Type, Content: value}
+	}
+	return soap.ValueToTR069Standers(soap.Value{Content: value})
+}
@@ -0,0 +1,134 @@
+package params_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+func TestSet(t *testing.T) {
+	var applied, committed, reverted []string
+	object := func(prefix string, err error, staging bool) *params.Object {
+		o := &params.Object{
+			Prefix: prefix,
+			Params: map[string]params.Param{
+				"Enable": {Type: soap.TR069TypeBoolean, Writable: true},
+				"Name":   {Type: soap.TR069TypeString, Writable: true},
+			},
+			Apply: func(map[string]string) error {
+				applied = append(applied, prefix)
+				return err
+			},
+		}
+		if staging {
+			o.Commit = func() error {
+				committed = append(committed, prefix)
+				return nil
+			}
+			o.Revert = func() { reverted = append(reverted, prefix) }
+		}
+		return o
+	}
+	registry := params.NewRegistry()
+	registry.Register(object("Device.A.", nil, true))
+	registry.Register(object("Device.B.", errors.New("reload failed"), true))
+	registry.Register(object("Device.C.", nil, false))
+	reset := func() { applied, committed, reverted = nil, nil, nil }
+
+	t.Run("InvalidValue", func(t *testing.T) {
+		reset()
+		faults := registry.Set([]soap.SetParameterValueStruct{
+			{Name: "Device.A.Enable", Value: "true"},
+			{Name: "Device.B.Enable", Value: "maybe"},
+		})
+		if len(faults) != 1 || faults[0].Code != params.FaultInvalidType {
+			t.Fatalf("Expected an invalid type, got %v", faults)
+		}
+		if len(applied) != 0 {
+			t.Errorf("Expected nothing to be applied, got %v", applied)
+		}
+	})
+
+	t.Run("ApplyFailure", func(t *testing.T) {
+		reset()
+		faults := registry.Set([]soap.SetParameterValueStruct{
+			{Name: "Device.A.Enable", Value: "true"},
+			{Name: "Device.B.Name", Value: "wan"},
+			{Name: "Device.B.Enable", Value: "false"},
+		})
+		if len(faults) != 2 {
+			t.Fatalf("Expected a fault for each value of Device.B., got %v", faults)
+		}
+		for i, name := range []string{"Device.B.Enable", "Device.B.Name"} {
+			if faults[i].Name != name || faults[i].Code != params.FaultInternalError {
+				t.Errorf("Expected an internal error for %s, got %v", name, faults[i])
+			}
+		}
+		if expected := []string{"Device.A.", "Device.B."}; !reflect.DeepEqual(reverted, expected) {
+			t.Errorf("Expected %v reverted, got %v", expected, reverted)
+		}
+		if len(committed) != 0 {
+			t.Errorf("Expected nothing to be committed, got %v", committed)
+		}
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		reset()
+		faults := registry.Set([]soap.SetParameterValueStruct{
+			{Name: "Device.C.Enable", Value: "true"},
+			{Name: "Device.A.Enable", Value: "true"},
+		})
+		if len(faults) != 0 {
+			t.Fatalf("Set failed: %v", faults)
+		}
+		// Device.C. cannot revert, it applies once Device.A. staged its values
+		if expected := []string{"Device.A.", "Device.C."}; !reflect.DeepEqual(applied, expected) {
+			t.Errorf("Expected %v applied, got %v", expected, applied)
+		}
+		if expected := []string{"Device.A."}; !reflect.DeepEqual(committed, expected) || len(reverted) != 0 {
+			t.Errorf("Expected %v committed and nothing reverted, got %v and %v", expected, committed, reverted)
+		}
+	})
+}
+
+func TestGetLive(t *testing.T) {
+	ucitest.UseStore(t)
+	var read []string
+	object := func(prefix string) *params.Object {
+		return &params.Object{
+			Prefix: prefix,
+			Params: map[string]params.Param{"Status": {Type: soap.TR069TypeString}},
+			Values: func() map[string]string {
+				read = append(read, prefix)
+				return map[string]string{prefix + "Status": "Up"}
+			},
+		}
+	}
+	registry := params.NewRegistry()
+	registry.Register(object("Device.Test.A."))
+	registry.Register(object("Device.Test.B."))
+
+	values, fault := registry.Get(nil, []string{"Device.Test.A.Status"})
+	if fault != nil {
+		t.Fatalf("Get failed: %v", fault)
+	}
+	if len(values) != 1 || values[0].Value.Content != "Up" {
+		t.Errorf("Expected Device.Test.A.Status Up, got %+v", values)
+	}
+	// Only the object holding the name is read
+	if expected := []string{"Device.Test.A."}; !reflect.DeepEqual(read, expected) {
+		t.Errorf("Expected %v read, got %v", expected, read)
+	}
+
+	read = nil
+	if _, fault := registry.Get(nil, []string{"Device.Test."}); fault != nil {
+		t.Fatalf("Get failed: %v", fault)
+	}
+	if len(read) != 2 {
+		t.Errorf("Expected both objects read for a partial path, got %v", read)
+	}
+}
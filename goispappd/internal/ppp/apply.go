@@ -0,0 +1,238 @@
+package ppp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// applyTimeout bounds the uci calls and the network reload of one request
+const applyTimeout = 30 * time.Second
+
+// demandIdle is the idle timeout of an interface switched to OnDemand
+// without IdleDisconnectTime, netifd needs one to dial on demand
+const demandIdle = 300
+
+// interfaceParams are the parameters of Device.PPP.
+var interfaceParams = map[string]params.Param{
+	"InterfaceNumberOfEntries":           {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"Interface.{i}.Enable":               {Type: soap.TR069TypeBoolean, Writable: true},
+	"Interface.{i}.Status":               {Type: soap.TR069TypeString},
+	"Interface.{i}.Name":                 {Type: soap.TR069TypeString},
+	"Interface.{i}.LowerLayers":          {Type: soap.TR069TypeString},
+	"Interface.{i}.ConnectionStatus":     {Type: soap.TR069TypeString},
+	"Interface.{i}.AutoDisconnectTime":   {Type: soap.TR069TypeUnsignedInt, Writable: true},
+	"Interface.{i}.IdleDisconnectTime":   {Type: soap.TR069TypeUnsignedInt, Writable: true},
+	"Interface.{i}.LCPEcho":              {Type: soap.TR069TypeUnsignedInt},
+	"Interface.{i}.LCPEchoRetry":         {Type: soap.TR069TypeUnsignedInt},
+	"Interface.{i}.Username":             {Type: soap.TR069TypeString, Writable: true, Check: checkLength(64)},
+	"Interface.{i}.Password":             {Type: soap.TR069TypeString, Writable: true, Check: checkLength(64)},
+	"Interface.{i}.EncryptionProtocol":   {Type: soap.TR069TypeString},
+	"Interface.{i}.ConnectionTrigger":    {Type: soap.TR069TypeString, Writable: true, Enum: []string{"OnDemand", "AlwaysOn"}},
+	"Interface.{i}.X_ISPAPP_Type":        {Type: soap.TR069TypeString},
+	"Interface.{i}.PPPoE.ACName":         {Type: soap.TR069TypeString, Writable: true, Check: checkLength(256)},
+	"Interface.{i}.PPPoE.ServiceName":    {Type: soap.TR069TypeString, Writable: true, Check: checkLength(256)},
+	"Interface.{i}.IPCP.LocalIPAddress":  {Type: soap.TR069TypeString},
+	"Interface.{i}.IPCP.RemoteIPAddress": {Type: soap.TR069TypeString},
+}
+
+// options are the uci options of the writable string parameters
+var options = map[string]string{
+	"Username":          "username",
+	"Password":          "password",
+	"PPPoE.ACName":      "ac",
+	"PPPoE.ServiceName": "service",
+}
+
+func checkLength(limit int) func(string) error {
+	return func(value string) error {
+		if len(value) > limit {
+			return fmt.Errorf("value is longer than %d characters", limit)
+		}
+		return nil
+	}
+}
+
+// Register adds Device.PPP. to registry
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{
+		Prefix: Prefix,
+		Params: interfaceParams,
+		Apply:  m.apply,
+		Commit: m.save,
+		Revert: m.revert,
+	})
+}
+
+// commit saves the network config, reloads netifd so the changed interfaces
+// redial and refreshes the store
+func (m *Manager) commit(ctx context.Context) error {
+	if err := m.uci.Commit(ctx); err != nil {
+		return err
+	}
+	if _, err := ucicfg.Command(ctx, m.runner, "/etc/init.d/network", "reload"); err != nil {
+		return err
+	}
+	return m.collect(ctx)
+}
+
+// path splits a name below Device.PPP.Interface. into the instance and the
+// parameter
+func path(name string) (int, string, error) {
+	instance, param, ok := strings.Cut(strings.TrimPrefix(name, interfacePrefix), ".")
+	index, err := strconv.Atoi(instance)
+	if !strings.HasPrefix(name, interfacePrefix) || !ok || err != nil {
+		return 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	return index, param, nil
+}
+
+// save commits the values staged by apply
+func (m *Manager) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	return m.commit(ctx)
+}
+
+// revert discards the values staged by apply
+func (m *Manager) revert() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	m.uci.Restore(ctx)
+}
+
+// apply stages the values of one SetParameterValues request, the registry
+// commits or reverts them with the other objects of the request
+func (m *Manager) apply(values map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	changes := make(map[int]map[string]string)
+	for name, value := range values {
+		index, param, err := path(name)
+		if err != nil {
+			return err
+		}
+		if changes[index] == nil {
+			changes[index] = make(map[string]string)
+		}
+		changes[index][param] = value
+	}
+
+	indices := make([]int, 0, len(changes))
+	for index := range changes {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	for _, index := range indices {
+		i := cfg.find(index)
+		if i == nil {
+			err = fmt.Errorf("%w: %s%d.", params.ErrInvalidName, interfacePrefix, index)
+		} else {
+			err = m.applyInterface(ctx, i, changes[index])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyInterface writes the changed parameters of one interface
+func (m *Manager) applyInterface(ctx context.Context, i *iface, changes map[string]string) error {
+	name := fmt.Sprintf("%s%d.", interfacePrefix, i.index)
+	for param, value := range changes {
+		option, ok := options[param]
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(param, "PPPoE.") && i.sec.Options["proto"] != "pppoe" {
+			return fmt.Errorf("%w: %s%s of a %s interface", params.ErrNotWritable, name, param, i.sec.Options["proto"])
+		}
+		if err := m.uci.Set(ctx, i.sec.Name, option, value); err != nil {
+			return err
+		}
+	}
+
+	if value, ok := changes["Enable"]; ok {
+		disabled := ""
+		if !soap.BooleanValues[strings.ToLower(value)] {
+			disabled = "1"
+		}
+		if err := m.uci.Set(ctx, i.sec.Name, "disabled", disabled); err != nil {
+			return err
+		}
+	}
+
+	if value, ok := changes["AutoDisconnectTime"]; ok {
+		seconds, _ := strconv.Atoi(value)
+		if err := m.uci.Set(ctx, i.sec.Name, "pppd_options", maxConnect(i.pppdOptions(), seconds)); err != nil {
+			return err
+		}
+	}
+
+	_, idleChanged := changes["IdleDisconnectTime"]
+	_, triggerChanged := changes["ConnectionTrigger"]
+	if idleChanged || triggerChanged {
+		current := i.sec.Options["demand"]
+		idle, _ := strconv.Atoi(current)
+		trigger := "AlwaysOn"
+		if idle > 0 {
+			trigger = "OnDemand"
+		}
+		if idleChanged {
+			idle, _ = strconv.Atoi(changes["IdleDisconnectTime"])
+		}
+		if triggerChanged {
+			trigger = changes["ConnectionTrigger"]
+		}
+		// The idle timeout is the demand option, an AlwaysOn interface has none
+		demand := ""
+		if trigger == "OnDemand" {
+			if idle <= 0 {
+				idle = demandIdle
+			}
+			demand = strconv.Itoa(idle)
+		}
+		if demand != current {
+			if err := m.uci.Set(ctx, i.sec.Name, "demand", demand); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// maxConnect returns the pppd options with the maxconnect option replaced,
+// removed when seconds is 0
+func maxConnect(words []string, seconds int) string {
+	var kept []string
+	for k := 0; k < len(words); k++ {
+		if words[k] == "maxconnect" {
+			k++
+			continue
+		}
+		kept = append(kept, words[k])
+	}
+	if seconds > 0 {
+		kept = append(kept, "maxconnect", strconv.Itoa(seconds))
+	}
+	return strings.Join(kept, " ")
+}
@@ -0,0 +1,359 @@
+// Package ppp maps TR-181 Device.PPP.Interface to the interface sections of
+// /etc/config/network running pppd, PPPoE above all. The credentials and
+// timers are uci options, the connection state and the IPCP addresses are
+// read from netifd.
+package ppp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// Prefix is the object mapped by the package
+const Prefix = "Device.PPP."
+
+// interfacePrefix is the Interface table
+const interfacePrefix = Prefix + "Interface."
+
+// interfaceInstance is the UCI option numbering the PPP interfaces
+const interfaceInstance = "ppp_int_instance"
+
+// lcpEchoInterval is the seconds between LCP echo requests of a keepalive
+// option without interval, as in the netifd ppp protocol handler
+const lcpEchoInterval = 5
+
+// types are the netifd protocols running pppd with their X_ISPAPP_Type
+var types = map[string]string{
+	"pppoe": "PPPoE",
+	"pppoa": "PPPoA",
+	"ppp":   "PPP",
+}
+
+// lowerLayers are the stored Ethernet links, a PPPoE session runs on the
+// link whose Name is its device
+var lowerLayers = regexp.MustCompile(`^(Device\.Ethernet\.Link\.\d+\.)Name$`)
+
+// Manager reads the PPP interfaces from netifd and writes them with uci
+type Manager struct {
+	runner  exec.Runner
+	uci     *ucicfg.Config
+	numbers *ucicfg.Config // Instance numbers, committed apart from the requests
+	mu      sync.Mutex
+}
+
+// NewManager creates a Manager running uci, ubus and netifd through runner
+func NewManager(runner exec.Runner) *Manager {
+	c := ucicfg.New(runner, "network", "ppp")
+	return &Manager{runner: runner, uci: c, numbers: c.Numbers()}
+}
+
+// status is an interface of ubus call network.interface dump
+type status struct {
+	Interface   string `json:"interface"`
+	Up          bool   `json:"up"`
+	Pending     bool   `json:"pending"`
+	Available   bool   `json:"available"`
+	L3Device    string `json:"l3_device"`
+	IPv4Address []struct {
+		Address    string `json:"address"`
+		PtpAddress string `json:"ptpaddress"`
+	} `json:"ipv4-address"`
+}
+
+// iface is a PPP interface section with its instance and netifd state
+type iface struct {
+	sec    *uci.Section
+	index  int
+	status *status // nil when netifd does not know the interface
+}
+
+// config is the PPP interfaces of the network config
+type config struct {
+	interfaces []*iface
+	dumped     bool // Whether netifd answered, interfaces are Unknown otherwise
+}
+
+// load reads the PPP interfaces of the network config and their netifd state,
+// numbering the sections that have no instance yet
+func (m *Manager) load(ctx context.Context) (*config, error) {
+	shown, err := m.uci.Show(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var sections []*uci.Section
+	highest := 0
+	for _, sec := range shown {
+		if sec.SectionType == "interface" && types[sec.Options["proto"]] != "" {
+			sections = append(sections, sec)
+			if index, err := strconv.Atoi(sec.Options[interfaceInstance]); err == nil {
+				highest = max(highest, index)
+			}
+		}
+	}
+
+	cfg := &config{}
+	statuses := make(map[string]*status)
+	if output, err := ucicfg.Command(ctx, m.runner, "ubus", "call", "network.interface", "dump"); err == nil {
+		var dump struct {
+			Interface []*status `json:"interface"`
+		}
+		if json.Unmarshal([]byte(output), &dump) == nil {
+			cfg.dumped = true
+			for _, s := range dump.Interface {
+				statuses[s.Interface] = s
+			}
+		}
+	}
+
+	numbered := false
+	for _, sec := range sections {
+		index, err := strconv.Atoi(sec.Options[interfaceInstance])
+		if err != nil {
+			highest++
+			index = highest
+			if err := m.numbers.Set(ctx, sec.Name, interfaceInstance, strconv.Itoa(index)); err != nil {
+				return nil, err
+			}
+			numbered = true
+		}
+		cfg.interfaces = append(cfg.interfaces, &iface{sec: sec, index: index, status: statuses[sec.Name]})
+	}
+	if numbered {
+		if err := m.numbers.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(cfg.interfaces, func(i, j int) bool { return cfg.interfaces[i].index < cfg.interfaces[j].index })
+	return cfg, nil
+}
+
+// find returns the interface numbered index
+func (cfg *config) find(index int) *iface {
+	for _, i := range cfg.interfaces {
+		if i.index == index {
+			return i
+		}
+	}
+	return nil
+}
+
+// name returns the PPP device, netifd names it after the protocol and the
+// interface
+func (i *iface) name() string {
+	if i.status != nil && i.status.L3Device != "" {
+		return i.status.L3Device
+	}
+	return i.sec.Options["proto"] + "-" + i.sec.Name
+}
+
+// pppdOptions returns the extra pppd options as words
+func (i *iface) pppdOptions() []string {
+	return strings.Fields(i.sec.Options["pppd_options"])
+}
+
+// maxConnect returns the maxconnect seconds of the extra pppd options, 0
+// when the connection time is not limited
+func (i *iface) maxConnect() int {
+	options := i.pppdOptions()
+	for k := 0; k+1 < len(options); k++ {
+		if options[k] == "maxconnect" {
+			seconds, _ := strconv.Atoi(options[k+1])
+			return seconds
+		}
+	}
+	return 0
+}
+
+// keepalive returns the LCP echo interval and failure count of the keepalive
+// option, "<failure> [<interval>]"
+func (i *iface) keepalive() (interval, retry int) {
+	values := strings.FieldsFunc(i.sec.Options["keepalive"], func(r rune) bool { return r == ' ' || r == ',' })
+	if len(values) == 0 {
+		return 0, 0
+	}
+	retry, _ = strconv.Atoi(values[0])
+	if retry <= 0 {
+		return 0, 0
+	}
+	interval = lcpEchoInterval
+	if len(values) > 1 {
+		if n, err := strconv.Atoi(values[1]); err == nil && n > 0 {
+			interval = n
+		}
+	}
+	return interval, retry
+}
+
+// interfaceStatus maps the netifd state to the TR-181 Status
+func (cfg *config) interfaceStatus(i *iface, enable bool) string {
+	switch {
+	case !cfg.dumped:
+		return "Unknown"
+	case i.status != nil && i.status.Up:
+		return "Up"
+	case !enable || i.status == nil:
+		return "Down"
+	case !i.status.Available:
+		return "LowerLayerDown"
+	default:
+		return "Down"
+	}
+}
+
+// connectionStatus maps the netifd state to the TR-181 ConnectionStatus
+func (i *iface) connectionStatus(enable bool) string {
+	switch {
+	case i.sec.Options["username"] == "" && i.sec.Options["proto"] == "pppoe":
+		return "Unconfigured"
+	case !enable || i.status == nil:
+		return "Disconnected"
+	case i.status.Up:
+		return "Connected"
+	case i.status.Pending:
+		return "Connecting"
+	default:
+		return "Disconnected"
+	}
+}
+
+// pppInterface maps an interface, links holds the Ethernet link references
+// by Linux device
+func (cfg *config) pppInterface(i *iface, links map[string]string) device.PPPInterface {
+	sec := i.sec
+	ppp := device.PPPInterface{
+		Index:              i.index,
+		Enable:             sec.Options["disabled"] != "1",
+		Name:               i.name(),
+		AutoDisconnectTime: i.maxConnect(),
+		Username:           sec.Options["username"],
+		Password:           sec.Options["password"],
+		EncryptionProtocol: "None",
+		ConnectionTrigger:  "AlwaysOn",
+		X_ISPAPP_Type:      types[sec.Options["proto"]],
+	}
+	ppp.Status = cfg.interfaceStatus(i, ppp.Enable)
+	ppp.ConnectionStatus = i.connectionStatus(ppp.Enable)
+	ppp.LCPEcho, ppp.LCPEchoRetry = i.keepalive()
+	// ifname before OpenWrt 21.02
+	lower, _, _ := strings.Cut(valueOr(sec.Options["device"], sec.Options["ifname"]), " ")
+	ppp.LowerLayers = links[lower]
+	if idle, err := strconv.Atoi(sec.Options["demand"]); err == nil && idle > 0 {
+		// netifd only knows an idle timeout for on demand connections
+		ppp.ConnectionTrigger = "OnDemand"
+		ppp.IdleDisconnectTime = idle
+	}
+	for _, option := range i.pppdOptions() {
+		if strings.HasPrefix(option, "require-mppe") {
+			ppp.EncryptionProtocol = "MPPE"
+		}
+	}
+	if sec.Options["proto"] == "pppoe" {
+		ppp.PPPoE = device.PPPoESettings{ACName: sec.Options["ac"], ServiceName: sec.Options["service"]}
+	}
+	if i.status != nil && i.status.Up && len(i.status.IPv4Address) > 0 {
+		ppp.IPCP = device.IPCPSettings{
+			LocalIPAddress:  i.status.IPv4Address[0].Address,
+			RemoteIPAddress: i.status.IPv4Address[0].PtpAddress,
+		}
+	}
+	return ppp
+}
+
+// PPP returns the PPP interfaces
+func (m *Manager) PPP(ctx context.Context) (*device.PPPDevice, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, err := store.Values()
+	if err != nil {
+		return nil, err
+	}
+	return m.ppp(ctx, stored)
+}
+
+func (m *Manager) ppp(ctx context.Context, stored map[string]string) (*device.PPPDevice, error) {
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string]string)
+	for name, value := range stored {
+		if match := lowerLayers.FindStringSubmatch(name); match != nil && value != "" {
+			links[value] = match[1]
+		}
+	}
+	ppp := &device.PPPDevice{}
+	for _, i := range cfg.interfaces {
+		ppp.Interfaces = append(ppp.Interfaces, cfg.pppInterface(i, links))
+	}
+	ppp.InterfaceNumberOfEntries = len(ppp.Interfaces)
+	return ppp, nil
+}
+
+// Collect stores the PPP interfaces in the tr069 store
+func (m *Manager) Collect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.collect(ctx)
+}
+
+func (m *Manager) collect(ctx context.Context) error {
+	stored, err := store.Values()
+	if err != nil {
+		return err
+	}
+	ppp, err := m.ppp(ctx, stored)
+	if err != nil {
+		return err
+	}
+	return store.Replace([]string{interfacePrefix}, Values(ppp))
+}
+
+// Values flattens the PPP interfaces into parameters keyed by full name. The
+// password is write-only and reads as an empty string
+func Values(ppp *device.PPPDevice) map[string]string {
+	values := map[string]string{
+		Prefix + "InterfaceNumberOfEntries": strconv.Itoa(ppp.InterfaceNumberOfEntries),
+	}
+	for _, i := range ppp.Interfaces {
+		name := fmt.Sprintf("%s%d.", interfacePrefix, i.Index)
+		values[name+"Enable"] = strconv.FormatBool(i.Enable)
+		values[name+"Status"] = i.Status
+		values[name+"Name"] = i.Name
+		values[name+"LowerLayers"] = i.LowerLayers
+		values[name+"ConnectionStatus"] = i.ConnectionStatus
+		values[name+"AutoDisconnectTime"] = strconv.Itoa(i.AutoDisconnectTime)
+		values[name+"IdleDisconnectTime"] = strconv.Itoa(i.IdleDisconnectTime)
+		values[name+"LCPEcho"] = strconv.Itoa(i.LCPEcho)
+		values[name+"LCPEchoRetry"] = strconv.Itoa(i.LCPEchoRetry)
+		values[name+"Username"] = i.Username
+		values[name+"Password"] = ""
+		values[name+"EncryptionProtocol"] = i.EncryptionProtocol
+		values[name+"ConnectionTrigger"] = i.ConnectionTrigger
+		values[name+"X_ISPAPP_Type"] = i.X_ISPAPP_Type
+		values[name+"PPPoE.ACName"] = i.PPPoE.ACName
+		values[name+"PPPoE.ServiceName"] = i.PPPoE.ServiceName
+		values[name+"IPCP.LocalIPAddress"] = i.IPCP.LocalIPAddress
+		values[name+"IPCP.RemoteIPAddress"] = i.IPCP.RemoteIPAddress
+	}
+	return values
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
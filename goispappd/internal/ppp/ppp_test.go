@@ -0,0 +1,197 @@
+package ppp_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/ip"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/ppp"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+)
+
+const interfaceDump = `{"interface":[
+{"interface":"lan","up":true,"available":true,"proto":"static","l3_device":"br-lan","device":"br-lan",
+ "ipv4-address":[{"address":"192.168.1.1","mask":24}],"ipv6-address":[],"ipv6-prefix-assignment":[]},
+{"interface":"wan","up":true,"available":true,"proto":"pppoe","l3_device":"pppoe-wan","device":"eth1",
+ "ipv4-address":[{"address":"198.51.100.7","mask":32,"ptpaddress":"198.51.100.1"}],"ipv6-address":[],
+ "ipv6-prefix-assignment":[],"dns-server":["198.51.100.53"]},
+{"interface":"backup","up":false,"pending":true,"available":true,"proto":"pppoe","device":"eth1.7",
+ "ipv4-address":[],"ipv6-address":[],"ipv6-prefix-assignment":[]},
+{"interface":"dsl","up":false,"available":false,"proto":"pppoa",
+ "ipv4-address":[],"ipv6-address":[],"ipv6-prefix-assignment":[]}]}`
+
+// newUCI emulates a PPPoE uplink with an on demand backup session and a DSL
+// modem, the interfaces the shell scripts did not number yet get the next
+// instances
+func newUCI() *ucitest.UCI {
+	return ucitest.New().
+		Section("network", "lan", "interface", "device", "br-lan", "proto", "static", "ipaddr", "192.168.1.1", "netmask", "255.255.255.0").
+		Section("network", "wan", "interface", "device", "eth1", "proto", "pppoe", "username", "subscriber@isp", "password", "secret",
+			"keepalive", "3 10", "pppd_options", "debug maxconnect 86400", "ppp_int_instance", "1").
+		Section("network", "backup", "interface", "device", "eth1.7", "proto", "pppoe", "username", "backup@isp", "ac", "BRAS-2",
+			"service", "internet", "demand", "600").
+		Section("network", "dsl", "interface", "proto", "pppoa", "vci", "35", "vpi", "8", "disabled", "1").
+		On("ubus call network.interface dump", interfaceDump).
+		On("/etc/init.d/network reload", "")
+}
+
+func newRegistry(t *testing.T) (*ucitest.UCI, *params.Registry) {
+	t.Helper()
+	ucitest.UseStore(t)
+	if err := store.Set(map[string]string{"Device.Ethernet.Link.1.Name": "eth1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	uci := newUCI()
+	manager := ppp.NewManager(uci)
+	if err := manager.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	registry := params.NewRegistry()
+	manager.Register(registry)
+	return uci, registry
+}
+
+func TestCollect(t *testing.T) {
+	uci, _ := newRegistry(t)
+
+	prefix := "Device.PPP.Interface."
+	ucitest.ExpectStored(t, map[string]string{
+		"Device.PPP.InterfaceNumberOfEntries": "3",
+		prefix + "1.Enable":                   "true",
+		prefix + "1.Status":                   "Up",
+		prefix + "1.Name":                     "pppoe-wan",
+		prefix + "1.LowerLayers":              "Device.Ethernet.Link.1.",
+		prefix + "1.ConnectionStatus":         "Connected",
+		prefix + "1.AutoDisconnectTime":       "86400",
+		prefix + "1.IdleDisconnectTime":       "0",
+		prefix + "1.ConnectionTrigger":        "AlwaysOn",
+		prefix + "1.LCPEcho":                  "10",
+		prefix + "1.LCPEchoRetry":             "3",
+		prefix + "1.Username":                 "subscriber@isp",
+		prefix + "1.Password":                 "",
+		prefix + "1.X_ISPAPP_Type":            "PPPoE",
+		prefix + "1.IPCP.LocalIPAddress":      "198.51.100.7",
+		prefix + "1.IPCP.RemoteIPAddress":     "198.51.100.1",
+		// The interfaces without instance are numbered in section order
+		prefix + "2.Name":                "pppoe-backup",
+		prefix + "2.LowerLayers":         "",
+		prefix + "2.Status":              "Down",
+		prefix + "2.ConnectionStatus":    "Connecting",
+		prefix + "2.ConnectionTrigger":   "OnDemand",
+		prefix + "2.IdleDisconnectTime":  "600",
+		prefix + "2.LCPEcho":             "0",
+		prefix + "2.PPPoE.ACName":        "BRAS-2",
+		prefix + "2.PPPoE.ServiceName":   "internet",
+		prefix + "2.IPCP.LocalIPAddress": "",
+		prefix + "3.Enable":              "false",
+		prefix + "3.Status":              "Down",
+		prefix + "3.ConnectionStatus":    "Disconnected",
+		prefix + "3.X_ISPAPP_Type":       "PPPoA",
+		prefix + "3.Name":                "pppoa-dsl",
+	})
+	if got := uci.Option("network", "dsl", "ppp_int_instance"); got != "3" {
+		t.Errorf("Expected the interface to be numbered, got %q", got)
+	}
+
+	t.Run("IPLowerLayers", func(t *testing.T) {
+		if err := ip.NewManager(uci).Collect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// The IP interfaces are numbered after the PPP ones, lan is 1
+		ucitest.ExpectStored(t, map[string]string{
+			"Device.IP.Interface.2.LowerLayers": "Device.PPP.Interface.1.",
+			"Device.IP.Interface.3.LowerLayers": "Device.PPP.Interface.2.",
+		})
+	})
+}
+
+func TestSet(t *testing.T) {
+	uci, registry := newRegistry(t)
+	prefix := "Device.PPP.Interface."
+
+	faults := registry.Set(ucitest.SetValues(
+		prefix+"1.Username", "new@isp",
+		prefix+"1.Password", "changed",
+		prefix+"1.AutoDisconnectTime", "0",
+		prefix+"1.IdleDisconnectTime", "900",
+		prefix+"2.ConnectionTrigger", "AlwaysOn",
+		prefix+"2.PPPoE.ServiceName", "",
+		prefix+"3.Enable", "true",
+		prefix+"3.ConnectionTrigger", "OnDemand",
+	))
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	for _, option := range [][3]string{
+		{"wan", "username", "new@isp"},
+		{"wan", "password", "changed"},
+		{"wan", "pppd_options", "debug"},
+		// The idle timeout of an AlwaysOn interface is not kept
+		{"wan", "demand", ""},
+		{"backup", "demand", ""},
+		{"backup", "service", ""},
+		{"dsl", "disabled", ""},
+		{"dsl", "demand", "300"},
+	} {
+		if got := uci.Option("network", option[0], option[1]); got != option[2] {
+			t.Errorf("%s.%s: expected %q, got %q", option[0], option[1], option[2], got)
+		}
+	}
+	if got := uci.Count("/etc/init.d/network reload"); got != 1 {
+		t.Errorf("Expected one network reload, got %d", got)
+	}
+	ucitest.ExpectStored(t, map[string]string{
+		prefix + "1.Username":           "new@isp",
+		prefix + "1.Password":           "",
+		prefix + "1.AutoDisconnectTime": "0",
+		prefix + "2.ConnectionTrigger":  "AlwaysOn",
+		prefix + "3.IdleDisconnectTime": "300",
+	})
+
+	t.Run("IdleDisconnectTime", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(
+			prefix+"1.ConnectionTrigger", "OnDemand",
+			prefix+"1.IdleDisconnectTime", "120",
+			prefix+"1.AutoDisconnectTime", "3600",
+		))
+		if len(faults) > 0 {
+			t.Fatalf("Set failed: %v", faults[0])
+		}
+		if got := uci.Option("network", "wan", "demand"); got != "120" {
+			t.Errorf("Expected an idle timeout of 120 seconds, got %q", got)
+		}
+		if got := uci.Option("network", "wan", "pppd_options"); got != "debug maxconnect 3600" {
+			t.Errorf("Expected maxconnect to be added, got %q", got)
+		}
+	})
+
+	t.Run("NotPPPoE", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(
+			prefix+"1.Username", "other@isp",
+			prefix+"3.PPPoE.ACName", "BRAS-1",
+		))
+		if len(faults) != 2 || faults[0].Code != params.FaultNotWritable {
+			t.Fatalf("Expected PPPoA to have no PPPoE settings, got %v", faults)
+		}
+		if got := uci.Option("network", "wan", "username"); got != "new@isp" {
+			t.Errorf("Expected the request to be reverted, got username %q", got)
+		}
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(prefix+"1.IPCP.LocalIPAddress", "198.51.100.8"))
+		if len(faults) != 1 || faults[0].Code != params.FaultNotWritable {
+			t.Errorf("Expected IPCP to be read-only, got %v", faults)
+		}
+	})
+
+	t.Run("UnknownInstance", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(prefix+"4.Username", "nobody"))
+		if len(faults) != 1 || faults[0].Code != params.FaultInvalidName {
+			t.Errorf("Expected an invalid name, got %v", faults)
+		}
+	})
+}
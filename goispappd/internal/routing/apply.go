@@ -0,0 +1,409 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// applyTimeout bounds the uci calls and the network reload of one request
+const applyTimeout = 30 * time.Second
+
+// routerParams are the parameters of Device.Routing., only static entries
+// accept the writable ones
+var routerParams = map[string]params.Param{
+	"RouterNumberOfEntries":                          {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"Router.{i}.Enable":                              {Type: soap.TR069TypeBoolean},
+	"Router.{i}.Status":                              {Type: soap.TR069TypeString},
+	"Router.{i}.IPv4ForwardingNumberOfEntries":       {Type: soap.TR069TypeUnsignedInt},
+	"Router.{i}.IPv6ForwardingNumberOfEntries":       {Type: soap.TR069TypeUnsignedInt},
+	"Router.{i}.IPv4Forwarding.{i}.Enable":           {Type: soap.TR069TypeBoolean, Writable: true},
+	"Router.{i}.IPv4Forwarding.{i}.Status":           {Type: soap.TR069TypeString},
+	"Router.{i}.IPv4Forwarding.{i}.StaticRoute":      {Type: soap.TR069TypeBoolean},
+	"Router.{i}.IPv4Forwarding.{i}.DestIPAddress":    {Type: soap.TR069TypeString, Writable: true, Check: optional(checkIPv4)},
+	"Router.{i}.IPv4Forwarding.{i}.DestSubnetMask":   {Type: soap.TR069TypeString, Writable: true, Check: optional(checkMask)},
+	"Router.{i}.IPv4Forwarding.{i}.ForwardingPolicy": {Type: soap.TR069TypeInt, Writable: true, Check: checkPolicy},
+	"Router.{i}.IPv4Forwarding.{i}.GatewayIPAddress": {Type: soap.TR069TypeString, Writable: true, Check: optional(checkIPv4)},
+	"Router.{i}.IPv4Forwarding.{i}.Interface":        {Type: soap.TR069TypeString, Writable: true, Check: checkInterface},
+	"Router.{i}.IPv4Forwarding.{i}.Origin":           {Type: soap.TR069TypeString},
+	"Router.{i}.IPv4Forwarding.{i}.ForwardingMetric": {Type: soap.TR069TypeInt, Writable: true, Check: checkMetric},
+	"Router.{i}.IPv6Forwarding.{i}.Enable":           {Type: soap.TR069TypeBoolean, Writable: true},
+	"Router.{i}.IPv6Forwarding.{i}.Status":           {Type: soap.TR069TypeString},
+	"Router.{i}.IPv6Forwarding.{i}.DestIPPrefix":     {Type: soap.TR069TypeString, Writable: true, Check: optional(checkIPv6Prefix)},
+	"Router.{i}.IPv6Forwarding.{i}.ForwardingPolicy": {Type: soap.TR069TypeInt, Writable: true, Check: checkPolicy},
+	"Router.{i}.IPv6Forwarding.{i}.NextHop":          {Type: soap.TR069TypeString, Writable: true, Check: optional(checkIPv6)},
+	"Router.{i}.IPv6Forwarding.{i}.Interface":        {Type: soap.TR069TypeString, Writable: true, Check: checkInterface},
+	"Router.{i}.IPv6Forwarding.{i}.Origin":           {Type: soap.TR069TypeString},
+	"Router.{i}.IPv6Forwarding.{i}.ForwardingMetric": {Type: soap.TR069TypeInt, Writable: true, Check: checkMetric},
+	"Router.{i}.IPv6Forwarding.{i}.ExpirationTime":   {Type: soap.TR069TypeDateTime},
+}
+
+// optional accepts an empty value or one passing check
+func optional(check func(string) error) func(string) error {
+	return func(value string) error {
+		if value == "" {
+			return nil
+		}
+		return check(value)
+	}
+}
+
+func checkIPv4(value string) error {
+	if addr, err := netip.ParseAddr(value); err != nil || !addr.Is4() {
+		return fmt.Errorf("%q is not an IPv4 address", value)
+	}
+	return nil
+}
+
+func checkIPv6(value string) error {
+	if addr, err := netip.ParseAddr(value); err != nil || !addr.Is6() {
+		return fmt.Errorf("%q is not an IPv6 address", value)
+	}
+	return nil
+}
+
+func checkIPv6Prefix(value string) error {
+	if prefix, err := netip.ParsePrefix(value); err != nil || !prefix.Addr().Is6() {
+		return fmt.Errorf("%q is not an IPv6 prefix", value)
+	}
+	return nil
+}
+
+func checkMask(value string) error {
+	if _, ok := maskBits(value); !ok {
+		return fmt.Errorf("%q is not a netmask", value)
+	}
+	return nil
+}
+
+func checkPolicy(value string) error {
+	if table, err := strconv.Atoi(value); err != nil || table < -1 || table == rtTableLocal {
+		return fmt.Errorf("%q is not a routing table", value)
+	}
+	return nil
+}
+
+func checkMetric(value string) error {
+	if metric, err := strconv.Atoi(value); err != nil || metric < -1 {
+		return fmt.Errorf("%q is not a metric", value)
+	}
+	return nil
+}
+
+func checkInterface(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := ucicfg.RefInstance(value, ipInterfaceRef); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Register adds Device.Routing. to registry
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{
+		Prefix: Prefix,
+		Params: routerParams,
+		Apply:  m.apply,
+		Commit: m.save,
+		Revert: m.revert,
+		Add:    m.add,
+		Delete: m.delete,
+	})
+}
+
+// commit saves the network config, has netifd install the routes and
+// refreshes the store
+func (m *Manager) commit(ctx context.Context) error {
+	if err := m.uci.Commit(ctx); err != nil {
+		return err
+	}
+	if _, err := ucicfg.Command(ctx, m.runner, "/etc/init.d/network", "reload"); err != nil {
+		return err
+	}
+	return m.collect(ctx)
+}
+
+// save commits the values staged by apply
+func (m *Manager) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	return m.commit(ctx)
+}
+
+// revert discards the values staged by apply
+func (m *Manager) revert() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	m.uci.Restore(ctx)
+}
+
+// stage runs fn on the loaded config, its changes stay in the save directory
+func (m *Manager) stage(fn func(ctx context.Context, cfg *config, stored map[string]string) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+
+	stored, err := store.Values()
+	if err != nil {
+		return err
+	}
+	cfg, err := m.load(ctx, stored)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, cfg, stored)
+}
+
+// write stages fn and commits its changes, they are reverted when fn fails
+func (m *Manager) write(fn func(ctx context.Context, cfg *config, stored map[string]string) error) error {
+	if err := m.stage(fn); err != nil {
+		m.revert()
+		return err
+	}
+	return m.save()
+}
+
+// path splits a name below the router into the table, the entry instance and
+// the parameter, e.g. IPv4Forwarding, 3 and Enable
+func path(name string) (table string, index int, param string, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(name, routerPrefix), ".", 3)
+	if !strings.HasPrefix(name, routerPrefix) || len(parts) < 3 || (parts[0] != "IPv4Forwarding" && parts[0] != "IPv6Forwarding") {
+		return "", 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	if index, err = strconv.Atoi(parts[1]); err != nil {
+		return "", 0, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	return parts[0], index, parts[2], nil
+}
+
+// find returns the static entry index of table
+func (cfg *config) find(table string, index int) *static {
+	routes := cfg.routes
+	if table == "IPv6Forwarding" {
+		routes = cfg.routes6
+	}
+	for _, s := range routes {
+		if s.index == index {
+			return s
+		}
+	}
+	return nil
+}
+
+// notStatic explains why name has no static entry, learned entries exist but
+// are read-only
+func notStatic(stored map[string]string, table string, index int, name string) error {
+	if _, ok := stored[fmt.Sprintf("%s%s.%d.Status", routerPrefix, table, index)]; ok {
+		return fmt.Errorf("%w: %s is not a static route", params.ErrNotWritable, name)
+	}
+	return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+}
+
+// apply stages the values of one SetParameterValues request, the registry
+// commits or reverts them with the other objects of the request
+func (m *Manager) apply(values map[string]string) error {
+	return m.stage(func(ctx context.Context, cfg *config, stored map[string]string) error {
+		changes := make(map[*static]map[string]string)
+		v6 := make(map[*static]bool)
+		for name, value := range values {
+			table, index, param, err := path(name)
+			if err != nil {
+				return err
+			}
+			s := cfg.find(table, index)
+			if s == nil {
+				return notStatic(stored, table, index, name)
+			}
+			if changes[s] == nil {
+				changes[s] = make(map[string]string)
+			}
+			changes[s][param] = value
+			v6[s] = table == "IPv6Forwarding"
+		}
+		for s, values := range changes {
+			if err := m.applyRoute(ctx, cfg, s, v6[s], values); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// applyRoute maps the parameters of one static entry to its section options
+func (m *Manager) applyRoute(ctx context.Context, cfg *config, s *static, v6 bool, changes map[string]string) error {
+	if value, ok := changes["Enable"]; ok {
+		disabled := "1"
+		if soap.BooleanValues[strings.ToLower(value)] {
+			disabled = ""
+		}
+		if err := m.uci.Set(ctx, s.section, "disabled", disabled); err != nil {
+			return err
+		}
+	}
+
+	if v6 {
+		if value, ok := changes["DestIPPrefix"]; ok {
+			target := "::/0"
+			if value != "" {
+				prefix, _ := netip.ParsePrefix(value)
+				if prefix.Masked() != prefix {
+					return fmt.Errorf("%s has host bits set", value)
+				}
+				target = prefix.String()
+			}
+			if err := m.uci.Set(ctx, s.section, "target", target); err != nil {
+				return err
+			}
+		}
+		if value, ok := changes["NextHop"]; ok {
+			if err := m.uci.Set(ctx, s.section, "gateway", value); err != nil {
+				return err
+			}
+		}
+	} else {
+		address, addressSet := changes["DestIPAddress"]
+		mask, maskSet := changes["DestSubnetMask"]
+		if addressSet || maskSet {
+			current, currentMask := destination(s.target)
+			if !addressSet {
+				address = current
+			}
+			if !maskSet {
+				mask = currentMask
+			}
+			if err := m.applyDestination(ctx, s, address, mask); err != nil {
+				return err
+			}
+		}
+		if value, ok := changes["GatewayIPAddress"]; ok {
+			if err := m.uci.Set(ctx, s.section, "gateway", value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if value, ok := changes["Interface"]; ok {
+		network, err := cfg.interfaceNetwork(value)
+		if err != nil {
+			return err
+		}
+		if err := m.uci.Set(ctx, s.section, "interface", network); err != nil {
+			return err
+		}
+	}
+	for param, option := range map[string]string{"ForwardingPolicy": "table", "ForwardingMetric": "metric"} {
+		value, ok := changes[param]
+		if !ok {
+			continue
+		}
+		if value == "-1" {
+			value = ""
+		}
+		if err := m.uci.Set(ctx, s.section, option, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyDestination writes the target and netmask of an IPv4 route, an empty
+// address is the default route and an empty mask a host route
+func (m *Manager) applyDestination(ctx context.Context, s *static, address, mask string) error {
+	switch {
+	case address == "":
+		address, mask = "0.0.0.0", "0.0.0.0"
+	case mask == "":
+		mask = "255.255.255.255"
+	}
+	bits, _ := maskBits(mask)
+	addr, _ := netip.ParseAddr(address)
+	if prefix := netip.PrefixFrom(addr, bits); prefix.Masked().Addr() != addr {
+		return fmt.Errorf("%s has host bits set for %s", address, mask)
+	}
+	if err := m.uci.Set(ctx, s.section, "target", address); err != nil {
+		return err
+	}
+	return m.uci.Set(ctx, s.section, "netmask", mask)
+}
+
+// interfaceNetwork returns the network interface numbered by a
+// Device.IP.Interface.{i}. reference, empty for an empty reference
+func (cfg *config) interfaceNetwork(ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	instance, err := ucicfg.RefInstance(ref, ipInterfaceRef)
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range cfg.interfaces {
+		if iface.instance == strconv.Itoa(instance) {
+			return iface.name, nil
+		}
+	}
+	return "", fmt.Errorf("no network interface for %s", ref)
+}
+
+// add creates a disabled static entry, numbered after every entry of its
+// table so it does not take the index of a learned route
+func (m *Manager) add(name string) (int, error) {
+	var index int
+	err := m.write(func(ctx context.Context, cfg *config, stored map[string]string) error {
+		var sectionType, option string
+		var routes []*static
+		var v6 bool
+		switch name {
+		case routerPrefix + "IPv4Forwarding.":
+			sectionType, option, routes = "route", routeInstance, cfg.routes
+		case routerPrefix + "IPv6Forwarding.":
+			sectionType, option, routes, v6 = "route6", route6Instance, cfg.routes6, true
+		default:
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		index = maxStored(stored, v6)
+		for _, s := range routes {
+			index = max(index, s.index)
+		}
+		index++
+
+		section, err := m.uci.Add(ctx, sectionType)
+		if err != nil {
+			return err
+		}
+		if err := m.uci.Set(ctx, section, option, strconv.Itoa(index)); err != nil {
+			return err
+		}
+		return m.uci.Set(ctx, section, "disabled", "1")
+	})
+	return index, err
+}
+
+// delete removes a static entry
+func (m *Manager) delete(name string) error {
+	return m.write(func(ctx context.Context, cfg *config, stored map[string]string) error {
+		table, index, param, err := path(name + "Enable")
+		if err != nil || param != "Enable" {
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		s := cfg.find(table, index)
+		if s == nil {
+			return fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+		}
+		return m.uci.Delete(ctx, s.section)
+	})
+}
@@ -0,0 +1,188 @@
+package routing
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+// rtnetlink values from linux/rtnetlink.h, spelled out so the parsing builds
+// on every platform
+const (
+	netlinkRoute = 0  // NETLINK_ROUTE
+	rtmNewRoute  = 24 // RTM_NEWROUTE
+	rtmGetRoute  = 26 // RTM_GETROUTE
+
+	rtaDst       = 1  // RTA_DST
+	rtaOif       = 4  // RTA_OIF
+	rtaGateway   = 5  // RTA_GATEWAY
+	rtaPriority  = 6  // RTA_PRIORITY
+	rtaMultipath = 9  // RTA_MULTIPATH
+	rtaCacheinfo = 12 // RTA_CACHEINFO
+	rtaTable     = 15 // RTA_TABLE
+
+	rtnUnicast    = 1     // RTN_UNICAST
+	rtTableMain   = 254   // RT_TABLE_MAIN
+	rtTableLocal  = 255   // RT_TABLE_LOCAL
+	rtmFCloned    = 0x200 // RTM_F_CLONED
+	rtmsgLength   = 12    // sizeof(struct rtmsg)
+	nexthopLength = 8     // sizeof(struct rtnexthop)
+
+	familyIPv4 = 2  // AF_INET
+	familyIPv6 = 10 // AF_INET6
+)
+
+// Route protocols of rtm_protocol mapped to an Origin of their own
+const (
+	protoKernel = 2   // RTPROT_KERNEL
+	protoRA     = 9   // RTPROT_RA
+	protoDHCP   = 16  // RTPROT_DHCP
+	protoOSPF   = 188 // RTPROT_OSPF
+	protoRIP    = 189 // RTPROT_RIP
+)
+
+// userHz is the clock tick of the expiry in rta_cacheinfo
+const userHz = 100
+
+// Route is a unicast route of the kernel routing tables
+type Route struct {
+	Destination netip.Prefix
+	Gateway     netip.Addr    // Invalid for directly connected routes
+	Device      string        // Egress device, e.g. br-lan
+	Metric      int           // RTA_PRIORITY
+	Table       int           // e.g. 254 for main
+	Protocol    int           // rtm_protocol, e.g. 4 for static
+	Expires     time.Duration // Lifetime left of routes learned from RAs, 0 for none
+}
+
+// RouteReader lists the kernel routes of one address family
+type RouteReader interface {
+	Routes(v6 bool) ([]Route, error)
+}
+
+// NetlinkReader dumps the routes of every table but local over rtnetlink
+type NetlinkReader struct{}
+
+// Routes implements RouteReader
+func (NetlinkReader) Routes(v6 bool) ([]Route, error) {
+	conn, err := netlink.Dial(netlinkRoute, nil)
+	if err != nil {
+		return nil, fmt.Errorf("dial rtnetlink: %w", err)
+	}
+	defer conn.Close()
+
+	family := byte(familyIPv4)
+	if v6 {
+		family = familyIPv6
+	}
+	request := make([]byte, rtmsgLength)
+	request[0] = family
+	messages, err := conn.Execute(netlink.Message{
+		Header: netlink.Header{Type: rtmGetRoute, Flags: netlink.Request | netlink.Dump},
+		Data:   request,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("dump routes: %w", err)
+	}
+
+	names := make(map[int]string)
+	var routes []Route
+	for _, message := range messages {
+		if message.Header.Type != rtmNewRoute {
+			continue
+		}
+		route, ifindex, ok := parseRoute(message.Data)
+		if !ok {
+			continue
+		}
+		if _, known := names[ifindex]; !known && ifindex > 0 {
+			if iface, err := net.InterfaceByIndex(ifindex); err == nil {
+				names[ifindex] = iface.Name
+			}
+		}
+		route.Device = names[ifindex]
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// parseRoute decodes an RTM_NEWROUTE payload with the index of its egress
+// device. Local, broadcast and cached routes and the local table are skipped
+func parseRoute(data []byte) (route Route, ifindex int, ok bool) {
+	if len(data) < rtmsgLength {
+		return Route{}, 0, false
+	}
+	family, dstLen, table, protocol, kind := data[0], int(data[1]), int(data[4]), int(data[5]), data[7]
+	flags := nlenc.Uint32(data[8:12])
+	if kind != rtnUnicast || flags&rtmFCloned != 0 || (family != familyIPv4 && family != familyIPv6) {
+		return Route{}, 0, false
+	}
+
+	unspecified := netip.IPv4Unspecified()
+	if family == familyIPv6 {
+		unspecified = netip.IPv6Unspecified()
+	}
+	route = Route{Destination: netip.PrefixFrom(unspecified, 0), Table: table, Protocol: protocol}
+	ad, err := netlink.NewAttributeDecoder(data[rtmsgLength:])
+	if err != nil {
+		return Route{}, 0, false
+	}
+	for ad.Next() {
+		switch ad.Type() {
+		case rtaDst:
+			if addr, ok := netip.AddrFromSlice(ad.Bytes()); ok {
+				route.Destination = netip.PrefixFrom(addr, dstLen)
+			}
+		case rtaGateway:
+			route.Gateway, _ = netip.AddrFromSlice(ad.Bytes())
+		case rtaOif:
+			ifindex = int(ad.Uint32())
+		case rtaPriority:
+			route.Metric = int(ad.Uint32())
+		case rtaTable:
+			route.Table = int(ad.Uint32())
+		case rtaCacheinfo:
+			// struct rta_cacheinfo, rta_expires is the third field
+			if b := ad.Bytes(); len(b) >= 12 {
+				if expires := int32(nlenc.Uint32(b[8:12])); expires > 0 {
+					route.Expires = time.Duration(expires) * time.Second / userHz
+				}
+			}
+		case rtaMultipath:
+			// Only the first hop of a multipath route is reported
+			if gateway, index, ok := firstHop(ad.Bytes()); ok {
+				route.Gateway, ifindex = gateway, index
+			}
+		}
+	}
+	if ad.Err() != nil || route.Table == rtTableLocal {
+		return Route{}, 0, false
+	}
+	return route, ifindex, true
+}
+
+// firstHop decodes the first struct rtnexthop of RTA_MULTIPATH
+func firstHop(data []byte) (gateway netip.Addr, ifindex int, ok bool) {
+	if len(data) < nexthopLength {
+		return netip.Addr{}, 0, false
+	}
+	length := int(nlenc.Uint16(data[0:2]))
+	if length < nexthopLength || length > len(data) {
+		return netip.Addr{}, 0, false
+	}
+	ifindex = int(int32(nlenc.Uint32(data[4:8])))
+	ad, err := netlink.NewAttributeDecoder(data[nexthopLength:length])
+	if err != nil {
+		return netip.Addr{}, 0, false
+	}
+	for ad.Next() {
+		if ad.Type() == rtaGateway {
+			gateway, _ = netip.AddrFromSlice(ad.Bytes())
+		}
+	}
+	return gateway, ifindex, ad.Err() == nil
+}
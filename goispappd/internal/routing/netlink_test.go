@@ -0,0 +1,98 @@
+package routing
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+// rtmsg builds an RTM_NEWROUTE payload
+func rtmsg(t *testing.T, family, dstLen, table, protocol, kind byte, attrs []netlink.Attribute) []byte {
+	t.Helper()
+	data, err := netlink.MarshalAttributes(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{family, dstLen, 0, 0, table, protocol, 0, kind, 0, 0, 0, 0}, data...)
+}
+
+func TestParseRoute(t *testing.T) {
+	cacheinfo := make([]byte, 32)
+	copy(cacheinfo[8:12], nlenc.Uint32Bytes(180000))
+	nexthop := append(nlenc.Uint16Bytes(16), 0, 0)
+	nexthop = append(append(nexthop, nlenc.Uint32Bytes(7)...), 8, 0, rtaGateway, 0, 10, 0, 0, 2)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		route   Route
+		ifindex int
+		ok      bool
+	}{
+		{
+			name: "Default",
+			data: rtmsg(t, familyIPv4, 0, rtTableMain, 4, rtnUnicast, []netlink.Attribute{
+				{Type: rtaTable, Data: nlenc.Uint32Bytes(rtTableMain)},
+				{Type: rtaGateway, Data: []byte{192, 168, 0, 1}},
+				{Type: rtaOif, Data: nlenc.Uint32Bytes(3)},
+				{Type: rtaPriority, Data: nlenc.Uint32Bytes(10)},
+			}),
+			route:   Route{Destination: netip.MustParsePrefix("0.0.0.0/0"), Gateway: netip.MustParseAddr("192.168.0.1"), Metric: 10, Table: rtTableMain, Protocol: 4},
+			ifindex: 3,
+			ok:      true,
+		},
+		{
+			name: "PolicyTable",
+			data: rtmsg(t, familyIPv4, 24, 252, 2, rtnUnicast, []netlink.Attribute{
+				{Type: rtaTable, Data: nlenc.Uint32Bytes(1000)},
+				{Type: rtaDst, Data: []byte{10, 1, 2, 0}},
+				{Type: rtaOif, Data: nlenc.Uint32Bytes(4)},
+			}),
+			route:   Route{Destination: netip.MustParsePrefix("10.1.2.0/24"), Table: 1000, Protocol: 2},
+			ifindex: 4,
+			ok:      true,
+		},
+		{
+			name: "RouterAdvertisement",
+			data: rtmsg(t, familyIPv6, 0, rtTableMain, protoRA, rtnUnicast, []netlink.Attribute{
+				{Type: rtaGateway, Data: netip.MustParseAddr("fe80::1").AsSlice()},
+				{Type: rtaOif, Data: nlenc.Uint32Bytes(5)},
+				{Type: rtaCacheinfo, Data: cacheinfo},
+			}),
+			route:   Route{Destination: netip.MustParsePrefix("::/0"), Gateway: netip.MustParseAddr("fe80::1"), Table: rtTableMain, Protocol: protoRA, Expires: 30 * time.Minute},
+			ifindex: 5,
+			ok:      true,
+		},
+		{
+			name: "Multipath",
+			data: rtmsg(t, familyIPv4, 8, rtTableMain, 4, rtnUnicast, []netlink.Attribute{
+				{Type: rtaDst, Data: []byte{10, 0, 0, 0}},
+				{Type: rtaMultipath, Data: nexthop},
+			}),
+			route:   Route{Destination: netip.MustParsePrefix("10.0.0.0/8"), Gateway: netip.MustParseAddr("10.0.0.2"), Table: rtTableMain, Protocol: 4},
+			ifindex: 7,
+			ok:      true,
+		},
+		{
+			name: "Local",
+			data: rtmsg(t, familyIPv4, 32, rtTableLocal, 2, 2, []netlink.Attribute{
+				{Type: rtaDst, Data: []byte{127, 0, 0, 1}},
+			}),
+		},
+		{
+			name: "Truncated",
+			data: []byte{familyIPv4, 0, 0},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			route, ifindex, ok := parseRoute(test.data)
+			if ok != test.ok || route != test.route || ifindex != test.ifindex {
+				t.Errorf("Expected %+v on %d (%v), got %+v on %d (%v)", test.route, test.ifindex, test.ok, route, ifindex, ok)
+			}
+		})
+	}
+}
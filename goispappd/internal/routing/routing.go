@@ -0,0 +1,693 @@
+// Package routing maps TR-181 Device.Routing.Router.1 to the kernel routing
+// tables read over rtnetlink and to the route and route6 sections of
+// /etc/config/network. The sections are the static forwarding entries, the
+// other entries are the routes installed by netifd, the kernel or a routing
+// daemon and are read-only.
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// Prefix is the object mapped by the package
+const Prefix = "Device.Routing."
+
+// routerPrefix is the only router, the main and policy tables all belong to it
+const routerPrefix = Prefix + "Router.1."
+
+// ipInterfaceRef is the prefix of the Interface references
+const ipInterfaceRef = "Device.IP.Interface."
+
+// UCI options numbering the instances, ip_int_instance is shared with the
+// tr181 shell scripts
+const (
+	routeInstance     = "route_instance"
+	route6Instance    = "route6_instance"
+	interfaceInstance = "ip_int_instance"
+)
+
+// infiniteTime is the TR-181 dateTime of a route that never expires
+const infiniteTime = "9999-12-31T23:59:59Z"
+
+// tableNames are the routing tables uci accepts by name
+var tableNames = map[string]int{"default": 253, "main": rtTableMain, "local": rtTableLocal}
+
+// Manager reads the routing tables and writes the static routes with uci
+type Manager struct {
+	runner  exec.Runner
+	uci     *ucicfg.Config
+	numbers *ucicfg.Config // Instance numbers, committed apart from the requests
+	reader  RouteReader
+	mu      sync.Mutex
+}
+
+// NewManager creates a Manager reading the kernel routes with reader and
+// running uci and netifd through runner
+func NewManager(runner exec.Runner, reader RouteReader) *Manager {
+	c := ucicfg.New(runner, "network", "routing")
+	return &Manager{runner: runner, uci: c, numbers: c.Numbers(), reader: reader}
+}
+
+// static is a route or route6 section
+type static struct {
+	section string
+	index   int
+	enable  bool
+	target  netip.Prefix // Invalid when the section has no usable target
+	gateway netip.Addr
+	network string // Network interface of the route
+	metric  int    // -1 when unset
+	table   int    // -1 for the main table
+}
+
+// netifd is a network interface with its layer 3 device
+type netifd struct {
+	name     string
+	instance string // ip_int_instance, empty until the IP scripts numbered it
+	proto    string
+	device   string
+}
+
+// config is the network config with its instance numbers
+type config struct {
+	routes     []*static // route sections
+	routes6    []*static // route6 sections
+	interfaces []*netifd
+}
+
+// load reads the network config, numbering the route sections that have no
+// instance yet after the highest instance of the stored tables
+func (m *Manager) load(ctx context.Context, stored map[string]string) (*config, error) {
+	sections, err := m.uci.Show(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &config{interfaces: m.interfaces(ctx, sections)}
+
+	numbered := false
+	for _, kind := range []struct {
+		sectionType, option string
+		v6                  bool
+		routes              *[]*static
+	}{
+		{"route", routeInstance, false, &cfg.routes},
+		{"route6", route6Instance, true, &cfg.routes6},
+	} {
+		next := max(ucicfg.MaxInstance(sections, kind.sectionType, kind.option), maxStored(stored, kind.v6))
+		for _, sec := range sections {
+			if sec.SectionType != kind.sectionType {
+				continue
+			}
+			index, err := strconv.Atoi(sec.Options[kind.option])
+			if err != nil {
+				next++
+				index = next
+				if err := m.numbers.Set(ctx, sec.Name, kind.option, strconv.Itoa(index)); err != nil {
+					return nil, err
+				}
+				numbered = true
+			}
+			*kind.routes = append(*kind.routes, newStatic(sec, index, kind.v6))
+		}
+		sort.Slice(*kind.routes, func(i, j int) bool { return (*kind.routes)[i].index < (*kind.routes)[j].index })
+	}
+	if numbered {
+		if err := m.numbers.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// interfaces returns the network interfaces with the device netifd brought
+// up, or the configured device while ubus is not available
+func (m *Manager) interfaces(ctx context.Context, sections []*uci.Section) []*netifd {
+	devices := make(map[string]string)
+	protos := make(map[string]string)
+	if output, err := ucicfg.Command(ctx, m.runner, "ubus", "call", "network.interface", "dump"); err == nil {
+		var dump struct {
+			Interface []struct {
+				Interface string `json:"interface"`
+				Proto     string `json:"proto"`
+				L3Device  string `json:"l3_device"`
+			} `json:"interface"`
+		}
+		if json.Unmarshal([]byte(output), &dump) == nil {
+			for _, iface := range dump.Interface {
+				devices[iface.Interface] = iface.L3Device
+				protos[iface.Interface] = iface.Proto
+			}
+		}
+	}
+
+	var interfaces []*netifd
+	for _, sec := range sections {
+		if sec.SectionType != "interface" {
+			continue
+		}
+		iface := &netifd{
+			name:     sec.Name,
+			instance: sec.Options[interfaceInstance],
+			proto:    valueOr(protos[sec.Name], sec.Options["proto"]),
+			device:   devices[sec.Name],
+		}
+		if iface.device == "" {
+			// ifname before OpenWrt 21.02, an @ alias has no device of its own
+			device := first(valueOr(sec.Options["device"], sec.Options["ifname"]))
+			if !strings.HasPrefix(device, "@") {
+				iface.device = device
+			}
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces
+}
+
+// newStatic maps a route or route6 section
+func newStatic(sec *uci.Section, index int, v6 bool) *static {
+	s := &static{
+		section: sec.Name,
+		index:   index,
+		enable:  sec.Options["disabled"] != "1",
+		network: sec.Options["interface"],
+		metric:  -1,
+		table:   -1,
+	}
+	s.target = parseTarget(sec.Options["target"], sec.Options["netmask"], v6)
+	s.gateway, _ = netip.ParseAddr(sec.Options["gateway"])
+	if metric, err := strconv.Atoi(sec.Options["metric"]); err == nil {
+		s.metric = metric
+	}
+	if table, ok := parseTable(sec.Options["table"]); ok && table != rtTableMain {
+		s.table = table
+	}
+	return s
+}
+
+// parseTarget parses the target of a route section, an address with an
+// optional netmask or a prefix
+func parseTarget(target, netmask string, v6 bool) netip.Prefix {
+	if prefix, err := netip.ParsePrefix(target); err == nil && prefix.Addr().Is6() == v6 {
+		return prefix.Masked()
+	}
+	addr, err := netip.ParseAddr(target)
+	if err != nil || addr.Is6() != v6 {
+		return netip.Prefix{}
+	}
+	bits := addr.BitLen()
+	if netmask != "" {
+		var ok bool
+		if bits, ok = maskBits(netmask); !ok {
+			return netip.Prefix{}
+		}
+	}
+	return netip.PrefixFrom(addr, bits).Masked()
+}
+
+// parseTable returns the number of a routing table given by number or name
+func parseTable(value string) (int, bool) {
+	if table, ok := tableNames[value]; ok {
+		return table, true
+	}
+	table, err := strconv.Atoi(value)
+	return table, err == nil
+}
+
+// networkInterface returns the network interface called name
+func (cfg *config) networkInterface(name string) *netifd {
+	for _, iface := range cfg.interfaces {
+		if iface.name == name && name != "" {
+			return iface
+		}
+	}
+	return nil
+}
+
+// deviceInterface returns the network interface of a device. Devices carrying
+// a DHCPv6 interface next to the IPv4 one, e.g. wan and wan6, are attributed
+// by address family
+func (cfg *config) deviceInterface(device string, v6 bool) *netifd {
+	var found *netifd
+	for _, iface := range cfg.interfaces {
+		if iface.device != device || device == "" {
+			continue
+		}
+		if (iface.proto == "dhcpv6") == v6 {
+			return iface
+		}
+		if found == nil {
+			found = iface
+		}
+	}
+	return found
+}
+
+// reference returns the Device.IP.Interface. reference of an interface
+func (iface *netifd) reference() string {
+	if iface == nil || iface.instance == "" {
+		return ""
+	}
+	return ipInterfaceRef + iface.instance + "."
+}
+
+// origin tells how a route was learned, from its protocol or else from the
+// protocol of its interface
+func (cfg *config) origin(route Route, v6 bool) string {
+	switch route.Protocol {
+	case protoDHCP:
+		if v6 {
+			return "DHCPv6"
+		}
+		return "DHCPv4"
+	case protoRA:
+		return "RA"
+	case protoOSPF:
+		return "OSPF"
+	case protoRIP:
+		if v6 {
+			return "RIPng"
+		}
+		return "RIP"
+	}
+	proto := ""
+	if iface := cfg.deviceInterface(route.Device, v6); iface != nil {
+		proto = iface.proto
+	}
+	switch {
+	case v6 && proto != "static" && proto != "" && route.Destination.Bits() == 0:
+		// odhcp6c hands the default router of the RAs to netifd
+		return "RA"
+	case v6 && proto == "dhcpv6":
+		return "DHCPv6"
+	case !v6 && proto == "dhcp":
+		return "DHCPv4"
+	case !v6 && isPPP(proto):
+		return "IPCP"
+	}
+	return "Static"
+}
+
+// isPPP reports whether proto brings the interface up with PPP
+func isPPP(proto string) bool {
+	switch proto {
+	case "ppp", "pppoe", "pppoa", "pptp", "l2tp", "3g":
+		return true
+	}
+	return false
+}
+
+// matches reports whether route is the kernel route of s
+func (s *static) matches(route Route) bool {
+	if !s.target.IsValid() || route.Destination != s.target {
+		return false
+	}
+	if s.gateway.IsValid() && route.Gateway != s.gateway {
+		return false
+	}
+	return policy(route.Table) == s.table
+}
+
+// policy returns the ForwardingPolicy of a table, -1 for the main table
+func policy(table int) int {
+	if table == rtTableMain {
+		return -1
+	}
+	return table
+}
+
+// status returns the Status of a static entry
+func (s *static) status(installed bool) string {
+	switch {
+	case !s.enable:
+		return "Disabled"
+	case installed:
+		return "Enabled"
+	}
+	return "Error_Misconfigured"
+}
+
+// Routers returns the router with its IPv4 and IPv6 forwarding tables
+func (m *Manager) Routers(ctx context.Context) ([]device.Router, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, err := store.Values()
+	if err != nil {
+		return nil, err
+	}
+	return m.routers(ctx, stored)
+}
+
+func (m *Manager) routers(ctx context.Context, stored map[string]string) ([]device.Router, error) {
+	cfg, err := m.load(ctx, stored)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := m.reader.Routes(false)
+	if err != nil {
+		return nil, err
+	}
+	routes6, err := m.reader.Routes(true)
+	if err != nil {
+		return nil, err
+	}
+	router := device.Router{Index: 1, Enable: true, Status: "Enabled"}
+	router.IPv4Forwarding = cfg.ipv4Forwarding(routes, stored)
+	router.IPv6Forwarding = cfg.ipv6Forwarding(routes6, stored, time.Now())
+	router.IPv4ForwardingNumberOfEntries = len(router.IPv4Forwarding)
+	router.IPv6ForwardingNumberOfEntries = len(router.IPv6Forwarding)
+	return []device.Router{router}, nil
+}
+
+// learned returns the routes no static entry accounts for, in a stable order,
+// and marks the static entries that are installed
+func learned(statics []*static, routes []Route) ([]Route, map[*static]bool) {
+	installed := make(map[*static]bool)
+	var rest []Route
+	for _, route := range routes {
+		owned := false
+		for _, s := range statics {
+			if s.enable && !installed[s] && s.matches(route) {
+				installed[s], owned = true, true
+				break
+			}
+		}
+		if !owned {
+			rest = append(rest, route)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		a, b := rest[i], rest[j]
+		if a.Table != b.Table {
+			return a.Table < b.Table
+		}
+		if a.Destination != b.Destination {
+			return a.Destination.Addr().Less(b.Destination.Addr()) ||
+				a.Destination.Addr() == b.Destination.Addr() && a.Destination.Bits() < b.Destination.Bits()
+		}
+		return a.Metric < b.Metric
+	})
+	return rest, installed
+}
+
+// numberer gives the learned entries the index they were stored with, new
+// entries are numbered after every index in use
+type numberer struct {
+	previous map[string]int
+	used     map[int]bool
+	next     int
+}
+
+func newNumberer(previous map[string]int, statics []*static) *numberer {
+	n := &numberer{previous: previous, used: make(map[int]bool)}
+	for _, s := range statics {
+		n.used[s.index] = true
+		n.next = max(n.next, s.index)
+	}
+	for _, index := range previous {
+		n.next = max(n.next, index)
+	}
+	return n
+}
+
+func (n *numberer) index(key string) int {
+	if index, ok := n.previous[key]; ok && !n.used[index] {
+		n.used[index] = true
+		return index
+	}
+	n.next++
+	n.used[n.next] = true
+	return n.next
+}
+
+// ipv4Forwarding builds the IPv4Forwarding table
+func (cfg *config) ipv4Forwarding(routes []Route, stored map[string]string) []device.IPv4ForwardingEntry {
+	rest, installed := learned(cfg.routes, routes)
+	var entries []device.IPv4ForwardingEntry
+	for _, s := range cfg.routes {
+		entry := device.IPv4ForwardingEntry{
+			Index:            s.index,
+			Enable:           s.enable,
+			Status:           s.status(installed[s]),
+			StaticRoute:      true,
+			ForwardingPolicy: s.table,
+			Interface:        cfg.networkInterface(s.network).reference(),
+			Origin:           "Static",
+			ForwardingMetric: s.metric,
+		}
+		entry.DestIPAddress, entry.DestSubnetMask = destination(s.target)
+		if s.gateway.IsValid() {
+			entry.GatewayIPAddress = s.gateway.String()
+		}
+		entries = append(entries, entry)
+	}
+
+	numbers := newNumberer(storedKeys(stored, false), cfg.routes)
+	for _, route := range rest {
+		entry := device.IPv4ForwardingEntry{
+			Enable:           true,
+			Status:           "Enabled",
+			ForwardingPolicy: policy(route.Table),
+			Interface:        cfg.deviceInterface(route.Device, false).reference(),
+			Origin:           cfg.origin(route, false),
+			ForwardingMetric: route.Metric,
+		}
+		entry.DestIPAddress, entry.DestSubnetMask = destination(route.Destination)
+		if route.Gateway.IsValid() {
+			entry.GatewayIPAddress = route.Gateway.String()
+		}
+		entry.Index = numbers.index(ipv4Key(entry.DestIPAddress, entry.DestSubnetMask, entry.GatewayIPAddress, entry.Interface, entry.ForwardingPolicy))
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Index < entries[j].Index })
+	return entries
+}
+
+// ipv6Forwarding builds the IPv6Forwarding table
+func (cfg *config) ipv6Forwarding(routes []Route, stored map[string]string, now time.Time) []device.IPv6ForwardingEntry {
+	rest, installed := learned(cfg.routes6, routes)
+	var entries []device.IPv6ForwardingEntry
+	for _, s := range cfg.routes6 {
+		entry := device.IPv6ForwardingEntry{
+			Index:            s.index,
+			Enable:           s.enable,
+			Status:           s.status(installed[s]),
+			ForwardingPolicy: s.table,
+			Interface:        cfg.networkInterface(s.network).reference(),
+			Origin:           "Static",
+			ForwardingMetric: s.metric,
+			ExpirationTime:   infiniteTime,
+		}
+		if s.target.IsValid() && s.target.Bits() > 0 {
+			entry.DestIPPrefix = s.target.String()
+		}
+		if s.gateway.IsValid() {
+			entry.NextHop = s.gateway.String()
+		}
+		entries = append(entries, entry)
+	}
+
+	numbers := newNumberer(storedKeys(stored, true), cfg.routes6)
+	for _, route := range rest {
+		// Every interface has a link-local route, they say nothing of interest
+		if route.Destination.Addr().IsLinkLocalUnicast() {
+			continue
+		}
+		entry := device.IPv6ForwardingEntry{
+			Enable:           true,
+			Status:           "Enabled",
+			ForwardingPolicy: policy(route.Table),
+			Interface:        cfg.deviceInterface(route.Device, true).reference(),
+			Origin:           cfg.origin(route, true),
+			ForwardingMetric: route.Metric,
+			ExpirationTime:   infiniteTime,
+		}
+		if route.Destination.Bits() > 0 {
+			entry.DestIPPrefix = route.Destination.String()
+		}
+		if route.Gateway.IsValid() {
+			entry.NextHop = route.Gateway.String()
+		}
+		if route.Expires > 0 {
+			entry.ExpirationTime = now.Add(route.Expires).UTC().Format(time.RFC3339)
+		}
+		entry.Index = numbers.index(ipv6Key(entry.DestIPPrefix, entry.NextHop, entry.Interface, entry.ForwardingPolicy))
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Index < entries[j].Index })
+	return entries
+}
+
+// destination returns DestIPAddress and DestSubnetMask, both empty for the
+// default route
+func destination(target netip.Prefix) (address, mask string) {
+	if !target.IsValid() || target.Bits() == 0 {
+		return "", ""
+	}
+	return target.Addr().String(), prefixMask(target.Bits())
+}
+
+func ipv4Key(address, mask, gateway, iface string, policy int) string {
+	return fmt.Sprintf("%s/%s via %s dev %s table %d", address, mask, gateway, iface, policy)
+}
+
+func ipv6Key(prefix, nextHop, iface string, policy int) string {
+	return fmt.Sprintf("%s via %s dev %s table %d", prefix, nextHop, iface, policy)
+}
+
+var storedEntry = regexp.MustCompile(`^` + regexp.QuoteMeta(routerPrefix) + `(IPv[46])Forwarding\.(\d+)\.Status$`)
+
+// storedKeys maps the entries of a stored table to their index, the indices
+// of static entries are taken by their sections before learned ones are
+// numbered
+func storedKeys(stored map[string]string, v6 bool) map[string]int {
+	table := routerPrefix + "IPv4Forwarding."
+	if v6 {
+		table = routerPrefix + "IPv6Forwarding."
+	}
+	keys := make(map[string]int)
+	for index := range storedIndices(stored, v6) {
+		entry := fmt.Sprintf("%s%d.", table, index)
+		policy, _ := strconv.Atoi(stored[entry+"ForwardingPolicy"])
+		if v6 {
+			keys[ipv6Key(stored[entry+"DestIPPrefix"], stored[entry+"NextHop"], stored[entry+"Interface"], policy)] = index
+		} else {
+			keys[ipv4Key(stored[entry+"DestIPAddress"], stored[entry+"DestSubnetMask"], stored[entry+"GatewayIPAddress"], stored[entry+"Interface"], policy)] = index
+		}
+	}
+	return keys
+}
+
+// storedIndices returns the indices of a stored table
+func storedIndices(stored map[string]string, v6 bool) map[int]bool {
+	family := "IPv4"
+	if v6 {
+		family = "IPv6"
+	}
+	indices := make(map[int]bool)
+	for name := range stored {
+		if match := storedEntry.FindStringSubmatch(name); match != nil && match[1] == family {
+			index, _ := strconv.Atoi(match[2])
+			indices[index] = true
+		}
+	}
+	return indices
+}
+
+// maxStored returns the highest index of a stored table
+func maxStored(stored map[string]string, v6 bool) int {
+	highest := 0
+	for index := range storedIndices(stored, v6) {
+		highest = max(highest, index)
+	}
+	return highest
+}
+
+// Collect stores the router in the tr069 store
+func (m *Manager) Collect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.collect(ctx)
+}
+
+func (m *Manager) collect(ctx context.Context) error {
+	stored, err := store.Values()
+	if err != nil {
+		return err
+	}
+	routers, err := m.routers(ctx, stored)
+	if err != nil {
+		return err
+	}
+	// RouterNumberOfEntries is rewritten, only the table needs clearing
+	return store.Replace([]string{Prefix + "Router."}, Values(routers))
+}
+
+// Values flattens routers into parameters keyed by full name
+func Values(routers []device.Router) map[string]string {
+	values := map[string]string{Prefix + "RouterNumberOfEntries": strconv.Itoa(len(routers))}
+	for _, r := range routers {
+		name := fmt.Sprintf("%sRouter.%d.", Prefix, r.Index)
+		values[name+"Enable"] = strconv.FormatBool(r.Enable)
+		values[name+"Status"] = r.Status
+		values[name+"IPv4ForwardingNumberOfEntries"] = strconv.Itoa(r.IPv4ForwardingNumberOfEntries)
+		values[name+"IPv6ForwardingNumberOfEntries"] = strconv.Itoa(r.IPv6ForwardingNumberOfEntries)
+		for _, f := range r.IPv4Forwarding {
+			entry := fmt.Sprintf("%sIPv4Forwarding.%d.", name, f.Index)
+			values[entry+"Enable"] = strconv.FormatBool(f.Enable)
+			values[entry+"Status"] = f.Status
+			values[entry+"StaticRoute"] = strconv.FormatBool(f.StaticRoute)
+			values[entry+"DestIPAddress"] = f.DestIPAddress
+			values[entry+"DestSubnetMask"] = f.DestSubnetMask
+			values[entry+"ForwardingPolicy"] = strconv.Itoa(f.ForwardingPolicy)
+			values[entry+"GatewayIPAddress"] = f.GatewayIPAddress
+			values[entry+"Interface"] = f.Interface
+			values[entry+"Origin"] = f.Origin
+			values[entry+"ForwardingMetric"] = strconv.Itoa(f.ForwardingMetric)
+		}
+		for _, f := range r.IPv6Forwarding {
+			entry := fmt.Sprintf("%sIPv6Forwarding.%d.", name, f.Index)
+			values[entry+"Enable"] = strconv.FormatBool(f.Enable)
+			values[entry+"Status"] = f.Status
+			values[entry+"DestIPPrefix"] = f.DestIPPrefix
+			values[entry+"ForwardingPolicy"] = strconv.Itoa(f.ForwardingPolicy)
+			values[entry+"NextHop"] = f.NextHop
+			values[entry+"Interface"] = f.Interface
+			values[entry+"Origin"] = f.Origin
+			values[entry+"ForwardingMetric"] = strconv.Itoa(f.ForwardingMetric)
+			values[entry+"ExpirationTime"] = f.ExpirationTime
+		}
+	}
+	return values
+}
+
+// maskBits returns the prefix length of a dotted netmask
+func maskBits(mask string) (int, bool) {
+	addr, err := netip.ParseAddr(mask)
+	if err != nil || !addr.Is4() {
+		return 0, false
+	}
+	b := addr.As4()
+	bits := uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+	ones := 0
+	for bits&0x80000000 != 0 {
+		ones++
+		bits <<= 1
+	}
+	return ones, bits == 0
+}
+
+// prefixMask returns the dotted netmask of a prefix length
+func prefixMask(bits int) string {
+	mask := ^uint32(0) << (32 - bits)
+	return netip.AddrFrom4([4]byte{byte(mask >> 24), byte(mask >> 16), byte(mask >> 8), byte(mask)}).String()
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// first returns the first word of a value
+func first(value string) string {
+	if fields := strings.Fields(value); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
@@ -0,0 +1,254 @@
+package routing_test
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/routing"
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+)
+
+// fakeReader returns the routes set by the test
+type fakeReader struct {
+	mu     sync.Mutex
+	v4, v6 []routing.Route
+}
+
+func (r *fakeReader) Routes(v6 bool) ([]routing.Route, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v6 {
+		return append([]routing.Route(nil), r.v6...), nil
+	}
+	return append([]routing.Route(nil), r.v4...), nil
+}
+
+func route(destination, gateway, device string, protocol int) routing.Route {
+	r := routing.Route{Destination: netip.MustParsePrefix(destination), Device: device, Table: 254, Protocol: protocol}
+	r.Gateway, _ = netip.ParseAddr(gateway)
+	return r
+}
+
+const interfaceDump = `{"interface":[
+{"interface":"lan","proto":"static","l3_device":"br-lan"},
+{"interface":"wan","proto":"dhcp","l3_device":"eth1"},
+{"interface":"wan6","proto":"dhcpv6","l3_device":"eth1"}]}`
+
+// newFakes emulates a router with a DHCP wan, a static lan and one static route
+func newFakes() (*ucitest.UCI, *fakeReader) {
+	uci := ucitest.New().
+		Section("network", "lan", "interface", "proto", "static", "device", "br-lan", "ipaddr", "192.168.1.1/24", "ip_int_instance", "1").
+		Section("network", "wan", "interface", "proto", "dhcp", "device", "eth1", "ip_int_instance", "2").
+		Section("network", "wan6", "interface", "proto", "dhcpv6", "device", "@wan", "ip_int_instance", "3").
+		Section("network", "office", "route", "interface", "lan", "target", "10.10.0.0", "netmask", "255.255.0.0", "gateway", "192.168.1.254").
+		On("ubus call network.interface dump", interfaceDump).
+		On("/etc/init.d/network reload", "")
+	reader := &fakeReader{
+		v4: []routing.Route{
+			route("192.168.1.0/24", "", "br-lan", 2),
+			route("10.10.0.0/16", "192.168.1.254", "br-lan", 4),
+			route("0.0.0.0/0", "192.0.2.1", "eth1", 4),
+			route("192.0.2.0/24", "", "eth1", 2),
+		},
+		v6: []routing.Route{
+			route("::/0", "fe80::1", "eth1", 4),
+			route("fe80::/64", "", "br-lan", 2),
+			route("fd00:1::/64", "", "br-lan", 4),
+		},
+	}
+	return uci, reader
+}
+
+func newRegistry(t *testing.T) (*ucitest.UCI, *fakeReader, *params.Registry) {
+	t.Helper()
+	ucitest.UseStore(t)
+	uci, reader := newFakes()
+	manager := routing.NewManager(uci, reader)
+	if err := manager.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	registry := params.NewRegistry()
+	manager.Register(registry)
+	return uci, reader, registry
+}
+
+func TestCollect(t *testing.T) {
+	uci, reader, _ := newRegistry(t)
+
+	prefix := "Device.Routing.Router.1."
+	ucitest.ExpectStored(t, map[string]string{
+		"Device.Routing.RouterNumberOfEntries":   "1",
+		prefix + "IPv4ForwardingNumberOfEntries": "4",
+		prefix + "IPv6ForwardingNumberOfEntries": "2",
+		// The static route keeps the first index
+		prefix + "IPv4Forwarding.1.StaticRoute":      "true",
+		prefix + "IPv4Forwarding.1.Status":           "Enabled",
+		prefix + "IPv4Forwarding.1.DestIPAddress":    "10.10.0.0",
+		prefix + "IPv4Forwarding.1.DestSubnetMask":   "255.255.0.0",
+		prefix + "IPv4Forwarding.1.GatewayIPAddress": "192.168.1.254",
+		prefix + "IPv4Forwarding.1.Interface":        "Device.IP.Interface.1.",
+		prefix + "IPv4Forwarding.1.Origin":           "Static",
+		prefix + "IPv4Forwarding.1.ForwardingPolicy": "-1",
+		prefix + "IPv4Forwarding.1.ForwardingMetric": "-1",
+		// The learned routes follow in table and destination order
+		prefix + "IPv4Forwarding.2.StaticRoute":      "false",
+		prefix + "IPv4Forwarding.2.DestIPAddress":    "",
+		prefix + "IPv4Forwarding.2.DestSubnetMask":   "",
+		prefix + "IPv4Forwarding.2.GatewayIPAddress": "192.0.2.1",
+		prefix + "IPv4Forwarding.2.Interface":        "Device.IP.Interface.2.",
+		prefix + "IPv4Forwarding.2.Origin":           "DHCPv4",
+		prefix + "IPv4Forwarding.3.DestIPAddress":    "192.0.2.0",
+		prefix + "IPv4Forwarding.3.Origin":           "DHCPv4",
+		prefix + "IPv4Forwarding.4.DestIPAddress":    "192.168.1.0",
+		prefix + "IPv4Forwarding.4.Origin":           "Static",
+		prefix + "IPv6Forwarding.1.DestIPPrefix":     "",
+		prefix + "IPv6Forwarding.1.NextHop":          "fe80::1",
+		prefix + "IPv6Forwarding.1.Interface":        "Device.IP.Interface.3.",
+		prefix + "IPv6Forwarding.1.Origin":           "RA",
+		prefix + "IPv6Forwarding.1.ExpirationTime":   "9999-12-31T23:59:59Z",
+		prefix + "IPv6Forwarding.2.DestIPPrefix":     "fd00:1::/64",
+		prefix + "IPv6Forwarding.2.Interface":        "Device.IP.Interface.1.",
+		prefix + "IPv6Forwarding.2.Origin":           "Static",
+	})
+	if got := uci.Option("network", "office", "route_instance"); got != "1" {
+		t.Errorf("Expected the static route to be numbered, got %q", got)
+	}
+
+	t.Run("StableIndices", func(t *testing.T) {
+		reader.mu.Lock()
+		reader.v4 = []routing.Route{
+			route("192.168.1.0/24", "", "br-lan", 2),
+			route("172.16.0.0/12", "192.168.1.2", "br-lan", 4),
+			route("192.0.2.0/24", "", "eth1", 2),
+		}
+		reader.mu.Unlock()
+		if err := routing.NewManager(uci, reader).Collect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		ucitest.ExpectStored(t, map[string]string{
+			prefix + "IPv4ForwardingNumberOfEntries":  "4",
+			prefix + "IPv4Forwarding.1.Status":        "Error_Misconfigured",
+			prefix + "IPv4Forwarding.3.DestIPAddress": "192.0.2.0",
+			prefix + "IPv4Forwarding.4.DestIPAddress": "192.168.1.0",
+			prefix + "IPv4Forwarding.5.DestIPAddress": "172.16.0.0",
+			prefix + "IPv4Forwarding.2.Status":        "",
+		})
+	})
+}
+
+func TestSet(t *testing.T) {
+	uci, _, registry := newRegistry(t)
+	prefix := "Device.Routing.Router.1.IPv4Forwarding."
+
+	faults := registry.Set(ucitest.SetValues(
+		prefix+"1.GatewayIPAddress", "192.168.1.253",
+		prefix+"1.ForwardingMetric", "20",
+		prefix+"1.ForwardingPolicy", "100",
+		prefix+"1.DestSubnetMask", "255.255.255.0",
+		prefix+"1.Enable", "false",
+	))
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	for option, want := range map[string]string{
+		"gateway":  "192.168.1.253",
+		"metric":   "20",
+		"table":    "100",
+		"target":   "10.10.0.0",
+		"netmask":  "255.255.255.0",
+		"disabled": "1",
+	} {
+		if got := uci.Option("network", "office", option); got != want {
+			t.Errorf("%s: expected %q, got %q", option, want, got)
+		}
+	}
+	if got := uci.Count("/etc/init.d/network reload"); got != 1 {
+		t.Errorf("Expected one network reload, got %d", got)
+	}
+	ucitest.ExpectStored(t, map[string]string{prefix + "1.Status": "Disabled", prefix + "1.ForwardingPolicy": "100"})
+
+	t.Run("HostBits", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(
+			prefix+"1.ForwardingMetric", "-1",
+			prefix+"1.DestIPAddress", "10.10.0.1",
+		))
+		if len(faults) != 2 || faults[0].Code != params.FaultInternalError {
+			t.Fatalf("Expected an internal error, got %v", faults)
+		}
+		if got := uci.Option("network", "office", "metric"); got != "20" {
+			t.Errorf("Expected the request to be reverted, got metric %q", got)
+		}
+	})
+
+	t.Run("Learned", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(prefix+"2.GatewayIPAddress", "192.0.2.2"))
+		if len(faults) != 1 || faults[0].Code != params.FaultNotWritable {
+			t.Errorf("Expected a learned route to be read-only, got %v", faults)
+		}
+	})
+
+	t.Run("UnknownInstance", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(prefix+"9.Enable", "true"))
+		if len(faults) != 1 || faults[0].Code != params.FaultInvalidName {
+			t.Errorf("Expected an invalid name, got %v", faults)
+		}
+	})
+}
+
+func TestAddDeleteObject(t *testing.T) {
+	uci, reader, registry := newRegistry(t)
+	prefix := "Device.Routing.Router.1.IPv6Forwarding."
+
+	instance, fault := registry.AddObject(prefix)
+	if fault != nil {
+		t.Fatalf("AddObject failed: %v", fault)
+	}
+	if instance != 3 {
+		t.Errorf("Expected instance 3 after the learned routes, got %d", instance)
+	}
+	ucitest.ExpectStored(t, map[string]string{prefix + "3.Status": "Disabled"})
+
+	reader.mu.Lock()
+	reader.v6 = append(reader.v6, route("2001:db8:5::/48", "fd00:1::2", "br-lan", 4))
+	reader.mu.Unlock()
+	faults := registry.Set(ucitest.SetValues(
+		prefix+"3.DestIPPrefix", "2001:db8:5::/48",
+		prefix+"3.NextHop", "fd00:1::2",
+		prefix+"3.Interface", "Device.IP.Interface.1.",
+		prefix+"3.Enable", "true",
+	))
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	sections := uci.Sections("network", "route6")
+	if len(sections) != 1 {
+		t.Fatalf("Expected one route6 section, got %v", sections)
+	}
+	for option, want := range map[string]string{"target": "2001:db8:5::/48", "gateway": "fd00:1::2", "interface": "lan", "route6_instance": "3", "disabled": ""} {
+		if got := uci.Option("network", sections[0], option); got != want {
+			t.Errorf("%s: expected %q, got %q", option, want, got)
+		}
+	}
+	ucitest.ExpectStored(t, map[string]string{
+		prefix + "3.Status": "Enabled",
+		"Device.Routing.Router.1.IPv6ForwardingNumberOfEntries": "3",
+	})
+
+	if fault := registry.DeleteObject(prefix + "3."); fault != nil {
+		t.Fatalf("DeleteObject failed: %v", fault)
+	}
+	if uci.Exists("network", sections[0]) {
+		t.Error("Expected the route6 section to be deleted")
+	}
+	for _, name := range []string{prefix + "1.", "Device.Routing.Router.1.IPv4Forwarding.9."} {
+		if fault := registry.DeleteObject(name); fault == nil || fault.Code != params.FaultInvalidName {
+			t.Errorf("DeleteObject %s: expected an invalid name, got %v", name, fault)
+		}
+	}
+	if _, fault := registry.AddObject("Device.Routing.Router.2.IPv4Forwarding."); fault == nil || fault.Code != params.FaultInvalidName {
+		t.Errorf("Expected a second router to be rejected, got %v", fault)
+	}
+}
@@ -0,0 +1,354 @@
+// Package software manages TR-181 Device.SoftwareModules on OpenWrt.
+// Deployment units map to opkg packages and execution units to procd services.
+package software
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+)
+
+// Fault codes reported in DUStateChangeComplete (TR-069 Amendment 6, A.5.1)
+const (
+	FaultInternalError       = 9002
+	FaultInvalidArguments    = 9003
+	FaultDownloadFailure     = 9010
+	FaultDuplicateDU         = 9026
+	FaultUnknownDU           = 9028
+	FaultInvalidDUState      = 9029
+	FaultVersionAlreadyExist = 9032
+)
+
+// ExecEnvRef is the single execution environment exposed by the device
+const ExecEnvRef = "Device.SoftwareModules.ExecEnv.1."
+
+// uuidNamespace is the namespace used to derive stable DU UUIDs from package names
+var uuidNamespace = [16]byte{0x6b, 0xa7, 0xb8, 0x10, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// DeploymentUnit is an installed opkg package
+type DeploymentUnit struct {
+	UUID           string   // Stable RFC 4122 v5 UUID derived from the package name
+	Name           string   // Package name
+	Version        string   // Installed version
+	Status         string   // Installed, Uninstalled
+	Resolved       bool     // Whether all dependencies are satisfied
+	ExecutionUnits []string // Names of the services shipped by the package
+}
+
+// ExecutionUnit is a procd service
+type ExecutionUnit struct {
+	EUID   string // Service name, unique per device
+	Name   string // Service name
+	Status string // Active or Idle
+	PID    int    // PID of the first running instance, 0 when idle
+}
+
+// OpError carries the CWMP fault code of a failed operation
+type OpError struct {
+	Code int
+	Err  error
+}
+
+func (e *OpError) Error() string { return e.Err.Error() }
+func (e *OpError) Unwrap() error { return e.Err }
+
+func opError(code int, format string, args ...interface{}) error {
+	return &OpError{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Manager installs, updates and removes deployment units with opkg
+type Manager struct {
+	runner exec.Runner
+}
+
+// NewManager creates a Manager running opkg through runner
+func NewManager(runner exec.Runner) *Manager {
+	return &Manager{runner: runner}
+}
+
+// PackageUUID derives a stable version 5 UUID for a package name
+func PackageUUID(name string) string {
+	h := sha1.New()
+	h.Write(uuidNamespace[:])
+	h.Write([]byte(name))
+	sum := h.Sum(nil)
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// ParseListInstalled parses the "name - version" lines of opkg list-installed
+func ParseListInstalled(output string) []DeploymentUnit {
+	var units []DeploymentUnit
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), " - ", 3)
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		units = append(units, DeploymentUnit{
+			UUID:     PackageUUID(parts[0]),
+			Name:     parts[0],
+			Version:  parts[1],
+			Status:   "Installed",
+			Resolved: true,
+		})
+	}
+	return units
+}
+
+// ParseServiceList parses the JSON of ubus call service list
+func ParseServiceList(raw []byte) ([]ExecutionUnit, error) {
+	var services map[string]struct {
+		Instances map[string]struct {
+			Running bool `json:"running"`
+			PID     int  `json:"pid"`
+		} `json:"instances"`
+	}
+	if err := json.Unmarshal(raw, &services); err != nil {
+		return nil, fmt.Errorf("failed to parse service list: %w", err)
+	}
+
+	units := make([]ExecutionUnit, 0, len(services))
+	for name, service := range services {
+		unit := ExecutionUnit{EUID: name, Name: name, Status: "Idle"}
+		instances := make([]string, 0, len(service.Instances))
+		for instance := range service.Instances {
+			instances = append(instances, instance)
+		}
+		sort.Strings(instances)
+		for _, instance := range instances {
+			if service.Instances[instance].Running {
+				unit.Status = "Active"
+				unit.PID = service.Instances[instance].PID
+				break
+			}
+		}
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Name < units[j].Name })
+	return units, nil
+}
+
+// ListInstalled returns all installed packages with their services attached
+func (m *Manager) ListInstalled(ctx context.Context) ([]DeploymentUnit, error) {
+	result, err := m.runner.Execute(ctx, "opkg", "list-installed")
+	if err != nil {
+		return nil, fmt.Errorf("opkg list-installed failed: %w", err)
+	}
+	units := ParseListInstalled(string(result.Raw))
+
+	services, err := m.ListServices(ctx)
+	if err != nil {
+		// Services are optional, a device without ubus still has packages
+		return units, nil
+	}
+	for i := range units {
+		for _, service := range services {
+			if service.Name == units[i].Name {
+				units[i].ExecutionUnits = append(units[i].ExecutionUnits, service.Name)
+			}
+		}
+	}
+	return units, nil
+}
+
+// ListServices returns the procd services known to ubus
+func (m *Manager) ListServices(ctx context.Context) ([]ExecutionUnit, error) {
+	result, err := m.runner.Execute(ctx, "ubus", "call", "service", "list")
+	if err != nil {
+		return nil, fmt.Errorf("ubus call service list failed: %w", err)
+	}
+	return ParseServiceList(result.Raw)
+}
+
+// Find returns the installed deployment unit with the given UUID
+func (m *Manager) Find(ctx context.Context, uuid string) (*DeploymentUnit, error) {
+	units, err := m.ListInstalled(ctx)
+	if err != nil {
+		return nil, opError(FaultInternalError, "%v", err)
+	}
+	return findUnit(units, uuid)
+}
+
+// findUnit returns the unit of units with the given UUID
+func findUnit(units []DeploymentUnit, uuid string) (*DeploymentUnit, error) {
+	for i := range units {
+		if strings.EqualFold(units[i].UUID, uuid) {
+			return &units[i], nil
+		}
+	}
+	return nil, opError(FaultUnknownDU, "unknown deployment unit %s", uuid)
+}
+
+// checkURL refuses the URLs opkg should not be given, e.g. a value starting
+// with - that it would parse as an option
+func checkURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return opError(FaultInvalidArguments, "invalid URL %q: %v", raw, err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "ftp":
+		if parsed.Host == "" {
+			return opError(FaultInvalidArguments, "URL %q has no host", raw)
+		}
+	case "file":
+		if parsed.Path == "" {
+			return opError(FaultInvalidArguments, "URL %q has no path", raw)
+		}
+	default:
+		return opError(FaultInvalidArguments, "URL %q is not http, https, ftp or file", raw)
+	}
+	return nil
+}
+
+// Install installs the package found at url and returns the resulting unit
+func (m *Manager) Install(ctx context.Context, url string) (*DeploymentUnit, error) {
+	if err := checkURL(url); err != nil {
+		return nil, err
+	}
+	before, err := m.ListInstalled(ctx)
+	if err != nil {
+		return nil, opError(FaultInternalError, "%v", err)
+	}
+	if result, err := m.runner.Execute(ctx, "opkg", "install", url); err != nil {
+		return nil, opError(FaultDownloadFailure, "opkg install failed: %s", failureOutput(result, err))
+	}
+	after, err := m.ListInstalled(ctx)
+	if err != nil {
+		return nil, opError(FaultInternalError, "%v", err)
+	}
+	unit := changedUnit(before, after, packageNameFromURL(url))
+	if unit == nil {
+		return nil, opError(FaultDuplicateDU, "package from %s is already installed", url)
+	}
+	return unit, nil
+}
+
+// Update upgrades the unit with the given UUID, from url when provided or the
+// feeds otherwise. Like Install it compares the installed packages before and
+// after, a url holding another package fails the operation.
+func (m *Manager) Update(ctx context.Context, uuid, url string) (*DeploymentUnit, error) {
+	if url != "" {
+		if err := checkURL(url); err != nil {
+			return nil, err
+		}
+	}
+	before, err := m.ListInstalled(ctx)
+	if err != nil {
+		return nil, opError(FaultInternalError, "%v", err)
+	}
+	current, err := findUnit(before, uuid)
+	if err != nil {
+		return nil, err
+	}
+	var result *exec.CommandResult
+	if url != "" {
+		result, err = m.runner.Execute(ctx, "opkg", "install", url)
+	} else {
+		result, err = m.runner.Execute(ctx, "opkg", "upgrade", current.Name)
+	}
+	if err != nil {
+		return nil, opError(FaultDownloadFailure, "opkg update of %s failed: %s", current.Name, failureOutput(result, err))
+	}
+	after, err := m.ListInstalled(ctx)
+	if err != nil {
+		return nil, opError(FaultInternalError, "%v", err)
+	}
+	unit := changedUnit(before, after, current.Name)
+	if unit == nil {
+		return current, opError(FaultVersionAlreadyExist, "%s %s is already installed", current.Name, current.Version)
+	}
+	if unit.Name != current.Name {
+		// Name the package of the URL rather than a dependency it pulled in
+		unit = changedUnit(before, after, packageNameFromURL(url))
+		return nil, opError(FaultInvalidArguments, "%s installed %s instead of %s", url, unit.Name, current.Name)
+	}
+	return unit, nil
+}
+
+// Uninstall removes the unit with the given UUID, version must match when provided
+func (m *Manager) Uninstall(ctx context.Context, uuid, version string) (*DeploymentUnit, error) {
+	current, err := m.Find(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+	if version != "" && version != current.Version {
+		return nil, opError(FaultInvalidDUState, "%s version %s is not installed", current.Name, version)
+	}
+	if result, err := m.runner.Execute(ctx, "opkg", "remove", current.Name); err != nil {
+		return nil, opError(FaultInternalError, "opkg remove %s failed: %s", current.Name, failureOutput(result, err))
+	}
+	current.Status = "Uninstalled"
+	current.ExecutionUnits = nil
+	return current, nil
+}
+
+// DeploymentUnitRef returns the DeploymentUnit path of the named package, indexes follow units order
+func DeploymentUnitRef(units []DeploymentUnit, name string) string {
+	for i, unit := range units {
+		if unit.Name == name {
+			return fmt.Sprintf("Device.SoftwareModules.DeploymentUnit.%d.", i+1)
+		}
+	}
+	return ""
+}
+
+// ExecutionUnitRefList returns the comma separated ExecutionUnit paths of the services of unit
+func ExecutionUnitRefList(unit DeploymentUnit, services []ExecutionUnit) string {
+	refs := make([]string, 0, len(unit.ExecutionUnits))
+	for _, name := range unit.ExecutionUnits {
+		for i, service := range services {
+			if service.Name == name {
+				refs = append(refs, fmt.Sprintf("Device.SoftwareModules.ExecutionUnit.%d.", i+1))
+			}
+		}
+	}
+	return strings.Join(refs, ",")
+}
+
+// changedUnit returns the unit that is new or has a new version in after. The
+// package named in the URL wins over dependencies pulled in by the same install.
+func changedUnit(before, after []DeploymentUnit, name string) *DeploymentUnit {
+	versions := make(map[string]string, len(before))
+	for _, unit := range before {
+		versions[unit.Name] = unit.Version
+	}
+	var changed *DeploymentUnit
+	for i := range after {
+		if version, ok := versions[after[i].Name]; !ok || version != after[i].Version {
+			if after[i].Name == name {
+				return &after[i]
+			}
+			if changed == nil {
+				changed = &after[i]
+			}
+		}
+	}
+	return changed
+}
+
+// packageNameFromURL extracts the package name from name_version_arch.ipk
+func packageNameFromURL(url string) string {
+	file := url[strings.LastIndex(url, "/")+1:]
+	if !strings.HasSuffix(file, ".ipk") {
+		return file
+	}
+	if i := strings.Index(file, "_"); i > 0 {
+		return file[:i]
+	}
+	return strings.TrimSuffix(file, ".ipk")
+}
+
+func failureOutput(result *exec.CommandResult, err error) string {
+	if result != nil && strings.TrimSpace(result.Stderr) != "" {
+		return strings.TrimSpace(result.Stderr)
+	}
+	return err.Error()
+}
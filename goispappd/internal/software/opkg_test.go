@@ -0,0 +1,187 @@
+package software_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/software"
+)
+
+// fakeOpkg emulates opkg and ubus over an in-memory package list
+type fakeOpkg struct {
+	installed map[string]string
+	order     []string
+	calls     []string
+}
+
+func newFakeOpkg() *fakeOpkg {
+	f := &fakeOpkg{installed: map[string]string{}}
+	f.add("busybox", "1.36.1-1")
+	f.add("dnsmasq", "2.90-2")
+	return f
+}
+
+func (f *fakeOpkg) add(name, version string) {
+	if _, ok := f.installed[name]; !ok {
+		f.order = append(f.order, name)
+	}
+	f.installed[name] = version
+}
+
+func (f *fakeOpkg) Execute(_ context.Context, command string, args ...string) (*exec.CommandResult, error) {
+	line := strings.TrimSpace(command + " " + strings.Join(args, " "))
+	f.calls = append(f.calls, line)
+	switch {
+	case line == "opkg list-installed":
+		var b strings.Builder
+		for _, name := range f.order {
+			if version, ok := f.installed[name]; ok {
+				fmt.Fprintf(&b, "%s - %s\n", name, version)
+			}
+		}
+		return &exec.CommandResult{Raw: []byte(b.String()), Success: true}, nil
+	case line == "ubus call service list":
+		return &exec.CommandResult{Raw: []byte(`{"dnsmasq":{"instances":{"cfg01411c":{"running":true,"pid":1234}}},"htop":{}}`), Success: true}, nil
+	case strings.HasPrefix(line, "opkg install http://feed/htop_3.2.2-1_mipsel_24kc.ipk"):
+		f.add("libncurses6", "6.4-2")
+		f.add("htop", "3.2.2-1")
+		return &exec.CommandResult{Success: true}, nil
+	case line == "opkg install http://feed/dnsmasq_2.90-3_mipsel_24kc.ipk":
+		f.add("dnsmasq", "2.90-3")
+		return &exec.CommandResult{Success: true}, nil
+	case strings.HasPrefix(line, "opkg remove "):
+		delete(f.installed, args[1])
+		return &exec.CommandResult{Success: true}, nil
+	}
+	return &exec.CommandResult{Stderr: "Unknown package", ExitCode: 255}, errors.New("exit status 255")
+}
+
+func TestSoftwareModules(t *testing.T) {
+	t.Run("PackageUUID", func(t *testing.T) {
+		uuid := software.PackageUUID("dnsmasq")
+		if !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(uuid) {
+			t.Errorf("Expected a version 5 UUID, got %s", uuid)
+		}
+		if uuid != software.PackageUUID("dnsmasq") || uuid == software.PackageUUID("busybox") {
+			t.Error("Expected UUIDs to be stable and unique per package")
+		}
+	})
+
+	t.Run("ParseServiceList", func(t *testing.T) {
+		services, err := software.ParseServiceList([]byte(`{"uhttpd":{"instances":{"instance1":{"running":false},"instance2":{"running":true,"pid":42}}},"cron":{}}`))
+		if err != nil {
+			t.Fatalf("ParseServiceList failed: %v", err)
+		}
+		if len(services) != 2 || services[0].Name != "cron" || services[0].Status != "Idle" {
+			t.Fatalf("Unexpected services: %+v", services)
+		}
+		if services[1].Status != "Active" || services[1].PID != 42 {
+			t.Errorf("Expected uhttpd active with pid 42, got %+v", services[1])
+		}
+	})
+
+	t.Run("Install", func(t *testing.T) {
+		manager := software.NewManager(newFakeOpkg())
+		unit, err := manager.Install(context.Background(), "http://feed/htop_3.2.2-1_mipsel_24kc.ipk")
+		if err != nil {
+			t.Fatalf("Install failed: %v", err)
+		}
+		// The dependency is installed too, the unit reported must be the requested package
+		if unit.Name != "htop" || unit.Version != "3.2.2-1" || unit.Status != "Installed" {
+			t.Errorf("Unexpected unit: %+v", unit)
+		}
+		if len(unit.ExecutionUnits) != 1 || unit.ExecutionUnits[0] != "htop" {
+			t.Errorf("Expected htop execution unit, got %v", unit.ExecutionUnits)
+		}
+	})
+
+	t.Run("InstallFailure", func(t *testing.T) {
+		manager := software.NewManager(newFakeOpkg())
+		_, err := manager.Install(context.Background(), "http://feed/missing.ipk")
+		var opErr *software.OpError
+		if !errors.As(err, &opErr) || opErr.Code != software.FaultDownloadFailure {
+			t.Errorf("Expected download failure fault, got %v", err)
+		}
+	})
+
+	t.Run("InvalidURL", func(t *testing.T) {
+		fake := newFakeOpkg()
+		manager := software.NewManager(fake)
+		for _, url := range []string{"--force-depends", "-d /tmp", "htop.ipk", "gopher://feed/htop.ipk", "http:///htop.ipk"} {
+			_, err := manager.Install(context.Background(), url)
+			var opErr *software.OpError
+			if !errors.As(err, &opErr) || opErr.Code != software.FaultInvalidArguments {
+				t.Errorf("Install(%q): expected invalid arguments fault, got %v", url, err)
+			}
+		}
+		_, err := manager.Update(context.Background(), software.PackageUUID("dnsmasq"), "--force-reinstall")
+		var opErr *software.OpError
+		if !errors.As(err, &opErr) || opErr.Code != software.FaultInvalidArguments {
+			t.Errorf("Update: expected invalid arguments fault, got %v", err)
+		}
+		if len(fake.calls) != 0 {
+			t.Errorf("Expected opkg not to run, got %v", fake.calls)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		manager := software.NewManager(newFakeOpkg())
+		unit, err := manager.Update(context.Background(), software.PackageUUID("dnsmasq"), "http://feed/dnsmasq_2.90-3_mipsel_24kc.ipk")
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if unit.Name != "dnsmasq" || unit.Version != "2.90-3" {
+			t.Errorf("Expected dnsmasq 2.90-3, got %+v", unit)
+		}
+
+		_, err = manager.Update(context.Background(), software.PackageUUID("dnsmasq"), "http://feed/dnsmasq_2.90-3_mipsel_24kc.ipk")
+		var opErr *software.OpError
+		if !errors.As(err, &opErr) || opErr.Code != software.FaultVersionAlreadyExist {
+			t.Errorf("Expected version already exists fault, got %v", err)
+		}
+
+		// The URL holds another package than the unit updated
+		_, err = manager.Update(context.Background(), software.PackageUUID("busybox"), "http://feed/htop_3.2.2-1_mipsel_24kc.ipk")
+		if !errors.As(err, &opErr) || opErr.Code != software.FaultInvalidArguments || !strings.Contains(err.Error(), "installed htop") {
+			t.Errorf("Expected invalid arguments fault naming htop, got %v", err)
+		}
+	})
+
+	t.Run("Uninstall", func(t *testing.T) {
+		fake := newFakeOpkg()
+		manager := software.NewManager(fake)
+		unit, err := manager.Uninstall(context.Background(), software.PackageUUID("dnsmasq"), "")
+		if err != nil {
+			t.Fatalf("Uninstall failed: %v", err)
+		}
+		if unit.Status != "Uninstalled" || fake.calls[len(fake.calls)-1] != "opkg remove dnsmasq" {
+			t.Errorf("Expected dnsmasq removed, got %+v after %v", unit, fake.calls)
+		}
+
+		_, err = manager.Uninstall(context.Background(), software.PackageUUID("dnsmasq"), "")
+		var opErr *software.OpError
+		if !errors.As(err, &opErr) || opErr.Code != software.FaultUnknownDU {
+			t.Errorf("Expected unknown deployment unit fault, got %v", err)
+		}
+	})
+
+	t.Run("Refs", func(t *testing.T) {
+		manager := software.NewManager(newFakeOpkg())
+		units, err := manager.ListInstalled(context.Background())
+		if err != nil {
+			t.Fatalf("ListInstalled failed: %v", err)
+		}
+		services, _ := manager.ListServices(context.Background())
+		if ref := software.DeploymentUnitRef(units, "dnsmasq"); ref != "Device.SoftwareModules.DeploymentUnit.2." {
+			t.Errorf("Unexpected DeploymentUnitRef %s", ref)
+		}
+		if refs := software.ExecutionUnitRefList(units[1], services); refs != "Device.SoftwareModules.ExecutionUnit.1." {
+			t.Errorf("Unexpected ExecutionUnitRefList %s", refs)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+// Package store keeps the Device tree collected by the cron jobs and written
+// by diagnostics in the tr069 UCI file that GetParameterValues reads back.
+//
+// A parameter Device.<Section>.<Key> is stored as option <Key> of the config
+// section of type <Section>, e.g. Device.IP.Diagnostics.IPPing.Host is option
+// Diagnostics.IPPing.Host of section IP.
+package store
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Niceblueman/goispappd/internal/uci"
+)
+
+// Path is the UCI file holding the Device tree, tests point it to a temp file
+var Path = "/etc/config/tr069"
+
+// mu serializes the load, modify and save cycles of the writers
+var mu sync.Mutex
+
+const root = "Device"
+
+// Split maps a full parameter name to its section and option key
+func Split(name string) (section, key string, err error) {
+	rest, ok := strings.CutPrefix(name, root+".")
+	if !ok {
+		return "", "", fmt.Errorf("parameter %s is not below %s", name, root)
+	}
+	section, key, ok = strings.Cut(rest, ".")
+	if !ok || section == "" || key == "" {
+		return "", "", fmt.Errorf("parameter %s has no section", name)
+	}
+	return section, key, nil
+}
+
+// Update loads the store, lets fn modify it and saves it
+func Update(fn func(config *uci.UCIConfig) error) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_package := root
+	config, err := uci.LoadConfig(Path, &_package)
+	if err != nil {
+		return err
+	}
+	if err := fn(config); err != nil {
+		return err
+	}
+	return config.Save()
+}
+
+// Set writes parameters keyed by their full name
+func Set(values map[string]string) error {
+	return Update(func(config *uci.UCIConfig) error {
+		for name, value := range values {
+			section, key, err := Split(name)
+			if err != nil {
+				return err
+			}
+			config.Set(section, key, value, false)
+		}
+		return nil
+	})
+}
+
+// Replace removes the parameters below the prefixes, e.g. a table about to be
+// rebuilt, and writes values in the same update
+func Replace(prefixes []string, values map[string]string) error {
+	return Update(func(config *uci.UCIConfig) error {
+		for _, prefix := range prefixes {
+			section, key, err := Split(prefix)
+			if err != nil {
+				return err
+			}
+			for _, sec := range config.Sections {
+				if sec.SectionType != section {
+					continue
+				}
+				for option := range sec.Options {
+					if strings.HasPrefix(option, key) {
+						delete(sec.Options, option)
+					}
+				}
+			}
+		}
+		for name, value := range values {
+			section, key, err := Split(name)
+			if err != nil {
+				return err
+			}
+			config.Set(section, key, value, false)
+		}
+		return nil
+	})
+}
+
+// Values returns every stored parameter keyed by its full name
+func Values() (map[string]string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_package := root
+	config, err := uci.LoadConfig(Path, &_package)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, sec := range config.Sections {
+		for key, value := range sec.Options {
+			values[fmt.Sprintf("%s.%s.%s", root, sec.SectionType, key)] = value
+		}
+	}
+	return values, nil
+}
+
+// Get returns a single parameter, ok is false when it is not stored
+func Get(name string) (value string, ok bool) {
+	values, err := Values()
+	if err != nil {
+		return "", false
+	}
+	value, ok = values[name]
+	return value, ok
+}
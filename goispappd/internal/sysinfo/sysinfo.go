@@ -0,0 +1,325 @@
+// Package sysinfo reads DeviceInfo values straight from procfs, sysfs and the
+// OpenWrt release files, without spawning shell pipelines.
+package sysinfo
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reader reads system information below Root, "/" on a device and a fixture
+// directory in tests
+type Reader struct {
+	Root string
+}
+
+// NewReader creates a Reader for the filesystem mounted at root
+func NewReader(root string) *Reader {
+	if root == "" {
+		root = "/"
+	}
+	return &Reader{Root: root}
+}
+
+func (r *Reader) path(name string) string {
+	return filepath.Join(r.Root, name)
+}
+
+func (r *Reader) readTrimmed(name string) (string, error) {
+	data, err := os.ReadFile(r.path(name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// UpTime returns the seconds elapsed since boot from /proc/uptime
+func (r *Reader) UpTime() (int, error) {
+	data, err := r.readTrimmed("proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty /proc/uptime")
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid /proc/uptime: %w", err)
+	}
+	return int(seconds), nil
+}
+
+// MemoryStatus returns MemTotal and MemFree in KiB from /proc/meminfo
+func (r *Reader) MemoryStatus() (total, free int, err error) {
+	file, err := os.Open(r.path("proc/meminfo"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	found := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = value
+			found++
+		case "MemFree:":
+			free = value
+			found++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	if found < 2 {
+		return 0, 0, fmt.Errorf("MemTotal or MemFree missing from /proc/meminfo")
+	}
+	return total, free, nil
+}
+
+// cpuTimes is the aggregate cpu line of /proc/stat
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+func (r *Reader) readCPUTimes() (cpuTimes, error) {
+	file, err := os.Open(r.path("proc/stat"))
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var times cpuTimes
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return cpuTimes{}, fmt.Errorf("invalid /proc/stat: %w", err)
+			}
+			times.total += value
+			// idle and iowait
+			if i == 3 || i == 4 {
+				times.idle += value
+			}
+		}
+		return times, nil
+	}
+	return cpuTimes{}, fmt.Errorf("cpu line missing from /proc/stat")
+}
+
+// CPUSampler computes CPU usage from the /proc/stat delta between two calls,
+// so periodic collectors do not need to sleep on every sample
+type CPUSampler struct {
+	reader   *Reader
+	interval time.Duration
+	mu       sync.Mutex
+	previous *cpuTimes
+}
+
+// NewCPUSampler creates a sampler, interval is the delay between the two
+// readings taken when there is no previous sample
+func NewCPUSampler(reader *Reader, interval time.Duration) *CPUSampler {
+	return &CPUSampler{reader: reader, interval: interval}
+}
+
+// Usage returns the CPU usage in percent since the previous call
+func (s *CPUSampler) Usage() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.previous == nil {
+		first, err := s.reader.readCPUTimes()
+		if err != nil {
+			return 0, err
+		}
+		s.previous = &first
+		time.Sleep(s.interval)
+	}
+	current, err := s.reader.readCPUTimes()
+	if err != nil {
+		return 0, err
+	}
+	previous := *s.previous
+	if current.total < previous.total || current.idle < previous.idle {
+		// A CPU went offline or the counters were reset, the sample restarts
+		previous = current
+		time.Sleep(s.interval)
+		if current, err = s.reader.readCPUTimes(); err != nil {
+			s.previous = &previous
+			return 0, err
+		}
+	}
+	s.previous = &current
+
+	if current.total < previous.total || current.idle < previous.idle {
+		return 0, nil
+	}
+	total := current.total - previous.total
+	idle := current.idle - previous.idle
+	if total == 0 || idle >= total {
+		return 0, nil
+	}
+	return int(min((total-idle)*100/total, 100)), nil
+}
+
+// ManufacturerOUI returns the first three octets of the base MAC address,
+// uppercase without separators
+func (r *Reader) ManufacturerOUI() (string, error) {
+	candidates := []string{"eth0", "br-lan"}
+	if entries, err := os.ReadDir(r.path("sys/class/net")); err == nil {
+		for _, entry := range entries {
+			candidates = append(candidates, entry.Name())
+		}
+	}
+	for _, iface := range candidates {
+		if iface == "lo" {
+			continue
+		}
+		mac, err := r.readTrimmed(filepath.Join("sys/class/net", iface, "address"))
+		if err != nil || len(mac) < 8 || mac == "00:00:00:00:00:00" {
+			continue
+		}
+		return strings.ToUpper(strings.ReplaceAll(mac[:8], ":", "")), nil
+	}
+	return "", fmt.Errorf("no interface with a MAC address")
+}
+
+// InterfaceBytes returns the received and sent byte counters of a network device
+func (r *Reader) InterfaceBytes(device string) (rx, tx uint64, err error) {
+	counters := make([]uint64, 2)
+	for i, name := range []string{"rx_bytes", "tx_bytes"} {
+		value, err := r.readTrimmed(filepath.Join("sys/class/net", device, "statistics", name))
+		if err != nil {
+			return 0, 0, err
+		}
+		if counters[i], err = strconv.ParseUint(value, 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid %s of %s: %w", name, device, err)
+		}
+	}
+	return counters[0], counters[1], nil
+}
+
+// SerialNumber returns the serial from /proc/cpuinfo or the device tree
+func (r *Reader) SerialNumber() (string, error) {
+	if file, err := os.Open(r.path("proc/cpuinfo")); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if ok && strings.TrimSpace(key) == "Serial" {
+				if serial := strings.TrimSpace(value); serial != "" && strings.Trim(serial, "0") != "" {
+					return serial, nil
+				}
+			}
+		}
+	}
+	if serial, err := r.readTrimmed("proc/device-tree/serial-number"); err == nil {
+		if serial = strings.TrimRight(serial, "\x00"); serial != "" {
+			return serial, nil
+		}
+	}
+	return "", fmt.Errorf("no serial number found")
+}
+
+// Nameservers returns the nameserver addresses of /etc/resolv.conf in order
+func (r *Reader) Nameservers() ([]string, error) {
+	file, err := os.Open(r.path("etc/resolv.conf"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers, scanner.Err()
+}
+
+// ReleaseFile parses a KEY='value' file such as /etc/openwrt_release or /etc/device_info
+func (r *Reader) ReleaseFile(name string) (map[string]string, error) {
+	file, err := os.Open(r.path(name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		values[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `'"`)
+	}
+	return values, scanner.Err()
+}
+
+// ReleaseValue returns key from a release file, an error when it is missing or empty
+func (r *Reader) ReleaseValue(name, key string) (string, error) {
+	values, err := r.ReleaseFile(name)
+	if err != nil {
+		return "", err
+	}
+	if value := values[key]; value != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("%s not set in %s", key, name)
+}
+
+// SoftwareVersion returns /etc/openwrt_version, falling back to VERSION in /etc/os-release
+func (r *Reader) SoftwareVersion() (string, error) {
+	if version, err := r.readTrimmed("etc/openwrt_version"); err == nil && version != "" {
+		return version, nil
+	}
+	return r.ReleaseValue("etc/os-release", "VERSION")
+}
+
+// BoardModel returns the model name and id from /tmp/board.json
+func (r *Reader) BoardModel() (name, id string, err error) {
+	data, err := os.ReadFile(r.path("tmp/board.json"))
+	if err != nil {
+		return "", "", err
+	}
+	var board struct {
+		Model struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"model"`
+	}
+	if err := json.Unmarshal(data, &board); err != nil {
+		return "", "", fmt.Errorf("invalid board.json: %w", err)
+	}
+	return board.Model.Name, board.Model.ID, nil
+}
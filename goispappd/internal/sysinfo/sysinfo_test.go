@@ -0,0 +1,134 @@
+package sysinfo_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/sysinfo"
+)
+
+// writeFiles lays out a fake root filesystem captured from an OpenWrt router
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"proc/uptime":                            "86461.37 170033.52\n",
+		"proc/meminfo":                           "MemTotal:         124360 kB\nMemFree:           61544 kB\nMemAvailable:      52360 kB\n",
+		"proc/cpuinfo":                           "system type\t\t: MediaTek MT7621 ver:1 eco:3\nprocessor\t\t: 0\n",
+		"proc/device-tree/serial-number":         "ISP1234567\x00",
+		"sys/class/net/eth0/address":             "94:83:c4:a0:11:22\n",
+		"sys/class/net/lo/address":               "00:00:00:00:00:00\n",
+		"sys/class/net/eth0/statistics/rx_bytes": "8123456789\n",
+		"sys/class/net/eth0/statistics/tx_bytes": "1024\n",
+		"etc/openwrt_release":                    "DISTRIB_ID='OpenWrt'\nDISTRIB_RELEASE='23.05.3'\nDISTRIB_REVISION='r23809-234f1a2efa'\n",
+		"etc/openwrt_version":                    "r23809-234f1a2efa\n",
+		"etc/device_info":                        "DEVICE_MANUFACTURER='OpenWrt'\nDEVICE_MANUFACTURER_URL='https://openwrt.org/'\nDEVICE_PRODUCT='Generic'\nDEVICE_REVISION='v0'\n",
+		"etc/resolv.conf":                        "search lan\nnameserver 127.0.0.1\nnameserver ::1\n",
+		"tmp/board.json":                         `{"model": {"id": "xiaomi,mi-router-4a-gigabit", "name": "Xiaomi Mi Router 4A Gigabit Edition"}}`,
+	})
+	reader := sysinfo.NewReader(root)
+
+	if uptime, err := reader.UpTime(); err != nil || uptime != 86461 {
+		t.Errorf("Expected uptime 86461, got %d %v", uptime, err)
+	}
+	if total, free, err := reader.MemoryStatus(); err != nil || total != 124360 || free != 61544 {
+		t.Errorf("Expected 124360/61544 KiB, got %d/%d %v", total, free, err)
+	}
+	if oui, err := reader.ManufacturerOUI(); err != nil || oui != "9483C4" {
+		t.Errorf("Expected OUI 9483C4, got %q %v", oui, err)
+	}
+	if rx, tx, err := reader.InterfaceBytes("eth0"); err != nil || rx != 8123456789 || tx != 1024 {
+		t.Errorf("Expected 8123456789/1024 bytes, got %d/%d %v", rx, tx, err)
+	}
+	if _, _, err := reader.InterfaceBytes("lo"); err == nil {
+		t.Error("Expected an error for missing counters")
+	}
+	if serial, err := reader.SerialNumber(); err != nil || serial != "ISP1234567" {
+		t.Errorf("Expected serial from the device tree, got %q %v", serial, err)
+	}
+	if release, err := reader.ReleaseValue("etc/openwrt_release", "DISTRIB_RELEASE"); err != nil || release != "23.05.3" {
+		t.Errorf("Expected release 23.05.3, got %q %v", release, err)
+	}
+	if _, err := reader.ReleaseValue("etc/openwrt_release", "DISTRIB_TAINTS"); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+	if version, err := reader.SoftwareVersion(); err != nil || version != "r23809-234f1a2efa" {
+		t.Errorf("Expected openwrt_version, got %q %v", version, err)
+	}
+	if servers, err := reader.Nameservers(); err != nil || len(servers) != 2 || servers[0] != "127.0.0.1" || servers[1] != "::1" {
+		t.Errorf("Expected nameservers 127.0.0.1 and ::1, got %v %v", servers, err)
+	}
+	if name, id, err := reader.BoardModel(); err != nil || name != "Xiaomi Mi Router 4A Gigabit Edition" || id != "xiaomi,mi-router-4a-gigabit" {
+		t.Errorf("Unexpected board model %q %q %v", name, id, err)
+	}
+}
+
+func TestReaderFallbacks(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"proc/cpuinfo":                 "processor\t: 0\nSerial\t\t: 00000000a1b2c3d4\n",
+		"sys/class/net/br-lan/address": "02:11:22:33:44:55\n",
+		"etc/os-release":               "NAME=\"OpenWrt\"\nVERSION=\"23.05.3\"\n",
+	})
+	reader := sysinfo.NewReader(root)
+
+	if serial, err := reader.SerialNumber(); err != nil || serial != "00000000a1b2c3d4" {
+		t.Errorf("Expected serial from cpuinfo, got %q %v", serial, err)
+	}
+	if oui, err := reader.ManufacturerOUI(); err != nil || oui != "021122" {
+		t.Errorf("Expected OUI from br-lan, got %q %v", oui, err)
+	}
+	if version, err := reader.SoftwareVersion(); err != nil || version != "23.05.3" {
+		t.Errorf("Expected os-release version, got %q %v", version, err)
+	}
+	if _, err := reader.UpTime(); err == nil {
+		t.Error("Expected an error without /proc/uptime")
+	}
+	if _, _, err := reader.MemoryStatus(); err == nil {
+		t.Error("Expected an error without /proc/meminfo")
+	}
+}
+
+func TestCPUSampler(t *testing.T) {
+	root := t.TempDir()
+	// user nice system idle iowait irq softirq
+	writeFiles(t, root, map[string]string{"proc/stat": "cpu  100 0 100 700 100 0 0\ncpu0 100 0 100 700 100 0 0\n"})
+	sampler := sysinfo.NewCPUSampler(sysinfo.NewReader(root), time.Millisecond)
+
+	if usage, err := sampler.Usage(); err != nil || usage != 0 {
+		t.Errorf("Expected 0%% without activity, got %d %v", usage, err)
+	}
+	// 300 busy and 100 idle jiffies since the previous sample
+	writeFiles(t, root, map[string]string{"proc/stat": "cpu  250 0 250 800 100 0 0\n"})
+	if usage, err := sampler.Usage(); err != nil || usage != 75 {
+		t.Errorf("Expected 75%%, got %d %v", usage, err)
+	}
+	// A CPU went offline, its idle time left the total
+	writeFiles(t, root, map[string]string{"proc/stat": "cpu  600 0 600 600 0 0 0\n"})
+	if usage, err := sampler.Usage(); err != nil || usage != 0 {
+		t.Errorf("Expected the sample to restart at 0%%, got %d %v", usage, err)
+	}
+	writeFiles(t, root, map[string]string{"proc/stat": "cpu  700 0 700 800 0 0 0\n"})
+	if usage, err := sampler.Usage(); err != nil || usage != 50 {
+		t.Errorf("Expected 50%% after the restart, got %d %v", usage, err)
+	}
+	// The counters were reset
+	writeFiles(t, root, map[string]string{"proc/stat": "cpu  10 0 10 20 0 0 0\n"})
+	if usage, err := sampler.Usage(); err != nil || usage != 0 {
+		t.Errorf("Expected the sample to restart at 0%%, got %d %v", usage, err)
+	}
+}
@@ -0,0 +1,277 @@
+// Package tr098 presents the TR-181 parameters of the registry under the
+// TR-098 InternetGatewayDevice root for the ACS profiles that still use it.
+// Names and values are translated at the boundary by a table of rules, the
+// parameters of TR-181 without a TR-098 counterpart are not visible.
+//
+// WANIPConnection.{i} is the i-th Device.IP.Interface of the wan firewall zone
+// and WANPPPConnection.{i} is Device.PPP.Interface.{i}, under the single
+// WANDevice.1.WANConnectionDevice.1. WLANConfiguration.{i} is
+// Device.WiFi.SSID.{i} with the AccessPoint of the same instance, and the
+// radio its LowerLayers names for the radio settings, which every SSID of
+// that radio shares. LANHostConfigManagement is Device.DHCPv4.Server.Pool.1.
+package tr098
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Roots of the data models the CPE can present, see config.Configuration
+const (
+	RootDevice                = "Device"
+	RootInternetGatewayDevice = "InternetGatewayDevice"
+)
+
+const (
+	igd     = RootInternetGatewayDevice + "."
+	wlan    = igd + "LANDevice.1.WLANConfiguration."
+	wan     = igd + "WANDevice.1.WANConnectionDevice.1."
+	wanIP   = wan + "WANIPConnection."
+	wanPPP  = wan + "WANPPPConnection."
+	lanHost = igd + "LANDevice.1.LANHostConfigManagement."
+)
+
+// TR-181 names the instances are read from
+const (
+	ipInterfacePrefix = "Device.IP.Interface."
+	ssidPrefix        = "Device.WiFi.SSID."
+	radioPrefix       = "Device.WiFi.Radio."
+)
+
+// How the {i} of a rule is numbered on each side
+const (
+	// sameInstance is the same number on both sides
+	sameInstance = iota
+	// wanInstance is the position of the interface in the wan zone
+	wanInstance
+	// radioInstance is the SSID on the TR-098 side and its radio on the
+	// TR-181 one
+	radioInstance
+	// wanCount has no instance, its value is the number of wan interfaces
+	wanCount
+)
+
+// rule maps a TR-098 name to a TR-181 one, {i} matches an instance number
+type rule struct {
+	tr098, tr181 string
+	// subtree maps every name below the two objects, keeping the rest of
+	// the name as is
+	subtree bool
+	// values maps the TR-098 values whose TR-181 one differs, the others
+	// are the same
+	values map[string]string
+	// instance is how {i} is numbered, sameInstance by default
+	instance int
+}
+
+// beaconTypes are the BeaconType values of the Personal security modes
+var beaconTypes = map[string]string{
+	"None":      "None",
+	"WPA":       "WPA-Personal",
+	"11i":       "WPA2-Personal",
+	"WPAand11i": "WPA-WPA2-Personal",
+}
+
+var rules = []rule{
+	{tr098: igd + "DeviceInfo.", tr181: "Device.DeviceInfo.", subtree: true},
+	{tr098: igd + "ManagementServer.", tr181: "Device.ManagementServer.", subtree: true},
+
+	{tr098: igd + "LANDevice.1.LANWLANConfigurationNumberOfEntries", tr181: "Device.WiFi.SSIDNumberOfEntries"},
+	{tr098: wlan, tr181: "Device.WiFi.SSID."},
+	{tr098: wlan + "{i}.", tr181: "Device.WiFi.SSID.{i}."},
+	{tr098: wlan + "{i}.Enable", tr181: "Device.WiFi.SSID.{i}.Enable"},
+	{tr098: wlan + "{i}.Status", tr181: "Device.WiFi.SSID.{i}.Status", values: map[string]string{"Disabled": "Down"}},
+	{tr098: wlan + "{i}.SSID", tr181: "Device.WiFi.SSID.{i}.SSID"},
+	{tr098: wlan + "{i}.BSSID", tr181: "Device.WiFi.SSID.{i}.BSSID"},
+	{tr098: wlan + "{i}.Channel", tr181: "Device.WiFi.Radio.{i}.Channel", instance: radioInstance},
+	{tr098: wlan + "{i}.AutoChannelEnable", tr181: "Device.WiFi.Radio.{i}.AutoChannelEnable", instance: radioInstance},
+	{tr098: wlan + "{i}.SSIDAdvertisementEnabled", tr181: "Device.WiFi.AccessPoint.{i}.SSIDAdvertisementEnabled"},
+	{tr098: wlan + "{i}.BeaconType", tr181: "Device.WiFi.AccessPoint.{i}.Security.ModeEnabled", values: beaconTypes},
+	{tr098: wlan + "{i}.KeyPassphrase", tr181: "Device.WiFi.AccessPoint.{i}.Security.KeyPassphrase"},
+	{tr098: wlan + "{i}.TotalAssociations", tr181: "Device.WiFi.AccessPoint.{i}.AssociatedDeviceNumberOfEntries"},
+
+	{tr098: wan + "WANIPConnectionNumberOfEntries", tr181: "Device.IP.InterfaceNumberOfEntries", instance: wanCount},
+	{tr098: wanIP, tr181: "Device.IP.Interface."},
+	{tr098: wanIP + "{i}.", tr181: "Device.IP.Interface.{i}.", instance: wanInstance},
+	{tr098: wanIP + "{i}.Enable", tr181: "Device.IP.Interface.{i}.Enable", instance: wanInstance},
+	{tr098: wanIP + "{i}.Name", tr181: "Device.IP.Interface.{i}.Name", instance: wanInstance},
+	{tr098: wanIP + "{i}.ConnectionStatus", tr181: "Device.IP.Interface.{i}.Status", values: map[string]string{"Connected": "Up", "Disconnected": "Down"}, instance: wanInstance},
+	{tr098: wanIP + "{i}.ExternalIPAddress", tr181: "Device.IP.Interface.{i}.IPv4Address.1.IPAddress", instance: wanInstance},
+	{tr098: wanIP + "{i}.SubnetMask", tr181: "Device.IP.Interface.{i}.IPv4Address.1.SubnetMask", instance: wanInstance},
+	{tr098: wanIP + "{i}.AddressingType", tr181: "Device.IP.Interface.{i}.IPv4Address.1.AddressingType", instance: wanInstance},
+
+	{tr098: wan + "WANPPPConnectionNumberOfEntries", tr181: "Device.PPP.InterfaceNumberOfEntries"},
+	{tr098: wanPPP, tr181: "Device.PPP.Interface."},
+	{tr098: wanPPP + "{i}.", tr181: "Device.PPP.Interface.{i}."},
+	{tr098: wanPPP + "{i}.Enable", tr181: "Device.PPP.Interface.{i}.Enable"},
+	{tr098: wanPPP + "{i}.Name", tr181: "Device.PPP.Interface.{i}.Name"},
+	{tr098: wanPPP + "{i}.ConnectionStatus", tr181: "Device.PPP.Interface.{i}.ConnectionStatus"},
+	{tr098: wanPPP + "{i}.ConnectionTrigger", tr181: "Device.PPP.Interface.{i}.ConnectionTrigger"},
+	{tr098: wanPPP + "{i}.IdleDisconnectTime", tr181: "Device.PPP.Interface.{i}.IdleDisconnectTime"},
+	{tr098: wanPPP + "{i}.AutoDisconnectTime", tr181: "Device.PPP.Interface.{i}.AutoDisconnectTime"},
+	{tr098: wanPPP + "{i}.Username", tr181: "Device.PPP.Interface.{i}.Username"},
+	{tr098: wanPPP + "{i}.Password", tr181: "Device.PPP.Interface.{i}.Password"},
+	{tr098: wanPPP + "{i}.PPPoEACName", tr181: "Device.PPP.Interface.{i}.PPPoE.ACName"},
+	{tr098: wanPPP + "{i}.PPPoEServiceName", tr181: "Device.PPP.Interface.{i}.PPPoE.ServiceName"},
+	{tr098: wanPPP + "{i}.ExternalIPAddress", tr181: "Device.PPP.Interface.{i}.IPCP.LocalIPAddress"},
+	{tr098: wanPPP + "{i}.RemoteIPAddress", tr181: "Device.PPP.Interface.{i}.IPCP.RemoteIPAddress"},
+
+	{tr098: lanHost + "DHCPServerEnable", tr181: "Device.DHCPv4.Server.Pool.1.Enable"},
+	{tr098: lanHost + "MinAddress", tr181: "Device.DHCPv4.Server.Pool.1.MinAddress"},
+	{tr098: lanHost + "MaxAddress", tr181: "Device.DHCPv4.Server.Pool.1.MaxAddress"},
+	{tr098: lanHost + "SubnetMask", tr181: "Device.DHCPv4.Server.Pool.1.SubnetMask"},
+	{tr098: lanHost + "DNSServers", tr181: "Device.DHCPv4.Server.Pool.1.DNSServers"},
+	{tr098: lanHost + "DomainName", tr181: "Device.DHCPv4.Server.Pool.1.DomainName"},
+	{tr098: lanHost + "IPRouters", tr181: "Device.DHCPv4.Server.Pool.1.IPRouters"},
+	{tr098: lanHost + "DHCPLeaseTime", tr181: "Device.DHCPv4.Server.Pool.1.LeaseTime"},
+}
+
+// Mapping numbers the instances of the rules after the device: the
+// Device.IP.Interface instances of the wan zone and the radio of each SSID
+type Mapping struct {
+	wan    []string          // Interface instance of WANIPConnection.{i+1}
+	radios map[string]string // Radio instance by SSID instance
+}
+
+// NewMapping creates the Mapping of the Device.IP.Interface. references of
+// the wan zone and of the Device.WiFi.SSID.{i}.LowerLayers found in values
+func NewMapping(wan []string, values map[string]string) *Mapping {
+	m := &Mapping{radios: make(map[string]string)}
+	for _, ref := range wan {
+		if instance, ok := instanceOf(ipInterfacePrefix, ref); ok {
+			m.wan = append(m.wan, instance)
+		}
+	}
+	for name, value := range values {
+		instance, ok := strings.CutSuffix(strings.TrimPrefix(name, ssidPrefix), ".LowerLayers")
+		if !ok || !strings.HasPrefix(name, ssidPrefix) || !isInstance(instance) {
+			continue
+		}
+		// LowerLayers is a list, an SSID has a single radio below it
+		lower, _, _ := strings.Cut(value, ",")
+		if r, ok := instanceOf(radioPrefix, strings.TrimSpace(lower)); ok {
+			m.radios[instance] = r
+		}
+	}
+	return m
+}
+
+// instanceOf returns the instance number of a reference to a table instance
+func instanceOf(table, ref string) (string, bool) {
+	instance, ok := strings.CutSuffix(strings.TrimPrefix(ref, table), ".")
+	if !ok || !strings.HasPrefix(ref, table) || !isInstance(instance) {
+		return "", false
+	}
+	return instance, true
+}
+
+func isInstance(part string) bool {
+	_, err := strconv.ParseUint(part, 10, 32)
+	return err == nil
+}
+
+// ToTR181 translates a TR-098 parameter or object name and the value of the
+// parameter, ok is false when the name has no TR-181 counterpart
+func (m *Mapping) ToTR181(name, value string) (string, string, bool) {
+	for _, r := range rules {
+		instance, rest, ok := r.match(r.tr098, name)
+		if !ok {
+			continue
+		}
+		switch r.instance {
+		case wanInstance:
+			i, _ := strconv.Atoi(instance)
+			if i < 1 || i > len(m.wan) {
+				return "", "", false
+			}
+			instance = m.wan[i-1]
+		case radioInstance:
+			if instance, ok = m.radios[instance]; !ok {
+				return "", "", false
+			}
+		}
+		if mapped, ok := r.values[value]; ok {
+			value = mapped
+		}
+		return strings.Replace(r.tr181, "{i}", instance, 1) + rest, value, true
+	}
+	return "", "", false
+}
+
+// ToTR098 translates a TR-181 parameter or object name and the value of the
+// parameter. A radio parameter has a name under every WLANConfiguration on
+// the radio, the names are empty when there is no TR-098 counterpart
+func (m *Mapping) ToTR098(name, value string) ([]string, string) {
+	for _, r := range rules {
+		instance, rest, ok := r.match(r.tr181, name)
+		if !ok {
+			continue
+		}
+		var instances []string
+		switch r.instance {
+		case wanInstance:
+			for i, wan := range m.wan {
+				if wan == instance {
+					instances = append(instances, strconv.Itoa(i+1))
+				}
+			}
+		case radioInstance:
+			for ssid, radio := range m.radios {
+				if radio == instance {
+					instances = append(instances, ssid)
+				}
+			}
+			sort.Slice(instances, func(i, j int) bool {
+				a, _ := strconv.Atoi(instances[i])
+				b, _ := strconv.Atoi(instances[j])
+				return a < b
+			})
+		case wanCount:
+			instances, value = []string{""}, strconv.Itoa(len(m.wan))
+		default:
+			instances = []string{instance}
+		}
+		for tr098, tr181 := range r.values {
+			if tr181 == value {
+				value = tr098
+				break
+			}
+		}
+		names := make([]string, len(instances))
+		for i, instance := range instances {
+			names[i] = strings.Replace(r.tr098, "{i}", instance, 1) + rest
+		}
+		return names, value
+	}
+	return nil, value
+}
+
+// match returns the instance number name has where the pattern from has {i},
+// empty when it has none, and the rest of the name below a subtree
+func (r rule) match(from, name string) (instance, rest string, ok bool) {
+	patternParts := strings.Split(from, ".")
+	parts := strings.Split(name, ".")
+	if r.subtree {
+		// The pattern ends with a dot, its last part is empty
+		if len(parts) < len(patternParts) {
+			return "", "", false
+		}
+		rest = strings.Join(parts[len(patternParts)-1:], ".")
+		patternParts, parts = patternParts[:len(patternParts)-1], parts[:len(patternParts)-1]
+	} else if len(parts) != len(patternParts) {
+		return "", "", false
+	}
+
+	for i, part := range patternParts {
+		if part == "{i}" {
+			if !isInstance(parts[i]) {
+				return "", "", false
+			}
+			instance = parts[i]
+		} else if part != parts[i] {
+			return "", "", false
+		}
+	}
+	return instance, rest, true
+}
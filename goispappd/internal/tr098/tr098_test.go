@@ -0,0 +1,202 @@
+package tr098_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/tr098"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+func TestMapping(t *testing.T) {
+	const (
+		wlan  = "InternetGatewayDevice.LANDevice.1.WLANConfiguration."
+		wanIP = "InternetGatewayDevice.WANDevice.1.WANConnectionDevice.1.WANIPConnection."
+	)
+	m := tr098.NewMapping([]string{"Device.IP.Interface.2.", "Device.IP.Interface.3."}, map[string]string{
+		"Device.WiFi.SSID.1.LowerLayers": "Device.WiFi.Radio.1.",
+		"Device.WiFi.SSID.2.LowerLayers": "Device.WiFi.Radio.2.",
+		"Device.WiFi.SSID.3.LowerLayers": "Device.WiFi.Radio.1.",
+	})
+	for _, tt := range []struct {
+		tr098, tr098Value, tr181, tr181Value string
+	}{
+		{"InternetGatewayDevice.DeviceInfo.SerialNumber", "1234", "Device.DeviceInfo.SerialNumber", "1234"},
+		{wlan + "2.SSID", "office", "Device.WiFi.SSID.2.SSID", "office"},
+		{wlan + "2.Channel", "36", "Device.WiFi.Radio.2.Channel", "36"},
+		{wlan + "1.BeaconType", "11i", "Device.WiFi.AccessPoint.1.Security.ModeEnabled", "WPA2-Personal"},
+		{wanIP + "2.ExternalIPAddress", "192.0.2.20", "Device.IP.Interface.3.IPv4Address.1.IPAddress", "192.0.2.20"},
+		{wanIP + "1.ConnectionStatus", "Connected", "Device.IP.Interface.2.Status", "Up"},
+		{"InternetGatewayDevice.WANDevice.1.WANConnectionDevice.1.WANPPPConnection.1.PPPoEACName", "isp", "Device.PPP.Interface.1.PPPoE.ACName", "isp"},
+		{"InternetGatewayDevice.LANDevice.1.LANHostConfigManagement.DHCPLeaseTime", "3600", "Device.DHCPv4.Server.Pool.1.LeaseTime", "3600"},
+		{wanIP, "", "Device.IP.Interface.", ""},
+	} {
+		name, value, ok := m.ToTR181(tt.tr098, tt.tr098Value)
+		if !ok || name != tt.tr181 || value != tt.tr181Value {
+			t.Errorf("ToTR181(%s, %s) = %s, %s, %v", tt.tr098, tt.tr098Value, name, value, ok)
+		}
+		names, value := m.ToTR098(tt.tr181, tt.tr181Value)
+		if !reflect.DeepEqual(names, []string{tt.tr098}) || value != tt.tr098Value {
+			t.Errorf("ToTR098(%s, %s) = %q, %s", tt.tr181, tt.tr181Value, names, value)
+		}
+	}
+
+	// Radio 1 is below SSID 1 and 3
+	names, _ := m.ToTR098("Device.WiFi.Radio.1.Channel", "6")
+	if expected := []string{wlan + "1.Channel", wlan + "3.Channel"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %q, got %q", expected, names)
+	}
+	names, value := m.ToTR098("Device.IP.InterfaceNumberOfEntries", "3")
+	if !reflect.DeepEqual(names, []string{"InternetGatewayDevice.WANDevice.1.WANConnectionDevice.1.WANIPConnectionNumberOfEntries"}) || value != "2" {
+		t.Errorf("Expected the number of wan interfaces, got %q, %s", names, value)
+	}
+
+	for _, name := range []string{
+		"InternetGatewayDevice.LANDevice.2.WLANConfiguration.1.SSID",
+		wlan + "x.SSID",
+		wlan + "4.Channel",
+		wanIP + "3.Name",
+		"Device.WiFi.SSID.1.SSID",
+	} {
+		if _, _, ok := m.ToTR181(name, ""); ok {
+			t.Errorf("Expected %s to have no TR-181 counterpart", name)
+		}
+	}
+	for _, name := range []string{"Device.Routing.Router.1.Enable", "Device.IP.Interface.1.Name"} {
+		if names, _ := m.ToTR098(name, ""); len(names) > 0 {
+			t.Errorf("Expected %s to have no TR-098 counterpart, got %q", name, names)
+		}
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	store.Path = filepath.Join(t.TempDir(), "tr069")
+	t.Cleanup(func() { store.Path = "/etc/config/tr069" })
+	if err := store.Set(map[string]string{
+		"Device.WiFi.SSID.1.SSID":                        "home",
+		"Device.WiFi.SSID.1.LowerLayers":                 "Device.WiFi.Radio.1.",
+		"Device.WiFi.AccessPoint.1.Security.ModeEnabled": "WPA2-Personal",
+		"Device.WiFi.Radio.1.Channel":                    "6",
+	}); err != nil {
+		t.Fatalf("store.Set failed: %v", err)
+	}
+
+	var applied map[string]string
+	registry := params.NewRegistry()
+	registry.Register(&params.Object{
+		Prefix: "Device.WiFi.",
+		Params: map[string]params.Param{
+			"SSIDNumberOfEntries":                  {Type: soap.TR069TypeUnsignedInt, Default: "1"},
+			"SSID.{i}.SSID":                        {Type: soap.TR069TypeString, Writable: true},
+			"Radio.{i}.Channel":                    {Type: soap.TR069TypeUnsignedInt, Writable: true},
+			"Radio.{i}.Stats.Noise":                {Type: soap.TR069TypeInt},
+			"AccessPoint.{i}.Security.ModeEnabled": {Type: soap.TR069TypeString, Writable: true, Enum: []string{"None", "WPA2-Personal"}},
+		},
+		Apply: func(values map[string]string) error {
+			applied = values
+			return nil
+		},
+		Values: func() map[string]string {
+			return map[string]string{"Device.WiFi.Radio.1.Stats.Noise": "-92"}
+		},
+		Add: func(path string) (int, error) { return 2, nil },
+	})
+	translator := tr098.NewTranslator(registry, func() []string { return nil })
+	const wlan = "InternetGatewayDevice.LANDevice.1.WLANConfiguration."
+
+	t.Run("Get", func(t *testing.T) {
+		values, fault := translator.Get(exec.NewFixtureRunner(), []string{wlan + "1.BeaconType", wlan})
+		if fault != nil {
+			t.Fatalf("Get failed: %v", fault)
+		}
+		got := make(map[string]string)
+		var names []string
+		for _, value := range values {
+			got[value.Name] = value.Value.Content
+			names = append(names, value.Name)
+		}
+		expected := []string{wlan + "1.BeaconType", wlan + "1.BeaconType", wlan + "1.Channel", wlan + "1.SSID"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("Expected %q, got %q", expected, names)
+		}
+		if got[wlan+"1.BeaconType"] != "11i" || got[wlan+"1.SSID"] != "home" || got[wlan+"1.Channel"] != "6" {
+			t.Errorf("Unexpected values %v", got)
+		}
+		if _, fault := translator.Get(nil, []string{"Device.WiFi.SSID.1.SSID"}); fault == nil || fault.Code != params.FaultInvalidName {
+			t.Errorf("Expected fault 9005 for a TR-181 name, got %v", fault)
+		}
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		faults := translator.Set([]soap.SetParameterValueStruct{{Name: wlan + "1.BeaconType", Value: "None"}, {Name: wlan + "1.SSID", Value: "guest"}})
+		if len(faults) > 0 {
+			t.Fatalf("Set failed: %v", faults[0])
+		}
+		expected := map[string]string{"Device.WiFi.AccessPoint.1.Security.ModeEnabled": "None", "Device.WiFi.SSID.1.SSID": "guest"}
+		if !reflect.DeepEqual(applied, expected) {
+			t.Errorf("Expected %v applied, got %v", expected, applied)
+		}
+
+		faults = translator.Set([]soap.SetParameterValueStruct{{Name: wlan + "1.BeaconType", Value: "Basic"}})
+		if len(faults) != 1 || faults[0].Code != params.FaultInvalidValue || faults[0].Name != wlan+"1.BeaconType" {
+			t.Errorf("Expected fault 9007 for BeaconType, got %v", faults)
+		}
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		infos, fault := translator.Names(wlan, true)
+		if fault != nil {
+			t.Fatalf("Names failed: %v", fault)
+		}
+		expected := []soap.ParameterInfoStruct{{Name: wlan + "1.", Writable: false}}
+		if !reflect.DeepEqual(infos, expected) {
+			t.Errorf("Expected %v, got %v", expected, infos)
+		}
+
+		infos, fault = translator.Names("InternetGatewayDevice.LANDevice.1.", false)
+		if fault != nil {
+			t.Fatalf("Names failed: %v", fault)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name)
+		}
+		expectedNames := []string{
+			"InternetGatewayDevice.LANDevice.1.",
+			"InternetGatewayDevice.LANDevice.1.LANWLANConfigurationNumberOfEntries",
+			wlan, wlan + "1.", wlan + "1.BeaconType", wlan + "1.Channel", wlan + "1.SSID",
+		}
+		if !reflect.DeepEqual(names, expectedNames) {
+			t.Errorf("Expected %q, got %q", expectedNames, names)
+		}
+		// The registry adds SSIDs, WLANConfiguration is writable
+		writable := map[string]bool{wlan: true, wlan + "1.BeaconType": true, wlan + "1.Channel": true, wlan + "1.SSID": true}
+		for _, info := range infos {
+			if info.Writable != writable[info.Name] {
+				t.Errorf("Expected %s writable %v", info.Name, writable[info.Name])
+			}
+		}
+		if instance, fault := translator.AddObject(wlan); fault != nil || instance != 2 {
+			t.Errorf("Expected instance 2 added, got %d, %v", instance, fault)
+		}
+
+		if _, fault := translator.Names(wlan+"1.SSID", true); fault == nil || fault.Code != params.FaultInvalidArguments {
+			t.Errorf("Expected fault 9003 for NextLevel on a parameter, got %v", fault)
+		}
+	})
+
+	t.Run("Values", func(t *testing.T) {
+		values := translator.Values([]soap.ParameterValueStruct{
+			{Name: "Device.DeviceInfo.SerialNumber", Value: soap.Value{Type: soap.TR069TypeString, Content: "1234"}},
+			{Name: "Device.Routing.RouterNumberOfEntries", Value: soap.Value{Type: soap.TR069TypeUnsignedInt, Content: "1"}},
+		})
+		expected := []soap.ParameterValueStruct{{Name: "InternetGatewayDevice.DeviceInfo.SerialNumber", Value: soap.Value{Type: soap.TR069TypeString, Content: "1234"}}}
+		if !reflect.DeepEqual(values, expected) {
+			t.Errorf("Expected %v, got %v", expected, values)
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package tr098
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// Translator answers the parameter RPCs of a TR-098 ACS with the registry
+type Translator struct {
+	registry *params.Registry
+	wan      func() []string
+}
+
+// NewTranslator creates a Translator of the parameters of registry, wan
+// returns the Device.IP.Interface. references of the wan firewall zone
+func NewTranslator(registry *params.Registry, wan func() []string) *Translator {
+	return &Translator{registry: registry, wan: wan}
+}
+
+// mapping numbers the instances for one request. The SSID radios are read
+// from the store, without them the Mapping still has the wan interfaces
+func (t *Translator) mapping() (*Mapping, *params.Fault) {
+	var wan []string
+	if t.wan != nil {
+		wan = t.wan()
+	}
+	values, err := store.Values()
+	if err != nil {
+		return NewMapping(wan, nil), &params.Fault{Code: params.FaultInternalError, Message: err.Error()}
+	}
+	return NewMapping(wan, values), nil
+}
+
+// invalidName is the fault of the names without TR-181 counterpart
+func invalidName(name string) *params.Fault {
+	return &params.Fault{Name: name, Code: params.FaultInvalidName, Message: "Invalid parameter name"}
+}
+
+// rename reports a fault of the registry with the TR-098 name, the one
+// requested when known
+func rename(fault *params.Fault, requested map[string]string, m *Mapping) *params.Fault {
+	if name, ok := requested[fault.Name]; ok {
+		fault.Name = name
+	} else if names, _ := m.ToTR098(fault.Name, ""); len(names) > 0 {
+		fault.Name = names[0]
+	} else {
+		fault.Name = igd
+	}
+	return fault
+}
+
+// tree returns the TR-098 parameters of the registry sorted by name, and the
+// writable objects
+func (t *Translator) tree(m *Mapping) ([]soap.ParameterInfoStruct, map[string]bool, *params.Fault) {
+	infos, fault := t.registry.Names("Device.", false)
+	if fault != nil {
+		return nil, nil, fault
+	}
+	var parameters []soap.ParameterInfoStruct
+	writable := make(map[string]bool)
+	for _, info := range infos {
+		names, _ := m.ToTR098(info.Name, "")
+		for _, name := range names {
+			if strings.HasSuffix(name, ".") {
+				writable[name] = info.Writable
+				continue
+			}
+			parameters = append(parameters, soap.ParameterInfoStruct{Name: name, Writable: info.Writable})
+		}
+	}
+	sort.Slice(parameters, func(i, j int) bool { return parameters[i].Name < parameters[j].Name })
+	return parameters, writable, nil
+}
+
+// Get resolves the requested TR-098 names, a name ending with a dot returns
+// the whole subtree
+func (t *Translator) Get(runner exec.Runner, names []string) ([]soap.ParameterValueStruct, *params.Fault) {
+	m, fault := t.mapping()
+	if fault != nil {
+		return nil, fault
+	}
+	var parameters []soap.ParameterInfoStruct
+	var requested, translated []string
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".") {
+			tr181, _, ok := m.ToTR181(name, "")
+			if !ok {
+				return nil, invalidName(name)
+			}
+			requested = append(requested, name)
+			translated = append(translated, tr181)
+			continue
+		}
+		if parameters == nil {
+			var fault *params.Fault
+			if parameters, _, fault = t.tree(m); fault != nil {
+				return nil, fault
+			}
+		}
+		matched := false
+		for _, parameter := range parameters {
+			if strings.HasPrefix(parameter.Name, name) {
+				tr181, _, _ := m.ToTR181(parameter.Name, "")
+				requested = append(requested, parameter.Name)
+				translated = append(translated, tr181)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, invalidName(name)
+		}
+	}
+
+	values, fault := t.registry.Get(runner, translated)
+	if fault != nil {
+		back := make(map[string]string, len(translated))
+		for i, name := range translated {
+			back[name] = requested[i]
+		}
+		return nil, rename(fault, back, m)
+	}
+	// Every name is a parameter, the registry returns one value for each
+	for i := range values {
+		_, values[i].Value.Content = m.ToTR098(values[i].Name, values[i].Value.Content)
+		values[i].Name = requested[i]
+	}
+	return values, nil
+}
+
+// Set translates the values and applies them like the registry
+func (t *Translator) Set(values []soap.SetParameterValueStruct) []*params.Fault {
+	m, fault := t.mapping()
+	if fault != nil {
+		return []*params.Fault{fault}
+	}
+	var faults []*params.Fault
+	translated := make([]soap.SetParameterValueStruct, 0, len(values))
+	requested := make(map[string]string, len(values))
+	for _, value := range values {
+		name, content, ok := m.ToTR181(value.Name, value.Value)
+		if !ok {
+			faults = append(faults, invalidName(value.Name))
+			continue
+		}
+		requested[name] = value.Name
+		translated = append(translated, soap.SetParameterValueStruct{Name: name, Value: content})
+	}
+	if len(faults) > 0 {
+		return faults
+	}
+	faults = t.registry.Set(translated)
+	for _, fault := range faults {
+		rename(fault, requested, m)
+	}
+	return faults
+}
+
+// Names answers GetParameterNames with the TR-098 parameters and objects
+func (t *Translator) Names(path string, nextLevel bool) ([]soap.ParameterInfoStruct, *params.Fault) {
+	m, fault := t.mapping()
+	if fault != nil {
+		return nil, fault
+	}
+	parameters, writable, fault := t.tree(m)
+	if fault != nil {
+		return nil, fault
+	}
+	return params.Subtree(parameters, path, nextLevel, func(object string) bool { return writable[object] })
+}
+
+// AddObject creates an instance of the TR-098 table named by path
+func (t *Translator) AddObject(path string) (int, *params.Fault) {
+	m, fault := t.mapping()
+	if fault != nil {
+		return 0, fault
+	}
+	name, _, ok := m.ToTR181(path, "")
+	if !ok {
+		return 0, invalidName(path)
+	}
+	instance, fault := t.registry.AddObject(name)
+	if fault != nil {
+		return 0, rename(fault, map[string]string{name: path}, m)
+	}
+	return instance, nil
+}
+
+// DeleteObject removes the TR-098 table instance named by path
+func (t *Translator) DeleteObject(path string) *params.Fault {
+	m, fault := t.mapping()
+	if fault != nil {
+		return fault
+	}
+	name, _, ok := m.ToTR181(path, "")
+	if !ok {
+		return invalidName(path)
+	}
+	if fault := t.registry.DeleteObject(name); fault != nil {
+		return rename(fault, map[string]string{name: path}, m)
+	}
+	return nil
+}
+
+// Values translates the parameters of an Inform, the ones without TR-098
+// counterpart are left out. The radio parameters are left out as well when
+// the store cannot be read
+func (t *Translator) Values(values []soap.ParameterValueStruct) []soap.ParameterValueStruct {
+	m, _ := t.mapping()
+	translated := make([]soap.ParameterValueStruct, 0, len(values))
+	for _, value := range values {
+		names, content := m.ToTR098(value.Name, value.Value.Content)
+		for _, name := range names {
+			value.Name, value.Value.Content = name, content
+			translated = append(translated, value)
+		}
+	}
+	return translated
+}
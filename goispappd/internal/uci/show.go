@@ -0,0 +1,71 @@
+package uci
+
+import "strings"
+
+// ParseShow parses the output of "uci -X show <config>" into its sections.
+// uci show prints options and lists alike, so every value is kept in Lists
+// and, joined with spaces, in Options.
+func ParseShow(output string) []*Section {
+	var sections []*Section
+	byName := make(map[string]*Section)
+	for _, line := range strings.Split(output, "\n") {
+		path, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		parts := strings.SplitN(path, ".", 3)
+		switch len(parts) {
+		case 2:
+			sec := &Section{
+				SectionType: value,
+				Name:        parts[1],
+				Options:     make(map[string]string),
+				Lists:       make(map[string][]string),
+			}
+			byName[sec.Name] = sec
+			sections = append(sections, sec)
+		case 3:
+			sec := byName[parts[1]]
+			if sec == nil {
+				continue
+			}
+			items := splitShowValue(value)
+			sec.Lists[parts[2]] = items
+			sec.Options[parts[2]] = strings.Join(items, " ")
+		}
+	}
+	return sections
+}
+
+// splitShowValue splits the single quoted items of a uci show value, a quote
+// inside an item is printed as '\”
+func splitShowValue(value string) []string {
+	var items []string
+	var item strings.Builder
+	quoted, started := false, false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+			started = true
+		case c == '\\' && !quoted && i+1 < len(value):
+			i++
+			item.WriteByte(value[i])
+			started = true
+		case c == ' ' && !quoted:
+			if started {
+				items = append(items, item.String())
+				item.Reset()
+				started = false
+			}
+		default:
+			item.WriteByte(c)
+			started = true
+		}
+	}
+	if started {
+		items = append(items, item.String())
+	}
+	return items
+}
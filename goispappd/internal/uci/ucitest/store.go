@@ -0,0 +1,36 @@
+package ucitest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// UseStore points the store at a temporary file for the test
+func UseStore(t testing.TB) {
+	t.Helper()
+	store.Path = filepath.Join(t.TempDir(), "tr069")
+	t.Cleanup(func() { store.Path = "/etc/config/tr069" })
+}
+
+// SetValues builds the values of a SetParameterValues request from name and
+// value pairs
+func SetValues(pairs ...string) []soap.SetParameterValueStruct {
+	var values []soap.SetParameterValueStruct
+	for i := 0; i+1 < len(pairs); i += 2 {
+		values = append(values, soap.SetParameterValueStruct{Name: pairs[i], Value: pairs[i+1]})
+	}
+	return values
+}
+
+// ExpectStored reports the names whose stored value is not the expected one
+func ExpectStored(t testing.TB, expected map[string]string) {
+	t.Helper()
+	for name, want := range expected {
+		if got, _ := store.Get(name); got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Package ucitest provides an exec.Runner emulating uci over in-memory
+// configs for the tests of the packages writing /etc/config.
+package ucitest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+)
+
+// section is a uci section, values hold one item for options
+type section struct {
+	name, kind string
+	order      []string
+	values     map[string][]string
+}
+
+// UCI emulates uci show, set, add_list, add, reorder, delete, commit and
+// revert. Like uci the changes are staged as deltas in the save directory
+// given with -t, commit and revert only touch the deltas of their own, and
+// show reads the committed configs with them. Other commands are answered by
+// Fixtures
+type UCI struct {
+	Fixtures *exec.FixtureRunner
+
+	mu        sync.Mutex
+	committed map[string][]*section
+	deltas    []delta // Staged changes of every save directory in order
+	added     int
+	calls     []string
+}
+
+// delta is a change staged in a save directory, a set, add_list, delete or
+// reorder command line
+type delta struct {
+	saveDir, config string
+	args            []string
+}
+
+// New creates an empty UCI
+func New() *UCI {
+	return &UCI{
+		Fixtures:  exec.NewFixtureRunner(),
+		committed: map[string][]*section{},
+	}
+}
+
+// Section adds a committed section, options are name and value pairs
+func (u *UCI) Section(config, name, kind string, options ...string) *UCI {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	sec := &section{name: name, kind: kind, values: map[string][]string{}}
+	for i := 0; i+1 < len(options); i += 2 {
+		sec.order = append(sec.order, options[i])
+		sec.values[options[i]] = []string{options[i+1]}
+	}
+	u.committed[config] = append(u.committed[config], sec)
+	return u
+}
+
+// List sets a committed list of the section called name
+func (u *UCI) List(config, name, option string, items ...string) *UCI {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	sec := find(u.committed, config, name)
+	if _, exists := sec.values[option]; !exists {
+		sec.order = append(sec.order, option)
+	}
+	sec.values[option] = items
+	return u
+}
+
+// On answers a command other than uci with stdout
+func (u *UCI) On(commandLine, stdout string) *UCI {
+	u.Fixtures.On(commandLine, exec.Fixture{Stdout: stdout})
+	return u
+}
+
+// Option returns a committed value, items joined with spaces
+func (u *UCI) Option(config, name, option string) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	sec := find(u.committed, config, name)
+	if sec == nil {
+		return ""
+	}
+	return strings.Join(sec.values[option], " ")
+}
+
+// Staged returns a value with the changes of every save directory, items
+// joined with spaces
+func (u *UCI) Staged(config, name, option string) string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	sec := find(u.view(func(string) bool { return true }), config, name)
+	if sec == nil {
+		return ""
+	}
+	return strings.Join(sec.values[option], " ")
+}
+
+// Exists reports whether a committed section called name exists
+func (u *UCI) Exists(config, name string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return find(u.committed, config, name) != nil
+}
+
+// Sections returns the names of the committed sections of one type
+func (u *UCI) Sections(config, kind string) []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var names []string
+	for _, sec := range u.committed[config] {
+		if sec.kind == kind {
+			names = append(names, sec.name)
+		}
+	}
+	return names
+}
+
+// Calls returns the command lines run so far
+func (u *UCI) Calls() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.calls...)
+}
+
+// Count returns how often commandLine was run
+func (u *UCI) Count(commandLine string) int {
+	count := 0
+	for _, call := range u.Calls() {
+		if call == commandLine {
+			count++
+		}
+	}
+	return count
+}
+
+func find(configs map[string][]*section, config, name string) *section {
+	for _, sec := range configs[config] {
+		if sec.name == name {
+			return sec
+		}
+	}
+	return nil
+}
+
+func clone(configs map[string][]*section) map[string][]*section {
+	copied := make(map[string][]*section)
+	for config, sections := range configs {
+		for _, sec := range sections {
+			c := &section{name: sec.name, kind: sec.kind, order: append([]string(nil), sec.order...), values: map[string][]string{}}
+			for key, value := range sec.values {
+				c.values[key] = append([]string(nil), value...)
+			}
+			copied[config] = append(copied[config], c)
+		}
+	}
+	return copied
+}
+
+// view returns the committed configs with the deltas of the save
+// directories chosen by staged, the deltas that no longer apply are skipped
+// like uci does
+func (u *UCI) view(staged func(saveDir string) bool) map[string][]*section {
+	configs := clone(u.committed)
+	for _, d := range u.deltas {
+		if staged(d.saveDir) {
+			change(configs, d.args)
+		}
+	}
+	return configs
+}
+
+// Execute implements exec.Runner
+func (u *UCI) Execute(ctx context.Context, command string, args ...string) (*exec.CommandResult, error) {
+	line := strings.TrimSpace(command + " " + strings.Join(args, " "))
+	u.mu.Lock()
+	u.calls = append(u.calls, line)
+	u.mu.Unlock()
+	if command != "uci" {
+		return u.Fixtures.Execute(ctx, command, args...)
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ok := func(stdout string) (*exec.CommandResult, error) {
+		return &exec.CommandResult{Raw: []byte(stdout), Stdout: stdout, Success: true}, nil
+	}
+	saveDir := "/tmp/.uci"
+	for args = append([]string(nil), args...); len(args) > 0; {
+		if args[0] == "-q" {
+			args = args[1:]
+		} else if args[0] == "-t" && len(args) > 1 {
+			saveDir, args = args[1], args[2:]
+		} else {
+			break
+		}
+	}
+	if len(args) < 2 {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+	own := func(dir string) bool { return dir == saveDir }
+	switch args[0] {
+	case "-X", "show":
+		// The sections all have names, show prints them like -X show
+		if args[0] == "-X" {
+			if len(args) < 3 || args[1] != "show" {
+				return nil, fmt.Errorf("unexpected command %q", line)
+			}
+			args = args[1:]
+		}
+		var out strings.Builder
+		for _, sec := range u.view(own)[args[1]] {
+			fmt.Fprintf(&out, "%s.%s=%s\n", args[1], sec.name, sec.kind)
+			for _, key := range sec.order {
+				fmt.Fprintf(&out, "%s.%s.%s='%s'\n", args[1], sec.name, key, strings.Join(sec.values[key], "' '"))
+			}
+		}
+		return ok(out.String())
+	case "commit", "revert":
+		if args[0] == "commit" {
+			u.committed[args[1]] = u.view(own)[args[1]]
+		}
+		var kept []delta
+		for _, d := range u.deltas {
+			if d.saveDir != saveDir || d.config != args[1] {
+				kept = append(kept, d)
+			}
+		}
+		u.deltas = kept
+		return ok("")
+	case "add":
+		if len(args) < 3 {
+			return nil, fmt.Errorf("unexpected command %q", line)
+		}
+		u.added++
+		name := fmt.Sprintf("cfg%02dnew", u.added)
+		u.deltas = append(u.deltas, delta{saveDir: saveDir, config: args[1], args: []string{"set", args[1] + "." + name + "=" + args[2]}})
+		return ok(name + "\n")
+	}
+	config, _, _ := strings.Cut(args[1], ".")
+	if err := change(u.view(own), args); err != nil {
+		if errors.Is(err, errUnexpected) {
+			return nil, fmt.Errorf("unexpected command %q", line)
+		}
+		return nil, err
+	}
+	u.deltas = append(u.deltas, delta{saveDir: saveDir, config: config, args: args})
+	return ok("")
+}
+
+// errUnexpected is returned by change for the commands it does not know
+var errUnexpected = errors.New("unexpected command")
+
+// change applies a set, add_list, delete or reorder command to configs
+func change(configs map[string][]*section, args []string) error {
+	path, value, _ := strings.Cut(args[1], "=")
+	parts := strings.SplitN(path, ".", 3)
+	if len(parts) < 2 {
+		return errUnexpected
+	}
+	sec := find(configs, parts[0], parts[1])
+	if args[0] == "set" && len(parts) == 2 {
+		if sec == nil {
+			configs[parts[0]] = append(configs[parts[0]], &section{name: parts[1], kind: value, values: map[string][]string{}})
+		} else {
+			sec.kind = value
+		}
+		return nil
+	}
+	if sec == nil {
+		return fmt.Errorf("uci: Entry not found")
+	}
+	switch {
+	case args[0] == "reorder" && len(parts) == 2:
+		// The section is taken out and inserted before the one at position
+		position, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("uci: Invalid argument")
+		}
+		var kept []*section
+		for _, other := range configs[parts[0]] {
+			if other != sec {
+				kept = append(kept, other)
+			}
+		}
+		position = min(max(position, 0), len(kept))
+		configs[parts[0]] = append(kept[:position:position], append([]*section{sec}, kept[position:]...)...)
+	case args[0] == "delete" && len(parts) == 2:
+		var kept []*section
+		for _, other := range configs[parts[0]] {
+			if other != sec {
+				kept = append(kept, other)
+			}
+		}
+		configs[parts[0]] = kept
+	case args[0] == "delete":
+		if _, exists := sec.values[parts[2]]; !exists {
+			return fmt.Errorf("uci: Entry not found")
+		}
+		delete(sec.values, parts[2])
+		for i, key := range sec.order {
+			if key == parts[2] {
+				sec.order = append(sec.order[:i], sec.order[i+1:]...)
+				break
+			}
+		}
+	case (args[0] == "set" || args[0] == "add_list") && len(parts) == 3:
+		if _, exists := sec.values[parts[2]]; !exists {
+			sec.order = append(sec.order, parts[2])
+		}
+		if args[0] == "set" {
+			sec.values[parts[2]] = nil
+		}
+		sec.values[parts[2]] = append(sec.values[parts[2]], value)
+	default:
+		return errUnexpected
+	}
+	return nil
+}
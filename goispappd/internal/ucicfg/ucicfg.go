@@ -0,0 +1,154 @@
+// Package ucicfg writes the OpenWrt configs behind the Device objects with
+// uci. Every manager stages its changes in a save directory of its own, so a
+// commit carries the options it set and not those staged by other uci users,
+// and a failed request is reverted without touching the config.
+package ucicfg
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/uci"
+)
+
+// SaveDir prefixes the save directories of the managers, uci creates them on
+// the first change
+var SaveDir = "/tmp/.uci-goispappd"
+
+// Command runs command through runner and returns stdout
+func Command(ctx context.Context, runner exec.Runner, command string, args ...string) (string, error) {
+	result, err := runner.Execute(ctx, command, args...)
+	if err != nil {
+		return "", fmt.Errorf("%s %s: %w", command, strings.Join(args, " "), err)
+	}
+	return string(result.Raw), nil
+}
+
+// Show reads a config as the other uci users see it, for the configs a
+// manager only reads
+func Show(ctx context.Context, runner exec.Runner, config string) ([]*uci.Section, error) {
+	output, err := Command(ctx, runner, "uci", "-X", "show", config)
+	if err != nil {
+		return nil, err
+	}
+	return uci.ParseShow(output), nil
+}
+
+// RefInstance returns the instance number of a reference below prefix, e.g.
+// 2 for Device.IP.Interface.2.
+func RefInstance(value, prefix string) (int, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSuffix(value, "."), prefix)
+	if !ok {
+		return 0, fmt.Errorf("%q is not below %s", value, prefix)
+	}
+	return strconv.Atoi(rest)
+}
+
+// MaxInstance returns the highest instance number held by option in the
+// sections of one type
+func MaxInstance(sections []*uci.Section, sectionType, option string) int {
+	highest := 0
+	for _, sec := range sections {
+		if sec.SectionType == sectionType {
+			if index, err := strconv.Atoi(sec.Options[option]); err == nil {
+				highest = max(highest, index)
+			}
+		}
+	}
+	return highest
+}
+
+// Config stages the changes of one manager to a uci config
+type Config struct {
+	name    string
+	saveDir string
+	runner  exec.Runner
+}
+
+// New creates a Config writing the config called name through runner, owner
+// names the save directory of the manager
+func New(runner exec.Runner, name, owner string) *Config {
+	return &Config{name: name, saveDir: SaveDir + "-" + owner, runner: runner}
+}
+
+// Numbers returns a Config of the same config with a save directory of its
+// own. The managers number their sections with it, so committing the numbers
+// leaves the changes staged for a request alone
+func (c *Config) Numbers() *Config {
+	return &Config{name: c.name, saveDir: c.saveDir + "-numbers", runner: c.runner}
+}
+
+// uci runs uci on the save directory of the config
+func (c *Config) uci(ctx context.Context, args ...string) (string, error) {
+	return Command(ctx, c.runner, "uci", append([]string{"-t", c.saveDir}, args...)...)
+}
+
+// Show reads the config with the changes staged in the save directory
+func (c *Config) Show(ctx context.Context) ([]*uci.Section, error) {
+	output, err := c.uci(ctx, "-X", "show", c.name)
+	if err != nil {
+		return nil, err
+	}
+	return uci.ParseShow(output), nil
+}
+
+// Set stages one option of a section, an empty value deletes the option
+func (c *Config) Set(ctx context.Context, section, option, value string) error {
+	path := fmt.Sprintf("%s.%s.%s", c.name, section, option)
+	if value == "" {
+		// Deleting a missing option fails, there is nothing to clear then
+		c.uci(ctx, "-q", "delete", path)
+		return nil
+	}
+	_, err := c.uci(ctx, "set", path+"="+value)
+	return err
+}
+
+// SetList stages a list option as a whole, uci has no way to replace one item
+func (c *Config) SetList(ctx context.Context, section, option string, items []string) error {
+	path := fmt.Sprintf("%s.%s.%s", c.name, section, option)
+	c.uci(ctx, "-q", "delete", path)
+	for _, item := range items {
+		if _, err := c.uci(ctx, "add_list", path+"="+item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add stages a new section of type sectionType and returns its name
+func (c *Config) Add(ctx context.Context, sectionType string) (string, error) {
+	output, err := c.uci(ctx, "add", c.name, sectionType)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// Delete stages the removal of a section
+func (c *Config) Delete(ctx context.Context, section string) error {
+	_, err := c.uci(ctx, "delete", c.name+"."+section)
+	return err
+}
+
+// Reorder stages the move of a section to position among all sections
+func (c *Config) Reorder(ctx context.Context, section string, position int) error {
+	_, err := c.uci(ctx, "reorder", fmt.Sprintf("%s.%s=%d", c.name, section, position))
+	return err
+}
+
+// Commit writes the changes staged in the save directory to the config
+func (c *Config) Commit(ctx context.Context) error {
+	_, err := c.uci(ctx, "commit", c.name)
+	return err
+}
+
+// Restore discards the changes staged since the last commit, the config
+// keeps its committed values
+func (c *Config) Restore(ctx context.Context) error {
+	_, err := c.uci(ctx, "revert", c.name)
+	return err
+}
@@ -0,0 +1,112 @@
+package ucicfg_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	uci := ucitest.New().
+		Section("firewall", "defaults", "defaults", "input", "ACCEPT").
+		Section("firewall", "ssh", "rule", "name", "ssh", "dest_port", "22").
+		Section("firewall", "web", "rule", "name", "web").
+		List("firewall", "web", "proto", "tcp", "udp")
+	cfg := ucicfg.New(uci, "firewall", "test")
+	if _, err := cfg.Show(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []func() error{
+		func() error { return cfg.Set(ctx, "ssh", "dest_port", "2222") },
+		func() error { return cfg.Set(ctx, "ssh", "dest_port", "") },
+		func() error { return cfg.Set(ctx, "defaults", "forward", "REJECT") },
+		func() error { return cfg.SetList(ctx, "web", "proto", []string{"icmp"}) },
+		func() error { return cfg.Reorder(ctx, "web", 0) },
+		func() error { return cfg.Delete(ctx, "ssh") },
+		func() error {
+			section, err := cfg.Add(ctx, "rule")
+			if err == nil {
+				err = cfg.Set(ctx, section, "name", "new")
+			}
+			return err
+		},
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cfg.Restore(ctx); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if got := uci.Staged("firewall", "ssh", "dest_port"); got != "22" {
+		t.Errorf("Expected dest_port 22, got %q", got)
+	}
+	if got := uci.Staged("firewall", "defaults", "forward"); got != "" {
+		t.Errorf("Expected forward to be removed, got %q", got)
+	}
+	if got := uci.Staged("firewall", "web", "proto"); got != "tcp udp" {
+		t.Errorf("Expected the proto list back, got %q", got)
+	}
+	sections, err := cfg.Show(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, sec := range sections {
+		names = append(names, sec.Name)
+	}
+	if strings.Join(names, " ") != "defaults ssh web" {
+		t.Errorf("Expected the sections in their order, got %v", names)
+	}
+	for _, call := range uci.Calls() {
+		if !strings.HasPrefix(call, "uci -t /tmp/.uci-goispappd-test ") {
+			t.Errorf("Expected the save directory of the owner, got %q", call)
+		}
+		if strings.Contains(call, " commit ") {
+			t.Errorf("Expected Restore to leave the config alone, got %q", call)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	ctx := context.Background()
+	uci := ucitest.New().
+		Section("firewall", "ssh", "rule", "name", "ssh", "dest_port", "22")
+	cfg := ucicfg.New(uci, "firewall", "test")
+	if err := cfg.Set(ctx, "ssh", "dest_port", "2222"); err != nil {
+		t.Fatal(err)
+	}
+	numbers := cfg.Numbers()
+	if err := numbers.Set(ctx, "ssh", "fw_rule_instance", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := numbers.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := uci.Option("firewall", "ssh", "fw_rule_instance"); got != "1" {
+		t.Errorf("Expected the number to be committed, got %q", got)
+	}
+	if got := uci.Option("firewall", "ssh", "dest_port"); got != "22" {
+		t.Errorf("Expected the staged dest_port to stay staged, got %q committed", got)
+	}
+	if got := uci.Staged("firewall", "ssh", "dest_port"); got != "2222" {
+		t.Errorf("Expected dest_port 2222 staged, got %q", got)
+	}
+}
+
+func TestRefInstance(t *testing.T) {
+	if index, err := ucicfg.RefInstance("Device.IP.Interface.2.", "Device.IP.Interface."); err != nil || index != 2 {
+		t.Errorf("Expected instance 2, got %d %v", index, err)
+	}
+	if _, err := ucicfg.RefInstance("Device.PPP.Interface.2.", "Device.IP.Interface."); err == nil {
+		t.Error("Expected an error for a reference below another object")
+	}
+}
@@ -0,0 +1,401 @@
+package wifi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/store"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+	"github.com/Niceblueman/goispappd/soap"
+)
+
+// applyTimeout bounds the uci calls and the wifi reload of one request
+const applyTimeout = 30 * time.Second
+
+// wifiParams are the parameters of Device.WiFi., the read-only ones are
+// collected by internal/cron/jobs
+var wifiParams = map[string]params.Param{
+	"RadioNumberOfEntries":                              {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"SSIDNumberOfEntries":                               {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"AccessPointNumberOfEntries":                        {Type: soap.TR069TypeUnsignedInt, Default: "0"},
+	"Radio.{i}.Enable":                                  {Type: soap.TR069TypeBoolean, Writable: true},
+	"Radio.{i}.Status":                                  {Type: soap.TR069TypeString},
+	"Radio.{i}.Name":                                    {Type: soap.TR069TypeString},
+	"Radio.{i}.SupportedFrequencyBands":                 {Type: soap.TR069TypeString},
+	"Radio.{i}.OperatingFrequencyBand":                  {Type: soap.TR069TypeString},
+	"Radio.{i}.SupportedStandards":                      {Type: soap.TR069TypeString},
+	"Radio.{i}.OperatingStandards":                      {Type: soap.TR069TypeString, Writable: true, Check: checkStandards},
+	"Radio.{i}.PossibleChannels":                        {Type: soap.TR069TypeString},
+	"Radio.{i}.Channel":                                 {Type: soap.TR069TypeUnsignedInt, Writable: true, Check: params.Range(1, 255)},
+	"Radio.{i}.AutoChannelSupported":                    {Type: soap.TR069TypeBoolean},
+	"Radio.{i}.AutoChannelEnable":                       {Type: soap.TR069TypeBoolean, Writable: true},
+	"Radio.{i}.OperatingChannelBandwidth":               {Type: soap.TR069TypeString, Writable: true, Enum: []string{"20MHz", "40MHz", "80MHz", "160MHz", "320MHz"}},
+	"Radio.{i}.Stats.Noise":                             {Type: soap.TR069TypeInt},
+	"Radio.{i}.X_ISPAPP_Stats.OverallTxCCQ":             {Type: soap.TR069TypeUnsignedInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurveyNumberOfEntries":   {Type: soap.TR069TypeUnsignedInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.Frequency":    {Type: soap.TR069TypeUnsignedInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.Channel":      {Type: soap.TR069TypeUnsignedInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.InUse":        {Type: soap.TR069TypeBoolean},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.Noise":        {Type: soap.TR069TypeInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.ActiveTime":   {Type: soap.TR069TypeUnsignedInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.BusyTime":     {Type: soap.TR069TypeUnsignedInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.ReceiveTime":  {Type: soap.TR069TypeUnsignedInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.TransmitTime": {Type: soap.TR069TypeUnsignedInt},
+	"Radio.{i}.X_ISPAPP_ChannelSurvey.{i}.Utilization":  {Type: soap.TR069TypeUnsignedInt},
+	"SSID.{i}.Enable":                                   {Type: soap.TR069TypeBoolean, Writable: true},
+	"SSID.{i}.Status":                                   {Type: soap.TR069TypeString},
+	"SSID.{i}.LowerLayers":                              {Type: soap.TR069TypeString},
+	"SSID.{i}.BSSID":                                    {Type: soap.TR069TypeString},
+	"SSID.{i}.MACAddress":                               {Type: soap.TR069TypeString},
+	"SSID.{i}.SSID":                                     {Type: soap.TR069TypeString, Writable: true, Check: checkSSID},
+	"AccessPoint.{i}.Enable":                            {Type: soap.TR069TypeBoolean, Writable: true},
+	"AccessPoint.{i}.Status":                            {Type: soap.TR069TypeString},
+	"AccessPoint.{i}.SSIDReference":                     {Type: soap.TR069TypeString},
+	"AccessPoint.{i}.SSIDAdvertisementEnabled":          {Type: soap.TR069TypeBoolean, Writable: true},
+	"AccessPoint.{i}.AssociatedDeviceNumberOfEntries":   {Type: soap.TR069TypeUnsignedInt},
+	"AccessPoint.{i}.Security.ModesSupported":           {Type: soap.TR069TypeString},
+	"AccessPoint.{i}.Security.ModeEnabled":              {Type: soap.TR069TypeString, Writable: true, Enum: modeNames()},
+	"AccessPoint.{i}.Security.KeyPassphrase":            {Type: soap.TR069TypeString, Writable: true, Check: checkPassphrase},
+}
+
+// modeNames returns the writable Security.ModeEnabled values
+func modeNames() []string {
+	names := make([]string, 0, len(securityModes))
+	for mode := range securityModes {
+		names = append(names, mode)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func checkSSID(value string) error {
+	if len(value) < 1 || len(value) > 32 {
+		return fmt.Errorf("an SSID has 1 to 32 octets")
+	}
+	return nil
+}
+
+// checkPassphrase accepts a WPA passphrase of 8 to 63 printable characters
+// or a PSK of 64 hex digits
+func checkPassphrase(value string) error {
+	if len(value) == 64 {
+		for _, c := range value {
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return fmt.Errorf("a 64 character key is hex")
+			}
+		}
+		return nil
+	}
+	if len(value) < 8 || len(value) > 63 {
+		return fmt.Errorf("a passphrase has 8 to 63 characters")
+	}
+	for _, c := range value {
+		if c < 32 || c > 126 {
+			return fmt.Errorf("a passphrase is printable ASCII")
+		}
+	}
+	return nil
+}
+
+func checkStandards(value string) error {
+	for _, standard := range strings.Split(value, ",") {
+		if _, ok := standardRanks[strings.TrimSpace(standard)]; !ok {
+			return fmt.Errorf("unknown standard %q", standard)
+		}
+	}
+	return nil
+}
+
+// Register adds Device.WiFi. to registry
+func (m *Manager) Register(registry *params.Registry) {
+	registry.Register(&params.Object{
+		Prefix: Prefix,
+		Params: wifiParams,
+		Apply:  m.apply,
+		Commit: m.save,
+		Revert: m.revert,
+	})
+}
+
+// commit saves the wireless config, reloads the changed radios and stores
+// the written values
+func (m *Manager) commit(ctx context.Context) error {
+	if err := m.uci.Commit(ctx); err != nil {
+		return err
+	}
+	if _, err := ucicfg.Command(ctx, m.runner, "wifi", "reload"); err != nil {
+		return err
+	}
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	return store.Set(cfg.values())
+}
+
+// target is a table instance of a request
+type target struct {
+	table string // Radio, SSID or AccessPoint
+	index int
+}
+
+// path splits a name below Device.WiFi. into its table instance and the
+// parameter
+func path(name string) (target, string, error) {
+	table, rest, _ := strings.Cut(strings.TrimPrefix(name, Prefix), ".")
+	instance, param, ok := strings.Cut(rest, ".")
+	index, err := strconv.Atoi(instance)
+	if !ok || err != nil {
+		return target{}, "", fmt.Errorf("%w: %s", params.ErrInvalidName, name)
+	}
+	return target{table, index}, param, nil
+}
+
+// save commits the values staged by apply
+func (m *Manager) save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	return m.commit(ctx)
+}
+
+// revert discards the values staged by apply
+func (m *Manager) revert() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+	m.uci.Restore(ctx)
+}
+
+// apply stages the values of one SetParameterValues request, the registry
+// commits or reverts them with the other objects of the request
+func (m *Manager) apply(values map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), applyTimeout)
+	defer cancel()
+
+	cfg, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	changes := make(map[target]map[string]string)
+	for name, value := range values {
+		t, param, err := path(name)
+		if err != nil {
+			return err
+		}
+		if changes[t] == nil {
+			changes[t] = make(map[string]string)
+		}
+		changes[t][param] = value
+	}
+
+	targets := make([]target, 0, len(changes))
+	for t := range changes {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].table != targets[j].table {
+			return targets[i].table < targets[j].table
+		}
+		return targets[i].index < targets[j].index
+	})
+	for _, t := range targets {
+		err = fmt.Errorf("%w: %s%s.%d.", params.ErrInvalidName, Prefix, t.table, t.index)
+		switch t.table {
+		case "Radio":
+			if r := cfg.radio(t.index); r != nil {
+				err = m.applyRadio(ctx, r, changes[t])
+			}
+		case "SSID":
+			if i := cfg.ssid(t.index); i != nil {
+				err = m.applySSID(ctx, i, changes[t])
+			}
+		case "AccessPoint":
+			if i := cfg.accessPoint(t.index); i != nil {
+				err = m.applyAccessPoint(ctx, i, changes[t])
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setEnable writes an Enable parameter as the disabled option
+func (m *Manager) setEnable(ctx context.Context, section, value string) error {
+	disabled := ""
+	if !soap.BooleanValues[strings.ToLower(value)] {
+		disabled = "1"
+	}
+	return m.uci.Set(ctx, section, "disabled", disabled)
+}
+
+// applyRadio writes the changes of one radio, the channel and the htmode are
+// checked against its band
+func (m *Manager) applyRadio(ctx context.Context, r *radio, changes map[string]string) error {
+	name := fmt.Sprintf("%s%d.", radioPrefix, r.index)
+	band := Band(r.sec.Options)
+	if value, ok := changes["Enable"]; ok {
+		if err := m.setEnable(ctx, r.sec.Name, value); err != nil {
+			return err
+		}
+	}
+
+	channel, channelSet := changes["Channel"]
+	if value, ok := changes["AutoChannelEnable"]; ok {
+		auto := soap.BooleanValues[strings.ToLower(value)]
+		switch {
+		case auto && channelSet:
+			return fmt.Errorf("%w: %sChannel is chosen by the radio with AutoChannelEnable", params.ErrInvalidValue, name)
+		case auto:
+			channel, channelSet = "auto", true
+		case !channelSet:
+			// The radio keeps its configured channel, auto has none to keep
+			if _, err := strconv.Atoi(r.sec.Options["channel"]); err != nil {
+				return fmt.Errorf("%w: %sAutoChannelEnable needs a Channel", params.ErrInvalidValue, name)
+			}
+		}
+	}
+	if channelSet {
+		if number, err := strconv.Atoi(channel); err == nil {
+			limits := bandChannels[band]
+			if number < limits[0] || number > limits[1] {
+				return fmt.Errorf("%w: %sChannel %d is not in the %s band", params.ErrInvalidValue, name, number, band)
+			}
+		}
+		if err := m.uci.Set(ctx, r.sec.Name, "channel", channel); err != nil {
+			return err
+		}
+	}
+
+	standards, standardsSet := changes["OperatingStandards"]
+	bandwidth, bandwidthSet := changes["OperatingChannelBandwidth"]
+	if !standardsSet && !bandwidthSet {
+		return nil
+	}
+	family, width := splitHTMode(r.sec.Options["htmode"])
+	if standardsSet {
+		family = ""
+		for _, standard := range strings.Split(standards, ",") {
+			standard = strings.TrimSpace(standard)
+			allowed := false
+			for _, s := range bandStandards[band] {
+				allowed = allowed || s == standard
+			}
+			if !allowed {
+				return fmt.Errorf("%w: %sOperatingStandards %s is not in the %s band", params.ErrInvalidValue, name, standard, band)
+			}
+			if k := standardRanks[standard]; k > rank(family) {
+				family = families[k]
+			}
+		}
+	}
+	limit := min(familyWidths[family], bandWidths[band])
+	if bandwidthSet {
+		width, _ = strconv.Atoi(strings.TrimSuffix(bandwidth, "MHz"))
+		if width > limit {
+			return fmt.Errorf("%w: %sOperatingChannelBandwidth %s exceeds %d MHz", params.ErrInvalidValue, name, bandwidth, limit)
+		}
+	}
+	width = min(width, limit)
+	htmode := "NOHT"
+	if family != "" {
+		htmode = fmt.Sprintf("%s%d", family, width)
+	}
+	return m.uci.Set(ctx, r.sec.Name, "htmode", htmode)
+}
+
+// applySSID writes the changes of one SSID
+func (m *Manager) applySSID(ctx context.Context, i *iface, changes map[string]string) error {
+	if value, ok := changes["Enable"]; ok {
+		if err := m.setEnable(ctx, i.sec.Name, value); err != nil {
+			return err
+		}
+	}
+	if value, ok := changes["SSID"]; ok {
+		return m.uci.Set(ctx, i.sec.Name, "ssid", value)
+	}
+	return nil
+}
+
+// applyAccessPoint writes the changes of one AccessPoint, a personal mode
+// needs a passphrase
+func (m *Manager) applyAccessPoint(ctx context.Context, i *iface, changes map[string]string) error {
+	name := fmt.Sprintf("%s%d.", accessPointPrefix, i.accessPoint)
+	if value, ok := changes["Enable"]; ok {
+		if err := m.setEnable(ctx, i.sec.Name, value); err != nil {
+			return err
+		}
+	}
+	if value, ok := changes["SSIDAdvertisementEnabled"]; ok {
+		hidden := "1"
+		if soap.BooleanValues[strings.ToLower(value)] {
+			hidden = ""
+		}
+		if err := m.uci.Set(ctx, i.sec.Name, "hidden", hidden); err != nil {
+			return err
+		}
+	}
+
+	key, keySet := changes["Security.KeyPassphrase"]
+	if !keySet {
+		key = i.sec.Options["key"]
+	}
+	if mode, ok := changes["Security.ModeEnabled"]; ok {
+		encryption := securityModes[mode]
+		if strings.HasSuffix(mode, "-Personal") || strings.HasSuffix(mode, "-Personal-Transition") {
+			if checkPassphrase(key) != nil {
+				return fmt.Errorf("%w: %sSecurity.ModeEnabled %s needs a KeyPassphrase", params.ErrInvalidValue, name, mode)
+			}
+		}
+		if err := m.uci.Set(ctx, i.sec.Name, "encryption", encryption); err != nil {
+			return err
+		}
+	}
+	if keySet {
+		return m.uci.Set(ctx, i.sec.Name, "key", key)
+	}
+	return nil
+}
+
+// values returns the writable parameters as they read back from the config,
+// the passphrase is write-only and reads as an empty string
+func (cfg *config) values() map[string]string {
+	values := make(map[string]string)
+	for _, r := range cfg.radios {
+		name := fmt.Sprintf("%s%d.", radioPrefix, r.index)
+		channel, err := strconv.Atoi(r.sec.Options["channel"])
+		values[name+"Enable"] = strconv.FormatBool(r.sec.Options["disabled"] != "1")
+		values[name+"AutoChannelEnable"] = strconv.FormatBool(err != nil)
+		if err == nil {
+			values[name+"Channel"] = strconv.Itoa(channel)
+		}
+		values[name+"OperatingStandards"] = OperatingStandards(r.sec.Options)
+		values[name+"OperatingChannelBandwidth"] = OperatingChannelBandwidth(r.sec.Options)
+	}
+	for _, i := range cfg.ifaces {
+		enable := strconv.FormatBool(i.sec.Options["disabled"] != "1")
+		name := fmt.Sprintf("%s%d.", ssidPrefix, i.index)
+		values[name+"Enable"] = enable
+		values[name+"SSID"] = i.sec.Options["ssid"]
+		if i.accessPoint == 0 {
+			continue
+		}
+		name = fmt.Sprintf("%s%d.", accessPointPrefix, i.accessPoint)
+		values[name+"Enable"] = enable
+		values[name+"SSIDAdvertisementEnabled"] = strconv.FormatBool(i.sec.Options["hidden"] != "1")
+		values[name+"Security.ModeEnabled"] = SecurityMode(i.sec.Options["encryption"])
+		values[name+"Security.KeyPassphrase"] = ""
+	}
+	return values
+}
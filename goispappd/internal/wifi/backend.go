@@ -0,0 +1,218 @@
+package wifi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+)
+
+// ErrNoWiFi is returned by a Backend that cannot reach the wireless drivers,
+// e.g. because nl80211 is missing or iw is not installed
+var ErrNoWiFi = errors.New("no wireless backend")
+
+// Interface is a wireless network device of the kernel
+type Interface struct {
+	Name      string
+	Index     int    // ifindex
+	PHY       int    // wiphy index, 0 for phy0
+	MAC       string // Also the BSSID of an access point
+	Type      string // Interface type as iw prints it, e.g. AP or managed
+	SSID      string
+	Frequency int // Operating channel in MHz, 0 when down
+}
+
+// Station is a client associated with an access point, the counters are
+// seen from the access point: BytesSent went to the station
+type Station struct {
+	MAC             string
+	Authorized      bool
+	Signal          int // dBm of the last received frame
+	TxRate          int // kbit/s of the last frame sent
+	RxRate          int // kbit/s of the last frame received
+	Connected       time.Duration
+	Inactive        time.Duration
+	BytesSent       uint64
+	BytesReceived   uint64
+	PacketsSent     uint64
+	PacketsReceived uint64
+	Retries         uint64
+	Failed          uint64
+}
+
+// BSS is a network found by a scan
+type BSS struct {
+	BSSID     string
+	SSID      string
+	Frequency int    // MHz of the primary channel
+	Signal    int    // dBm
+	Standards string // e.g. a,n,ac, empty when the backend cannot tell
+	Bandwidth string // e.g. 80MHz, empty when the backend cannot tell
+}
+
+// Survey is the use of a channel measured by a radio, the times add up since
+// the radio started
+type Survey struct {
+	Frequency int  // MHz
+	Noise     int  // dBm, 0 when the driver does not measure it
+	InUse     bool // The operating channel of the radio
+	Active    time.Duration
+	Busy      time.Duration // Time the channel was sensed busy, by any station
+	Receive   time.Duration // Time the radio received
+	Transmit  time.Duration // Time the radio transmitted
+}
+
+// Utilization returns the percentage of the active time the channel was busy
+func (s Survey) Utilization() int {
+	if s.Active <= 0 {
+		return 0
+	}
+	return int(min(s.Busy*100/s.Active, 100))
+}
+
+// Backend reads the wireless interfaces of the kernel
+type Backend interface {
+	Interfaces(ctx context.Context) ([]Interface, error)
+	Stats(ctx context.Context, name string) (device.InterfaceStats, error)
+	Stations(ctx context.Context, name string) ([]Station, error)
+	Scan(ctx context.Context, name string) ([]BSS, error)
+}
+
+// Surveyor is implemented by the backends reading the channel survey of the
+// phy an interface belongs to
+type Surveyor interface {
+	Survey(ctx context.Context, name string) ([]Survey, error)
+}
+
+// Fallback is a Backend reading through the first of its backends that
+// succeeds, e.g. nl80211 and the shell tools for drivers outside mac80211
+type Fallback []Backend
+
+// first returns the result of the first backend read succeeds with, or the
+// first error that is not ErrNoWiFi
+func first[T any](backends Fallback, read func(Backend) (T, error)) (T, error) {
+	var zero T
+	failed := ErrNoWiFi
+	for _, backend := range backends {
+		result, err := read(backend)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, ErrNoWiFi) && errors.Is(failed, ErrNoWiFi) {
+			failed = err
+		}
+	}
+	return zero, failed
+}
+
+// Interfaces implements Backend, a backend listing no interface is skipped
+// as the wireless devices may be driven outside of it
+func (f Fallback) Interfaces(ctx context.Context) ([]Interface, error) {
+	return first(f, func(b Backend) ([]Interface, error) {
+		interfaces, err := b.Interfaces(ctx)
+		if err == nil && len(interfaces) == 0 {
+			err = ErrNoWiFi
+		}
+		return interfaces, err
+	})
+}
+
+// Stats implements Backend
+func (f Fallback) Stats(ctx context.Context, name string) (device.InterfaceStats, error) {
+	return first(f, func(b Backend) (device.InterfaceStats, error) { return b.Stats(ctx, name) })
+}
+
+// Stations implements Backend
+func (f Fallback) Stations(ctx context.Context, name string) ([]Station, error) {
+	return first(f, func(b Backend) ([]Station, error) { return b.Stations(ctx, name) })
+}
+
+// Scan implements Backend
+func (f Fallback) Scan(ctx context.Context, name string) ([]BSS, error) {
+	return first(f, func(b Backend) ([]BSS, error) { return b.Scan(ctx, name) })
+}
+
+// Survey implements Surveyor, the backends without survey are skipped
+func (f Fallback) Survey(ctx context.Context, name string) ([]Survey, error) {
+	return first(f, func(b Backend) ([]Survey, error) {
+		surveyor, ok := b.(Surveyor)
+		if !ok {
+			return nil, ErrNoWiFi
+		}
+		return surveyor.Survey(ctx, name)
+	})
+}
+
+// Channel returns the channel number of a frequency in MHz, 0 when it is
+// not in the 2.4, 5 or 6 GHz band
+func Channel(frequency int) int {
+	switch {
+	case frequency == 2484:
+		return 14
+	case frequency >= 2412 && frequency < 2484:
+		return (frequency - 2407) / 5
+	case frequency == 5935:
+		return 2
+	case frequency > 5950 && frequency <= 7115:
+		return (frequency - 5950) / 5
+	case frequency >= 5160 && frequency <= 5885:
+		return (frequency - 5000) / 5
+	}
+	return 0
+}
+
+// FrequencyBand returns the TR-181 band of a frequency in MHz, e.g. 5GHz
+func FrequencyBand(frequency int) string {
+	switch {
+	case frequency >= 2412 && frequency <= 2484:
+		return "2.4GHz"
+	case frequency >= 5160 && frequency <= 5885:
+		return "5GHz"
+	case frequency >= 5935 && frequency <= 7115:
+		return "6GHz"
+	}
+	return "Unknown"
+}
+
+// capabilities are the 802.11 features a BSS advertises
+type capabilities struct {
+	cck, ofdm        bool // Legacy rates of 802.11b and 802.11a/g
+	ht, vht, he, eht bool
+	width            int // Channel width in MHz, 0 when unknown
+}
+
+// bandOf returns the band key of bandStandards of a frequency in MHz
+func bandOf(frequency int) string {
+	switch FrequencyBand(frequency) {
+	case "2.4GHz":
+		return "2g"
+	case "5GHz":
+		return "5g"
+	case "6GHz":
+		return "6g"
+	}
+	return ""
+}
+
+// standards returns the standards of a BSS on frequency as the comma
+// separated TR-181 list
+func (c capabilities) standards(frequency int) string {
+	supported := map[string]bool{"a": true, "n": c.ht, "ac": c.vht, "ax": c.he, "be": c.eht}
+	// A BSS without supported rates is taken for a b/g one
+	supported["b"], supported["g"] = c.cck || !c.ofdm, c.ofdm || !c.cck
+	var standards []string
+	for _, standard := range bandStandards[bandOf(frequency)] {
+		if supported[standard] {
+			standards = append(standards, standard)
+		}
+	}
+	return strings.Join(standards, ",")
+}
+
+// bandwidth returns the channel width as the TR-181 value, e.g. 80MHz
+func (c capabilities) bandwidth() string {
+	return fmt.Sprintf("%dMHz", max(c.width, 20))
+}
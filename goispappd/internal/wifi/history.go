@@ -0,0 +1,82 @@
+package wifi
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// sample is a measurement of a station
+type sample struct {
+	at      time.Time
+	signal  int
+	sent    uint64
+	retries uint64
+}
+
+// Summary is what the History tells about a station
+type Summary struct {
+	MinSignal int // Weakest signal of the window in dBm
+	AvgSignal int // Mean signal of the window in dBm
+	Samples   int // Measurements in the window, the last included
+	// Retransmissions is the percentage of the packets sent since the
+	// previous measurement that needed a retry, from the counters of the
+	// association when there is none
+	Retransmissions int
+}
+
+// History keeps the measurements of the stations of the last window in
+// memory, by MAC address, so the signal of a client can be followed between
+// two collections
+type History struct {
+	window  time.Duration
+	mu      sync.Mutex
+	samples map[string][]sample
+}
+
+// NewHistory creates a History of the measurements of the last window
+func NewHistory(window time.Duration) *History {
+	return &History{window: window, samples: make(map[string][]sample)}
+}
+
+// Add records a measurement of station at and summarizes its window. The
+// stations not measured during the window are forgotten
+func (h *History) Add(station Station, at time.Time) Summary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	since := at.Add(-h.window)
+	for mac, samples := range h.samples {
+		if !samples[len(samples)-1].at.After(since) {
+			delete(h.samples, mac)
+		}
+	}
+
+	mac := strings.ToLower(station.MAC)
+	samples := h.samples[mac]
+	first := 0
+	for first < len(samples) && !samples[first].at.After(since) {
+		first++
+	}
+	samples = samples[first:]
+	current := sample{at: at, signal: station.Signal, sent: station.PacketsSent, retries: station.Retries}
+
+	var previous sample
+	if len(samples) > 0 && samples[len(samples)-1].sent <= current.sent {
+		// A reassociation restarts the counters, which are then used as is
+		previous = samples[len(samples)-1]
+	}
+	samples = append(samples, current)
+	h.samples[mac] = samples
+
+	summary := Summary{MinSignal: current.signal, Samples: len(samples)}
+	total := 0
+	for _, s := range samples {
+		summary.MinSignal = min(summary.MinSignal, s.signal)
+		total += s.signal
+	}
+	summary.AvgSignal = total / len(samples)
+	if sent := current.sent - previous.sent; sent > 0 && current.retries >= previous.retries {
+		summary.Retransmissions = int(min((current.retries-previous.retries)*100/sent, 100))
+	}
+	return summary
+}
@@ -0,0 +1,581 @@
+package wifi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	mdwifi "github.com/mdlayher/wifi"
+)
+
+// nl80211 values from linux/nl80211.h, spelled out so the parsing builds on
+// every platform
+const (
+	nl80211Family    = "nl80211"
+	nl80211ScanGroup = "scan"
+
+	cmdGetScan        = 32 // NL80211_CMD_GET_SCAN
+	cmdTriggerScan    = 33 // NL80211_CMD_TRIGGER_SCAN
+	cmdNewScanResults = 34 // NL80211_CMD_NEW_SCAN_RESULTS
+	cmdScanAborted    = 35 // NL80211_CMD_SCAN_ABORTED
+	cmdGetSurvey      = 50 // NL80211_CMD_GET_SURVEY
+
+	attrIfindex    = 3   // NL80211_ATTR_IFINDEX
+	attrBSS        = 47  // NL80211_ATTR_BSS
+	attrSurveyInfo = 84  // NL80211_ATTR_SURVEY_INFO
+	attrScanFlags  = 158 // NL80211_ATTR_SCAN_FLAGS
+
+	bssBSSID     = 1  // NL80211_BSS_BSSID
+	bssFrequency = 2  // NL80211_BSS_FREQUENCY
+	bssIEs       = 6  // NL80211_BSS_INFORMATION_ELEMENTS
+	bssSignalMBM = 7  // NL80211_BSS_SIGNAL_MBM, in 1/100 dBm
+	bssBeaconIEs = 11 // NL80211_BSS_BEACON_IES
+
+	surveyFrequency = 1 // NL80211_SURVEY_INFO_FREQUENCY
+	surveyNoise     = 2 // NL80211_SURVEY_INFO_NOISE, signed dBm
+	surveyInUse     = 3 // NL80211_SURVEY_INFO_IN_USE
+	surveyTime      = 4 // NL80211_SURVEY_INFO_TIME, in ms like the other times
+	surveyTimeBusy  = 5 // NL80211_SURVEY_INFO_TIME_BUSY
+	surveyTimeRx    = 7 // NL80211_SURVEY_INFO_TIME_RX
+	surveyTimeTx    = 8 // NL80211_SURVEY_INFO_TIME_TX
+
+	scanFlagAP = 4 // NL80211_SCAN_FLAG_AP
+)
+
+// sysfsNet is where the kernel lists the network devices
+const sysfsNet = "/sys/class/net"
+
+// scanTimeout bounds a scan when the context has no deadline
+const scanTimeout = 15 * time.Second
+
+// Information elements of IEEE 802.11 section 9.4.2
+const (
+	ieSSID          = 0
+	ieRates         = 1
+	ieHTCapability  = 45
+	ieExtendedRates = 50
+	ieHTOperation   = 61
+	ieVHTCapability = 191
+	ieVHTOperation  = 192
+	ieExtension     = 255
+
+	extHECapability  = 35
+	extHEOperation   = 36
+	extEHTOperation  = 106
+	extEHTCapability = 108
+)
+
+// iwTypes are the interface types as iw prints them
+var iwTypes = map[mdwifi.InterfaceType]string{
+	mdwifi.InterfaceTypeAdHoc:         "IBSS",
+	mdwifi.InterfaceTypeStation:       "managed",
+	mdwifi.InterfaceTypeAP:            "AP",
+	mdwifi.InterfaceTypeAPVLAN:        "AP/VLAN",
+	mdwifi.InterfaceTypeWDS:           "WDS",
+	mdwifi.InterfaceTypeMonitor:       "monitor",
+	mdwifi.InterfaceTypeMeshPoint:     "mesh point",
+	mdwifi.InterfaceTypeP2PClient:     "P2P-client",
+	mdwifi.InterfaceTypeP2PGroupOwner: "P2P-GO",
+	mdwifi.InterfaceTypeP2PDevice:     "P2P-device",
+	mdwifi.InterfaceTypeOCB:           "outside context of a BSS",
+	mdwifi.InterfaceTypeNAN:           "NAN",
+}
+
+// Client is the part of the nl80211 client of github.com/mdlayher/wifi the
+// NL80211 backend uses
+type Client interface {
+	Interfaces() ([]*mdwifi.Interface, error)
+	StationInfo(ifi *mdwifi.Interface) ([]*mdwifi.StationInfo, error)
+	Close() error
+}
+
+// NL80211 reads the wireless interfaces over nl80211 with
+// github.com/mdlayher/wifi and scans over generic netlink, which the library
+// has no request for. nl80211 only counts per station, the counters of an
+// interface are read from sysfs
+type NL80211 struct {
+	Dial func() (Client, error) // wifi.New of github.com/mdlayher/wifi when nil
+	FS   fs.FS                  // /sys/class/net when nil
+}
+
+// client dials nl80211
+func (b NL80211) client() (Client, error) {
+	var client Client
+	var err error
+	if b.Dial != nil {
+		client, err = b.Dial()
+	} else {
+		client, err = mdwifi.New()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoWiFi, err)
+	}
+	return client, nil
+}
+
+// find returns the interface called name with the client it was listed by
+func (b NL80211) find(name string) (Client, *mdwifi.Interface, error) {
+	client, err := b.client()
+	if err != nil {
+		return nil, nil, err
+	}
+	interfaces, err := client.Interfaces()
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("list wireless interfaces: %w", err)
+	}
+	for _, iface := range interfaces {
+		if iface.Name == name {
+			return client, iface, nil
+		}
+	}
+	client.Close()
+	return nil, nil, fmt.Errorf("%w: %s is not a nl80211 interface", ErrNoWiFi, name)
+}
+
+// Interfaces implements Backend
+func (b NL80211) Interfaces(context.Context) ([]Interface, error) {
+	client, err := b.client()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	listed, err := client.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("list wireless interfaces: %w", err)
+	}
+	var interfaces []Interface
+	for _, iface := range listed {
+		// A P2P device has no network device
+		if iface.Name == "" {
+			continue
+		}
+		interfaces = append(interfaces, Interface{
+			Name:      iface.Name,
+			Index:     iface.Index,
+			PHY:       iface.PHY,
+			MAC:       iface.HardwareAddr.String(),
+			Type:      iwTypes[iface.Type],
+			Frequency: iface.Frequency,
+		})
+	}
+	return interfaces, nil
+}
+
+// Stats implements Backend
+func (b NL80211) Stats(_ context.Context, name string) (device.InterfaceStats, error) {
+	fsys := b.FS
+	if fsys == nil {
+		fsys = os.DirFS(sysfsNet)
+	}
+	if _, err := fs.Stat(fsys, name+"/phy80211"); err != nil {
+		return device.InterfaceStats{}, fmt.Errorf("%w: %s has no phy80211", ErrNoWiFi, name)
+	}
+	counter := func(attribute string) uint64 {
+		data, _ := fs.ReadFile(fsys, name+"/statistics/"+attribute)
+		value, _ := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		return value
+	}
+	return interfaceStats(counter("tx_bytes"), counter("rx_bytes"), counter("tx_packets"), counter("rx_packets"),
+		counter("tx_errors"), counter("rx_errors"), counter("tx_dropped"), counter("rx_dropped")), nil
+}
+
+// Stations implements Backend, nl80211 lists the stations once they are
+// associated
+func (b NL80211) Stations(_ context.Context, name string) ([]Station, error) {
+	client, iface, err := b.find(name)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	listed, err := client.StationInfo(iface)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list stations of %s: %w", name, err)
+	}
+	stations := make([]Station, 0, len(listed))
+	for _, info := range listed {
+		stations = append(stations, Station{
+			MAC:             info.HardwareAddr.String(),
+			Authorized:      true,
+			Signal:          info.Signal,
+			TxRate:          info.TransmitBitrate / 1000,
+			RxRate:          info.ReceiveBitrate / 1000,
+			Connected:       info.Connected,
+			Inactive:        info.Inactive,
+			BytesSent:       uint64(info.TransmittedBytes),
+			BytesReceived:   uint64(info.ReceivedBytes),
+			PacketsSent:     uint64(info.TransmittedPackets),
+			PacketsReceived: uint64(info.ReceivedPackets),
+			Retries:         uint64(info.TransmitRetries),
+			Failed:          uint64(info.TransmitFailed),
+		})
+	}
+	return stations, nil
+}
+
+// dialFamily dials generic netlink and resolves nl80211
+func dialFamily() (*genetlink.Conn, genetlink.Family, error) {
+	conn, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, genetlink.Family{}, fmt.Errorf("%w: dial generic netlink: %v", ErrNoWiFi, err)
+	}
+	family, err := conn.GetFamily(nl80211Family)
+	if err != nil {
+		conn.Close()
+		return nil, genetlink.Family{}, fmt.Errorf("%w: %v", ErrNoWiFi, err)
+	}
+	return conn, family, nil
+}
+
+// Scan implements Backend. It triggers a scan, waits for nl80211 to announce
+// its results and dumps them. A scan already running, e.g. the one of the
+// automatic channel selection, is waited for instead
+func (b NL80211) Scan(ctx context.Context, name string) ([]BSS, error) {
+	client, iface, err := b.find(name)
+	if err != nil {
+		return nil, err
+	}
+	client.Close()
+
+	conn, family, err := dialFamily()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// The results are announced on a connection of their own, the replies of
+	// conn are matched by sequence number
+	events, _, err := dialFamily()
+	if err != nil {
+		return nil, err
+	}
+	defer events.Close()
+	joined := false
+	for _, group := range family.Groups {
+		if group.Name == nl80211ScanGroup {
+			if err := events.JoinGroup(group.ID); err != nil {
+				return nil, fmt.Errorf("join the nl80211 scan group: %w", err)
+			}
+			joined = true
+		}
+	}
+	if !joined {
+		return nil, fmt.Errorf("nl80211 has no %s group", nl80211ScanGroup)
+	}
+
+	request := func(command uint8, flags netlink.HeaderFlags, scanFlags uint32) ([]genetlink.Message, error) {
+		ae := netlink.NewAttributeEncoder()
+		ae.Uint32(attrIfindex, uint32(iface.Index))
+		if scanFlags != 0 {
+			ae.Uint32(attrScanFlags, scanFlags)
+		}
+		data, err := ae.Encode()
+		if err != nil {
+			return nil, err
+		}
+		return conn.Execute(genetlink.Message{
+			Header: genetlink.Header{Command: command, Version: family.Version},
+			Data:   data,
+		}, family.ID, netlink.Request|flags)
+	}
+
+	var scanFlags uint32
+	if iface.Type == mdwifi.InterfaceTypeAP {
+		// A beaconing interface only scans when asked to
+		scanFlags = scanFlagAP
+	}
+	if _, err := request(cmdTriggerScan, netlink.Acknowledge, scanFlags); err != nil && !errors.Is(err, syscall.EBUSY) {
+		return nil, fmt.Errorf("trigger a scan on %s: %w", name, err)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(scanTimeout)
+	}
+	if err := events.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	for done := false; !done; {
+		messages, _, err := events.Receive()
+		if err != nil {
+			return nil, fmt.Errorf("wait for the scan on %s: %w", name, err)
+		}
+		for _, message := range messages {
+			command := message.Header.Command
+			if (command != cmdNewScanResults && command != cmdScanAborted) || ifindex(message.Data) != iface.Index {
+				continue
+			}
+			if command == cmdScanAborted {
+				return nil, fmt.Errorf("scan on %s aborted", name)
+			}
+			done = true
+		}
+	}
+
+	messages, err := request(cmdGetScan, netlink.Dump, 0)
+	if err != nil {
+		return nil, fmt.Errorf("dump the scan results of %s: %w", name, err)
+	}
+	return parseScanResults(messages), nil
+}
+
+// Survey implements Surveyor with a NL80211_CMD_GET_SURVEY dump
+func (b NL80211) Survey(_ context.Context, name string) ([]Survey, error) {
+	client, iface, err := b.find(name)
+	if err != nil {
+		return nil, err
+	}
+	client.Close()
+
+	conn, family, err := dialFamily()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ae := netlink.NewAttributeEncoder()
+	ae.Uint32(attrIfindex, uint32(iface.Index))
+	data, err := ae.Encode()
+	if err != nil {
+		return nil, err
+	}
+	messages, err := conn.Execute(genetlink.Message{
+		Header: genetlink.Header{Command: cmdGetSurvey, Version: family.Version},
+		Data:   data,
+	}, family.ID, netlink.Request|netlink.Dump)
+	if err != nil {
+		return nil, fmt.Errorf("dump the survey of %s: %w", name, err)
+	}
+	return parseSurvey(messages), nil
+}
+
+// parseSurvey decodes the channels of a NL80211_CMD_GET_SURVEY dump
+func parseSurvey(messages []genetlink.Message) []Survey {
+	var surveys []Survey
+	for _, message := range messages {
+		ad, err := netlink.NewAttributeDecoder(message.Data)
+		if err != nil {
+			continue
+		}
+		for ad.Next() {
+			if ad.Type() != attrSurveyInfo {
+				continue
+			}
+			if survey, ok := parseSurveyInfo(ad.Bytes()); ok {
+				surveys = append(surveys, survey)
+			}
+		}
+	}
+	return surveys
+}
+
+// parseSurveyInfo decodes the nested attributes of NL80211_ATTR_SURVEY_INFO
+func parseSurveyInfo(data []byte) (Survey, bool) {
+	ad, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return Survey{}, false
+	}
+	var survey Survey
+	for ad.Next() {
+		switch ad.Type() {
+		case surveyFrequency:
+			survey.Frequency = int(ad.Uint32())
+		case surveyNoise:
+			survey.Noise = int(int8(ad.Uint8()))
+		case surveyInUse:
+			survey.InUse = true
+		case surveyTime:
+			survey.Active = time.Duration(ad.Uint64()) * time.Millisecond
+		case surveyTimeBusy:
+			survey.Busy = time.Duration(ad.Uint64()) * time.Millisecond
+		case surveyTimeRx:
+			survey.Receive = time.Duration(ad.Uint64()) * time.Millisecond
+		case surveyTimeTx:
+			survey.Transmit = time.Duration(ad.Uint64()) * time.Millisecond
+		}
+	}
+	if ad.Err() != nil || survey.Frequency == 0 {
+		return Survey{}, false
+	}
+	return survey, true
+}
+
+// ifindex returns the NL80211_ATTR_IFINDEX of a message, 0 when it has none
+func ifindex(data []byte) int {
+	ad, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return 0
+	}
+	for ad.Next() {
+		if ad.Type() == attrIfindex {
+			return int(ad.Uint32())
+		}
+	}
+	return 0
+}
+
+// parseScanResults decodes the BSSes of a NL80211_CMD_GET_SCAN dump
+func parseScanResults(messages []genetlink.Message) []BSS {
+	var results []BSS
+	for _, message := range messages {
+		ad, err := netlink.NewAttributeDecoder(message.Data)
+		if err != nil {
+			continue
+		}
+		for ad.Next() {
+			if ad.Type() != attrBSS {
+				continue
+			}
+			if bss, ok := parseBSS(ad.Bytes()); ok {
+				results = append(results, bss)
+			}
+		}
+	}
+	return results
+}
+
+// parseBSS decodes the nested attributes of NL80211_ATTR_BSS
+func parseBSS(data []byte) (BSS, bool) {
+	ad, err := netlink.NewAttributeDecoder(data)
+	if err != nil {
+		return BSS{}, false
+	}
+	var bss BSS
+	var ies, beaconIEs []byte
+	for ad.Next() {
+		switch ad.Type() {
+		case bssBSSID:
+			bss.BSSID = net.HardwareAddr(ad.Bytes()).String()
+		case bssFrequency:
+			bss.Frequency = int(ad.Uint32())
+		case bssSignalMBM:
+			bss.Signal = int(int32(ad.Uint32())) / 100
+		case bssIEs:
+			ies = ad.Bytes()
+		case bssBeaconIEs:
+			beaconIEs = ad.Bytes()
+		}
+	}
+	if ad.Err() != nil || bss.BSSID == "" {
+		return BSS{}, false
+	}
+	// The elements of a probe response are preferred, a passive scan only
+	// has the beacon
+	if ies == nil {
+		ies = beaconIEs
+	}
+	var caps capabilities
+	bss.SSID, caps = parseIEs(ies)
+	bss.Standards, bss.Bandwidth = caps.standards(bss.Frequency), caps.bandwidth()
+	return bss, true
+}
+
+// parseIEs returns the SSID and the capabilities advertised by information
+// elements
+func parseIEs(data []byte) (string, capabilities) {
+	var ssid string
+	var caps capabilities
+	for len(data) >= 2 {
+		id, length := data[0], int(data[1])
+		if len(data) < 2+length {
+			break
+		}
+		body := data[2 : 2+length]
+		data = data[2+length:]
+		switch id {
+		case ieSSID:
+			// A hidden network sends an empty or zeroed SSID
+			if strings.Trim(string(body), "\x00") != "" {
+				ssid = string(body)
+			}
+		case ieRates, ieExtendedRates:
+			for _, rate := range body {
+				// Rates are in 500 kbit/s, values past 54 Mbps are selectors
+				switch rate & 0x7f {
+				case 2, 4, 11, 22:
+					caps.cck = true
+				case 12, 18, 24, 36, 48, 72, 96, 108:
+					caps.ofdm = true
+				}
+			}
+		case ieHTCapability:
+			caps.ht = true
+		case ieHTOperation:
+			// A secondary channel above or below with any STA channel width
+			if len(body) >= 2 && body[1]&0x3 != 0 && body[1]&0x4 != 0 {
+				caps.width = max(caps.width, 40)
+			}
+		case ieVHTCapability:
+			caps.vht = true
+		case ieVHTOperation:
+			if len(body) >= 3 {
+				caps.width = max(caps.width, vhtWidth(body[0], body[2]))
+			}
+		case ieExtension:
+			if len(body) >= 1 {
+				caps.extension(body[0], body[1:])
+			}
+		}
+	}
+	return ssid, caps
+}
+
+// vhtWidth returns the width of a VHT operation element from its channel
+// width and second center frequency segment
+func vhtWidth(width, segment1 byte) int {
+	switch {
+	case width == 0:
+		return 0
+	case width >= 2:
+		// Deprecated 160 and 80+80 MHz signaling
+		return 160
+	case segment1 == 0:
+		return 80
+	}
+	// A second segment is the center of 160 MHz or the other 80 of 80+80
+	return 160
+}
+
+// extension reads an element extension
+func (c *capabilities) extension(id byte, body []byte) {
+	switch id {
+	case extHECapability:
+		c.he = true
+	case extEHTCapability:
+		c.eht = true
+	case extHEOperation:
+		// HE operation parameters, BSS color and basic HE-MCS set, then the
+		// optional VHT operation, co-hosted BSS and 6 GHz operation fields
+		if len(body) < 6 {
+			return
+		}
+		parameters := uint32(body[0]) | uint32(body[1])<<8 | uint32(body[2])<<16
+		offset := 6
+		if parameters&(1<<14) != 0 {
+			offset += 3
+		}
+		if parameters&(1<<15) != 0 {
+			offset++
+		}
+		if parameters&(1<<17) != 0 && len(body) >= offset+2 {
+			c.width = max(c.width, 20<<(body[offset+1]&0x3))
+		}
+	case extEHTOperation:
+		// EHT operation parameters and basic EHT-MCS set, then the optional
+		// EHT operation information starting with its channel width
+		if len(body) >= 6 && body[0]&0x1 != 0 && body[5]&0x7 <= 4 {
+			c.width = max(c.width, 20<<(body[5]&0x7))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package wifi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+)
+
+// ie builds an information element
+func ie(id byte, body ...byte) []byte {
+	return append([]byte{id, byte(len(body))}, body...)
+}
+
+// scanMessage builds a NL80211_CMD_NEW_SCAN_RESULTS message of a dump
+func scanMessage(t *testing.T, bssid []byte, frequency uint32, mbm int32, ies ...[]byte) genetlink.Message {
+	t.Helper()
+	var elements []byte
+	for _, element := range ies {
+		elements = append(elements, element...)
+	}
+	nested, err := netlink.MarshalAttributes([]netlink.Attribute{
+		{Type: bssBSSID, Data: bssid},
+		{Type: bssFrequency, Data: nlenc.Uint32Bytes(frequency)},
+		{Type: bssSignalMBM, Data: nlenc.Uint32Bytes(uint32(mbm))},
+		{Type: bssBeaconIEs, Data: elements},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := netlink.MarshalAttributes([]netlink.Attribute{
+		{Type: attrIfindex, Data: nlenc.Uint32Bytes(9)},
+		{Type: attrBSS | netlink.Nested, Data: nested},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return genetlink.Message{Header: genetlink.Header{Command: cmdNewScanResults}, Data: data}
+}
+
+func TestParseScanResults(t *testing.T) {
+	messages := []genetlink.Message{
+		// 802.11b only on channel 11 with a hidden SSID
+		scanMessage(t, []byte{0x02, 0, 0, 0, 0, 1}, 2462, -8150,
+			ie(ieSSID, 0, 0, 0, 0), ie(ieRates, 0x82, 0x84, 0x8b, 0x96)),
+		// VHT80 on channel 36
+		scanMessage(t, []byte{0x02, 0, 0, 0, 0, 2}, 5180, -6000,
+			ie(ieSSID, 'o', 'f', 'f', 'i', 'c', 'e'), ie(ieRates, 0x8c, 0x12, 0x98, 0x24),
+			ie(ieHTCapability, make([]byte, 26)...), ie(ieHTOperation, 36, 0x05, 0, 0, 0),
+			ie(ieVHTCapability, make([]byte, 12)...), ie(ieVHTOperation, 1, 42, 0, 0, 0)),
+		// HE160 on 6 GHz channel 37, the width only in the 6 GHz operation
+		scanMessage(t, []byte{0x02, 0, 0, 0, 0, 3}, 6135, -7000,
+			ie(ieSSID, 'h', 'e'), ie(ieExtension, extHECapability, 0, 0),
+			ie(ieExtension, extHEOperation, 0, 0, 0x02, 0, 0, 0, 37, 0x03, 47, 15, 0)),
+		// EHT320 on 6 GHz
+		scanMessage(t, []byte{0x02, 0, 0, 0, 0, 4}, 6195, -7500,
+			ie(ieSSID, 'b', 'e'), ie(ieExtension, extHECapability, 0, 0), ie(ieExtension, extEHTCapability, 0),
+			ie(ieExtension, extEHTOperation, 0x01, 0, 0, 0, 0, 0x04, 63, 31)),
+		// A message without BSS
+		{Header: genetlink.Header{Command: cmdNewScanResults}, Data: nlenc.Uint32Bytes(0)},
+	}
+	expected := []BSS{
+		{BSSID: "02:00:00:00:00:01", Frequency: 2462, Signal: -81, Standards: "b", Bandwidth: "20MHz"},
+		{BSSID: "02:00:00:00:00:02", SSID: "office", Frequency: 5180, Signal: -60, Standards: "a,n,ac", Bandwidth: "80MHz"},
+		{BSSID: "02:00:00:00:00:03", SSID: "he", Frequency: 6135, Signal: -70, Standards: "ax", Bandwidth: "160MHz"},
+		{BSSID: "02:00:00:00:00:04", SSID: "be", Frequency: 6195, Signal: -75, Standards: "ax,be", Bandwidth: "320MHz"},
+	}
+
+	results := parseScanResults(messages)
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("Result %d: expected %+v, got %+v", i, expected[i], results[i])
+		}
+	}
+	if got := ifindex(messages[0].Data); got != 9 {
+		t.Errorf("Expected ifindex 9, got %d", got)
+	}
+}
+
+func TestChannel(t *testing.T) {
+	for frequency, channel := range map[int]int{2412: 1, 2472: 13, 2484: 14, 5180: 36, 5825: 165, 5935: 2, 5955: 1, 6135: 37, 60480: 0} {
+		if got := Channel(frequency); got != channel {
+			t.Errorf("%d MHz: expected channel %d, got %d", frequency, channel, got)
+		}
+	}
+}
+
+func TestParseSurvey(t *testing.T) {
+	info := func(attributes ...netlink.Attribute) genetlink.Message {
+		nested, err := netlink.MarshalAttributes(attributes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := netlink.MarshalAttributes([]netlink.Attribute{
+			{Type: attrIfindex, Data: nlenc.Uint32Bytes(9)},
+			{Type: attrSurveyInfo | netlink.Nested, Data: nested},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return genetlink.Message{Header: genetlink.Header{Command: cmdGetSurvey}, Data: data}
+	}
+	messages := []genetlink.Message{
+		info(
+			netlink.Attribute{Type: surveyFrequency, Data: nlenc.Uint32Bytes(2412)},
+			netlink.Attribute{Type: surveyNoise, Data: []byte{0xa4}}, // -92 dBm
+			netlink.Attribute{Type: surveyInUse},
+			netlink.Attribute{Type: surveyTime, Data: nlenc.Uint64Bytes(1000)},
+			netlink.Attribute{Type: surveyTimeBusy, Data: nlenc.Uint64Bytes(250)},
+			netlink.Attribute{Type: surveyTimeRx, Data: nlenc.Uint64Bytes(200)},
+			netlink.Attribute{Type: surveyTimeTx, Data: nlenc.Uint64Bytes(30)},
+		),
+		// A channel the radio never dwelled on
+		info(netlink.Attribute{Type: surveyFrequency, Data: nlenc.Uint32Bytes(2417)}),
+		// An entry without frequency is skipped
+		info(netlink.Attribute{Type: surveyNoise, Data: []byte{0xa4}}),
+	}
+	expected := []Survey{
+		{Frequency: 2412, Noise: -92, InUse: true, Active: time.Second, Busy: 250 * time.Millisecond,
+			Receive: 200 * time.Millisecond, Transmit: 30 * time.Millisecond},
+		{Frequency: 2417},
+	}
+
+	surveys := parseSurvey(messages)
+	if len(surveys) != len(expected) || surveys[0] != expected[0] || surveys[1] != expected[1] {
+		t.Errorf("Expected %+v, got %+v", expected, surveys)
+	}
+	if got := surveys[0].Utilization(); got != 25 {
+		t.Errorf("Expected 25%% utilization, got %d", got)
+	}
+	if got := surveys[1].Utilization(); got != 0 {
+		t.Errorf("Expected no utilization without active time, got %d", got)
+	}
+}
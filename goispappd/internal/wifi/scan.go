@@ -0,0 +1,135 @@
+package wifi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Niceblueman/goispappd/device"
+)
+
+// defaultNoise is the Noise of a neighbour in dBm, the scans do not measure
+// the noise floor
+const defaultNoise = -95
+
+// Scan scans the neighbouring networks of every enabled radio on its own
+// band. A network heard by several radios is reported once with its
+// strongest signal, the strongest first
+func (m *Manager) Scan(ctx context.Context) ([]device.NeighboringWiFiResult, error) {
+	m.mu.Lock()
+	cfg, err := m.load(ctx)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	kernel, err := m.backend.Interfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]device.NeighboringWiFiResult)
+	var failed error
+	scanned := 0
+	used := make(map[int]bool) // PHYs scanned by an earlier radio
+	for _, r := range cfg.radios {
+		if r.sec.Options["disabled"] == "1" {
+			continue
+		}
+		k := cfg.radioInterface(r, kernel, used)
+		if k.Name == "" {
+			continue
+		}
+		networks, err := m.backend.Scan(ctx, k.Name)
+		if err != nil {
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		scanned++
+		band := Band(r.sec.Options)
+		for _, bss := range networks {
+			// A radio driving several bands only reports its own
+			if bandOf(bss.Frequency) != band {
+				continue
+			}
+			if seen, ok := found[bss.BSSID]; ok && seen.SignalStrength >= bss.Signal {
+				continue
+			}
+			found[bss.BSSID] = neighbour(r, bss)
+		}
+	}
+	if scanned == 0 {
+		if failed == nil {
+			failed = fmt.Errorf("%w: no radio to scan with", ErrNoWiFi)
+		}
+		return nil, failed
+	}
+
+	results := make([]device.NeighboringWiFiResult, 0, len(found))
+	for _, result := range found {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].SignalStrength != results[j].SignalStrength {
+			return results[i].SignalStrength > results[j].SignalStrength
+		}
+		return results[i].BSSID < results[j].BSSID
+	})
+	return results, nil
+}
+
+// neighbour returns the result of a network r found
+func neighbour(r *radio, bss BSS) device.NeighboringWiFiResult {
+	result := device.NeighboringWiFiResult{
+		Radio:                     fmt.Sprintf("%s%d.", radioPrefix, r.index),
+		SSID:                      bss.SSID,
+		BSSID:                     bss.BSSID,
+		Channel:                   Channel(bss.Frequency),
+		SignalStrength:            bss.Signal,
+		OperatingFrequencyBand:    FrequencyBand(bss.Frequency),
+		OperatingChannelBandwidth: bss.Bandwidth,
+		Noise:                     defaultNoise,
+	}
+	if bss.Standards != "" {
+		result.OperatingStandards = strings.Split(bss.Standards, ",")
+	}
+	return result
+}
+
+// radioInterface returns the kernel interface r scans and surveys with, one
+// without Name when r has none. It is the ifname of a wifi-iface of r, else
+// an interface of the phy numbered like r as netifd names them, e.g. phy1-ap0
+// of radio1, else one of a phy operating in the band of r. used holds the
+// PHYs of the radios already handled, the chosen one is added
+func (cfg *config) radioInterface(r *radio, kernel []Interface, used map[int]bool) Interface {
+	band := Band(r.sec.Options)
+	candidates := make([]func(Interface) bool, 0, 3)
+	ifnames := make(map[string]bool)
+	for _, i := range cfg.ifaces {
+		if i.sec.Options["device"] == r.sec.Name && i.sec.Options["ifname"] != "" {
+			ifnames[i.sec.Options["ifname"]] = true
+		}
+	}
+	candidates = append(candidates, func(k Interface) bool { return ifnames[k.Name] })
+	if number, ok := strings.CutPrefix(r.sec.Name, "radio"); ok {
+		if phy, err := strconv.Atoi(number); err == nil {
+			candidates = append(candidates, func(k Interface) bool {
+				return k.PHY == phy && (k.Frequency == 0 || bandOf(k.Frequency) == band)
+			})
+		}
+	}
+	candidates = append(candidates, func(k Interface) bool { return bandOf(k.Frequency) == band })
+
+	for _, matches := range candidates {
+		for _, k := range kernel {
+			if !used[k.PHY] && matches(k) {
+				used[k.PHY] = true
+				return k
+			}
+		}
+	}
+	return Interface{}
+}
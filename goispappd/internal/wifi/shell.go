@@ -0,0 +1,308 @@
+package wifi
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// Shell reads the wireless interfaces with iw, /proc/net/dev and wlanconfig,
+// the fallback for drivers nl80211 does not cover
+type Shell struct {
+	Runner exec.Runner
+}
+
+var (
+	// iwPHY is a phy line of iw dev, e.g. phy#0
+	iwPHY = regexp.MustCompile(`^phy#(\d+)$`)
+	// iwChannel is the channel line of an interface of iw dev
+	iwChannel = regexp.MustCompile(`^channel \d+ \((\d+) MHz\)`)
+	// iwBSS starts a BSS of iw scan, e.g. BSS 94:83:c4:a0:11:22(on phy0-ap0)
+	iwBSS = regexp.MustCompile(`^BSS ([0-9a-fA-F]{2}(?::[0-9a-fA-F]{2}){5})`)
+	// iwWidth is the width of the VHT operation of iw scan, 80+80 MHz counts
+	// as 160
+	iwWidth = regexp.MustCompile(`^\* channel width: \d+ \((\d+)(\+80)? MHz\)`)
+	// wlanconfigStation starts a station of wlanconfig list
+	wlanconfigStation = regexp.MustCompile(`^([0-9a-fA-F]{2}(?::[0-9a-fA-F]{2}){5})\s`)
+)
+
+// Interfaces implements Backend
+func (s Shell) Interfaces(ctx context.Context) ([]Interface, error) {
+	output, err := ucicfg.Command(ctx, s.Runner, "iw", "dev")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoWiFi, err)
+	}
+	var interfaces []Interface
+	phy := -1
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if matches := iwPHY.FindStringSubmatch(line); matches != nil {
+			phy, _ = strconv.Atoi(matches[1])
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "Interface "); ok && phy >= 0 {
+			interfaces = append(interfaces, Interface{Name: name, PHY: phy})
+			continue
+		}
+		if len(interfaces) == 0 {
+			continue
+		}
+		iface := &interfaces[len(interfaces)-1]
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "ifindex":
+			iface.Index, _ = strconv.Atoi(value)
+		case "addr":
+			iface.MAC = value
+		case "ssid":
+			iface.SSID = value
+		case "type":
+			iface.Type = value
+		case "channel":
+			if matches := iwChannel.FindStringSubmatch(line); matches != nil {
+				iface.Frequency, _ = strconv.Atoi(matches[1])
+			}
+		}
+	}
+	return interfaces, nil
+}
+
+// Stats implements Backend
+func (s Shell) Stats(ctx context.Context, name string) (device.InterfaceStats, error) {
+	output, err := ucicfg.Command(ctx, s.Runner, "cat", "/proc/net/dev")
+	if err != nil {
+		return device.InterfaceStats{}, err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		// The counters may follow the colon without a space
+		dev, counters, ok := strings.Cut(line, ":")
+		fields := strings.Fields(counters)
+		if !ok || strings.TrimSpace(dev) != name || len(fields) < 16 {
+			continue
+		}
+		counter := func(k int) uint64 {
+			value, _ := strconv.ParseUint(fields[k], 10, 64)
+			return value
+		}
+		// Receive: bytes packets errs drop fifo frame compressed multicast,
+		// transmit: bytes packets errs drop fifo colls carrier compressed
+		return interfaceStats(counter(8), counter(0), counter(9), counter(1),
+			counter(10), counter(2), counter(11), counter(3)), nil
+	}
+	return device.InterfaceStats{}, fmt.Errorf("no counters for %s in /proc/net/dev", name)
+}
+
+// interfaceStats returns the counters of an interface, the 32 bit ones wrap
+// like the TR-181 unsignedInt
+func interfaceStats(bytesSent, bytesReceived, packetsSent, packetsReceived, errorsSent, errorsReceived, discardsSent, discardsReceived uint64) device.InterfaceStats {
+	return device.InterfaceStats{
+		BytesSent:              bytesSent,
+		BytesReceived:          bytesReceived,
+		PacketsSent:            packetsSent,
+		PacketsReceived:        packetsReceived,
+		ErrorsSent:             uint32(errorsSent),
+		ErrorsReceived:         uint32(errorsReceived),
+		DiscardPacketsSent:     uint32(discardsSent),
+		DiscardPacketsReceived: uint32(discardsReceived),
+	}
+}
+
+// Stations implements Backend with wlanconfig of the Qualcomm drivers, whose
+// list has a line per station:
+//
+//	ADDR AID CHAN TXRATE RXRATE RSSI MINRSSI MAXRSSI IDLE TXSEQ RXSEQ ...
+func (s Shell) Stations(ctx context.Context, name string) ([]Station, error) {
+	output, err := ucicfg.Command(ctx, s.Runner, "wlanconfig", name, "list")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoWiFi, err)
+	}
+	var stations []Station
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !wlanconfigStation.MatchString(line) {
+			continue
+		}
+		fields := strings.Fields(line)
+		// Stations listed by the driver are associated and authorized
+		station := Station{MAC: strings.ToLower(fields[0]), Authorized: true}
+		if len(fields) > 5 {
+			station.TxRate = parseRate(fields[3])
+			station.RxRate = parseRate(fields[4])
+			station.Signal, _ = strconv.Atoi(fields[5])
+		}
+		if len(fields) > 8 {
+			idle, _ := strconv.Atoi(fields[8])
+			station.Inactive = time.Duration(idle) * time.Second
+		}
+		stations = append(stations, station)
+	}
+	return stations, nil
+}
+
+// parseRate returns a rate like 54M or 866.7M in kbit/s
+func parseRate(rate string) int {
+	mbps, err := strconv.ParseFloat(strings.TrimSuffix(rate, "M"), 64)
+	if err != nil {
+		return 0
+	}
+	return int(mbps * 1000)
+}
+
+// Scan implements Backend with iw scan
+func (s Shell) Scan(ctx context.Context, name string) ([]BSS, error) {
+	args := []string{"dev", name, "scan"}
+	if iface, err := s.find(ctx, name); err == nil && iface.Type == "AP" {
+		// A beaconing interface only scans when asked to
+		args = append(args, "ap-force")
+	}
+	output, err := ucicfg.Command(ctx, s.Runner, "iw", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseScan(output), nil
+}
+
+// find returns the interface called name
+func (s Shell) find(ctx context.Context, name string) (Interface, error) {
+	interfaces, err := s.Interfaces(ctx)
+	if err != nil {
+		return Interface{}, err
+	}
+	for _, iface := range interfaces {
+		if iface.Name == name {
+			return iface, nil
+		}
+	}
+	return Interface{}, fmt.Errorf("no wireless interface %s", name)
+}
+
+// parseScan parses the output of iw scan
+func parseScan(output string) []BSS {
+	var results []BSS
+	var caps capabilities
+	done := func() {
+		if len(results) > 0 {
+			bss := &results[len(results)-1]
+			bss.Standards, bss.Bandwidth = caps.standards(bss.Frequency), caps.bandwidth()
+		}
+	}
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		indented := strings.HasPrefix(line, "\t\t")
+		line = strings.TrimSpace(line)
+		if matches := iwBSS.FindStringSubmatch(line); matches != nil {
+			done()
+			results = append(results, BSS{BSSID: strings.ToLower(matches[1])})
+			caps = capabilities{}
+			continue
+		}
+		if len(results) == 0 {
+			continue
+		}
+		bss := &results[len(results)-1]
+		if !indented {
+			section = ""
+		}
+		key, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		switch {
+		case indented && section == "HT operation" && strings.HasPrefix(line, "* STA channel width: any"):
+			caps.width = max(caps.width, 40)
+		case indented && section == "VHT operation":
+			if matches := iwWidth.FindStringSubmatch(line); matches != nil {
+				width, _ := strconv.Atoi(matches[1])
+				if matches[2] != "" {
+					width = 160
+				}
+				caps.width = max(caps.width, width)
+			}
+		case indented:
+		case key == "freq":
+			frequency, _ := strconv.ParseFloat(value, 64)
+			bss.Frequency = int(frequency)
+		case key == "signal":
+			signal, _ := strconv.ParseFloat(strings.TrimSuffix(value, " dBm"), 64)
+			bss.Signal = int(signal)
+		case key == "SSID":
+			bss.SSID = value
+		case key == "Supported rates" || key == "Extended supported rates":
+			for _, rate := range strings.Fields(value) {
+				mbps, _ := strconv.ParseFloat(strings.TrimSuffix(rate, "*"), 64)
+				switch mbps {
+				case 1, 2, 5.5, 11:
+					caps.cck = true
+				case 6, 9, 12, 18, 24, 36, 48, 54:
+					caps.ofdm = true
+				}
+			}
+		default:
+			section = key
+			switch key {
+			case "HT capabilities":
+				caps.ht = true
+			case "VHT capabilities":
+				caps.vht = true
+			case "HE capabilities":
+				caps.he = true
+			case "EHT capabilities":
+				caps.eht = true
+			}
+		}
+	}
+	done()
+	return results
+}
+
+// Survey implements Surveyor with iw survey dump, whose channels look like
+//
+//	Survey data from phy0-ap0
+//		frequency:			2412 MHz [in use]
+//		noise:				-92 dBm
+//		channel active time:		1234 ms
+func (s Shell) Survey(ctx context.Context, name string) ([]Survey, error) {
+	output, err := ucicfg.Command(ctx, s.Runner, "iw", "dev", name, "survey", "dump")
+	if err != nil {
+		return nil, err
+	}
+	var surveys []Survey
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		number, _ := strconv.Atoi(fields[0])
+		if key == "frequency" {
+			surveys = append(surveys, Survey{Frequency: number, InUse: strings.Contains(value, "[in use]")})
+			continue
+		}
+		if len(surveys) == 0 {
+			continue
+		}
+		survey := &surveys[len(surveys)-1]
+		milliseconds := time.Duration(number) * time.Millisecond
+		switch key {
+		case "noise":
+			survey.Noise = number
+		case "channel active time":
+			survey.Active = milliseconds
+		case "channel busy time":
+			survey.Busy = milliseconds
+		case "channel receive time":
+			survey.Receive = milliseconds
+		case "channel transmit time":
+			survey.Transmit = milliseconds
+		}
+	}
+	return surveys, nil
+}
@@ -0,0 +1,79 @@
+package wifi
+
+import (
+	"context"
+	"sort"
+)
+
+// RadioStats are the measurements of a radio
+type RadioStats struct {
+	Noise int // dBm on the operating channel, 0 when unknown
+	// OverallTxCCQ is the percentage of the transmissions to the stations of
+	// the radio that were acknowledged, retries and failures counted as
+	// attempts, 0 when nothing was sent
+	OverallTxCCQ int
+	Survey       []Survey // By frequency
+}
+
+// RadioStats measures every enabled radio, keyed by radio instance. A radio
+// whose survey or stations cannot be read is reported without them
+func (m *Manager) RadioStats(ctx context.Context) (map[int]RadioStats, error) {
+	m.mu.Lock()
+	cfg, err := m.load(ctx)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	kernel, err := m.backend.Interfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make(map[int]RadioStats)
+	used := make(map[int]bool) // PHYs measured for an earlier radio
+	for _, r := range cfg.radios {
+		if r.sec.Options["disabled"] == "1" {
+			continue
+		}
+		k := cfg.radioInterface(r, kernel, used)
+		if k.Name == "" {
+			continue
+		}
+		var radio RadioStats
+		if surveys, err := m.backend.Survey(ctx, k.Name); err == nil {
+			sort.Slice(surveys, func(i, j int) bool { return surveys[i].Frequency < surveys[j].Frequency })
+			radio.Survey = surveys
+			for _, survey := range surveys {
+				if survey.InUse {
+					radio.Noise = survey.Noise
+				}
+			}
+		}
+		radio.OverallTxCCQ = m.txCCQ(ctx, kernel, k.PHY)
+		stats[r.index] = radio
+	}
+	return stats, nil
+}
+
+// txCCQ returns the OverallTxCCQ of the access points of a phy
+func (m *Manager) txCCQ(ctx context.Context, kernel []Interface, phy int) int {
+	var sent, retries, failed uint64
+	for _, k := range kernel {
+		if k.PHY != phy || k.Type != "AP" {
+			continue
+		}
+		stations, err := m.backend.Stations(ctx, k.Name)
+		if err != nil {
+			continue
+		}
+		for _, station := range stations {
+			sent += station.PacketsSent
+			retries += station.Retries
+			failed += station.Failed
+		}
+	}
+	if attempts := sent + retries + failed; attempts > 0 {
+		return int(sent * 100 / attempts)
+	}
+	return 0
+}
@@ -0,0 +1,295 @@
+// Package wifi maps the writable parameters of TR-181 Device.WiFi to
+// /etc/config/wireless. A Radio is a wifi-device section, an SSID is a
+// wifi-iface section and an AccessPoint is a wifi-iface section in AP mode.
+// The sections are numbered with instance options so the collectors of
+// internal/cron/jobs and SetParameterValues agree on the instances.
+package wifi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/uci"
+	"github.com/Niceblueman/goispappd/internal/ucicfg"
+)
+
+// Prefix is the object mapped by the package
+const Prefix = "Device.WiFi."
+
+// Tables below Prefix
+const (
+	radioPrefix       = Prefix + "Radio."
+	ssidPrefix        = Prefix + "SSID."
+	accessPointPrefix = Prefix + "AccessPoint."
+)
+
+// UCI options numbering the wireless sections
+const (
+	RadioInstance       = "wifi_radio_instance"
+	SSIDInstance        = "wifi_ssid_instance"
+	AccessPointInstance = "wifi_ap_instance"
+)
+
+// securityModes maps the TR-181 Security.ModeEnabled values to the encryption
+// option of hostapd.sh, the cipher suffix like +ccmp left out
+var securityModes = map[string]string{
+	"None":                     "none",
+	"WPA-Personal":             "psk",
+	"WPA2-Personal":            "psk2",
+	"WPA-WPA2-Personal":        "psk-mixed",
+	"WPA3-Personal":            "sae",
+	"WPA3-Personal-Transition": "sae-mixed",
+	"WPA-Enterprise":           "wpa",
+	"WPA2-Enterprise":          "wpa2",
+	"WPA-WPA2-Enterprise":      "wpa-mixed",
+	"WPA3-Enterprise":          "wpa3",
+}
+
+// ModesSupported is the Security.ModesSupported of every AccessPoint
+const ModesSupported = "None,WPA-Personal,WPA2-Personal,WPA-WPA2-Personal,WPA3-Personal,WPA3-Personal-Transition," +
+	"WPA-Enterprise,WPA2-Enterprise,WPA-WPA2-Enterprise,WPA3-Enterprise,X_ISPAPP_Specific"
+
+// bandStandards are the 802.11 standards of each band, in the order
+// OperatingStandards lists them
+var bandStandards = map[string][]string{
+	"2g": {"b", "g", "n", "ax", "be"},
+	"5g": {"a", "n", "ac", "ax", "be"},
+	"6g": {"ax", "be"},
+}
+
+// families are the htmode prefixes, a family includes the standards up to
+// its own: NOHT is legacy a/b/g, HT adds n, VHT ac, HE ax and EHT be
+var families = []string{"", "HT", "VHT", "HE", "EHT"}
+
+// standardRanks are the family index of each standard
+var standardRanks = map[string]int{"a": 0, "b": 0, "g": 0, "n": 1, "ac": 2, "ax": 3, "be": 4}
+
+// familyWidths are the widest channel of each family in MHz
+var familyWidths = map[string]int{"": 20, "HT": 40, "VHT": 160, "HE": 160, "EHT": 320}
+
+// bandWidths are the widest channel of each band in MHz
+var bandWidths = map[string]int{"2g": 40, "5g": 160, "6g": 320}
+
+// bandChannels are the lowest and highest channel of each band
+var bandChannels = map[string][2]int{"2g": {1, 14}, "5g": {32, 177}, "6g": {1, 233}}
+
+// Manager writes the wireless config with uci and scans through its backends
+type Manager struct {
+	runner  exec.Runner
+	uci     *ucicfg.Config
+	numbers *ucicfg.Config // Instance numbers, committed apart from the requests
+	backend Fallback
+	mu      sync.Mutex
+}
+
+// NewManager creates a Manager running uci and wifi through runner, the
+// neighbour scans run through the first of backends that succeeds
+func NewManager(runner exec.Runner, backends ...Backend) *Manager {
+	c := ucicfg.New(runner, "wireless", "wifi")
+	return &Manager{runner: runner, uci: c, numbers: c.Numbers(), backend: Fallback(backends)}
+}
+
+// radio is a wifi-device section
+type radio struct {
+	sec   *uci.Section
+	index int
+}
+
+// iface is a wifi-iface section, accessPoint is 0 when it is not in AP mode
+type iface struct {
+	sec         *uci.Section
+	index       int
+	accessPoint int
+}
+
+// config is the wireless config with its instance numbers
+type config struct {
+	radios []*radio
+	ifaces []*iface
+}
+
+// Number gives the wireless sections without instance the next free ones,
+// the collectors call it before reading the config
+func (m *Manager) Number(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := m.load(ctx)
+	return err
+}
+
+// load reads the wireless config, numbering the sections that have no
+// instance yet
+func (m *Manager) load(ctx context.Context) (*config, error) {
+	sections, err := m.uci.Show(ctx)
+	if err != nil {
+		return nil, err
+	}
+	highest := map[string]int{}
+	for _, sec := range sections {
+		for _, option := range []string{RadioInstance, SSIDInstance, AccessPointInstance} {
+			if index, err := strconv.Atoi(sec.Options[option]); err == nil {
+				highest[option] = max(highest[option], index)
+			}
+		}
+	}
+
+	numbered := false
+	instance := func(sec *uci.Section, option string) (int, error) {
+		if index, err := strconv.Atoi(sec.Options[option]); err == nil {
+			return index, nil
+		}
+		highest[option]++
+		index := highest[option]
+		if err := m.numbers.Set(ctx, sec.Name, option, strconv.Itoa(index)); err != nil {
+			return 0, err
+		}
+		sec.Options[option] = strconv.Itoa(index)
+		numbered = true
+		return index, nil
+	}
+
+	cfg := &config{}
+	for _, sec := range sections {
+		switch sec.SectionType {
+		case "wifi-device":
+			index, err := instance(sec, RadioInstance)
+			if err != nil {
+				return nil, err
+			}
+			cfg.radios = append(cfg.radios, &radio{sec: sec, index: index})
+		case "wifi-iface":
+			index, err := instance(sec, SSIDInstance)
+			if err != nil {
+				return nil, err
+			}
+			i := &iface{sec: sec, index: index}
+			// hostapd.sh defaults the mode to ap
+			if mode := sec.Options["mode"]; mode == "" || mode == "ap" {
+				if i.accessPoint, err = instance(sec, AccessPointInstance); err != nil {
+					return nil, err
+				}
+			}
+			cfg.ifaces = append(cfg.ifaces, i)
+		}
+	}
+	if numbered {
+		if err := m.numbers.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(cfg.radios, func(i, j int) bool { return cfg.radios[i].index < cfg.radios[j].index })
+	sort.Slice(cfg.ifaces, func(i, j int) bool { return cfg.ifaces[i].index < cfg.ifaces[j].index })
+	return cfg, nil
+}
+
+// radio returns the radio numbered index
+func (cfg *config) radio(index int) *radio {
+	for _, r := range cfg.radios {
+		if r.index == index {
+			return r
+		}
+	}
+	return nil
+}
+
+// ssid returns the SSID numbered index
+func (cfg *config) ssid(index int) *iface {
+	for _, i := range cfg.ifaces {
+		if i.index == index {
+			return i
+		}
+	}
+	return nil
+}
+
+// accessPoint returns the AccessPoint numbered index
+func (cfg *config) accessPoint(index int) *iface {
+	for _, i := range cfg.ifaces {
+		if i.accessPoint == index && index > 0 {
+			return i
+		}
+	}
+	return nil
+}
+
+// Band returns the band of a wifi-device, 2g, 5g or 6g, from the band option
+// or the hwmode and channel of releases before 21.02
+func Band(options map[string]string) string {
+	if band := options["band"]; band != "" {
+		return band
+	}
+	switch options["hwmode"] {
+	case "11a":
+		return "5g"
+	case "11b", "11g":
+		return "2g"
+	}
+	if channel, err := strconv.Atoi(options["channel"]); err == nil && channel > 14 {
+		return "5g"
+	}
+	return "2g"
+}
+
+// splitHTMode splits an htmode like VHT80 or HT40+ into its family and width
+// in MHz, NOHT is the legacy family of 20 MHz
+func splitHTMode(htmode string) (family string, width int) {
+	if htmode == "" || htmode == "NOHT" {
+		return "", 20
+	}
+	family = strings.TrimRight(htmode, "0123456789+-")
+	width, err := strconv.Atoi(strings.TrimRight(strings.TrimPrefix(htmode, family), "+-"))
+	if err != nil || familyWidths[family] == 0 {
+		return "", 20
+	}
+	return family, width
+}
+
+// rank returns the index of family in families
+func rank(family string) int {
+	for k, f := range families {
+		if f == family {
+			return k
+		}
+	}
+	return 0
+}
+
+// OperatingStandards returns the standards of a wifi-device as the comma
+// separated TR-181 list, e.g. a,n,ac for VHT80 on 5 GHz
+func OperatingStandards(options map[string]string) string {
+	family, _ := splitHTMode(options["htmode"])
+	var standards []string
+	for _, standard := range bandStandards[Band(options)] {
+		if standardRanks[standard] <= rank(family) {
+			standards = append(standards, standard)
+		}
+	}
+	return strings.Join(standards, ",")
+}
+
+// OperatingChannelBandwidth returns the channel width of a wifi-device, e.g.
+// 80MHz for VHT80
+func OperatingChannelBandwidth(options map[string]string) string {
+	_, width := splitHTMode(options["htmode"])
+	return fmt.Sprintf("%dMHz", width)
+}
+
+// SecurityMode returns the TR-181 Security.ModeEnabled of an encryption
+// option, X_ISPAPP_Specific for the modes TR-181 has no name for
+func SecurityMode(encryption string) string {
+	base, _, _ := strings.Cut(encryption, "+")
+	if base == "" {
+		return "None"
+	}
+	for mode, option := range securityModes {
+		if option == base {
+			return mode
+		}
+	}
+	return "X_ISPAPP_Specific"
+}
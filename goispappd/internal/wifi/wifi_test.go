@@ -0,0 +1,555 @@
+package wifi_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Niceblueman/goispappd/device"
+	"github.com/Niceblueman/goispappd/internal/exec"
+	"github.com/Niceblueman/goispappd/internal/params"
+	"github.com/Niceblueman/goispappd/internal/uci/ucitest"
+	"github.com/Niceblueman/goispappd/internal/wifi"
+	mdwifi "github.com/mdlayher/wifi"
+)
+
+// newUCI emulates a dual band router with an access point on each radio and
+// a client uplink on the 5 GHz one, only the first radio was numbered by the
+// collectors
+func newUCI() *ucitest.UCI {
+	return ucitest.New().
+		Section("wireless", "radio0", "wifi-device", "type", "mac80211", "band", "2g", "channel", "1", "htmode", "HT20",
+			wifi.RadioInstance, "1").
+		Section("wireless", "radio1", "wifi-device", "type", "mac80211", "band", "5g", "channel", "auto", "htmode", "VHT80").
+		Section("wireless", "default_radio0", "wifi-iface", "device", "radio0", "network", "lan", "mode", "ap",
+			"ssid", "OpenWrt", "encryption", "psk2", "key", "oldpassphrase").
+		Section("wireless", "default_radio1", "wifi-iface", "device", "radio1", "network", "lan", "mode", "ap",
+			"ssid", "OpenWrt-5G", "encryption", "sae-mixed+ccmp", "key", "oldpassphrase").
+		Section("wireless", "uplink", "wifi-iface", "device", "radio1", "network", "wwan", "mode", "sta",
+			"ssid", "Upstream", "encryption", "psk2", "key", "upstreamkey").
+		On("wifi reload", "")
+}
+
+func newRegistry(t *testing.T) (*ucitest.UCI, *params.Registry) {
+	t.Helper()
+	ucitest.UseStore(t)
+
+	uci := newUCI()
+	manager := wifi.NewManager(uci)
+	if err := manager.Number(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	registry := params.NewRegistry()
+	manager.Register(registry)
+	return uci, registry
+}
+
+func expectOptions(t *testing.T, uci *ucitest.UCI, expected [][3]string) {
+	t.Helper()
+	for _, option := range expected {
+		if got := uci.Option("wireless", option[0], option[1]); got != option[2] {
+			t.Errorf("%s.%s: expected %q, got %q", option[0], option[1], option[2], got)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	uci, _ := newRegistry(t)
+
+	// The sections without instance are numbered in section order, the
+	// client interface is an SSID but no AccessPoint
+	expectOptions(t, uci, [][3]string{
+		{"radio0", wifi.RadioInstance, "1"},
+		{"radio1", wifi.RadioInstance, "2"},
+		{"default_radio0", wifi.SSIDInstance, "1"},
+		{"default_radio0", wifi.AccessPointInstance, "1"},
+		{"default_radio1", wifi.SSIDInstance, "2"},
+		{"default_radio1", wifi.AccessPointInstance, "2"},
+		{"uplink", wifi.SSIDInstance, "3"},
+		{"uplink", wifi.AccessPointInstance, ""},
+	})
+}
+
+func TestHelpers(t *testing.T) {
+	for _, test := range []struct {
+		options   map[string]string
+		standards string
+		bandwidth string
+	}{
+		{map[string]string{"band": "2g", "htmode": "HT20"}, "b,g,n", "20MHz"},
+		{map[string]string{"band": "5g", "htmode": "VHT80"}, "a,n,ac", "80MHz"},
+		{map[string]string{"band": "6g", "htmode": "HE160"}, "ax", "160MHz"},
+		{map[string]string{"hwmode": "11a", "htmode": "HT40+"}, "a,n", "40MHz"},
+		{map[string]string{"channel": "11"}, "b,g", "20MHz"},
+	} {
+		if got := wifi.OperatingStandards(test.options); got != test.standards {
+			t.Errorf("%v: expected standards %q, got %q", test.options, test.standards, got)
+		}
+		if got := wifi.OperatingChannelBandwidth(test.options); got != test.bandwidth {
+			t.Errorf("%v: expected bandwidth %q, got %q", test.options, test.bandwidth, got)
+		}
+	}
+	for encryption, mode := range map[string]string{
+		"":               "None",
+		"none":           "None",
+		"psk2+ccmp":      "WPA2-Personal",
+		"sae-mixed":      "WPA3-Personal-Transition",
+		"owe":            "X_ISPAPP_Specific",
+		"wpa2+tkip+ccmp": "WPA2-Enterprise",
+	} {
+		if got := wifi.SecurityMode(encryption); got != mode {
+			t.Errorf("%q: expected %q, got %q", encryption, mode, got)
+		}
+	}
+}
+
+func TestSet(t *testing.T) {
+	uci, registry := newRegistry(t)
+	prefix := "Device.WiFi."
+
+	faults := registry.Set(ucitest.SetValues(
+		prefix+"SSID.1.SSID", "Home",
+		prefix+"AccessPoint.1.Security.KeyPassphrase", "newpassphrase",
+		prefix+"AccessPoint.1.SSIDAdvertisementEnabled", "false",
+		prefix+"AccessPoint.2.Security.ModeEnabled", "WPA2-Personal",
+		prefix+"Radio.1.Channel", "6",
+		prefix+"Radio.2.Channel", "36",
+		prefix+"Radio.2.AutoChannelEnable", "false",
+		prefix+"Radio.2.OperatingStandards", "a,n,ac,ax",
+		prefix+"Radio.2.OperatingChannelBandwidth", "160MHz",
+		prefix+"SSID.3.Enable", "false",
+	))
+	if len(faults) > 0 {
+		t.Fatalf("Set failed: %v", faults[0])
+	}
+	expectOptions(t, uci, [][3]string{
+		{"default_radio0", "ssid", "Home"},
+		{"default_radio0", "key", "newpassphrase"},
+		{"default_radio0", "hidden", "1"},
+		{"default_radio1", "encryption", "psk2"},
+		{"default_radio1", "key", "oldpassphrase"},
+		{"radio0", "channel", "6"},
+		{"radio1", "channel", "36"},
+		{"radio1", "htmode", "HE160"},
+		{"uplink", "disabled", "1"},
+	})
+	if got := uci.Count("wifi reload"); got != 1 {
+		t.Errorf("Expected one wifi reload, got %d", got)
+	}
+	ucitest.ExpectStored(t, map[string]string{
+		prefix + "SSID.1.SSID":                            "Home",
+		prefix + "AccessPoint.1.SSIDAdvertisementEnabled": "false",
+		prefix + "AccessPoint.1.Security.KeyPassphrase":   "",
+		prefix + "AccessPoint.2.Security.ModeEnabled":     "WPA2-Personal",
+		prefix + "Radio.2.AutoChannelEnable":              "false",
+		prefix + "Radio.2.OperatingStandards":             "a,n,ac,ax",
+		prefix + "Radio.2.OperatingChannelBandwidth":      "160MHz",
+		prefix + "SSID.3.Enable":                          "false",
+	})
+
+	t.Run("AutoChannelEnable", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(prefix+"Radio.2.AutoChannelEnable", "true"))
+		if len(faults) > 0 {
+			t.Fatalf("Set failed: %v", faults[0])
+		}
+		expectOptions(t, uci, [][3]string{{"radio1", "channel", "auto"}})
+		ucitest.ExpectStored(t, map[string]string{prefix + "Radio.2.AutoChannelEnable": "true"})
+	})
+
+	t.Run("InvalidValue", func(t *testing.T) {
+		for _, pairs := range [][]string{
+			{prefix + "Radio.1.Channel", "36"},
+			{prefix + "Radio.1.OperatingStandards", "n,ac"},
+			{prefix + "Radio.1.OperatingChannelBandwidth", "80MHz"},
+			{prefix + "Radio.2.AutoChannelEnable", "false"},
+			{prefix + "AccessPoint.1.Security.ModeEnabled", "WPA3-Personal", prefix + "AccessPoint.1.Security.KeyPassphrase", "short"},
+			{prefix + "SSID.1.SSID", "Other", prefix + "AccessPoint.2.Security.ModeEnabled", "None", prefix + "Radio.1.Channel", "36"},
+		} {
+			faults := registry.Set(ucitest.SetValues(pairs...))
+			if len(faults) == 0 || faults[0].Code != params.FaultInvalidValue {
+				t.Errorf("%v: expected an invalid value, got %v", pairs, faults)
+			}
+		}
+		// The failed requests are reverted as a whole
+		expectOptions(t, uci, [][3]string{
+			{"default_radio0", "ssid", "Home"},
+			{"default_radio1", "encryption", "psk2"},
+			{"radio0", "channel", "6"},
+		})
+	})
+
+	t.Run("ReadOnly", func(t *testing.T) {
+		faults := registry.Set(ucitest.SetValues(prefix+"Radio.1.Status", "Down"))
+		if len(faults) != 1 || faults[0].Code != params.FaultNotWritable {
+			t.Errorf("Expected Status to be read-only, got %v", faults)
+		}
+	})
+
+	t.Run("UnknownInstance", func(t *testing.T) {
+		for _, name := range []string{prefix + "SSID.4.SSID", prefix + "AccessPoint.3.Enable"} {
+			faults := registry.Set(ucitest.SetValues(name, "true"))
+			if len(faults) != 1 || faults[0].Code != params.FaultInvalidName {
+				t.Errorf("%s: expected an invalid name, got %v", name, faults)
+			}
+		}
+	})
+}
+
+// client replays the nl80211 interfaces and stations of an access point
+type client struct {
+	interfaces []*mdwifi.Interface
+	stations   map[string][]*mdwifi.StationInfo
+}
+
+func (c *client) Interfaces() ([]*mdwifi.Interface, error) { return c.interfaces, nil }
+func (c *client) Close() error                             { return nil }
+
+func (c *client) StationInfo(ifi *mdwifi.Interface) ([]*mdwifi.StationInfo, error) {
+	return c.stations[ifi.Name], nil
+}
+
+func TestNL80211(t *testing.T) {
+	ctx := context.Background()
+	mac := func(s string) net.HardwareAddr {
+		addr, _ := net.ParseMAC(s)
+		return addr
+	}
+	nl := &client{
+		interfaces: []*mdwifi.Interface{
+			{Index: 9, Name: "phy0-ap0", HardwareAddr: mac("94:83:c4:a0:11:22"), PHY: 0, Type: mdwifi.InterfaceTypeAP, Frequency: 2437},
+			{Index: 12, Name: "phy1-sta0", HardwareAddr: mac("94:83:c4:a0:11:24"), PHY: 1, Type: mdwifi.InterfaceTypeStation},
+			// The P2P device of a phy has no network device
+			{PHY: 1, Type: mdwifi.InterfaceTypeP2PDevice},
+		},
+		stations: map[string][]*mdwifi.StationInfo{"phy0-ap0": {{
+			HardwareAddr: mac("a4:c3:f0:12:34:56"), Connected: 751 * time.Second, Inactive: 2100 * time.Millisecond,
+			ReceivedBytes: 1048576, TransmittedBytes: 8388608, ReceivedPackets: 1200, TransmittedPackets: 6400,
+			Signal: -52, ReceiveBitrate: 130000000, TransmitBitrate: 144400000, TransmitRetries: 17, TransmitFailed: 2,
+		}}},
+	}
+	fsys := fstest.MapFS{
+		"phy0-ap0/phy80211":             &fstest.MapFile{Mode: 0o777 | fs.ModeSymlink},
+		"phy0-ap0/statistics/tx_bytes":  &fstest.MapFile{Data: []byte("654321\n")},
+		"phy0-ap0/statistics/rx_bytes":  &fstest.MapFile{Data: []byte("123456\n")},
+		"phy0-ap0/statistics/tx_errors": &fstest.MapFile{Data: []byte("3\n")},
+		"eth0/statistics/tx_bytes":      &fstest.MapFile{Data: []byte("1\n")},
+	}
+	backend := wifi.NL80211{Dial: func() (wifi.Client, error) { return nl, nil }, FS: fsys}
+
+	interfaces, err := backend.Interfaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []wifi.Interface{
+		{Name: "phy0-ap0", Index: 9, PHY: 0, MAC: "94:83:c4:a0:11:22", Type: "AP", Frequency: 2437},
+		{Name: "phy1-sta0", Index: 12, PHY: 1, MAC: "94:83:c4:a0:11:24", Type: "managed"},
+	}
+	if len(interfaces) != len(expected) || interfaces[0] != expected[0] || interfaces[1] != expected[1] {
+		t.Errorf("Expected %+v, got %+v", expected, interfaces)
+	}
+
+	stats, err := backend.Stats(ctx, "phy0-ap0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (device.InterfaceStats{BytesSent: 654321, BytesReceived: 123456, ErrorsSent: 3}) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if _, err := backend.Stats(ctx, "eth0"); !errors.Is(err, wifi.ErrNoWiFi) {
+		t.Errorf("Expected eth0 to be left to the other backends, got %v", err)
+	}
+
+	stations, err := backend.Stations(ctx, "phy0-ap0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	station := wifi.Station{
+		MAC: "a4:c3:f0:12:34:56", Authorized: true, Signal: -52, TxRate: 144400, RxRate: 130000,
+		Connected: 751 * time.Second, Inactive: 2100 * time.Millisecond, BytesSent: 8388608, BytesReceived: 1048576,
+		PacketsSent: 6400, PacketsReceived: 1200, Retries: 17, Failed: 2,
+	}
+	if len(stations) != 1 || stations[0] != station {
+		t.Errorf("Expected %+v, got %+v", station, stations)
+	}
+	if _, err := backend.Stations(ctx, "ath0"); !errors.Is(err, wifi.ErrNoWiFi) {
+		t.Errorf("Expected ath0 to be left to the other backends, got %v", err)
+	}
+}
+
+func TestShell(t *testing.T) {
+	ctx := context.Background()
+	runner := exec.NewFixtureRunner().
+		On("iw dev", exec.Fixture{Stdout: `phy#1
+	Interface phy1-ap0
+		ifindex 10
+		wdev 0x100000002
+		addr 94:83:c4:a0:11:23
+		ssid ispapp-5g
+		type AP
+		channel 36 (5180 MHz), width: 80 MHz, center1: 5210 MHz
+		txpower 23.00 dBm
+`}).
+		On("cat /proc/net/dev", exec.Fixture{Stdout: `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+phy1-ap0:4294967296 789    1    2    0     0          0         0   654321     987    3    4    0     0       0          0
+`}).
+		On("iw dev phy1-ap0 survey dump", exec.Fixture{Stdout: `Survey data from phy1-ap0
+	frequency:			5180 MHz [in use]
+	noise:				-95 dBm
+	channel active time:		1000 ms
+	channel busy time:		400 ms
+	channel receive time:		300 ms
+	channel transmit time:		50 ms
+Survey data from phy1-ap0
+	frequency:			5200 MHz
+`}).
+		On("iw dev phy1-ap0 scan ap-force", exec.Fixture{Stdout: `BSS 3c:37:86:aa:bb:cc(on phy1-ap0)
+	last seen: 1520.368s [boottime]
+	freq: 5500.0
+	signal: -67.00 dBm
+	SSID: office: 2nd floor
+	Supported rates: 6.0* 9.0 12.0* 18.0 24.0* 36.0 48.0 54.0 
+	BSS Load:
+		 * station count: 3
+	HT capabilities:
+		Capabilities: 0x9ef
+	HT operation:
+		 * primary channel: 100
+		 * secondary channel offset: above
+		 * STA channel width: any
+	VHT capabilities:
+		VHT Capabilities (0x338b79b2):
+	VHT operation:
+		 * channel width: 1 (80 MHz)
+		 * center freq segment 1: 106
+	HE capabilities:
+		HE MAC Capabilities (0x000801185018):
+BSS 3c:37:86:aa:bb:cd(on phy1-ap0)
+	freq: 5180
+	signal: -80.00 dBm
+	SSID: 
+	Supported rates: 6.0* 9.0 12.0* 18.0 24.0* 36.0 48.0 54.0 
+`})
+	backend := wifi.Shell{Runner: runner}
+
+	interfaces, err := backend.Interfaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iface := wifi.Interface{Name: "phy1-ap0", Index: 10, PHY: 1, MAC: "94:83:c4:a0:11:23", Type: "AP", SSID: "ispapp-5g", Frequency: 5180}
+	if len(interfaces) != 1 || interfaces[0] != iface {
+		t.Errorf("Expected %+v, got %+v", iface, interfaces)
+	}
+
+	// The counters may follow the device name without a space
+	stats, err := backend.Stats(ctx, "phy1-ap0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.BytesReceived != 4294967296 || stats.BytesSent != 654321 || stats.DiscardPacketsReceived != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	results, err := backend.Scan(ctx, "phy1-ap0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []wifi.BSS{
+		{BSSID: "3c:37:86:aa:bb:cc", SSID: "office: 2nd floor", Frequency: 5500, Signal: -67, Standards: "a,n,ac,ax", Bandwidth: "80MHz"},
+		{BSSID: "3c:37:86:aa:bb:cd", Frequency: 5180, Signal: -80, Standards: "a", Bandwidth: "20MHz"},
+	}
+	if len(results) != len(expected) || results[0] != expected[0] || results[1] != expected[1] {
+		t.Errorf("Expected %+v, got %+v", expected, results)
+	}
+
+	surveys, err := backend.Survey(ctx, "phy1-ap0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	survey := wifi.Survey{Frequency: 5180, Noise: -95, InUse: true, Active: time.Second, Busy: 400 * time.Millisecond,
+		Receive: 300 * time.Millisecond, Transmit: 50 * time.Millisecond}
+	if len(surveys) != 2 || surveys[0] != survey || surveys[1] != (wifi.Survey{Frequency: 5200}) {
+		t.Errorf("Expected %+v and 5200 MHz, got %+v", survey, surveys)
+	}
+
+	t.Run("Fallback", func(t *testing.T) {
+		unreachable := wifi.NL80211{Dial: func() (wifi.Client, error) { return nil, errors.New("nl80211 not found") }}
+		interfaces, err := wifi.Fallback{unreachable, backend}.Interfaces(ctx)
+		if err != nil || len(interfaces) != 1 {
+			t.Errorf("Expected the interfaces of iw, got %+v %v", interfaces, err)
+		}
+		// wlanconfig is missing as well
+		if _, err := (wifi.Fallback{unreachable, backend}).Stations(ctx, "phy1-ap0"); !errors.Is(err, wifi.ErrNoWiFi) {
+			t.Errorf("Expected no backend to list the stations, got %v", err)
+		}
+	})
+}
+
+// scanner is a Backend with scripted interfaces, scan results, stations and
+// surveys
+type scanner struct {
+	interfaces []wifi.Interface
+	scans      map[string][]wifi.BSS
+	stations   map[string][]wifi.Station
+	surveys    map[string][]wifi.Survey
+	scanned    []string
+}
+
+func (s *scanner) Interfaces(context.Context) ([]wifi.Interface, error) { return s.interfaces, nil }
+
+func (s *scanner) Stats(context.Context, string) (device.InterfaceStats, error) {
+	return device.InterfaceStats{}, wifi.ErrNoWiFi
+}
+
+func (s *scanner) Stations(_ context.Context, name string) ([]wifi.Station, error) {
+	stations, ok := s.stations[name]
+	if !ok {
+		return nil, wifi.ErrNoWiFi
+	}
+	return stations, nil
+}
+
+func (s *scanner) Survey(_ context.Context, name string) ([]wifi.Survey, error) {
+	surveys, ok := s.surveys[name]
+	if !ok {
+		return nil, errors.New("survey failed")
+	}
+	return surveys, nil
+}
+
+func (s *scanner) Scan(_ context.Context, name string) ([]wifi.BSS, error) {
+	s.scanned = append(s.scanned, name)
+	results, ok := s.scans[name]
+	if !ok {
+		return nil, errors.New("scan failed")
+	}
+	return results, nil
+}
+
+func TestScan(t *testing.T) {
+	ctx := context.Background()
+	backend := &scanner{
+		interfaces: []wifi.Interface{
+			{Name: "phy1-sta0", PHY: 1, Type: "managed", Frequency: 5500},
+			{Name: "phy1-ap0", PHY: 1, Type: "AP", Frequency: 5500},
+			{Name: "phy0-ap0", PHY: 0, Type: "AP", Frequency: 2412},
+		},
+		scans: map[string][]wifi.BSS{
+			"phy0-ap0": {
+				{BSSID: "3c:37:86:aa:bb:01", SSID: "neighbour", Frequency: 2437, Signal: -71, Standards: "b,g,n", Bandwidth: "20MHz"},
+				// Heard on 5 GHz by a dual band phy, it belongs to the other radio
+				{BSSID: "3c:37:86:aa:bb:02", SSID: "office", Frequency: 5180, Signal: -40, Standards: "a,n,ac", Bandwidth: "80MHz"},
+			},
+			"phy1-sta0": {
+				{BSSID: "3c:37:86:aa:bb:02", SSID: "office", Frequency: 5180, Signal: -60, Standards: "a,n,ac", Bandwidth: "80MHz"},
+				{BSSID: "3c:37:86:aa:bb:03", Frequency: 5500, Signal: -85},
+			},
+		},
+	}
+
+	results, err := wifi.NewManager(newUCI(), backend).Scan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backend.scanned) != 2 || backend.scanned[0] != "phy0-ap0" || backend.scanned[1] != "phy1-sta0" {
+		t.Errorf("Expected a scan per radio, got %v", backend.scanned)
+	}
+	expected := []device.NeighboringWiFiResult{
+		{Radio: "Device.WiFi.Radio.2.", SSID: "office", BSSID: "3c:37:86:aa:bb:02", Channel: 36, SignalStrength: -60,
+			OperatingFrequencyBand: "5GHz", OperatingStandards: []string{"a", "n", "ac"}, OperatingChannelBandwidth: "80MHz", Noise: -95},
+		{Radio: "Device.WiFi.Radio.1.", SSID: "neighbour", BSSID: "3c:37:86:aa:bb:01", Channel: 6, SignalStrength: -71,
+			OperatingFrequencyBand: "2.4GHz", OperatingStandards: []string{"b", "g", "n"}, OperatingChannelBandwidth: "20MHz", Noise: -95},
+		{Radio: "Device.WiFi.Radio.2.", BSSID: "3c:37:86:aa:bb:03", Channel: 100, SignalStrength: -85,
+			OperatingFrequencyBand: "5GHz", Noise: -95},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %+v", len(expected), results)
+	}
+	for i := range expected {
+		if fmt.Sprint(results[i]) != fmt.Sprint(expected[i]) {
+			t.Errorf("Result %d: expected %+v, got %+v", i+1, expected[i], results[i])
+		}
+	}
+
+	t.Run("NoRadio", func(t *testing.T) {
+		// Without a kernel interface in the band of a radio nothing is scanned
+		backend := &scanner{interfaces: []wifi.Interface{{Name: "wlan9", PHY: 9, Frequency: 60480}}}
+		if _, err := wifi.NewManager(newUCI(), backend).Scan(ctx); !errors.Is(err, wifi.ErrNoWiFi) {
+			t.Errorf("Expected ErrNoWiFi, got %v", err)
+		}
+	})
+}
+
+func TestRadioStats(t *testing.T) {
+	backend := &scanner{
+		interfaces: []wifi.Interface{
+			{Name: "phy0-ap0", PHY: 0, Type: "AP", Frequency: 2412},
+			{Name: "phy1-ap0", PHY: 1, Type: "AP", Frequency: 5180},
+			{Name: "phy1-ap1", PHY: 1, Type: "AP", Frequency: 5180},
+			{Name: "phy1-sta0", PHY: 1, Type: "managed", Frequency: 5180},
+		},
+		stations: map[string][]wifi.Station{
+			"phy1-ap0": {{MAC: "a4:c3:f0:12:34:56", PacketsSent: 700, Retries: 200, Failed: 20}},
+			"phy1-ap1": {{MAC: "a4:c3:f0:12:34:57", PacketsSent: 100}},
+			// The uplink does not count in the CCQ of the access points
+			"phy1-sta0": {{MAC: "3c:37:86:aa:bb:02", PacketsSent: 10, Retries: 1000}},
+		},
+		surveys: map[string][]wifi.Survey{
+			"phy1-ap0": {
+				{Frequency: 5200, Noise: -97, Active: time.Second},
+				{Frequency: 5180, Noise: -93, InUse: true, Active: time.Second, Busy: 600 * time.Millisecond},
+			},
+		},
+	}
+
+	stats, err := wifi.NewManager(newUCI(), backend).RadioStats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// radio0 has neither stations nor a survey
+	if radio := stats[1]; radio.Noise != 0 || radio.OverallTxCCQ != 0 || radio.Survey != nil {
+		t.Errorf("Expected radio 1 without measurements, got %+v", radio)
+	}
+	radio := stats[2]
+	if radio.Noise != -93 || radio.OverallTxCCQ != 78 {
+		t.Errorf("Expected -93 dBm and 78%% CCQ, got %+v", radio)
+	}
+	if len(radio.Survey) != 2 || radio.Survey[0].Frequency != 5180 || radio.Survey[0].Utilization() != 60 {
+		t.Errorf("Expected the survey by frequency, got %+v", radio.Survey)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	history := wifi.NewHistory(time.Hour)
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	station := func(signal int, sent, retries uint64) wifi.Station {
+		return wifi.Station{MAC: "A4:C3:F0:12:34:56", Signal: signal, PacketsSent: sent, Retries: retries}
+	}
+
+	steps := []struct {
+		name     string
+		station  wifi.Station
+		at       time.Duration
+		expected wifi.Summary
+	}{
+		{"First", station(-60, 100, 10), 0, wifi.Summary{MinSignal: -60, AvgSignal: -60, Samples: 1, Retransmissions: 10}},
+		{"Delta", station(-70, 300, 50), 30 * time.Minute, wifi.Summary{MinSignal: -70, AvgSignal: -65, Samples: 2, Retransmissions: 20}},
+		{"Window", station(-50, 300, 50), 70 * time.Minute, wifi.Summary{MinSignal: -70, AvgSignal: -60, Samples: 2}},
+		{"Reassociated", station(-50, 20, 1), 80 * time.Minute, wifi.Summary{MinSignal: -70, AvgSignal: -56, Samples: 3, Retransmissions: 5}},
+	}
+	for _, step := range steps {
+		if got := history.Add(step.station, start.Add(step.at)); got != step.expected {
+			t.Errorf("%s: expected %+v, got %+v", step.name, step.expected, got)
+		}
+	}
+
+	// A station gone for longer than the window starts over
+	if got := history.Add(station(-80, 0, 0), start.Add(3*time.Hour)); got != (wifi.Summary{MinSignal: -80, AvgSignal: -80, Samples: 1}) {
+		t.Errorf("Expected a new history, got %+v", got)
+	}
+}
@@ -2,6 +2,7 @@ package soap
 
 import (
 	"encoding/xml"
+	"strings"
 )
 
 // ResponceEnvelope represents incoming messages from ACS to CPE
@@ -12,39 +13,40 @@ type ResponceEnvelope struct {
 	Header  *struct {
 		XMLName *xml.Name `xml:"Header"`
 		ID      struct {
-			XMLName        *xml.Name `xml:"cwmp:ID"`
+			XMLName        *xml.Name `xml:"ID"`
 			MustUnderstand *string   `xml:"mustUnderstand,attr"`
 			Value          *string   `xml:",chardata"`
-		} `xml:"cwmp:ID"`
+		} `xml:"ID"`
 	} `xml:"Header"`
 	Body *struct {
 		// ACS-initiated RPC methods
 		XMLName                  *xml.Name                 `xml:"Body"`
-		GetRPCMethods            *GetRPCMethods            `xml:"cwmp:GetRPCMethods"`
-		GetParameterValues       *GetParameterValues       `xml:"cwmp:GetParameterValues"`
-		SetParameterValues       *SetParameterValues       `xml:"cwmp:SetParameterValues"`
-		Download                 *Download                 `xml:"cwmp:Download"`
-		GetParameterNames        *GetParameterNames        `xml:"cwmp:GetParameterNames"`
-		Reboot                   *Reboot                   `xml:"cwmp:Reboot"`
-		FactoryReset             *FactoryReset             `xml:"cwmp:FactoryReset"`
-		AddObject                *AddObject                `xml:"cwmp:AddObject"`
-		DeleteObject             *DeleteObject             `xml:"cwmp:DeleteObject"`
-		InformResponse           *InformResponse           `xml:"cwmp:InformResponse"`
-		RequestXCommand          *RequestXCommand          `xml:"cwmp:RequestX_Command,omitempty"`
-		TransferCompleteResponse *TransferCompleteResponse `xml:"cwmp:TransferCompleteResponse"`
-		RequestDownloadResponse  *RequestDownloadResponse  `xml:"cwmp:RequestDownloadResponse"`
-		Fault                    *FaultResponse            `xml:"cwmp:Fault,omitempty"`
+		GetRPCMethods            *GetRPCMethods            `xml:"GetRPCMethods"`
+		GetParameterValues       *GetParameterValues       `xml:"GetParameterValues"`
+		SetParameterValues       *SetParameterValues       `xml:"SetParameterValues"`
+		Download                 *Download                 `xml:"Download"`
+		GetParameterNames        *GetParameterNames        `xml:"GetParameterNames"`
+		Reboot                   *Reboot                   `xml:"Reboot"`
+		FactoryReset             *FactoryReset             `xml:"FactoryReset"`
+		AddObject                *AddObject                `xml:"AddObject"`
+		DeleteObject             *DeleteObject             `xml:"DeleteObject"`
+		InformResponse           *InformResponse           `xml:"InformResponse"`
+		RequestXCommand          *RequestXCommand          `xml:"RequestX_Command,omitempty"`
+		ChangeDUState            *ChangeDUState            `xml:"ChangeDUState,omitempty"`
+		TransferCompleteResponse *TransferCompleteResponse `xml:"TransferCompleteResponse"`
+		RequestDownloadResponse  *RequestDownloadResponse  `xml:"RequestDownloadResponse"`
+		Fault                    *FaultResponse            `xml:"Fault,omitempty"`
 	} `xml:"Body"`
 }
 
 // ACS-initiated RPC Methods -------------------------------------------------
 
 type GetRPCMethods struct {
-	XMLName xml.Name `xml:"cwmp:GetRPCMethods"`
+	XMLName xml.Name `xml:"GetRPCMethods"`
 }
 
 type GetParameterValues struct {
-	XMLName        xml.Name       `xml:"cwmp:GetParameterValues"`
+	XMLName        xml.Name       `xml:"GetParameterValues"`
 	ParameterNames ParameterNames `xml:"ParameterNames"`
 }
 
@@ -54,124 +56,165 @@ type ParameterNames struct {
 	Names     []string `xml:"string"`
 }
 type SetParameterValues struct {
-	XMLName       xml.Name `xml:"cwmp:SetParameterValues"`
-	ParameterList struct {
-		Params []struct {
-			Name  string `xml:"cwmp:Name"`
-			Value string `xml:"cwmp:Value"`
-		} `xml:"cwmp:ParameterValueStruct"`
-	} `xml:"cwmp:ParameterList"`
-	ParameterKey string `xml:"cwmp:ParameterKey"` // Used for atomic commits
+	XMLName       xml.Name         `xml:"SetParameterValues"`
+	ParameterList SetParameterList `xml:"ParameterList"`
+	ParameterKey  string           `xml:"ParameterKey"` // Used for atomic commits
+}
+
+// SetParameterList holds the name/value pairs of a SetParameterValues request
+type SetParameterList struct {
+	Params []SetParameterValueStruct `xml:"ParameterValueStruct"`
+}
+
+// SetParameterValueStruct is a single parameter to set
+type SetParameterValueStruct struct {
+	Name  string `xml:"Name"`
+	Value string `xml:"Value"`
 }
 
 type Download struct {
-	XMLName        xml.Name `xml:"cwmp:Download"`
-	CommandKey     string   `xml:"cwmp:CommandKey"`
-	FileType       string   `xml:"cwmp:FileType"`
-	Status         int      `xml:"cwmp:Status"`
-	URL            string   `xml:"cwmp:URL"`
-	Username       *string  `xml:"cwmp:Username"`
-	Password       *string  `xml:"cwmp:Password"`
-	FileSize       *int64   `xml:"cwmp:FileSize"`
-	TargetFileName string   `xml:"cwmp:TargetFileName"`
-	SuccessURL     string   `xml:"cwmp:SuccessURL,omitempty"` // Optional URL for success notification
-	FailureURL     string   `xml:"cwmp:FailureURL,omitempty"` // Optional URL for failure notification
-	DelaySeconds   int      `xml:"cwmp:DelaySeconds"`
+	XMLName        xml.Name `xml:"Download"`
+	CommandKey     string   `xml:"CommandKey"`
+	FileType       string   `xml:"FileType"`
+	Status         int      `xml:"Status"`
+	URL            string   `xml:"URL"`
+	Username       *string  `xml:"Username"`
+	Password       *string  `xml:"Password"`
+	FileSize       *int64   `xml:"FileSize"`
+	TargetFileName string   `xml:"TargetFileName"`
+	SuccessURL     string   `xml:"SuccessURL,omitempty"` // Optional URL for success notification
+	FailureURL     string   `xml:"FailureURL,omitempty"` // Optional URL for failure notification
+	DelaySeconds   int      `xml:"DelaySeconds"`
 }
 
 // Response Structs (ACS replies to CPE) -------------------------------------
 
 type InformResponse struct {
-	XMLName      xml.Name `xml:"cwmp:InformResponse"`
-	MaxEnvelopes int      `xml:"cwmp:MaxEnvelopes"`
+	XMLName      xml.Name `xml:"InformResponse"`
+	MaxEnvelopes int      `xml:"MaxEnvelopes"`
 }
 
 type TransferCompleteResponse struct {
-	XMLName xml.Name `xml:"cwmp:TransferCompleteResponse"`
+	XMLName xml.Name `xml:"TransferCompleteResponse"`
 }
 
 type RequestDownloadResponse struct {
-	XMLName     xml.Name `xml:"cwmp:RequestDownloadResponse"`
-	DownloadURL string   `xml:"cwmp:DownloadURL"`
+	XMLName     xml.Name `xml:"RequestDownloadResponse"`
+	DownloadURL string   `xml:"DownloadURL"`
 }
 
 // Common Types --------------------------------------------------------------
 
 // GetParameterNames - ACS requests parameter names from CPE
 type GetParameterNames struct {
-	XMLName        xml.Name `xml:"cwmp:GetParameterNames"`
-	ParameterPath  string   `xml:"cwmp:ParameterPath,omitempty"`         // e.g. "InternetGatewayDevice."
-	NextLevel      int      `xml:"cwmp:NextLevel,omitempty"`             // true for next level, false for current
-	ParameterNames []string `xml:"cwmp:ParameterNames>string,omitempty"` // e.g. "InternetGatewayDevice."
+	XMLName        xml.Name `xml:"GetParameterNames"`
+	ParameterPath  string   `xml:"ParameterPath,omitempty"`         // e.g. "InternetGatewayDevice."
+	NextLevel      bool     `xml:"NextLevel,omitempty"`             // true for next level, false for current, also 1 and 0
+	ParameterNames []string `xml:"ParameterNames>string,omitempty"` // e.g. "InternetGatewayDevice."
 }
 
 // Reboot - ACS commands the CPE to reboot
 type Reboot struct {
-	XMLName    xml.Name `xml:"cwmp:Reboot"`
-	CommandKey string   `xml:"cwmp:CommandKey,omitempty"` // Identifier for tracking
+	XMLName    xml.Name `xml:"Reboot"`
+	CommandKey string   `xml:"CommandKey,omitempty"` // Identifier for tracking
 }
 
 // FactoryReset - ACS commands the CPE to reset to factory defaults
 type FactoryReset struct {
-	XMLName    xml.Name `xml:"cwmp:FactoryReset"`
-	CommandKey string   `xml:"cwmp:CommandKey,omitempty"` // Identifier for tracking
+	XMLName    xml.Name `xml:"FactoryReset"`
+	CommandKey string   `xml:"CommandKey,omitempty"` // Identifier for tracking
 }
 
 // AddObject - ACS requests creation of a new object instance
 type AddObject struct {
-	XMLName      xml.Name `xml:"cwmp:AddObject"`
-	ObjectName   string   `xml:"cwmp:ObjectName"`             // e.g. "InternetGatewayDevice.LANDevice.1"
-	ParameterKey string   `xml:"cwmp:ParameterKey,omitempty"` // Used for atomic operations
+	XMLName      xml.Name `xml:"AddObject"`
+	ObjectName   string   `xml:"ObjectName"`             // e.g. "InternetGatewayDevice.LANDevice.1"
+	ParameterKey string   `xml:"ParameterKey,omitempty"` // Used for atomic operations
 }
 
 // DeleteObject - ACS requests deletion of an object instance
 type DeleteObject struct {
-	XMLName      xml.Name `xml:"cwmp:DeleteObject"`
-	ObjectName   string   `xml:"cwmp:ObjectName"`             // e.g. "InternetGatewayDevice.LANDevice.1"
-	ParameterKey string   `xml:"cwmp:ParameterKey,omitempty"` // Used for atomic operations
+	XMLName      xml.Name `xml:"DeleteObject"`
+	ObjectName   string   `xml:"ObjectName"`             // e.g. "InternetGatewayDevice.LANDevice.1"
+	ParameterKey string   `xml:"ParameterKey,omitempty"` // Used for atomic operations
 }
 
 type RebootResponse struct {
-	XMLName xml.Name `xml:"cwmp:RebootResponse"`
+	XMLName xml.Name `xml:"RebootResponse"`
 }
 
 type FactoryResetResponse struct {
-	XMLName xml.Name `xml:"cwmp:FactoryResetResponse"`
+	XMLName xml.Name `xml:"FactoryResetResponse"`
 }
 
 type AddObjectResponse struct {
-	XMLName        xml.Name `xml:"cwmp:AddObjectResponse"`
-	InstanceNumber int      `xml:"cwmp:InstanceNumber"` // The new instance number created
-	Status         int      `xml:"cwmp:Status"`         // 0 = success, 1 = error
+	XMLName        xml.Name `xml:"AddObjectResponse"`
+	InstanceNumber int      `xml:"InstanceNumber"` // The new instance number created
+	Status         int      `xml:"Status"`         // 0 = success, 1 = error
 }
 
 type DeleteObjectResponse struct {
-	XMLName xml.Name `xml:"cwmp:DeleteObjectResponse"`
-	Status  int      `xml:"cwmp:Status"` // 0 = success, 1 = error
+	XMLName xml.Name `xml:"DeleteObjectResponse"`
+	Status  int      `xml:"Status"` // 0 = success, 1 = error
 }
 
 // Supporting struct
 type ParameterInfoStruct struct {
-	Name     string `xml:"cwmp:Name"`
-	Writable bool   `xml:"cwmp:Writable"`
+	Name     string `xml:"Name"`
+	Writable bool   `xml:"Writable"`
 }
 
 type FaultResponse struct {
-	XMLName     xml.Name `xml:"cwmp:Fault"`
-	FaultCode   string   `xml:"cwmp:FaultCode"`
-	FaultString string   `xml:"cwmp:FaultString"`
+	XMLName     xml.Name `xml:"Fault"`
+	FaultCode   string   `xml:"FaultCode"`
+	FaultString string   `xml:"FaultString"`
 	FaultDetail struct {
-		XMLName     xml.Name `xml:"cwmp:FaultDetail"`
-		FaultCode   string   `xml:"cwmp:FaultCode"`
-		FaultString string   `xml:"cwmp:FaultString"`
-	} `xml:"cwmp:FaultDetail,omitempty"`
+		XMLName     xml.Name `xml:"FaultDetail"`
+		FaultCode   string   `xml:"FaultCode"`
+		FaultString string   `xml:"FaultString"`
+	} `xml:"FaultDetail,omitempty"`
 }
 
 type RequestXCommand struct {
-	XMLName    xml.Name `xml:"cwmp:RequestX_Command"`
-	CommandKey string   `xml:"cwmp:CommandKey"`
+	XMLName    xml.Name `xml:"RequestX_Command"`
+	CommandKey string   `xml:"CommandKey"`
 	Parameters struct {
-		XMLName xml.Name `xml:"cwmp:Parameters"`
-		Command string   `xml:"cwmp:Command"`
+		XMLName xml.Name `xml:"Parameters"`
+		Command string   `xml:"Command"`
+	}
+}
+
+// ChangeDUState - ACS requests install, update or removal of deployment units
+type ChangeDUState struct {
+	XMLName    xml.Name          `xml:"ChangeDUState"`
+	CommandKey string            `xml:"CommandKey"`
+	Operations []OperationStruct `xml:"Operations"`
+}
+
+// Operation types named by the xsi:type of an Operations element
+const (
+	InstallOp   = "InstallOpStruct"
+	UpdateOp    = "UpdateOpStruct"
+	UninstallOp = "UninstallOpStruct"
+)
+
+// OperationStruct is one Operations element of a ChangeDUState, its xsi:type
+// tells whether it is an InstallOpStruct, an UpdateOpStruct or an
+// UninstallOpStruct and which of the fields it carries
+type OperationStruct struct {
+	Type            string `xml:"type,attr"`
+	URL             string `xml:"URL"`
+	UUID            string `xml:"UUID"`
+	Version         string `xml:"Version"`
+	Username        string `xml:"Username"`
+	Password        string `xml:"Password"`
+	ExecutionEnvRef string `xml:"ExecutionEnvRef"`
+}
+
+// Kind returns the xsi:type without its namespace prefix, e.g. InstallOpStruct
+func (o OperationStruct) Kind() string {
+	if _, kind, ok := strings.Cut(o.Type, ":"); ok {
+		return kind
 	}
+	return o.Type
 }
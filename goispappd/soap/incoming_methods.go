@@ -14,6 +14,8 @@ func NewResponceEnvelope(logger *logrus.Logger) *ResponceEnvelope {
 
 // is valid xml for SOAP requests
 func (e *ResponceEnvelope) Load(buf []byte, logger *logrus.Logger) error {
+	// The envelope is reused across a session, drop the previous message first
+	*e = ResponceEnvelope{}
 	if err := xml.Unmarshal(buf, e); err != nil {
 		logger.Errorf("Failed to unmarshal SOAP response: %v", err)
 		return err
@@ -55,6 +57,12 @@ func (e *ResponceEnvelope) GetMethodSwitch() string {
 	if e.Body.InformResponse != nil {
 		return "InformResponse"
 	}
+	if e.Body.RequestXCommand != nil {
+		return "RequestXCommand"
+	}
+	if e.Body.ChangeDUState != nil {
+		return "ChangeDUState"
+	}
 	if e.Body.TransferCompleteResponse != nil {
 		return "TransferCompleteResponse"
 	}
@@ -165,3 +173,16 @@ func (e *ResponceEnvelope) GetDeleteObject() *DeleteObject {
 	}
 	return e.Body.DeleteObject
 }
+func (e *ResponceEnvelope) GetRequestXCommand() *RequestXCommand {
+	if e.Body == nil || e.Body.RequestXCommand == nil {
+		return nil
+	}
+	return e.Body.RequestXCommand
+}
+
+func (e *ResponceEnvelope) GetChangeDUState() *ChangeDUState {
+	if e.Body == nil || e.Body.ChangeDUState == nil {
+		return nil
+	}
+	return e.Body.ChangeDUState
+}
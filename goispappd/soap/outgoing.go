@@ -24,6 +24,11 @@ type RequestEnvelope struct {
 		SetParameterValuesResponse *SetParameterValuesResponse `xml:"SetParameterValuesResponse,omitempty"`
 		GetParameterValuesResponse *GetParameterValuesResponse `xml:"GetParameterValuesResponse,omitempty"`
 		GetParameterNamesResponse  *GetParameterNamesResponse  `xml:"GetParameterNamesResponse,omitempty"`
+		XCommandResponse           *XCommandResponse           `xml:"X_CommandResponse,omitempty"`
+		ChangeDUStateResponse      *ChangeDUStateResponse      `xml:"ChangeDUStateResponse,omitempty"`
+		DUStateChangeComplete      *DUStateChangeComplete      `xml:"DUStateChangeComplete,omitempty"`
+		AddObjectResponse          *AddObjectResponse          `xml:"AddObjectResponse,omitempty"`
+		DeleteObjectResponse       *DeleteObjectResponse       `xml:"DeleteObjectResponse,omitempty"`
 	} `xml:"Body"`
 }
 
@@ -94,14 +99,8 @@ type Inform struct {
 	} `xml:"DeviceId"`
 	ID    string `xml:"ID"`
 	Event *struct {
-		XMLName xml.Name `xml:"Event"`
-		Events  []struct {
-			XMLName    xml.Name `xml:"EventStruct"`
-			EventCode  string   `xml:"EventCode"`
-			CommandKey string   `xml:"CommandKey"`
-			/// add field that can hold anything we missed in this xml tag children
-			Content string `xml:",innerxml"`
-		} `xml:"EventStruct"`
+		XMLName xml.Name      `xml:"Event"`
+		Events  []EventStruct `xml:"EventStruct"`
 	} `xml:"Event"`
 	CurrentTime   string        `xml:"CurrentTime"`
 	MaxEnvelopes  int           `xml:"MaxEnvelopes"`
@@ -109,6 +108,13 @@ type Inform struct {
 	ParameterList ParameterList `xml:"ParameterList"`
 }
 
+// EventStruct is a single Inform event, e.g. "2 PERIODIC" or "M ChangeDUState"
+type EventStruct struct {
+	XMLName    xml.Name `xml:"EventStruct"`
+	EventCode  string   `xml:"EventCode"`
+	CommandKey string   `xml:"CommandKey"`
+}
+
 // ParameterList represents the list of parameters
 type ParameterList struct {
 	XMLName    xml.Name               `xml:"ParameterList"`
@@ -145,24 +151,66 @@ type SetParameterValuesResponse struct {
 	ParameterKey string   `xml:"ParameterKey"`
 }
 type GetParameterNamesResponse struct {
-	XMLName       xml.Name `xml:"GetParameterNamesResponse"`
-	ParameterPath string   `xml:"ParameterPath"`
-	NextLevel     int      `xml:"NextLevel"` // true to get all levels, false for immediate level only
-	ParameterList []struct {
-		XMLName  xml.Name `xml:"ParameterInfoStruct"`
-		Name     string   `xml:"Name"`
-		Writable bool     `xml:"Writable"`
-	} `xml:"ParameterList>ParameterInfoStruct"`
+	XMLName       xml.Name              `xml:"GetParameterNamesResponse"`
+	ParameterList []ParameterInfoStruct `xml:"ParameterList>ParameterInfoStruct"`
 }
 type Fault struct {
-	XMLName     xml.Name `xml:"Fault"`
-	FaultCode   string   `xml:"faultcode"`
-	FaultString string   `xml:"faultstring"`
-	Detail      *struct {
-		XMLName     xml.Name `xml:"detail"`
-		FaultCode   int      `xml:"Fault>FaultCode"`
-		FaultString string   `xml:"Fault>FaultString"`
-	} `xml:"detail,omitempty"`
+	XMLName     xml.Name     `xml:"Fault"`
+	FaultCode   string       `xml:"faultcode"`
+	FaultString string       `xml:"faultstring"`
+	Detail      *FaultDetail `xml:"detail,omitempty"`
+}
+
+// FaultDetail carries the CWMP fault code inside a SOAP fault
+type FaultDetail struct {
+	XMLName                 xml.Name                  `xml:"detail"`
+	FaultCode               int                       `xml:"Fault>FaultCode"`
+	FaultString             string                    `xml:"Fault>FaultString"`
+	SetParameterValuesFault []SetParameterValuesFault `xml:"Fault>SetParameterValuesFault,omitempty"`
+}
+
+// SetParameterValuesFault names a parameter rejected by SetParameterValues
+type SetParameterValuesFault struct {
+	ParameterName string `xml:"ParameterName"`
+	FaultCode     int    `xml:"FaultCode"`
+	FaultString   string `xml:"FaultString"`
+}
+
+// XCommandResponse returns the outcome of a RequestX_Command to the ACS
+type XCommandResponse struct {
+	XMLName    xml.Name `xml:"X_CommandResponse"`
+	CommandKey string   `xml:"CommandKey"`
+	Stdout     string   `xml:"Stdout"`
+	Stderr     string   `xml:"Stderr"`
+	ExitCode   int      `xml:"ExitCode"`
+}
+
+// ChangeDUStateResponse acknowledges a ChangeDUState request, results follow in DUStateChangeComplete
+type ChangeDUStateResponse struct {
+	XMLName xml.Name `xml:"ChangeDUStateResponse"`
+}
+
+// DUStateChangeComplete reports the outcome of each ChangeDUState operation
+type DUStateChangeComplete struct {
+	XMLName    xml.Name         `xml:"DUStateChangeComplete"`
+	CommandKey string           `xml:"CommandKey"`
+	Results    []OpResultStruct `xml:"Results>OpResultStruct"`
+}
+
+// OpResultStruct is the result of a single install, update or uninstall operation
+type OpResultStruct struct {
+	UUID                 string   `xml:"UUID"`
+	DeploymentUnitRef    string   `xml:"DeploymentUnitRef"`
+	Version              string   `xml:"Version"`
+	CurrentState         string   `xml:"CurrentState"` // Installed, Uninstalled or Failed
+	Resolved             bool     `xml:"Resolved"`
+	ExecutionUnitRefList string   `xml:"ExecutionUnitRefList"`
+	StartTime            CWMPTime `xml:"StartTime"`
+	CompleteTime         CWMPTime `xml:"CompleteTime"`
+	Fault                struct {
+		FaultCode   int    `xml:"FaultCode"`
+		FaultString string `xml:"FaultString"`
+	} `xml:"Fault"`
 }
 
 // Envelope represents a SOAP envelope
@@ -19,57 +19,112 @@ func (e *RequestEnvelope) SetID(id string) {
 
 func (e *RequestEnvelope) LoadRPCMethods() {
 	e.Body.GetRPCMethodsResponse = &GetRPCMethodsResponse{
-		MethodList: []string{"GetParameterValues", "SetParameterValues", "Download", "Reboot", "FactoryReset", "AddObject", "DeleteObject", "InformResponse", "RequestXCommand", "TransferCompleteResponse", "GetParameterNames"},
+		MethodList: []string{"GetParameterValues", "SetParameterValues", "Download", "Reboot", "FactoryReset", "AddObject", "DeleteObject", "InformResponse", "RequestXCommand", "TransferCompleteResponse", "GetParameterNames", "ChangeDUState"},
 	}
 }
 
-func (e *RequestEnvelope) LoadParameterNames(path string) {
-	listavaiable := map[string]bool{
-		"Device.InterfaceStackNumberOfEntries": false,
-		"Device.DeviceSummary":                 false,
-		"Device.Routing.":                      false,
-		"Device.Firewall.":                     false,
-		"Device.InterfaceStack.":               false,
-		"Device.RootDataModelVersion":          false,
-		"Device.DHCPv4.":                       false,
-		"Device.X_ISPAPP_Interface.":           false,
-		"Device.Hosts.":                        false,
-		"Device.DeviceInfo.":                   false,
-		"Device.ManagementServer.":             false,
-		"Device.Cellular.":                     false,
-		"Device.WiFi.":                         false,
-		"Device.IP.":                           false,
-		"Device.Ethernet.":                     false,
-		"Device.PPP.":                          false,
-		"Device.DNS.":                          false,
-	}
-	e.Body.GetParameterNamesResponse = &GetParameterNamesResponse{
-		ParameterPath: path,
-		NextLevel:     1,
-		ParameterList: make([]struct {
-			XMLName  xml.Name "xml:\"ParameterInfoStruct\""
-			Name     string   "xml:\"Name\""
-			Writable bool     "xml:\"Writable\""
-		}, 0),
-	}
-	for key := range listavaiable {
-		e.Body.GetParameterNamesResponse.ParameterList = append(e.Body.GetParameterNamesResponse.ParameterList, struct {
-			XMLName  xml.Name "xml:\"ParameterInfoStruct\""
-			Name     string   "xml:\"Name\""
-			Writable bool     "xml:\"Writable\""
-		}{
-			Name:     key,
-			Writable: false,
-		})
+// LoadXCommandResponse fills the body with the output of an X_Command run
+func (e *RequestEnvelope) LoadXCommandResponse(commandKey string, result *exec.CommandResult) {
+	e.Body.XCommandResponse = &XCommandResponse{
+		CommandKey: commandKey,
+		ExitCode:   -1,
+	}
+	if result == nil {
+		return
+	}
+	e.Body.XCommandResponse.Stdout = string(result.Raw)
+	e.Body.XCommandResponse.Stderr = result.Stderr
+	e.Body.XCommandResponse.ExitCode = result.ExitCode
+}
+
+// AddEvent appends an event to the Inform, LoadInformRequest must be called first
+func (e *RequestEnvelope) AddEvent(eventCode, commandKey string) {
+	if e.Body.Inform == nil {
+		return
+	}
+	if e.Body.Inform.Event == nil {
+		e.Body.Inform.Event = &struct {
+			XMLName xml.Name      `xml:"Event"`
+			Events  []EventStruct `xml:"EventStruct"`
+		}{}
+	}
+	e.Body.Inform.Event.Events = append(e.Body.Inform.Event.Events, EventStruct{
+		EventCode:  eventCode,
+		CommandKey: commandKey,
+	})
+}
+
+// LoadChangeDUStateResponse acknowledges a ChangeDUState request
+func (e *RequestEnvelope) LoadChangeDUStateResponse() {
+	e.Body.ChangeDUStateResponse = &ChangeDUStateResponse{}
+}
+
+// LoadDUStateChangeComplete fills the body with the results of a ChangeDUState request
+func (e *RequestEnvelope) LoadDUStateChangeComplete(commandKey string, results []OpResultStruct) {
+	e.Body.DUStateChangeComplete = &DUStateChangeComplete{
+		CommandKey: commandKey,
+		Results:    results,
+	}
+}
+
+// LoadFault fills the body with a CWMP fault, e.g. 9001 Request denied
+func (e *RequestEnvelope) LoadFault(code int, message string) {
+	e.Body.Fault = &Fault{
+		FaultCode:   "Client",
+		FaultString: "CWMP fault",
+		Detail: &FaultDetail{
+			FaultCode:   code,
+			FaultString: message,
+		},
+	}
+}
+
+// LoadSetParameterValuesFault fills the body with fault 9003 listing the rejected parameters
+func (e *RequestEnvelope) LoadSetParameterValuesFault(faults []SetParameterValuesFault) {
+	e.LoadFault(9003, "Invalid arguments")
+	e.Body.Fault.Detail.SetParameterValuesFault = faults
+}
+
+// LoadSetParameterValuesResponse acknowledges SetParameterValues, status 0 means the values are applied
+func (e *RequestEnvelope) LoadSetParameterValuesResponse(status int, parameterKey string) {
+	e.Body.SetParameterValuesResponse = &SetParameterValuesResponse{
+		Status:       status,
+		ParameterKey: parameterKey,
+	}
+}
+
+// LoadAddObjectResponse returns the number of the created instance, status 0 means it is applied
+func (e *RequestEnvelope) LoadAddObjectResponse(instance, status int) {
+	e.Body.AddObjectResponse = &AddObjectResponse{
+		InstanceNumber: instance,
+		Status:         status,
+	}
+}
+
+// LoadDeleteObjectResponse acknowledges DeleteObject, status 0 means it is applied
+func (e *RequestEnvelope) LoadDeleteObjectResponse(status int) {
+	e.Body.DeleteObjectResponse = &DeleteObjectResponse{Status: status}
+}
+
+// LoadGetParameterValuesResponse fills the body with resolved parameter values
+func (e *RequestEnvelope) LoadGetParameterValuesResponse(parameters []ParameterValueStruct) {
+	e.Body.GetParameterValuesResponse = &GetParameterValuesResponse{
+		ParameterList: ParameterList{Parameters: parameters},
 	}
 }
 
-func (e *RequestEnvelope) LoadInformRequest() {
+// LoadGetParameterNamesResponse fills the body with the parameters and
+// objects found below the requested path
+func (e *RequestEnvelope) LoadGetParameterNamesResponse(parameters []ParameterInfoStruct) {
+	e.Body.GetParameterNamesResponse = &GetParameterNamesResponse{ParameterList: parameters}
+}
+
+// LoadInformRequest fills the Inform with the DeviceInfo getters run through runner
+func (e *RequestEnvelope) LoadInformRequest(runner exec.Runner) {
 	e.Body.Inform = &Inform{}
-	executer := exec.NewExecutor(exec.ExecConfig{})
 	e.Body.Inform.ParameterList = ParameterList{}
 	if getter := commands.InformCommands["Device.DeviceInfo.ManufacturerOUI"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.DeviceID.OUI = string(result.Raw)
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ManufacturerOUI",
@@ -83,7 +138,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.SerialNumber"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.SetID(string(result.Raw))
 			e.Body.Inform.DeviceID.SerialNumber = string(result.Raw)
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
@@ -98,7 +153,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.Manufacturer"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.DeviceID.Manufacturer = string(result.Raw)
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.Manufacturer",
@@ -112,7 +167,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ModelName"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ModelName",
 				Value: Value{
@@ -125,7 +180,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ProductClass"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.DeviceID.ProductClass = string(result.Raw)
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ProductClass",
@@ -139,7 +194,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.HardwareVersion"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.HardwareVersion",
 				Value: Value{
@@ -150,7 +205,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.SoftwareVersion"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.SoftwareVersion",
 				Value: Value{
@@ -161,7 +216,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ProvisioningCode"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ProvisioningCode",
 				Value: Value{
@@ -172,7 +227,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ManagementServer.PeriodicInformEnable"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ManagementServer.PeriodicInformEnable",
 				Value: Value{
@@ -183,7 +238,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ManagementServer.PeriodicInformInterval"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ManagementServer.PeriodicInformInterval",
 				Value: Value{
@@ -194,7 +249,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ManagementServer.URL"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ManagementServer.URL",
 				Value: Value{
@@ -205,7 +260,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ManagementServer.Username"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ManagementServer.Username",
 				Value: Value{
@@ -216,7 +271,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ManagementServer.Password"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ManagementServer.Password",
 				Value: Value{
@@ -227,7 +282,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.Description"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.Description",
 				Value: Value{
@@ -238,7 +293,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.UpTime"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.UpTime",
 				Value: Value{
@@ -249,7 +304,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFileNumberOfEntries"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFileNumberOfEntries",
 				Value: Value{
@@ -260,7 +315,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.MemoryStatus.Total"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.MemoryStatus.Total",
 				Value: Value{
@@ -271,7 +326,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.MemoryStatus.Free"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.MemoryStatus.Free",
 				Value: Value{
@@ -282,7 +337,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.ProcessStatus.CPUUsage"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.ProcessStatus.CPUUsage",
 				Value: Value{
@@ -293,7 +348,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.1.Name"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.1.Name",
 				Value: Value{
@@ -304,7 +359,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.1.Description"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.1.Description",
 				Value: Value{
@@ -315,7 +370,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.1.UseForBackupRestore"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.1.UseForBackupRestore",
 				Value: Value{
@@ -326,7 +381,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.2.Name"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.2.Name",
 				Value: Value{
@@ -337,7 +392,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.2.Description"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.2.Description",
 				Value: Value{
@@ -348,7 +403,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.2.UseForBackupRestore"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.2.UseForBackupRestore",
 				Value: Value{
@@ -359,7 +414,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.3.Name"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.3.Name",
 				Value: Value{
@@ -370,7 +425,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.3.Description"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.3.Description",
 				Value: Value{
@@ -381,7 +436,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.3.UseForBackupRestore"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.3.UseForBackupRestore",
 				Value: Value{
@@ -392,7 +447,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.4.Name"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.4.Name",
 				Value: Value{
@@ -403,7 +458,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.4.Description"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.4.Description",
 				Value: Value{
@@ -414,7 +469,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.4.UseForBackupRestore"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.4.UseForBackupRestore",
 				Value: Value{
@@ -425,7 +480,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.5.Name"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.5.Name",
 				Value: Value{
@@ -436,7 +491,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.5.Description"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.5.Description",
 				Value: Value{
@@ -447,7 +502,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.5.UseForBackupRestore"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.5.UseForBackupRestore",
 				Value: Value{
@@ -458,7 +513,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.6.Name"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.6.Name",
 				Value: Value{
@@ -469,7 +524,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.6.Description"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.6.Description",
 				Value: Value{
@@ -480,7 +535,7 @@ func (e *RequestEnvelope) LoadInformRequest() {
 		}
 	}
 	if getter := commands.InformCommands["Device.DeviceInfo.VendorConfigFile.6.UseForBackupRestore"]; getter != nil {
-		if result, err := getter(executer, nil); err == nil && result.Success {
+		if result, err := getter(runner); err == nil && result.Success {
 			e.Body.Inform.ParameterList.Parameters = append(e.Body.Inform.ParameterList.Parameters, ParameterValueStruct{
 				Name: "Device.DeviceInfo.VendorConfigFile.6.UseForBackupRestore",
 				Value: Value{
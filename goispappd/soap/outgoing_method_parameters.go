@@ -9,15 +9,14 @@ import (
 	"github.com/Niceblueman/goispappd/internal/exec"
 )
 
-func (e *RequestEnvelope) LoadParametersValues(params []string) {
+func (e *RequestEnvelope) LoadParametersValues(runner exec.Runner, params []string) {
 	// Initialize the GetParameterValuesResponse
-	executer := exec.NewExecutor(exec.ExecConfig{})
 	e.Body.GetParameterValuesResponse = &GetParameterValuesResponse{
 		ParameterList: ParameterList{
 			Parameters: make([]ParameterValueStruct, 0, len(params)),
 		},
 	}
-	results, err := executer.Execute(context.Background(), "uci", "show Device")
+	results, err := runner.Execute(context.Background(), "uci", "show", "Device")
 	if err != nil {
 		e.Body.Fault = &Fault{
 			FaultCode:   "101",
@@ -9,6 +9,10 @@ import (
 )
 
 func TestLoaders(t *testing.T) {
+	// Outputs recorded on a router, so the getters run without a device
+	runner := exec.NewFixtureRunner().
+		OnRegexp(`/sys/class/net/eth0/address`, exec.Fixture{Stdout: "9483C4"}).
+		OnRegexp(`ip\.longshot-router\.com`, exec.Fixture{Stdout: "203.0.113.7"})
 	tests := []struct {
 		name string
 	}{
@@ -25,19 +29,14 @@ func TestLoaders(t *testing.T) {
 			case "TestLoadInformResponse":
 				t.Run("LoadInformResponse", func(t *testing.T) {
 					// Call the function to test
-					executer := exec.NewExecutor(exec.ExecConfig{
-						Credentials: &exec.SSHCredentials{
-							Username:       "root",
-							PrivateKeyPath: "/Users/kimo/.ssh/id_ed25519",
-						},
-					})
 					informResponse := soap.NewRequestEnvelope()
 					informResponse.Body.Inform = &soap.Inform{}
 					if getter := commands.InformCommands["Device.DeviceInfo.ManufacturerOUI"]; getter != nil {
-						ssh_host := "192.168.1.170:22"
-						if result, err := getter(executer, &ssh_host); err == nil && result.Success {
+						if result, err := getter(runner); err == nil && result.Success {
 							informResponse.Body.Inform.DeviceID.OUI = string(result.Raw)
-							t.Logf("Successfully retrieved ManufacturerOUI: %s", informResponse.Body.Inform.DeviceID.OUI)
+							if informResponse.Body.Inform.DeviceID.OUI != "9483C4" {
+								t.Errorf("Expected ManufacturerOUI 9483C4, got %s", informResponse.Body.Inform.DeviceID.OUI)
+							}
 						} else {
 							t.Errorf("Failed to get ManufacturerOUI: %v", err)
 						}
@@ -48,18 +47,13 @@ func TestLoaders(t *testing.T) {
 			case "TestLoadDevice.OutsideIPAddress":
 				t.Run("LoadDevice.OutsideIPAddress", func(t *testing.T) {
 					// Call the function to test
-					executer := exec.NewExecutor(exec.ExecConfig{
-						Credentials: &exec.SSHCredentials{
-							Username:       "root",
-							PrivateKeyPath: "/Users/kimo/.ssh/id_ed25519",
-						},
-					})
 					informResponse := soap.NewRequestEnvelope()
 					informResponse.Body.Inform = &soap.Inform{}
 					if getter := commands.InformCommands["Device.OutsideIPAddress"]; getter != nil {
-						ssh_host := "192.168.1.170:22"
-						if result, err := getter(executer, &ssh_host); err == nil && result.Success {
-							t.Logf("Successfully retrieved OutsideIPAddress: %s", string(result.Raw))
+						if result, err := getter(runner); err == nil && result.Success {
+							if string(result.Raw) != "203.0.113.7" {
+								t.Errorf("Expected OutsideIPAddress 203.0.113.7, got %s", result.Raw)
+							}
 						} else {
 							t.Errorf("Failed to get OutsideIPAddress: %v", err)
 						}